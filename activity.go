@@ -0,0 +1,180 @@
+package adb
+
+import (
+	"bufio"
+	"strconv"
+	"strings"
+
+	"github.com/mqhack/goadb/internal/errors"
+)
+
+// Activity identifies an activity running on the device.
+type Activity struct {
+	Package string
+	// Activity is the fully-qualified class name of the activity, e.g.
+	// "com.android.settings.Settings".
+	Activity string
+	// PID is the process the activity runs in, or zero if it couldn't be determined.
+	PID int
+}
+
+// Component returns the activity's component name, as accepted by am start, e.g.
+// "com.android.settings/.Settings".
+func (a *Activity) Component() string {
+	if strings.HasPrefix(a.Activity, a.Package+".") {
+		return a.Package + "/" + strings.TrimPrefix(a.Activity, a.Package)
+	}
+	return a.Package + "/" + a.Activity
+}
+
+// Prefixes of the lines naming the resumed activity in dumpsys activity activities. Android
+// 12 and later report topResumedActivity, 10 and 11 ResumedActivity, and older versions
+// mResumedActivity, or mFocusedActivity before Android 8.
+var resumedActivityPrefixes = []string{
+	"topResumedActivity=",
+	"ResumedActivity:",
+	"mResumedActivity:",
+	"mFocusedActivity:",
+}
+
+// Prefixes of the lines naming the focused app in dumpsys window, which is used if dumpsys
+// activity activities doesn't report a resumed activity.
+var focusedWindowPrefixes = []string{
+	"mFocusedApp=",
+	"mCurrentFocus=",
+}
+
+/*
+CurrentActivity returns the activity in the foreground, i.e. the resumed activity that has
+input focus.
+
+The resumed activity is read from dumpsys activity activities, which also reports its process.
+If that fails, e.g. on builds where dumpsys activity is restricted, the focused window from
+dumpsys window is used, and PID is zero.
+
+Corresponds to the command:
+
+	adb shell dumpsys activity activities
+*/
+func (c *Device) CurrentActivity() (*Activity, error) {
+	output, err := c.RunCommand("dumpsys", "activity", "activities")
+	if err != nil {
+		return nil, wrapClientError(err, c, "CurrentActivity")
+	}
+	if activity, ok := parseResumedActivity(output); ok {
+		return activity, nil
+	}
+
+	output, err = c.RunCommand("dumpsys", "window")
+	if err != nil {
+		return nil, wrapClientError(err, c, "CurrentActivity")
+	}
+	activity, err := parseFocusedWindow(output)
+	return activity, wrapClientError(err, c, "CurrentActivity")
+}
+
+// parseResumedActivity finds the resumed activity in the output of dumpsys activity
+// activities, e.g.
+//
+//	Hist #0: ActivityRecord{8a4e0c1 u0 com.android.settings/.Settings t23}
+//	  app=ProcessRecord{3f2b9d6 4121:com.android.settings/1000}
+//	...
+//	mResumedActivity: ActivityRecord{8a4e0c1 u0 com.android.settings/.Settings t23}
+//
+// The PID is taken from the app line of the activity's record.
+func parseResumedActivity(output string) (*Activity, bool) {
+	var resumed *Activity
+	var resumedToken string
+	pids := map[string]int{}
+	var recordToken string
+
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if resumed == nil {
+			for _, prefix := range resumedActivityPrefixes {
+				if strings.HasPrefix(line, prefix) {
+					resumed, resumedToken = parseActivityRecord(strings.TrimPrefix(line, prefix))
+					break
+				}
+			}
+		}
+
+		if strings.HasPrefix(line, "* ") && strings.Contains(line, "ActivityRecord{") {
+			_, recordToken = parseActivityRecord(line)
+		} else if value := strings.TrimPrefix(line, "app=ProcessRecord{"); value != line && recordToken != "" {
+			if pid, ok := parseProcessRecordPID(value); ok {
+				pids[recordToken] = pid
+			}
+			recordToken = ""
+		}
+	}
+
+	if resumed == nil {
+		return nil, false
+	}
+	resumed.PID = pids[resumedToken]
+	return resumed, true
+}
+
+// parseFocusedWindow finds the focused app in the output of dumpsys window, e.g.
+//
+//	mFocusedApp=ActivityRecord{8a4e0c1 u0 com.android.settings/.Settings t23}
+//	mCurrentFocus=Window{51b0c4d u0 com.android.settings/com.android.settings.Settings}
+func parseFocusedWindow(output string) (*Activity, error) {
+	for _, prefix := range focusedWindowPrefixes {
+		scanner := bufio.NewScanner(strings.NewReader(output))
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if value := strings.TrimPrefix(line, prefix); value != line {
+				if activity, _ := parseActivityRecord(value); activity != nil {
+					return activity, nil
+				}
+			}
+		}
+	}
+	return nil, errors.Errorf(errors.ParseError, "no foreground activity in dumpsys output")
+}
+
+// parseActivityRecord returns the activity named by the first component in record, e.g.
+// "ActivityRecord{8a4e0c1 u0 com.android.settings/.Settings t23}", and the record's hash code,
+// which identifies it across the dumpsys output. Returns nil if record has no component, e.g.
+// for windows that don't belong to an app, like "Window{51b0c4d u0 StatusBar}".
+func parseActivityRecord(record string) (*Activity, string) {
+	start := strings.Index(record, "{")
+	if start < 0 {
+		return nil, ""
+	}
+	fields := strings.Fields(strings.TrimRight(record[start+1:], "}"))
+	if len(fields) == 0 {
+		return nil, ""
+	}
+	for _, field := range fields[1:] {
+		field = strings.TrimRight(field, "}")
+		pkg, class, ok := strings.Cut(field, "/")
+		if !ok || pkg == "" || class == "" {
+			continue
+		}
+		if strings.HasPrefix(class, ".") {
+			class = pkg + class
+		}
+		return &Activity{Package: pkg, Activity: class}, fields[0]
+	}
+	return nil, fields[0]
+}
+
+// parseProcessRecordPID returns the PID from the body of a process record, e.g.
+// "3f2b9d6 4121:com.android.settings/1000}".
+func parseProcessRecordPID(record string) (int, bool) {
+	fields := strings.Fields(record)
+	if len(fields) < 2 {
+		return 0, false
+	}
+	pid, _, ok := strings.Cut(fields[1], ":")
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.Atoi(pid)
+	return n, err == nil && n > 0
+}
@@ -0,0 +1,76 @@
+package adb
+
+import (
+	"testing"
+
+	"github.com/mqhack/goadb/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const dumpsysActivitiesQ = `ACTIVITY MANAGER ACTIVITIES (dumpsys activity activities)
+Display #0 (activities from top to bottom):
+  Stack #23: type=standard mode=fullscreen
+    * TaskRecord{b1d9e2 #23 A=com.android.settings U=0 StackId=23 sz=1}
+      * Hist #0: ActivityRecord{8a4e0c1 u0 com.android.settings/.Settings t23}
+          packageName=com.android.settings processName=com.android.settings
+          app=ProcessRecord{3f2b9d6 4121:com.android.settings/1000}
+  Stack #0: type=home mode=fullscreen
+      * Hist #0: ActivityRecord{71c3f0a u0 com.google.android.apps.nexuslauncher/.NexusLauncherActivity t2}
+          app=ProcessRecord{e0d9a87 1873:com.google.android.apps.nexuslauncher/u0a110}
+
+    mResumedActivity: ActivityRecord{8a4e0c1 u0 com.android.settings/.Settings t23}
+`
+
+const dumpsysActivitiesU = `ACTIVITY MANAGER ACTIVITIES (dumpsys activity activities)
+Display #0 (activities from top to bottom):
+  * Task{5d3bb1f #41 type=standard A=10178:com.example.app}
+    topResumedActivity=ActivityRecord{2c1e8f4 u0 com.example.app/com.example.app.ui.MainActivity t41}
+    * Hist  #0: ActivityRecord{2c1e8f4 u0 com.example.app/com.example.app.ui.MainActivity t41}
+      app=ProcessRecord{9b6f2a1 12077:com.example.app/u0a178}
+`
+
+func TestParseResumedActivity(t *testing.T) {
+	activity, ok := parseResumedActivity(dumpsysActivitiesQ)
+	require.True(t, ok)
+	assert.Equal(t, &Activity{Package: "com.android.settings", Activity: "com.android.settings.Settings", PID: 4121}, activity)
+	assert.Equal(t, "com.android.settings/.Settings", activity.Component())
+
+	activity, ok = parseResumedActivity(dumpsysActivitiesU)
+	require.True(t, ok)
+	assert.Equal(t, &Activity{Package: "com.example.app", Activity: "com.example.app.ui.MainActivity", PID: 12077}, activity)
+	assert.Equal(t, "com.example.app/.ui.MainActivity", activity.Component())
+
+	_, ok = parseResumedActivity("Permission Denial: can't dump ActivityManager\n")
+	assert.False(t, ok)
+}
+
+func TestParseFocusedWindow(t *testing.T) {
+	activity, err := parseFocusedWindow(`WINDOW MANAGER WINDOWS (dumpsys window windows)
+  mCurrentFocus=Window{51b0c4d u0 com.android.settings/com.android.settings.SubSettings}
+  mFocusedApp=AppWindowToken{7fbc1e3 token=Token{e6c4b92 ActivityRecord{8a4e0c1 u0 com.android.settings/.Settings t23}}}
+`)
+	require.NoError(t, err)
+	assert.Equal(t, &Activity{Package: "com.android.settings", Activity: "com.android.settings.Settings"}, activity)
+
+	activity, err = parseFocusedWindow("  mCurrentFocus=Window{51b0c4d u0 com.android.chrome/org.chromium.chrome.browser.ChromeTabbedActivity}\n")
+	require.NoError(t, err)
+	assert.Equal(t, "com.android.chrome/org.chromium.chrome.browser.ChromeTabbedActivity", activity.Component())
+
+	_, err = parseFocusedWindow("  mCurrentFocus=Window{51b0c4d u0 StatusBar}\n")
+	assert.EqualError(t, err, "ParseError: no foreground activity in dumpsys output")
+}
+
+func TestCurrentActivity(t *testing.T) {
+	s := &MockServer{
+		Status:   wire.StatusSuccess,
+		Messages: []string{dumpsysActivitiesQ},
+	}
+	device := (&Adb{server: s}).Device(AnyDevice())
+
+	activity, err := device.CurrentActivity()
+	require.NoError(t, err)
+	assert.Equal(t, "com.android.settings", activity.Package)
+	assert.Equal(t, 4121, activity.PID)
+	assert.Equal(t, "shell:dumpsys activity activities", s.Requests[1])
+}
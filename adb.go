@@ -21,6 +21,23 @@ See list of services at https://android.googlesource.com/platform/system/core/+/
 // TODO(z): Finish implementing host services.
 type Adb struct {
 	server server
+
+	// Nil unless ServerConfig.DeviceListCacheTTL is set.
+	deviceListCache *deviceListCache
+
+	compressionPreference []string
+
+	// Holds the transcript started by BeginTranscript, which server records connections in.
+	transcripts *transcriptRecorder
+
+	// From ServerConfig.StrictParsing.
+	strictParsing bool
+
+	// Shared with devices, so they can check requests are allowed by the server.
+	restrictions *serverRestrictions
+
+	// From ServerConfig.Resolver. Nil if the server resolves host names.
+	resolver Resolver
 }
 
 // New creates a new Adb client that uses the default ServerConfig.
@@ -33,7 +50,19 @@ func NewWithConfig(config ServerConfig) (*Adb, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &Adb{server}, nil
+	transcripts := &transcriptRecorder{}
+	adb := &Adb{
+		server:                &transcribingServer{server: server, recorder: transcripts},
+		compressionPreference: config.CompressionPreference,
+		transcripts:           transcripts,
+		strictParsing:         config.StrictParsing,
+		restrictions:          newServerRestrictions(config.OneDevice),
+		resolver:              config.Resolver,
+	}
+	if config.DeviceListCacheTTL > 0 {
+		adb.deviceListCache = newDeviceListCache(config.DeviceListCacheTTL)
+	}
+	return adb, nil
 }
 
 // Dial establishes a connection with the adb server.
@@ -51,11 +80,24 @@ func (c *Adb) Device(descriptor DeviceDescriptor) *Device {
 		server:         c.server,
 		descriptor:     descriptor,
 		deviceListFunc: c.ListDevices,
+
+		compressionPreference: c.compressionPreference,
+		restrictions:          c.serverRestrictions(),
+		resources:             newDeviceResources(),
 	}
 }
 
+// NewDeviceWatcher starts watching for device state changes. Changes it reports also
+// invalidate the device list cache.
 func (c *Adb) NewDeviceWatcher() *DeviceWatcher {
-	return newDeviceWatcher(c.server)
+	return newDeviceWatcher(c.server, c.deviceListCache.invalidate, c.strictParsing)
+}
+
+// InvalidateDeviceListCache makes the next call to ListDevices or ListDeviceSerials ask the
+// server, even if ServerConfig.DeviceListCacheTTL hasn't passed. It does nothing if the cache
+// is disabled.
+func (c *Adb) InvalidateDeviceListCache() {
+	c.deviceListCache.invalidate()
 }
 
 // ServerVersion asks the ADB server for its internal version number.
@@ -101,12 +143,12 @@ Corresponds to the command:
 	adb devices
 */
 func (c *Adb) ListDeviceSerials() ([]string, error) {
-	resp, err := roundTripSingleResponse(c.server, "host:devices")
+	resp, err := c.deviceListCache.roundTrip(c.server, "host:devices")
 	if err != nil {
 		return nil, wrapClientError(err, c, "ListDeviceSerials")
 	}
 
-	devices, err := parseDeviceList(string(resp), parseDeviceShort)
+	devices, err := parseDeviceList(string(resp), false, c.strictParsing)
 	if err != nil {
 		return nil, wrapClientError(err, c, "ListDeviceSerials")
 	}
@@ -126,49 +168,18 @@ Corresponds to the command:
 	adb devices -l
 */
 func (c *Adb) ListDevices() ([]*DeviceInfo, error) {
-	resp, err := roundTripSingleResponse(c.server, "host:devices-l")
+	resp, err := c.deviceListCache.roundTrip(c.server, "host:devices-l")
 	if err != nil {
 		return nil, wrapClientError(err, c, "ListDevices")
 	}
 
-	devices, err := parseDeviceList(string(resp), parseDeviceLong)
+	devices, err := parseDeviceList(string(resp), true, c.strictParsing)
 	if err != nil {
 		return nil, wrapClientError(err, c, "ListDevices")
 	}
 	return devices, nil
 }
 
-func (c *Adb) ListForwards() ([]*DeviceInfo, error) {
-	resp, err := roundTripSingleResponse(c.server, "host:list-forward")
-	if err != nil {
-		return nil, wrapClientError(err, c, "ListForwards")
-	}
-
-	fmt.Printf("forward resp: %s\n", string(resp))
-	// devices, err := parseDeviceList(string(resp), parseDeviceLong)
-	// if err != nil {
-	// 	return nil, wrapClientError(err, c, "ListDevices")
-	// }
-	// return devices, nil
-
-	return nil, nil
-}
-
-/*
-Connect connect to a device via TCP/IP
-
-Corresponds to the command:
-
-	adb connect
-*/
-func (c *Adb) Connect(host string, port int) error {
-	_, err := roundTripSingleResponse(c.server, fmt.Sprintf("host:connect:%s:%d", host, port))
-	if err != nil {
-		return wrapClientError(err, c, "Connect")
-	}
-	return nil
-}
-
 func (c *Adb) parseServerVersion(versionRaw []byte) (int, error) {
 	versionStr := string(versionRaw)
 	version, err := strconv.ParseInt(versionStr, 16, 32)
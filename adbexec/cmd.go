@@ -0,0 +1,351 @@
+package adbexec
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+
+	"github.com/mqhack/goadb/internal/errors"
+	"github.com/mqhack/goadb/wire"
+)
+
+// stdinChunkSize is the maximum amount of stdin data sent in a single packet.
+// It's deliberately small so that it fits in the shell buffer of any adbd version.
+const stdinChunkSize = 4096
+
+// Device is the part of *adb.Device that Cmd needs to run commands.
+type Device interface {
+	OpenShell(cmd string, args ...string) (*wire.ShellConn, error)
+}
+
+/*
+Cmd represents a command being prepared or run on a device.
+
+A Cmd cannot be reused after calling its Run, Output or CombinedOutput methods.
+*/
+type Cmd struct {
+	// Path is the command to run. It is resolved by the device's shell.
+	Path string
+
+	// Args holds command line arguments, including the command as Args[0].
+	Args []string
+
+	// Stdin specifies the command's standard input. If nil, the command reads from an
+	// empty stream.
+	Stdin io.Reader
+
+	// Stdout and Stderr specify the command's standard output and error.
+	// If either is nil, the corresponding output is discarded.
+	Stdout io.Writer
+	Stderr io.Writer
+
+	// Process is the underlying process, once started.
+	Process *Process
+
+	// ProcessState contains information about an exited process, available after a call
+	// to Wait or Run.
+	ProcessState *ProcessState
+
+	device Device
+	ctx    context.Context
+
+	// Pipe writers that are closed once the command's output has been fully read.
+	closeAfterOutput []*io.PipeWriter
+	// Pipe ends that are closed by Wait.
+	closeAfterWait []io.Closer
+
+	done      chan outputResult
+	stdinDone chan struct{}
+	ctxDone   chan struct{}
+	waitOnce  sync.Once
+	waited    bool
+}
+
+type outputResult struct {
+	exitCode int
+	err      error
+}
+
+// Command returns the Cmd struct to execute the named program with the given arguments
+// on device.
+func Command(device Device, name string, arg ...string) *Cmd {
+	return &Cmd{
+		Path:   name,
+		Args:   append([]string{name}, arg...),
+		device: device,
+	}
+}
+
+// CommandContext is like Command but includes a context. The process is killed if the
+// context is done before the command completes on its own.
+func CommandContext(ctx context.Context, device Device, name string, arg ...string) *Cmd {
+	if ctx == nil {
+		panic("nil Context")
+	}
+	cmd := Command(device, name, arg...)
+	cmd.ctx = ctx
+	return cmd
+}
+
+// Run starts the specified command and waits for it to complete.
+// If the command exits with a non-zero status, the error is of type *ExitError.
+func (c *Cmd) Run() error {
+	if err := c.Start(); err != nil {
+		return err
+	}
+	return c.Wait()
+}
+
+// Output runs the command and returns its standard output.
+// If c.Stderr was nil and the command fails, the returned *ExitError contains the
+// command's standard error.
+func (c *Cmd) Output() ([]byte, error) {
+	if c.Stdout != nil {
+		return nil, errors.AssertionErrorf("adbexec: Stdout already set")
+	}
+	var stdout, stderr bytes.Buffer
+	c.Stdout = &stdout
+
+	captureErr := c.Stderr == nil
+	if captureErr {
+		c.Stderr = &stderr
+	}
+
+	err := c.Run()
+	if exitErr, ok := err.(*ExitError); ok && captureErr {
+		exitErr.Stderr = stderr.Bytes()
+	}
+	return stdout.Bytes(), err
+}
+
+// CombinedOutput runs the command and returns its combined standard output and
+// standard error.
+func (c *Cmd) CombinedOutput() ([]byte, error) {
+	if c.Stdout != nil {
+		return nil, errors.AssertionErrorf("adbexec: Stdout already set")
+	}
+	if c.Stderr != nil {
+		return nil, errors.AssertionErrorf("adbexec: Stderr already set")
+	}
+	var output bytes.Buffer
+	c.Stdout = &output
+	c.Stderr = &output
+
+	err := c.Run()
+	return output.Bytes(), err
+}
+
+// StdinPipe returns a pipe that will be connected to the command's standard input when
+// the command starts. Closing the pipe sends EOF to the command. The pipe is closed
+// automatically by Wait.
+func (c *Cmd) StdinPipe() (io.WriteCloser, error) {
+	if c.Stdin != nil {
+		return nil, errors.AssertionErrorf("adbexec: Stdin already set")
+	}
+	if c.Process != nil {
+		return nil, errors.AssertionErrorf("adbexec: StdinPipe after process started")
+	}
+	pr, pw := io.Pipe()
+	c.Stdin = pr
+	c.closeAfterWait = append(c.closeAfterWait, pw)
+	return pw, nil
+}
+
+// StdoutPipe returns a pipe that will be connected to the command's standard output when
+// the command starts. The pipe returns EOF once the command has exited and all its output
+// has been read. All reads from the pipe must complete before calling Wait.
+func (c *Cmd) StdoutPipe() (io.ReadCloser, error) {
+	if c.Stdout != nil {
+		return nil, errors.AssertionErrorf("adbexec: Stdout already set")
+	}
+	if c.Process != nil {
+		return nil, errors.AssertionErrorf("adbexec: StdoutPipe after process started")
+	}
+	pr, pw := io.Pipe()
+	c.Stdout = pw
+	c.closeAfterOutput = append(c.closeAfterOutput, pw)
+	c.closeAfterWait = append(c.closeAfterWait, pr)
+	return pr, nil
+}
+
+// StderrPipe is like StdoutPipe, but for the command's standard error.
+func (c *Cmd) StderrPipe() (io.ReadCloser, error) {
+	if c.Stderr != nil {
+		return nil, errors.AssertionErrorf("adbexec: Stderr already set")
+	}
+	if c.Process != nil {
+		return nil, errors.AssertionErrorf("adbexec: StderrPipe after process started")
+	}
+	pr, pw := io.Pipe()
+	c.Stderr = pw
+	c.closeAfterOutput = append(c.closeAfterOutput, pw)
+	c.closeAfterWait = append(c.closeAfterWait, pr)
+	return pr, nil
+}
+
+// Start starts the specified command but does not wait for it to complete.
+// After a successful call to Start the Wait method must be called in order to release
+// the connection to the device.
+func (c *Cmd) Start() error {
+	if c.Process != nil {
+		return errors.AssertionErrorf("adbexec: already started")
+	}
+	if c.ctx != nil {
+		select {
+		case <-c.ctx.Done():
+			c.closeAll()
+			return c.ctx.Err()
+		default:
+		}
+	}
+
+	conn, err := c.device.OpenShell(c.Path, c.Args[1:]...)
+	if err != nil {
+		c.closeAll()
+		return err
+	}
+	c.Process = &Process{conn: conn}
+
+	c.stdinDone = make(chan struct{})
+	if c.Stdin != nil {
+		go func() {
+			c.copyStdin(conn)
+			close(c.stdinDone)
+		}()
+	} else {
+		close(c.stdinDone)
+		// Send EOF immediately so commands that read stdin don't block forever.
+		// If this fails, the error will also be reported by the output reader.
+		conn.SendPacket(wire.ShellIDCloseStdin, nil)
+	}
+
+	c.done = make(chan outputResult, 1)
+	go func() {
+		code, err := c.readOutput(conn)
+		for _, pw := range c.closeAfterOutput {
+			pw.Close()
+		}
+		c.done <- outputResult{code, err}
+	}()
+
+	if c.ctx != nil {
+		c.ctxDone = make(chan struct{})
+		go func() {
+			select {
+			case <-c.ctx.Done():
+				c.Process.Kill()
+			case <-c.ctxDone:
+			}
+		}()
+	}
+
+	return nil
+}
+
+// Wait waits for the command to exit, for its output to be fully copied, and for any
+// copying of Stdin to complete. The command must have been started by Start, and Wait
+// can only be called once: later calls return an error, whatever the first one returned.
+//
+// If the command exits with a non-zero status or is killed, the error is of
+// type *ExitError.
+func (c *Cmd) Wait() error {
+	if c.Process == nil {
+		return errors.AssertionErrorf("adbexec: not started")
+	}
+	if c.waited {
+		return errors.AssertionErrorf("adbexec: Wait was already called")
+	}
+	// Set even if Wait fails, since there's nothing left to receive from c.done.
+	c.waited = true
+
+	result := <-c.done
+	if c.ctxDone != nil {
+		close(c.ctxDone)
+	}
+	// Closing the pipes unblocks copyStdin if it's reading from a StdinPipe.
+	c.closeAll()
+	<-c.stdinDone
+	c.Process.conn.Close()
+
+	if c.Process.wasKilled() {
+		c.ProcessState = &ProcessState{exitCode: -1, killed: true}
+		if c.ctx != nil && c.ctx.Err() != nil {
+			return c.ctx.Err()
+		}
+		return &ExitError{ProcessState: c.ProcessState}
+	}
+	if result.err != nil {
+		return result.err
+	}
+
+	c.ProcessState = &ProcessState{exitCode: result.exitCode}
+	if !c.ProcessState.Success() {
+		return &ExitError{ProcessState: c.ProcessState}
+	}
+	return nil
+}
+
+func (c *Cmd) closeAll() {
+	c.waitOnce.Do(func() {
+		for _, closer := range c.closeAfterWait {
+			closer.Close()
+		}
+	})
+}
+
+// copyStdin sends everything read from c.Stdin to the command, followed by EOF.
+// Errors are not reported: if the connection is broken, readOutput will see it too.
+func (c *Cmd) copyStdin(conn *wire.ShellConn) {
+	buf := make([]byte, stdinChunkSize)
+	for {
+		n, err := c.Stdin.Read(buf)
+		if n > 0 {
+			if sendErr := conn.SendPacket(wire.ShellIDStdin, buf[:n]); sendErr != nil {
+				return
+			}
+		}
+		if err != nil {
+			// Either EOF or a read error, either way there's no more input.
+			conn.SendPacket(wire.ShellIDCloseStdin, nil)
+			return
+		}
+	}
+}
+
+// readOutput copies stdout and stderr packets to their writers until the exit packet
+// is received, and returns the exit code.
+func (c *Cmd) readOutput(conn *wire.ShellConn) (int, error) {
+	for {
+		id, data, err := conn.ReadPacket()
+		if err != nil {
+			return 0, errors.WrapErrf(err, "shell connection closed before command exited")
+		}
+
+		switch id {
+		case wire.ShellIDStdout:
+			if err := writeTo(c.Stdout, data); err != nil {
+				return 0, errors.WrapErrorf(err, errors.AssertionError, "error writing stdout")
+			}
+		case wire.ShellIDStderr:
+			if err := writeTo(c.Stderr, data); err != nil {
+				return 0, errors.WrapErrorf(err, errors.AssertionError, "error writing stderr")
+			}
+		case wire.ShellIDExit:
+			if len(data) != 1 {
+				return 0, errors.Errorf(errors.ParseError, "expected 1 byte exit code, got %d bytes", len(data))
+			}
+			return int(data[0]), nil
+		default:
+			// Ignore packet types that don't apply to non-interactive commands.
+		}
+	}
+}
+
+func writeTo(w io.Writer, data []byte) error {
+	if w == nil {
+		return nil
+	}
+	_, err := w.Write(data)
+	return err
+}
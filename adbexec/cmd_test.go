@@ -0,0 +1,154 @@
+package adbexec
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/mqhack/goadb/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// MockDevice returns a ShellConn that reads the packets in Output and records everything
+// sent in Input.
+type MockDevice struct {
+	Output io.Reader
+	Input  bytes.Buffer
+
+	Cmd  string
+	Args []string
+}
+
+func (d *MockDevice) OpenShell(cmd string, args ...string) (*wire.ShellConn, error) {
+	d.Cmd = cmd
+	d.Args = args
+	return &wire.ShellConn{
+		ShellScanner: wire.NewShellScanner(d.Output),
+		ShellSender:  wire.NewShellSender(&d.Input),
+	}, nil
+}
+
+func packet(id byte, data string) string {
+	header := make([]byte, 5)
+	header[0] = id
+	binary.LittleEndian.PutUint32(header[1:], uint32(len(data)))
+	return string(header) + data
+}
+
+func exitPacket(code byte) string {
+	return packet(wire.ShellIDExit, string([]byte{code}))
+}
+
+func TestOutput(t *testing.T) {
+	dev := &MockDevice{Output: strings.NewReader(
+		packet(wire.ShellIDStdout, "hello ") + packet(wire.ShellIDStderr, "oops") +
+			packet(wire.ShellIDStdout, "world") + exitPacket(0))}
+
+	out, err := Command(dev, "echo", "hello world").Output()
+	assert.NoError(t, err)
+	assert.Equal(t, "hello world", string(out))
+	assert.Equal(t, "echo", dev.Cmd)
+	assert.Equal(t, []string{"hello world"}, dev.Args)
+	// No stdin, so EOF should have been sent right away.
+	assert.Equal(t, packet(wire.ShellIDCloseStdin, ""), dev.Input.String())
+}
+
+func TestCombinedOutput(t *testing.T) {
+	dev := &MockDevice{Output: strings.NewReader(
+		packet(wire.ShellIDStdout, "out ") + packet(wire.ShellIDStderr, "err") + exitPacket(0))}
+
+	out, err := Command(dev, "cmd").CombinedOutput()
+	assert.NoError(t, err)
+	assert.Equal(t, "out err", string(out))
+}
+
+func TestOutputExitError(t *testing.T) {
+	dev := &MockDevice{Output: strings.NewReader(
+		packet(wire.ShellIDStderr, "no such file") + exitPacket(1))}
+
+	cmd := Command(dev, "ls", "/foo")
+	_, err := cmd.Output()
+	require.IsType(t, &ExitError{}, err)
+	exitErr := err.(*ExitError)
+	assert.Equal(t, 1, exitErr.ExitCode())
+	assert.Equal(t, "no such file", string(exitErr.Stderr))
+	assert.EqualError(t, err, "exit status 1")
+	assert.False(t, cmd.ProcessState.Success())
+}
+
+func TestRunWithStdin(t *testing.T) {
+	dev := &MockDevice{Output: strings.NewReader(exitPacket(0))}
+
+	cmd := Command(dev, "cat")
+	cmd.Stdin = strings.NewReader("input")
+	assert.NoError(t, cmd.Run())
+	assert.True(t, cmd.ProcessState.Success())
+	assert.Equal(t, packet(wire.ShellIDStdin, "input")+packet(wire.ShellIDCloseStdin, ""), dev.Input.String())
+}
+
+func TestStdoutPipe(t *testing.T) {
+	dev := &MockDevice{Output: strings.NewReader(
+		packet(wire.ShellIDStdout, "line1\n") + packet(wire.ShellIDStdout, "line2\n") + exitPacket(0))}
+
+	cmd := Command(dev, "cmd")
+	stdout, err := cmd.StdoutPipe()
+	require.NoError(t, err)
+	require.NoError(t, cmd.Start())
+
+	out, err := ioutil.ReadAll(stdout)
+	assert.NoError(t, err)
+	assert.Equal(t, "line1\nline2\n", string(out))
+	assert.NoError(t, cmd.Wait())
+}
+
+func TestConnectionClosedBeforeExit(t *testing.T) {
+	dev := &MockDevice{Output: strings.NewReader(packet(wire.ShellIDStdout, "partial"))}
+
+	cmd := Command(dev, "cmd")
+	err := cmd.Run()
+	assert.Error(t, err)
+	_, isExitErr := err.(*ExitError)
+	assert.False(t, isExitErr)
+	assert.EqualError(t, cmd.Wait(), "AssertionError: adbexec: Wait was already called")
+}
+
+func TestKill(t *testing.T) {
+	pr, _ := io.Pipe()
+	dev := &MockDevice{Output: pr}
+
+	cmd := Command(dev, "sleep", "100")
+	require.NoError(t, cmd.Start())
+	require.NoError(t, cmd.Process.Kill())
+
+	err := cmd.Wait()
+	require.IsType(t, &ExitError{}, err)
+	assert.Equal(t, -1, cmd.ProcessState.ExitCode())
+	assert.EqualError(t, err, "signal: killed")
+}
+
+func TestCommandContextCancel(t *testing.T) {
+	pr, _ := io.Pipe()
+	dev := &MockDevice{Output: pr}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cmd := CommandContext(ctx, dev, "sleep", "100")
+	require.NoError(t, cmd.Start())
+	cancel()
+
+	assert.Equal(t, context.Canceled, cmd.Wait())
+}
+
+func TestStartTwice(t *testing.T) {
+	dev := &MockDevice{Output: strings.NewReader(exitPacket(0))}
+
+	cmd := Command(dev, "cmd")
+	require.NoError(t, cmd.Start())
+	assert.Error(t, cmd.Start())
+	assert.NoError(t, cmd.Wait())
+	assert.Error(t, cmd.Wait())
+}
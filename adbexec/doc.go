@@ -0,0 +1,11 @@
+/*
+Package adbexec runs commands on Android devices with an API modeled on os/exec.
+
+	cmd := adbexec.Command(device, "ls", "-l", "/sdcard")
+	out, err := cmd.Output()
+
+Commands are run using the shell protocol (aka shell v2), so stdout and stderr are kept
+separate, stdin is supported, and the exit code of the command is reported. This requires
+a device running Android N or later.
+*/
+package adbexec
@@ -0,0 +1,63 @@
+package adbexec
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/mqhack/goadb/wire"
+)
+
+// Process represents a command started on a device by Cmd.Start.
+type Process struct {
+	conn   *wire.ShellConn
+	killed int32
+}
+
+// Kill causes the process to exit immediately.
+//
+// The shell protocol has no way to send a signal to a command, so this closes the
+// connection, which causes adbd to send SIGHUP to the process.
+func (p *Process) Kill() error {
+	atomic.StoreInt32(&p.killed, 1)
+	return p.conn.Close()
+}
+
+func (p *Process) wasKilled() bool {
+	return atomic.LoadInt32(&p.killed) == 1
+}
+
+// ProcessState stores information about a command that has exited, as reported by Wait.
+type ProcessState struct {
+	exitCode int
+	killed   bool
+}
+
+// ExitCode returns the exit code of the exited process, or -1 if the process was killed.
+func (p *ProcessState) ExitCode() int {
+	return p.exitCode
+}
+
+// Success reports whether the program exited successfully.
+func (p *ProcessState) Success() bool {
+	return p.exitCode == 0 && !p.killed
+}
+
+func (p *ProcessState) String() string {
+	if p.killed {
+		return "signal: killed"
+	}
+	return fmt.Sprintf("exit status %d", p.exitCode)
+}
+
+// ExitError is returned by Cmd methods when a command exits unsuccessfully.
+type ExitError struct {
+	*ProcessState
+
+	// Stderr holds the standard error output of the command if it was collected by
+	// Cmd.Output.
+	Stderr []byte
+}
+
+func (e *ExitError) Error() string {
+	return e.ProcessState.String()
+}
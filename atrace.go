@@ -0,0 +1,152 @@
+package adb
+
+import (
+	"bufio"
+	"compress/zlib"
+	"context"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mqhack/goadb/internal/errors"
+)
+
+// Size of the kernel trace buffer per CPU used by Atrace, in KB. Big enough for tens of
+// seconds of the common categories; the buffer is circular, so longer traces keep the most
+// recent events.
+const atraceBufferSizeKB = 16384
+
+// Printed by atrace before the trace data.
+const atraceDataMarker = "TRACE:"
+
+/*
+Atrace records a systrace of the given categories for duration, and writes the trace to out
+in the ftrace text format read by systrace and the Perfetto UI. It's an alternative to
+perfetto for devices running Android O or earlier.
+
+The categories are checked against the ones the device supports first, and if any aren't
+supported an error with code RequirementNotMet is returned. If ctx is done before duration
+elapses, tracing is stopped early and the shorter trace is written to out.
+
+Corresponds to the commands:
+
+	adb shell atrace --async_start -c -b <size> <categories>
+	adb shell atrace --async_stop -z
+*/
+func (c *Device) Atrace(ctx context.Context, categories []string, duration time.Duration, out io.Writer) error {
+	if len(categories) == 0 {
+		return errors.AssertionErrorf("at least one atrace category is required")
+	}
+
+	output, err := c.RunCommand("atrace", "--list_categories")
+	if err != nil {
+		return wrapClientError(err, c, "Atrace")
+	}
+	supported := parseAtraceCategories(output)
+	var unsupported []string
+	for _, category := range categories {
+		if !supported[category] {
+			unsupported = append(unsupported, category)
+		}
+	}
+	if len(unsupported) > 0 {
+		err := errors.Errorf(errors.RequirementNotMet, "device doesn't support atrace categories: %s", strings.Join(unsupported, ", "))
+		return wrapClientError(err, c, "Atrace")
+	}
+
+	args := append([]string{"--async_start", "-c", "-b", strconv.Itoa(atraceBufferSizeKB)}, categories...)
+	output, err = c.RunCommand("atrace", args...)
+	if err != nil {
+		// Tracing may have started before the connection failed.
+		c.stopAtrace()
+		return wrapClientError(err, c, "Atrace")
+	}
+	if failure := atraceFailure(output); failure != "" {
+		c.stopAtrace()
+		err := errors.Errorf(errors.AdbError, "error starting atrace: %s", failure)
+		return wrapClientError(err, c, "Atrace")
+	}
+
+	timer := time.NewTimer(duration)
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+		timer.Stop()
+	}
+
+	conn, err := c.openExec("atrace", "--async_stop", "-z")
+	if err != nil {
+		c.stopAtrace()
+		return wrapClientError(err, c, "Atrace")
+	}
+	defer conn.Close()
+	if err := copyAtraceOutput(conn, out); err != nil {
+		// If the connection broke, atrace may have been killed before it stopped tracing.
+		c.stopAtrace()
+		return wrapClientError(err, c, "Atrace")
+	}
+	return nil
+}
+
+// stopAtrace stops tracing and discards the trace, so a failed Atrace doesn't leave the
+// kernel tracing. It's best effort, since it's only used after another error.
+func (c *Device) stopAtrace() {
+	c.RunCommand("atrace --async_stop > /dev/null")
+}
+
+// parseAtraceCategories parses the output of atrace --list_categories, which has lines
+// like "         gfx - Graphics".
+func parseAtraceCategories(output string) map[string]bool {
+	categories := make(map[string]bool)
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		fields := strings.SplitN(strings.TrimSpace(scanner.Text()), " - ", 2)
+		if len(fields) == 2 && fields[0] != "" {
+			categories[fields[0]] = true
+		}
+	}
+	return categories
+}
+
+// atraceFailure returns the first line of atrace output that reports a failure, like "error
+// opening /sys/kernel/tracing/tracing_on: Permission denied (13)", or "" if there isn't one.
+// atrace exits with status 0 for most failures, and only prints them.
+func atraceFailure(output string) string {
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "error") {
+			return line
+		}
+	}
+	return ""
+}
+
+// copyAtraceOutput decompresses the trace in the output of atrace -z to out.
+func copyAtraceOutput(r io.Reader, out io.Writer) error {
+	br := bufio.NewReader(r)
+	var preamble strings.Builder
+	for {
+		line, err := br.ReadString('\n')
+		if strings.TrimSpace(line) == atraceDataMarker {
+			break
+		}
+		preamble.WriteString(line)
+		if err == io.EOF {
+			return errors.Errorf(errors.AdbError, "atrace didn't output a trace: %s", strings.TrimSpace(preamble.String()))
+		} else if err != nil {
+			return errors.WrapErrorf(err, errors.NetworkError, "error reading atrace output")
+		}
+	}
+
+	zr, err := zlib.NewReader(br)
+	if err != nil {
+		return errors.WrapErrorf(err, errors.ParseError, "error decompressing trace")
+	}
+	defer zr.Close()
+	if _, err := io.Copy(out, zr); err != nil {
+		return errors.WrapErrorf(err, errors.ParseError, "error decompressing trace")
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package adb
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mqhack/goadb/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAtraceCategories(t *testing.T) {
+	categories := parseAtraceCategories("         gfx - Graphics\r\n" +
+		"       input - Input\r\n" +
+		"  binder_driver - Binder Kernel driver\r\n" +
+		"garbage\r\n")
+	assert.Equal(t, map[string]bool{"gfx": true, "input": true, "binder_driver": true}, categories)
+}
+
+func TestAtraceFailure(t *testing.T) {
+	assert.Equal(t, "", atraceFailure("capturing trace...\r\n"))
+	assert.Equal(t, "", atraceFailure("Warning: category 'memreclaim' has no error counters\n"))
+	assert.Equal(t, "error opening /sys/kernel/tracing/tracing_on: Permission denied (13)",
+		atraceFailure("capturing trace...\nerror opening /sys/kernel/tracing/tracing_on: Permission denied (13)\r\n"))
+}
+
+func TestCopyAtraceOutput(t *testing.T) {
+	var compressed bytes.Buffer
+	zw := zlib.NewWriter(&compressed)
+	zw.Write([]byte("# tracer: nop\n"))
+	zw.Close()
+
+	var out bytes.Buffer
+	require.NoError(t, copyAtraceOutput(strings.NewReader("capturing trace... done\nTRACE:\n"+compressed.String()), &out))
+	assert.Equal(t, "# tracer: nop\n", out.String())
+
+	err := copyAtraceOutput(strings.NewReader("error: no tracing categories\n"), &out)
+	assert.EqualError(t, err, "AdbError: atrace didn't output a trace: error: no tracing categories")
+}
+
+func TestAtraceUnsupportedCategory(t *testing.T) {
+	s := &MockServer{
+		Status:   wire.StatusSuccess,
+		Messages: []string{"         gfx - Graphics\r\n"},
+	}
+	device := (&Adb{server: s}).Device(AnyDevice())
+
+	err := device.Atrace(context.Background(), []string{"gfx", "sched", "freq"}, time.Second, &bytes.Buffer{})
+	assert.True(t, HasErrCode(err, RequirementNotMet))
+	assert.Contains(t, ErrorWithCauseChain(err), "device doesn't support atrace categories: sched, freq")
+	assert.Equal(t, []string{"host:transport-any", "shell:atrace --list_categories"}, s.Requests)
+}
+
+func TestAtraceStopsTracingWhenStopFails(t *testing.T) {
+	s := &MockServer{
+		Status:          wire.StatusSuccess,
+		SeparateOutputs: true,
+		Messages:        []string{"         gfx - Graphics\n", "", "capturing trace..."},
+	}
+	device := (&Adb{server: s}).Device(AnyDevice())
+
+	err := device.Atrace(context.Background(), []string{"gfx"}, 0, &bytes.Buffer{})
+	assert.True(t, HasErrCode(err, AdbError))
+	assert.Equal(t, []string{
+		"host:transport-any", "shell:atrace --list_categories",
+		"host:transport-any", "shell:atrace --async_start -c -b 16384 gfx",
+		"host:transport-any", "exec:atrace --async_stop -z",
+		"host:transport-any", "shell:atrace --async_stop > /dev/null",
+	}, s.Requests)
+}
@@ -0,0 +1,156 @@
+package adb
+
+import (
+	"bufio"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Battery status reported by dumpsys battery, from android.os.BatteryManager.
+const (
+	batteryStatusCharging = 2
+	batteryStatusFull     = 5
+)
+
+// DeviceBanner identifies a device, for terminal tools to print when they start a session.
+type DeviceBanner struct {
+	Model   string
+	Serial  string
+	Release string
+	// APILevel is zero if ro.build.version.sdk isn't set.
+	APILevel int
+	// Build is ro.build.display.id, e.g. "TQ3A.230805.001".
+	Build string
+
+	// BatteryLevel is the charge percentage, or -1 if it couldn't be read.
+	BatteryLevel int
+	Charging     bool
+
+	// IPAddresses are the IPv4 addresses of the device's network interfaces, excluding
+	// loopback.
+	IPAddresses []string
+}
+
+/*
+Banner collects the information identifying the device for a DeviceBanner.
+
+Only the serial and system properties are required; if the battery or network state can't be
+read, e.g. because dumpsys or ip is missing in recovery, those fields are left unset.
+*/
+func (c *Device) Banner() (*DeviceBanner, error) {
+	serial, err := c.Serial()
+	if err != nil {
+		return nil, wrapClientError(err, c, "Banner")
+	}
+	props, err := c.getProps()
+	if err != nil {
+		return nil, wrapClientError(err, c, "Banner")
+	}
+	banner := newDeviceBanner(serial, props)
+
+	if output, err := c.RunCommand("dumpsys", "battery"); err == nil {
+		banner.BatteryLevel, banner.Charging = parseDumpsysBattery(output)
+	}
+	if output, err := c.RunCommand("ip", "-o", "-4", "addr", "show"); err == nil {
+		banner.IPAddresses = parseIPAddrOutput(output)
+	}
+	return banner, nil
+}
+
+func newDeviceBanner(serial string, props map[string]string) *DeviceBanner {
+	apiLevel, _ := strconv.Atoi(props[PropAPILevel])
+	return &DeviceBanner{
+		Model:        props["ro.product.model"],
+		Serial:       serial,
+		Release:      props["ro.build.version.release"],
+		APILevel:     apiLevel,
+		Build:        props["ro.build.display.id"],
+		BatteryLevel: -1,
+	}
+}
+
+// String formats the banner as a few lines of text, e.g.
+//
+//	Pixel 7 (2B121FDH2004M1)
+//	Android 14 (API 34), build UQ1A.240105.004
+//	Battery 85%, charging
+//	IP 192.168.1.23
+func (b *DeviceBanner) String() string {
+	var lines []string
+	if b.Model != "" {
+		lines = append(lines, fmt.Sprintf("%s (%s)", b.Model, b.Serial))
+	} else {
+		lines = append(lines, b.Serial)
+	}
+
+	var build []string
+	if b.Release != "" {
+		build = append(build, "Android "+b.Release)
+	}
+	if b.APILevel > 0 {
+		build = append(build, fmt.Sprintf("(API %d)", b.APILevel))
+	}
+	if b.Build != "" {
+		if len(build) > 0 {
+			build[len(build)-1] += ","
+		}
+		build = append(build, "build "+b.Build)
+	}
+	if len(build) > 0 {
+		lines = append(lines, strings.Join(build, " "))
+	}
+
+	if b.BatteryLevel >= 0 {
+		battery := fmt.Sprintf("Battery %d%%", b.BatteryLevel)
+		if b.Charging {
+			battery += ", charging"
+		}
+		lines = append(lines, battery)
+	}
+	if len(b.IPAddresses) > 0 {
+		lines = append(lines, "IP "+strings.Join(b.IPAddresses, ", "))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// parseDumpsysBattery returns the battery level and whether it's charging from the output
+// of dumpsys battery. The level is -1 if it's not in the output.
+func parseDumpsysBattery(output string) (level int, charging bool) {
+	level = -1
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), ": ")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "level":
+			if n, err := strconv.Atoi(value); err == nil {
+				level = n
+			}
+		case "status":
+			status, _ := strconv.Atoi(value)
+			charging = status == batteryStatusCharging || status == batteryStatusFull
+		}
+	}
+	return level, charging
+}
+
+// parseIPAddrOutput returns the addresses listed by ip -o -4 addr show, which prints a line
+// per address, e.g.
+//
+//	30: wlan0    inet 192.168.1.23/24 brd 192.168.1.255 scope global wlan0\       valid_lft forever
+func parseIPAddrOutput(output string) []string {
+	var addrs []string
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 || fields[1] == "lo" || fields[2] != "inet" {
+			continue
+		}
+		addr, _, _ := strings.Cut(fields[3], "/")
+		addrs = append(addrs, addr)
+	}
+	return addrs
+}
@@ -0,0 +1,55 @@
+package adb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeviceBannerString(t *testing.T) {
+	banner := newDeviceBanner("2B121FDH2004M1", map[string]string{
+		"ro.product.model":         "Pixel 7",
+		"ro.build.version.release": "14",
+		"ro.build.version.sdk":     "34",
+		"ro.build.display.id":      "UQ1A.240105.004",
+	})
+	banner.BatteryLevel, banner.Charging = 85, true
+	banner.IPAddresses = []string{"192.168.1.23"}
+
+	assert.Equal(t, "Pixel 7 (2B121FDH2004M1)\n"+
+		"Android 14 (API 34), build UQ1A.240105.004\n"+
+		"Battery 85%, charging\n"+
+		"IP 192.168.1.23", banner.String())
+}
+
+func TestDeviceBannerStringMinimal(t *testing.T) {
+	banner := newDeviceBanner("emulator-5554", map[string]string{"ro.build.display.id": "sdk_phone-eng"})
+	assert.Equal(t, "emulator-5554\nbuild sdk_phone-eng", banner.String())
+}
+
+func TestParseDumpsysBattery(t *testing.T) {
+	output := "Current Battery Service state:\r\n" +
+		"  AC powered: false\r\n" +
+		"  USB powered: true\r\n" +
+		"  status: 5\r\n" +
+		"  level: 100\r\n" +
+		"  scale: 100\r\n"
+	level, charging := parseDumpsysBattery(output)
+	assert.Equal(t, 100, level)
+	assert.True(t, charging)
+
+	level, charging = parseDumpsysBattery("  status: 3\n  level: 42\n")
+	assert.Equal(t, 42, level)
+	assert.False(t, charging)
+
+	level, _ = parseDumpsysBattery("Can't find service: battery\n")
+	assert.Equal(t, -1, level)
+}
+
+func TestParseIPAddrOutput(t *testing.T) {
+	output := "1: lo    inet 127.0.0.1/8 scope host lo\\       valid_lft forever preferred_lft forever\n" +
+		"30: wlan0    inet 192.168.1.23/24 brd 192.168.1.255 scope global wlan0\\       valid_lft forever preferred_lft forever\n" +
+		"31: rmnet_data0    inet 10.0.0.7/30 scope global rmnet_data0\\       valid_lft forever preferred_lft forever\n"
+	assert.Equal(t, []string{"192.168.1.23", "10.0.0.7"}, parseIPAddrOutput(output))
+	assert.Empty(t, parseIPAddrOutput("/system/bin/sh: ip: not found\n"))
+}
@@ -0,0 +1,99 @@
+package adb
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/mqhack/goadb/internal/errors"
+)
+
+// The block size dd writes with, which is big enough that it doesn't slow down flash
+// storage.
+const blockDeviceWriteSize = 1 << 20
+
+/*
+WriteBlockDevice writes the data read from r to the start of the block device at devPath,
+e.g. "/dev/block/by-name/vendor_boot_a", and then checks that the device's SHA-256 of that
+many bytes matches the data sent. If progress is set, it's called with the number of bytes
+written so far as they're sent.
+
+The data is piped into dd as root, using su if adbd isn't running as root, over the shell
+protocol so dd gets EOF when r does, which requires Android N or later. It requires a rooted
+or engineering device, and the error has code RequirementNotMet if no way of running
+commands as root works, or ChecksumMismatch if the data on the device doesn't match. If ctx
+is done, the error has code Timeout, and the block device is left partly written.
+
+Corresponds to the command:
+
+	adb shell su 0 dd of=<dev-path>
+*/
+func (c *Device) WriteBlockDevice(ctx context.Context, r io.Reader, devPath string, progress func(written int64)) error {
+	return wrapClientError(c.writeBlockDevice(ctx, r, devPath, progress), c, "WriteBlockDevice(%s)", devPath)
+}
+
+func (c *Device) writeBlockDevice(ctx context.Context, r io.Reader, devPath string, progress func(written int64)) error {
+	level, err := c.rootPrivilegeLevel()
+	if err != nil {
+		return err
+	}
+	return c.writeBlockDeviceAs(ctx, level, r, devPath, progress)
+}
+
+// writeBlockDeviceAs writes the block device like WriteBlockDevice, running dd at level.
+func (c *Device) writeBlockDeviceAs(ctx context.Context, level privilegeLevel, r io.Reader, devPath string,
+	progress func(written int64)) error {
+	quoted := shellQuote(devPath)
+	sum := sha256.New()
+	var written int64
+	stdin := &progressReader{r: io.TeeReader(r, sum), progress: func(n int) {
+		written += int64(n)
+		if progress != nil {
+			progress(written)
+		}
+	}}
+	conn, err := c.openShell(level.wrap("dd of=" + quoted + " bs=" + strconv.Itoa(blockDeviceWriteSize)))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	stop := closeWhenDone(ctx, conn)
+	defer stop()
+
+	// dd doesn't print anything until it's read all its input, so it's sent before any
+	// output is read.
+	err = sendShellStdin(conn, stdin)
+	var result *CommandResult
+	if err == nil {
+		result, err = readCommandResult(conn, 0)
+	}
+	if ctx.Err() != nil {
+		return errors.WrapErrorf(ctx.Err(), errors.Timeout, "writing %s cancelled after %d bytes", devPath, written)
+	}
+	if err != nil {
+		return err
+	}
+	// dd only prints its statistics, to stderr, unless it fails.
+	if result.ExitCode != 0 {
+		stderr := strings.TrimSpace(result.Stderr)
+		return errors.Errorf(fsErrorCode(stderr), "dd exited with code %d: %s", result.ExitCode, stderr)
+	}
+
+	checksum, err := c.runChecksumScript(ChecksumSHA256, level.wrap("head -c "+strconv.FormatInt(written, 10)+" "+quoted+
+		" | { "+checksumScript(ChecksumSHA256, "")+"; }"))
+	if err != nil {
+		return err
+	}
+	remote, err := parseChecksumOutput(checksum)
+	if err != nil {
+		return err
+	}
+	if expected := hex.EncodeToString(sum.Sum(nil)); remote != expected {
+		return errors.Errorf(errors.ChecksumMismatch, "SHA-256 of the first %d bytes of %s is %s, but %s was written",
+			written, devPath, remote, expected)
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package adb
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/mqhack/goadb/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// SHA-256 of "flash me".
+const flashMeSHA256 = "921e3a12f04bd6abad1ada652d23718d1c3feafbe08fc6afbf225110f0a086d9"
+
+func TestWriteBlockDevice(t *testing.T) {
+	s := &MockServer{Status: wire.StatusSuccess, Messages: []string{
+		shellPacket(wire.ShellIDStderr, "8+0 records in\n8+0 records out\n") + shellPacket(wire.ShellIDExit, "\x00"),
+		flashMeSHA256 + "  -\r\n",
+	}}
+	var progress []int64
+	err := (&Adb{server: s}).Device(AnyDevice()).writeBlockDeviceAs(context.Background(), privilegeLevels[1],
+		strings.NewReader("flash me"), "/dev/block/by-name/misc", func(written int64) { progress = append(progress, written) })
+	require.NoError(t, err)
+	assert.Equal(t, []int64{8}, progress)
+	assert.Equal(t, `shell,v2,raw:su 0 sh -c 'dd of='\''/dev/block/by-name/misc'\'' bs=1048576'`, s.Requests[1])
+	assert.Contains(t, string(s.Written), shellPacket(wire.ShellIDStdin, "flash me")+shellPacket(wire.ShellIDCloseStdin, ""))
+	assert.True(t, strings.HasPrefix(s.Requests[3], `shell:su 0 sh -c 'head -c 8 '\''/dev/block/by-name/misc'\'' | { set --; if command -v sha256sum`), s.Requests[3])
+}
+
+func TestWriteBlockDeviceChecksumMismatch(t *testing.T) {
+	s := &MockServer{Status: wire.StatusSuccess, Messages: []string{
+		shellPacket(wire.ShellIDExit, "\x00"),
+		strings.Repeat("0", 64) + "  -\r\n",
+	}}
+	err := (&Adb{server: s}).Device(AnyDevice()).writeBlockDeviceAs(context.Background(), privilegeLevels[0],
+		strings.NewReader("flash me"), "/dev/block/by-name/misc", nil)
+	assert.True(t, HasErrCode(err, ChecksumMismatch), "%v", err)
+}
+
+func TestWriteBlockDeviceFails(t *testing.T) {
+	s := &MockServer{Status: wire.StatusSuccess, Messages: []string{
+		shellPacket(wire.ShellIDStderr, "dd: /dev/block/by-name/system: Read-only file system\n") + shellPacket(wire.ShellIDExit, "\x01"),
+	}}
+	err := (&Adb{server: s}).Device(AnyDevice()).writeBlockDeviceAs(context.Background(), privilegeLevels[0],
+		strings.NewReader("flash me"), "/dev/block/by-name/system", nil)
+	assert.True(t, HasErrCode(err, ReadOnlyFileSystem), "%v", err)
+}
+
+func TestWriteBlockDeviceNoRoot(t *testing.T) {
+	s := &MockServer{Status: wire.StatusSuccess, Messages: []string{""}}
+	err := (&Adb{server: s}).Device(AnyDevice()).WriteBlockDevice(context.Background(),
+		strings.NewReader("flash me"), "/dev/block/by-name/misc", nil)
+	assert.True(t, HasErrCode(err, RequirementNotMet), "%v", err)
+}
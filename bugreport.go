@@ -0,0 +1,161 @@
+package adb
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/mqhack/goadb/internal/errors"
+)
+
+// Prefixes of the lines printed by bugreportz -p.
+const (
+	bugreportzBegin    = "BEGIN:"
+	bugreportzProgress = "PROGRESS:"
+	bugreportzOK       = "OK:"
+	bugreportzFail     = "FAIL:"
+)
+
+/*
+Bugreport generates a bug report and writes it to w. If progress is not nil, it's called
+with the percentage complete (0 to 100) as the report is generated.
+
+On devices that have bugreportz (Android N and later), the report is a zip file, which is
+generated on the device then pulled. On older devices, the legacy flat text report is
+streamed to w instead, and progress isn't reported.
+
+Generating a report usually takes a few minutes. If ctx is done first, an error with code
+Timeout is returned.
+
+Corresponds to the command:
+
+	adb bugreport <file>
+*/
+func (c *Device) Bugreport(ctx context.Context, w io.Writer, progress func(pct float64)) error {
+	path, legacy, err := c.generateBugreportz(ctx, progress)
+	if err != nil {
+		return wrapClientError(err, c, "Bugreport")
+	}
+	if legacy {
+		return wrapClientError(c.streamLegacyBugreport(ctx, w), c, "Bugreport")
+	}
+
+	reader, err := c.OpenRead(path)
+	if err != nil {
+		return wrapClientError(err, c, "Bugreport")
+	}
+	defer reader.Close()
+	stop := closeWhenDone(ctx, reader)
+	defer stop()
+
+	if _, err := io.Copy(w, reader); err != nil {
+		if ctx.Err() != nil {
+			return wrapClientError(errors.WrapErrorf(ctx.Err(), errors.Timeout, "bugreport pull of %s cancelled", path), c, "Bugreport")
+		}
+		if _, ok := err.(*errors.Err); !ok {
+			err = errors.WrapErrorf(err, errors.NetworkError, "error pulling bugreport %s", path)
+		}
+		return wrapClientError(err, c, "Bugreport")
+	}
+	return nil
+}
+
+// generateBugreportz runs bugreportz and returns the path of the zip it created on the
+// device. If the device doesn't have bugreportz, legacy is true.
+func (c *Device) generateBugreportz(ctx context.Context, progress func(pct float64)) (path string, legacy bool, err error) {
+	conn, err := c.openExec("bugreportz", "-p")
+	if err != nil {
+		return "", false, err
+	}
+	defer conn.Close()
+	stop := closeWhenDone(ctx, conn)
+	defer stop()
+
+	path, err = parseBugreportzOutput(conn, progress)
+	if ctx.Err() != nil {
+		return "", false, errors.WrapErrorf(ctx.Err(), errors.Timeout, "bugreportz didn't complete")
+	}
+	if err == errNoBugreportz {
+		return "", true, nil
+	}
+	return path, false, err
+}
+
+var errNoBugreportz = errors.Errorf(errors.FileNoExistError, "bugreportz not found")
+
+// parseBugreportzOutput reads the output of bugreportz -p until it reports success or
+// failure, and returns the path of the zip file.
+func parseBugreportzOutput(r io.Reader, progress func(pct float64)) (string, error) {
+	var output []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		switch {
+		case strings.HasPrefix(line, bugreportzOK):
+			return strings.TrimPrefix(line, bugreportzOK), nil
+		case strings.HasPrefix(line, bugreportzFail):
+			return "", errors.Errorf(errors.AdbError, "bugreportz failed: %s", strings.TrimPrefix(line, bugreportzFail))
+		case strings.HasPrefix(line, bugreportzProgress):
+			if pct, ok := parseBugreportzProgress(strings.TrimPrefix(line, bugreportzProgress)); ok && progress != nil {
+				progress(pct)
+			}
+		case strings.HasPrefix(line, bugreportzBegin):
+			// The path is reported again in the OK line.
+		default:
+			output = append(output, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", errors.WrapErrorf(err, errors.NetworkError, "error reading bugreportz output")
+	}
+
+	joined := strings.Join(output, "\n")
+	if strings.Contains(joined, "not found") {
+		return "", errNoBugreportz
+	}
+	return "", errors.Errorf(errors.AdbError, "bugreportz exited without reporting a result: %s", joined)
+}
+
+// parseBugreportzProgress parses "<current>/<max>" into a percentage.
+func parseBugreportzProgress(s string) (float64, bool) {
+	parts := strings.SplitN(s, "/", 2)
+	if len(parts) != 2 {
+		return 0, false
+	}
+	current, err := strconv.ParseFloat(parts[0], 64)
+	if err != nil {
+		return 0, false
+	}
+	max, err := strconv.ParseFloat(parts[1], 64)
+	if err != nil || max <= 0 {
+		return 0, false
+	}
+	pct := current / max * 100
+	// Some devices' estimates of the total are low.
+	if pct > 100 {
+		pct = 100
+	}
+	return pct, true
+}
+
+// streamLegacyBugreport copies the output of the flat bugreport command to w.
+func (c *Device) streamLegacyBugreport(ctx context.Context, w io.Writer) error {
+	conn, err := c.openExec("bugreport")
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	stop := closeWhenDone(ctx, conn)
+	defer stop()
+
+	_, err = io.Copy(w, conn)
+	if ctx.Err() != nil {
+		return errors.WrapErrorf(ctx.Err(), errors.Timeout, "bugreport didn't complete")
+	}
+	if err != nil {
+		return errors.WrapErrorf(err, errors.NetworkError, "error reading bugreport")
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package adb
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/mqhack/goadb/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseBugreportzOutput(t *testing.T) {
+	var progress []float64
+	path, err := parseBugreportzOutput(strings.NewReader(
+		"BEGIN:/data/bugreports/bugreport.zip\r\nPROGRESS:0/200\nPROGRESS:50/200\nPROGRESS:250/200\nOK:/data/bugreports/bugreport.zip\n"),
+		func(pct float64) { progress = append(progress, pct) })
+	assert.NoError(t, err)
+	assert.Equal(t, "/data/bugreports/bugreport.zip", path)
+	assert.Equal(t, []float64{0, 25, 100}, progress)
+}
+
+func TestParseBugreportzOutputFail(t *testing.T) {
+	_, err := parseBugreportzOutput(strings.NewReader("BEGIN:/x.zip\nFAIL:could not create zip\n"), nil)
+	assert.EqualError(t, err, "AdbError: bugreportz failed: could not create zip")
+}
+
+func TestParseBugreportzOutputNotFound(t *testing.T) {
+	_, err := parseBugreportzOutput(strings.NewReader("/system/bin/sh: bugreportz: not found\n"), nil)
+	assert.Equal(t, errNoBugreportz, err)
+
+	_, err = parseBugreportzOutput(strings.NewReader("something unexpected\n"), nil)
+	assert.True(t, HasErrCode(err, AdbError))
+}
+
+func TestParseBugreportzProgress(t *testing.T) {
+	pct, ok := parseBugreportzProgress("1/4")
+	assert.True(t, ok)
+	assert.Equal(t, 25.0, pct)
+
+	for _, s := range []string{"", "1", "a/4", "1/b", "1/0"} {
+		_, ok := parseBugreportzProgress(s)
+		assert.False(t, ok, s)
+	}
+}
+
+func TestBugreportZip(t *testing.T) {
+	s := &MockServer{
+		Status: wire.StatusSuccess,
+		Messages: []string{
+			"BEGIN:/data/bugreport.zip\nPROGRESS:1/2\nOK:/data/bugreport.zip\n",
+			"DATA\x03\x00\x00\x00PK!",
+			"DONE\x00\x00\x00\x00",
+		},
+	}
+	device := (&Adb{server: s}).Device(AnyDevice())
+
+	var buf bytes.Buffer
+	var progress []float64
+	err := device.Bugreport(context.Background(), &buf, func(pct float64) { progress = append(progress, pct) })
+	require.NoError(t, err)
+	assert.Equal(t, "PK!", buf.String())
+	assert.Equal(t, []float64{50}, progress)
+	assert.Equal(t, []string{"host:transport-any", "exec:bugreportz -p", "host:transport-any", "sync:"}, s.Requests)
+}
+
+func TestBugreportLegacy(t *testing.T) {
+	s := &MockServer{
+		Status:   wire.StatusSuccess,
+		Messages: []string{"/system/bin/sh: bugreportz: not found\n"},
+	}
+	device := (&Adb{server: s}).Device(AnyDevice())
+
+	require.NoError(t, device.Bugreport(context.Background(), &bytes.Buffer{}, nil))
+	assert.Equal(t, []string{"host:transport-any", "exec:bugreportz -p", "host:transport-any", "exec:bugreport"}, s.Requests)
+}
+
+func TestStreamLegacyBugreport(t *testing.T) {
+	s := &MockServer{
+		Status:   wire.StatusSuccess,
+		Messages: []string{"== dumpstate ==\n", "more\n"},
+	}
+	device := (&Adb{server: s}).Device(AnyDevice())
+
+	var buf bytes.Buffer
+	require.NoError(t, device.streamLegacyBugreport(context.Background(), &buf))
+	assert.Equal(t, "== dumpstate ==\nmore\n", buf.String())
+}
@@ -0,0 +1,124 @@
+package adb
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/mqhack/goadb/internal/errors"
+)
+
+// System properties that describe the device's build.
+const (
+	PropFingerprint   = "ro.build.fingerprint"
+	PropSecurityPatch = "ro.build.version.security_patch"
+	PropAPILevel      = "ro.build.version.sdk"
+)
+
+// Names of the components of a build fingerprint, which has the format
+// brand/product/device:release/id/incremental:type/tags.
+var fingerprintComponents = []string{"brand", "product", "device", "release", "id", "incremental", "type", "tags"}
+
+// BuildSpec describes the builds a caller is willing to run on. Zero fields aren't checked.
+type BuildSpec struct {
+	// Fingerprint must match ro.build.fingerprint. Any component of the fingerprint may be
+	// "*" to match any value, e.g. "google/walleye/walleye:*/*/*:userdebug/dev-keys".
+	Fingerprint string
+
+	// MinSecurityPatch is the oldest acceptable ro.build.version.security_patch, in the
+	// same YYYY-MM-DD format.
+	MinSecurityPatch string
+
+	// MinAPILevel and MaxAPILevel are the inclusive bounds of ro.build.version.sdk.
+	MinAPILevel int
+	MaxAPILevel int
+}
+
+/*
+AssertBuild checks that the device is running a build that satisfies expected, and returns
+an error with code RequirementNotMet describing every difference if it isn't.
+
+Use it at the start of a job to fail fast with a clear message when the job was scheduled
+onto a device with the wrong build.
+*/
+func (c *Device) AssertBuild(expected BuildSpec) error {
+	props, err := c.getProps()
+	if err != nil {
+		return wrapClientError(err, c, "AssertBuild")
+	}
+
+	if mismatches := checkBuild(expected, props); len(mismatches) > 0 {
+		err := errors.Errorf(errors.RequirementNotMet, "device build doesn't match spec: %s", strings.Join(mismatches, "; "))
+		return wrapClientError(err, c, "AssertBuild")
+	}
+	return nil
+}
+
+// checkBuild returns a description of each way props doesn't satisfy spec.
+func checkBuild(spec BuildSpec, props map[string]string) []string {
+	var mismatches []string
+
+	if spec.Fingerprint != "" {
+		mismatches = append(mismatches, diffFingerprint(spec.Fingerprint, props[PropFingerprint])...)
+	}
+
+	if spec.MinSecurityPatch != "" {
+		// Dates in YYYY-MM-DD format sort lexically.
+		if patch := props[PropSecurityPatch]; patch < spec.MinSecurityPatch {
+			mismatches = append(mismatches, fmt.Sprintf("security patch: want %s or later, got %q", spec.MinSecurityPatch, patch))
+		}
+	}
+
+	if spec.MinAPILevel != 0 || spec.MaxAPILevel != 0 {
+		level, err := strconv.Atoi(props[PropAPILevel])
+		switch {
+		case err != nil:
+			mismatches = append(mismatches, fmt.Sprintf("API level: invalid value %q", props[PropAPILevel]))
+		case spec.MinAPILevel != 0 && level < spec.MinAPILevel:
+			mismatches = append(mismatches, fmt.Sprintf("API level: want at least %d, got %d", spec.MinAPILevel, level))
+		case spec.MaxAPILevel != 0 && level > spec.MaxAPILevel:
+			mismatches = append(mismatches, fmt.Sprintf("API level: want at most %d, got %d", spec.MaxAPILevel, level))
+		}
+	}
+
+	return mismatches
+}
+
+// diffFingerprint describes how actual differs from the fingerprint pattern want,
+// component by component if both are well-formed.
+func diffFingerprint(want, actual string) []string {
+	wantParts, wantOK := splitFingerprint(want)
+	actualParts, actualOK := splitFingerprint(actual)
+	if !wantOK || !actualOK {
+		if want == actual {
+			return nil
+		}
+		return []string{fmt.Sprintf("fingerprint: want %q, got %q", want, actual)}
+	}
+
+	var diffs []string
+	for i, name := range fingerprintComponents {
+		if wantParts[i] != "*" && wantParts[i] != actualParts[i] {
+			diffs = append(diffs, fmt.Sprintf("fingerprint %s: want %q, got %q", name, wantParts[i], actualParts[i]))
+		}
+	}
+	return diffs
+}
+
+// splitFingerprint splits a fingerprint into its components.
+func splitFingerprint(fingerprint string) ([]string, bool) {
+	sections := strings.Split(fingerprint, ":")
+	if len(sections) != 3 {
+		return nil, false
+	}
+	var parts []string
+	for i, section := range sections {
+		sectionParts := strings.Split(section, "/")
+		// Only the last section has 2 components.
+		if want := 3 - i/2; len(sectionParts) != want {
+			return nil, false
+		}
+		parts = append(parts, sectionParts...)
+	}
+	return parts, true
+}
@@ -0,0 +1,77 @@
+package adb
+
+import (
+	"testing"
+
+	"github.com/mqhack/goadb/wire"
+	"github.com/stretchr/testify/assert"
+)
+
+const testFingerprint = "google/walleye/walleye:11/RP1A.201005.004/6782484:user/release-keys"
+
+func TestCheckBuildMatches(t *testing.T) {
+	props := map[string]string{
+		PropFingerprint:   testFingerprint,
+		PropSecurityPatch: "2020-10-05",
+		PropAPILevel:      "30",
+	}
+
+	assert.Empty(t, checkBuild(BuildSpec{}, props))
+	assert.Empty(t, checkBuild(BuildSpec{
+		Fingerprint:      testFingerprint,
+		MinSecurityPatch: "2020-10-05",
+		MinAPILevel:      30,
+		MaxAPILevel:      30,
+	}, props))
+	assert.Empty(t, checkBuild(BuildSpec{Fingerprint: "google/walleye/walleye:*/*/*:user/*"}, props))
+}
+
+func TestCheckBuildMismatches(t *testing.T) {
+	props := map[string]string{
+		PropFingerprint:   testFingerprint,
+		PropSecurityPatch: "2020-10-05",
+		PropAPILevel:      "30",
+	}
+
+	assert.Equal(t, []string{
+		`fingerprint incremental: want "1234", got "6782484"`,
+		`fingerprint type: want "userdebug", got "user"`,
+		`security patch: want 2021-01-01 or later, got "2020-10-05"`,
+		`API level: want at least 31, got 30`,
+	}, checkBuild(BuildSpec{
+		Fingerprint:      "google/walleye/walleye:11/RP1A.201005.004/1234:userdebug/release-keys",
+		MinSecurityPatch: "2021-01-01",
+		MinAPILevel:      31,
+	}, props))
+
+	assert.Equal(t, []string{"API level: want at most 29, got 30"}, checkBuild(BuildSpec{MaxAPILevel: 29}, props))
+	assert.Equal(t, []string{`fingerprint: want "custom", got "` + testFingerprint + `"`},
+		checkBuild(BuildSpec{Fingerprint: "custom"}, props))
+	assert.Equal(t, []string{`API level: invalid value ""`}, checkBuild(BuildSpec{MinAPILevel: 1}, map[string]string{}))
+}
+
+func TestSplitFingerprint(t *testing.T) {
+	parts, ok := splitFingerprint(testFingerprint)
+	assert.True(t, ok)
+	assert.Equal(t, []string{"google", "walleye", "walleye", "11", "RP1A.201005.004", "6782484", "user", "release-keys"}, parts)
+
+	for _, fingerprint := range []string{"", "a/b/c:d/e/f", "a/b:c/d/e/f:g/h", "a/b/c:d/e/f:g/h/i"} {
+		_, ok := splitFingerprint(fingerprint)
+		assert.False(t, ok, fingerprint)
+	}
+}
+
+func TestAssertBuild(t *testing.T) {
+	s := &MockServer{
+		Status: wire.StatusSuccess,
+		Messages: []string{"[ro.build.fingerprint]: [" + testFingerprint + "]\r\n" +
+			"[ro.build.version.sdk]: [30]\r\n" +
+			"[ro.build.version.security_patch]: [2020-10-05]\r\n"},
+	}
+	device := (&Adb{server: s}).Device(AnyDevice())
+
+	err := device.AssertBuild(BuildSpec{MinAPILevel: 33})
+	assert.True(t, HasErrCode(err, RequirementNotMet))
+	assert.Contains(t, ErrorWithCauseChain(err), "device build doesn't match spec: API level: want at least 33, got 30")
+	assert.Equal(t, "shell:getprop", s.Requests[1])
+}
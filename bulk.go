@@ -0,0 +1,116 @@
+package adb
+
+import (
+	"github.com/mqhack/goadb/internal/errors"
+)
+
+// BulkOptions controls how operations that act on many items at once handle failures.
+type BulkOptions struct {
+	// If true, the operation stops at the first failure. Items that were not attempted
+	// are reported in PartialResult.Skipped.
+	// By default every item is attempted and all failures are reported.
+	FailFast bool
+}
+
+// ItemFailure describes why a single item of a bulk operation failed.
+type ItemFailure struct {
+	// Item identifies what failed, e.g. a device serial or a file path.
+	Item string
+	// Err is the cause of the failure. Use HasErrCode to inspect it.
+	Err error
+}
+
+func (f ItemFailure) Error() string {
+	return f.Item + ": " + f.Err.Error()
+}
+
+// PartialResult reports the outcome of each item processed by a bulk operation.
+type PartialResult struct {
+	Succeeded []string
+	Failed    []ItemFailure
+	// Skipped contains items that were never attempted because FailFast was set.
+	Skipped []string
+}
+
+// OK returns true if every item succeeded.
+func (r *PartialResult) OK() bool {
+	return len(r.Failed) == 0 && len(r.Skipped) == 0
+}
+
+// Err returns nil if every item succeeded, else an error combining all the failures.
+// If only one item failed, its error is returned unwrapped.
+func (r *PartialResult) Err() error {
+	if len(r.Failed) == 1 && len(r.Skipped) == 0 {
+		return r.Failed[0].Err
+	}
+
+	var errs []error
+	for _, failure := range r.Failed {
+		errs = append(errs, failure)
+	}
+	if len(r.Skipped) > 0 {
+		errs = append(errs, errors.Errorf(errors.AssertionError, "%d items skipped after failure", len(r.Skipped)))
+	}
+	return errors.CombineErrs("bulk operation partially failed", errors.AssertionError, errs...)
+}
+
+// bulkRunner accumulates a PartialResult for a sequence of items.
+type bulkRunner struct {
+	opts   BulkOptions
+	result *PartialResult
+}
+
+func newBulkRunner(opts BulkOptions) *bulkRunner {
+	return &bulkRunner{opts: opts, result: &PartialResult{}}
+}
+
+// run calls fn for item, unless a previous item failed and FailFast is set.
+// Returns false if the caller should stop processing items.
+func (r *bulkRunner) run(item string, fn func() error) bool {
+	if r.stopped() {
+		r.result.Skipped = append(r.result.Skipped, item)
+		return false
+	}
+	if err := fn(); err != nil {
+		r.fail(item, err)
+	} else {
+		r.result.Succeeded = append(r.result.Succeeded, item)
+	}
+	return !r.stopped()
+}
+
+// fail records a failure for item without running anything.
+func (r *bulkRunner) fail(item string, err error) {
+	r.result.Failed = append(r.result.Failed, ItemFailure{Item: item, Err: err})
+}
+
+func (r *bulkRunner) stopped() bool {
+	return r.opts.FailFast && len(r.result.Failed) > 0
+}
+
+/*
+ForEachDevice calls fn for every online device, and reports the result for each device
+by serial. A failure on one device doesn't stop fn being called for the others, unless
+opts.FailFast is set.
+
+The returned error is only non-nil if the device list couldn't be retrieved; failures
+returned by fn are reported in the PartialResult.
+*/
+func (c *Adb) ForEachDevice(opts BulkOptions, fn func(device *Device) error) (*PartialResult, error) {
+	devices, err := c.ListDevices()
+	if err != nil {
+		return nil, wrapClientError(err, c, "ForEachDevice")
+	}
+
+	runner := newBulkRunner(opts)
+	for _, info := range devices {
+		if info.State != StateOnline {
+			continue
+		}
+		device := c.Device(DeviceWithSerial(info.Serial))
+		runner.run(info.Serial, func() error {
+			return fn(device)
+		})
+	}
+	return runner.result, nil
+}
@@ -0,0 +1,60 @@
+package adb
+
+import (
+	"testing"
+
+	"github.com/mqhack/goadb/internal/errors"
+	"github.com/mqhack/goadb/wire"
+	"github.com/stretchr/testify/assert"
+)
+
+func newDeviceListServer() *MockServer {
+	return &MockServer{
+		Status: wire.StatusSuccess,
+		Messages: []string{"A    device usb:1\n" +
+			"B    unauthorized usb:2\n" +
+			"C    device usb:3\n" +
+			"D    device usb:4\n"},
+	}
+}
+
+func TestForEachDeviceReportsAllFailures(t *testing.T) {
+	client := &Adb{server: newDeviceListServer()}
+
+	var called []string
+	result, err := client.ForEachDevice(BulkOptions{}, func(d *Device) error {
+		called = append(called, d.descriptor.serial)
+		if d.descriptor.serial == "C" {
+			return errors.Errorf(errors.DeviceNotFound, "gone")
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"A", "C", "D"}, called)
+	assert.Equal(t, []string{"A", "D"}, result.Succeeded)
+	assert.Len(t, result.Failed, 1)
+	assert.Equal(t, "C", result.Failed[0].Item)
+	assert.True(t, HasErrCode(result.Failed[0].Err, DeviceNotFound))
+	assert.Empty(t, result.Skipped)
+	assert.False(t, result.OK())
+	assert.True(t, HasErrCode(result.Err(), DeviceNotFound))
+}
+
+func TestForEachDeviceFailFast(t *testing.T) {
+	client := &Adb{server: newDeviceListServer()}
+
+	result, err := client.ForEachDevice(BulkOptions{FailFast: true}, func(d *Device) error {
+		return errors.Errorf(errors.NetworkError, "broken")
+	})
+	assert.NoError(t, err)
+	assert.Empty(t, result.Succeeded)
+	assert.Len(t, result.Failed, 1)
+	assert.Equal(t, []string{"C", "D"}, result.Skipped)
+	assert.EqualError(t, result.Err(), "AssertionError: bulk operation partially failed")
+}
+
+func TestPartialResultOK(t *testing.T) {
+	result := &PartialResult{Succeeded: []string{"a"}}
+	assert.True(t, result.OK())
+	assert.NoError(t, result.Err())
+}
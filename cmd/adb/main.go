@@ -4,7 +4,8 @@ import (
 	"fmt"
 	"io"
 	"os"
-	"path/filepath"
+	"path"
+	"runtime"
 	"syscall"
 	"time"
 
@@ -23,6 +24,10 @@ var (
 
 	shellCommand = kingpin.Command("shell",
 		"Run a shell command on the device.")
+	shellBannerFlag = shellCommand.Flag("banner",
+		"Print a banner identifying the device before running the command, if stderr is a terminal.").
+		Default("true").
+		Bool()
 	shellCommandArg = shellCommand.Arg("command",
 		"Command to run on device.").
 		Strings()
@@ -40,6 +45,13 @@ var (
 		"Show progress.").
 		Short('p').
 		Bool()
+	pullTextFlag = pullCommand.Flag("text",
+		"Convert line endings to the host's.").
+		Bool()
+	pullPreserveFlag = pullCommand.Flag("preserve",
+		"Preserve the file's permissions and modification time.").
+		Short('a').
+		Bool()
 	pullRemoteArg = pullCommand.Arg("remote",
 		"Path of source file on device.").
 		Required().
@@ -54,6 +66,9 @@ var (
 		"Show progress.").
 		Short('p').
 		Bool()
+	pushTextFlag = pushCommand.Flag("text",
+		"Convert line endings to LF.").
+		Bool()
 	pushLocalArg = pushCommand.Arg("local",
 		"Path of source file. If -, will read from stdin.").
 		Required().
@@ -80,11 +95,11 @@ func main() {
 	case "devices":
 		exitCode = listDevices(*devicesLongFlag)
 	case "shell":
-		exitCode = runShellCommand(*shellCommandArg, parseDevice())
+		exitCode = runShellCommand(*shellCommandArg, *shellBannerFlag, parseDevice())
 	case "pull":
-		exitCode = pull(*pullProgressFlag, *pullRemoteArg, *pullLocalArg, parseDevice())
+		exitCode = pull(*pullProgressFlag, pullTransferOptions(*pullTextFlag, *pullPreserveFlag), *pullRemoteArg, *pullLocalArg, parseDevice())
 	case "push":
-		exitCode = push(*pushProgressFlag, *pushLocalArg, *pushRemoteArg, parseDevice())
+		exitCode = push(*pushProgressFlag, transferOptions(*pushTextFlag), *pushLocalArg, *pushRemoteArg, parseDevice())
 	}
 
 	os.Exit(exitCode)
@@ -122,7 +137,7 @@ func listDevices(long bool) int {
 	return 0
 }
 
-func runShellCommand(commandAndArgs []string, device adb.DeviceDescriptor) int {
+func runShellCommand(commandAndArgs []string, showBanner bool, device adb.DeviceDescriptor) int {
 	if len(commandAndArgs) == 0 {
 		fmt.Fprintln(os.Stderr, "error: no command")
 		kingpin.Usage()
@@ -137,6 +152,10 @@ func runShellCommand(commandAndArgs []string, device adb.DeviceDescriptor) int {
 	}
 
 	client := client.Device(device)
+	if showBanner && isTerminal(os.Stderr) {
+		printBanner(client)
+	}
+
 	output, err := client.RunCommand(command, args...)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, "error:", err)
@@ -147,15 +166,47 @@ func runShellCommand(commandAndArgs []string, device adb.DeviceDescriptor) int {
 	return 0
 }
 
-func pull(showProgress bool, remotePath, localPath string, device adb.DeviceDescriptor) int {
+// printBanner prints the banner identifying device to stderr, so it's not mixed into the
+// command's output. Errors are ignored, since the command will report them.
+func printBanner(device *adb.Device) {
+	banner, err := device.Banner()
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "%s\n\n", banner)
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// transferOptions returns the options for pushing and pulling files on this host. Backslashes
+// in remote paths are translated on Windows, where users type paths with them.
+func transferOptions(text bool) adb.TransferOptions {
+	opts := adb.TransferOptions{TranslateBackslashes: runtime.GOOS == "windows"}
+	if text {
+		opts.Newlines = adb.NewlinesNative
+	}
+	return opts
+}
+
+func pullTransferOptions(text, preserve bool) adb.TransferOptions {
+	opts := transferOptions(text)
+	opts.PreserveMetadata = preserve
+	return opts
+}
+
+func pull(showProgress bool, opts adb.TransferOptions, remotePath, localPath string, device adb.DeviceDescriptor) int {
 	if remotePath == "" {
 		fmt.Fprintln(os.Stderr, "error: must specify remote file")
 		kingpin.Usage()
 		return 1
 	}
 
+	remotePath = opts.RemotePath(remotePath)
 	if localPath == "" {
-		localPath = filepath.Base(remotePath)
+		localPath = path.Base(remotePath)
 	}
 
 	client := client.Device(device)
@@ -180,7 +231,7 @@ func pull(showProgress bool, remotePath, localPath string, device adb.DeviceDesc
 	if localPath == StdIoFilename {
 		localFile = os.Stdout
 	} else {
-		localFile, err = os.Create(localPath)
+		localFile, err = os.Create(opts.LocalPath(localPath))
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "error opening local file %s: %s\n", localPath, err)
 			return 1
@@ -188,14 +239,33 @@ func pull(showProgress bool, remotePath, localPath string, device adb.DeviceDesc
 	}
 	defer localFile.Close()
 
-	if err := copyWithProgressAndStats(localFile, remoteFile, int(info.Size), showProgress); err != nil {
+	w := opts.PullWriter(localFile)
+	if err := copyWithProgressAndStats(w, remoteFile, int(info.Size), showProgress); err != nil {
 		fmt.Fprintln(os.Stderr, "error pulling file:", err)
 		return 1
 	}
+	if err := w.Close(); err != nil {
+		fmt.Fprintln(os.Stderr, "error pulling file:", err)
+		return 1
+	}
+	if opts.PreserveMetadata && localPath != StdIoFilename && info.Mode.IsRegular() {
+		if err := localFile.Close(); err != nil {
+			fmt.Fprintln(os.Stderr, "error pulling file:", err)
+			return 1
+		}
+		if err := os.Chmod(opts.LocalPath(localPath), info.Mode.Perm()); err != nil {
+			fmt.Fprintln(os.Stderr, "error setting file permissions:", err)
+			return 1
+		}
+		if err := os.Chtimes(opts.LocalPath(localPath), info.ModifiedAt, info.ModifiedAt); err != nil {
+			fmt.Fprintln(os.Stderr, "error setting file modification time:", err)
+			return 1
+		}
+	}
 	return 0
 }
 
-func push(showProgress bool, localPath, remotePath string, device adb.DeviceDescriptor) int {
+func push(showProgress bool, opts adb.TransferOptions, localPath, remotePath string, device adb.DeviceDescriptor) int {
 	if remotePath == "" {
 		fmt.Fprintln(os.Stderr, "error: must specify remote file")
 		kingpin.Usage()
@@ -215,12 +285,12 @@ func push(showProgress bool, localPath, remotePath string, device adb.DeviceDesc
 		mtime = adb.MtimeOfClose
 	} else {
 		var err error
-		localFile, err = os.Open(localPath)
+		localFile, err = os.Open(opts.LocalPath(localPath))
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "error opening local file %s: %s\n", localPath, err)
 			return 1
 		}
-		info, err := os.Stat(localPath)
+		info, err := os.Stat(opts.LocalPath(localPath))
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "error reading local file %s: %s\n", localPath, err)
 			return 1
@@ -232,14 +302,14 @@ func push(showProgress bool, localPath, remotePath string, device adb.DeviceDesc
 	defer localFile.Close()
 
 	client := client.Device(device)
-	writer, err := client.OpenWrite(remotePath, perms, mtime)
+	writer, err := client.OpenWrite(opts.RemotePath(remotePath), perms, mtime)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "error opening remote file %s: %s\n", remotePath, err)
 		return 1
 	}
 	defer writer.Close()
 
-	if err := copyWithProgressAndStats(writer, localFile, size, showProgress); err != nil {
+	if err := copyWithProgressAndStats(writer, opts.PushReader(localFile), size, showProgress); err != nil {
 		fmt.Fprintln(os.Stderr, "error pushing file:", err)
 		return 1
 	}
@@ -0,0 +1,111 @@
+package adb
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mqhack/goadb/internal/errors"
+)
+
+// IOClass is an I/O scheduling class, as set by ionice.
+type IOClass int
+
+const (
+	// IOClassDefault leaves the I/O scheduling class unchanged.
+	IOClassDefault IOClass = iota
+	IOClassRealtime
+	IOClassBestEffort
+	// IOClassIdle only gets disk time when no other process needs it.
+	IOClassIdle
+)
+
+/*
+CommandPriority is the CPU and I/O priority, and the CPUs, of the commands a Device runs, so
+background work like collecting logs and traces doesn't perturb measurements of the
+foreground app. The zero value leaves everything unchanged.
+
+The shell user can only lower priorities, e.g. set a positive Nice or IOClassIdle; raising
+them requires a rooted device.
+*/
+type CommandPriority struct {
+	// Nice is the niceness, from -20 (highest priority) to 19 (lowest).
+	Nice int
+
+	IOClass IOClass
+	// IOLevel is the priority within IOClassRealtime or IOClassBestEffort, from 0 (highest)
+	// to 7 (lowest).
+	IOLevel int
+
+	// CPUs are the numbers of the CPUs commands may run on, e.g. the little cores. Empty means
+	// any CPU.
+	CPUs []int
+}
+
+func (p *CommandPriority) validate() error {
+	if p.Nice < -20 || p.Nice > 19 {
+		return errors.AssertionErrorf("nice must be between -20 and 19, got %d", p.Nice)
+	}
+	if p.IOClass < IOClassDefault || p.IOClass > IOClassIdle {
+		return errors.AssertionErrorf("invalid I/O class %d", p.IOClass)
+	}
+	if p.IOLevel < 0 || p.IOLevel > 7 {
+		return errors.AssertionErrorf("I/O level must be between 0 and 7, got %d", p.IOLevel)
+	}
+	for _, cpu := range p.CPUs {
+		if cpu < 0 || cpu > 63 {
+			return errors.AssertionErrorf("CPU must be between 0 and 63, got %d", cpu)
+		}
+	}
+	return nil
+}
+
+// render returns shell code that applies the priority to the shell running it, which the
+// command then inherits. Failures are ignored, so commands still run on devices that are
+// missing renice, ionice or taskset (which toybox has since Android M).
+func (p *CommandPriority) render() string {
+	var steps []string
+	if p.Nice != 0 {
+		// The shell starts with niceness 0, so the increment is the niceness.
+		steps = append(steps, fmt.Sprintf("renice -n %d -p $$", p.Nice))
+	}
+	switch p.IOClass {
+	case IOClassRealtime, IOClassBestEffort:
+		steps = append(steps, fmt.Sprintf("ionice -c %d -n %d -p $$", p.IOClass, p.IOLevel))
+	case IOClassIdle:
+		steps = append(steps, "ionice -c 3 -p $$")
+	}
+	if len(p.CPUs) > 0 {
+		var mask uint64
+		for _, cpu := range p.CPUs {
+			mask |= 1 << uint(cpu)
+		}
+		steps = append(steps, fmt.Sprintf("taskset -p %x $$", mask))
+	}
+	if len(steps) == 0 {
+		return ""
+	}
+	return "{ " + strings.Join(steps, "; ") + "; } >/dev/null 2>&1; "
+}
+
+/*
+SetCommandPriority makes every command run by this Device (by RunCommand, OpenShell, OpenExec,
+and the helpers built on them) run with priority. Commands run by other Device values for the
+same device are unaffected.
+
+Passing nil runs commands with the default priority again.
+*/
+func (c *Device) SetCommandPriority(priority *CommandPriority) error {
+	if priority != nil {
+		if err := priority.validate(); err != nil {
+			return wrapClientError(err, c, "SetCommandPriority")
+		}
+	}
+	c.priority.Store(priority)
+	return nil
+}
+
+// getCommandPriority returns the priority set by SetCommandPriority, or nil if there isn't one.
+func (c *Device) getCommandPriority() *CommandPriority {
+	priority, _ := c.priority.Load().(*CommandPriority)
+	return priority
+}
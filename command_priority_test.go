@@ -0,0 +1,43 @@
+package adb
+
+import (
+	"testing"
+
+	"github.com/mqhack/goadb/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderCommandPriority(t *testing.T) {
+	assert.Equal(t, "{ renice -n 10 -p $$; ionice -c 3 -p $$; taskset -p 3 $$; } >/dev/null 2>&1; ",
+		(&CommandPriority{Nice: 10, IOClass: IOClassIdle, CPUs: []int{0, 1}}).render())
+	assert.Equal(t, "{ ionice -c 2 -n 7 -p $$; } >/dev/null 2>&1; ",
+		(&CommandPriority{IOClass: IOClassBestEffort, IOLevel: 7}).render())
+	assert.Equal(t, "", (&CommandPriority{}).render())
+}
+
+func TestSetCommandPriorityInvalid(t *testing.T) {
+	device := (&Adb{server: &MockServer{}}).Device(AnyDevice())
+
+	assert.True(t, HasErrCode(device.SetCommandPriority(&CommandPriority{Nice: 20}), AssertionError))
+	assert.True(t, HasErrCode(device.SetCommandPriority(&CommandPriority{IOClass: IOClassBestEffort, IOLevel: 8}), AssertionError))
+	assert.True(t, HasErrCode(device.SetCommandPriority(&CommandPriority{CPUs: []int{64}}), AssertionError))
+}
+
+func TestSetCommandPriority(t *testing.T) {
+	s := &MockServer{
+		Status:   wire.StatusSuccess,
+		Messages: []string{"output"},
+	}
+	device := (&Adb{server: s}).Device(AnyDevice())
+
+	require.NoError(t, device.SetCommandPriority(&CommandPriority{CPUs: []int{4, 5, 6, 7}}))
+	_, err := device.RunCommand("ls", "/sdcard")
+	require.NoError(t, err)
+	assert.Equal(t, "shell:{ taskset -p f0 $$; } >/dev/null 2>&1; ls /sdcard", s.Requests[1])
+
+	require.NoError(t, device.SetCommandPriority(nil))
+	_, err = device.RunCommand("ls", "/sdcard")
+	require.NoError(t, err)
+	assert.Equal(t, "shell:ls /sdcard", s.Requests[len(s.Requests)-1])
+}
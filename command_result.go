@@ -0,0 +1,216 @@
+package adb
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"time"
+
+	"github.com/mqhack/goadb/internal/errors"
+	"github.com/mqhack/goadb/wire"
+)
+
+// shellStdinChunkSize is the maximum amount of stdin data sent in a single packet.
+// It's deliberately small so that it fits in the shell buffer of any adbd version.
+const shellStdinChunkSize = 4096
+
+// CommandOptions configures how RunCommandResult runs a command.
+type CommandOptions struct {
+	// Timeout is a hard limit on how long the command may run, in addition to any deadline
+	// on the context. The command is killed when it's reached. Zero means no limit.
+	Timeout time.Duration
+
+	// MaxOutputSize limits how many bytes of each of stdout and stderr are kept.
+	// If the command writes more than that to either stream, it is killed and the result
+	// is marked as Truncated. Zero means no limit.
+	MaxOutputSize int
+
+	// Stdin is sent to the command as its standard input, followed by EOF.
+	// If nil, the command gets an empty input.
+	Stdin io.Reader
+}
+
+// CommandResult is the outcome of a command run by RunCommandResult.
+type CommandResult struct {
+	Stdout string
+	Stderr string
+
+	// ExitCode is the command's exit status, or -1 if it didn't exit on its own
+	// (e.g. it was killed because its output was too large).
+	ExitCode int
+
+	// Duration is how long the command took, measured on the host.
+	Duration time.Duration
+
+	// Truncated is true if the command was killed for exceeding MaxOutputSize.
+	Truncated bool
+}
+
+/*
+RunCommandResult runs the specified command on the device like RunCommand, but uses the
+shell protocol so it can report stdout and stderr separately, along with the exit code.
+
+A non-zero exit code is not an error. If ctx is done or opts.Timeout elapses before the
+command exits, the command is killed and an error with code Timeout is returned along with
+any output collected so far.
+
+Requires a device running Android N or later (see OpenShell).
+*/
+func (c *Device) RunCommandResult(ctx context.Context, cmd string, opts CommandOptions, args ...string) (*CommandResult, error) {
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	conn, err := c.openShell(cmd, args...)
+	if err != nil {
+		return nil, wrapClientError(err, c, "RunCommandResult")
+	}
+	defer conn.Close()
+
+	stop := closeWhenDone(ctx, conn)
+	stdinErr := make(chan error, 1)
+	go func() {
+		if err := sendShellStdin(conn, opts.Stdin); err != nil {
+			// Without the rest of its input the command may never exit, so abort it.
+			stdinErr <- err
+			conn.Close()
+		}
+	}()
+	result, err := readCommandResult(conn, opts.MaxOutputSize)
+	select {
+	case sendErr := <-stdinErr:
+		if result.ExitCode == -1 {
+			err = sendErr
+		}
+	default:
+	}
+	stop()
+
+	result.Duration = time.Since(start)
+
+	// The context may be done just after the command exited, which isn't a timeout.
+	if ctxErr := ctx.Err(); ctxErr != nil && result.ExitCode == -1 {
+		err = errors.WrapErrorf(ctxErr, errors.Timeout, "command '%s' didn't complete after %s", cmd, result.Duration)
+	}
+	return result, wrapClientError(err, c, "RunCommandResult")
+}
+
+// sendShellStdin sends everything read from r, if it's not nil, to the command as stdin,
+// followed by EOF.
+func sendShellStdin(s wire.ShellSender, r io.Reader) error {
+	if r != nil {
+		buf := make([]byte, shellStdinChunkSize)
+		for {
+			n, err := r.Read(buf)
+			if n > 0 {
+				if sendErr := s.SendPacket(wire.ShellIDStdin, buf[:n]); sendErr != nil {
+					return sendErr
+				}
+			}
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				return errors.WrapErrorf(err, errors.AssertionError, "error reading command input")
+			}
+		}
+	}
+	return s.SendPacket(wire.ShellIDCloseStdin, nil)
+}
+
+// readCommandResult reads output packets from s until the command exits, or until
+// either output stream is larger than maxOutputSize (if non-zero).
+// If an error occurs, the output read so far is still returned.
+func readCommandResult(s wire.ShellScanner, maxOutputSize int) (*CommandResult, error) {
+	var stdout, stderr bytes.Buffer
+	result := &CommandResult{ExitCode: -1}
+
+	finish := func() *CommandResult {
+		result.Stdout = stdout.String()
+		result.Stderr = stderr.String()
+		return result
+	}
+
+	for {
+		id, data, err := s.ReadPacket()
+		if err != nil {
+			return finish(), err
+		}
+
+		var buf *bytes.Buffer
+		switch id {
+		case wire.ShellIDStdout:
+			buf = &stdout
+		case wire.ShellIDStderr:
+			buf = &stderr
+		case wire.ShellIDExit:
+			if len(data) != 1 {
+				return finish(), errors.Errorf(errors.ParseError, "expected 1 byte exit code, got %d bytes", len(data))
+			}
+			result.ExitCode = int(data[0])
+			return finish(), nil
+		default:
+			continue
+		}
+
+		if maxOutputSize > 0 && buf.Len()+len(data) > maxOutputSize {
+			buf.Write(data[:maxOutputSize-buf.Len()])
+			result.Truncated = true
+			return finish(), nil
+		}
+		buf.Write(data)
+	}
+}
+
+// shellStdoutReader reads the stdout of a shell protocol command, collecting stderr, and
+// returns io.EOF once the command exits.
+type shellStdoutReader struct {
+	scanner wire.ShellScanner
+	pending []byte
+
+	exited   bool
+	exitCode int
+	stderr   bytes.Buffer
+}
+
+func newShellStdoutReader(s wire.ShellScanner) *shellStdoutReader {
+	return &shellStdoutReader{scanner: s, exitCode: -1}
+}
+
+func (r *shellStdoutReader) Read(p []byte) (int, error) {
+	if err := r.fill(); err != nil {
+		return 0, err
+	}
+	if len(r.pending) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+// fill reads packets until there's stdout data pending or the command has exited.
+func (r *shellStdoutReader) fill() error {
+	for len(r.pending) == 0 && !r.exited {
+		id, data, err := r.scanner.ReadPacket()
+		if err != nil {
+			return err
+		}
+
+		switch id {
+		case wire.ShellIDStdout:
+			r.pending = data
+		case wire.ShellIDStderr:
+			r.stderr.Write(data)
+		case wire.ShellIDExit:
+			if len(data) != 1 {
+				return errors.Errorf(errors.ParseError, "expected 1 byte exit code, got %d bytes", len(data))
+			}
+			r.exited = true
+			r.exitCode = int(data[0])
+		}
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package adb
+
+import (
+	"context"
+	"encoding/binary"
+	"strings"
+	"testing"
+
+	"github.com/mqhack/goadb/wire"
+	"github.com/stretchr/testify/assert"
+)
+
+func shellPacket(id byte, data string) string {
+	header := make([]byte, 5)
+	header[0] = id
+	binary.LittleEndian.PutUint32(header[1:], uint32(len(data)))
+	return string(header) + data
+}
+
+func TestReadCommandResult(t *testing.T) {
+	s := wire.NewShellScanner(strings.NewReader(
+		shellPacket(wire.ShellIDStdout, "out") +
+			shellPacket(wire.ShellIDStderr, "err") +
+			shellPacket(wire.ShellIDStdout, "put") +
+			shellPacket(wire.ShellIDExit, "\003")))
+
+	result, err := readCommandResult(s, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, &CommandResult{
+		Stdout:   "output",
+		Stderr:   "err",
+		ExitCode: 3,
+	}, result)
+}
+
+func TestReadCommandResultTruncated(t *testing.T) {
+	s := wire.NewShellScanner(strings.NewReader(
+		shellPacket(wire.ShellIDStdout, "0123") +
+			shellPacket(wire.ShellIDStdout, "4567") +
+			shellPacket(wire.ShellIDExit, "\000")))
+
+	result, err := readCommandResult(s, 6)
+	assert.NoError(t, err)
+	assert.Equal(t, "012345", result.Stdout)
+	assert.True(t, result.Truncated)
+	assert.Equal(t, -1, result.ExitCode)
+}
+
+func TestReadCommandResultNoExit(t *testing.T) {
+	s := wire.NewShellScanner(strings.NewReader(shellPacket(wire.ShellIDStdout, "partial")))
+
+	result, err := readCommandResult(s, 0)
+	assert.True(t, HasErrCode(err, ConnectionResetError))
+	assert.Equal(t, "partial", result.Stdout)
+	assert.Equal(t, -1, result.ExitCode)
+}
+
+func TestRunCommandResultWithStdin(t *testing.T) {
+	s := &MockServer{
+		Status: wire.StatusSuccess,
+		Messages: []string{
+			shellPacket(wire.ShellIDStdout, "ok") + shellPacket(wire.ShellIDExit, "\000"),
+		},
+	}
+	device := (&Adb{server: s}).Device(AnyDevice())
+
+	result, err := device.RunCommandResult(context.Background(), "cat", CommandOptions{Stdin: strings.NewReader("input")})
+	assert.NoError(t, err)
+	assert.Equal(t, "ok", result.Stdout)
+	assert.Equal(t, 0, result.ExitCode)
+	assert.Equal(t, []string{"host:transport-any", "shell,v2,raw:cat"}, s.Requests)
+}
+
+func TestRunCommandResultExitedWhenContextDone(t *testing.T) {
+	s := &MockServer{
+		Status: wire.StatusSuccess,
+		Messages: []string{
+			shellPacket(wire.ShellIDStdout, "ok") + shellPacket(wire.ShellIDExit, "\000"),
+		},
+	}
+	device := (&Adb{server: s}).Device(AnyDevice())
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// The mock server's connection can still be read after it's closed, so the exit status is
+	// received even though the context is done.
+	result, err := device.RunCommandResult(ctx, "true", CommandOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, result.ExitCode)
+}
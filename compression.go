@@ -0,0 +1,98 @@
+package adb
+
+import (
+	"io"
+	"sync"
+)
+
+// Names of the compression algorithms adbd supports for sync transfers.
+const (
+	CompressionBrotli = "brotli"
+	CompressionLZ4    = "lz4"
+	CompressionZstd   = "zstd"
+	// CompressionNone can be put in ServerConfig.CompressionPreference to stop codecs after
+	// it from being used, or on its own to disable compression.
+	CompressionNone = "none"
+)
+
+// DefaultCompressionPreference is the order codecs are tried in when
+// ServerConfig.CompressionPreference isn't set.
+var DefaultCompressionPreference = []string{CompressionZstd, CompressionLZ4, CompressionBrotli}
+
+/*
+CompressionCodec implements a compression algorithm for sync transfers.
+
+No codecs are registered by default, since the standard library doesn't implement any of the
+algorithms adbd supports. Register an implementation, e.g. one wrapping a zstd package, with
+RegisterCompressionCodec.
+*/
+type CompressionCodec interface {
+	// Name is the algorithm's name in the device's features, e.g. "zstd" for
+	// sendrecv_v2_zstd. The device must advertise the feature for the codec to be used.
+	Name() string
+	// SyncFlag is the flag set in v2 send and receive requests to select the codec, e.g.
+	// wire.SyncFlagZstd.
+	SyncFlag() uint32
+	// NewWriter returns a writer that compresses data written to it into w. Close flushes
+	// the compressed data, and doesn't close w.
+	NewWriter(w io.Writer) (io.WriteCloser, error)
+	// NewReader returns a reader that decompresses data read from r.
+	NewReader(r io.Reader) (io.ReadCloser, error)
+}
+
+var compressionCodecs = struct {
+	sync.RWMutex
+	byName map[string]CompressionCodec
+}{byName: make(map[string]CompressionCodec)}
+
+// RegisterCompressionCodec makes codec available to all clients. It replaces any codec
+// registered with the same name, so a tuned implementation can replace a default one.
+func RegisterCompressionCodec(codec CompressionCodec) {
+	compressionCodecs.Lock()
+	defer compressionCodecs.Unlock()
+	compressionCodecs.byName[codec.Name()] = codec
+}
+
+// LookupCompressionCodec returns the codec registered with name, if any.
+func LookupCompressionCodec(name string) (CompressionCodec, bool) {
+	compressionCodecs.RLock()
+	defer compressionCodecs.RUnlock()
+	codec, ok := compressionCodecs.byName[name]
+	return codec, ok
+}
+
+/*
+CompressionCodec returns the codec sync transfers with the device would use: the first codec
+in the client's preference that's registered and supported by the device. Returns nil if
+there isn't one, in which case transfers aren't compressed.
+*/
+func (c *Device) CompressionCodec() (CompressionCodec, error) {
+	features, err := c.Features()
+	if err != nil {
+		return nil, wrapClientError(err, c, "CompressionCodec")
+	}
+	return selectCompressionCodec(c.compressionPreference, features), nil
+}
+
+func selectCompressionCodec(preference []string, features []string) CompressionCodec {
+	if preference == nil {
+		preference = DefaultCompressionPreference
+	}
+	supported := make(map[string]bool)
+	for _, feature := range features {
+		supported[feature] = true
+	}
+	if !supported["sendrecv_v2"] {
+		return nil
+	}
+
+	for _, name := range preference {
+		if name == CompressionNone {
+			return nil
+		}
+		if codec, ok := LookupCompressionCodec(name); ok && supported["sendrecv_v2_"+name] {
+			return codec
+		}
+	}
+	return nil
+}
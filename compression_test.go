@@ -0,0 +1,63 @@
+package adb
+
+import (
+	"io"
+	"testing"
+
+	"github.com/mqhack/goadb/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeCodec struct {
+	name string
+}
+
+func (c fakeCodec) Name() string     { return c.name }
+func (c fakeCodec) SyncFlag() uint32 { return 0x100 }
+
+func (c fakeCodec) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return nopWriteCloser{w}, nil
+}
+
+func (c fakeCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return io.NopCloser(r), nil
+}
+
+func TestSelectCompressionCodec(t *testing.T) {
+	RegisterCompressionCodec(fakeCodec{"test-fast"})
+	RegisterCompressionCodec(fakeCodec{"test-small"})
+	features := []string{"shell_v2", "sendrecv_v2", "sendrecv_v2_test-fast", "sendrecv_v2_test-small"}
+
+	assert.Equal(t, fakeCodec{"test-small"}, selectCompressionCodec([]string{"test-small", "test-fast"}, features))
+	// Skips codecs that aren't registered or supported by the device.
+	assert.Equal(t, fakeCodec{"test-fast"}, selectCompressionCodec([]string{"test-unregistered", "test-fast"}, features))
+	assert.Equal(t, fakeCodec{"test-fast"}, selectCompressionCodec([]string{"test-small", "test-fast"}, features[:3]))
+
+	assert.Nil(t, selectCompressionCodec([]string{CompressionNone, "test-fast"}, features))
+	assert.Nil(t, selectCompressionCodec([]string{"test-fast"}, []string{"sendrecv_v2_test-fast"}))
+}
+
+func TestRegisterCompressionCodecReplaces(t *testing.T) {
+	RegisterCompressionCodec(fakeCodec{"test-replaced"})
+	tuned := &fakeCodec{"test-replaced"}
+	RegisterCompressionCodec(tuned)
+
+	codec, ok := LookupCompressionCodec("test-replaced")
+	require.True(t, ok)
+	assert.True(t, codec == tuned)
+}
+
+func TestDeviceCompressionCodec(t *testing.T) {
+	RegisterCompressionCodec(fakeCodec{"test-device"})
+	s := &MockServer{
+		Status:   wire.StatusSuccess,
+		Messages: []string{"shell_v2,sendrecv_v2,sendrecv_v2_test-device\n"},
+	}
+	client := &Adb{server: s, compressionPreference: []string{"test-device"}}
+
+	codec, err := client.Device(DeviceWithSerial("abc")).CompressionCodec()
+	require.NoError(t, err)
+	assert.Equal(t, fakeCodec{"test-device"}, codec)
+	assert.Equal(t, []string{"host-serial:abc:features"}, s.Requests)
+}
@@ -0,0 +1,207 @@
+package adb
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/mqhack/goadb/internal/errors"
+)
+
+// ConnectStatus is the outcome of a successful Adb.Connect.
+//
+//go:generate stringer -type=ConnectStatus
+type ConnectStatus int8
+
+const (
+	// The server connected to the device.
+	ConnectStatusConnected ConnectStatus = iota
+	// The server was already connected to the device.
+	ConnectStatusAlreadyConnected
+	// The server connected, but the device hasn't authorized this host's key yet. The device
+	// is unauthorized until the user accepts the prompt on it.
+	ConnectStatusAuthPending
+)
+
+// ConnectResult describes the connection made by Adb.Connect.
+type ConnectResult struct {
+	// Serial is the serial of the connected device, e.g. "192.168.1.23:5555".
+	Serial string
+	Status ConnectStatus
+	// Message is the server's response, e.g. "already connected to 192.168.1.23:5555".
+	Message string
+}
+
+// Resolver looks up the addresses of host names. It's implemented by *net.Resolver.
+type Resolver interface {
+	LookupHost(ctx context.Context, host string) (addrs []string, err error)
+}
+
+// Endpoint is the address of a device to connect to over TCP/IP.
+type Endpoint struct {
+	// Host is a host name, an IPv4 address, or an IPv6 address, which may have a zone, e.g.
+	// "fe80::1%wlan0", and may be in brackets.
+	//
+	// It can also be the mDNS instance name of a device advertising wireless debugging, e.g.
+	// "adb-2B281FDH20024C-vWgJpq._adb-tls-connect._tcp", which the server resolves with its
+	// mDNS discovery. Port must be zero then.
+	Host string
+	// Port defaults to 5555, adbd's TCP port, if zero.
+	Port int
+}
+
+// String returns the endpoint as host:connect expects it, e.g. "192.168.1.23:5555" or
+// "[fe80::1%wlan0]:5555".
+func (e Endpoint) String() string {
+	host := strings.TrimSuffix(strings.TrimPrefix(e.Host, "["), "]")
+	if e.Port == 0 && (isMDNSInstanceName(host) || !strings.Contains(host, ":")) {
+		return host
+	}
+	port := e.Port
+	if port == 0 {
+		port = defaultDevicePort
+	}
+	return net.JoinHostPort(host, strconv.Itoa(port))
+}
+
+// adbd's default TCP port, which the server connects to if none is given.
+const defaultDevicePort = 5555
+
+// isMDNSInstanceName returns true if host is the instance name of an adb mDNS service, e.g.
+// "adb-2B281FDH20024C-vWgJpq._adb-tls-connect._tcp".
+func isMDNSInstanceName(host string) bool {
+	return strings.HasSuffix(host, "._tcp") || strings.HasSuffix(host, "._tcp.")
+}
+
+func (e Endpoint) validate() error {
+	host := strings.TrimSuffix(strings.TrimPrefix(e.Host, "["), "]")
+	if host == "" {
+		return errors.AssertionErrorf("endpoint has no host")
+	}
+	if e.Port < 0 || e.Port > 65535 {
+		return errors.AssertionErrorf("invalid port %d for %s", e.Port, host)
+	}
+	if isMDNSInstanceName(host) && e.Port != 0 {
+		return errors.AssertionErrorf("mDNS instance name %s can't have a port", host)
+	}
+	return nil
+}
+
+/*
+Connect connects to a device via TCP/IP. host can be anything an Endpoint's Host can be.
+
+The server responds to connection failures with a message rather than an error status, so
+failures like "failed to connect to '192.168.1.23:5555': Connection refused" are returned as
+errors with code AdbError.
+
+Corresponds to the command:
+
+	adb connect <host>:<port>
+*/
+func (c *Adb) Connect(host string, port int) (*ConnectResult, error) {
+	result, err := c.connect(Endpoint{Host: host, Port: port})
+	return result, wrapClientError(err, c, "Connect")
+}
+
+/*
+ConnectEndpoint connects to the device at endpoint via TCP/IP, like Connect.
+
+If ServerConfig.Resolver is set, host names are resolved with it, and the server connects to
+the first address found. IP addresses and mDNS instance names are passed to the server as they
+are.
+*/
+func (c *Adb) ConnectEndpoint(endpoint Endpoint) (*ConnectResult, error) {
+	result, err := c.connect(endpoint)
+	return result, wrapClientError(err, c, "ConnectEndpoint")
+}
+
+func (c *Adb) connect(endpoint Endpoint) (*ConnectResult, error) {
+	endpoint, err := c.resolveEndpoint(context.Background(), endpoint)
+	if err != nil {
+		return nil, err
+	}
+	address := endpoint.String()
+	resp, err := roundTripSingleResponse(c.server, "host:connect:"+address)
+	c.deviceListCache.invalidate()
+	if err != nil {
+		return nil, err
+	}
+	return parseConnectResponse(string(resp), address)
+}
+
+// resolveEndpoint validates endpoint, and replaces its host name with an address from
+// c.resolver, if set.
+func (c *Adb) resolveEndpoint(ctx context.Context, endpoint Endpoint) (Endpoint, error) {
+	if err := endpoint.validate(); err != nil {
+		return endpoint, err
+	}
+	host := strings.TrimSuffix(strings.TrimPrefix(endpoint.Host, "["), "]")
+	if c.resolver == nil || isMDNSInstanceName(host) || isIPAddress(host) {
+		return endpoint, nil
+	}
+	addrs, err := c.resolver.LookupHost(ctx, host)
+	if err != nil {
+		return endpoint, errors.WrapErrorf(err, errors.NetworkError, "error resolving %s", host)
+	}
+	if len(addrs) == 0 {
+		return endpoint, errors.Errorf(errors.NetworkError, "no addresses found for %s", host)
+	}
+	endpoint.Host = addrs[0]
+	return endpoint, nil
+}
+
+// isIPAddress returns true if host is an IPv4 or IPv6 address, ignoring any IPv6 zone.
+func isIPAddress(host string) bool {
+	if i := strings.IndexByte(host, '%'); i >= 0 {
+		host = host[:i]
+	}
+	return net.ParseIP(host) != nil
+}
+
+/*
+ConnectAndWait connects to a device via TCP/IP like Connect, then waits until the device is
+online. If the connection is waiting for the device to authorize this host, this waits for the
+user to accept the prompt on the device.
+
+If ctx is done before the device is online, the error has code Timeout.
+*/
+func (c *Adb) ConnectAndWait(ctx context.Context, host string, port int) (*ConnectResult, error) {
+	result, err := c.Connect(host, port)
+	if err != nil {
+		return nil, wrapClientError(err, c, "ConnectAndWait")
+	}
+	device := c.Device(DeviceWithSerial(result.Serial))
+	if err := device.waitForState(ctx, "device"); err != nil {
+		return result, wrapClientError(err, c, "ConnectAndWait")
+	}
+	return result, nil
+}
+
+// parseConnectResponse parses the message the server responds to host:connect with. address is
+// the connected serial if the message doesn't include one.
+func parseConnectResponse(resp string, address string) (*ConnectResult, error) {
+	resp = strings.TrimSpace(resp)
+	result := &ConnectResult{Serial: address, Message: resp}
+	var rest string
+	switch {
+	case strings.HasPrefix(resp, "already connected to "):
+		result.Status = ConnectStatusAlreadyConnected
+		rest = strings.TrimPrefix(resp, "already connected to ")
+	case strings.HasPrefix(resp, "connected to "):
+		result.Status = ConnectStatusConnected
+		rest = strings.TrimPrefix(resp, "connected to ")
+	case strings.HasPrefix(resp, "failed to authenticate to "):
+		result.Status = ConnectStatusAuthPending
+		rest = strings.TrimPrefix(resp, "failed to authenticate to ")
+	default:
+		if resp == "" {
+			return nil, errors.Errorf(errors.AdbError, "empty response connecting to %s", address)
+		}
+		return nil, errors.Errorf(errors.AdbError, "%s", resp)
+	}
+	if fields := strings.Fields(rest); len(fields) > 0 {
+		result.Serial = fields[0]
+	}
+	return result, nil
+}
@@ -0,0 +1,113 @@
+package adb
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/mqhack/goadb/internal/errors"
+	"github.com/mqhack/goadb/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseConnectResponse(t *testing.T) {
+	for resp, expected := range map[string]*ConnectResult{
+		"connected to 192.168.1.23:5555": {
+			Serial: "192.168.1.23:5555", Status: ConnectStatusConnected, Message: "connected to 192.168.1.23:5555"},
+		"already connected to 192.168.1.23:5555\n": {
+			Serial: "192.168.1.23:5555", Status: ConnectStatusAlreadyConnected, Message: "already connected to 192.168.1.23:5555"},
+		"failed to authenticate to 192.168.1.23:5555": {
+			Serial: "192.168.1.23:5555", Status: ConnectStatusAuthPending, Message: "failed to authenticate to 192.168.1.23:5555"},
+	} {
+		result, err := parseConnectResponse(resp, "pixel.local:5555")
+		require.NoError(t, err, resp)
+		assert.Equal(t, expected, result, resp)
+	}
+
+	_, err := parseConnectResponse("failed to connect to '192.168.1.23:5555': Connection refused", "192.168.1.23:5555")
+	assert.EqualError(t, err, "AdbError: failed to connect to '192.168.1.23:5555': Connection refused")
+}
+
+func TestConnect(t *testing.T) {
+	s := &MockServer{
+		Status:   wire.StatusSuccess,
+		Messages: []string{"already connected to 192.168.1.23:5555"},
+	}
+	client := &Adb{server: s}
+
+	result, err := client.Connect("192.168.1.23", 5555)
+	require.NoError(t, err)
+	assert.Equal(t, ConnectStatusAlreadyConnected, result.Status)
+	assert.Equal(t, "ConnectStatusAlreadyConnected", result.Status.String())
+	assert.Equal(t, []string{"host:connect:192.168.1.23:5555"}, s.Requests)
+}
+
+func TestConnectAndWait(t *testing.T) {
+	s := &MockServer{
+		Status:   wire.StatusSuccess,
+		Messages: []string{"failed to authenticate to 192.168.1.23:5555"},
+	}
+	client := &Adb{server: s}
+
+	result, err := client.ConnectAndWait(context.Background(), "192.168.1.23", 5555)
+	require.NoError(t, err)
+	assert.Equal(t, ConnectStatusAuthPending, result.Status)
+	assert.Equal(t, []string{
+		"host:connect:192.168.1.23:5555",
+		"host-serial:192.168.1.23:5555:wait-for-any-device",
+	}, s.Requests)
+}
+
+func TestEndpointString(t *testing.T) {
+	for endpoint, expected := range map[Endpoint]string{
+		{Host: "192.168.1.23", Port: 5555}:                "192.168.1.23:5555",
+		{Host: "pixel.local", Port: 5556}:                 "pixel.local:5556",
+		{Host: "pixel.local"}:                             "pixel.local",
+		{Host: "fe80::1%wlan0", Port: 5555}:               "[fe80::1%wlan0]:5555",
+		{Host: "[2001:db8::1]", Port: 5555}:               "[2001:db8::1]:5555",
+		{Host: "2001:db8::1"}:                             "[2001:db8::1]:5555",
+		{Host: "adb-2B281F-vWgJpq._adb-tls-connect._tcp"}: "adb-2B281F-vWgJpq._adb-tls-connect._tcp",
+	} {
+		assert.Equal(t, expected, endpoint.String(), "%+v", endpoint)
+	}
+}
+
+func TestConnectEndpointInvalid(t *testing.T) {
+	client := &Adb{server: &MockServer{}}
+	for _, endpoint := range []Endpoint{
+		{},
+		{Host: "[]", Port: 5555},
+		{Host: "192.168.1.23", Port: 70000},
+		{Host: "adb-2B281F-vWgJpq._adb-tls-connect._tcp", Port: 5555},
+	} {
+		_, err := client.ConnectEndpoint(endpoint)
+		assert.Equal(t, errors.AssertionError, code(err), "%+v", endpoint)
+	}
+}
+
+type fakeResolver map[string][]string
+
+func (r fakeResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	addrs, ok := r[host]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	return addrs, nil
+}
+
+func TestConnectEndpointResolver(t *testing.T) {
+	s := &MockServer{
+		Status:   wire.StatusSuccess,
+		Messages: []string{"connected to [fe80::1%wlan0]:5555"},
+	}
+	client := &Adb{server: s, resolver: fakeResolver{"pixel.lan": {"fe80::1%wlan0", "192.168.1.23"}}}
+
+	result, err := client.ConnectEndpoint(Endpoint{Host: "pixel.lan", Port: 5555})
+	require.NoError(t, err)
+	assert.Equal(t, "[fe80::1%wlan0]:5555", result.Serial)
+	assert.Equal(t, []string{"host:connect:[fe80::1%wlan0]:5555"}, s.Requests)
+
+	_, err = client.ConnectEndpoint(Endpoint{Host: "unknown.lan", Port: 5555})
+	assert.Equal(t, errors.NetworkError, code(err))
+}
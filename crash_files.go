@@ -0,0 +1,215 @@
+package adb
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mqhack/goadb/internal/errors"
+	"github.com/mqhack/goadb/parse"
+	"github.com/mqhack/goadb/wire"
+)
+
+// Directories where the platform writes crash reports.
+const (
+	ANRTracesDir  = "/data/anr"
+	TombstonesDir = "/data/tombstones"
+)
+
+// Printed by the listing script once the directory has been listed, to distinguish an
+// empty directory from one that couldn't be read.
+const crashFilesListedMarker = "goadb:listed"
+
+// CollectOptions configures CollectANRTraces and CollectTombstones.
+type CollectOptions struct {
+	// If non-zero, only files modified after Since are collected.
+	Since time.Time
+
+	BulkOptions
+}
+
+// remoteCrashFile is a file found by the listing script.
+type remoteCrashFile struct {
+	path  string
+	mtime time.Time
+}
+
+/*
+CollectANRTraces pulls the ANR traces in /data/anr into dstDir, which is created if necessary.
+
+The directory usually isn't readable by the shell user on production builds, so if listing
+it fails, the files are read with su instead, if the device has it.
+
+The result reports each file by its path on the device. The returned error is only non-nil
+if the directory couldn't be listed at all.
+*/
+func (c *Device) CollectANRTraces(dstDir string, opts CollectOptions) (*PartialResult, error) {
+	result, err := c.collectCrashFiles(ANRTracesDir, dstDir, opts)
+	return result, wrapClientError(err, c, "CollectANRTraces(%s)", dstDir)
+}
+
+/*
+CollectTombstones pulls the native crash reports in /data/tombstones into dstDir, which is
+created if necessary. See CollectANRTraces for how permissions are handled.
+*/
+func (c *Device) CollectTombstones(dstDir string, opts CollectOptions) (*PartialResult, error) {
+	result, err := c.collectCrashFiles(TombstonesDir, dstDir, opts)
+	return result, wrapClientError(err, c, "CollectTombstones(%s)", dstDir)
+}
+
+func (c *Device) collectCrashFiles(remoteDir, dstDir string, opts CollectOptions) (*PartialResult, error) {
+	if err := os.MkdirAll(dstDir, 0755); err != nil {
+		return nil, wrapLocalFileError(err, dstDir)
+	}
+
+	level, files, err := c.listCrashFiles(remoteDir)
+	if err != nil {
+		return nil, err
+	}
+
+	runner := newBulkRunner(opts.BulkOptions)
+	for _, file := range files {
+		if !opts.Since.IsZero() && !file.mtime.After(opts.Since) {
+			continue
+		}
+		file := file
+		runner.run(file.path, func() error {
+			err := c.pullCrashFile(level, file, filepath.Join(dstDir, path.Base(file.path)))
+			return wrapClientError(err, c, "pull(%s)", file.path)
+		})
+	}
+	return runner.result, nil
+}
+
+// listCrashFiles lists the regular files in dir using the first privilege level that can
+// read it. The sync protocol is tried first, since its timestamps are exact and it doesn't
+// depend on the device's tools, but it can only list directories the shell user can read.
+func (c *Device) listCrashFiles(dir string) (privilegeLevel, []remoteCrashFile, error) {
+	// Unreadable directories are listed as empty rather than failing, so an empty listing
+	// has to be checked with the shell.
+	if entries, err := c.ListDirEntries(dir); err == nil {
+		all, err := entries.ReadAll()
+		if err == nil && len(all) > 0 {
+			var files []remoteCrashFile
+			for _, entry := range all {
+				if entry.Mode.IsRegular() {
+					files = append(files, remoteCrashFile{path: path.Join(dir, entry.Name), mtime: entry.ModifiedAt})
+				}
+			}
+			return privilegeLevels[0], files, nil
+		}
+	}
+
+	// Android 5 and earlier don't have stat, so ls is used instead.
+	quoted := shellQuote(dir)
+	script := "if [ -r " + quoted + " ] && [ -x " + quoted + " ]; then " +
+		"if stat -c %Y " + quoted + " >/dev/null 2>&1; then " +
+		"for f in " + quoted + "/*; do [ -f \"$f\" ] && stat -c '%Y %n' \"$f\"; done; " +
+		"else ls -l " + quoted + "; fi; " +
+		"echo " + crashFilesListedMarker + "; fi"
+
+	var tried []string
+	for _, level := range privilegeLevels {
+		output, err := c.RunCommand(level.wrap(script))
+		if err != nil {
+			return privilegeLevel{}, nil, err
+		}
+		if files, ok := parseCrashFileListing(dir, output); ok {
+			return level, files, nil
+		}
+		tried = append(tried, level.name)
+	}
+	return privilegeLevel{}, nil, errors.Errorf(errors.AdbError, "can't read %s (tried %s)", dir, strings.Join(tried, ", "))
+}
+
+// parseCrashFileListing parses the output of the listing script for dir: either lines of
+// "<mtime> <path>", or ls -l output. Returns false if the listing didn't complete.
+func parseCrashFileListing(dir, output string) ([]remoteCrashFile, bool) {
+	var files []remoteCrashFile
+	listed := false
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == crashFilesListedMarker {
+			listed = true
+			continue
+		}
+		if entry, ok := parse.LsLine(line); ok {
+			if entry.Mode.IsRegular() {
+				files = append(files, remoteCrashFile{path: path.Join(dir, entry.Name), mtime: entry.ModifiedAt})
+			}
+			continue
+		}
+		fields := strings.SplitN(line, " ", 2)
+		if len(fields) != 2 {
+			continue
+		}
+		mtime, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		files = append(files, remoteCrashFile{path: fields[1], mtime: time.Unix(mtime, 0)})
+	}
+	return files, listed
+}
+
+// pullCrashFile copies file to localPath by running cat at level.
+func (c *Device) pullCrashFile(level privilegeLevel, file remoteCrashFile, localPath string) error {
+	conn, err := c.openShell(level.wrap("cat " + shellQuote(file.path)))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	local, err := os.Create(localPath)
+	if err != nil {
+		return wrapLocalFileError(err, localPath)
+	}
+
+	exitCode, stderr, err := copyShellStdout(conn, local)
+	if closeErr := local.Close(); err == nil && closeErr != nil {
+		err = errors.WrapErrorf(closeErr, errors.AssertionError, "error writing local file %s", localPath)
+	}
+	if err == nil && exitCode != 0 {
+		err = errors.Errorf(errors.AdbError, "cat exited with status %d: %s", exitCode, strings.TrimSpace(stderr))
+	}
+	if err != nil {
+		os.Remove(localPath)
+		return err
+	}
+
+	err = os.Chtimes(localPath, file.mtime, file.mtime)
+	return errors.WrapErrorf(err, errors.AssertionError, "error setting mtime of local file %s", localPath)
+}
+
+// copyShellStdout writes the stdout of a shell protocol command to w until it exits, and
+// returns its exit code and stderr.
+func copyShellStdout(s wire.ShellScanner, w io.Writer) (int, string, error) {
+	var stderr bytes.Buffer
+	for {
+		id, data, err := s.ReadPacket()
+		if err != nil {
+			return -1, stderr.String(), err
+		}
+
+		switch id {
+		case wire.ShellIDStdout:
+			if _, err := w.Write(data); err != nil {
+				return -1, stderr.String(), errors.WrapErrorf(err, errors.AssertionError, "error writing command output")
+			}
+		case wire.ShellIDStderr:
+			stderr.Write(data)
+		case wire.ShellIDExit:
+			if len(data) != 1 {
+				return -1, stderr.String(), errors.Errorf(errors.ParseError, "expected 1 byte exit code, got %d bytes", len(data))
+			}
+			return int(data[0]), stderr.String(), nil
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package adb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mqhack/goadb/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCrashFileListing(t *testing.T) {
+	files, ok := parseCrashFileListing(TombstonesDir, "1451703845 /data/tombstones/tombstone_00\r\n"+
+		"1451703846 /data/tombstones/tombstone with space\n"+
+		"stat: bad line\n"+
+		crashFilesListedMarker+"\n")
+	assert.True(t, ok)
+	assert.Equal(t, []remoteCrashFile{
+		{"/data/tombstones/tombstone_00", time.Unix(1451703845, 0)},
+		{"/data/tombstones/tombstone with space", time.Unix(1451703846, 0)},
+	}, files)
+
+	_, ok = parseCrashFileListing(TombstonesDir, "/system/bin/sh: su: not found\n")
+	assert.False(t, ok)
+}
+
+func TestParseCrashFileListingLs(t *testing.T) {
+	files, ok := parseCrashFileListing(ANRTracesDir, "-rw-rw-rw- system   system     123456 2015-03-04 05:06 traces.txt\r\n"+
+		"drwxr-xr-x system   system              2015-03-04 05:06 subdir\r\n"+
+		crashFilesListedMarker+"\r\n")
+	assert.True(t, ok)
+	assert.Equal(t, []remoteCrashFile{
+		{"/data/anr/traces.txt", time.Date(2015, 3, 4, 5, 6, 0, 0, time.UTC)},
+	}, files)
+}
+
+func TestListCrashFilesSync(t *testing.T) {
+	s := &MockServer{
+		Status: wire.StatusSuccess,
+		Messages: []string{
+			syncDirEntry(0100644, 12, 1451703845, "tombstone_00"),
+			syncDirEntry(040755, 0, 1451703845, "dir"),
+			"DONE",
+		},
+	}
+	device := v1SyncDevice(s)
+
+	level, files, err := device.listCrashFiles(TombstonesDir)
+	require.NoError(t, err)
+	assert.Equal(t, "shell", level.name)
+	require.Len(t, files, 1)
+	assert.Equal(t, "/data/tombstones/tombstone_00", files[0].path)
+	assert.True(t, files[0].mtime.Equal(time.Unix(1451703845, 0)))
+	assert.Equal(t, []string{"host:transport-any", "sync:"}, s.Requests)
+}
+
+// syncDirEntry encodes a DENT sync response.
+func syncDirEntry(mode, size, mtime uint32, name string) string {
+	var buf bytes.Buffer
+	buf.WriteString("DENT")
+	for _, n := range []uint32{mode, size, mtime, uint32(len(name))} {
+		binary.Write(&buf, binary.LittleEndian, n)
+	}
+	buf.WriteString(name)
+	return buf.String()
+}
+
+func TestCollectTombstonesEmpty(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tombstones")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	dstDir := filepath.Join(dir, "out")
+
+	s := &MockServer{
+		Status:   wire.StatusSuccess,
+		Messages: []string{"DONE", crashFilesListedMarker + "\n"},
+	}
+	device := v1SyncDevice(s)
+
+	result, err := device.CollectTombstones(dstDir, CollectOptions{})
+	require.NoError(t, err)
+	assert.True(t, result.OK())
+	assert.Empty(t, result.Succeeded)
+	assert.DirExists(t, dstDir)
+	assert.True(t, strings.HasPrefix(s.Requests[3], "shell:if [ -r '/data/tombstones' ]"), s.Requests[3])
+}
+
+func TestCollectANRTracesNoPermission(t *testing.T) {
+	dir, err := ioutil.TempDir("", "anr")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	s := &MockServer{Status: wire.StatusSuccess, Messages: []string{"DONE"}}
+	device := v1SyncDevice(s)
+
+	_, err = device.CollectANRTraces(dir, CollectOptions{})
+	assert.True(t, HasErrCode(err, AdbError))
+	assert.Contains(t, ErrorWithCauseChain(err), "can't read /data/anr (tried shell, su 0, su -c)")
+	require.Len(t, s.Requests, 8)
+	assert.True(t, strings.HasPrefix(s.Requests[5], `shell:su 0 sh -c 'if [ -r '\''/data/anr'\'' ]`), s.Requests[5])
+	assert.True(t, strings.HasPrefix(s.Requests[7], "shell:su -c 'if"), s.Requests[7])
+}
+
+func TestPullCrashFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "anr")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	localPath := filepath.Join(dir, "traces.txt")
+
+	s := &MockServer{
+		Status: wire.StatusSuccess,
+		Messages: []string{
+			shellPacket(wire.ShellIDStdout, "----- pid 1234 -----\n"),
+			shellPacket(wire.ShellIDExit, "\x00"),
+		},
+	}
+	device := (&Adb{server: s}).Device(AnyDevice())
+
+	mtime := time.Unix(1451703845, 0)
+	level := privilegeLevels[1]
+	require.NoError(t, device.pullCrashFile(level, remoteCrashFile{"/data/anr/traces.txt", mtime}, localPath))
+	assert.Equal(t, `shell,v2,raw:su 0 sh -c 'cat '\''/data/anr/traces.txt'\'''`, s.Requests[1])
+
+	data, err := ioutil.ReadFile(localPath)
+	require.NoError(t, err)
+	assert.Equal(t, "----- pid 1234 -----\n", string(data))
+	info, err := os.Stat(localPath)
+	require.NoError(t, err)
+	assert.True(t, info.ModTime().Equal(mtime))
+}
+
+func TestPullCrashFileFailure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "anr")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	localPath := filepath.Join(dir, "traces.txt")
+
+	s := &MockServer{
+		Status: wire.StatusSuccess,
+		Messages: []string{
+			shellPacket(wire.ShellIDStderr, "cat: /data/anr/traces.txt: Permission denied\n"),
+			shellPacket(wire.ShellIDExit, "\x01"),
+		},
+	}
+	device := (&Adb{server: s}).Device(AnyDevice())
+
+	err = device.pullCrashFile(privilegeLevels[0], remoteCrashFile{"/data/anr/traces.txt", time.Now()}, localPath)
+	assert.EqualError(t, err, "AdbError: cat exited with status 1: cat: /data/anr/traces.txt: Permission denied")
+	_, err = os.Stat(localPath)
+	assert.True(t, os.IsNotExist(err))
+}
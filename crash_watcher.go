@@ -0,0 +1,350 @@
+package adb
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/mqhack/goadb/internal/errors"
+)
+
+// CrashKind is the type of failure reported by a CrashWatcher.
+//
+//go:generate stringer -type=CrashKind
+type CrashKind int8
+
+const (
+	// CrashJava is an uncaught exception in a Java or Kotlin process.
+	CrashJava CrashKind = iota
+	// CrashNative is a fatal signal in a native process, as reported by debuggerd.
+	CrashNative
+	// CrashANR is an Application Not Responding report from the ActivityManager.
+	CrashANR
+)
+
+// CrashEvent describes a single crash or ANR.
+type CrashEvent struct {
+	Kind CrashKind
+	// Time is when the first line of the report was logged.
+	Time time.Time
+	// PID of the process that crashed, or 0 if it couldn't be determined.
+	PID int
+	// Package is the name of the process that crashed, which for apps is usually the
+	// package name.
+	Package string
+	// Reason is a one-line summary: the exception for Java crashes, the signal for native
+	// crashes, and the reason given by ActivityManager for ANRs.
+	Reason string
+	// StackTrace contains the frames of the crashing thread, with leading whitespace
+	// removed. Empty for ANRs, whose traces aren't logged.
+	StackTrace []string
+	// Log contains every message in the report, in order.
+	Log []string
+}
+
+// How long the watcher waits for more lines of a report before emitting it.
+const crashReportIdleTimeout = 500 * time.Millisecond
+
+/*
+CrashWatcher reports crashes and ANRs on a device by tailing its logcat.
+*/
+type CrashWatcher struct {
+	events chan CrashEvent
+
+	// If an error occurs, it is stored here and events is closed immediately after.
+	err atomic.Value
+}
+
+// C returns a channel that can be received on to get crash events.
+// The channel is closed when the context passed to WatchCrashes is done or an error occurs.
+func (w *CrashWatcher) C() <-chan CrashEvent {
+	return w.events
+}
+
+// Err returns the error that caused the channel returned by C to be closed, if C is closed.
+// It's nil if the context was done.
+// If C is not closed, its return value is undefined.
+func (w *CrashWatcher) Err() error {
+	if err, ok := w.err.Load().(error); ok {
+		return err
+	}
+	return nil
+}
+
+/*
+WatchCrashes starts a CrashWatcher that reports Java crashes, native crashes, and ANRs
+until ctx is done. Crashes logged before the watcher started are not reported, except for
+ones logged earlier in the same second, because the device's clock is only read to the
+second.
+
+Reports are read from logcat's crash and system buffers, so this requires Android L or later.
+*/
+func (c *Device) WatchCrashes(ctx context.Context) (*CrashWatcher, error) {
+	// Starting from the device's current time skips the existing contents of the buffers.
+	since, err := c.deviceLogTime()
+	if err != nil {
+		return nil, wrapClientError(err, c, "WatchCrashes")
+	}
+	stream, err := c.Logcat(ctx, LogcatOptions{
+		Buffers: []LogBuffer{LogBufferCrash, LogBufferSystem},
+		Since:   since,
+	})
+	if err != nil {
+		return nil, wrapClientError(err, c, "WatchCrashes")
+	}
+
+	watcher := &CrashWatcher{events: make(chan CrashEvent)}
+	go func() {
+		defer close(watcher.events)
+		if err := watchCrashes(ctx, stream.C(), watcher.events); err != nil {
+			return
+		}
+		if err := stream.Err(); err != nil {
+			watcher.err.Store(wrapClientError(err, c, "WatchCrashes"))
+		}
+	}()
+	return watcher, nil
+}
+
+// deviceLogTime returns the device's clock, to the second, for use as LogcatOptions.Since.
+func (c *Device) deviceLogTime() (time.Time, error) {
+	output, err := c.RunCommand("date", "+%m-%d %H:%M:%S")
+	if err != nil {
+		return time.Time{}, err
+	}
+	t, err := time.Parse("01-02 15:04:05", strings.TrimSpace(output))
+	if err != nil {
+		return time.Time{}, errors.WrapErrorf(err, errors.ParseError, "error parsing device time %q", strings.TrimSpace(output))
+	}
+	return t, nil
+}
+
+// watchCrashes assembles entries into crash events until entries is closed or ctx is done.
+// Returns ctx.Err() if ctx was done.
+func watchCrashes(ctx context.Context, entries <-chan LogEntry, events chan<- CrashEvent) error {
+	var assembler crashAssembler
+	idle := time.NewTimer(crashReportIdleTimeout)
+	defer idle.Stop()
+
+	send := func(event CrashEvent) error {
+		select {
+		case events <- event:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	for {
+		select {
+		case entry, ok := <-entries:
+			if !ok {
+				for _, event := range assembler.Flush() {
+					if err := send(event); err != nil {
+						return err
+					}
+				}
+				return nil
+			}
+			for _, event := range assembler.Add(entry) {
+				if err := send(event); err != nil {
+					return err
+				}
+			}
+			if !idle.Stop() {
+				select {
+				case <-idle.C:
+				default:
+				}
+			}
+			idle.Reset(crashReportIdleTimeout)
+		case <-idle.C:
+			// Reports are logged all at once, so a pause means they're all complete.
+			for _, event := range assembler.Flush() {
+				if err := send(event); err != nil {
+					return err
+				}
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// crashAssembler groups log entries from the same thread and tag into reports. Reports from
+// different threads can be interleaved in the log, so several may be assembled at once.
+type crashAssembler struct {
+	// Reports being assembled, in the order they started.
+	reports []*crashReport
+}
+
+type crashReport struct {
+	key     crashReportKey
+	entries []LogEntry
+}
+
+type crashReportKey struct {
+	pid, tid int
+	tag      string
+}
+
+// Add adds entry to the report being assembled for its thread and tag, or starts a report if
+// entry is the first line of one. It returns the crashes that are complete: the thread's
+// previous report if entry starts a new one, and any reports that have had no entries for
+// crashReportIdleTimeout of log time.
+func (a *crashAssembler) Add(entry LogEntry) []CrashEvent {
+	done := a.expire(entry.Time)
+
+	key := crashReportKey{pid: entry.PID, tid: entry.TID, tag: entry.Tag}
+	kind := crashKindOf(entry)
+	for i, report := range a.reports {
+		if report.key != key {
+			continue
+		}
+		if kind < 0 {
+			report.entries = append(report.entries, entry)
+			return done
+		}
+		done = append(done, a.remove(i))
+		break
+	}
+
+	if kind >= 0 {
+		a.reports = append(a.reports, &crashReport{key: key, entries: []LogEntry{entry}})
+	}
+	return done
+}
+
+// Flush returns all the crashes currently being assembled.
+func (a *crashAssembler) Flush() []CrashEvent {
+	var done []CrashEvent
+	for _, report := range a.reports {
+		done = append(done, *parseCrash(crashKindOf(report.entries[0]), report.entries))
+	}
+	a.reports = nil
+	return done
+}
+
+// expire removes and returns the reports whose last entry was logged more than
+// crashReportIdleTimeout before now.
+func (a *crashAssembler) expire(now time.Time) []CrashEvent {
+	var done []CrashEvent
+	for i := 0; i < len(a.reports); {
+		last := a.reports[i].entries[len(a.reports[i].entries)-1]
+		if now.Sub(last.Time) > crashReportIdleTimeout {
+			done = append(done, a.remove(i))
+			continue
+		}
+		i++
+	}
+	return done
+}
+
+// remove removes reports[i] and returns its crash.
+func (a *crashAssembler) remove(i int) CrashEvent {
+	report := a.reports[i]
+	a.reports = append(a.reports[:i], a.reports[i+1:]...)
+	return *parseCrash(crashKindOf(report.entries[0]), report.entries)
+}
+
+// crashKindOf returns the kind of report started by entry, or -1 if it doesn't start one.
+func crashKindOf(entry LogEntry) CrashKind {
+	switch {
+	case entry.Tag == "AndroidRuntime" && strings.HasPrefix(entry.Message, "FATAL EXCEPTION"):
+		return CrashJava
+	case entry.Tag == "DEBUG" && strings.HasPrefix(entry.Message, "*** *** ***"):
+		return CrashNative
+	case entry.Tag == "ActivityManager" && strings.HasPrefix(entry.Message, "ANR in "):
+		return CrashANR
+	default:
+		return -1
+	}
+}
+
+var (
+	// Matches e.g. "Process: com.example, PID: 1234".
+	javaProcessPattern = regexp.MustCompile(`^Process: (\S+), PID: (\d+)`)
+	// Matches e.g. "pid: 1234, tid: 1234, name: example  >>> com.example <<<".
+	nativeProcessPattern = regexp.MustCompile(`^pid: (\d+), tid: \d+, name: .*>>> (.*) <<<`)
+	// Matches e.g. "#00 pc 0001a2b4  /system/lib/libc.so (abort+12)".
+	nativeFramePattern = regexp.MustCompile(`^#\d+ pc `)
+	// Matches e.g. "ANR in com.example (com.example/.MainActivity)".
+	anrProcessPattern = regexp.MustCompile(`^ANR in (\S+)`)
+	anrPIDPattern     = regexp.MustCompile(`^PID: (\d+)`)
+)
+
+func parseCrash(kind CrashKind, entries []LogEntry) *CrashEvent {
+	event := &CrashEvent{
+		Kind: kind,
+		Time: entries[0].Time,
+	}
+	for _, entry := range entries {
+		event.Log = append(event.Log, entry.Message)
+	}
+
+	switch kind {
+	case CrashJava:
+		parseJavaCrash(event, entries[0].PID)
+	case CrashNative:
+		parseNativeCrash(event)
+	case CrashANR:
+		parseANR(event)
+	}
+	return event
+}
+
+func parseJavaCrash(event *CrashEvent, pid int) {
+	// AndroidRuntime logs from the crashing process itself.
+	event.PID = pid
+
+	// FATAL EXCEPTION: main
+	// Process: com.example, PID: 1234
+	// java.lang.RuntimeException: boom
+	// 	at com.example.Foo.bar(Foo.java:10)
+	for i, line := range event.Log {
+		if match := javaProcessPattern.FindStringSubmatch(line); match != nil {
+			event.Package = match[1]
+			event.PID = atoiOrZero(match[2])
+			continue
+		}
+		if i == 0 {
+			continue
+		}
+		if event.Reason == "" {
+			event.Reason = line
+			continue
+		}
+		event.StackTrace = append(event.StackTrace, strings.TrimSpace(line))
+	}
+}
+
+func parseNativeCrash(event *CrashEvent) {
+	for _, line := range event.Log {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case event.Package == "" && nativeProcessPattern.MatchString(trimmed):
+			match := nativeProcessPattern.FindStringSubmatch(trimmed)
+			event.PID = atoiOrZero(match[1])
+			event.Package = match[2]
+		case event.Reason == "" && strings.HasPrefix(trimmed, "signal "):
+			event.Reason = trimmed
+		case nativeFramePattern.MatchString(trimmed):
+			event.StackTrace = append(event.StackTrace, trimmed)
+		}
+	}
+}
+
+func parseANR(event *CrashEvent) {
+	for _, line := range event.Log {
+		switch {
+		case event.Package == "" && anrProcessPattern.MatchString(line):
+			event.Package = anrProcessPattern.FindStringSubmatch(line)[1]
+		case event.PID == 0 && anrPIDPattern.MatchString(line):
+			event.PID = atoiOrZero(anrPIDPattern.FindStringSubmatch(line)[1])
+		case event.Reason == "" && strings.HasPrefix(line, "Reason: "):
+			event.Reason = strings.TrimPrefix(line, "Reason: ")
+		}
+	}
+}
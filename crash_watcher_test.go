@@ -0,0 +1,210 @@
+package adb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mqhack/goadb/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func logEntries(tag string, pid, tid int, messages ...string) []LogEntry {
+	var entries []LogEntry
+	for _, msg := range messages {
+		entries = append(entries, LogEntry{PID: pid, TID: tid, Priority: PriorityError, Tag: tag, Message: msg})
+	}
+	return entries
+}
+
+func assembleCrashes(entries []LogEntry) []CrashEvent {
+	var a crashAssembler
+	var events []CrashEvent
+	for _, entry := range entries {
+		events = append(events, a.Add(entry)...)
+	}
+	return append(events, a.Flush()...)
+}
+
+func TestAssembleJavaCrash(t *testing.T) {
+	entries := logEntries("ActivityManager", 500, 510, "Start proc 1234:com.example")
+	entries = append(entries, logEntries("AndroidRuntime", 1234, 1234,
+		"FATAL EXCEPTION: main",
+		"Process: com.example, PID: 1234",
+		"java.lang.RuntimeException: boom",
+		"\tat com.example.Foo.bar(Foo.java:10)",
+		"Caused by: java.lang.NullPointerException",
+		"\t... 1 more")...)
+	entries = append(entries, logEntries("Process", 1234, 1234, "Sending signal. PID: 1234 SIG: 9")...)
+
+	events := assembleCrashes(entries)
+	require.Len(t, events, 1)
+	assert.Equal(t, CrashJava, events[0].Kind)
+	assert.Equal(t, 1234, events[0].PID)
+	assert.Equal(t, "com.example", events[0].Package)
+	assert.Equal(t, "java.lang.RuntimeException: boom", events[0].Reason)
+	assert.Equal(t, []string{
+		"at com.example.Foo.bar(Foo.java:10)",
+		"Caused by: java.lang.NullPointerException",
+		"... 1 more",
+	}, events[0].StackTrace)
+	assert.Len(t, events[0].Log, 6)
+}
+
+func TestAssembleNativeCrash(t *testing.T) {
+	entries := logEntries("DEBUG", 2000, 2000,
+		"*** *** *** *** *** *** *** *** *** *** *** *** *** *** *** ***",
+		"Build fingerprint: 'google/sdk/generic:7.0/NYC/123:userdebug/test-keys'",
+		"pid: 1234, tid: 1240, name: RenderThread  >>> com.example <<<",
+		"signal 11 (SIGSEGV), code 1 (SEGV_MAPERR), fault addr 0x0",
+		"backtrace:",
+		"    #00 pc 0001a2b4  /system/lib/libc.so (abort+12)",
+		"    #01 pc 00004567  /data/app/com.example/lib/libfoo.so")
+
+	events := assembleCrashes(entries)
+	require.Len(t, events, 1)
+	assert.Equal(t, CrashNative, events[0].Kind)
+	assert.Equal(t, 1234, events[0].PID)
+	assert.Equal(t, "com.example", events[0].Package)
+	assert.Equal(t, "signal 11 (SIGSEGV), code 1 (SEGV_MAPERR), fault addr 0x0", events[0].Reason)
+	assert.Equal(t, []string{
+		"#00 pc 0001a2b4  /system/lib/libc.so (abort+12)",
+		"#01 pc 00004567  /data/app/com.example/lib/libfoo.so",
+	}, events[0].StackTrace)
+}
+
+func TestAssembleANR(t *testing.T) {
+	entries := logEntries("ActivityManager", 500, 520,
+		"ANR in com.example (com.example/.MainActivity)",
+		"PID: 1234",
+		"Reason: Input dispatching timed out",
+		"Load: 1.0 / 0.5 / 0.2")
+	// A crash from another process ends the ANR report.
+	entries = append(entries, logEntries("AndroidRuntime", 1300, 1300,
+		"FATAL EXCEPTION: main", "java.lang.Error")...)
+
+	events := assembleCrashes(entries)
+	require.Len(t, events, 2)
+	assert.Equal(t, CrashANR, events[0].Kind)
+	assert.Equal(t, 1234, events[0].PID)
+	assert.Equal(t, "com.example", events[0].Package)
+	assert.Equal(t, "Input dispatching timed out", events[0].Reason)
+	assert.Empty(t, events[0].StackTrace)
+
+	assert.Equal(t, CrashJava, events[1].Kind)
+	assert.Equal(t, 1300, events[1].PID)
+	assert.Equal(t, "java.lang.Error", events[1].Reason)
+}
+
+func TestAssembleIgnoresOtherEntries(t *testing.T) {
+	entries := logEntries("AndroidRuntime", 1, 1, "Shutting down VM")
+	entries = append(entries, logEntries("DEBUG", 2, 2, "some debug message")...)
+	assert.Empty(t, assembleCrashes(entries))
+}
+
+func TestAssembleInterleavedCrashes(t *testing.T) {
+	java := logEntries("AndroidRuntime", 1234, 1234,
+		"FATAL EXCEPTION: main",
+		"Process: com.example, PID: 1234",
+		"java.lang.Error")
+	anr := logEntries("ActivityManager", 500, 510,
+		"ANR in com.other",
+		"PID: 4321",
+		"Reason: Input dispatching timed out")
+	entries := []LogEntry{java[0], anr[0], java[1], anr[1], java[2], anr[2]}
+
+	events := assembleCrashes(entries)
+	require.Len(t, events, 2)
+	assert.Equal(t, CrashJava, events[0].Kind)
+	assert.Equal(t, "java.lang.Error", events[0].Reason)
+	assert.Len(t, events[0].Log, 3)
+	assert.Equal(t, CrashANR, events[1].Kind)
+	assert.Equal(t, "Input dispatching timed out", events[1].Reason)
+	assert.Len(t, events[1].Log, 3)
+}
+
+func TestAssembleEndsReportAtNextHeader(t *testing.T) {
+	entries := logEntries("AndroidRuntime", 1, 1,
+		"FATAL EXCEPTION: main", "java.lang.Error",
+		"FATAL EXCEPTION: main", "java.lang.RuntimeException")
+
+	var a crashAssembler
+	assert.Empty(t, a.Add(entries[0]))
+	assert.Empty(t, a.Add(entries[1]))
+	events := a.Add(entries[2])
+	require.Len(t, events, 1)
+	assert.Equal(t, "java.lang.Error", events[0].Reason)
+	assert.Empty(t, a.Add(entries[3]))
+	events = a.Flush()
+	require.Len(t, events, 1)
+	assert.Equal(t, "java.lang.RuntimeException", events[0].Reason)
+}
+
+func TestAssembleExpiresIdleReports(t *testing.T) {
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	crash := logEntries("AndroidRuntime", 1, 1, "FATAL EXCEPTION: main", "java.lang.Error")
+	crash[0].Time, crash[1].Time = start, start
+	other := LogEntry{Time: start.Add(time.Second), PID: 2, TID: 2, Tag: "Other", Message: "unrelated"}
+
+	var a crashAssembler
+	assert.Empty(t, a.Add(crash[0]))
+	assert.Empty(t, a.Add(crash[1]))
+	// Entries from other threads keep coming, so the report ends when it's been idle for
+	// long enough in log time.
+	events := a.Add(other)
+	require.Len(t, events, 1)
+	assert.Equal(t, "java.lang.Error", events[0].Reason)
+	assert.Empty(t, a.Flush())
+}
+
+func TestWatchCrashesFlushesWhenIdle(t *testing.T) {
+	entries := make(chan LogEntry)
+	events := make(chan CrashEvent)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- watchCrashes(ctx, entries, events)
+	}()
+
+	for _, entry := range logEntries("AndroidRuntime", 1, 1, "FATAL EXCEPTION: main", "java.lang.Error") {
+		entries <- entry
+	}
+	// The report is emitted after the idle timeout without any more entries.
+	event := <-events
+	assert.Equal(t, "java.lang.Error", event.Reason)
+
+	cancel()
+	assert.Equal(t, context.Canceled, <-done)
+}
+
+func TestWatchCrashes(t *testing.T) {
+	s := &MockServer{
+		Status:          wire.StatusSuccess,
+		SeparateOutputs: true,
+		Messages: []string{
+			"01-02 03:04:05\n",
+			"01-02 03:04:05.678  1234  1234 E AndroidRuntime: FATAL EXCEPTION: main\n" +
+				"01-02 03:04:05.678  1234  1234 E AndroidRuntime: Process: com.example, PID: 1234\n" +
+				"01-02 03:04:05.678  1234  1234 E AndroidRuntime: java.lang.Error\n",
+		},
+	}
+	device := (&Adb{server: s}).Device(AnyDevice())
+
+	watcher, err := device.WatchCrashes(context.Background())
+	require.NoError(t, err)
+
+	var events []CrashEvent
+	for event := range watcher.C() {
+		events = append(events, event)
+	}
+	assert.NoError(t, watcher.Err())
+	require.Len(t, events, 1)
+	assert.Equal(t, "com.example", events[0].Package)
+	assert.Equal(t, []string{
+		"host:transport-any", `shell:date "+%m-%d %H:%M:%S"`,
+		"host:transport-any", `exec:logcat -v threadtime -b crash -b system -T "01-02 03:04:05.000"`,
+	}, s.Requests)
+}
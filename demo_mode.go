@@ -0,0 +1,126 @@
+package adb
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/mqhack/goadb/internal/errors"
+)
+
+// Action of the broadcasts that control System UI demo mode.
+const demoModeAction = "com.android.systemui.demo"
+
+// DemoModeOptions configures the status bar shown in demo mode. The zero value shows a clean
+// status bar: 12:00, a full battery and Wi-Fi signal, and no notification icons.
+type DemoModeOptions struct {
+	// Clock is the time shown, as HHMM. Defaults to "1200".
+	Clock string
+	// Battery is the battery level shown, from 1 to 100. Defaults to 100.
+	Battery int
+	// BatteryPlugged shows the battery as charging.
+	BatteryPlugged bool
+	// Wifi, if set, is the number of Wi-Fi signal bars shown, from 0 to 4, or -1 to hide the
+	// Wi-Fi icon. Defaults to 4.
+	Wifi *int
+	// Notifications shows notification icons.
+	Notifications bool
+}
+
+/*
+EnterDemoMode puts the System UI in demo mode, which replaces the status bar's clock, battery
+and network icons with fixed values, for consistent screenshots. Demo mode lasts until
+ExitDemoMode is called or the device reboots.
+
+Corresponds to the commands:
+
+	adb shell settings put global sysui_demo_allowed 1
+	adb shell am broadcast -a com.android.systemui.demo -e command enter
+	adb shell am broadcast -a com.android.systemui.demo -e command clock -e hhmm 1200
+	...
+*/
+func (c *Device) EnterDemoMode(opts DemoModeOptions) error {
+	commands, err := demoModeCommands(opts)
+	if err != nil {
+		return wrapClientError(err, c, "EnterDemoMode")
+	}
+	if _, err := c.RunCommand("settings", "put", "global", "sysui_demo_allowed", "1"); err != nil {
+		return wrapClientError(err, c, "EnterDemoMode")
+	}
+	for _, extras := range commands {
+		if err := c.sendDemoCommand(extras); err != nil {
+			return wrapClientError(err, c, "EnterDemoMode")
+		}
+	}
+	return nil
+}
+
+/*
+ExitDemoMode returns the status bar to showing the device's real state.
+
+Corresponds to the command:
+
+	adb shell am broadcast -a com.android.systemui.demo -e command exit
+*/
+func (c *Device) ExitDemoMode() error {
+	return wrapClientError(c.sendDemoCommand([]string{"command", "exit"}), c, "ExitDemoMode")
+}
+
+// demoModeCommands returns the extras of each broadcast that sets up demo mode with opts, as
+// key, value pairs.
+func demoModeCommands(opts DemoModeOptions) ([][]string, error) {
+	clock := opts.Clock
+	if clock == "" {
+		clock = "1200"
+	}
+	if len(clock) != 4 || !containsOnly(clock, "0123456789") {
+		return nil, errors.AssertionErrorf("invalid demo mode clock %q, expected HHMM", clock)
+	}
+	battery := opts.Battery
+	if battery == 0 {
+		battery = 100
+	}
+	if battery < 1 || battery > 100 {
+		return nil, errors.AssertionErrorf("invalid demo mode battery level %d", battery)
+	}
+	wifi := 4
+	if opts.Wifi != nil {
+		wifi = *opts.Wifi
+	}
+	if wifi < -1 || wifi > 4 {
+		return nil, errors.AssertionErrorf("invalid demo mode Wi-Fi level %d", wifi)
+	}
+
+	wifiExtras := []string{"command", "network", "wifi", "hide"}
+	if wifi >= 0 {
+		wifiExtras = []string{"command", "network", "wifi", "show", "level", strconv.Itoa(wifi)}
+	}
+	return [][]string{
+		{"command", "enter"},
+		{"command", "clock", "hhmm", clock},
+		{"command", "battery", "level", strconv.Itoa(battery), "plugged", strconv.FormatBool(opts.BatteryPlugged)},
+		wifiExtras,
+		{"command", "notifications", "visible", strconv.FormatBool(opts.Notifications)},
+	}, nil
+}
+
+// sendDemoCommand sends a demo mode broadcast with extras, which are key, value pairs.
+func (c *Device) sendDemoCommand(extras []string) error {
+	args := []string{"broadcast", "-a", demoModeAction}
+	for i := 0; i+1 < len(extras); i += 2 {
+		args = append(args, "-e", extras[i], extras[i+1])
+	}
+	output, err := c.RunCommand("am", args...)
+	if err != nil {
+		return err
+	}
+	return checkBroadcastOutput(output)
+}
+
+// checkBroadcastOutput returns an error if am broadcast didn't report that the broadcast
+// completed.
+func checkBroadcastOutput(output string) error {
+	if !strings.Contains(output, "Broadcast completed") {
+		return errors.Errorf(errors.AdbError, "broadcast failed: %s", strings.TrimSpace(output))
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package adb
+
+import (
+	"testing"
+
+	"github.com/mqhack/goadb/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDemoModeCommandsDefaults(t *testing.T) {
+	commands, err := demoModeCommands(DemoModeOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{
+		{"command", "enter"},
+		{"command", "clock", "hhmm", "1200"},
+		{"command", "battery", "level", "100", "plugged", "false"},
+		{"command", "network", "wifi", "show", "level", "4"},
+		{"command", "notifications", "visible", "false"},
+	}, commands)
+}
+
+func TestDemoModeCommands(t *testing.T) {
+	hidden, none, five := -1, 0, 5
+	commands, err := demoModeCommands(DemoModeOptions{
+		Clock:          "0941",
+		Battery:        42,
+		BatteryPlugged: true,
+		Wifi:           &hidden,
+		Notifications:  true,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"command", "clock", "hhmm", "0941"}, commands[1])
+	assert.Equal(t, []string{"command", "battery", "level", "42", "plugged", "true"}, commands[2])
+	assert.Equal(t, []string{"command", "network", "wifi", "hide"}, commands[3])
+	assert.Equal(t, []string{"command", "notifications", "visible", "true"}, commands[4])
+
+	commands, err = demoModeCommands(DemoModeOptions{Wifi: &none})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"command", "network", "wifi", "show", "level", "0"}, commands[3])
+
+	_, err = demoModeCommands(DemoModeOptions{Wifi: &five})
+	assert.EqualError(t, err, "AssertionError: invalid demo mode Wi-Fi level 5")
+}
+
+func TestDemoModeCommandsInvalid(t *testing.T) {
+	_, err := demoModeCommands(DemoModeOptions{Clock: "12:00"})
+	assert.EqualError(t, err, `AssertionError: invalid demo mode clock "12:00", expected HHMM`)
+	_, err = demoModeCommands(DemoModeOptions{Battery: 101})
+	assert.EqualError(t, err, "AssertionError: invalid demo mode battery level 101")
+}
+
+func TestExitDemoMode(t *testing.T) {
+	s := &MockServer{
+		Status:   wire.StatusSuccess,
+		Messages: []string{"Broadcasting: Intent { act=com.android.systemui.demo flg=0x400000 (has extras) }\r\nBroadcast completed: result=0\r\n"},
+	}
+	device := (&Adb{server: s}).Device(AnyDevice())
+
+	require.NoError(t, device.ExitDemoMode())
+	assert.Equal(t, "shell:am broadcast -a com.android.systemui.demo -e command exit", s.Requests[1])
+}
+
+func TestExitDemoModeFailed(t *testing.T) {
+	s := &MockServer{
+		Status:   wire.StatusSuccess,
+		Messages: []string{"Security exception: Permission Denial\r\n"},
+	}
+	device := (&Adb{server: s}).Device(AnyDevice())
+
+	err := device.ExitDemoMode()
+	assert.True(t, HasErrCode(err, AdbError))
+	assert.Contains(t, ErrorWithCauseChain(err), "broadcast failed: Security exception: Permission Denial")
+}
@@ -1,10 +1,12 @@
 package adb
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"os"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/mqhack/goadb/internal/errors"
@@ -24,6 +26,30 @@ type Device struct {
 
 	// Used to get device info.
 	deviceListFunc func() ([]*DeviceInfo, error)
+
+	// The *stagedShellProfile set by SetShellProfile.
+	shellProfile atomic.Value
+
+	// The *CommandPriority set by SetCommandPriority.
+	priority atomic.Value
+
+	// The *OutputEncoding set by SetOutputEncoding.
+	outputEncoding atomic.Value
+
+	// The logical ID of the display set by SetInputDisplay, an int.
+	inputDisplay atomic.Value
+
+	// The syncFeatures of the device, once they've been read.
+	syncFeatures atomic.Value
+
+	// From ServerConfig.CompressionPreference.
+	compressionPreference []string
+
+	// Restrictions of the server, shared with the Adb.
+	restrictions *serverRestrictions
+
+	// What Close releases.
+	resources *deviceResources
 }
 
 func (c *Device) String() string {
@@ -42,6 +68,32 @@ func (c *Device) Serial() (string, error) {
 	return attr, wrapClientError(err, c, "Serial")
 }
 
+/*
+Features returns the features supported by both the device and the server, e.g. "shell_v2"
+and "sendrecv_v2_zstd".
+
+Corresponds to the command:
+
+	adb features
+*/
+func (c *Device) Features() ([]string, error) {
+	attr, err := c.getAttribute("features")
+	if err != nil {
+		return nil, wrapClientError(err, c, "Features")
+	}
+	return parseFeatures(attr), nil
+}
+
+func parseFeatures(attr string) []string {
+	var features []string
+	for _, feature := range strings.Split(strings.TrimSpace(attr), ",") {
+		if feature != "" {
+			features = append(features, feature)
+		}
+	}
+	return features
+}
+
 func (c *Device) DevicePath() (string, error) {
 	attr, err := c.getAttribute("get-devpath")
 	return attr, wrapClientError(err, c, "DevicePath")
@@ -102,7 +154,7 @@ This method quotes the arguments for you, and will return an error if any of the
 contain double quotes.
 */
 func (c *Device) RunCommand(cmd string, args ...string) (string, error) {
-	cmd, err := prepareCommandLine(cmd, args...)
+	cmd, err := c.commandLine(cmd, args...)
 	if err != nil {
 		return "", wrapClientError(err, c, "RunCommand")
 	}
@@ -126,7 +178,121 @@ func (c *Device) RunCommand(cmd string, args ...string) (string, error) {
 	}
 
 	resp, err := conn.ReadUntilEof()
-	return string(resp), wrapClientError(err, c, "RunCommand")
+	if err != nil {
+		return string(resp), wrapClientError(err, c, "RunCommand")
+	}
+	output, err := c.getOutputEncoding().normalize(string(resp))
+	return output, wrapClientError(err, c, "RunCommand")
+}
+
+// getProp returns the value of the system property name, or "" if it's not set.
+func (c *Device) getProp(name string) (string, error) {
+	value, err := c.RunCommand("getprop", name)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(value), nil
+}
+
+/*
+OpenShell starts the specified command on the device using the shell protocol (aka shell v2),
+and returns the connection that carries its stdin, stdout, stderr, and exit code.
+
+Unlike RunCommand, stdout and stderr are kept separate, and the exit code of the command is
+reported. The command is run without a PTY, so output is binary-safe.
+The shell protocol is only supported by devices running Android N or later.
+
+Arguments are quoted in the same way as RunCommand. Closing the connection before the
+command exits will cause adbd to kill the command.
+*/
+func (c *Device) OpenShell(cmd string, args ...string) (*wire.ShellConn, error) {
+	conn, err := c.openShell(cmd, args...)
+	return conn, wrapClientError(err, c, "OpenShell")
+}
+
+func (c *Device) openShell(cmd string, args ...string) (*wire.ShellConn, error) {
+	cmd, err := c.commandLine(cmd, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := c.dialDevice()
+	if err != nil {
+		return nil, err
+	}
+
+	req := fmt.Sprintf("shell,v2,raw:%s", cmd)
+	if err = conn.SendMessage([]byte(req)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if _, err = conn.ReadStatus(req); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return conn.NewShellConn(), nil
+}
+
+/*
+OpenExec starts the specified command on the device using the exec: service, and returns
+a connection to the command's stdin and stdout. Stderr is merged into stdout.
+
+The exec: service runs the command without a PTY, so unlike RunCommand the output is
+binary-safe (no LF to CRLF translation). It doesn't report the exit code, and there is no
+way to send EOF on stdin without closing the connection, which kills the command.
+Supported on devices running Android L or later.
+
+Arguments are quoted in the same way as RunCommand.
+*/
+func (c *Device) OpenExec(cmd string, args ...string) (io.ReadWriteCloser, error) {
+	conn, err := c.openExec(cmd, args...)
+	return conn, wrapClientError(err, c, "OpenExec")
+}
+
+func (c *Device) openExec(cmd string, args ...string) (*wire.Conn, error) {
+	cmd, err := c.commandLine(cmd, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := c.dialDevice()
+	if err != nil {
+		return nil, err
+	}
+
+	req := fmt.Sprintf("exec:%s", cmd)
+	if err = conn.SendMessage([]byte(req)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if _, err = conn.ReadStatus(req); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+/*
+DialSocket opens a connection to a socket on the device through its transport, e.g.
+"localabstract:scrcpy" or "tcp:8080". It's what adb forward does for each connection to the
+forwarded host port, without needing a host port.
+*/
+func (c *Device) DialSocket(socket string) (io.ReadWriteCloser, error) {
+	conn, err := c.dialDevice()
+	if err != nil {
+		return nil, wrapClientError(err, c, "DialSocket(%s)", socket)
+	}
+	if err = wire.SendMessageString(conn, socket); err != nil {
+		conn.Close()
+		return nil, wrapClientError(err, c, "DialSocket(%s)", socket)
+	}
+	if _, err = conn.ReadStatus(socket); err != nil {
+		conn.Close()
+		return nil, wrapClientError(err, c, "DialSocket(%s)", socket)
+	}
+	return conn, nil
 }
 
 /*
@@ -151,54 +317,200 @@ func (c *Device) Remount() (string, error) {
 	return string(resp), wrapClientError(err, c, "Remount")
 }
 
+/*
+ReconnectFromHost tells the adb server to drop its transport to the device and perform a
+new handshake. The device isn't restarted or asked to do anything, so this is useful when
+the server's connection is wedged but adbd on the device is fine.
+
+The device is briefly offline while it reconnects; use a DeviceWatcher to wait for it to
+come back online.
+
+Corresponds to the command:
+
+	adb -s <serial> reconnect
+*/
+func (c *Device) ReconnectFromHost() error {
+	// The server replies "done" once the transport has been kicked.
+	_, err := c.getAttribute("reconnect")
+	return wrapClientError(err, c, "ReconnectFromHost")
+}
+
+// ListDirEntries lists the directory at path. Devices with the ls_v2 feature are listed with
+// the v2 request, which reports sizes over 4GB, and owners.
 func (c *Device) ListDirEntries(path string) (*DirEntries, error) {
+	entries, err := c.openDirEntries(context.Background(), path)
+	return entries, wrapClientError(err, c, "ListDirEntries(%s)", path)
+}
+
+/*
+ListDirEntriesContext lists the directory at path like ListDirEntries, but stops once ctx is
+done: Next returns false, and Err returns an error with code Timeout. Use it to bound scans of
+large directories, e.g. the camera folder.
+*/
+func (c *Device) ListDirEntriesContext(ctx context.Context, path string) (*DirEntries, error) {
+	entries, err := c.openDirEntries(ctx, path)
+	return entries, wrapClientError(err, c, "ListDirEntriesContext(%s)", path)
+}
+
+func (c *Device) openDirEntries(ctx context.Context, path string) (*DirEntries, error) {
+	if ctx.Err() != nil {
+		return nil, errors.WrapErrorf(ctx.Err(), errors.Timeout, "listing of %s cancelled", path)
+	}
+	features := c.getSyncFeatures()
 	conn, err := c.getSyncConn()
 	if err != nil {
-		return nil, wrapClientError(err, c, "ListDirEntries(%s)", path)
+		return nil, err
 	}
 
-	entries, err := listDirEntries(conn, path)
-	return entries, wrapClientError(err, c, "ListDirEntries(%s)", path)
+	var entries *DirEntries
+	if features.listV2 {
+		entries, err = listDirEntriesV2(conn, path)
+	} else {
+		entries, err = listDirEntries(conn, path)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if ctx.Done() != nil {
+		entries.ctx = ctx
+		entries.stop = closeWhenDone(ctx, conn)
+	}
+	return entries, nil
 }
 
+// Stat returns the mode, size and modification time of the file at path, without following
+// symlinks. Devices with the stat_v2 feature are asked with the v2 request, which reports
+// sizes over 4GB, and the file's owner. It's the same as Lstat.
 func (c *Device) Stat(path string) (*DirEntry, error) {
+	entry, err := c.lstat(path)
+	return entry, wrapClientError(err, c, "Stat(%s)", path)
+}
+
+// Lstat returns the mode, size and modification time of the file at path. If it's a
+// symlink, the entry describes the symlink, whose mode has os.ModeSymlink set; ReadLink
+// returns its target.
+func (c *Device) Lstat(path string) (*DirEntry, error) {
+	entry, err := c.lstat(path)
+	return entry, wrapClientError(err, c, "Lstat(%s)", path)
+}
+
+func (c *Device) lstat(path string) (*DirEntry, error) {
+	features := c.getSyncFeatures()
 	conn, err := c.getSyncConn()
 	if err != nil {
-		return nil, wrapClientError(err, c, "Stat(%s)", path)
+		return nil, err
 	}
 	defer conn.Close()
 
-	entry, err := stat(conn, path)
-	return entry, wrapClientError(err, c, "Stat(%s)", path)
+	if features.statV2 {
+		return lstatV2(conn, path)
+	}
+	return stat(conn, path)
 }
 
-func (c *Device) OpenRead(path string) (io.ReadCloser, error) {
-	conn, err := c.getSyncConn()
+// syncFeatures are the v2 sync requests a device supports.
+type syncFeatures struct {
+	statV2 bool
+	listV2 bool
+	// All the device's features, which the compression codecs it supports are chosen from.
+	all []string
+}
+
+func parseSyncFeatures(features []string) syncFeatures {
+	f := syncFeatures{all: features}
+	for _, feature := range features {
+		switch feature {
+		case "stat_v2":
+			f.statV2 = true
+		case "ls_v2":
+			f.listV2 = true
+		}
+	}
+	return f
+}
+
+// getSyncFeatures returns the v2 sync requests the device supports, which are read from its
+// features the first time. If the features can't be read, e.g. because the server is too old
+// to report them, only the v1 requests are used.
+func (c *Device) getSyncFeatures() syncFeatures {
+	if f, ok := c.syncFeatures.Load().(syncFeatures); ok {
+		return f
+	}
+	features, err := c.Features()
 	if err != nil {
-		return nil, wrapClientError(err, c, "OpenRead(%s)", path)
+		return syncFeatures{}
 	}
+	f := parseSyncFeatures(features)
+	c.syncFeatures.Store(f)
+	return f
+}
 
-	reader, err := receiveFile(conn, path)
+// OpenRead opens the file at path on the device, and returns a reader that reads its
+// contents. The file is compressed while it's transferred if the client's compression
+// preference names a codec the device supports, unless it's already compressed.
+func (c *Device) OpenRead(path string) (io.ReadCloser, error) {
+	reader, err := c.openRead(path, "")
 	return reader, wrapClientError(err, c, "OpenRead(%s)", path)
 }
 
+// openRead opens the file at path, compressed with the codec named compression, or chosen
+// by transferCodec if it's empty.
+func (c *Device) openRead(path string, compression string) (io.ReadCloser, error) {
+	codec, err := c.transferCodec(compression)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := c.getSyncConn()
+	if err != nil {
+		return nil, err
+	}
+	if codec != nil && (compression != "" || isCompressible(path)) {
+		return receiveFileV2(conn, path, codec)
+	}
+	return receiveFile(conn, path)
+}
+
 // OpenWrite opens the file at path on the device, creating it with the permissions specified
 // by perms if necessary, and returns a writer that writes to the file.
 // The files modification time will be set to mtime when the WriterCloser is closed. The zero value
 // is TimeOfClose, which will use the time the Close method is called as the modification time.
+// Like OpenRead, the file is compressed while it's transferred if the device supports a
+// preferred codec, and the start of the file compresses well.
 func (c *Device) OpenWrite(path string, perms os.FileMode, mtime time.Time) (io.WriteCloser, error) {
+	writer, _, err := c.openWrite(path, perms, mtime, "")
+	return writer, wrapClientError(err, c, "OpenWrite(%s)", path)
+}
+
+// openWrite opens the file at path for writing, compressed with the codec named compression,
+// or chosen by transferCodec if it's empty. Also returns the connection, which aborts the
+// write if it's closed before the writer is, so the device removes the partial file.
+func (c *Device) openWrite(path string, perms os.FileMode, mtime time.Time, compression string) (io.WriteCloser, io.Closer, error) {
+	codec, err := c.transferCodec(compression)
+	if err != nil {
+		return nil, nil, err
+	}
 	conn, err := c.getSyncConn()
 	if err != nil {
-		return nil, wrapClientError(err, c, "OpenWrite(%s)", path)
+		return nil, nil, err
+	}
+	if codec != nil {
+		return newSyncFileWriterV2(conn, path, perms, mtime, codec, compression != ""), conn, nil
 	}
-
 	writer, err := sendFile(conn, path, perms, mtime)
-	return writer, wrapClientError(err, c, "OpenWrite(%s)", path)
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	return writer, conn, nil
 }
 
 // getAttribute returns the first message returned by the server by running
 // <host-prefix>:<attr>, where host-prefix is determined from the DeviceDescriptor.
 func (c *Device) getAttribute(attr string) (string, error) {
+	if err := c.checkServerRestrictions(); err != nil {
+		return "", err
+	}
 	resp, err := roundTripSingleResponse(c.server,
 		fmt.Sprintf("%s:%s", c.descriptor.getHostPrefix(), attr))
 	if err != nil {
@@ -207,6 +519,35 @@ func (c *Device) getAttribute(attr string) (string, error) {
 	return string(resp), nil
 }
 
+// waitForState blocks until the server reports the device is in state, which is one of the
+// states accepted by adb wait-for, e.g. "device" or "sideload".
+func (c *Device) waitForState(ctx context.Context, state string) error {
+	if err := c.checkServerRestrictions(); err != nil {
+		return err
+	}
+	conn, err := c.server.Dial()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	stop := closeWhenDone(ctx, conn)
+	defer stop()
+
+	req := fmt.Sprintf("%s:wait-for-%s-%s", c.descriptor.getHostPrefix(), c.descriptor.getWaitTransport(), state)
+	if err = wire.SendMessageString(conn, req); err != nil {
+		return err
+	}
+	// The server acknowledges the request, then sends a second status once the device is
+	// in the state.
+	if _, err = conn.ReadStatus(req); err == nil {
+		_, err = conn.ReadStatus(req)
+	}
+	if ctx.Err() != nil {
+		return errors.WrapErrorf(ctx.Err(), errors.Timeout, "device didn't reach state %s", state)
+	}
+	return err
+}
+
 func (c *Device) getSyncConn() (*wire.SyncConn, error) {
 	conn, err := c.dialDevice()
 	if err != nil {
@@ -227,6 +568,12 @@ func (c *Device) getSyncConn() (*wire.SyncConn, error) {
 // dialDevice switches the connection to communicate directly with the device
 // by requesting the transport defined by the DeviceDescriptor.
 func (c *Device) dialDevice() (*wire.Conn, error) {
+	if err := c.resources.checkOpen(); err != nil {
+		return nil, err
+	}
+	if err := c.checkServerRestrictions(); err != nil {
+		return nil, err
+	}
 	conn, err := c.server.Dial()
 	if err != nil {
 		return nil, err
@@ -243,6 +590,7 @@ func (c *Device) dialDevice() (*wire.Conn, error) {
 		return nil, err
 	}
 
+	c.resources.track(conn)
 	return conn, nil
 }
 
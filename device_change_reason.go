@@ -0,0 +1,141 @@
+package adb
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// ChangeReason is a best guess at why a device changed state, reported on
+// DeviceStateChangedEvent.
+//
+//go:generate stringer -type=ChangeReason
+type ChangeReason int8
+
+const (
+	// ReasonUnknown means the watcher couldn't tell why the state changed, or the change
+	// (e.g. a device being plugged in for the first time) doesn't need explaining.
+	ReasonUnknown ChangeReason = iota
+	// ReasonUSBDisconnect means the device went offline because it was unplugged: its USB
+	// device disappeared from the host.
+	ReasonUSBDisconnect
+	// ReasonAdbdRestart means adbd on the device restarted, e.g. because of adb tcpip or
+	// adb root. Reported when a device goes offline while its USB device is still present
+	// on the host, and when a device comes back online shortly after going offline.
+	ReasonAdbdRestart
+	// ReasonUnauthorized means the device stopped trusting the host's key, e.g. because
+	// USB debugging authorizations were revoked.
+	ReasonUnauthorized
+)
+
+// Devices that come back online within this long of going offline are assumed to have
+// restarted adbd rather than been unplugged and plugged back in.
+const adbdRestartWindow = 10 * time.Second
+
+const usbDevpathPrefix = "usb:"
+
+// changeClassifier guesses the reasons for state changes from the history of each device.
+type changeClassifier struct {
+	// Returns the server's devpath for the device, e.g. "usb:1-1".
+	getDevpath func(serial string) (string, error)
+	// Returns whether the USB device at devpath is still attached to the host, and whether
+	// that could be determined at all.
+	usbDevicePresent func(devpath string) (present, ok bool)
+	now              func() time.Time
+
+	// Devpaths of online devices, by serial.
+	devpaths map[string]string
+	// When each device last went offline, by serial.
+	wentOffline map[string]time.Time
+}
+
+func newChangeClassifier(server server) *changeClassifier {
+	present := func(string) (bool, bool) { return false, false }
+	if isLocalServer(server) {
+		present = hostUSBDevicePresent
+	}
+
+	return &changeClassifier{
+		getDevpath: func(serial string) (string, error) {
+			resp, err := roundTripSingleResponse(server, "host-serial:"+serial+":get-devpath")
+			return string(resp), err
+		},
+		usbDevicePresent: present,
+		now:              time.Now,
+		devpaths:         make(map[string]string),
+		wentOffline:      make(map[string]time.Time),
+	}
+}
+
+// classify sets the Reason of event, and updates the history of the device.
+func (c *changeClassifier) classify(event *DeviceStateChangedEvent) {
+	now := c.now()
+	offlineAt, recentlyOffline := c.wentOffline[event.Serial]
+	recentlyOffline = recentlyOffline && now.Sub(offlineAt) < adbdRestartWindow
+
+	switch {
+	case event.NewState == StateUnauthorized && (event.OldState == StateOnline || recentlyOffline):
+		event.Reason = ReasonUnauthorized
+		delete(c.wentOffline, event.Serial)
+
+	case event.WentOffline():
+		event.Reason = ReasonUnknown
+		if devpath := c.devpaths[event.Serial]; strings.HasPrefix(devpath, usbDevpathPrefix) {
+			if present, ok := c.usbDevicePresent(devpath); ok {
+				if present {
+					event.Reason = ReasonAdbdRestart
+				} else {
+					event.Reason = ReasonUSBDisconnect
+				}
+			}
+		}
+		delete(c.devpaths, event.Serial)
+		c.wentOffline[event.Serial] = now
+
+	case event.CameOnline():
+		if recentlyOffline {
+			event.Reason = ReasonAdbdRestart
+		}
+		delete(c.wentOffline, event.Serial)
+		// Remember where the device is attached so it can be checked when it goes offline.
+		if devpath, err := c.getDevpath(event.Serial); err == nil {
+			c.devpaths[event.Serial] = devpath
+		}
+	}
+}
+
+// isLocalServer returns true if server runs on this host, so its USB devices are visible.
+func isLocalServer(s server) bool {
+	if ts, ok := s.(*transcribingServer); ok {
+		s = ts.server
+	}
+	rs, ok := s.(*realServer)
+	if !ok {
+		return false
+	}
+	switch rs.config.Host {
+	case "localhost", "127.0.0.1", "::1":
+		return true
+	default:
+		return false
+	}
+}
+
+// hostUSBDevicePresent checks sysfs for the USB device at devpath. Only supported on Linux,
+// where the server's devpaths are sysfs device names.
+func hostUSBDevicePresent(devpath string) (present, ok bool) {
+	if runtime.GOOS != "linux" {
+		return false, false
+	}
+	name := strings.TrimPrefix(devpath, usbDevpathPrefix)
+	if name == "" || strings.ContainsRune(name, '/') {
+		return false, false
+	}
+	_, err := os.Stat(filepath.Join("/sys/bus/usb/devices", name))
+	if err == nil {
+		return true, true
+	}
+	return false, os.IsNotExist(err)
+}
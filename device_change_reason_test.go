@@ -0,0 +1,103 @@
+package adb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mqhack/goadb/internal/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeClassifierEnv struct {
+	now      time.Time
+	attached map[string]bool
+}
+
+func newTestClassifier(env *fakeClassifierEnv, sysfsSupported bool) *changeClassifier {
+	return &changeClassifier{
+		getDevpath: func(serial string) (string, error) {
+			if serial == "192.168.1.5:5555" {
+				return "", errors.Errorf(errors.AdbError, "unknown")
+			}
+			return "usb:1-" + serial, nil
+		},
+		usbDevicePresent: func(devpath string) (bool, bool) {
+			return env.attached[devpath], sysfsSupported
+		},
+		now:         func() time.Time { return env.now },
+		devpaths:    make(map[string]string),
+		wentOffline: make(map[string]time.Time),
+	}
+}
+
+func classifyEvent(c *changeClassifier, serial string, oldState, newState DeviceState) ChangeReason {
+	event := DeviceStateChangedEvent{Serial: serial, OldState: oldState, NewState: newState}
+	c.classify(&event)
+	return event.Reason
+}
+
+func TestClassifyUSBDisconnect(t *testing.T) {
+	env := &fakeClassifierEnv{now: time.Unix(1000, 0), attached: map[string]bool{"usb:1-1": true}}
+	c := newTestClassifier(env, true)
+
+	assert.Equal(t, ReasonUnknown, classifyEvent(c, "1", StateDisconnected, StateOnline))
+	env.attached["usb:1-1"] = false
+	assert.Equal(t, ReasonUSBDisconnect, classifyEvent(c, "1", StateOnline, StateDisconnected))
+
+	// Plugged back in much later.
+	env.now = env.now.Add(time.Minute)
+	assert.Equal(t, ReasonUnknown, classifyEvent(c, "1", StateDisconnected, StateOnline))
+}
+
+func TestClassifyAdbdRestart(t *testing.T) {
+	env := &fakeClassifierEnv{now: time.Unix(1000, 0), attached: map[string]bool{"usb:1-1": true}}
+	c := newTestClassifier(env, true)
+
+	classifyEvent(c, "1", StateDisconnected, StateOnline)
+	assert.Equal(t, ReasonAdbdRestart, classifyEvent(c, "1", StateOnline, StateDisconnected))
+	env.now = env.now.Add(2 * time.Second)
+	assert.Equal(t, ReasonAdbdRestart, classifyEvent(c, "1", StateDisconnected, StateOnline))
+}
+
+func TestClassifyWithoutSysfs(t *testing.T) {
+	env := &fakeClassifierEnv{now: time.Unix(1000, 0)}
+	c := newTestClassifier(env, false)
+
+	classifyEvent(c, "1", StateDisconnected, StateOnline)
+	assert.Equal(t, ReasonUnknown, classifyEvent(c, "1", StateOnline, StateOffline))
+	// Timing still identifies a quick reconnect.
+	env.now = env.now.Add(time.Second)
+	assert.Equal(t, ReasonAdbdRestart, classifyEvent(c, "1", StateOffline, StateOnline))
+}
+
+func TestClassifyTCPDevice(t *testing.T) {
+	env := &fakeClassifierEnv{now: time.Unix(1000, 0)}
+	c := newTestClassifier(env, true)
+
+	classifyEvent(c, "192.168.1.5:5555", StateDisconnected, StateOnline)
+	assert.Equal(t, ReasonUnknown, classifyEvent(c, "192.168.1.5:5555", StateOnline, StateOffline))
+}
+
+func TestClassifyUnauthorized(t *testing.T) {
+	env := &fakeClassifierEnv{now: time.Unix(1000, 0), attached: map[string]bool{"usb:1-1": true}}
+	c := newTestClassifier(env, true)
+
+	classifyEvent(c, "1", StateDisconnected, StateOnline)
+	assert.Equal(t, ReasonUnauthorized, classifyEvent(c, "1", StateOnline, StateUnauthorized))
+
+	// Revoking authorizations usually makes the device reconnect first.
+	classifyEvent(c, "1", StateUnauthorized, StateOnline)
+	classifyEvent(c, "1", StateOnline, StateDisconnected)
+	env.now = env.now.Add(time.Second)
+	assert.Equal(t, ReasonUnauthorized, classifyEvent(c, "1", StateDisconnected, StateUnauthorized))
+
+	// A new device that has never been authorized isn't a revocation.
+	assert.Equal(t, ReasonUnknown, classifyEvent(c, "2", StateDisconnected, StateUnauthorized))
+}
+
+func TestIsLocalServer(t *testing.T) {
+	assert.True(t, isLocalServer(&realServer{config: ServerConfig{Host: "localhost"}}))
+	assert.False(t, isLocalServer(&realServer{config: ServerConfig{Host: "10.0.0.1"}}))
+	assert.False(t, isLocalServer(&MockServer{}))
+	assert.True(t, isLocalServer(&transcribingServer{server: &realServer{config: ServerConfig{Host: "localhost"}}}))
+}
@@ -78,3 +78,16 @@ func (d DeviceDescriptor) getTransportDescriptor() string {
 		panic(fmt.Sprintf("invalid DeviceDescriptorType: %v", d.descriptorType))
 	}
 }
+
+// getWaitTransport returns the transport type used in host wait-for-<transport>-<state>
+// requests.
+func (d DeviceDescriptor) getWaitTransport() string {
+	switch d.descriptorType {
+	case DeviceUsb:
+		return "usb"
+	case DeviceLocal:
+		return "local"
+	default:
+		return "any"
+	}
+}
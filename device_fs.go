@@ -0,0 +1,346 @@
+package adb
+
+import (
+	"bufio"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mqhack/goadb/internal/errors"
+	"github.com/mqhack/goadb/parse"
+)
+
+// Printed by the shell fallbacks of DeviceFS once they've succeeded, to distinguish an empty
+// directory or file from one that couldn't be read.
+const deviceFSReadableMarker = "goadb:readable"
+
+/*
+DeviceFS is a read-only view of a device's file system, returned by Device.FS. It implements
+fs.FS, fs.ReadDirFS and fs.StatFS, so it can be used with fs.WalkDir, fs.ReadFile,
+http.FS and the like.
+
+Names are resolved from the device's root directory, so "system/build.prop" is
+/system/build.prop, and "." is /. Open and Stat follow symlinks, while ReadDir reports them as
+symlinks.
+
+Files and directories are read with the sync protocol. If the shell user can't read them, they
+are read with ls and cat instead, as root if su is available. Times of directory entries read
+with ls are only accurate to the minute.
+
+Errors are *fs.PathError values, and match fs.ErrNotExist, fs.ErrPermission or fs.ErrInvalid
+with errors.Is where they apply.
+*/
+type DeviceFS struct {
+	device *Device
+}
+
+var (
+	_ fs.ReadDirFS = &DeviceFS{}
+	_ fs.StatFS    = &DeviceFS{}
+)
+
+// FS returns a read-only view of the device's file system.
+func (c *Device) FS() *DeviceFS {
+	return &DeviceFS{device: c}
+}
+
+// Open opens the named file or directory. Directories implement fs.ReadDirFile.
+func (f *DeviceFS) Open(name string) (fs.File, error) {
+	remotePath, err := deviceFSPath("open", name)
+	if err != nil {
+		return nil, err
+	}
+	entry, err := f.stat(remotePath)
+	if err != nil {
+		return nil, deviceFSError("open", name, err)
+	}
+	info := &deviceFileInfo{name: path.Base(name), entry: entry}
+	if entry.Mode.IsDir() {
+		return &deviceDir{fsys: f, name: name, path: remotePath, info: info}, nil
+	}
+
+	r, err := f.openRead(remotePath)
+	if err != nil {
+		return nil, deviceFSError("open", name, err)
+	}
+	return &deviceFile{name: name, info: info, r: r}, nil
+}
+
+// ReadDir reads the named directory and returns its entries sorted by name.
+func (f *DeviceFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	remotePath, err := deviceFSPath("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := f.readDir(remotePath)
+	if err != nil {
+		return nil, deviceFSError("readdir", name, err)
+	}
+	return entries, nil
+}
+
+// Stat returns the metadata of the named file or directory, following symlinks.
+func (f *DeviceFS) Stat(name string) (fs.FileInfo, error) {
+	remotePath, err := deviceFSPath("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	entry, err := f.stat(remotePath)
+	if err != nil {
+		return nil, deviceFSError("stat", name, err)
+	}
+	return &deviceFileInfo{name: path.Base(name), entry: entry}, nil
+}
+
+// deviceFSPath returns the path on the device of name, an fs.FS name.
+func deviceFSPath(op, name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	return path.Join("/", name), nil
+}
+
+// deviceFSError returns err as an fs.PathError, which matches the fs error it corresponds to.
+func deviceFSError(op, name string, err error) error {
+	switch {
+	case errors.HasErrCode(err, errors.FileNoExistError):
+		err = fs.ErrNotExist
+	case isPermissionDenied(err):
+		err = fs.ErrPermission
+	}
+	return &fs.PathError{Op: op, Path: name, Err: err}
+}
+
+// isPermissionDenied returns true if err is the device refusing access to a file.
+func isPermissionDenied(err error) bool {
+	return errors.HasErrCode(err, errors.PermissionDenied) || errors.HasErrCode(err, errors.AdbError) &&
+		strings.Contains(strings.ToLower(errors.ErrorWithCauseChain(err)), "permission denied")
+}
+
+// stat returns the entry of remotePath, following symlinks.
+func (f *DeviceFS) stat(remotePath string) (*DirEntry, error) {
+	entry, err := f.device.Stat(remotePath)
+	if err == nil && entry.Mode&fs.ModeSymlink != 0 {
+		entry, _, err = f.device.followRemoteLink(remotePath)
+	}
+	if err == nil {
+		entry.Name = path.Base(remotePath)
+		return entry, nil
+	}
+	// Devices without stat_v2 report files in directories the shell user can't read as not
+	// existing, so they're checked with ls too.
+	notExist := errors.HasErrCode(err, errors.FileNoExistError) && !f.device.getSyncFeatures().statV2
+	if !notExist && !isPermissionDenied(err) {
+		return nil, err
+	}
+	for _, level := range privilegeLevels[1:] {
+		output, shellErr := f.device.RunCommand(level.wrap("ls -ldL " + shellQuote(remotePath) + " 2>/dev/null"))
+		if shellErr != nil {
+			return nil, shellErr
+		}
+		if entry, ok := parse.LsLine(strings.TrimSpace(output)); ok {
+			return &DirEntry{Name: path.Base(remotePath), Mode: entry.Mode, Size: entry.Size,
+				ModifiedAt: entry.ModifiedAt, UID: -1, GID: -1}, nil
+		}
+	}
+	return nil, err
+}
+
+// readDir lists remotePath, with ls if the shell user can't list it with the sync protocol.
+func (f *DeviceFS) readDir(remotePath string) ([]fs.DirEntry, error) {
+	listing, err := f.device.ListDirEntries(remotePath)
+	var all []*DirEntry
+	if err == nil {
+		all, err = listing.ReadAll()
+	}
+	var entries []fs.DirEntry
+	for _, entry := range all {
+		if entry.Name != "." && entry.Name != ".." {
+			entries = append(entries, fs.FileInfoToDirEntry(&deviceFileInfo{name: entry.Name, entry: entry}))
+		}
+	}
+	// Directories the shell user can't read are listed as empty.
+	if err == nil && len(entries) > 0 {
+		sortDirEntries(entries)
+		return entries, nil
+	}
+
+	quoted := shellQuote(remotePath)
+	script := "[ -d " + quoted + " ] && [ -r " + quoted + " ] && ls -la " + quoted + " && echo " + deviceFSReadableMarker
+	for _, level := range privilegeLevels {
+		output, shellErr := f.device.RunCommand(level.wrap(script))
+		if shellErr != nil {
+			return nil, shellErr
+		}
+		if entries, ok := parseDeviceFSListing(output); ok {
+			sortDirEntries(entries)
+			return entries, nil
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	// The sync protocol lists files and missing paths as empty directories too.
+	entry, err := f.stat(remotePath)
+	if err != nil {
+		return nil, err
+	}
+	if !entry.Mode.IsDir() {
+		return nil, errors.Errorf(errors.AssertionError, "%s is not a directory", remotePath)
+	}
+	return nil, errors.Errorf(errors.AdbError, "can't list %s: permission denied", remotePath)
+}
+
+// parseDeviceFSListing parses the output of ls -la followed by the readable marker. Returns
+// false if the listing didn't complete.
+func parseDeviceFSListing(output string) ([]fs.DirEntry, bool) {
+	var entries []fs.DirEntry
+	listed := false
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == deviceFSReadableMarker {
+			listed = true
+			continue
+		}
+		ls, ok := parse.LsLine(line)
+		if !ok || ls.Name == "." || ls.Name == ".." {
+			continue
+		}
+		entry := &DirEntry{Name: ls.Name, Mode: ls.Mode, Size: ls.Size, ModifiedAt: ls.ModifiedAt, UID: -1, GID: -1}
+		entries = append(entries, fs.FileInfoToDirEntry(&deviceFileInfo{name: ls.Name, entry: entry}))
+	}
+	return entries, listed
+}
+
+func sortDirEntries(entries []fs.DirEntry) {
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+}
+
+// openRead opens remotePath for reading, with cat if the shell user can't read it with the
+// sync protocol.
+func (f *DeviceFS) openRead(remotePath string) (io.ReadCloser, error) {
+	r, err := f.device.OpenRead(remotePath)
+	if err == nil || !isPermissionDenied(err) {
+		return r, err
+	}
+
+	quoted := shellQuote(remotePath)
+	for _, level := range privilegeLevels[1:] {
+		output, shellErr := f.device.RunCommand(level.wrap("[ -r " + quoted + " ] && echo " + deviceFSReadableMarker))
+		if shellErr != nil {
+			return nil, shellErr
+		}
+		if strings.TrimSpace(output) != deviceFSReadableMarker {
+			continue
+		}
+		conn, shellErr := f.device.openShell(level.wrap("cat " + quoted))
+		if shellErr != nil {
+			return nil, shellErr
+		}
+		return &shellFileReader{shellStdoutReader: newShellStdoutReader(conn), conn: conn, command: "cat"}, nil
+	}
+	return nil, err
+}
+
+// shellFileReader reads a file with a shell command like cat, and fails if the command does.
+type shellFileReader struct {
+	*shellStdoutReader
+	conn io.Closer
+	// The name of the command, for errors.
+	command string
+}
+
+func (r *shellFileReader) Read(p []byte) (int, error) {
+	n, err := r.shellStdoutReader.Read(p)
+	if err == io.EOF && r.exitCode != 0 {
+		err = errors.Errorf(errors.AdbError, "%s exited with status %d: %s", r.command, r.exitCode, strings.TrimSpace(r.stderr.String()))
+	}
+	return n, err
+}
+
+func (r *shellFileReader) Close() error {
+	return r.conn.Close()
+}
+
+// deviceFileInfo is the fs.FileInfo of a DirEntry.
+type deviceFileInfo struct {
+	name  string
+	entry *DirEntry
+}
+
+func (i *deviceFileInfo) Name() string       { return i.name }
+func (i *deviceFileInfo) Size() int64        { return i.entry.Size }
+func (i *deviceFileInfo) Mode() fs.FileMode  { return i.entry.Mode }
+func (i *deviceFileInfo) ModTime() time.Time { return i.entry.ModifiedAt }
+func (i *deviceFileInfo) IsDir() bool        { return i.entry.Mode.IsDir() }
+
+// Sys returns the *DirEntry.
+func (i *deviceFileInfo) Sys() interface{} { return i.entry }
+
+// deviceFile is a file opened by DeviceFS.Open.
+type deviceFile struct {
+	name string
+	info fs.FileInfo
+	r    io.ReadCloser
+}
+
+func (f *deviceFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+
+func (f *deviceFile) Read(p []byte) (int, error) {
+	n, err := f.r.Read(p)
+	if err != nil && err != io.EOF {
+		err = &fs.PathError{Op: "read", Path: f.name, Err: err}
+	}
+	return n, err
+}
+
+func (f *deviceFile) Close() error { return f.r.Close() }
+
+// deviceDir is a directory opened by DeviceFS.Open. It's listed by the first call to ReadDir.
+type deviceDir struct {
+	fsys *DeviceFS
+	name string
+	path string
+	info fs.FileInfo
+
+	entries []fs.DirEntry
+	listed  bool
+}
+
+func (d *deviceDir) Stat() (fs.FileInfo, error) { return d.info, nil }
+
+func (d *deviceDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.name, Err: errors.Errorf(errors.AssertionError, "is a directory")}
+}
+
+func (d *deviceDir) Close() error { return nil }
+
+// ReadDir returns the next n entries of the directory, or all the remaining entries if n <= 0,
+// as fs.ReadDirFile specifies.
+func (d *deviceDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !d.listed {
+		entries, err := d.fsys.readDir(d.path)
+		if err != nil {
+			return nil, deviceFSError("readdir", d.name, err)
+		}
+		d.entries, d.listed = entries, true
+	}
+	if n <= 0 {
+		entries := d.entries
+		d.entries = nil
+		return entries, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(d.entries) {
+		n = len(d.entries)
+	}
+	entries := d.entries[:n]
+	d.entries = d.entries[n:]
+	return entries, nil
+}
@@ -0,0 +1,134 @@
+package adb
+
+import (
+	"bytes"
+	"encoding/binary"
+	stderrors "errors"
+	"io"
+	"io/fs"
+	"testing"
+
+	"github.com/mqhack/goadb/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// syncStat encodes a STAT sync response.
+func syncStat(mode, size, mtime uint32) string {
+	var buf bytes.Buffer
+	buf.WriteString("STAT")
+	for _, n := range []uint32{mode, size, mtime} {
+		binary.Write(&buf, binary.LittleEndian, n)
+	}
+	return buf.String()
+}
+
+func TestDeviceFSReadDir(t *testing.T) {
+	s := &MockServer{
+		Status: wire.StatusSuccess,
+		Messages: []string{
+			syncDirEntry(040755, 0, 1451703845, "."),
+			syncDirEntry(0100644, 12, 1451703845, "hosts"),
+			syncDirEntry(040755, 0, 1451703845, "apns"),
+			syncDirEntry(0120777, 8, 1451703845, "link"),
+			"DONE",
+		},
+	}
+	entries, err := fs.ReadDir(v1SyncDevice(s).FS(), "system/etc")
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	assert.Equal(t, "apns", entries[0].Name())
+	assert.True(t, entries[0].IsDir())
+	assert.Equal(t, "hosts", entries[1].Name())
+	info, err := entries[1].Info()
+	require.NoError(t, err)
+	assert.Equal(t, int64(12), info.Size())
+	assert.Equal(t, fs.ModeSymlink, entries[2].Type())
+	assert.Equal(t, []string{"host:transport-any", "sync:"}, s.Requests)
+}
+
+func TestDeviceFSReadDirShellFallback(t *testing.T) {
+	s := &MockServer{
+		Status: wire.StatusSuccess,
+		Messages: []string{
+			"DONE",
+			"total 8\r\n" +
+				"drwxrwx--x 2 system system 4096 2015-01-01 12:00 .\r\n" +
+				"-rw------- 1 system system 1234 2015-01-01 12:00 packages.xml\r\n" +
+				deviceFSReadableMarker + "\r\n",
+		},
+	}
+	entries, err := v1SyncDevice(s).FS().ReadDir("data/system")
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "packages.xml", entries[0].Name())
+	assert.Equal(t, "shell:[ -d '/data/system' ] && [ -r '/data/system' ] && ls -la '/data/system' && echo goadb:readable",
+		s.Requests[3])
+}
+
+func TestDeviceFSReadFile(t *testing.T) {
+	s := &MockServer{
+		Status: wire.StatusSuccess,
+		Messages: []string{
+			syncStat(0100644, 5, 1451703845),
+			"DATA\005\000\000\000hello",
+			"DONE",
+		},
+	}
+	data, err := fs.ReadFile(v1SyncDevice(s).FS(), "system/build.prop")
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(data))
+}
+
+func TestDeviceFSStatNotExist(t *testing.T) {
+	s := &MockServer{
+		Status:   wire.StatusSuccess,
+		Messages: []string{syncStat(0, 0, 0)},
+	}
+	_, err := v1SyncDevice(s).FS().Stat("missing")
+	assert.True(t, stderrors.Is(err, fs.ErrNotExist))
+	var pathErr *fs.PathError
+	require.True(t, stderrors.As(err, &pathErr))
+	assert.Equal(t, "stat", pathErr.Op)
+	assert.Equal(t, "missing", pathErr.Path)
+}
+
+func TestDeviceFSInvalidName(t *testing.T) {
+	fsys := (&Adb{server: &MockServer{}}).Device(AnyDevice()).FS()
+	for _, name := range []string{"/system", "system/../data", "system/", ""} {
+		_, err := fsys.Open(name)
+		assert.True(t, stderrors.Is(err, fs.ErrInvalid), name)
+	}
+}
+
+func TestDeviceFSRoot(t *testing.T) {
+	s := &MockServer{
+		Status:   wire.StatusSuccess,
+		Messages: []string{syncStat(040755, 0, 0)},
+	}
+	info, err := v1SyncDevice(s).FS().Stat(".")
+	require.NoError(t, err)
+	assert.Equal(t, ".", info.Name())
+	assert.True(t, info.IsDir())
+}
+
+func TestDeviceDirReadDir(t *testing.T) {
+	entries := []fs.DirEntry{
+		fs.FileInfoToDirEntry(&deviceFileInfo{name: "a", entry: &DirEntry{}}),
+		fs.FileInfoToDirEntry(&deviceFileInfo{name: "b", entry: &DirEntry{}}),
+		fs.FileInfoToDirEntry(&deviceFileInfo{name: "c", entry: &DirEntry{}}),
+	}
+	dir := &deviceDir{entries: entries, listed: true}
+
+	page, err := dir.ReadDir(2)
+	require.NoError(t, err)
+	assert.Equal(t, entries[:2], page)
+	page, err = dir.ReadDir(2)
+	require.NoError(t, err)
+	assert.Equal(t, entries[2:], page)
+	_, err = dir.ReadDir(2)
+	assert.Equal(t, io.EOF, err)
+	page, err = dir.ReadDir(-1)
+	require.NoError(t, err)
+	assert.Empty(t, page)
+}
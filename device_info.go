@@ -1,23 +1,38 @@
 package adb
 
 import (
-	"bufio"
 	"strings"
 
 	"github.com/mqhack/goadb/internal/errors"
+	"github.com/mqhack/goadb/parse"
 )
 
 type DeviceInfo struct {
 	// Always set.
 	Serial string
 
-	// Product, device, and model are not set in the short form.
+	// State is the parsed device state. If the server reported a state this package
+	// doesn't know about (e.g. "no permissions"), State is StateInvalid and the
+	// original text is still available in StateDescription.
+	State DeviceState
+	// StateDescription is the state column exactly as reported by the server.
+	StateDescription string
+
+	// Product, device, and model are not set in the short form, and are usually
+	// missing for devices that are unauthorized or offline.
 	Product    string
 	Model      string
 	DeviceInfo string
 
 	// Only set for devices connected via USB.
 	Usb string
+
+	// Only reported by newer servers.
+	TransportID string
+
+	// Extra holds any key:value attributes reported by the server that don't have
+	// a dedicated field (e.g. connection_speed). Nil if there are none.
+	Extra map[string]string
 }
 
 // IsUsb returns true if the device is connected via USB.
@@ -25,65 +40,76 @@ func (d *DeviceInfo) IsUsb() bool {
 	return d.Usb != ""
 }
 
-func newDevice(serial string, attrs map[string]string) (*DeviceInfo, error) {
+// IsTCP returns true if the device is connected over TCP, i.e. with adb connect.
+func (d *DeviceInfo) IsTCP() bool {
+	return tcpEndpoint(d.Serial) != ""
+}
+
+func newDevice(serial string, stateDescription string, attrs map[string]string, strict bool) (*DeviceInfo, error) {
 	if serial == "" {
 		return nil, errors.AssertionErrorf("device serial cannot be blank")
 	}
 
-	return &DeviceInfo{
-		Serial:     serial,
-		Product:    attrs["product"],
-		Model:      attrs["model"],
-		DeviceInfo: attrs["device"],
-		Usb:        attrs["usb"],
-	}, nil
+	// Unknown states are reported as StateInvalid rather than failing, so that one
+	// device in an unexpected state doesn't break listing all the others.
+	state, err := parseDeviceState(stateDescription)
+	if err != nil && strict {
+		return nil, err
+	}
+
+	info := &DeviceInfo{
+		Serial:           serial,
+		State:            state,
+		StateDescription: stateDescription,
+	}
+	for key, val := range attrs {
+		switch key {
+		case "product":
+			info.Product = val
+		case "model":
+			info.Model = val
+		case "device":
+			info.DeviceInfo = val
+		case "usb":
+			info.Usb = val
+		case "transport_id":
+			info.TransportID = val
+		default:
+			if strict {
+				return nil, errors.Errorf(errors.ParseError, "unexpected device attribute: %s", key)
+			}
+			if info.Extra == nil {
+				info.Extra = map[string]string{}
+			}
+			info.Extra[key] = val
+		}
+	}
+	return info, nil
 }
 
-func parseDeviceList(list string, lineParseFunc func(string) (*DeviceInfo, error)) ([]*DeviceInfo, error) {
-	// fmt.Printf("list: %s\n", list)
+// parseDeviceList parses the output of host:devices, or host:devices-l if long is true. If strict
+// is true, unknown device states, unexpected attributes, and truncated lists are errors.
+func parseDeviceList(list string, long, strict bool) ([]*DeviceInfo, error) {
+	lines, err := parse.DeviceList(list, long, strict)
+	if err != nil {
+		return nil, err
+	}
 	devices := []*DeviceInfo{}
-	scanner := bufio.NewScanner(strings.NewReader(list))
-
-	for scanner.Scan() {
-		// fmt.Printf("line: %s\n", scanner.Text())
-		device, err := lineParseFunc(scanner.Text())
+	for _, line := range lines {
+		device, err := newDevice(line.Serial, line.State, line.Attributes, strict)
 		if err != nil {
 			return nil, err
 		}
 		devices = append(devices, device)
 	}
-
 	return devices, nil
 }
 
-func parseDeviceShort(line string) (*DeviceInfo, error) {
-	fields := strings.Fields(line)
-	if len(fields) != 2 {
-		return nil, errors.Errorf(errors.ParseError,
-			"malformed device line, expected 2 fields but found %d", len(fields))
+// lastLine returns the last non-empty line of s.
+func lastLine(s string) string {
+	s = strings.TrimRight(s, "\n")
+	if i := strings.LastIndex(s, "\n"); i >= 0 {
+		return s[i+1:]
 	}
-
-	return newDevice(fields[0], map[string]string{})
-}
-
-func parseDeviceLong(line string) (*DeviceInfo, error) {
-	fields := strings.Fields(line)
-
-	attrs := parseDeviceAttributes(fields[2:])
-	return newDevice(fields[0], attrs)
-}
-
-func parseDeviceAttributes(fields []string) map[string]string {
-	attrs := map[string]string{}
-	for _, field := range fields {
-		key, val := parseKeyVal(field)
-		attrs[key] = val
-	}
-	return attrs
-}
-
-// Parses a key:val pair and returns key, val.
-func parseKeyVal(pair string) (string, string) {
-	split := strings.Split(pair, ":")
-	return split[0], split[1]
+	return s
 }
@@ -1,14 +1,16 @@
 package adb
 
 import (
+	"strings"
 	"testing"
 
+	"github.com/mqhack/goadb/wire"
 	"github.com/stretchr/testify/assert"
 )
 
 func ParseDeviceList(t *testing.T) {
 	devs, err := parseDeviceList(`192.168.56.101:5555	device
-05856558`, parseDeviceShort)
+05856558`, false, false)
 
 	assert.NoError(t, err)
 	assert.Len(t, devs, 2)
@@ -16,38 +18,153 @@ func ParseDeviceList(t *testing.T) {
 	assert.Equal(t, "05856558", devs[1].Serial)
 }
 
+// parseDeviceLine parses a device list containing only line.
+func parseDeviceLine(long bool, line string, strict bool) (*DeviceInfo, error) {
+	devs, err := parseDeviceList(strings.TrimSuffix(line, "\n")+"\n", long, strict)
+	if err != nil {
+		return nil, err
+	}
+	return devs[0], nil
+}
+
+func TestParseDeviceListSkipsBlankLines(t *testing.T) {
+	devs, err := parseDeviceList("SERIAL1\tdevice\n\nSERIAL2\tunauthorized\n", false, false)
+	assert.NoError(t, err)
+	assert.Len(t, devs, 2)
+	assert.Equal(t, StateUnauthorized, devs[1].State)
+}
+
 func TestParseDeviceShort(t *testing.T) {
-	dev, err := parseDeviceShort("192.168.56.101:5555	device\n")
+	dev, err := parseDeviceLine(false, "192.168.56.101:5555	device\n", false)
 	assert.NoError(t, err)
 	assert.Equal(t, &DeviceInfo{
-		Serial: "192.168.56.101:5555"}, dev)
+		Serial:           "192.168.56.101:5555",
+		State:            StateOnline,
+		StateDescription: "device"}, dev)
+}
+
+func TestParseDeviceShortMultiWordState(t *testing.T) {
+	dev, err := parseDeviceLine(false, "SERIAL\tno permissions (user in plugdev group); see [http://developer.android.com/tools/device.html]", false)
+	assert.NoError(t, err)
+	assert.Equal(t, "SERIAL", dev.Serial)
+	assert.Equal(t, StateInvalid, dev.State)
+	assert.Equal(t, "no permissions (user in plugdev group); see [http://developer.android.com/tools/device.html]", dev.StateDescription)
+}
+
+func TestParseDeviceShortMalformed(t *testing.T) {
+	_, err := parseDeviceLine(false, "SERIAL", false)
+	assert.EqualError(t, err, "ParseError: malformed device line, expected at least 2 fields but found 1")
 }
 
 func TestParseDeviceLong(t *testing.T) {
-	dev, err := parseDeviceLong("SERIAL    device product:PRODUCT model:MODEL device:DEVICE\n")
+	dev, err := parseDeviceLine(true, "SERIAL    device product:PRODUCT model:MODEL device:DEVICE\n", false)
 	assert.NoError(t, err)
 	assert.Equal(t, &DeviceInfo{
-		Serial:     "SERIAL",
-		Product:    "PRODUCT",
-		Model:      "MODEL",
-		DeviceInfo: "DEVICE"}, dev)
+		Serial:           "SERIAL",
+		State:            StateOnline,
+		StateDescription: "device",
+		Product:          "PRODUCT",
+		Model:            "MODEL",
+		DeviceInfo:       "DEVICE"}, dev)
 }
 
 func TestParseDeviceLongUnauthorized(t *testing.T) {
-	dev, err := parseDeviceLong("SERIAL    unauthorized usb:1234 transport_id:8")
+	dev, err := parseDeviceLine(true, "SERIAL    unauthorized usb:1234 transport_id:8", false)
 	assert.NoError(t, err)
 	assert.Equal(t, &DeviceInfo{
-		Serial: "SERIAL",
-		Usb: "1234"}, dev)
+		Serial:           "SERIAL",
+		State:            StateUnauthorized,
+		StateDescription: "unauthorized",
+		Usb:              "1234",
+		TransportID:      "8"}, dev)
 }
 
 func TestParseDeviceLongUsb(t *testing.T) {
-	dev, err := parseDeviceLong("SERIAL    device usb:1234 product:PRODUCT model:MODEL device:DEVICE \n")
+	dev, err := parseDeviceLine(true, "SERIAL    device usb:1234 product:PRODUCT model:MODEL device:DEVICE \n", false)
 	assert.NoError(t, err)
 	assert.Equal(t, &DeviceInfo{
-		Serial:     "SERIAL",
-		Product:    "PRODUCT",
-		Model:      "MODEL",
-		DeviceInfo: "DEVICE",
-		Usb:        "1234"}, dev)
+		Serial:           "SERIAL",
+		State:            StateOnline,
+		StateDescription: "device",
+		Product:          "PRODUCT",
+		Model:            "MODEL",
+		DeviceInfo:       "DEVICE",
+		Usb:              "1234"}, dev)
+}
+
+func TestParseDeviceLongUnknownAttributes(t *testing.T) {
+	dev, err := parseDeviceLine(true, "SERIAL    device usb:1-1 product:PRODUCT connection_speed:5000 transport_id:3", false)
+	assert.NoError(t, err)
+	assert.Equal(t, "1-1", dev.Usb)
+	assert.Equal(t, "3", dev.TransportID)
+	assert.Equal(t, map[string]string{"connection_speed": "5000"}, dev.Extra)
+}
+
+func TestParseDeviceLongNoPermissions(t *testing.T) {
+	dev, err := parseDeviceLine(true, "SERIAL    no permissions (missing udev rules?); see [http://developer.android.com/tools/device.html] usb:1-1 transport_id:2", false)
+	assert.NoError(t, err)
+	assert.Equal(t, &DeviceInfo{
+		Serial:           "SERIAL",
+		State:            StateInvalid,
+		StateDescription: "no permissions (missing udev rules?); see [http://developer.android.com/tools/device.html]",
+		Usb:              "1-1",
+		TransportID:      "2"}, dev)
+}
+
+func TestParseDeviceLongStateOnly(t *testing.T) {
+	dev, err := parseDeviceLine(true, "SERIAL    offline", false)
+	assert.NoError(t, err)
+	assert.Equal(t, &DeviceInfo{
+		Serial:           "SERIAL",
+		State:            StateOffline,
+		StateDescription: "offline"}, dev)
+}
+
+func TestParseDeviceLongValueWithColon(t *testing.T) {
+	dev, err := parseDeviceLine(true, "SERIAL    device product:a:b", false)
+	assert.NoError(t, err)
+	assert.Equal(t, "a:b", dev.Product)
+}
+
+func TestParseDeviceLongStrict(t *testing.T) {
+	dev, err := parseDeviceLine(true, "SERIAL    device usb:1-1 product:PRODUCT model:MODEL device:DEVICE transport_id:3", true)
+	assert.NoError(t, err)
+	assert.Equal(t, "PRODUCT", dev.Product)
+
+	_, err = parseDeviceLine(true, "SERIAL    device usb:1-1 connection_speed:5000", true)
+	assert.True(t, HasErrCode(err, ParseError))
+	assert.EqualError(t, err, "ParseError: unexpected device attribute: connection_speed")
+
+	_, err = parseDeviceLine(true, "SERIAL    device usb:1-1 product", true)
+	assert.True(t, HasErrCode(err, ParseError))
+
+	_, err = parseDeviceLine(true, "SERIAL    device usb:1-1 usb:1-2", true)
+	assert.True(t, HasErrCode(err, ParseError))
+}
+
+func TestParseDeviceShortStrictUnknownState(t *testing.T) {
+	_, err := parseDeviceLine(false, "SERIAL\tno permissions (user in plugdev group)", true)
+	assert.True(t, HasErrCode(err, ParseError))
+}
+
+func TestParseDeviceListStrictTruncated(t *testing.T) {
+	_, err := parseDeviceList("SERIAL1\tdevice\nSERIAL2\tdev", false, true)
+	assert.True(t, HasErrCode(err, ParseError))
+	assert.EqualError(t, err, "ParseError: device list truncated, last line: SERIAL2\tdev")
+
+	devs, err := parseDeviceList("", false, true)
+	assert.NoError(t, err)
+	assert.Empty(t, devs)
+}
+
+func TestListDevicesStrictParsing(t *testing.T) {
+	list := "SERIAL    device usb:1-1 connection_speed:5000\n"
+	client := &Adb{server: &MockServer{Status: wire.StatusSuccess, Messages: []string{list}}}
+	devs, err := client.ListDevices()
+	assert.NoError(t, err)
+	assert.Len(t, devs, 1)
+
+	client = &Adb{server: &MockServer{Status: wire.StatusSuccess, Messages: []string{list}}, strictParsing: true}
+	_, err = client.ListDevices()
+	assert.True(t, HasErrCode(err, ParseError))
 }
@@ -0,0 +1,71 @@
+package adb
+
+import (
+	"sync"
+	"time"
+)
+
+// deviceListCache caches the responses to host:devices and host:devices-l for a short time,
+// so callers polling the device list many times a second don't each make a round trip to the
+// server.
+type deviceListCache struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mu        sync.Mutex
+	responses map[string]cachedResponse
+	// Incremented by invalidate, so responses to requests sent before then aren't cached.
+	generation int
+}
+
+type cachedResponse struct {
+	resp      []byte
+	fetchedAt time.Time
+}
+
+func newDeviceListCache(ttl time.Duration) *deviceListCache {
+	return &deviceListCache{
+		ttl:       ttl,
+		now:       time.Now,
+		responses: make(map[string]cachedResponse),
+	}
+}
+
+// roundTrip returns the cached response to req if it's fresh, and otherwise sends req to
+// the server. A nil cache always sends req.
+func (c *deviceListCache) roundTrip(s server, req string) ([]byte, error) {
+	if c == nil {
+		return roundTripSingleResponse(s, req)
+	}
+
+	c.mu.Lock()
+	cached, ok := c.responses[req]
+	generation := c.generation
+	c.mu.Unlock()
+	if ok && c.now().Sub(cached.fetchedAt) < c.ttl {
+		return cached.resp, nil
+	}
+
+	fetchedAt := c.now()
+	resp, err := roundTripSingleResponse(s, req)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	if generation == c.generation {
+		c.responses[req] = cachedResponse{resp, fetchedAt}
+	}
+	c.mu.Unlock()
+	return resp, nil
+}
+
+// invalidate drops all cached responses. It's safe to call on a nil cache.
+func (c *deviceListCache) invalidate() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	c.responses = make(map[string]cachedResponse)
+	c.generation++
+	c.mu.Unlock()
+}
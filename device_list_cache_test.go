@@ -0,0 +1,69 @@
+package adb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mqhack/goadb/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeviceListCache(t *testing.T) {
+	s := &MockServer{
+		Status:   wire.StatusSuccess,
+		Messages: []string{"A device\n", "B device\n", "C device\n"},
+	}
+	now := time.Unix(0, 0)
+	cache := newDeviceListCache(time.Second)
+	cache.now = func() time.Time { return now }
+	client := &Adb{server: s, deviceListCache: cache}
+
+	serials, err := client.ListDeviceSerials()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"A"}, serials)
+	now = now.Add(999 * time.Millisecond)
+	serials, err = client.ListDeviceSerials()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"A"}, serials)
+	assert.Equal(t, []string{"host:devices"}, s.Requests)
+
+	now = now.Add(time.Millisecond)
+	serials, err = client.ListDeviceSerials()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"B"}, serials)
+
+	client.InvalidateDeviceListCache()
+	serials, err = client.ListDeviceSerials()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"C"}, serials)
+	assert.Equal(t, []string{"host:devices", "host:devices", "host:devices"}, s.Requests)
+}
+
+func TestDeviceListCacheDisabled(t *testing.T) {
+	s := &MockServer{
+		Status:   wire.StatusSuccess,
+		Messages: []string{"A device\n", "B device\n"},
+	}
+	client := &Adb{server: s}
+
+	client.InvalidateDeviceListCache()
+	client.ListDeviceSerials()
+	serials, err := client.ListDeviceSerials()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"B"}, serials)
+}
+
+func TestPublishDevicesInvalidatesOnChange(t *testing.T) {
+	s := &MockServer{
+		Messages: []string{"A\tdevice\n", "A\tdevice\n", "A\toffline\n"},
+	}
+	eventChan := make(chan DeviceStateChangedEvent, 10)
+	var lastKnownStates map[string]DeviceState
+	changes := 0
+
+	_, err := publishDevicesUntilError(s, eventChan, &lastKnownStates, newChangeClassifier(s), func() { changes++ }, false)
+	assert.Error(t, err)
+	assert.Equal(t, 2, changes)
+	assert.Len(t, eventChan, 2)
+}
@@ -0,0 +1,296 @@
+package adb
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mqhack/goadb/internal/errors"
+)
+
+// DefaultPoolHealthCheckInterval is how often a DevicePool checks its devices by default.
+const DefaultPoolHealthCheckInterval = 10 * time.Second
+
+// DeviceCapabilities are facts about a device that a DevicePool resolves once, when the
+// device joins the pool, so users of the pool don't have to probe for them.
+type DeviceCapabilities struct {
+	// APILevel is ro.build.version.sdk.
+	APILevel    int
+	ABI         string
+	Fingerprint string
+}
+
+// ShellV2 returns true if the device supports the shell protocol, which is required by
+// OpenShell, RunCommandResult and the helpers built on them.
+func (c DeviceCapabilities) ShellV2() bool {
+	return c.APILevel >= 24
+}
+
+// PooledDevice is a device handed out by a DevicePool.
+type PooledDevice struct {
+	*Device
+	Serial       string
+	Capabilities DeviceCapabilities
+}
+
+// PoolOptions configures a DevicePool.
+type PoolOptions struct {
+	// Size is the most devices the pool keeps. Zero means no limit.
+	Size int
+	// HealthCheckInterval is how often idle devices are checked, and new devices are looked
+	// for. Defaults to DefaultPoolHealthCheckInterval.
+	HealthCheckInterval time.Duration
+}
+
+/*
+DevicePool keeps a set of online devices ready to use, for services that run many short
+operations and can't afford to find and probe a device for each one.
+
+In the background, the pool adds devices as they come online (up to its Size), resolves their
+capabilities, and drops idle devices that stop responding. Devices are handed out exclusively
+by Acquire, and must be returned with Release.
+*/
+type DevicePool struct {
+	opts PoolOptions
+
+	listDevices func() ([]*DeviceInfo, error)
+	probe       func(serial string) (*PooledDevice, error)
+	healthy     func(device *PooledDevice) bool
+
+	mu      sync.Mutex
+	devices map[string]*poolEntry
+	// Closed and replaced whenever a device is added or released, to wake up Acquire.
+	changed chan struct{}
+	closed  bool
+
+	stop context.CancelFunc
+	done chan struct{}
+}
+
+type poolEntry struct {
+	device *PooledDevice
+	inUse  bool
+}
+
+// NewDevicePool creates a pool of the devices attached to the server, and starts checking
+// them in the background. Call Close to stop.
+func (c *Adb) NewDevicePool(opts PoolOptions) *DevicePool {
+	pool := newDevicePool(opts, c.ListDevices, func(serial string) (*PooledDevice, error) {
+		return probeDevice(c.Device(DeviceWithSerial(serial)), serial)
+	}, func(device *PooledDevice) bool {
+		state, err := device.State()
+		return err == nil && state == StateOnline
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	pool.stop = cancel
+	go pool.run(ctx)
+	return pool
+}
+
+func newDevicePool(opts PoolOptions, listDevices func() ([]*DeviceInfo, error),
+	probe func(string) (*PooledDevice, error), healthy func(*PooledDevice) bool) *DevicePool {
+	if opts.HealthCheckInterval <= 0 {
+		opts.HealthCheckInterval = DefaultPoolHealthCheckInterval
+	}
+	return &DevicePool{
+		opts:        opts,
+		listDevices: listDevices,
+		probe:       probe,
+		healthy:     healthy,
+		devices:     make(map[string]*poolEntry),
+		changed:     make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+}
+
+// probeDevice resolves the capabilities of device.
+func probeDevice(device *Device, serial string) (*PooledDevice, error) {
+	props, err := device.getProps()
+	if err != nil {
+		return nil, err
+	}
+	apiLevel, _ := strconv.Atoi(props[PropAPILevel])
+	return &PooledDevice{
+		Device: device,
+		Serial: serial,
+		Capabilities: DeviceCapabilities{
+			APILevel:    apiLevel,
+			ABI:         props["ro.product.cpu.abi"],
+			Fingerprint: props[PropFingerprint],
+		},
+	}, nil
+}
+
+func (p *DevicePool) run(ctx context.Context) {
+	defer close(p.done)
+	ticker := time.NewTicker(p.opts.HealthCheckInterval)
+	defer ticker.Stop()
+	for {
+		p.refresh()
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// refresh drops idle devices that are unhealthy, and adds any new online devices.
+func (p *DevicePool) refresh() {
+	p.mu.Lock()
+	var idle []*PooledDevice
+	for _, entry := range p.devices {
+		if !entry.inUse {
+			idle = append(idle, entry.device)
+		}
+	}
+	p.mu.Unlock()
+
+	for _, device := range idle {
+		if !p.healthy(device) {
+			p.mu.Lock()
+			// It may have been acquired since.
+			entry, ok := p.devices[device.Serial]
+			dropped := ok && !entry.inUse
+			if dropped {
+				delete(p.devices, device.Serial)
+			}
+			p.mu.Unlock()
+			if dropped {
+				device.close()
+			}
+		}
+	}
+
+	infos, err := p.listDevices()
+	if err != nil {
+		return
+	}
+	for _, info := range infos {
+		if info.State != StateOnline {
+			continue
+		}
+		p.mu.Lock()
+		_, known := p.devices[info.Serial]
+		full := p.opts.Size > 0 && len(p.devices) >= p.opts.Size
+		p.mu.Unlock()
+		if known || full {
+			continue
+		}
+
+		device, err := p.probe(info.Serial)
+		if err != nil {
+			continue
+		}
+		p.mu.Lock()
+		if !p.closed {
+			p.devices[info.Serial] = &poolEntry{device: device}
+			p.notifyLocked()
+		}
+		p.mu.Unlock()
+	}
+}
+
+/*
+Acquire returns an idle device from the pool for which filter returns true, and marks it in
+use until it's passed to Release. A nil filter accepts any device.
+
+If no device is available, Acquire waits for one to be released or join the pool. If ctx is
+done first, an error with code Timeout is returned.
+*/
+func (p *DevicePool) Acquire(ctx context.Context, filter func(device *PooledDevice) bool) (*PooledDevice, error) {
+	for {
+		p.mu.Lock()
+		if p.closed {
+			p.mu.Unlock()
+			return nil, errors.AssertionErrorf("device pool is closed")
+		}
+		for _, entry := range p.devices {
+			if !entry.inUse && (filter == nil || filter(entry.device)) {
+				entry.inUse = true
+				p.mu.Unlock()
+				return entry.device, nil
+			}
+		}
+		changed := p.changed
+		p.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return nil, errors.WrapErrorf(ctx.Err(), errors.Timeout, "no matching device available in pool")
+		}
+	}
+}
+
+// Release returns a device obtained from Acquire to the pool. The connections it still has
+// open are closed and its cleanups are run (see Device.Close), so the next user of the device
+// starts afresh. If the pool has been closed, the device is closed.
+func (p *DevicePool) Release(device *PooledDevice) {
+	p.mu.Lock()
+	closed := p.closed
+	p.mu.Unlock()
+	if closed {
+		device.close()
+		return
+	}
+	if device.Device != nil {
+		device.resources.release(false)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if entry, ok := p.devices[device.Serial]; ok && entry.device == device {
+		entry.inUse = false
+		p.notifyLocked()
+	}
+}
+
+// Len returns the number of devices in the pool, including ones in use.
+func (p *DevicePool) Len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.devices)
+}
+
+// Close stops checking devices, and makes pending and future calls to Acquire fail. Idle
+// devices are closed, and devices in use are closed when they're released.
+func (p *DevicePool) Close() {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return
+	}
+	p.closed = true
+	p.notifyLocked()
+	var idle []*PooledDevice
+	for _, entry := range p.devices {
+		if !entry.inUse {
+			idle = append(idle, entry.device)
+		}
+	}
+	p.mu.Unlock()
+
+	if p.stop != nil {
+		p.stop()
+		<-p.done
+	}
+	for _, device := range idle {
+		device.close()
+	}
+}
+
+// close closes the device, if the pool made one. Errors are ignored, since the pool is done
+// with it.
+func (d *PooledDevice) close() {
+	if d.Device != nil {
+		d.Device.Close()
+	}
+}
+
+func (p *DevicePool) notifyLocked() {
+	close(p.changed)
+	p.changed = make(chan struct{})
+}
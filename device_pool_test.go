@@ -0,0 +1,105 @@
+package adb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mqhack/goadb/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestDevicePool(opts PoolOptions, infos *[]*DeviceInfo, unhealthy map[string]bool) *DevicePool {
+	return newDevicePool(opts, func() ([]*DeviceInfo, error) {
+		return *infos, nil
+	}, func(serial string) (*PooledDevice, error) {
+		return &PooledDevice{Serial: serial, Capabilities: DeviceCapabilities{APILevel: len(serial)}}, nil
+	}, func(device *PooledDevice) bool {
+		return !unhealthy[device.Serial]
+	})
+}
+
+func TestDevicePoolAcquireRelease(t *testing.T) {
+	infos := []*DeviceInfo{
+		{Serial: "a", State: StateOnline},
+		{Serial: "bb", State: StateOnline},
+		{Serial: "ccc", State: StateUnauthorized},
+	}
+	pool := newTestDevicePool(PoolOptions{}, &infos, nil)
+	pool.refresh()
+	assert.Equal(t, 2, pool.Len())
+
+	wantsShellV2 := func(d *PooledDevice) bool { return d.Capabilities.APILevel == 2 }
+	device, err := pool.Acquire(context.Background(), wantsShellV2)
+	require.NoError(t, err)
+	assert.Equal(t, "bb", device.Serial)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = pool.Acquire(ctx, wantsShellV2)
+	assert.True(t, HasErrCode(err, Timeout))
+
+	acquired := make(chan *PooledDevice)
+	go func() {
+		device, _ := pool.Acquire(context.Background(), wantsShellV2)
+		acquired <- device
+	}()
+	pool.Release(device)
+	assert.Equal(t, device, <-acquired)
+}
+
+func TestDevicePoolRefresh(t *testing.T) {
+	infos := []*DeviceInfo{
+		{Serial: "a", State: StateOnline},
+		{Serial: "b", State: StateOnline},
+	}
+	unhealthy := make(map[string]bool)
+	pool := newTestDevicePool(PoolOptions{Size: 1}, &infos, unhealthy)
+
+	pool.refresh()
+	assert.Equal(t, 1, pool.Len())
+	device, err := pool.Acquire(context.Background(), nil)
+	require.NoError(t, err)
+
+	// Devices in use aren't checked.
+	unhealthy[device.Serial] = true
+	pool.refresh()
+	assert.Equal(t, 1, pool.Len())
+
+	pool.Release(device)
+	infos = infos[:0]
+	pool.refresh()
+	assert.Equal(t, 0, pool.Len())
+}
+
+func TestDevicePoolClose(t *testing.T) {
+	infos := []*DeviceInfo{}
+	pool := newTestDevicePool(PoolOptions{}, &infos, nil)
+
+	errs := make(chan error)
+	go func() {
+		_, err := pool.Acquire(context.Background(), nil)
+		errs <- err
+	}()
+	pool.Close()
+	assert.EqualError(t, <-errs, "AssertionError: device pool is closed")
+}
+
+func TestProbeDevice(t *testing.T) {
+	s := &MockServer{
+		Status: wire.StatusSuccess,
+		Messages: []string{"[ro.build.version.sdk]: [29]\n" +
+			"[ro.product.cpu.abi]: [arm64-v8a]\n" +
+			"[ro.build.fingerprint]: [google/coral/coral:10/QQ3A.200805.001/6578210:user/release-keys]\n"},
+	}
+	device, err := probeDevice((&Adb{server: s}).Device(DeviceWithSerial("abc")), "abc")
+	require.NoError(t, err)
+	assert.Equal(t, "abc", device.Serial)
+	assert.Equal(t, DeviceCapabilities{
+		APILevel:    29,
+		ABI:         "arm64-v8a",
+		Fingerprint: "google/coral/coral:10/QQ3A.200805.001/6578210:user/release-keys",
+	}, device.Capabilities)
+	assert.True(t, device.Capabilities.ShellV2())
+}
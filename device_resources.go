@@ -0,0 +1,209 @@
+package adb
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/mqhack/goadb/internal/errors"
+	"github.com/mqhack/goadb/internal/random"
+	"github.com/mqhack/goadb/wire"
+)
+
+// Directory that Device.TempDir creates temporary directories in.
+const deviceTempDirParent = "/data/local/tmp"
+
+// deviceResources are what a Device has open on the device and the server, which Close
+// releases.
+type deviceResources struct {
+	mu sync.Mutex
+	// closing is set when Close starts, and closed once it's released everything, since the
+	// cleanups can still use the Device.
+	closing bool
+	closed  bool
+	// Connections that haven't been closed yet, by the sender that untracks them on close.
+	conns       map[*trackedSender]*wire.Conn
+	cleanups    []func() error
+	tempDir     string
+	profilePath string
+
+	// Held while TempDir creates the directory, which can't be done holding mu, since running
+	// the command tracks its connection.
+	tempDirMu sync.Mutex
+}
+
+func newDeviceResources() *deviceResources {
+	return &deviceResources{conns: make(map[*trackedSender]*wire.Conn)}
+}
+
+// track makes conn be closed by Close, unless it's closed first.
+func (r *deviceResources) track(conn *wire.Conn) {
+	sender := &trackedSender{Sender: conn.Sender}
+	sender.untrack = func() {
+		r.mu.Lock()
+		delete(r.conns, sender)
+		r.mu.Unlock()
+	}
+	conn.Sender = sender
+
+	r.mu.Lock()
+	r.conns[sender] = conn
+	r.mu.Unlock()
+}
+
+// checkOpen returns an error if the Device has been closed.
+func (r *deviceResources) checkOpen() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return errors.AssertionErrorf("device handle is closed")
+	}
+	return nil
+}
+
+// release closes the tracked connections, then runs the cleanups, most recently added first,
+// and returns the first error. If close is true, the Device can't be used afterwards.
+func (r *deviceResources) release(close bool) error {
+	r.mu.Lock()
+	conns := make([]*wire.Conn, 0, len(r.conns))
+	for _, conn := range r.conns {
+		conns = append(conns, conn)
+	}
+	cleanups := r.cleanups
+	r.conns = make(map[*trackedSender]*wire.Conn)
+	r.cleanups = nil
+	r.tempDir = ""
+	r.profilePath = ""
+	r.mu.Unlock()
+
+	for _, conn := range conns {
+		// The connections are being abandoned, so errors closing them don't matter.
+		conn.Close()
+	}
+	var err error
+	for i := len(cleanups) - 1; i >= 0; i-- {
+		if cleanupErr := cleanups[i](); err == nil {
+			err = cleanupErr
+		}
+	}
+
+	if close {
+		r.mu.Lock()
+		r.closed = true
+		r.mu.Unlock()
+	}
+	return err
+}
+
+// trackedSender untracks its connection when it, or a sync or shell sender made from it, is
+// closed.
+type trackedSender struct {
+	wire.Sender
+	once    sync.Once
+	untrack func()
+}
+
+func (s *trackedSender) Close() error {
+	s.once.Do(s.untrack)
+	return s.Sender.Close()
+}
+
+func (s *trackedSender) NewSyncSender() wire.SyncSender {
+	return &trackedSyncSender{SyncSender: s.Sender.NewSyncSender(), parent: s}
+}
+
+func (s *trackedSender) NewShellSender() wire.ShellSender {
+	return &trackedShellSender{ShellSender: s.Sender.NewShellSender(), parent: s}
+}
+
+type trackedSyncSender struct {
+	wire.SyncSender
+	parent *trackedSender
+}
+
+func (s *trackedSyncSender) Close() error {
+	s.parent.once.Do(s.parent.untrack)
+	return s.SyncSender.Close()
+}
+
+type trackedShellSender struct {
+	wire.ShellSender
+	parent *trackedSender
+}
+
+func (s *trackedShellSender) Close() error {
+	s.parent.once.Do(s.parent.untrack)
+	return s.ShellSender.Close()
+}
+
+/*
+Close releases everything this Device has open: it closes connections that are still open,
+including shells, sync connections and streams like logcat, and runs the cleanups added with
+AddCleanup, like deleting the directory created by TempDir. Other Device values for the same
+device are unaffected.
+
+Afterwards, every operation on the Device fails. Close returns the first error returned by a
+cleanup, after running all of them. Calling it again, even concurrently, does nothing.
+*/
+func (c *Device) Close() error {
+	c.resources.mu.Lock()
+	closing := c.resources.closing
+	c.resources.closing = true
+	c.resources.mu.Unlock()
+	if closing {
+		return nil
+	}
+	return wrapClientError(c.resources.release(true), c, "Close")
+}
+
+// AddCleanup adds a function that's called when the Device is closed, e.g. to remove a port
+// forward or stop an agent started for the Device. Cleanups run in the reverse of the order
+// they were added in, after the Device's connections have been closed, and can still use the
+// Device.
+func (c *Device) AddCleanup(cleanup func() error) {
+	c.resources.mu.Lock()
+	defer c.resources.mu.Unlock()
+	c.resources.cleanups = append(c.resources.cleanups, cleanup)
+}
+
+/*
+TempDir returns a directory on the device for this Device's temporary files, creating it the
+first time it's called. It's deleted, with its contents, when the Device is closed.
+*/
+func (c *Device) TempDir() (string, error) {
+	if err := c.resources.checkOpen(); err != nil {
+		return "", wrapClientError(err, c, "TempDir")
+	}
+	c.resources.tempDirMu.Lock()
+	defer c.resources.tempDirMu.Unlock()
+	c.resources.mu.Lock()
+	dir := c.resources.tempDir
+	c.resources.mu.Unlock()
+	if dir != "" {
+		return dir, nil
+	}
+
+	dir = fmt.Sprintf("%s/goadb-%s", deviceTempDirParent, random.ID())
+	output, err := c.RunCommand("mkdir " + shellQuote(dir))
+	if err != nil {
+		return "", wrapClientError(err, c, "TempDir")
+	}
+	if output = strings.TrimSpace(output); output != "" {
+		return "", wrapClientError(errors.Errorf(errors.AdbError, "error creating %s: %s", dir, output), c, "TempDir")
+	}
+
+	c.resources.mu.Lock()
+	c.resources.tempDir = dir
+	c.resources.mu.Unlock()
+	c.AddCleanup(func() error {
+		output, err := c.RunCommand("rm -rf " + shellQuote(dir))
+		if err != nil {
+			return err
+		}
+		if output = strings.TrimSpace(output); output != "" {
+			return errors.Errorf(errors.AdbError, "error removing %s: %s", dir, output)
+		}
+		return nil
+	})
+	return dir, nil
+}
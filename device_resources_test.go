@@ -0,0 +1,118 @@
+package adb
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/mqhack/goadb/internal/errors"
+	"github.com/mqhack/goadb/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeviceCloseClosesConnections(t *testing.T) {
+	s := &MockServer{Status: wire.StatusSuccess}
+	device := (&Adb{server: s}).Device(AnyDevice())
+
+	shell, err := device.OpenShell("cat")
+	require.NoError(t, err)
+	require.NoError(t, shell.Close())
+	assert.Empty(t, device.resources.conns)
+
+	_, err = device.OpenExec("cat")
+	require.NoError(t, err)
+	assert.Len(t, device.resources.conns, 1)
+
+	s.Trace = nil
+	require.NoError(t, device.Close())
+	assert.Equal(t, []string{"Close", "Close"}, s.Trace)
+	assert.Empty(t, device.resources.conns)
+
+	_, err = device.RunCommand("ls")
+	assert.True(t, HasErrCode(err, AssertionError))
+	assert.Contains(t, ErrorWithCauseChain(err), "device handle is closed")
+	assert.NoError(t, device.Close())
+}
+
+func TestDeviceCloseRunsCleanups(t *testing.T) {
+	device := (&Adb{server: &MockServer{Status: wire.StatusSuccess}}).Device(AnyDevice())
+
+	var order []int
+	device.AddCleanup(func() error {
+		order = append(order, 1)
+		return nil
+	})
+	device.AddCleanup(func() error {
+		order = append(order, 2)
+		return errors.Errorf(errors.AdbError, "cleanup failed")
+	})
+	device.AddCleanup(func() error {
+		order = append(order, 3)
+		return errors.Errorf(errors.AdbError, "another cleanup failed")
+	})
+
+	err := device.Close()
+	assert.True(t, HasErrCode(err, AdbError))
+	assert.Contains(t, ErrorWithCauseChain(err), "another cleanup failed")
+	assert.Equal(t, []int{3, 2, 1}, order)
+}
+
+func TestDeviceTempDir(t *testing.T) {
+	s := &MockServer{Status: wire.StatusSuccess}
+	device := (&Adb{server: s}).Device(AnyDevice())
+
+	dir, err := device.TempDir()
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(dir, "/data/local/tmp/goadb-"), dir)
+	again, err := device.TempDir()
+	require.NoError(t, err)
+	assert.Equal(t, dir, again)
+	assert.Equal(t, []string{"host:transport-any", "shell:mkdir '" + dir + "'"}, s.Requests)
+
+	require.NoError(t, device.Close())
+	assert.Equal(t, "shell:rm -rf '"+dir+"'", s.Requests[len(s.Requests)-1])
+}
+
+func TestDeviceConcurrentClose(t *testing.T) {
+	device := (&Adb{server: &MockServer{Status: wire.StatusSuccess}}).Device(AnyDevice())
+	var calls int32
+	device.AddCleanup(func() error {
+		atomic.AddInt32(&calls, 1)
+		return nil
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, device.Close())
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestDeviceConcurrentTempDir(t *testing.T) {
+	s := &MockServer{Status: wire.StatusSuccess}
+	device := (&Adb{server: s}).Device(AnyDevice())
+
+	dirs := make([]string, 10)
+	var wg sync.WaitGroup
+	for i := range dirs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			dir, err := device.TempDir()
+			assert.NoError(t, err)
+			dirs[i] = dir
+		}(i)
+	}
+	wg.Wait()
+	for _, dir := range dirs {
+		assert.Equal(t, dirs[0], dir)
+	}
+	assert.Equal(t, []string{"host:transport-any", "shell:mkdir '" + dirs[0] + "'"}, s.Requests)
+}
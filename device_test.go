@@ -1,11 +1,13 @@
 package adb
 
 import (
+	"io"
 	"testing"
 
 	"github.com/mqhack/goadb/internal/errors"
 	"github.com/mqhack/goadb/wire"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestGetAttribute(t *testing.T) {
@@ -13,7 +15,7 @@ func TestGetAttribute(t *testing.T) {
 		Status:   wire.StatusSuccess,
 		Messages: []string{"value"},
 	}
-	client := (&Adb{s}).Device(DeviceWithSerial("serial"))
+	client := (&Adb{server: s}).Device(DeviceWithSerial("serial"))
 
 	v, err := client.getAttribute("attr")
 	assert.Equal(t, "host-serial:serial:attr", s.Requests[0])
@@ -54,7 +56,7 @@ func TestGetDeviceInfo(t *testing.T) {
 }
 
 func newDeviceClientWithDeviceLister(serial string, deviceLister func() ([]*DeviceInfo, error)) *Device {
-	client := (&Adb{&MockServer{
+	client := (&Adb{server: &MockServer{
 		Status:   wire.StatusSuccess,
 		Messages: []string{serial},
 	}}).Device(DeviceWithSerial(serial))
@@ -67,7 +69,7 @@ func TestRunCommandNoArgs(t *testing.T) {
 		Status:   wire.StatusSuccess,
 		Messages: []string{"output"},
 	}
-	client := (&Adb{s}).Device(AnyDevice())
+	client := (&Adb{server: s}).Device(AnyDevice())
 
 	v, err := client.RunCommand("cmd")
 	assert.Equal(t, "host:transport-any", s.Requests[0])
@@ -76,6 +78,34 @@ func TestRunCommandNoArgs(t *testing.T) {
 	assert.Equal(t, "output", v)
 }
 
+func TestDialSocket(t *testing.T) {
+	s := &MockServer{
+		Status:   wire.StatusSuccess,
+		Messages: []string{"hello"},
+	}
+	client := (&Adb{server: s}).Device(AnyDevice())
+
+	conn, err := client.DialSocket("localabstract:scrcpy")
+	require.NoError(t, err)
+	defer conn.Close()
+	buf := make([]byte, 5)
+	_, err = io.ReadFull(conn, buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", string(buf))
+	assert.Equal(t, []string{"host:transport-any", "localabstract:scrcpy"}, s.Requests)
+}
+
+func TestReconnectFromHost(t *testing.T) {
+	s := &MockServer{
+		Status:   wire.StatusSuccess,
+		Messages: []string{"done"},
+	}
+	client := (&Adb{server: s}).Device(DeviceWithSerial("serial"))
+
+	assert.NoError(t, client.ReconnectFromHost())
+	assert.Equal(t, []string{"host-serial:serial:reconnect"}, s.Requests)
+}
+
 func TestPrepareCommandLineNoArgs(t *testing.T) {
 	result, err := prepareCommandLine("cmd")
 	assert.NoError(t, err)
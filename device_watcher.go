@@ -27,6 +27,10 @@ type DeviceStateChangedEvent struct {
 	Serial   string
 	OldState DeviceState
 	NewState DeviceState
+
+	// Reason is a best guess at why the state changed, mostly useful when the device
+	// went offline.
+	Reason ChangeReason
 }
 
 // CameOnline returns true if this event represents a device coming online.
@@ -46,12 +50,20 @@ type deviceWatcherImpl struct {
 	err atomic.Value
 
 	eventChan chan DeviceStateChangedEvent
+
+	// Called before publishing the events for each change in the device list.
+	onChange func()
+
+	// From ServerConfig.StrictParsing.
+	strict bool
 }
 
-func newDeviceWatcher(server server) *DeviceWatcher {
+func newDeviceWatcher(server server, onChange func(), strict bool) *DeviceWatcher {
 	watcher := &DeviceWatcher{&deviceWatcherImpl{
 		server:    server,
 		eventChan: make(chan DeviceStateChangedEvent),
+		onChange:  onChange,
+		strict:    strict,
 	}}
 
 	runtime.SetFinalizer(watcher, func(watcher *DeviceWatcher) {
@@ -108,6 +120,7 @@ func publishDevices(watcher *deviceWatcherImpl) {
 	defer close(watcher.eventChan)
 
 	var lastKnownStates map[string]DeviceState
+	classifier := newChangeClassifier(watcher.server)
 	finished := false
 
 	for {
@@ -117,7 +130,7 @@ func publishDevices(watcher *deviceWatcherImpl) {
 			return
 		}
 
-		finished, err = publishDevicesUntilError(scanner, watcher.eventChan, &lastKnownStates)
+		finished, err = publishDevicesUntilError(scanner, watcher.eventChan, &lastKnownStates, classifier, watcher.onChange, watcher.strict)
 
 		if finished {
 			scanner.Close()
@@ -166,27 +179,38 @@ func connectToTrackDevices(server server) (wire.Scanner, error) {
 	return conn, nil
 }
 
-func publishDevicesUntilError(scanner wire.Scanner, eventChan chan<- DeviceStateChangedEvent, lastKnownStates *map[string]DeviceState) (finished bool, err error) {
+func publishDevicesUntilError(scanner wire.Scanner, eventChan chan<- DeviceStateChangedEvent, lastKnownStates *map[string]DeviceState, classifier *changeClassifier, onChange func(), strict bool) (finished bool, err error) {
 	for {
 		msg, err := scanner.ReadMessage()
 		if err != nil {
 			return false, err
 		}
 
-		deviceStates, err := parseDeviceStates(string(msg))
+		deviceStates, err := parseDeviceStates(string(msg), strict)
 		if err != nil {
 			return false, err
 		}
 
-		for _, event := range calculateStateDiffs(*lastKnownStates, deviceStates) {
+		events := calculateStateDiffs(*lastKnownStates, deviceStates)
+		if len(events) > 0 && onChange != nil {
+			onChange()
+		}
+		for _, event := range events {
+			classifier.classify(&event)
 			eventChan <- event
 		}
 		*lastKnownStates = deviceStates
 	}
 }
 
-func parseDeviceStates(msg string) (states map[string]DeviceState, err error) {
+// parseDeviceStates parses a message from host:track-devices. Unknown states are reported as
+// StateInvalid, unless strict is true, in which case they're an error, as are truncated messages.
+func parseDeviceStates(msg string, strict bool) (states map[string]DeviceState, err error) {
 	states = make(map[string]DeviceState)
+	if strict && msg != "" && !strings.HasSuffix(msg, "\n") {
+		err = errors.Errorf(errors.ParseError, "device states truncated, last line: %s", lastLine(msg))
+		return
+	}
 
 	for lineNum, line := range strings.Split(msg, "\n") {
 		if len(line) == 0 {
@@ -200,8 +224,11 @@ func parseDeviceStates(msg string) (states map[string]DeviceState, err error) {
 		}
 
 		serial, stateString := fields[0], fields[1]
-		var state DeviceState
-		state, err = parseDeviceState(stateString)
+		state, stateErr := parseDeviceState(stateString)
+		if stateErr != nil && strict {
+			err = stateErr
+			return
+		}
 		states[serial] = state
 	}
 
@@ -215,10 +242,10 @@ func calculateStateDiffs(oldStates, newStates map[string]DeviceState) (events []
 		if oldState != newState {
 			if ok {
 				// Device present in both lists: state changed.
-				events = append(events, DeviceStateChangedEvent{serial, oldState, newState})
+				events = append(events, DeviceStateChangedEvent{Serial: serial, OldState: oldState, NewState: newState})
 			} else {
 				// Device only present in old list: device removed.
-				events = append(events, DeviceStateChangedEvent{serial, oldState, StateDisconnected})
+				events = append(events, DeviceStateChangedEvent{Serial: serial, OldState: oldState, NewState: StateDisconnected})
 			}
 		}
 	}
@@ -226,7 +253,7 @@ func calculateStateDiffs(oldStates, newStates map[string]DeviceState) (events []
 	for serial, newState := range newStates {
 		if _, ok := oldStates[serial]; !ok {
 			// Device only present in new list: device added.
-			events = append(events, DeviceStateChangedEvent{serial, StateDisconnected, newState})
+			events = append(events, DeviceStateChangedEvent{Serial: serial, OldState: StateDisconnected, NewState: newState})
 		}
 	}
 
@@ -10,7 +10,7 @@ import (
 
 func TestParseDeviceStatesSingle(t *testing.T) {
 	states, err := parseDeviceStates(`192.168.56.101:5555	offline
-`)
+`, false)
 
 	assert.NoError(t, err)
 	assert.Len(t, states, 1)
@@ -20,7 +20,7 @@ func TestParseDeviceStatesSingle(t *testing.T) {
 func TestParseDeviceStatesMultiple(t *testing.T) {
 	states, err := parseDeviceStates(`192.168.56.101:5555	offline
 0x0x0x0x	device
-`)
+`, false)
 
 	assert.NoError(t, err)
 	assert.Len(t, states, 2)
@@ -31,7 +31,7 @@ func TestParseDeviceStatesMultiple(t *testing.T) {
 func TestParseDeviceStatesMalformed(t *testing.T) {
 	_, err := parseDeviceStates(`192.168.56.101:5555	offline
 0x0x0x0x
-`)
+`, false)
 
 	assert.True(t, HasErrCode(err, ParseError))
 	assert.Equal(t, "invalid device state line 1: 0x0x0x0x", err.(*errors.Err).Message)
@@ -70,7 +70,7 @@ func TestCalculateStateDiffsOneAdded(t *testing.T) {
 	diffs := calculateStateDiffs(oldStates, newStates)
 
 	assertContainsOnly(t, []DeviceStateChangedEvent{
-		DeviceStateChangedEvent{"serial", StateDisconnected, StateOffline},
+		DeviceStateChangedEvent{Serial: "serial", OldState: StateDisconnected, NewState: StateOffline},
 	}, diffs)
 }
 
@@ -83,7 +83,7 @@ func TestCalculateStateDiffsOneRemoved(t *testing.T) {
 	diffs := calculateStateDiffs(oldStates, newStates)
 
 	assertContainsOnly(t, []DeviceStateChangedEvent{
-		DeviceStateChangedEvent{"serial", StateOffline, StateDisconnected},
+		DeviceStateChangedEvent{Serial: "serial", OldState: StateOffline, NewState: StateDisconnected},
 	}, diffs)
 }
 
@@ -99,7 +99,7 @@ func TestCalculateStateDiffsOneAddedOneUnchanged(t *testing.T) {
 	diffs := calculateStateDiffs(oldStates, newStates)
 
 	assertContainsOnly(t, []DeviceStateChangedEvent{
-		DeviceStateChangedEvent{"2", StateDisconnected, StateOffline},
+		DeviceStateChangedEvent{Serial: "2", OldState: StateDisconnected, NewState: StateOffline},
 	}, diffs)
 }
 
@@ -115,7 +115,7 @@ func TestCalculateStateDiffsOneRemovedOneUnchanged(t *testing.T) {
 	diffs := calculateStateDiffs(oldStates, newStates)
 
 	assertContainsOnly(t, []DeviceStateChangedEvent{
-		DeviceStateChangedEvent{"1", StateOffline, StateDisconnected},
+		DeviceStateChangedEvent{Serial: "1", OldState: StateOffline, NewState: StateDisconnected},
 	}, diffs)
 }
 
@@ -130,8 +130,8 @@ func TestCalculateStateDiffsOneAddedOneRemoved(t *testing.T) {
 	diffs := calculateStateDiffs(oldStates, newStates)
 
 	assertContainsOnly(t, []DeviceStateChangedEvent{
-		DeviceStateChangedEvent{"1", StateOffline, StateDisconnected},
-		DeviceStateChangedEvent{"2", StateDisconnected, StateOffline},
+		DeviceStateChangedEvent{Serial: "1", OldState: StateOffline, NewState: StateDisconnected},
+		DeviceStateChangedEvent{Serial: "2", OldState: StateDisconnected, NewState: StateOffline},
 	}, diffs)
 }
 
@@ -148,7 +148,7 @@ func TestCalculateStateDiffsOneChangedOneUnchanged(t *testing.T) {
 	diffs := calculateStateDiffs(oldStates, newStates)
 
 	assertContainsOnly(t, []DeviceStateChangedEvent{
-		DeviceStateChangedEvent{"1", StateOffline, StateOnline},
+		DeviceStateChangedEvent{Serial: "1", OldState: StateOffline, NewState: StateOnline},
 	}, diffs)
 }
 
@@ -165,8 +165,8 @@ func TestCalculateStateDiffsMultipleChanged(t *testing.T) {
 	diffs := calculateStateDiffs(oldStates, newStates)
 
 	assertContainsOnly(t, []DeviceStateChangedEvent{
-		DeviceStateChangedEvent{"1", StateOffline, StateOnline},
-		DeviceStateChangedEvent{"2", StateOnline, StateOffline},
+		DeviceStateChangedEvent{Serial: "1", OldState: StateOffline, NewState: StateOnline},
+		DeviceStateChangedEvent{Serial: "2", OldState: StateOnline, NewState: StateOffline},
 	}, diffs)
 }
 
@@ -183,26 +183,26 @@ func TestCalculateStateDiffsOneAddedOneRemovedOneChanged(t *testing.T) {
 	diffs := calculateStateDiffs(oldStates, newStates)
 
 	assertContainsOnly(t, []DeviceStateChangedEvent{
-		DeviceStateChangedEvent{"1", StateOffline, StateOnline},
-		DeviceStateChangedEvent{"2", StateOffline, StateDisconnected},
-		DeviceStateChangedEvent{"3", StateDisconnected, StateOffline},
+		DeviceStateChangedEvent{Serial: "1", OldState: StateOffline, NewState: StateOnline},
+		DeviceStateChangedEvent{Serial: "2", OldState: StateOffline, NewState: StateDisconnected},
+		DeviceStateChangedEvent{Serial: "3", OldState: StateDisconnected, NewState: StateOffline},
 	}, diffs)
 }
 
 func TestCameOnline(t *testing.T) {
-	assert.True(t, DeviceStateChangedEvent{"", StateDisconnected, StateOnline}.CameOnline())
-	assert.True(t, DeviceStateChangedEvent{"", StateOffline, StateOnline}.CameOnline())
-	assert.False(t, DeviceStateChangedEvent{"", StateOnline, StateOffline}.CameOnline())
-	assert.False(t, DeviceStateChangedEvent{"", StateOnline, StateDisconnected}.CameOnline())
-	assert.False(t, DeviceStateChangedEvent{"", StateOffline, StateDisconnected}.CameOnline())
+	assert.True(t, DeviceStateChangedEvent{Serial: "", OldState: StateDisconnected, NewState: StateOnline}.CameOnline())
+	assert.True(t, DeviceStateChangedEvent{Serial: "", OldState: StateOffline, NewState: StateOnline}.CameOnline())
+	assert.False(t, DeviceStateChangedEvent{Serial: "", OldState: StateOnline, NewState: StateOffline}.CameOnline())
+	assert.False(t, DeviceStateChangedEvent{Serial: "", OldState: StateOnline, NewState: StateDisconnected}.CameOnline())
+	assert.False(t, DeviceStateChangedEvent{Serial: "", OldState: StateOffline, NewState: StateDisconnected}.CameOnline())
 }
 
 func TestWentOffline(t *testing.T) {
-	assert.True(t, DeviceStateChangedEvent{"", StateOnline, StateDisconnected}.WentOffline())
-	assert.True(t, DeviceStateChangedEvent{"", StateOnline, StateOffline}.WentOffline())
-	assert.False(t, DeviceStateChangedEvent{"", StateOffline, StateOnline}.WentOffline())
-	assert.False(t, DeviceStateChangedEvent{"", StateDisconnected, StateOnline}.WentOffline())
-	assert.False(t, DeviceStateChangedEvent{"", StateOffline, StateDisconnected}.WentOffline())
+	assert.True(t, DeviceStateChangedEvent{Serial: "", OldState: StateOnline, NewState: StateDisconnected}.WentOffline())
+	assert.True(t, DeviceStateChangedEvent{Serial: "", OldState: StateOnline, NewState: StateOffline}.WentOffline())
+	assert.False(t, DeviceStateChangedEvent{Serial: "", OldState: StateOffline, NewState: StateOnline}.WentOffline())
+	assert.False(t, DeviceStateChangedEvent{Serial: "", OldState: StateDisconnected, NewState: StateOnline}.WentOffline())
+	assert.False(t, DeviceStateChangedEvent{Serial: "", OldState: StateOffline, NewState: StateDisconnected}.WentOffline())
 }
 
 func TestPublishDevicesRestartsServer(t *testing.T) {
@@ -243,3 +243,17 @@ func assertContains(t *testing.T, expectedEntry DeviceStateChangedEvent, actual
 	}
 	assert.Fail(t, "expected to find %+v in %+v", expectedEntry, actual)
 }
+
+func TestParseDeviceStatesUnknownState(t *testing.T) {
+	states, err := parseDeviceStates("SERIAL1\tno permissions\nSERIAL2\tdevice\n", false)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]DeviceState{"SERIAL1": StateInvalid, "SERIAL2": StateOnline}, states)
+
+	_, err = parseDeviceStates("SERIAL1\tno permissions\nSERIAL2\tdevice\n", true)
+	assert.True(t, HasErrCode(err, ParseError))
+}
+
+func TestParseDeviceStatesStrictTruncated(t *testing.T) {
+	_, err := parseDeviceStates("SERIAL1\tdevice\nSERIAL2\tdev", true)
+	assert.True(t, HasErrCode(err, ParseError))
+}
@@ -4,9 +4,9 @@ package adb
 
 import "fmt"
 
-const _DeviceState_name = "StateInvalidStateAuthorizingStateUnauthorizedStateDisconnectedStateOfflineStateOnline"
+const _DeviceState_name = "StateInvalidStateAuthorizingStateUnauthorizedStateDisconnectedStateSideloadStateRecoveryStateOfflineStateOnline"
 
-var _DeviceState_index = [...]uint8{0, 12, 28, 45, 62, 74, 85}
+var _DeviceState_index = [...]uint8{0, 12, 28, 45, 62, 75, 88, 100, 111}
 
 func (i DeviceState) String() string {
 	if i < 0 || i >= DeviceState(len(_DeviceState_index)-1) {
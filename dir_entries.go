@@ -1,24 +1,50 @@
 package adb
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"time"
 
+	"github.com/mqhack/goadb/internal/errors"
 	"github.com/mqhack/goadb/wire"
 )
 
 // DirEntry holds information about a directory entry on a device.
 type DirEntry struct {
-	Name       string
-	Mode       os.FileMode
-	Size       int32
+	Name string
+	// Mode includes the setuid, setgid and sticky bits, and character devices are both
+	// os.ModeDevice and os.ModeCharDevice, like the os package's modes.
+	Mode os.FileMode
+	// Size is only reported modulo 4GB by devices without the stat_v2 and ls_v2 features.
+	Size       int64
 	ModifiedAt time.Time
+
+	// UID and GID are the file's owner and group. They're only reported by devices with the
+	// stat_v2 and ls_v2 features, and are -1 for other devices.
+	UID, GID int
+	// Links is the file's number of hard links, and AccessedAt and ChangedAt are the times
+	// its contents were last read and its metadata was last changed. Like UID and GID,
+	// they're only reported by devices with stat_v2 and ls_v2, and are zero for others.
+	Links                 int
+	AccessedAt, ChangedAt time.Time
 }
 
-// DirEntries iterates over directory entries.
+/*
+DirEntries iterates over directory entries. Entries are read from the device as Next is
+called, so listing a directory with many thousands of files only holds one entry in memory at
+a time, unless they're collected with ReadAll.
+*/
 type DirEntries struct {
 	scanner wire.SyncScanner
+	// Whether the entries are SyncIDDirEntryV2 packets.
+	v2 bool
+
+	// The context the listing stops when is done, if it was started with
+	// ListDirEntriesContext.
+	ctx context.Context
+	// Stops closing the scanner when ctx is done.
+	stop func()
 
 	currentEntry *DirEntry
 	err          error
@@ -38,13 +64,46 @@ func (entries *DirEntries) ReadAll() (result []*DirEntry, err error) {
 	return
 }
 
+/*
+ForEach calls fn with each of the remaining directory entries as they're read, then closes
+entries. It returns the first error returned by fn, which stops the iteration, or the error
+that stopped entries being read.
+*/
+func (entries *DirEntries) ForEach(fn func(entry *DirEntry) error) error {
+	defer entries.Close()
+
+	for entries.Next() {
+		if err := fn(entries.Entry()); err != nil {
+			return err
+		}
+	}
+	return entries.Err()
+}
+
+// Next reads the next entry, and returns false once there are no more entries, or an error
+// occurred, which is returned by Err.
 func (entries *DirEntries) Next() bool {
 	if entries.err != nil {
 		return false
 	}
+	if entries.ctx != nil && entries.ctx.Err() != nil {
+		entries.err = entries.cancelledError()
+		entries.Close()
+		return false
+	}
 
-	entry, done, err := readNextDirListEntry(entries.scanner)
+	var entry *DirEntry
+	var done bool
+	var err error
+	if entries.v2 {
+		entry, done, err = readNextDirListEntryV2(entries.scanner)
+	} else {
+		entry, done, err = readNextDirListEntry(entries.scanner)
+	}
 	if err != nil {
+		if entries.ctx != nil && entries.ctx.Err() != nil {
+			err = entries.cancelledError()
+		}
 		entries.err = err
 		entries.Close()
 		return false
@@ -70,19 +129,28 @@ func (entries *DirEntries) Err() error {
 // Close closes the connection to the adb.
 // Next() will call Close() before returning false.
 func (entries *DirEntries) Close() error {
+	// Next closes the entries when they run out, so ReadAll closes them twice.
+	if entries.stop != nil {
+		entries.stop()
+		entries.stop = nil
+	}
 	return entries.scanner.Close()
 }
 
+func (entries *DirEntries) cancelledError() error {
+	return errors.WrapErrorf(entries.ctx.Err(), errors.Timeout, "directory listing cancelled")
+}
+
 func readNextDirListEntry(s wire.SyncScanner) (entry *DirEntry, done bool, err error) {
 	status, err := s.ReadStatus("dir-entry")
 	if err != nil {
 		return
 	}
 
-	if status == "DONE" {
+	if status == wire.SyncIDDone {
 		done = true
 		return
-	} else if status != "DENT" {
+	} else if status != wire.SyncIDDirEntry {
 		err = fmt.Errorf("error reading dir entries: expected dir entry ID 'DENT', but got '%s'", status)
 		return
 	}
@@ -110,10 +178,40 @@ func readNextDirListEntry(s wire.SyncScanner) (entry *DirEntry, done bool, err e
 
 	done = false
 	entry = &DirEntry{
-		Name:       name,
-		Mode:       mode,
-		Size:       size,
+		Name: name,
+		Mode: mode,
+		// Sizes are unsigned in v1.
+		Size:       int64(uint32(size)),
 		ModifiedAt: mtime,
+		UID:        -1,
+		GID:        -1,
+	}
+	return
+}
+
+func readNextDirListEntryV2(s wire.SyncScanner) (entry *DirEntry, done bool, err error) {
+	status, err := s.ReadStatus("dir-entry")
+	if err != nil {
+		return
+	}
+	if status == wire.SyncIDDone {
+		done = true
+		return
+	} else if status != wire.SyncIDDirEntryV2 {
+		err = errors.Errorf(errors.AssertionError, "error reading dir entries: expected dir entry ID 'DNT2', but got '%s'", status)
+		return
+	}
+
+	// An entry that couldn't be stat'd, e.g. because it was deleted while it was being
+	// listed, is still listed, with its errno and zeroes for its stat.
+	entry, _, err = readStatV2(s)
+	if err != nil {
+		err = errors.WrapErrf(err, "error reading dir entries: %v", err)
+		return
+	}
+	entry.Name, err = s.ReadString()
+	if err != nil {
+		err = errors.WrapErrf(err, "error reading dir entries: error reading file name: %v", err)
 	}
 	return
 }
@@ -0,0 +1,99 @@
+package adb
+
+import (
+	"context"
+	stderrors "errors"
+	"testing"
+
+	"github.com/mqhack/goadb/internal/errors"
+	"github.com/mqhack/goadb/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDirEntriesForEach(t *testing.T) {
+	s := &MockServer{
+		Status: wire.StatusSuccess,
+		Messages: []string{
+			syncDirEntry(0100644, 1, 1451703845, "a.jpg"),
+			syncDirEntry(0100644, 2, 1451703845, "b.jpg"),
+			"DONE",
+		},
+	}
+	entries, err := v1SyncDevice(s).ListDirEntries("/sdcard/DCIM")
+	require.NoError(t, err)
+
+	var names []string
+	require.NoError(t, entries.ForEach(func(entry *DirEntry) error {
+		names = append(names, entry.Name)
+		return nil
+	}))
+	assert.Equal(t, []string{"a.jpg", "b.jpg"}, names)
+}
+
+func TestDirEntriesForEachStops(t *testing.T) {
+	s := &MockServer{
+		Status: wire.StatusSuccess,
+		Messages: []string{
+			syncDirEntry(0100644, 1, 1451703845, "a.jpg"),
+			syncDirEntry(0100644, 2, 1451703845, "b.jpg"),
+			"DONE",
+		},
+	}
+	entries, err := v1SyncDevice(s).ListDirEntries("/sdcard/DCIM")
+	require.NoError(t, err)
+
+	stop := stderrors.New("found it")
+	calls := 0
+	err = entries.ForEach(func(entry *DirEntry) error {
+		calls++
+		return stop
+	})
+	assert.Equal(t, stop, err)
+	assert.Equal(t, 1, calls)
+}
+
+func TestDirEntriesContextClosedTwice(t *testing.T) {
+	listing := []string{
+		syncDirEntry(0100644, 1, 1451703845, "a.jpg"),
+		"DONE",
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	entries, err := v1SyncDevice(&MockServer{Status: wire.StatusSuccess, Messages: listing}).
+		ListDirEntriesContext(ctx, "/sdcard/DCIM")
+	require.NoError(t, err)
+	all, err := entries.ReadAll()
+	require.NoError(t, err)
+	assert.Len(t, all, 1)
+
+	entries, err = v1SyncDevice(&MockServer{Status: wire.StatusSuccess, Messages: listing}).
+		ListDirEntriesContext(ctx, "/sdcard/DCIM")
+	require.NoError(t, err)
+	assert.NoError(t, entries.ForEach(func(*DirEntry) error { return nil }))
+}
+
+func TestListDirEntriesContextCancelled(t *testing.T) {
+	s := &MockServer{
+		Status: wire.StatusSuccess,
+		Messages: []string{
+			syncDirEntry(0100644, 1, 1451703845, "a.jpg"),
+			syncDirEntry(0100644, 2, 1451703845, "b.jpg"),
+			"DONE",
+		},
+	}
+	device := v1SyncDevice(s)
+	ctx, cancel := context.WithCancel(context.Background())
+	entries, err := device.ListDirEntriesContext(ctx, "/sdcard/DCIM")
+	require.NoError(t, err)
+
+	require.True(t, entries.Next())
+	assert.Equal(t, "a.jpg", entries.Entry().Name)
+	cancel()
+	assert.False(t, entries.Next())
+	assert.Equal(t, errors.Timeout, code(entries.Err()))
+
+	_, err = device.ListDirEntriesContext(ctx, "/sdcard/DCIM")
+	assert.Equal(t, errors.Timeout, code(err))
+}
@@ -0,0 +1,220 @@
+package adb
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/mqhack/goadb/internal/errors"
+)
+
+// SymlinkPolicy is how Device.PushDir and Device.PullDir transfer symlinks.
+type SymlinkPolicy int
+
+const (
+	// SymlinksSkip leaves symlinks out of the transfer.
+	SymlinksSkip SymlinkPolicy = iota
+	// SymlinksFollow transfers the files and directories symlinks point to, as if they were
+	// in the tree themselves. Symlinks that are dangling, or lead to a directory containing
+	// them, are reported as failures.
+	SymlinksFollow
+	// SymlinksRecreate creates symlinks with the same targets at the destination. Targets
+	// aren't translated, so absolute targets still refer to the source's file system.
+	SymlinksRecreate
+)
+
+// dirTransferLink is a symlink to be recreated by PushDir or PullDir.
+type dirTransferLink struct {
+	// Relative to the directory, with slashes.
+	path string
+	// Only known before the link is recreated when it's pushed.
+	target string
+}
+
+// isSymlinkLoop returns true if target, the canonical path of a directory a symlink points
+// to, is one of the directories in chain, or contains one of them. sep is the separator of
+// the paths.
+func isSymlinkLoop(target string, chain []string, sep string) bool {
+	prefix := strings.TrimSuffix(target, sep) + sep
+	for _, dir := range chain {
+		if dir == target || strings.HasPrefix(dir, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// transferLinks recreates links with create, once all the files have been transferred, and
+// records the results in runner. create is called with all the links at once, so they can be
+// recreated with as few commands as possible, and returns the error for each.
+func transferLinks(ctx context.Context, runner *bulkRunner, links []dirTransferLink,
+	create func(links []dirTransferLink) []error) error {
+	if len(links) == 0 {
+		return nil
+	}
+	if runner.stopped() {
+		skipLinks(runner, links)
+		return nil
+	}
+	if ctx.Err() != nil {
+		skipLinks(runner, links)
+		return errors.WrapErrorf(ctx.Err(), errors.Timeout, "transfer cancelled before %d symlinks", len(links))
+	}
+
+	for i, err := range create(links) {
+		if err != nil {
+			runner.fail(links[i].path, err)
+		} else {
+			runner.result.Succeeded = append(runner.result.Succeeded, links[i].path)
+		}
+	}
+	return nil
+}
+
+func skipLinks(runner *bulkRunner, links []dirTransferLink) {
+	for _, link := range links {
+		runner.result.Skipped = append(runner.result.Skipped, link.path)
+	}
+}
+
+// makeRemoteLinks creates links under remoteDir on the device, replacing any files at their
+// paths, with as few commands as possible.
+func (c *Device) makeRemoteLinks(remoteDir string, links []dirTransferLink) []error {
+	// Each link's command prints its index and ln's error if it fails.
+	args := make([]string, len(links))
+	for i, link := range links {
+		args[i] = fmt.Sprintf(`out=$(ln -sfn %s %s 2>&1) || echo "%d:$out"; `,
+			shellQuote(link.target), shellQuote(path.Join(remoteDir, link.path)), i)
+	}
+
+	errs := make([]error, len(links))
+	for _, batch := range shellBatches("", args, "") {
+		output, err := c.RunCommand(batch.cmd)
+		if err != nil {
+			for i := batch.start; i < batch.end; i++ {
+				errs[i] = err
+			}
+			continue
+		}
+		for _, line := range strings.Split(output, "\n") {
+			index, msg, ok := strings.Cut(strings.TrimRight(line, "\r"), ":")
+			i, err := strconv.Atoi(index)
+			if !ok || err != nil || i < batch.start || i >= batch.end {
+				continue
+			}
+			errs[i] = errors.Errorf(errors.AdbError, "error creating symlink: %s", strings.TrimSpace(msg))
+		}
+	}
+	return errs
+}
+
+// pullLinks recreates links, read from under remoteDir on the device, under localDir,
+// replacing any files at their paths.
+func (c *Device) pullLinks(remoteDir, localDir string, opts TransferOptions, links []dirTransferLink) []error {
+	paths := make([]string, len(links))
+	for i, link := range links {
+		paths[i] = path.Join(remoteDir, link.path)
+	}
+	targets, errs := c.readRemoteLinks(paths)
+	for i, link := range links {
+		if errs[i] != nil {
+			continue
+		}
+		localPath := opts.LocalPath(filepath.Join(localDir, filepath.FromSlash(link.path)))
+		os.Remove(localPath)
+		if err := os.Symlink(filepath.FromSlash(targets[i]), localPath); err != nil {
+			errs[i] = wrapLocalFileError(err, localPath)
+		}
+	}
+	return errs
+}
+
+// ReadLink returns the target of the symlink at path on the device, as it was written when
+// the symlink was made, so a relative target is relative to the symlink's directory. The
+// error has code FileNoExistError if path doesn't exist, and AssertionError if it isn't a
+// symlink.
+func (c *Device) ReadLink(path string) (string, error) {
+	targets, errs := c.readRemoteLinks([]string{path})
+	if errs[0] == nil {
+		return targets[0], nil
+	}
+	err := errs[0]
+	// readlink doesn't say why it failed, so ask the sync protocol.
+	if entry, statErr := c.lstat(path); statErr != nil {
+		err = statErr
+	} else if entry.Mode&os.ModeSymlink == 0 {
+		err = errors.Errorf(errors.AssertionError, "%s is not a symlink", path)
+	}
+	return "", wrapClientError(err, c, "ReadLink(%s)", path)
+}
+
+// readRemoteLinks returns the targets of the symlinks at paths on the device, with as few
+// commands as possible, and the error for each symlink that couldn't be read.
+func (c *Device) readRemoteLinks(paths []string) ([]string, []error) {
+	args := make([]string, len(paths))
+	for i, p := range paths {
+		args[i] = " " + shellQuote(p)
+	}
+
+	// readlink prints nothing if it fails, and a symlink's target can't be empty, so each
+	// symlink prints exactly one line.
+	targets := make([]string, len(paths))
+	errs := make([]error, len(paths))
+	for _, batch := range shellBatches("for f in", args, `; do readlink "$f" 2>/dev/null || echo; done`) {
+		output, err := c.RunCommand(batch.cmd)
+		lines := strings.Split(strings.TrimSuffix(output, "\n"), "\n")
+		if err == nil && len(lines) != batch.end-batch.start {
+			err = errors.Errorf(errors.ParseError, "expected %d symlink targets, got %d lines: %q",
+				batch.end-batch.start, len(lines), output)
+		}
+		for i := batch.start; i < batch.end; i++ {
+			switch {
+			case err != nil:
+				errs[i] = err
+			case strings.TrimRight(lines[i-batch.start], "\r") == "":
+				errs[i] = errors.Errorf(errors.AdbError, "couldn't read symlink %s", paths[i])
+			default:
+				targets[i] = strings.TrimRight(lines[i-batch.start], "\r")
+			}
+		}
+	}
+	return targets, errs
+}
+
+// followRemoteLink returns the entry of the file or directory the symlink at remotePath
+// points to, and its canonical path.
+func (c *Device) followRemoteLink(remotePath string) (*DirEntry, string, error) {
+	target, err := c.canonicalRemotePath(remotePath)
+	if err != nil {
+		return nil, "", err
+	}
+	entry, err := c.Stat(target)
+	if err != nil {
+		return nil, "", err
+	}
+	return entry, target, nil
+}
+
+// EvalSymlinks returns path on the device with all the symlinks in it resolved, like
+// filepath.EvalSymlinks. The error has code FileNoExistError if they can't be resolved.
+func (c *Device) EvalSymlinks(path string) (string, error) {
+	canonical, err := c.canonicalRemotePath(path)
+	return canonical, wrapClientError(err, c, "EvalSymlinks(%s)", path)
+}
+
+// canonicalRemotePath returns remotePath on the device with all its symlinks resolved.
+func (c *Device) canonicalRemotePath(remotePath string) (string, error) {
+	output, err := c.RunCommand("readlink -f " + shellQuote(remotePath) + " 2>/dev/null")
+	if err != nil {
+		return "", err
+	}
+	canonical := strings.TrimRight(output, "\r\n")
+	if canonical == "" {
+		return "", errors.Errorf(errors.FileNoExistError, "couldn't resolve symlinks in %s", remotePath)
+	}
+	return canonical, nil
+}
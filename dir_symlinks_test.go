@@ -0,0 +1,97 @@
+package adb
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/mqhack/goadb/internal/errors"
+	"github.com/mqhack/goadb/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsSymlinkLoop(t *testing.T) {
+	chain := []string{"/system", "/system/etc", "/vendor/etc"}
+	assert.True(t, isSymlinkLoop("/system", chain, "/"))
+	assert.True(t, isSymlinkLoop("/vendor", chain, "/"))
+	assert.True(t, isSymlinkLoop("/", chain, "/"))
+	assert.False(t, isSymlinkLoop("/system/lib", chain, "/"))
+	assert.False(t, isSymlinkLoop("/sys", chain, "/"))
+	assert.False(t, isSymlinkLoop("/system", nil, "/"))
+	assert.True(t, isSymlinkLoop(`C:\src`, []string{`C:\src\sub`}, `\`))
+}
+
+func TestMakeRemoteLinks(t *testing.T) {
+	s := &MockServer{
+		Status:   wire.StatusSuccess,
+		Messages: []string{"1:ln: /sdcard/dir/b: Permission denied\n"},
+	}
+	device := (&Adb{server: s}).Device(AnyDevice())
+
+	errs := device.makeRemoteLinks("/sdcard/dir", []dirTransferLink{
+		{path: "a", target: "../lib"},
+		{path: "b", target: "/system/b"},
+	})
+	require.Len(t, errs, 2)
+	assert.NoError(t, errs[0])
+	assert.Equal(t, errors.AdbError, code(errs[1]))
+	assert.Contains(t, errs[1].Error(), "Permission denied")
+	assert.Equal(t, `shell:out=$(ln -sfn '../lib' '/sdcard/dir/a' 2>&1) || echo "0:$out"; `+
+		`out=$(ln -sfn '/system/b' '/sdcard/dir/b' 2>&1) || echo "1:$out"; `, s.Requests[1])
+}
+
+func TestReadRemoteLinks(t *testing.T) {
+	s := &MockServer{
+		Status:   wire.StatusSuccess,
+		Messages: []string{"/system/lib64\r\n\r\nbar\r\n"},
+	}
+	device := (&Adb{server: s}).Device(AnyDevice())
+
+	targets, errs := device.readRemoteLinks([]string{"/system/lib", "/system/dangling", "/system/foo"})
+	assert.Equal(t, []string{"/system/lib64", "", "bar"}, targets)
+	assert.NoError(t, errs[0])
+	assert.Equal(t, errors.AdbError, code(errs[1]))
+	assert.NoError(t, errs[2])
+	assert.True(t, strings.HasPrefix(s.Requests[1], "shell:for f in '/system/lib' '/system/dangling' '/system/foo'; do readlink"))
+}
+
+func TestReadRemoteLinksMissingOutput(t *testing.T) {
+	s := &MockServer{
+		Status:   wire.StatusSuccess,
+		Messages: []string{"/system/lib64\n"},
+	}
+	device := (&Adb{server: s}).Device(AnyDevice())
+
+	_, errs := device.readRemoteLinks([]string{"/system/lib", "/system/foo"})
+	assert.Equal(t, errors.ParseError, code(errs[0]))
+	assert.Equal(t, errors.ParseError, code(errs[1]))
+}
+
+func TestLstatAndReadLink(t *testing.T) {
+	s := &MockServer{
+		Status:   wire.StatusSuccess,
+		Messages: []string{syncStat(0120777, 14, 1451703845), "/system/lib64\r\n"},
+	}
+	device := v1SyncDevice(s)
+
+	entry, err := device.Lstat("/system/lib")
+	require.NoError(t, err)
+	assert.NotZero(t, entry.Mode&os.ModeSymlink)
+
+	target, err := device.ReadLink("/system/lib")
+	require.NoError(t, err)
+	assert.Equal(t, "/system/lib64", target)
+}
+
+func TestEvalSymlinks(t *testing.T) {
+	s := &MockServer{Status: wire.StatusSuccess, Messages: []string{"/system/lib64\r\n"}}
+	canonical, err := (&Adb{server: s}).Device(AnyDevice()).EvalSymlinks("/system/lib")
+	require.NoError(t, err)
+	assert.Equal(t, "/system/lib64", canonical)
+	assert.Equal(t, "shell:readlink -f '/system/lib' 2>/dev/null", s.Requests[1])
+
+	s = &MockServer{Status: wire.StatusSuccess, Messages: []string{""}}
+	_, err = (&Adb{server: s}).Device(AnyDevice()).EvalSymlinks("/system/missing")
+	assert.True(t, HasErrCode(err, FileNoExistError))
+}
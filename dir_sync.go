@@ -0,0 +1,292 @@
+package adb
+
+import (
+	"context"
+	"encoding/hex"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/mqhack/goadb/internal/errors"
+)
+
+// SyncOptions configures Device.Sync.
+type SyncOptions struct {
+	// TransferOptions is how each file's path and contents are translated.
+	TransferOptions
+	// BulkOptions controls whether the sync stops at the first file that fails.
+	BulkOptions
+
+	// Checksum compares files that have the same size with this algorithm, instead of by
+	// their modification times, which catches changes that kept the time but costs reading
+	// every such file on both sides. Defaults to ChecksumNone.
+	Checksum ChecksumAlgorithm
+
+	// Delete removes files and directories under remoteDir that aren't in localDir, once
+	// the changed files have been pushed, unless any of them failed.
+	Delete bool
+
+	// Progress, if set, is called as each changed file is pushed, from the goroutine that
+	// called Sync.
+	Progress func(DirTransferProgress)
+}
+
+// SyncResult reports the outcome of Device.Sync. Paths are relative to the directories,
+// with slashes.
+type SyncResult struct {
+	// PartialResult reports the files that were pushed because they were new or had
+	// changed, and the files and directories that couldn't be pushed or deleted.
+	PartialResult
+	// Unchanged are the files that were already up to date on the device.
+	Unchanged []string
+	// Deleted are the files and directories that were removed from the device because they
+	// weren't in localDir.
+	Deleted []string
+}
+
+/*
+Sync makes the directory tree at remoteDir match localDir, pushing only the files that are
+new or have changed, like adb sync. A file has changed if its size or modification time
+differs from the remote file's, or, if opts.Checksum is set, its size or checksum does. Pushed
+files keep their permissions and modification times, so they compare as unchanged next time.
+
+Symlinks and special files in localDir are skipped. If opts.Newlines converts files, the sizes
+of the files it converts differ on each side, so they're always pushed unless opts.Checksum is
+set.
+
+The returned error is only non-nil if localDir couldn't be read, remoteDir couldn't be listed
+or created, or ctx is done, in which case the error has code Timeout.
+
+Corresponds to the command:
+
+	adb sync
+*/
+func (c *Device) Sync(ctx context.Context, localDir, remoteDir string, opts SyncOptions) (*SyncResult, error) {
+	result, err := c.sync(ctx, localDir, remoteDir, opts)
+	return result, wrapClientError(err, c, "Sync")
+}
+
+func (c *Device) sync(ctx context.Context, localDir, remoteDir string, opts SyncOptions) (*SyncResult, error) {
+	remoteDir = opts.RemotePath(remoteDir)
+	dirOpts := DirTransferOptions{TransferOptions: opts.withSharedRateLimit(), BulkOptions: opts.BulkOptions, Progress: opts.Progress}
+	runner := newBulkRunner(opts.BulkOptions)
+	result := &SyncResult{}
+
+	localDirs, localFiles, err := walkSyncLocal(opts.LocalPath(localDir))
+	if err != nil {
+		return nil, err
+	}
+	remote, err := c.walkSyncRemote(ctx, remoteDir, localDirs)
+	if err != nil {
+		return nil, err
+	}
+
+	// Remote entries that are in the way of a local file or directory are deleted first, and
+	// the rest last.
+	var conflicts, extra []string
+	for rel, entry := range remote {
+		_, isFile := localFiles[rel]
+		switch {
+		case localDirs[rel] && entry.Mode.IsDir(), isFile && entry.Mode.IsRegular():
+		case localDirs[rel] || isFile:
+			conflicts = append(conflicts, rel)
+			delete(remote, rel)
+		default:
+			extra = append(extra, rel)
+		}
+	}
+	sort.Strings(conflicts)
+	sort.Strings(extra)
+	if opts.Delete {
+		c.syncDelete(remoteDir, conflicts, runner, result)
+	} else {
+		for _, rel := range conflicts {
+			runner.fail(rel, errors.Errorf(errors.AssertionError, "%s is a different kind of file on the device", rel))
+			delete(localFiles, rel)
+		}
+	}
+
+	dirs := []string{remoteDir}
+	for rel := range localDirs {
+		if rel != "." && remote[rel] == nil {
+			dirs = append(dirs, path.Join(remoteDir, rel))
+		}
+	}
+	sort.Strings(dirs)
+	if err := c.makeRemoteDirs(dirs); err != nil {
+		return nil, err
+	}
+
+	changed, err := c.syncChanged(localDir, remoteDir, localFiles, remote, opts)
+	if err != nil {
+		return nil, err
+	}
+	var files []dirTransferFile
+	for _, rel := range sortedPaths(localFiles) {
+		if changed[rel] {
+			files = append(files, dirTransferFile{path: rel, size: localFiles[rel].Size()})
+		} else {
+			result.Unchanged = append(result.Unchanged, rel)
+		}
+	}
+
+	_, err = transferFiles(ctx, runner, files, dirOpts, func(file dirTransferFile, progress func(int)) error {
+		return c.pushFile(ctx, filepath.Join(localDir, filepath.FromSlash(file.path)), path.Join(remoteDir, file.path),
+			dirOpts.TransferOptions, progress)
+	})
+	if err == nil && opts.Delete && len(runner.result.Failed) == 0 {
+		c.syncDelete(remoteDir, extra, runner, result)
+	}
+	result.PartialResult = *runner.result
+	return result, err
+}
+
+// walkSyncLocal returns the directories and regular files under root, by their paths
+// relative to it, with slashes. The directories include ".", root itself.
+func walkSyncLocal(root string) (map[string]bool, map[string]os.FileInfo, error) {
+	dirs := map[string]bool{".": true}
+	files := make(map[string]os.FileInfo)
+	err := filepath.Walk(root, func(localPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return wrapLocalFileError(err, localPath)
+		}
+		rel, err := filepath.Rel(root, localPath)
+		if err != nil {
+			return wrapLocalFileError(err, localPath)
+		}
+		rel = filepath.ToSlash(rel)
+		switch {
+		case info.IsDir():
+			dirs[rel] = true
+		case info.Mode().IsRegular():
+			files[rel] = info
+		}
+		return nil
+	})
+	return dirs, files, err
+}
+
+// walkSyncRemote returns the entries under remoteDir on the device, by their paths relative
+// to it, with slashes. Only the directories that are in localDirs are listed, since the
+// contents of the others are either all new or all to be deleted.
+func (c *Device) walkSyncRemote(ctx context.Context, remoteDir string, localDirs map[string]bool) (map[string]*DirEntry, error) {
+	remote := make(map[string]*DirEntry)
+	var walk func(rel string) error
+	walk = func(rel string) error {
+		listing, err := c.ListDirEntriesContext(ctx, path.Join(remoteDir, rel))
+		if err != nil {
+			return err
+		}
+		entries, err := listing.ReadAll()
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if entry.Name == "." || entry.Name == ".." {
+				continue
+			}
+			entryPath := path.Join(rel, entry.Name)
+			remote[entryPath] = entry
+			if entry.Mode.IsDir() && localDirs[entryPath] {
+				if err := walk(entryPath); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	return remote, walk(".")
+}
+
+// syncChanged returns which of files differ from their remote entries.
+func (c *Device) syncChanged(localDir, remoteDir string, files map[string]os.FileInfo, remote map[string]*DirEntry,
+	opts SyncOptions) (map[string]bool, error) {
+	changed := make(map[string]bool)
+	var compare []string
+	for rel, file := range files {
+		entry := remote[rel]
+		switch {
+		case entry == nil:
+			changed[rel] = true
+		case opts.Checksum == ChecksumNone:
+			changed[rel] = entry.Size != file.Size() || entry.ModifiedAt.Unix() != file.ModTime().Unix()
+		case opts.Newlines == NewlinesUnchanged && entry.Size != file.Size():
+			changed[rel] = true
+		default:
+			compare = append(compare, rel)
+		}
+	}
+	if len(compare) == 0 {
+		return changed, nil
+	}
+
+	sort.Strings(compare)
+	remotePaths := make([]string, len(compare))
+	for i, rel := range compare {
+		remotePaths[i] = path.Join(remoteDir, rel)
+	}
+	sums, err := c.remoteChecksums(opts.Checksum, remotePaths)
+	if err != nil {
+		return nil, err
+	}
+	for i, rel := range compare {
+		localPath := opts.LocalPath(filepath.Join(localDir, filepath.FromSlash(rel)))
+		sum, err := localChecksum(opts.TransferOptions, opts.Checksum, localPath)
+		if err != nil {
+			return nil, err
+		}
+		changed[rel] = sums[remotePaths[i]] != sum
+	}
+	return changed, nil
+}
+
+// localChecksum returns the checksum of the file at localPath as it would be pushed with opts.
+func localChecksum(opts TransferOptions, algorithm ChecksumAlgorithm, localPath string) (string, error) {
+	local, err := os.Open(localPath)
+	if err != nil {
+		return "", wrapLocalFileError(err, localPath)
+	}
+	defer local.Close()
+	sum, err := algorithm.newHash()
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(sum, opts.PushReader(local)); err != nil {
+		return "", wrapLocalFileError(err, localPath)
+	}
+	return hex.EncodeToString(sum.Sum(nil)), nil
+}
+
+// syncDelete removes rels under remoteDir, recording them in result.Deleted, or recording the
+// failure in runner if they couldn't be removed.
+func (c *Device) syncDelete(remoteDir string, rels []string, runner *bulkRunner, result *SyncResult) {
+	args := make([]string, len(rels))
+	for i, rel := range rels {
+		args[i] = " " + shellQuote(path.Join(remoteDir, rel))
+	}
+	for _, batch := range shellBatches("rm -rf", args, "") {
+		output, err := c.RunCommand(batch.cmd)
+		if err == nil && strings.TrimSpace(output) != "" {
+			err = errors.Errorf(errors.AdbError, "error deleting files: %s", strings.TrimSpace(output))
+		}
+		for _, rel := range rels[batch.start:batch.end] {
+			if err != nil {
+				runner.fail(rel, err)
+			} else {
+				result.Deleted = append(result.Deleted, rel)
+			}
+		}
+	}
+}
+
+func sortedPaths(files map[string]os.FileInfo) []string {
+	keys := make([]string, 0, len(files))
+	for key := range files {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,98 @@
+package adb
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mqhack/goadb/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeSyncTree writes a.txt, b.txt and sub/c.txt, all modified at mtime, to a new directory.
+func writeSyncTree(t *testing.T, mtime time.Time) string {
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "sub"), 0755))
+	for name, content := range map[string]string{"a.txt": "aaa", "b.txt": "bbbb", "sub/c.txt": "c"} {
+		localPath := filepath.Join(dir, filepath.FromSlash(name))
+		require.NoError(t, ioutil.WriteFile(localPath, []byte(content), 0644))
+		require.NoError(t, os.Chtimes(localPath, mtime, mtime))
+	}
+	return dir
+}
+
+func TestSync(t *testing.T) {
+	localDir := writeSyncTree(t, time.Unix(1451703845, 0))
+	s := &MockServer{
+		Status: wire.StatusSuccess,
+		Messages: []string{
+			syncDirEntry(040755, 0, 1451703845, "."),
+			syncDirEntry(0100644, 3, 1451703845, "a.txt"),
+			syncDirEntry(0100644, 3, 1451703845, "b.txt"),
+			syncDirEntry(0100644, 9, 1451703845, "old.txt"),
+			"DONE",
+		},
+	}
+
+	result, err := v1SyncDevice(s).Sync(context.Background(), localDir, "/sdcard/x", SyncOptions{Delete: true})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"b.txt", "sub/c.txt"}, result.Succeeded)
+	assert.Equal(t, []string{"a.txt"}, result.Unchanged)
+	assert.Equal(t, []string{"old.txt"}, result.Deleted)
+	assert.True(t, result.OK())
+	assert.Contains(t, s.Requests, "shell:mkdir -p '/sdcard/x' '/sdcard/x/sub'")
+	assert.Equal(t, "shell:rm -rf '/sdcard/x/old.txt'", s.Requests[len(s.Requests)-1])
+	assert.True(t, strings.Contains(string(s.Written), "/sdcard/x/b.txt,420"))
+	assert.False(t, strings.Contains(string(s.Written), "/sdcard/x/a.txt"))
+}
+
+func TestSyncWithoutDelete(t *testing.T) {
+	localDir := writeSyncTree(t, time.Unix(1451703845, 0))
+	s := &MockServer{
+		Status: wire.StatusSuccess,
+		Messages: []string{
+			syncDirEntry(040755, 0, 1451703845, "a.txt"),
+			syncDirEntry(0100644, 9, 1451703845, "old.txt"),
+			"DONE",
+		},
+	}
+
+	result, err := v1SyncDevice(s).Sync(context.Background(), localDir, "/sdcard/x", SyncOptions{})
+	require.NoError(t, err)
+	// a.txt is a directory on the device, so it can't be replaced without deleting it.
+	require.Len(t, result.Failed, 1)
+	assert.Equal(t, "a.txt", result.Failed[0].Item)
+	assert.Equal(t, []string{"b.txt", "sub/c.txt"}, result.Succeeded)
+	assert.Empty(t, result.Deleted)
+	for _, req := range s.Requests {
+		assert.False(t, strings.HasPrefix(req, "shell:rm"), req)
+	}
+}
+
+func TestSyncChecksum(t *testing.T) {
+	// The times differ, but the checksums are compared instead.
+	localDir := writeSyncTree(t, time.Unix(1451700000, 0))
+	_, files, err := walkSyncLocal(localDir)
+	require.NoError(t, err)
+	remote := map[string]*DirEntry{
+		"a.txt":     {Name: "a.txt", Mode: 0644, Size: 3},
+		"b.txt":     {Name: "b.txt", Mode: 0644, Size: 4},
+		"sub/c.txt": {Name: "c.txt", Mode: 0644, Size: 1},
+	}
+	// md5 of "aaa", a different checksum for "bbbb", and none for sub/c.txt.
+	s := &MockServer{Status: wire.StatusSuccess, Messages: []string{
+		"47bce5c74f589f4867dbd57e9ca9f808  /sdcard/x/a.txt\r\n" +
+			"d41d8cd98f00b204e9800998ecf8427e  /sdcard/x/b.txt\r\n" +
+			"md5sum: /sdcard/x/sub/c.txt: Permission denied\r\n",
+	}}
+
+	changed, err := v1SyncDevice(s).syncChanged(localDir, "/sdcard/x", files, remote, SyncOptions{Checksum: ChecksumMD5})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{"a.txt": false, "b.txt": true, "sub/c.txt": true}, changed)
+	assert.True(t, strings.HasPrefix(s.Requests[1], "shell:set -- '/sdcard/x/a.txt' '/sdcard/x/b.txt' '/sdcard/x/sub/c.txt'; "), s.Requests[1])
+}
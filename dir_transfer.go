@@ -0,0 +1,416 @@
+package adb
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/mqhack/goadb/internal/errors"
+)
+
+// The longest command PushDir and PullDir run to create directories or symlinks or read
+// symlinks, well under the shell's argument limit on every release.
+const maxShellCommandLen = 32 * 1024
+
+// DirTransferOptions configures Device.PushDir and Device.PullDir.
+type DirTransferOptions struct {
+	// TransferOptions is how each file's path and contents are translated.
+	TransferOptions
+	// BulkOptions controls whether the transfer stops at the first file that fails.
+	BulkOptions
+
+	// Symlinks is how symlinks in the directory tree are transferred. Defaults to
+	// SymlinksSkip.
+	Symlinks SymlinkPolicy
+
+	// Patterns, if set, choose which files and symlinks are transferred by their paths
+	// relative to the directory, with slashes. Each pattern matches whole paths like
+	// path.Match, except that a "**" segment matches any number of segments, so "**/*.so"
+	// matches .so files at any depth. A pattern starting with "!" excludes the paths it
+	// matches, and the others include them. The last pattern that matches a path decides;
+	// paths that match none are only transferred if every pattern excludes.
+	//
+	// Directories that an excluding pattern matches, or ends with "/**" under, aren't walked.
+	// If any pattern includes, only the directories that hold transferred files or symlinks
+	// are created.
+	Patterns []string
+
+	// Progress, if set, is called as each file is transferred, from the goroutine that
+	// called PushDir or PullDir.
+	Progress func(DirTransferProgress)
+}
+
+// DirTransferProgress reports the progress of Device.PushDir or Device.PullDir.
+type DirTransferProgress struct {
+	// Path is the file being transferred, relative to the directory, with slashes.
+	Path string
+	// FileBytes is how many bytes of the file have been transferred, out of FileSize.
+	FileBytes, FileSize int64
+
+	// Files is how many files have finished, out of TotalFiles.
+	Files, TotalFiles int
+	// Bytes is how many bytes of all the files have been transferred, out of TotalBytes.
+	Bytes, TotalBytes int64
+}
+
+// dirTransferFile is a file to be transferred by PushDir or PullDir.
+type dirTransferFile struct {
+	// Relative to the directory, with slashes.
+	path string
+	size int64
+}
+
+/*
+PushDir pushes the directory tree at localDir to remoteDir, creating remoteDir and its
+subdirectories, including empty ones, as needed. Each file keeps its permissions and
+modification time, and its path and contents are translated according to opts. Symlinks are
+handled according to opts.Symlinks, and special files are skipped.
+
+Files are reported in the PartialResult by their path relative to localDir, with slashes. A
+file or subdirectory that fails doesn't stop the others being pushed, unless opts.FailFast is
+set.
+
+The returned error is only non-nil if localDir couldn't be read, remoteDir couldn't be
+created, or ctx is done, in which case the error has code Timeout, and files that weren't
+pushed are in PartialResult.Skipped.
+
+Corresponds to the command:
+
+	adb push <local-dir> <remote-dir>
+*/
+func (c *Device) PushDir(ctx context.Context, localDir, remoteDir string, opts DirTransferOptions) (*PartialResult, error) {
+	remoteDir = opts.RemotePath(remoteDir)
+	opts.TransferOptions = opts.withSharedRateLimit()
+	root := opts.LocalPath(localDir)
+	filter, err := newPathFilter(opts.Patterns)
+	if err != nil {
+		return nil, wrapClientError(err, c, "PushDir")
+	}
+	runner := newBulkRunner(opts.BulkOptions)
+	var dirs []string
+	var files []dirTransferFile
+	var links []dirTransferLink
+
+	// chain is the canonical paths of the directory being walked and its ancestors, which
+	// followed symlinks mustn't lead back to.
+	var walk func(rel string, chain []string) error
+	walk = func(rel string, chain []string) error {
+		dir := filepath.Join(root, filepath.FromSlash(rel))
+		infos, err := ioutil.ReadDir(dir)
+		if err != nil {
+			return wrapLocalFileError(err, dir)
+		}
+		for _, info := range infos {
+			entryPath := path.Join(rel, info.Name())
+			localPath := filepath.Join(dir, info.Name())
+			canonical := filepath.Join(chain[len(chain)-1], info.Name())
+			if info.Mode()&os.ModeSymlink != 0 {
+				switch opts.Symlinks {
+				case SymlinksRecreate:
+					if !filter.includes(entryPath) {
+						continue
+					}
+					target, err := os.Readlink(localPath)
+					if err != nil {
+						runner.fail(entryPath, wrapLocalFileError(err, localPath))
+					} else {
+						links = append(links, dirTransferLink{path: entryPath, target: opts.RemotePath(target)})
+					}
+					continue
+				case SymlinksFollow:
+					if info, err = os.Stat(localPath); err == nil && info.IsDir() {
+						canonical, err = filepath.EvalSymlinks(localPath)
+					}
+					if err != nil {
+						runner.fail(entryPath, wrapLocalFileError(err, localPath))
+						continue
+					}
+					if info.IsDir() && isSymlinkLoop(canonical, chain, string(filepath.Separator)) {
+						runner.fail(entryPath, errors.Errorf(errors.AssertionError, "symlink %s leads to a directory containing it", localPath))
+						continue
+					}
+				default:
+					continue
+				}
+			}
+			switch {
+			case info.IsDir():
+				if filter.excludesDir(entryPath) {
+					continue
+				}
+				dirs = append(dirs, entryPath)
+				if err := walk(entryPath, append(chain[:len(chain):len(chain)], canonical)); err != nil {
+					runner.fail(entryPath, err)
+				}
+			case info.Mode().IsRegular() && filter.includes(entryPath):
+				files = append(files, dirTransferFile{path: entryPath, size: info.Size()})
+			}
+		}
+		return nil
+	}
+	canonicalRoot, err := filepath.Abs(root)
+	if err == nil && opts.Symlinks == SymlinksFollow {
+		canonicalRoot, err = filepath.EvalSymlinks(canonicalRoot)
+	}
+	if err != nil {
+		return nil, wrapClientError(wrapLocalFileError(err, root), c, "PushDir")
+	}
+	if err := walk("", []string{canonicalRoot}); err != nil {
+		return nil, wrapClientError(err, c, "PushDir")
+	}
+	remoteDirs := []string{remoteDir}
+	for _, dir := range filter.dirsToCreate(dirs, files, links) {
+		remoteDirs = append(remoteDirs, path.Join(remoteDir, dir))
+	}
+	if err := c.makeRemoteDirs(remoteDirs); err != nil {
+		return nil, wrapClientError(err, c, "PushDir")
+	}
+
+	result, err := transferFiles(ctx, runner, files, opts, func(file dirTransferFile, progress func(int)) error {
+		return c.pushFile(ctx, filepath.Join(localDir, filepath.FromSlash(file.path)), path.Join(remoteDir, file.path),
+			opts.TransferOptions, progress)
+	})
+	if err == nil {
+		err = transferLinks(ctx, runner, links, func(links []dirTransferLink) []error {
+			return c.makeRemoteLinks(remoteDir, links)
+		})
+	} else {
+		skipLinks(runner, links)
+	}
+	return result, wrapClientError(err, c, "PushDir")
+}
+
+/*
+PullDir pulls the directory tree at remoteDir to localDir, creating localDir and its
+subdirectories, including empty ones, as needed. Each file's path and contents are translated
+according to opts, and if opts.PreserveMetadata is set, it keeps its permissions and
+modification time. Symlinks are handled according to opts.Symlinks, and special files are
+skipped.
+
+Files are reported in the PartialResult by their path relative to remoteDir. A file or
+subdirectory that fails doesn't stop the others being pulled, unless opts.FailFast is set.
+
+The returned error is only non-nil if remoteDir couldn't be listed, localDir couldn't be
+created, or ctx is done, in which case the error has code Timeout, and files that weren't
+pulled are in PartialResult.Skipped.
+
+Corresponds to the command:
+
+	adb pull <remote-dir> <local-dir>
+*/
+func (c *Device) PullDir(ctx context.Context, remoteDir, localDir string, opts DirTransferOptions) (*PartialResult, error) {
+	remoteDir = opts.RemotePath(remoteDir)
+	opts.TransferOptions = opts.withSharedRateLimit()
+	filter, err := newPathFilter(opts.Patterns)
+	if err != nil {
+		return nil, wrapClientError(err, c, "PullDir")
+	}
+	runner := newBulkRunner(opts.BulkOptions)
+	var dirs []string
+	var files []dirTransferFile
+	var links []dirTransferLink
+	// The listed entries of files, so their metadata doesn't have to be stat'd again.
+	listed := make(map[string]*DirEntry)
+
+	// chain is the canonical paths of the directory being walked and its ancestors, which
+	// followed symlinks mustn't lead back to. It's only tracked when following symlinks.
+	var walk func(rel string, chain []string) error
+	walk = func(rel string, chain []string) error {
+		entries, err := c.ListDirEntriesContext(ctx, path.Join(remoteDir, rel))
+		if err != nil {
+			return err
+		}
+		all, err := entries.ReadAll()
+		if err != nil {
+			return err
+		}
+		if rel == "" {
+			if err := os.MkdirAll(opts.LocalPath(localDir), 0755); err != nil {
+				return wrapLocalFileError(err, localDir)
+			}
+		}
+		sort.Slice(all, func(i, j int) bool { return all[i].Name < all[j].Name })
+		for _, entry := range all {
+			if entry.Name == "." || entry.Name == ".." {
+				continue
+			}
+			entryPath := path.Join(rel, entry.Name)
+			var canonical string
+			if chain != nil {
+				canonical = path.Join(chain[len(chain)-1], entry.Name)
+			}
+			if entry.Mode&os.ModeSymlink != 0 {
+				switch opts.Symlinks {
+				case SymlinksRecreate:
+					if filter.includes(entryPath) {
+						links = append(links, dirTransferLink{path: entryPath})
+					}
+					continue
+				case SymlinksFollow:
+					target, targetPath, err := c.followRemoteLink(path.Join(remoteDir, entryPath))
+					if err != nil {
+						runner.fail(entryPath, err)
+						continue
+					}
+					if target.Mode.IsDir() && isSymlinkLoop(targetPath, chain, "/") {
+						runner.fail(entryPath, errors.Errorf(errors.AssertionError, "symlink %s leads to a directory containing it", entryPath))
+						continue
+					}
+					target.Name = entry.Name
+					entry, canonical = target, targetPath
+				default:
+					continue
+				}
+			}
+			switch {
+			case entry.Mode.IsDir():
+				if filter.excludesDir(entryPath) {
+					continue
+				}
+				dirs = append(dirs, entryPath)
+				var subchain []string
+				if chain != nil {
+					subchain = append(chain[:len(chain):len(chain)], canonical)
+				}
+				if err := walk(entryPath, subchain); err != nil {
+					runner.fail(entryPath, err)
+				}
+			case entry.Mode.IsRegular() && filter.includes(entryPath):
+				files = append(files, dirTransferFile{path: entryPath, size: entry.Size})
+				listed[entryPath] = entry
+			}
+		}
+		return nil
+	}
+	var chain []string
+	if opts.Symlinks == SymlinksFollow {
+		canonicalRoot, err := c.canonicalRemotePath(remoteDir)
+		if err != nil {
+			return nil, wrapClientError(err, c, "PullDir")
+		}
+		chain = []string{canonicalRoot}
+	}
+	if err := walk("", chain); err != nil {
+		return nil, wrapClientError(err, c, "PullDir")
+	}
+	for _, dir := range filter.dirsToCreate(dirs, files, links) {
+		local := filepath.Join(localDir, filepath.FromSlash(dir))
+		if err := os.MkdirAll(opts.LocalPath(local), 0755); err != nil {
+			runner.fail(dir, wrapLocalFileError(err, local))
+		}
+	}
+
+	result, err := transferFiles(ctx, runner, files, opts, func(file dirTransferFile, progress func(int)) error {
+		return c.pullFile(ctx, path.Join(remoteDir, file.path), filepath.Join(localDir, filepath.FromSlash(file.path)),
+			opts.TransferOptions, listed[file.path], progress)
+	})
+	if err == nil {
+		err = transferLinks(ctx, runner, links, func(links []dirTransferLink) []error {
+			return c.pullLinks(remoteDir, localDir, opts.TransferOptions, links)
+		})
+	} else {
+		skipLinks(runner, links)
+	}
+	return result, wrapClientError(err, c, "PullDir")
+}
+
+// makeRemoteDirs creates dirs and their parents on the device, with as few commands as
+// possible.
+func (c *Device) makeRemoteDirs(dirs []string) error {
+	args := make([]string, len(dirs))
+	for i, dir := range dirs {
+		args[i] = " " + shellQuote(dir)
+	}
+	for _, batch := range shellBatches("mkdir -p", args, "") {
+		output, err := c.RunCommand(batch.cmd)
+		if err != nil {
+			return err
+		}
+		if output = strings.TrimSpace(output); output != "" {
+			return errors.Errorf(errors.AdbError, "error creating directories: %s", output)
+		}
+	}
+	return nil
+}
+
+// shellBatch is a command made by shellBatches, holding args[start:end].
+type shellBatch struct {
+	cmd        string
+	start, end int
+}
+
+// shellBatches returns as few commands as possible that together hold all of args, each made
+// of prefix, then consecutive args, then suffix, and no longer than maxShellCommandLen unless
+// a single arg makes it longer.
+func shellBatches(prefix string, args []string, suffix string) []shellBatch {
+	var batches []shellBatch
+	for start := 0; start < len(args); {
+		cmd := prefix
+		end := start
+		for ; end < len(args); end++ {
+			if end > start && len(cmd)+len(args[end])+len(suffix) > maxShellCommandLen {
+				break
+			}
+			cmd += args[end]
+		}
+		batches = append(batches, shellBatch{cmd: cmd + suffix, start: start, end: end})
+		start = end
+	}
+	return batches
+}
+
+// transferFiles calls transfer for each of files in turn, recording the results in runner
+// and reporting progress to opts.Progress.
+func transferFiles(ctx context.Context, runner *bulkRunner, files []dirTransferFile, opts DirTransferOptions,
+	transfer func(file dirTransferFile, progress func(int)) error) (*PartialResult, error) {
+	total := DirTransferProgress{TotalFiles: len(files)}
+	for _, file := range files {
+		total.TotalBytes += file.size
+	}
+
+	for i, file := range files {
+		if ctx.Err() != nil {
+			for _, skipped := range files[i:] {
+				runner.result.Skipped = append(runner.result.Skipped, skipped.path)
+			}
+			return runner.result, errors.WrapErrorf(ctx.Err(), errors.Timeout, "transfer cancelled after %d of %d files", i, len(files))
+		}
+
+		current := total
+		current.Path, current.FileSize = file.path, file.size
+		report := func() {
+			if opts.Progress != nil {
+				opts.Progress(current)
+			}
+		}
+		report()
+		ok := runner.run(file.path, func() error {
+			return transfer(file, func(n int) {
+				current.FileBytes += int64(n)
+				current.Bytes += int64(n)
+				report()
+			})
+		})
+		// Files can change size while they're transferred, so the totals count what was
+		// actually transferred.
+		total.Bytes = current.Bytes
+		total.Files++
+		if !ok {
+			for _, skipped := range files[i+1:] {
+				runner.result.Skipped = append(runner.result.Skipped, skipped.path)
+			}
+			break
+		}
+	}
+	if opts.Progress != nil {
+		opts.Progress(total)
+	}
+	if ctx.Err() != nil {
+		return runner.result, errors.WrapErrorf(ctx.Err(), errors.Timeout, "transfer cancelled")
+	}
+	return runner.result, nil
+}
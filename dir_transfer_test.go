@@ -0,0 +1,103 @@
+package adb
+
+import (
+	"context"
+	stderrors "errors"
+	"strings"
+	"testing"
+
+	"github.com/mqhack/goadb/internal/errors"
+	"github.com/mqhack/goadb/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransferFiles(t *testing.T) {
+	files := []dirTransferFile{{"a.txt", 3}, {"dir/b.txt", 5}, {"dir/c.txt", 2}}
+	var progress []DirTransferProgress
+	opts := DirTransferOptions{Progress: func(p DirTransferProgress) {
+		progress = append(progress, p)
+	}}
+
+	result, err := transferFiles(context.Background(), newBulkRunner(opts.BulkOptions), files, opts,
+		func(file dirTransferFile, progress func(int)) error {
+			if file.path == "dir/b.txt" {
+				progress(2)
+				return stderrors.New("disk full")
+			}
+			progress(int(file.size))
+			return nil
+		})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a.txt", "dir/c.txt"}, result.Succeeded)
+	require.Len(t, result.Failed, 1)
+	assert.Equal(t, "dir/b.txt: disk full", result.Failed[0].Error())
+
+	assert.Equal(t, []DirTransferProgress{
+		{Path: "a.txt", FileSize: 3, TotalFiles: 3, TotalBytes: 10},
+		{Path: "a.txt", FileBytes: 3, FileSize: 3, Bytes: 3, TotalFiles: 3, TotalBytes: 10},
+		{Path: "dir/b.txt", FileSize: 5, Files: 1, Bytes: 3, TotalFiles: 3, TotalBytes: 10},
+		{Path: "dir/b.txt", FileBytes: 2, FileSize: 5, Files: 1, Bytes: 5, TotalFiles: 3, TotalBytes: 10},
+		{Path: "dir/c.txt", FileSize: 2, Files: 2, Bytes: 5, TotalFiles: 3, TotalBytes: 10},
+		{Path: "dir/c.txt", FileBytes: 2, FileSize: 2, Files: 2, Bytes: 7, TotalFiles: 3, TotalBytes: 10},
+		{Files: 3, Bytes: 7, TotalFiles: 3, TotalBytes: 10},
+	}, progress)
+}
+
+func TestTransferFilesFailFast(t *testing.T) {
+	files := []dirTransferFile{{"a.txt", 3}, {"b.txt", 5}, {"c.txt", 2}}
+	runner := newBulkRunner(BulkOptions{FailFast: true})
+	runner.fail("dir", stderrors.New("permission denied"))
+
+	result, err := transferFiles(context.Background(), runner, files, DirTransferOptions{},
+		func(file dirTransferFile, progress func(int)) error {
+			t.Fatal("file transferred after failure")
+			return nil
+		})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a.txt", "b.txt", "c.txt"}, result.Skipped)
+}
+
+func TestTransferFilesCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	files := []dirTransferFile{{"a.txt", 3}, {"b.txt", 5}}
+
+	result, err := transferFiles(ctx, newBulkRunner(BulkOptions{}), files, DirTransferOptions{},
+		func(file dirTransferFile, progress func(int)) error {
+			cancel()
+			return nil
+		})
+	assert.Equal(t, errors.Timeout, code(err))
+	assert.Equal(t, []string{"a.txt"}, result.Succeeded)
+	assert.Equal(t, []string{"b.txt"}, result.Skipped)
+}
+
+func TestMakeRemoteDirs(t *testing.T) {
+	s := &MockServer{Status: wire.StatusSuccess}
+	device := (&Adb{server: s}).Device(AnyDevice())
+
+	dirs := []string{"/sdcard/My Files"}
+	for i := 0; i < 1000; i++ {
+		dirs = append(dirs, "/sdcard/My Files/"+strings.Repeat("d", 20))
+	}
+	require.NoError(t, device.makeRemoteDirs(dirs))
+	var commands []string
+	for _, req := range s.Requests {
+		if strings.HasPrefix(req, "shell:") {
+			commands = append(commands, req)
+		}
+	}
+	require.Len(t, commands, 2)
+	assert.True(t, strings.HasPrefix(commands[0], "shell:mkdir -p '/sdcard/My Files' '/sdcard/My Files/ddd"))
+	assert.True(t, len(commands[0]) <= len("shell:")+maxShellCommandLen)
+}
+
+func TestShellBatches(t *testing.T) {
+	long := strings.Repeat("x", maxShellCommandLen)
+	batches := shellBatches("echo", []string{" a", " b", long, " c"}, ";")
+	assert.Equal(t, []shellBatch{
+		{cmd: "echo a b;", start: 0, end: 2},
+		{cmd: "echo" + long + ";", start: 2, end: 3},
+		{cmd: "echo c;", start: 3, end: 4},
+	}, batches)
+}
@@ -0,0 +1,270 @@
+package adb
+
+import (
+	"bufio"
+	"context"
+	"path"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/mqhack/goadb/internal/errors"
+)
+
+// DirEventKind is the type of change reported by a DirWatcher.
+//
+//go:generate stringer -type=DirEventKind
+type DirEventKind int8
+
+const (
+	// DirCreate is a file or directory created in, or moved into, the watched directory.
+	DirCreate DirEventKind = iota
+	// DirModify is a file in the watched directory that was written to.
+	DirModify
+	// DirDelete is a file or directory deleted from, or moved out of, the watched directory.
+	DirDelete
+)
+
+// DirEvent describes a change to an entry of a watched directory.
+type DirEvent struct {
+	Kind DirEventKind
+	// Path is the path on the device of the entry that changed.
+	Path string
+}
+
+// Printed by WatchDir's script to report what it found on the device.
+const (
+	dirWatchNoDirMarker       = "goadb:no-dir"
+	dirWatchInotifydMarker    = "goadb:inotifyd"
+	dirWatchInotifywaitMarker = "goadb:inotifywait"
+)
+
+// How often WatchDir lists the directory when the device has no inotify tool.
+const dirWatchPollInterval = time.Second
+
+/*
+DirWatcher reports changes to the entries of a directory on a device.
+*/
+type DirWatcher struct {
+	events chan DirEvent
+
+	// If an error occurs, it is stored here and events is closed immediately after.
+	err atomic.Value
+}
+
+// C returns a channel that can be received on to get change events.
+// The channel is closed when the context passed to WatchDir is done or an error occurs.
+func (w *DirWatcher) C() <-chan DirEvent {
+	return w.events
+}
+
+// Err returns the error that caused the channel returned by C to be closed, if C is closed.
+// It's nil if the context was done.
+// If C is not closed, its return value is undefined.
+func (w *DirWatcher) Err() error {
+	if err, ok := w.err.Load().(error); ok {
+		return err
+	}
+	return nil
+}
+
+/*
+WatchDir starts a DirWatcher that reports files and directories created in, modified in, or
+deleted from the directory at dir, until ctx is done. Only dir's own entries are watched, not
+those of its subdirectories. Files are reported as modified when they're closed after being
+written, so a new screenshot is reported once it's complete.
+
+Changes are reported as they happen with toybox's inotifyd, or inotifywait if the device has
+it instead. Otherwise the directory is listed every second, so changes are reported late,
+modifications are only noticed if they change a file's size or modification time, and a file
+that's deleted and recreated between listings is reported as modified.
+
+The error has code FileNoExistError if dir isn't a directory.
+*/
+func (c *Device) WatchDir(ctx context.Context, dir string) (*DirWatcher, error) {
+	quoted := shellQuote(dir)
+	conn, err := c.openExec("if [ ! -d " + quoted + " ]; then echo " + dirWatchNoDirMarker +
+		"; elif command -v inotifyd >/dev/null 2>&1; then echo " + dirWatchInotifydMarker +
+		"; exec inotifyd - " + quoted + ":nwdmy" +
+		"; elif command -v inotifywait >/dev/null 2>&1; then echo " + dirWatchInotifywaitMarker +
+		"; exec inotifywait -m -q -e create,close_write,delete,moved_from,moved_to --format '%e\t%f' " + quoted +
+		"; fi 2>/dev/null")
+	if err != nil {
+		return nil, wrapClientError(err, c, "WatchDir(%s)", dir)
+	}
+	stop := closeWhenDone(ctx, conn)
+	scanner := bufio.NewScanner(conn)
+	var tool string
+	if scanner.Scan() {
+		tool = strings.TrimSpace(scanner.Text())
+	}
+
+	var previous map[string]*DirEntry
+	if tool != dirWatchInotifydMarker && tool != dirWatchInotifywaitMarker {
+		stop()
+		conn.Close()
+		switch {
+		case ctx.Err() != nil:
+			err = errors.WrapErrorf(ctx.Err(), errors.Timeout, "watching %s cancelled", dir)
+		case tool == dirWatchNoDirMarker:
+			err = errors.Errorf(errors.FileNoExistError, "no directory at %s", dir)
+		case scanner.Err() != nil:
+			err = errors.WrapErrorf(scanner.Err(), errors.NetworkError, "error starting to watch %s", dir)
+		default:
+			// There's no inotify tool, so changes are found by comparing listings.
+			previous, err = c.listDirForWatch(ctx, dir)
+		}
+		if err != nil {
+			return nil, wrapClientError(err, c, "WatchDir(%s)", dir)
+		}
+	}
+
+	watcher := &DirWatcher{events: make(chan DirEvent)}
+	go func() {
+		defer close(watcher.events)
+		var err error
+		if previous != nil {
+			err = c.pollDir(ctx, dir, previous, watcher.events)
+		} else {
+			defer conn.Close()
+			defer stop()
+			err = watchDirEvents(ctx, dir, tool, scanner, watcher.events)
+		}
+		if err != nil && ctx.Err() == nil {
+			watcher.err.Store(wrapClientError(err, c, "WatchDir(%s)", dir))
+		}
+	}()
+	return watcher, nil
+}
+
+// watchDirEvents sends the events printed by tool to events, until it stops or ctx is done.
+func watchDirEvents(ctx context.Context, dir, tool string, scanner *bufio.Scanner, events chan<- DirEvent) error {
+	parse := parseInotifydLine
+	if tool == dirWatchInotifywaitMarker {
+		parse = parseInotifywaitLine
+	}
+	for scanner.Scan() {
+		event, ok := parse(dir, strings.TrimRight(scanner.Text(), "\r"))
+		if !ok {
+			continue
+		}
+		select {
+		case events <- event:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return errors.WrapErrorf(err, errors.NetworkError, "error reading changes to %s", dir)
+	}
+	return errors.Errorf(errors.AdbError, "%s stopped watching %s", strings.TrimPrefix(tool, "goadb:"), dir)
+}
+
+// parseInotifydLine parses a line printed by inotifyd -, e.g. "n	/sdcard/DCIM	a.jpg".
+func parseInotifydLine(dir, line string) (DirEvent, bool) {
+	fields := strings.Split(line, "\t")
+	if len(fields) != 3 || fields[0] == "" || fields[2] == "" {
+		return DirEvent{}, false
+	}
+	event := DirEvent{Path: path.Join(dir, fields[2])}
+	switch fields[0][0] {
+	case 'n', 'y':
+		event.Kind = DirCreate
+	case 'w':
+		event.Kind = DirModify
+	case 'd', 'm':
+		event.Kind = DirDelete
+	default:
+		return DirEvent{}, false
+	}
+	return event, true
+}
+
+// parseInotifywaitLine parses a line printed by inotifywait with WatchDir's format, e.g.
+// "CREATE,ISDIR	sub".
+func parseInotifywaitLine(dir, line string) (DirEvent, bool) {
+	names, name, ok := strings.Cut(line, "\t")
+	if !ok || name == "" {
+		return DirEvent{}, false
+	}
+	event := DirEvent{Path: path.Join(dir, name)}
+	switch strings.Split(names, ",")[0] {
+	case "CREATE", "MOVED_TO":
+		event.Kind = DirCreate
+	case "CLOSE_WRITE":
+		event.Kind = DirModify
+	case "DELETE", "MOVED_FROM":
+		event.Kind = DirDelete
+	default:
+		return DirEvent{}, false
+	}
+	return event, true
+}
+
+// pollDir lists dir every dirWatchPollInterval, and sends the changes from the previous
+// listing to events, until listing fails or ctx is done.
+func (c *Device) pollDir(ctx context.Context, dir string, previous map[string]*DirEntry, events chan<- DirEvent) error {
+	ticker := time.NewTicker(dirWatchPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		current, err := c.listDirForWatch(ctx, dir)
+		if err != nil {
+			return err
+		}
+		for _, event := range diffDirListings(dir, previous, current) {
+			select {
+			case events <- event:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		previous = current
+	}
+}
+
+// listDirForWatch returns the entries of dir by name.
+func (c *Device) listDirForWatch(ctx context.Context, dir string) (map[string]*DirEntry, error) {
+	listing, err := c.ListDirEntriesContext(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+	all, err := listing.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	entries := make(map[string]*DirEntry, len(all))
+	for _, entry := range all {
+		if entry.Name != "." && entry.Name != ".." {
+			entries[entry.Name] = entry
+		}
+	}
+	return entries, nil
+}
+
+// diffDirListings returns the events that change the listing previous into current, in
+// order of name.
+func diffDirListings(dir string, previous, current map[string]*DirEntry) []DirEvent {
+	var events []DirEvent
+	for name, entry := range current {
+		old := previous[name]
+		switch {
+		case old == nil:
+			events = append(events, DirEvent{Kind: DirCreate, Path: path.Join(dir, name)})
+		case entry.Mode.IsRegular() && (old.Size != entry.Size || !old.ModifiedAt.Equal(entry.ModifiedAt)):
+			events = append(events, DirEvent{Kind: DirModify, Path: path.Join(dir, name)})
+		}
+	}
+	for name := range previous {
+		if current[name] == nil {
+			events = append(events, DirEvent{Kind: DirDelete, Path: path.Join(dir, name)})
+		}
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].Path < events[j].Path })
+	return events
+}
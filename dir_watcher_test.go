@@ -0,0 +1,118 @@
+package adb
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/mqhack/goadb/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseInotifydLine(t *testing.T) {
+	for line, expected := range map[string]DirEvent{
+		"n\t/sdcard/DCIM\ta.jpg": {Kind: DirCreate, Path: "/sdcard/DCIM/a.jpg"},
+		"y\t/sdcard/DCIM\tb.jpg": {Kind: DirCreate, Path: "/sdcard/DCIM/b.jpg"},
+		"w\t/sdcard/DCIM\ta.jpg": {Kind: DirModify, Path: "/sdcard/DCIM/a.jpg"},
+		"d\t/sdcard/DCIM\ta.jpg": {Kind: DirDelete, Path: "/sdcard/DCIM/a.jpg"},
+		"m\t/sdcard/DCIM\tc.jpg": {Kind: DirDelete, Path: "/sdcard/DCIM/c.jpg"},
+	} {
+		event, ok := parseInotifydLine("/sdcard/DCIM", line)
+		assert.True(t, ok, line)
+		assert.Equal(t, expected, event, line)
+	}
+	for _, line := range []string{"", "D\t/sdcard/DCIM", "a\t/sdcard/DCIM\ta.jpg"} {
+		_, ok := parseInotifydLine("/sdcard/DCIM", line)
+		assert.False(t, ok, line)
+	}
+}
+
+func TestParseInotifywaitLine(t *testing.T) {
+	event, ok := parseInotifywaitLine("/sdcard", "CREATE,ISDIR\tsub")
+	assert.True(t, ok)
+	assert.Equal(t, DirEvent{Kind: DirCreate, Path: "/sdcard/sub"}, event)
+	event, ok = parseInotifywaitLine("/sdcard", "CLOSE_WRITE,CLOSE\ta.log")
+	assert.True(t, ok)
+	assert.Equal(t, DirEvent{Kind: DirModify, Path: "/sdcard/a.log"}, event)
+	event, ok = parseInotifywaitLine("/sdcard", "MOVED_FROM\ta.log")
+	assert.True(t, ok)
+	assert.Equal(t, DirEvent{Kind: DirDelete, Path: "/sdcard/a.log"}, event)
+	_, ok = parseInotifywaitLine("/sdcard", "Setting up watches.")
+	assert.False(t, ok)
+}
+
+func TestDiffDirListings(t *testing.T) {
+	mtime := time.Unix(1451703845, 0)
+	previous := map[string]*DirEntry{
+		"kept.txt":    {Name: "kept.txt", Mode: 0644, Size: 3, ModifiedAt: mtime},
+		"changed.txt": {Name: "changed.txt", Mode: 0644, Size: 3, ModifiedAt: mtime},
+		"gone.txt":    {Name: "gone.txt", Mode: 0644, Size: 3, ModifiedAt: mtime},
+		"sub":         {Name: "sub", Mode: os.ModeDir | 0755, ModifiedAt: mtime},
+	}
+	current := map[string]*DirEntry{
+		"kept.txt":    {Name: "kept.txt", Mode: 0644, Size: 3, ModifiedAt: mtime},
+		"changed.txt": {Name: "changed.txt", Mode: 0644, Size: 3, ModifiedAt: mtime.Add(time.Second)},
+		"new.txt":     {Name: "new.txt", Mode: 0644, Size: 1, ModifiedAt: mtime},
+		"sub":         {Name: "sub", Mode: os.ModeDir | 0755, ModifiedAt: mtime.Add(time.Second)},
+	}
+	assert.Equal(t, []DirEvent{
+		{Kind: DirModify, Path: "/sdcard/changed.txt"},
+		{Kind: DirDelete, Path: "/sdcard/gone.txt"},
+		{Kind: DirCreate, Path: "/sdcard/new.txt"},
+	}, diffDirListings("/sdcard", previous, current))
+}
+
+func TestWatchDirInotifyd(t *testing.T) {
+	s := &MockServer{Status: wire.StatusSuccess, Messages: []string{
+		"goadb:inotifyd\n",
+		"n\t/sdcard/DCIM\ta.jpg\nw\t/sdcard/DCIM\ta.jpg\n",
+	}}
+	watcher, err := (&Adb{server: s}).Device(AnyDevice()).WatchDir(context.Background(), "/sdcard/DCIM")
+	require.NoError(t, err)
+	assert.Contains(t, s.Requests[1], "exec inotifyd - '/sdcard/DCIM':nwdmy")
+
+	var events []DirEvent
+	for event := range watcher.C() {
+		events = append(events, event)
+	}
+	assert.Equal(t, []DirEvent{
+		{Kind: DirCreate, Path: "/sdcard/DCIM/a.jpg"},
+		{Kind: DirModify, Path: "/sdcard/DCIM/a.jpg"},
+	}, events)
+	// The mock server runs out of output, as if inotifyd exited.
+	assert.True(t, HasErrCode(watcher.Err(), AdbError), "%v", watcher.Err())
+}
+
+func TestWatchDirNoDir(t *testing.T) {
+	s := &MockServer{Status: wire.StatusSuccess, Messages: []string{"goadb:no-dir\n"}}
+	_, err := (&Adb{server: s}).Device(AnyDevice()).WatchDir(context.Background(), "/sdcard/missing")
+	assert.True(t, HasErrCode(err, FileNoExistError))
+}
+
+func TestWatchDirPolls(t *testing.T) {
+	// The script prints no marker, so the directory is listed instead.
+	s := &MockServer{Status: wire.StatusSuccess, Messages: []string{
+		"\n",
+		syncDirEntry(0100644, 3, 1451703845, "a.txt"),
+		"DONE",
+		syncDirEntry(0100644, 3, 1451703845, "a.txt"),
+		syncDirEntry(0100644, 5, 1451703845, "b.txt"),
+		"DONE",
+	}}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	watcher, err := v1SyncDevice(s).WatchDir(ctx, "/sdcard")
+	require.NoError(t, err)
+
+	select {
+	case event := <-watcher.C():
+		assert.Equal(t, DirEvent{Kind: DirCreate, Path: "/sdcard/b.txt"}, event)
+	case <-time.After(5 * dirWatchPollInterval):
+		t.Fatal("no event")
+	}
+	cancel()
+	for range watcher.C() {
+	}
+}
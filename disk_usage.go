@@ -0,0 +1,168 @@
+package adb
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/mqhack/goadb/internal/errors"
+)
+
+// Printed between the outputs of df and dumpsys diskstats by StorageStats.
+const diskstatsMarker = "goadb:diskstats"
+
+// FilesystemStats is the space on a mounted file system, as reported by df. Sizes are in
+// bytes.
+type FilesystemStats struct {
+	Filesystem string
+	MountedOn  string
+	Total      int64
+	Used       int64
+	Available  int64
+}
+
+// PartitionSpace is the free space on one of the partitions reported by dumpsys diskstats.
+// Sizes are in bytes.
+type PartitionSpace struct {
+	Free, Total int64
+}
+
+// StorageStats reports the space on the device's storage.
+type StorageStats struct {
+	// Filesystems are the mounted file systems, in the order df lists them.
+	Filesystems []FilesystemStats
+
+	// Data, Cache and System are the partitions dumpsys diskstats reports on, or nil if it
+	// didn't, e.g. because the device doesn't have the service.
+	Data, Cache, System *PartitionSpace
+}
+
+// MountedOn returns the file system mounted at mountPoint, e.g. "/data", or nil if there
+// isn't one.
+func (s *StorageStats) MountedOn(mountPoint string) *FilesystemStats {
+	for i := len(s.Filesystems) - 1; i >= 0; i-- {
+		// Later mounts hide earlier ones at the same point.
+		if s.Filesystems[i].MountedOn == mountPoint {
+			return &s.Filesystems[i]
+		}
+	}
+	return nil
+}
+
+// Matches the lines printed by du -sk, e.g. "1234	/sdcard".
+var duLinePattern = regexp.MustCompile(`^(\d+)\s+(.*)$`)
+
+/*
+DiskUsage returns how many bytes the file or directory tree at path uses on disk, rounded up
+to whole kilobytes. Files the shell user can't read are left out.
+
+Corresponds to the command:
+
+	adb shell du -sk <path>
+*/
+func (c *Device) DiskUsage(path string) (int64, error) {
+	output, err := c.RunCommand("du -sk " + shellQuote(path) + " </dev/null 2>&1")
+	if err != nil {
+		return 0, wrapClientError(err, c, "DiskUsage(%s)", path)
+	}
+	usage, err := parseDiskUsage(output)
+	return usage, wrapClientError(err, c, "DiskUsage(%s)", path)
+}
+
+func parseDiskUsage(output string) (int64, error) {
+	// du prints errors for the files it can't read, then the total.
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if match := duLinePattern.FindStringSubmatch(strings.TrimSpace(lines[len(lines)-1])); match != nil {
+		kilobytes, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return 0, errors.WrapErrorf(err, errors.ParseError, "invalid disk usage %q", match[1])
+		}
+		return kilobytes * 1024, nil
+	}
+	output = strings.TrimSpace(output)
+	return 0, errors.Errorf(fsErrorCode(output), "error getting disk usage: %s", output)
+}
+
+/*
+StorageStats returns the space on each mounted file system, and on the data, cache and system
+partitions.
+
+Corresponds to the commands:
+
+	adb shell df -k
+	adb shell dumpsys diskstats
+*/
+func (c *Device) StorageStats() (*StorageStats, error) {
+	output, err := c.RunCommand("df -k 2>/dev/null; echo " + diskstatsMarker + "; dumpsys diskstats 2>/dev/null")
+	if err != nil {
+		return nil, wrapClientError(err, c, "StorageStats")
+	}
+	df, diskstats, _ := strings.Cut(output, diskstatsMarker)
+	stats := &StorageStats{}
+	if stats.Filesystems, err = parseDf(df); err != nil {
+		return nil, wrapClientError(err, c, "StorageStats")
+	}
+	parseDiskstats(diskstats, stats)
+	return stats, nil
+}
+
+// parseDf parses the output of df -k, e.g.
+//
+//	Filesystem     1K-blocks    Used Available Use% Mounted on
+//	/dev/block/dm-0  5102876 5089188     13688 100% /
+func parseDf(output string) ([]FilesystemStats, error) {
+	var filesystems []FilesystemStats
+	lines := strings.Split(output, "\n")
+	for i, line := range lines {
+		fields := strings.Fields(line)
+		if i == 0 || len(fields) < 6 {
+			continue
+		}
+		var sizes [3]int64
+		for j := range sizes {
+			kilobytes, err := strconv.ParseInt(fields[j+1], 10, 64)
+			if err != nil {
+				return nil, errors.WrapErrorf(err, errors.ParseError, "invalid df line %q", strings.TrimSpace(line))
+			}
+			sizes[j] = kilobytes * 1024
+		}
+		filesystems = append(filesystems, FilesystemStats{
+			Filesystem: fields[0],
+			// The mount point is last, and may contain spaces.
+			MountedOn: strings.Join(fields[5:], " "),
+			Total:     sizes[0],
+			Used:      sizes[1],
+			Available: sizes[2],
+		})
+	}
+	if len(filesystems) == 0 {
+		return nil, errors.Errorf(errors.ParseError, "no file systems in df output: %q", output)
+	}
+	return filesystems, nil
+}
+
+// Matches the free space lines printed by dumpsys diskstats, e.g.
+//
+//	Data-Free: 4277000K / 5989944K total = 71% free
+var diskstatsFreePattern = regexp.MustCompile(`^(\w+)-Free: (\d+)K / (\d+)K total`)
+
+// parseDiskstats sets the partitions in stats from the output of dumpsys diskstats.
+func parseDiskstats(output string, stats *StorageStats) {
+	for _, line := range strings.Split(output, "\n") {
+		match := diskstatsFreePattern.FindStringSubmatch(strings.TrimSpace(line))
+		if match == nil {
+			continue
+		}
+		free, _ := strconv.ParseInt(match[2], 10, 64)
+		total, _ := strconv.ParseInt(match[3], 10, 64)
+		space := &PartitionSpace{Free: free * 1024, Total: total * 1024}
+		switch match[1] {
+		case "Data":
+			stats.Data = space
+		case "Cache":
+			stats.Cache = space
+		case "System":
+			stats.System = space
+		}
+	}
+}
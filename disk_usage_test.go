@@ -0,0 +1,60 @@
+package adb
+
+import (
+	"testing"
+
+	"github.com/mqhack/goadb/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiskUsage(t *testing.T) {
+	s := &MockServer{Status: wire.StatusSuccess, Messages: []string{
+		"du: /sdcard/Android/data/x: Permission denied\r\n1234\t/sdcard\r\n",
+	}}
+	usage, err := (&Adb{server: s}).Device(AnyDevice()).DiskUsage("/sdcard")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1234*1024), usage)
+	assert.Equal(t, "shell:du -sk '/sdcard' </dev/null 2>&1", s.Requests[1])
+}
+
+func TestDiskUsageMissing(t *testing.T) {
+	_, err := parseDiskUsage("du: /sdcard/missing: No such file or directory\n")
+	assert.True(t, HasErrCode(err, FileNoExistError))
+}
+
+func TestStorageStats(t *testing.T) {
+	s := &MockServer{Status: wire.StatusSuccess, Messages: []string{
+		"Filesystem            1K-blocks    Used Available Use% Mounted on\n" +
+			"/dev/block/dm-0         5102876 5089188     13688 100% /\n" +
+			"tmpfs                   1007800     612   1007188   1% /dev\n" +
+			"/dev/block/dm-5         5989944 1712944   4277000  29% /data\n" +
+			"/dev/fuse               5989944 1712944   4277000  29% /storage/emulated\n" +
+			diskstatsMarker + "\n" +
+			"Latency: 2ms [512B Data Write]\n" +
+			"Data-Free: 4277000K / 5989944K total = 71% free\n" +
+			"System-Free: 0K / 1456136K total = 0% free\n" +
+			"File-based Encryption: true\n",
+	}}
+	stats, err := (&Adb{server: s}).Device(AnyDevice()).StorageStats()
+	require.NoError(t, err)
+	require.Len(t, stats.Filesystems, 4)
+	assert.Equal(t, FilesystemStats{
+		Filesystem: "/dev/block/dm-5",
+		MountedOn:  "/data",
+		Total:      5989944 * 1024,
+		Used:       1712944 * 1024,
+		Available:  4277000 * 1024,
+	}, *stats.MountedOn("/data"))
+	assert.Nil(t, stats.MountedOn("/cache"))
+	assert.Equal(t, &PartitionSpace{Free: 4277000 * 1024, Total: 5989944 * 1024}, stats.Data)
+	assert.Equal(t, &PartitionSpace{Free: 0, Total: 1456136 * 1024}, stats.System)
+	assert.Nil(t, stats.Cache)
+}
+
+func TestParseDfInvalid(t *testing.T) {
+	_, err := parseDf("Filesystem 1K-blocks Used Available Use% Mounted on\n/dev x y z 1% /\n")
+	assert.True(t, HasErrCode(err, ParseError))
+	_, err = parseDf("df: not found\n")
+	assert.True(t, HasErrCode(err, ParseError))
+}
@@ -0,0 +1,147 @@
+package adb
+
+import (
+	"bufio"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/mqhack/goadb/internal/errors"
+)
+
+// DisplayID is the physical ID of a display, as listed by ListDisplays and accepted by
+// screencap -d and screenrecord --display-id. The zero value means the default display.
+type DisplayID uint64
+
+// Display describes a display attached to the device.
+type Display struct {
+	ID DisplayID
+	// HWCDisplay is the hardware composer's index for the display. 0 is usually the built-in
+	// display.
+	HWCDisplay int
+	Port       int
+	PnpID      string
+	Name       string
+}
+
+// Matches the lines printed by dumpsys SurfaceFlinger --display-id, e.g.
+//
+//	Display 4619827259835644672 (HWC display 0): port=0 pnpId=GGL displayName="EMU_display_0"
+var displayLinePattern = regexp.MustCompile(`^Display (\d+) \(HWC display (\d+)\):(.*)$`)
+
+// Matches the key=value attributes after the display IDs, where the value may be quoted.
+var displayAttributePattern = regexp.MustCompile(`(\w+)=("[^"]*"|\S*)`)
+
+/*
+ListDisplays returns the physical displays attached to the device, e.g. both screens of a
+foldable, or the screens of an Android Automotive head unit. Requires Android Q or later.
+
+Corresponds to the command:
+
+	adb shell dumpsys SurfaceFlinger --display-id
+*/
+func (c *Device) ListDisplays() ([]Display, error) {
+	output, err := c.RunCommand("dumpsys", "SurfaceFlinger", "--display-id")
+	if err != nil {
+		return nil, wrapClientError(err, c, "ListDisplays")
+	}
+	displays, err := parseDisplayList(output)
+	return displays, wrapClientError(err, c, "ListDisplays")
+}
+
+func parseDisplayList(output string) ([]Display, error) {
+	var displays []Display
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		match := displayLinePattern.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+
+		id, err := strconv.ParseUint(match[1], 10, 64)
+		if err != nil {
+			return nil, errors.WrapErrorf(err, errors.ParseError, "invalid display ID in %q", line)
+		}
+		hwcDisplay, _ := strconv.Atoi(match[2])
+		display := Display{ID: DisplayID(id), HWCDisplay: hwcDisplay}
+		for _, attr := range displayAttributePattern.FindAllStringSubmatch(match[3], -1) {
+			value := strings.Trim(attr[2], `"`)
+			switch attr[1] {
+			case "port":
+				display.Port, _ = strconv.Atoi(value)
+			case "pnpId":
+				display.PnpID = value
+			case "displayName":
+				display.Name = value
+			}
+		}
+		displays = append(displays, display)
+	}
+
+	if len(displays) == 0 {
+		return nil, errors.Errorf(errors.ParseError, "no displays listed by dumpsys SurfaceFlinger: %s", strings.TrimSpace(output))
+	}
+	return displays, nil
+}
+
+/*
+SetInputDisplay makes the input helpers (Tap, Swipe, Text, KeyEvent and the others built on
+input) run by this Device inject their events into display, as listed by ListDisplays, e.g.
+the cover screen of a foldable or a passenger screen of a car. Commands run by other Device
+values for the same device are unaffected.
+
+input takes the display's logical ID rather than its physical one, so it's looked up with
+dumpsys display; the error has code FileNoExistError if the display isn't listed there.
+Passing 0, the default display, injects events into the default display again. Other displays
+require Android Q or later.
+
+Corresponds to the command:
+
+	adb shell dumpsys display
+*/
+func (c *Device) SetInputDisplay(display DisplayID) error {
+	if display == 0 {
+		c.inputDisplay.Store(0)
+		return nil
+	}
+	output, err := c.RunCommand("dumpsys", "display")
+	if err != nil {
+		return wrapClientError(err, c, "SetInputDisplay")
+	}
+	logical, ok := logicalDisplayID(output, display)
+	if !ok {
+		err := errors.Errorf(errors.FileNoExistError, "display %d isn't listed by dumpsys display", display)
+		return wrapClientError(err, c, "SetInputDisplay")
+	}
+	c.inputDisplay.Store(logical)
+	return nil
+}
+
+// Matches the logical and physical IDs of a display in the DisplayInfo lines printed by dumpsys
+// display, e.g.
+//
+//	mBaseDisplayInfo=DisplayInfo{"Built-in Screen", displayId 0, ..., uniqueId "local:4619827259835644672", ...}
+var displayInfoIDsPattern = regexp.MustCompile(`DisplayInfo\{.*?\bdisplayId (\d+).*?\buniqueId "local:(\d+)"`)
+
+// logicalDisplayID returns the logical ID of the display with the physical ID display, from the
+// output of dumpsys display.
+func logicalDisplayID(output string, display DisplayID) (int, bool) {
+	want := strconv.FormatUint(uint64(display), 10)
+	for _, match := range displayInfoIDsPattern.FindAllStringSubmatch(output, -1) {
+		if match[2] != want {
+			continue
+		}
+		if logical, err := strconv.Atoi(match[1]); err == nil {
+			return logical, true
+		}
+	}
+	return 0, false
+}
+
+// getInputDisplay returns the logical ID of the display set by SetInputDisplay, or 0 if there
+// isn't one.
+func (c *Device) getInputDisplay() int {
+	display, _ := c.inputDisplay.Load().(int)
+	return display
+}
@@ -0,0 +1,75 @@
+package adb
+
+import (
+	"testing"
+
+	"github.com/mqhack/goadb/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDisplayList(t *testing.T) {
+	output := "Display 4619827259835644672 (HWC display 0): port=0 pnpId=GGL displayName=\"EMU_display_0\"\r\n" +
+		"Display 4619827551948147201 (HWC display 1): port=1 pnpId=GGL displayName=\"Outer display\"\r\n"
+	displays, err := parseDisplayList(output)
+	require.NoError(t, err)
+	assert.Equal(t, []Display{
+		{ID: 4619827259835644672, HWCDisplay: 0, Port: 0, PnpID: "GGL", Name: "EMU_display_0"},
+		{ID: 4619827551948147201, HWCDisplay: 1, Port: 1, PnpID: "GGL", Name: "Outer display"},
+	}, displays)
+}
+
+func TestParseDisplayListOldFormat(t *testing.T) {
+	// Android Q doesn't print the attributes.
+	displays, err := parseDisplayList("Display 19260211033588105 (HWC display 0): no identification data\n")
+	require.NoError(t, err)
+	assert.Equal(t, []Display{{ID: 19260211033588105}}, displays)
+}
+
+func TestParseDisplayListUnsupported(t *testing.T) {
+	_, err := parseDisplayList("Unknown argument: --display-id\n")
+	assert.EqualError(t, err, "ParseError: no displays listed by dumpsys SurfaceFlinger: Unknown argument: --display-id")
+}
+
+const dumpsysDisplay = `Logical Displays: size=2
+  Display 0:
+    mDisplayId=0
+    mBaseDisplayInfo=DisplayInfo{"Built-in Screen", displayId 0, displayGroupId 0, FLAG_SECURE, real 1080 x 2400, uniqueId "local:4619827259835644672", app 1080 x 2400}
+  Display 2:
+    mDisplayId=2
+    mBaseDisplayInfo=DisplayInfo{"Cover Screen", displayId 2, displayGroupId 0, FLAG_SECURE, real 904 x 2316, uniqueId "local:4619827259835644673", app 904 x 2316}
+`
+
+func TestSetInputDisplay(t *testing.T) {
+	s := &MockServer{Status: wire.StatusSuccess, Messages: []string{dumpsysDisplay}}
+	device := (&Adb{server: s}).Device(AnyDevice())
+
+	require.NoError(t, device.SetInputDisplay(4619827259835644673))
+	assert.Equal(t, "shell:dumpsys display", s.Requests[1])
+	require.NoError(t, device.runInput("tap", "10", "20"))
+	assert.Equal(t, "shell:input -d 2 tap 10 20", s.Requests[len(s.Requests)-1])
+
+	require.NoError(t, device.SetInputDisplay(0))
+	require.NoError(t, device.runInput("tap", "10", "20"))
+	assert.Equal(t, "shell:input tap 10 20", s.Requests[len(s.Requests)-1])
+}
+
+func TestSetInputDisplayNotListed(t *testing.T) {
+	s := &MockServer{Status: wire.StatusSuccess, Messages: []string{dumpsysDisplay}}
+	device := (&Adb{server: s}).Device(AnyDevice())
+
+	assert.True(t, HasErrCode(device.SetInputDisplay(42), FileNoExistError))
+	assert.Equal(t, 0, device.getInputDisplay())
+}
+
+func TestLogicalDisplayID(t *testing.T) {
+	// Before Android R the display's name and logical ID are quoted together.
+	old := `mBaseDisplayInfo=DisplayInfo{"Built-in Screen, displayId 0", uniqueId "local:0", app 1080 x 1920}`
+	id, ok := logicalDisplayID(old, 0)
+	assert.True(t, ok)
+	assert.Equal(t, 0, id)
+
+	id, ok = logicalDisplayID(dumpsysDisplay, 4619827259835644672)
+	assert.True(t, ok)
+	assert.Equal(t, 0, id)
+}
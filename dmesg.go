@@ -0,0 +1,179 @@
+package adb
+
+import (
+	"bufio"
+	"context"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/mqhack/goadb/internal/errors"
+)
+
+// KernelLogLevel is the syslog severity of a kernel log message.
+//
+//go:generate stringer -type=KernelLogLevel
+type KernelLogLevel int8
+
+const (
+	KernelEmergency KernelLogLevel = iota
+	KernelAlert
+	KernelCritical
+	KernelError
+	KernelWarning
+	KernelNotice
+	KernelInfo
+	KernelDebug
+)
+
+// KernelLogEntry is a single message from the kernel log.
+type KernelLogEntry struct {
+	// Timestamp is the time since boot the message was logged at, or 0 if the kernel
+	// doesn't record timestamps.
+	Timestamp time.Duration
+	// Facility is the syslog facility of the message, which is 0 for the kernel itself.
+	// -1 if not reported.
+	Facility int
+	// Level is -1 if not reported.
+	Level   KernelLogLevel
+	Message string
+}
+
+// DmesgOptions configures Device.Dmesg.
+type DmesgOptions struct {
+	// If true, keep waiting for new messages after the existing ones have been read.
+	Follow bool
+}
+
+// Matches e.g. "<6>[   12.345678] usb 1-1: new device", where the level marker and
+// timestamp are optional, and the timestamp may be followed by a caller ID like "[  T1]".
+var kernelLogPattern = regexp.MustCompile(`^(?:<(\d+)>)?(?:\[\s*(\d+)\.(\d+)\])?(?:\[\s*[TC]\d+\])?\s?(.*)$`)
+
+/*
+DmesgStream delivers parsed kernel log messages from a running dmesg command.
+*/
+type DmesgStream struct {
+	entries chan KernelLogEntry
+
+	// If an error occurs, it is stored here and entries is closed immediately after.
+	err atomic.Value
+}
+
+// C returns a channel that can be received on to get kernel log entries.
+// The channel is closed when dmesg exits, the context passed to Dmesg is done, or an
+// error occurs.
+func (s *DmesgStream) C() <-chan KernelLogEntry {
+	return s.entries
+}
+
+// Err returns the error that caused the channel returned by C to be closed, if C is closed.
+// It's nil if dmesg exited normally or the context was done.
+// If C is not closed, its return value is undefined.
+func (s *DmesgStream) Err() error {
+	if err, ok := s.err.Load().(error); ok {
+		return err
+	}
+	return nil
+}
+
+/*
+Dmesg reads the kernel log and streams the parsed messages until ctx is done, or dmesg
+exits if opts.Follow is false.
+
+Most production builds don't let the shell user read the kernel log, so if dmesg fails, it's
+retried with su, if the device has it. If every attempt fails, an error with code
+RequirementNotMet is returned.
+
+Corresponds to the command:
+
+	adb shell dmesg -r [-w]
+*/
+func (c *Device) Dmesg(ctx context.Context, opts DmesgOptions) (*DmesgStream, error) {
+	cmd := "dmesg -r"
+	if opts.Follow {
+		cmd += " -w"
+	}
+
+	var failures []string
+	for _, level := range privilegeLevels {
+		conn, err := c.openShell(level.wrap(cmd))
+		if err != nil {
+			return nil, wrapClientError(err, c, "Dmesg")
+		}
+		stop := closeWhenDone(ctx, conn)
+
+		// Wait for the first output, so failures can be retried at the next level.
+		stdout := newShellStdoutReader(conn)
+		if err := stdout.fill(); err != nil {
+			stop()
+			conn.Close()
+			if ctx.Err() != nil {
+				return nil, wrapClientError(errors.WrapErrorf(ctx.Err(), errors.Timeout, "dmesg cancelled"), c, "Dmesg")
+			}
+			return nil, wrapClientError(err, c, "Dmesg")
+		}
+		if stdout.exited && stdout.exitCode != 0 {
+			stop()
+			conn.Close()
+			failures = append(failures, level.name+": "+strings.TrimSpace(stdout.stderr.String()))
+			continue
+		}
+
+		stream := &DmesgStream{entries: make(chan KernelLogEntry)}
+		go func() {
+			defer close(stream.entries)
+			defer conn.Close()
+			defer stop()
+
+			scanner := bufio.NewScanner(stdout)
+			for scanner.Scan() {
+				select {
+				case stream.entries <- parseKernelLogLine(scanner.Text()):
+				case <-ctx.Done():
+					return
+				}
+			}
+			if err := scanner.Err(); err != nil && ctx.Err() == nil {
+				stream.err.Store(wrapClientError(errors.WrapErrorf(err, errors.NetworkError, "error reading dmesg"), c, "Dmesg"))
+			}
+		}()
+		return stream, nil
+	}
+
+	err := errors.Errorf(errors.RequirementNotMet, "can't read kernel log: %s", strings.Join(failures, "; "))
+	return nil, wrapClientError(err, c, "Dmesg")
+}
+
+func parseKernelLogLine(line string) KernelLogEntry {
+	line = strings.TrimRight(line, "\r")
+	entry := KernelLogEntry{Facility: -1, Level: -1, Message: line}
+
+	match := kernelLogPattern.FindStringSubmatch(line)
+	if match == nil {
+		return entry
+	}
+	if match[1] != "" {
+		priority := atoiOrZero(match[1])
+		entry.Facility = priority >> 3
+		entry.Level = KernelLogLevel(priority & 7)
+	}
+	if match[2] != "" {
+		entry.Timestamp = parseKernelTimestamp(match[2], match[3])
+	}
+	entry.Message = match[4]
+	return entry
+}
+
+// parseKernelTimestamp parses the seconds and fractional seconds of a timestamp.
+func parseKernelTimestamp(seconds, fraction string) time.Duration {
+	if len(fraction) > 9 {
+		fraction = fraction[:9]
+	}
+	// Scale the fraction to nanoseconds.
+	fraction += strings.Repeat("0", 9-len(fraction))
+	secs, _ := strconv.ParseInt(seconds, 10, 64)
+	nanos, _ := strconv.ParseInt(fraction, 10, 64)
+	return time.Duration(secs)*time.Second + time.Duration(nanos)
+}
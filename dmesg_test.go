@@ -0,0 +1,97 @@
+package adb
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mqhack/goadb/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseKernelLogLine(t *testing.T) {
+	assert.Equal(t, KernelLogEntry{
+		Timestamp: 12*time.Second + 345678*time.Microsecond,
+		Facility:  0,
+		Level:     KernelInfo,
+		Message:   "usb 1-1: new high-speed USB device number 2",
+	}, parseKernelLogLine("<6>[   12.345678] usb 1-1: new high-speed USB device number 2\r"))
+
+	assert.Equal(t, KernelLogEntry{
+		Timestamp: 1500 * time.Millisecond,
+		Facility:  1,
+		Level:     KernelError,
+		Message:   "init: service 'foo' exited",
+	}, parseKernelLogLine("<11>[    1.500000][    T1] init: service 'foo' exited"))
+
+	assert.Equal(t, KernelLogEntry{
+		Facility: -1,
+		Level:    -1,
+		Message:  "no prefix",
+	}, parseKernelLogLine("no prefix"))
+}
+
+func TestDmesgFallsBackToSu(t *testing.T) {
+	s := &MockServer{
+		Status: wire.StatusSuccess,
+		Messages: []string{
+			shellPacket(wire.ShellIDStderr, "dmesg: klogctl: Permission denied\n"),
+			shellPacket(wire.ShellIDExit, "\x01"),
+			shellPacket(wire.ShellIDStdout, "<4>[    0.000000] Booting Linux\n<6>[    0.100000] done\n"),
+			shellPacket(wire.ShellIDExit, "\x00"),
+		},
+	}
+	device := (&Adb{server: s}).Device(AnyDevice())
+
+	stream, err := device.Dmesg(context.Background(), DmesgOptions{})
+	require.NoError(t, err)
+	var entries []KernelLogEntry
+	for entry := range stream.C() {
+		entries = append(entries, entry)
+	}
+	assert.NoError(t, stream.Err())
+	assert.Equal(t, []KernelLogEntry{
+		{Timestamp: 0, Facility: 0, Level: KernelWarning, Message: "Booting Linux"},
+		{Timestamp: 100 * time.Millisecond, Facility: 0, Level: KernelInfo, Message: "done"},
+	}, entries)
+	assert.Equal(t, "shell,v2,raw:dmesg -r", s.Requests[1])
+	assert.Equal(t, "shell,v2,raw:su 0 sh -c 'dmesg -r'", s.Requests[3])
+}
+
+func TestDmesgRestricted(t *testing.T) {
+	s := &MockServer{
+		Status: wire.StatusSuccess,
+		Messages: []string{
+			shellPacket(wire.ShellIDStderr, "dmesg: klogctl: Permission denied\n"),
+			shellPacket(wire.ShellIDExit, "\x01"),
+			shellPacket(wire.ShellIDStderr, "/system/bin/sh: su: not found\n"),
+			shellPacket(wire.ShellIDExit, "\x7f"),
+			shellPacket(wire.ShellIDStderr, "/system/bin/sh: su: not found\n"),
+			shellPacket(wire.ShellIDExit, "\x7f"),
+		},
+	}
+	device := (&Adb{server: s}).Device(AnyDevice())
+
+	_, err := device.Dmesg(context.Background(), DmesgOptions{Follow: true})
+	assert.True(t, HasErrCode(err, RequirementNotMet))
+	assert.Contains(t, ErrorWithCauseChain(err), "can't read kernel log: shell: dmesg: klogctl: Permission denied; su 0: /system/bin/sh: su: not found")
+	assert.Equal(t, "shell,v2,raw:su -c 'dmesg -r -w'", s.Requests[5])
+}
+
+func TestDmesgLineTooLong(t *testing.T) {
+	s := &MockServer{
+		Status: wire.StatusSuccess,
+		Messages: []string{
+			shellPacket(wire.ShellIDStdout, "<6>[    0.000000] "+strings.Repeat("x", 70000)+"\n"),
+			shellPacket(wire.ShellIDExit, "\x00"),
+		},
+	}
+	stream, err := (&Adb{server: s}).Device(AnyDevice()).Dmesg(context.Background(), DmesgOptions{})
+	require.NoError(t, err)
+	for range stream.C() {
+	}
+	assert.True(t, HasErrCode(stream.Err(), NetworkError))
+	assert.Contains(t, ErrorWithCauseChain(stream.Err()), "token too long")
+}
@@ -19,6 +19,31 @@ const (
 	DeviceNotFound = ErrCode(errors.DeviceNotFound)
 	// Tried to perform an operation on a path that doesn't exist on the device.
 	FileNoExistError = ErrCode(errors.FileNoExistError)
+	// The operation didn't finish before its deadline, or its context was cancelled.
+	Timeout = ErrCode(errors.Timeout)
+	// The device doesn't meet a requirement checked by the operation, e.g. it's running the
+	// wrong build.
+	RequirementNotMet = ErrCode(errors.RequirementNotMet)
+	// The server doesn't allow access to the device, e.g. because it was started with
+	// --one-device for a different device.
+	ServerRestricted = ErrCode(errors.ServerRestricted)
+	// The device's certificate doesn't match the one it was first trusted with, or has been
+	// revoked.
+	UntrustedDevice = ErrCode(errors.UntrustedDevice)
+	// No view on the screen matches a UI selector.
+	NodeNotFound = ErrCode(errors.NodeNotFound)
+	// A transferred file's checksum on the device doesn't match the checksum of the data
+	// sent or received.
+	ChecksumMismatch = ErrCode(errors.ChecksumMismatch)
+	// The device refused access to a file.
+	PermissionDenied = ErrCode(errors.PermissionDenied)
+	// Tried to modify a file on a file system the device has mounted read-only.
+	ReadOnlyFileSystem = ErrCode(errors.ReadOnlyFileSystem)
+	// Tried to create a file at a path that already exists on the device.
+	FileExistError = ErrCode(errors.FileExistError)
+	// The package manager refused to install or uninstall a package. PackageFailureReason
+	// returns the reason it gave.
+	PackageManagerError = ErrCode(errors.PackageManagerError)
 )
 
 // HasErrCode returns true if err is an *errors.Err and err.Code == code.
@@ -0,0 +1,141 @@
+package adb
+
+import (
+	"fmt"
+
+	"github.com/mqhack/goadb/internal/errors"
+	"github.com/mqhack/goadb/parse"
+	"github.com/mqhack/goadb/wire"
+)
+
+// ForwardEntry is a port forward from the host to a device, as listed by adb forward --list.
+type ForwardEntry struct {
+	Serial string
+	// Local is the socket on the host, e.g. "tcp:8080".
+	Local string
+	// Remote is the socket on the device, e.g. "tcp:8080" or "localabstract:chrome_devtools_remote".
+	Remote string
+}
+
+func (e ForwardEntry) String() string {
+	return fmt.Sprintf("%s %s %s", e.Serial, e.Local, e.Remote)
+}
+
+/*
+ListForwards returns the port forwards of all devices.
+
+Corresponds to the command:
+
+	adb forward --list
+*/
+func (c *Adb) ListForwards() ([]ForwardEntry, error) {
+	resp, err := roundTripSingleResponse(c.server, "host:list-forward")
+	if err != nil {
+		return nil, wrapClientError(err, c, "ListForwards")
+	}
+	forwards, err := parseForwardList(string(resp))
+	return forwards, wrapClientError(err, c, "ListForwards")
+}
+
+/*
+EnsureForwards adds and removes port forwards so the forwards of all devices are exactly
+desired. Forwards that already exist are left alone, so calling it again with the same entries
+does nothing.
+
+Forwards that aren't desired are removed before the missing ones are added, so a local socket
+can be moved to another device or remote socket. If an error occurs, the forwards that were
+changed before it are left changed.
+*/
+func (c *Adb) EnsureForwards(desired []ForwardEntry) error {
+	if err := validateForwards(desired); err != nil {
+		return wrapClientError(err, c, "EnsureForwards")
+	}
+	current, err := c.ListForwards()
+	if err != nil {
+		return wrapClientError(err, c, "EnsureForwards")
+	}
+
+	add, remove := diffForwards(current, desired)
+	for _, entry := range remove {
+		if err := c.forwardRequest(entry.Serial, "killforward:"+entry.Local); err != nil {
+			return wrapClientError(err, c, "EnsureForwards(remove %s)", entry)
+		}
+	}
+	for _, entry := range add {
+		if err := c.forwardRequest(entry.Serial, "forward:"+entry.Local+";"+entry.Remote); err != nil {
+			return wrapClientError(err, c, "EnsureForwards(add %s)", entry)
+		}
+	}
+	return nil
+}
+
+// forwardRequest sends a forward or killforward request for the device with serial. The server
+// acknowledges the request, then sends a second status once the forward has been changed.
+func (c *Adb) forwardRequest(serial, req string) error {
+	conn, err := c.server.Dial()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	req = fmt.Sprintf("host-serial:%s:%s", serial, req)
+	if err = wire.SendMessageString(conn, req); err != nil {
+		return err
+	}
+	if _, err = conn.ReadStatus(req); err != nil {
+		return err
+	}
+	_, err = conn.ReadStatus(req)
+	return err
+}
+
+// validateForwards checks that every entry is complete, and that no local socket is forwarded
+// to more than one place.
+func validateForwards(entries []ForwardEntry) error {
+	locals := make(map[string]ForwardEntry)
+	for _, entry := range entries {
+		if entry.Serial == "" || entry.Local == "" || entry.Remote == "" {
+			return errors.AssertionErrorf("incomplete forward: %+v", entry)
+		}
+		if other, ok := locals[entry.Local]; ok && other != entry {
+			return errors.AssertionErrorf("conflicting forwards for %s: %s and %s", entry.Local, other, entry)
+		}
+		locals[entry.Local] = entry
+	}
+	return nil
+}
+
+// diffForwards returns the entries in desired that aren't in current, and the entries in
+// current that aren't in desired.
+func diffForwards(current, desired []ForwardEntry) (add, remove []ForwardEntry) {
+	currentSet := make(map[ForwardEntry]bool)
+	for _, entry := range current {
+		currentSet[entry] = true
+	}
+	desiredSet := make(map[ForwardEntry]bool)
+	for _, entry := range desired {
+		if !desiredSet[entry] && !currentSet[entry] {
+			add = append(add, entry)
+		}
+		desiredSet[entry] = true
+	}
+	for _, entry := range current {
+		if !desiredSet[entry] {
+			remove = append(remove, entry)
+		}
+	}
+	return add, remove
+}
+
+// parseForwardList parses the response to host:list-forward.
+func parseForwardList(list string) ([]ForwardEntry, error) {
+	parsed, err := parse.ForwardList(list)
+	if err != nil {
+		return nil, err
+	}
+	var forwards []ForwardEntry
+	for _, forward := range parsed {
+		forwards = append(forwards, ForwardEntry(forward))
+	}
+	return forwards, nil
+}
@@ -0,0 +1,68 @@
+package adb
+
+import (
+	"testing"
+
+	"github.com/mqhack/goadb/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseForwardList(t *testing.T) {
+	forwards, err := parseForwardList("SERIAL1 tcp:8080 tcp:80\nSERIAL2 tcp:9222 localabstract:chrome_devtools_remote\n")
+	require.NoError(t, err)
+	assert.Equal(t, []ForwardEntry{
+		{"SERIAL1", "tcp:8080", "tcp:80"},
+		{"SERIAL2", "tcp:9222", "localabstract:chrome_devtools_remote"},
+	}, forwards)
+
+	forwards, err = parseForwardList("")
+	require.NoError(t, err)
+	assert.Empty(t, forwards)
+
+	_, err = parseForwardList("SERIAL1 tcp:8080\n")
+	assert.True(t, HasErrCode(err, ParseError))
+}
+
+func TestEnsureForwards(t *testing.T) {
+	s := &MockServer{
+		Status:   wire.StatusSuccess,
+		Messages: []string{"SERIAL tcp:8080 tcp:80\nSERIAL tcp:9000 tcp:9000\n"},
+	}
+	client := &Adb{server: s}
+
+	err := client.EnsureForwards([]ForwardEntry{
+		{"SERIAL", "tcp:8080", "tcp:80"},
+		{"SERIAL", "tcp:9222", "localabstract:chrome_devtools_remote"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"host:list-forward",
+		"host-serial:SERIAL:killforward:tcp:9000",
+		"host-serial:SERIAL:forward:tcp:9222;localabstract:chrome_devtools_remote",
+	}, s.Requests)
+}
+
+func TestEnsureForwardsConflict(t *testing.T) {
+	s := &MockServer{Status: wire.StatusSuccess}
+	client := &Adb{server: s}
+
+	err := client.EnsureForwards([]ForwardEntry{
+		{"SERIAL", "tcp:8080", "tcp:80"},
+		{"OTHER", "tcp:8080", "tcp:80"},
+	})
+	assert.True(t, HasErrCode(err, AssertionError))
+	assert.Empty(t, s.Requests)
+}
+
+func TestDiffForwards(t *testing.T) {
+	a := ForwardEntry{"SERIAL", "tcp:1", "tcp:1"}
+	b := ForwardEntry{"SERIAL", "tcp:2", "tcp:2"}
+	add, remove := diffForwards([]ForwardEntry{a}, []ForwardEntry{a, b, b})
+	assert.Equal(t, []ForwardEntry{b}, add)
+	assert.Empty(t, remove)
+
+	add, remove = diffForwards([]ForwardEntry{a, b}, nil)
+	assert.Empty(t, add)
+	assert.Equal(t, []ForwardEntry{a, b}, remove)
+}
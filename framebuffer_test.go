@@ -0,0 +1,78 @@
+package adb
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/mqhack/goadb/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func framebufferData(fields ...uint32) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, fields)
+	return buf.Bytes()
+}
+
+func TestReadFramebufferVersion1(t *testing.T) {
+	// RGBA_8888: red, blue, green and alpha offsets and lengths.
+	data := framebufferData(1, 32, 8, 2, 1, 0, 8, 16, 8, 8, 8, 24, 8)
+	data = append(data, 1, 2, 3, 4, 5, 6, 7, 8)
+
+	img, err := readFramebuffer(bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 2, 1), img.Bounds())
+	assert.Equal(t, color.NRGBA{1, 2, 3, 4}, img.At(0, 0))
+	assert.Equal(t, color.NRGBA{5, 6, 7, 8}, img.At(1, 0))
+}
+
+func TestReadFramebufferVersion2(t *testing.T) {
+	// RGBX_8888 with a color space, and no alpha.
+	data := framebufferData(2, 32, 0, 4, 1, 1, 0, 8, 16, 8, 8, 8, 24, 0)
+	data = append(data, 10, 20, 30, 0)
+
+	img, err := readFramebuffer(bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, color.NRGBA{10, 20, 30, 0xff}, img.At(0, 0))
+}
+
+func TestReadFramebufferLegacy(t *testing.T) {
+	data := framebufferData(16, 4, 2, 1)
+	// Pure red, then pure green.
+	data = append(data, 0x00, 0xf8, 0xe0, 0x07)
+
+	img, err := readFramebuffer(bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, color.NRGBA{0xff, 0, 0, 0xff}, img.At(0, 0))
+	assert.Equal(t, color.NRGBA{0, 0xff, 0, 0xff}, img.At(1, 0))
+}
+
+func TestReadFramebufferErrors(t *testing.T) {
+	_, err := readFramebuffer(bytes.NewReader(framebufferData(3)))
+	assert.EqualError(t, err, "ParseError: unsupported framebuffer version 3")
+
+	_, err = readFramebuffer(bytes.NewReader(framebufferData(16, 5, 2, 1)))
+	assert.EqualError(t, err, "ParseError: framebuffer size 5 doesn't match 2x1 image at 16 bpp")
+
+	_, err = readFramebuffer(bytes.NewReader(framebufferData(16, 32768*32768*2, 32768, 32768)))
+	assert.EqualError(t, err, "ParseError: framebuffer size 2147483648 is larger than the maximum of 132710400")
+}
+
+func TestFramebuffer(t *testing.T) {
+	data := append(framebufferData(16, 2, 1, 1), 0x1f, 0x00)
+	s := &MockServer{
+		Status:   wire.StatusSuccess,
+		Messages: []string{string(data)},
+	}
+	device := (&Adb{server: s}).Device(AnyDevice())
+
+	img, err := device.Framebuffer(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, color.NRGBA{0, 0, 0xff, 0xff}, img.At(0, 0))
+	assert.Equal(t, []string{"host:transport-any", "framebuffer:"}, s.Requests)
+}
@@ -0,0 +1,88 @@
+package adb
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/mqhack/goadb/internal/errors"
+	"github.com/mqhack/goadb/wire"
+)
+
+/*
+Remove removes the file or empty directory at path on the device, like os.Remove.
+
+Like the other file system mutations, it runs a shell command, and translates the errors it
+prints into codes: FileNoExistError, PermissionDenied, ReadOnlyFileSystem, FileExistError, or
+AdbError for any other error.
+*/
+func (c *Device) Remove(path string) error {
+	quoted := shellQuote(path)
+	err := c.mutateFS("if [ -d " + quoted + " ] && [ ! -L " + quoted + " ]; then rmdir " + quoted +
+		"; else rm " + quoted + "; fi")
+	return wrapClientError(err, c, "Remove(%s)", path)
+}
+
+// RemoveAll removes path on the device and everything it contains, like os.RemoveAll. It
+// returns nil if path doesn't exist.
+func (c *Device) RemoveAll(path string) error {
+	return wrapClientError(c.mutateFS("rm -rf "+shellQuote(path)), c, "RemoveAll(%s)", path)
+}
+
+// Mkdir creates a directory at path on the device with the permission bits of perm, like
+// os.Mkdir. The error has code FileExistError if path already exists.
+func (c *Device) Mkdir(path string, perm os.FileMode) error {
+	err := c.mutateFS(fmt.Sprintf("mkdir -m %04o %s", perm.Perm(), shellQuote(path)))
+	return wrapClientError(err, c, "Mkdir(%s)", path)
+}
+
+// MkdirAll creates a directory at path on the device, and any parents it needs, like
+// os.MkdirAll. Only the directory at path gets the permission bits of perm; parents get the
+// device's defaults. It returns nil if path is already a directory.
+func (c *Device) MkdirAll(path string, perm os.FileMode) error {
+	err := c.mutateFS(fmt.Sprintf("mkdir -p -m %04o %s", perm.Perm(), shellQuote(path)))
+	return wrapClientError(err, c, "MkdirAll(%s)", path)
+}
+
+// Rename renames oldpath to newpath on the device, replacing newpath if it's a file. Like mv,
+// if newpath is a directory, oldpath is moved into it.
+func (c *Device) Rename(oldpath, newpath string) error {
+	err := c.mutateFS("mv -f " + shellQuote(oldpath) + " " + shellQuote(newpath))
+	return wrapClientError(err, c, "Rename(%s, %s)", oldpath, newpath)
+}
+
+// Chmod sets the permission, setuid, setgid and sticky bits of the file at path on the device to
+// those of mode.
+func (c *Device) Chmod(path string, mode os.FileMode) error {
+	err := c.mutateFS(fmt.Sprintf("chmod %04o %s", wire.FileModeToAdb(mode)&07777, shellQuote(path)))
+	return wrapClientError(err, c, "Chmod(%s)", path)
+}
+
+// mutateFS runs cmd, which prints nothing if it succeeds, and returns the error it printed.
+func (c *Device) mutateFS(cmd string) error {
+	output, err := c.RunCommand(cmd + " </dev/null 2>&1")
+	if err != nil {
+		return err
+	}
+	if output = strings.TrimSpace(output); output != "" {
+		return errors.Errorf(fsErrorCode(output), "%s", output)
+	}
+	return nil
+}
+
+// fsErrorCode returns the code of the error a file system command printed.
+func fsErrorCode(output string) errors.ErrCode {
+	output = strings.ToLower(output)
+	switch {
+	case strings.Contains(output, "no such file"):
+		return errors.FileNoExistError
+	case strings.Contains(output, "permission denied"), strings.Contains(output, "operation not permitted"):
+		return errors.PermissionDenied
+	case strings.Contains(output, "read-only file system"):
+		return errors.ReadOnlyFileSystem
+	case strings.Contains(output, "file exists"):
+		return errors.FileExistError
+	default:
+		return errors.AdbError
+	}
+}
@@ -0,0 +1,48 @@
+package adb
+
+import (
+	"os"
+	"testing"
+
+	"github.com/mqhack/goadb/wire"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRemove(t *testing.T) {
+	s := &MockServer{Status: wire.StatusSuccess, Messages: []string{""}}
+	assert.NoError(t, (&Adb{server: s}).Device(AnyDevice()).Remove("/sdcard/a b"))
+	assert.Equal(t, "shell:if [ -d '/sdcard/a b' ] && [ ! -L '/sdcard/a b' ]; then rmdir '/sdcard/a b'; "+
+		"else rm '/sdcard/a b'; fi </dev/null 2>&1", s.Requests[1])
+}
+
+func TestMkdirAll(t *testing.T) {
+	s := &MockServer{Status: wire.StatusSuccess, Messages: []string{""}}
+	assert.NoError(t, (&Adb{server: s}).Device(AnyDevice()).MkdirAll("/sdcard/a/b", 0750))
+	assert.Equal(t, "shell:mkdir -p -m 0750 '/sdcard/a/b' </dev/null 2>&1", s.Requests[1])
+}
+
+func TestChmod(t *testing.T) {
+	s := &MockServer{Status: wire.StatusSuccess, Messages: []string{""}}
+	assert.NoError(t, (&Adb{server: s}).Device(AnyDevice()).Chmod("/sdcard/a", 0644))
+	assert.Equal(t, "shell:chmod 0644 '/sdcard/a' </dev/null 2>&1", s.Requests[1])
+
+	s = &MockServer{Status: wire.StatusSuccess, Messages: []string{""}}
+	assert.NoError(t, (&Adb{server: s}).Device(AnyDevice()).Chmod("/data/local/tmp", os.ModeDir|os.ModeSticky|0777))
+	assert.Equal(t, "shell:chmod 1777 '/data/local/tmp' </dev/null 2>&1", s.Requests[1])
+}
+
+func TestFSMutationErrors(t *testing.T) {
+	for output, code := range map[string]ErrCode{
+		"rm: /sdcard/a: No such file or directory":       FileNoExistError,
+		"mkdir: '/data/x': Permission denied":            PermissionDenied,
+		"chmod: /system/bin/sh: Operation not permitted": PermissionDenied,
+		"mv: /system/a: Read-only file system":           ReadOnlyFileSystem,
+		"mkdir: '/sdcard/a': File exists":                FileExistError,
+		"rmdir: /sdcard/a: Directory not empty":          AdbError,
+	} {
+		s := &MockServer{Status: wire.StatusSuccess, Messages: []string{output + "\r\n"}}
+		err := (&Adb{server: s}).Device(AnyDevice()).Rename("/sdcard/a", "/sdcard/b")
+		assert.True(t, HasErrCode(err, code), "%s: %v", output, err)
+		assert.Contains(t, ErrorWithCauseChain(err), output)
+	}
+}
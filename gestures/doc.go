@@ -0,0 +1,19 @@
+/*
+Package gestures synthesizes multitouch gestures on Android devices, like pinches and
+two-finger swipes, which the input command can't perform.
+
+	screen, err := gestures.FindTouchscreen(device)
+	err = gestures.Perform(device, screen, gestures.Pinch(gestures.Point{X: 0.5, Y: 0.5}, 0.1, 0.3, 500*time.Millisecond))
+
+Gestures are performed by writing raw events to the touchscreen's input device, as if they
+came from the hardware. The touchscreen is found with getevent, which also reports whether it
+uses the slotted (type B) or anonymous (type A) multitouch protocol, and the range of its
+coordinates. Points are given as fractions of the touchscreen's width and height, in the
+display's natural orientation, so they don't depend on its resolution.
+
+The events of a gesture are pushed to the device with a script that writes them a frame at a
+time, so the gesture's timing doesn't depend on the connection. Requires a device running
+Android M or later, and a build that lets the shell user write to /dev/input, which includes
+userdebug builds and most emulators.
+*/
+package gestures
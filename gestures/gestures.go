@@ -0,0 +1,415 @@
+package gestures
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mqhack/goadb/internal/errors"
+	"github.com/mqhack/goadb/wire"
+)
+
+// ScriptPath is where gesture scripts are pushed to on the device, and EventsPath where the
+// events they write are.
+const (
+	ScriptPath = "/data/local/tmp/goadb-gesture.sh"
+	EventsPath = "/data/local/tmp/goadb-gesture.events"
+)
+
+// FrameInterval is how often pointers are moved during a gesture.
+const FrameInterval = 16 * time.Millisecond
+
+// Event types and codes, from linux/input-event-codes.h.
+const (
+	evSyn = 0x00
+	evKey = 0x01
+	evAbs = 0x03
+
+	synReport   = 0x00
+	synMTReport = 0x02
+
+	btnTouch = 0x14a
+
+	absMTSlot       = 0x2f
+	absMTTouchMajor = 0x30
+	absMTPositionX  = 0x35
+	absMTPositionY  = 0x36
+	absMTTrackingID = 0x39
+	absMTPressure   = 0x3a
+)
+
+// Device is the part of *adb.Device that gestures need.
+type Device interface {
+	OpenWrite(path string, perms os.FileMode, mtime time.Time) (io.WriteCloser, error)
+	RunCommand(cmd string, args ...string) (string, error)
+}
+
+// Touchscreen is a multitouch input device, as reported by getevent.
+type Touchscreen struct {
+	// Path is the device node, e.g. "/dev/input/event2".
+	Path string
+	Name string
+
+	// The range of the touchscreen's coordinates.
+	MinX, MaxX int
+	MinY, MaxY int
+
+	// Slots is the number of pointers the touchscreen can track with the slotted (type B)
+	// protocol, or zero if it uses the anonymous (type A) protocol.
+	Slots int
+	// MaxPressure and MaxTouchMajor are the maximum values of ABS_MT_PRESSURE and
+	// ABS_MT_TOUCH_MAJOR, or zero if the touchscreen doesn't report them.
+	MaxPressure   int
+	MaxTouchMajor int
+	HasTrackingID bool
+
+	// EventSize is the size of the struct input_event the device's shell writes: 24 bytes on
+	// 64-bit builds, and 16 on 32-bit ones. If it's zero, Perform reads it from the device.
+	EventSize int
+}
+
+// Point is a position on the touchscreen, as fractions of its width and height, from 0 to 1.
+type Point struct {
+	X, Y float64
+}
+
+// Pointer is a finger that touches the screen at the first point of Path, moves through the
+// rest of the points at a constant speed, and lifts at the last.
+type Pointer struct {
+	Path []Point
+}
+
+// Gesture is a set of pointers that touch the screen at the same time, and move for Duration.
+type Gesture struct {
+	Pointers []Pointer
+	Duration time.Duration
+}
+
+// Swipe is a gesture where fingers fingers, spaced spacing apart horizontally, move together
+// from from to to.
+func Swipe(from, to Point, fingers int, spacing float64, duration time.Duration) Gesture {
+	gesture := Gesture{Duration: duration}
+	for i := 0; i < fingers; i++ {
+		offset := (float64(i) - float64(fingers-1)/2) * spacing
+		gesture.Pointers = append(gesture.Pointers, Pointer{Path: []Point{
+			{from.X + offset, from.Y},
+			{to.X + offset, to.Y},
+		}})
+	}
+	return gesture
+}
+
+// Pinch is a gesture where two fingers on opposite sides of center move from fromRadius to
+// toRadius from it. It zooms in if toRadius is larger, and out if it's smaller.
+func Pinch(center Point, fromRadius, toRadius float64, duration time.Duration) Gesture {
+	return Gesture{
+		Pointers: []Pointer{
+			{Path: []Point{{center.X - fromRadius, center.Y}, {center.X - toRadius, center.Y}}},
+			{Path: []Point{{center.X + fromRadius, center.Y}, {center.X + toRadius, center.Y}}},
+		},
+		Duration: duration,
+	}
+}
+
+// Matches the first line of a device in getevent -p output, e.g. "add device 1: /dev/input/event2".
+var geteventDevicePattern = regexp.MustCompile(`^add device \d+: (\S+)$`)
+
+// Matches an axis in getevent -p output, e.g. "0035  : value 0, min 0, max 1079, ...", which
+// may follow the "ABS (0003):" heading on the same line.
+var geteventAxisPattern = regexp.MustCompile(`([0-9a-f]{4})\s+: value -?\d+, min (-?\d+), max (-?\d+)`)
+
+/*
+FindTouchscreen returns the first input device that reports multitouch positions.
+
+Corresponds to the command:
+
+	adb shell getevent -p
+*/
+func FindTouchscreen(device Device) (*Touchscreen, error) {
+	output, err := device.RunCommand("getevent", "-p")
+	if err != nil {
+		return nil, errors.WrapAnyErrf(err, errors.NetworkError, "error listing input devices")
+	}
+	screen, err := parseGeteventDevices(output)
+	if err != nil {
+		return nil, err
+	}
+	if screen.EventSize, err = getEventSize(device); err != nil {
+		return nil, err
+	}
+	return screen, nil
+}
+
+// getEventSize returns the size of struct input_event for the device's ABI. The kernel expects
+// the layout of the process that writes the events, so a 64-bit kernel running 32-bit builds
+// expects the 32-bit layout.
+func getEventSize(device Device) (int, error) {
+	abi, err := device.RunCommand("getprop", "ro.product.cpu.abi")
+	if err != nil {
+		return 0, errors.WrapAnyErrf(err, errors.NetworkError, "error reading device ABI")
+	}
+	if strings.Contains(abi, "64") {
+		return 24, nil
+	}
+	return 16, nil
+}
+
+func parseGeteventDevices(output string) (*Touchscreen, error) {
+	var current *Touchscreen
+	var hasX, hasY bool
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if match := geteventDevicePattern.FindStringSubmatch(line); match != nil {
+			if current != nil && hasX && hasY {
+				return current, nil
+			}
+			current, hasX, hasY = &Touchscreen{Path: match[1]}, false, false
+			continue
+		}
+		if current == nil {
+			continue
+		}
+		if name := strings.TrimPrefix(line, "name:"); name != line {
+			current.Name = strings.Trim(strings.TrimSpace(name), `"`)
+			continue
+		}
+		match := geteventAxisPattern.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		code, _ := strconv.ParseInt(match[1], 16, 32)
+		minValue, _ := strconv.Atoi(match[2])
+		maxValue, _ := strconv.Atoi(match[3])
+		switch code {
+		case absMTPositionX:
+			current.MinX, current.MaxX, hasX = minValue, maxValue, true
+		case absMTPositionY:
+			current.MinY, current.MaxY, hasY = minValue, maxValue, true
+		case absMTSlot:
+			current.Slots = maxValue + 1
+		case absMTTrackingID:
+			current.HasTrackingID = true
+		case absMTPressure:
+			current.MaxPressure = maxValue
+		case absMTTouchMajor:
+			current.MaxTouchMajor = maxValue
+		}
+	}
+	if current != nil && hasX && hasY {
+		return current, nil
+	}
+	return nil, errors.Errorf(errors.RequirementNotMet, "no multitouch input device found")
+}
+
+/*
+Perform performs gesture on screen, and returns once it has finished.
+*/
+func Perform(device Device, screen *Touchscreen, gesture Gesture) error {
+	if screen.EventSize == 0 {
+		size, err := getEventSize(device)
+		if err != nil {
+			return err
+		}
+		withSize := *screen
+		withSize.EventSize = size
+		screen = &withSize
+	}
+	script, events, err := gestureScript(screen, gesture)
+	if err != nil {
+		return err
+	}
+
+	if err := push(device, EventsPath, events); err != nil {
+		return err
+	}
+	if err := push(device, ScriptPath, []byte(script)); err != nil {
+		return err
+	}
+
+	output, err := device.RunCommand("sh", ScriptPath)
+	if err != nil {
+		return errors.WrapAnyErrf(err, errors.NetworkError, "error performing gesture")
+	}
+	if output = strings.TrimSpace(output); output != "" {
+		return errors.Errorf(errors.AdbError, "error performing gesture: %s", output)
+	}
+	return nil
+}
+
+// push writes data to path on the device.
+func push(device Device, path string, data []byte) error {
+	w, err := device.OpenWrite(path, wire.DefaultFilePerms, time.Time{})
+	if err != nil {
+		return errors.WrapAnyErrf(err, errors.NetworkError, "error pushing %s", path)
+	}
+	if _, err := w.Write(data); err != nil {
+		w.Close()
+		return errors.WrapAnyErrf(err, errors.NetworkError, "error pushing %s", path)
+	}
+	if err := w.Close(); err != nil {
+		return errors.WrapAnyErrf(err, errors.NetworkError, "error pushing %s", path)
+	}
+	return nil
+}
+
+/*
+gestureScript returns the events of gesture on screen, and a shell script that writes them to
+screen from EventsPath. Each frame moves every pointer, then sleeps for FrameInterval.
+
+The events of a frame are written by a single dd, rather than a sendevent per event, so
+starting processes doesn't slow the gesture down, or split a frame's events over several
+milliseconds.
+*/
+func gestureScript(screen *Touchscreen, gesture Gesture) (string, []byte, error) {
+	if len(gesture.Pointers) == 0 {
+		return "", nil, errors.AssertionErrorf("gesture has no pointers")
+	}
+	if screen.Slots > 0 && len(gesture.Pointers) > screen.Slots {
+		return "", nil, errors.Errorf(errors.RequirementNotMet,
+			"gesture has %d pointers, but %s only tracks %d", len(gesture.Pointers), screen.Path, screen.Slots)
+	}
+	for i, pointer := range gesture.Pointers {
+		if len(pointer.Path) == 0 {
+			return "", nil, errors.AssertionErrorf("pointer %d has no path", i)
+		}
+	}
+
+	frames := int(gesture.Duration / FrameInterval)
+	if frames < 1 {
+		frames = 1
+	}
+	sleep := strconv.FormatFloat(FrameInterval.Seconds(), 'f', -1, 64)
+
+	s := &scriptWriter{screen: screen}
+	// The device is opened once, so a failure to open it is reported on the first line.
+	s.line("exec 3>" + screen.Path)
+	for frame := 0; frame <= frames; frame++ {
+		t := float64(frame) / float64(frames)
+		for i, pointer := range gesture.Pointers {
+			x, y := screen.coordinates(pointer.at(t))
+			s.pointer(i, x, y, frame == 0)
+		}
+		if frame == 0 {
+			s.event(evKey, btnTouch, 1)
+		}
+		s.event(evSyn, synReport, 0)
+		if frame < frames {
+			s.flush()
+			s.line("sleep " + sleep)
+		}
+	}
+	s.up(len(gesture.Pointers))
+	s.flush()
+	return s.String(), s.events.Bytes(), nil
+}
+
+// at returns the position of the pointer at t, from 0 at the start of the gesture to 1 at
+// the end.
+func (p Pointer) at(t float64) Point {
+	if len(p.Path) == 1 || t <= 0 {
+		return p.Path[0]
+	}
+	if t >= 1 {
+		return p.Path[len(p.Path)-1]
+	}
+	segment := t * float64(len(p.Path)-1)
+	i := int(segment)
+	f := segment - float64(i)
+	from, to := p.Path[i], p.Path[i+1]
+	return Point{from.X + (to.X-from.X)*f, from.Y + (to.Y-from.Y)*f}
+}
+
+// coordinates converts p to the touchscreen's coordinates, clamping it to the screen.
+func (s *Touchscreen) coordinates(p Point) (int, int) {
+	clamp := func(v float64) float64 { return math.Max(0, math.Min(1, v)) }
+	x := s.MinX + int(math.Round(clamp(p.X)*float64(s.MaxX-s.MinX)))
+	y := s.MinY + int(math.Round(clamp(p.Y)*float64(s.MaxY-s.MinY)))
+	return x, y
+}
+
+type scriptWriter struct {
+	strings.Builder
+	screen *Touchscreen
+
+	// The events written so far, and how many of them the script writes already.
+	events  bytes.Buffer
+	count   int
+	written int
+}
+
+func (s *scriptWriter) line(line string) {
+	s.WriteString(line)
+	s.WriteByte('\n')
+}
+
+// event appends an event to the events, with a zero timestamp, which the kernel replaces.
+func (s *scriptWriter) event(typ, code, value int) {
+	s.events.Write(make([]byte, s.screen.EventSize-8))
+	var fields [8]byte
+	binary.LittleEndian.PutUint16(fields[0:], uint16(typ))
+	binary.LittleEndian.PutUint16(fields[2:], uint16(code))
+	binary.LittleEndian.PutUint32(fields[4:], uint32(int32(value)))
+	s.events.Write(fields[:])
+	s.count++
+}
+
+// flush writes the events that haven't been written yet to the device. dd writes a block at a
+// time, so each event is a separate write, like sendevent does.
+func (s *scriptWriter) flush() {
+	if s.count == s.written {
+		return
+	}
+	s.line(fmt.Sprintf("dd if=%s bs=%d skip=%d count=%d >&3 2>/dev/null",
+		EventsPath, s.screen.EventSize, s.written, s.count-s.written))
+	s.written = s.count
+}
+
+// pointer writes the position of pointer i. With the slotted protocol, only the first
+// position includes the pointer's tracking ID and contact size; with the anonymous protocol,
+// every position does.
+func (s *scriptWriter) pointer(i, x, y int, down bool) {
+	slotted := s.screen.Slots > 0
+	if slotted {
+		s.event(evAbs, absMTSlot, i)
+	}
+	if (down || !slotted) && (slotted || s.screen.HasTrackingID) {
+		s.event(evAbs, absMTTrackingID, i)
+	}
+	s.event(evAbs, absMTPositionX, x)
+	s.event(evAbs, absMTPositionY, y)
+	if down || !slotted {
+		if s.screen.MaxTouchMajor > 0 {
+			s.event(evAbs, absMTTouchMajor, (s.screen.MaxTouchMajor+1)/2)
+		}
+		if s.screen.MaxPressure > 0 {
+			s.event(evAbs, absMTPressure, (s.screen.MaxPressure+1)/2)
+		}
+	}
+	if !slotted {
+		s.event(evSyn, synMTReport, 0)
+	}
+}
+
+// up lifts all the pointers. With the slotted protocol, each slot's tracking ID is cleared;
+// with the anonymous protocol, a frame with no pointers is sent.
+func (s *scriptWriter) up(pointers int) {
+	if s.screen.Slots > 0 {
+		for i := 0; i < pointers; i++ {
+			s.event(evAbs, absMTSlot, i)
+			s.event(evAbs, absMTTrackingID, -1)
+		}
+	} else {
+		s.event(evSyn, synMTReport, 0)
+	}
+	s.event(evKey, btnTouch, 0)
+	s.event(evSyn, synReport, 0)
+}
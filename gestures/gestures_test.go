@@ -0,0 +1,171 @@
+package gestures
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	adb "github.com/mqhack/goadb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var _ Device = (*adb.Device)(nil)
+
+type MockDevice struct {
+	// Output is the output of commands that aren't in Outputs.
+	Output   string
+	Outputs  map[string]string
+	Files    map[string][]byte
+	Commands []string
+}
+
+type fileWriter struct {
+	bytes.Buffer
+	d    *MockDevice
+	path string
+}
+
+func (w *fileWriter) Close() error {
+	w.d.Files[w.path] = w.Bytes()
+	return nil
+}
+
+func (d *MockDevice) OpenWrite(path string, perms os.FileMode, mtime time.Time) (io.WriteCloser, error) {
+	if d.Files == nil {
+		d.Files = make(map[string][]byte)
+	}
+	return &fileWriter{d: d, path: path}, nil
+}
+
+func (d *MockDevice) RunCommand(cmd string, args ...string) (string, error) {
+	line := strings.Join(append([]string{cmd}, args...), " ")
+	d.Commands = append(d.Commands, line)
+	if output, ok := d.Outputs[line]; ok {
+		return output, nil
+	}
+	return d.Output, nil
+}
+
+const geteventOutput = `add device 1: /dev/input/event1
+  name:     "gpio-keys"
+  events:
+    KEY (0001): 0072  0073  0074
+  input props:
+    <none>
+add device 2: /dev/input/event2
+  name:     "sec_touchscreen"
+  events:
+    KEY (0001): 014a
+    ABS (0003): 002f  : value 0, min 0, max 9, fuzz 0, flat 0, resolution 0
+                0030  : value 0, min 0, max 255, fuzz 0, flat 0, resolution 0
+                0035  : value 0, min 0, max 1079, fuzz 0, flat 0, resolution 0
+                0036  : value 0, min 0, max 2399, fuzz 0, flat 0, resolution 0
+                0039  : value 0, min 0, max 65535, fuzz 0, flat 0, resolution 0
+  input props:
+    INPUT_PROP_DIRECT
+`
+
+func TestFindTouchscreen(t *testing.T) {
+	device := &MockDevice{Output: geteventOutput, Outputs: map[string]string{"getprop ro.product.cpu.abi": "armeabi-v7a\n"}}
+
+	screen, err := FindTouchscreen(device)
+	require.NoError(t, err)
+	assert.Equal(t, &Touchscreen{
+		Path:          "/dev/input/event2",
+		Name:          "sec_touchscreen",
+		MaxX:          1079,
+		MaxY:          2399,
+		Slots:         10,
+		MaxTouchMajor: 255,
+		HasTrackingID: true,
+		EventSize:     16,
+	}, screen)
+	assert.Equal(t, []string{"getevent -p", "getprop ro.product.cpu.abi"}, device.Commands)
+
+	_, err = parseGeteventDevices("add device 1: /dev/input/event1\n  name:     \"gpio-keys\"\n")
+	assert.EqualError(t, err, "RequirementNotMet: no multitouch input device found")
+}
+
+// decodeEvents returns the type, code and value of each event in events, like sendevent's
+// arguments.
+func decodeEvents(t *testing.T, events []byte, size int) []string {
+	require.Zero(t, len(events)%size)
+	var decoded []string
+	for ; len(events) > 0; events = events[size:] {
+		event := events[size-8 : size]
+		decoded = append(decoded, fmt.Sprintf("%d %d %d", binary.LittleEndian.Uint16(event[0:]),
+			binary.LittleEndian.Uint16(event[2:]), int32(binary.LittleEndian.Uint32(event[4:]))))
+	}
+	return decoded
+}
+
+func TestGestureScriptSlotted(t *testing.T) {
+	screen := &Touchscreen{Path: "/dev/input/event2", MaxX: 1000, MaxY: 2000, Slots: 10, HasTrackingID: true, EventSize: 24}
+
+	script, events, err := gestureScript(screen, Pinch(Point{0.5, 0.5}, 0.1, 0.2, FrameInterval))
+	require.NoError(t, err)
+	assert.Equal(t, `exec 3>/dev/input/event2
+dd if=/data/local/tmp/goadb-gesture.events bs=24 skip=0 count=10 >&3 2>/dev/null
+sleep 0.016
+dd if=/data/local/tmp/goadb-gesture.events bs=24 skip=10 count=13 >&3 2>/dev/null
+`, script)
+	assert.Equal(t, []string{
+		"3 47 0", "3 57 0", "3 53 400", "3 54 1000",
+		"3 47 1", "3 57 1", "3 53 600", "3 54 1000",
+		"1 330 1", "0 0 0",
+		"3 47 0", "3 53 300", "3 54 1000",
+		"3 47 1", "3 53 700", "3 54 1000",
+		"0 0 0",
+		"3 47 0", "3 57 -1", "3 47 1", "3 57 -1",
+		"1 330 0", "0 0 0",
+	}, decodeEvents(t, events, 24))
+}
+
+func TestGestureScriptAnonymous(t *testing.T) {
+	screen := &Touchscreen{Path: "/dev/input/event0", MaxX: 100, MaxY: 100, EventSize: 16}
+
+	script, events, err := gestureScript(screen, Gesture{Pointers: []Pointer{{Path: []Point{{0.5, 0.25}}}}})
+	require.NoError(t, err)
+	assert.Equal(t, `exec 3>/dev/input/event0
+dd if=/data/local/tmp/goadb-gesture.events bs=16 skip=0 count=5 >&3 2>/dev/null
+sleep 0.016
+dd if=/data/local/tmp/goadb-gesture.events bs=16 skip=5 count=7 >&3 2>/dev/null
+`, script)
+	assert.Equal(t, []string{
+		"3 53 50", "3 54 25", "0 2 0", "1 330 1", "0 0 0",
+		"3 53 50", "3 54 25", "0 2 0", "0 0 0",
+		"0 2 0", "1 330 0", "0 0 0",
+	}, decodeEvents(t, events, 16))
+}
+
+func TestGestureScriptTooManyPointers(t *testing.T) {
+	screen := &Touchscreen{Path: "/dev/input/event2", MaxX: 1000, MaxY: 2000, Slots: 2}
+
+	_, _, err := gestureScript(screen, Swipe(Point{0.5, 0.8}, Point{0.5, 0.2}, 3, 0.1, time.Second))
+	assert.True(t, adb.HasErrCode(err, adb.RequirementNotMet))
+}
+
+func TestSwipe(t *testing.T) {
+	gesture := Swipe(Point{0.5, 0.8}, Point{0.5, 0.2}, 2, 0.2, time.Second)
+	assert.Equal(t, []Pointer{
+		{Path: []Point{{0.4, 0.8}, {0.4, 0.2}}},
+		{Path: []Point{{0.6, 0.8}, {0.6, 0.2}}},
+	}, gesture.Pointers)
+}
+
+func TestPerform(t *testing.T) {
+	device := &MockDevice{Outputs: map[string]string{"getprop ro.product.cpu.abi": "arm64-v8a\n"}}
+	screen := &Touchscreen{Path: "/dev/input/event2", MaxX: 1000, MaxY: 2000, Slots: 10}
+
+	require.NoError(t, Perform(device, screen, Pinch(Point{0.5, 0.5}, 0.3, 0.1, 100*time.Millisecond)))
+	assert.Equal(t, []string{"getprop ro.product.cpu.abi", "sh " + ScriptPath}, device.Commands)
+	assert.Contains(t, string(device.Files[ScriptPath]), "dd if="+EventsPath+" bs=24 skip=0 count=")
+	assert.Contains(t, decodeEvents(t, device.Files[EventsPath], 24), "1 330 1")
+	assert.Zero(t, screen.EventSize)
+}
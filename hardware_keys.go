@@ -0,0 +1,82 @@
+package adb
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/mqhack/goadb/internal/errors"
+)
+
+// The first API level whose input has the keycombination command (Android 13).
+const keyCombinationAPILevel = 33
+
+// PressHome presses the home button.
+func (c *Device) PressHome() error {
+	return wrapClientError(c.KeyEvent(KeyCodeHome), c, "PressHome")
+}
+
+// PressBack presses the back button.
+func (c *Device) PressBack() error {
+	return wrapClientError(c.KeyEvent(KeyCodeBack), c, "PressBack")
+}
+
+// PressPower presses the power button, which turns the screen off if it's on, and on if it's
+// off. Use WakeUp or Sleep to turn it on or off regardless of its state.
+func (c *Device) PressPower() error {
+	return wrapClientError(c.KeyEvent(KeyCodePower), c, "PressPower")
+}
+
+// PressVolumeUp presses the volume up button.
+func (c *Device) PressVolumeUp() error {
+	return wrapClientError(c.KeyEvent(KeyCodeVolumeUp), c, "PressVolumeUp")
+}
+
+// PressVolumeDown presses the volume down button.
+func (c *Device) PressVolumeDown() error {
+	return wrapClientError(c.KeyEvent(KeyCodeVolumeDown), c, "PressVolumeDown")
+}
+
+// PressAppSwitch presses the recent apps button.
+func (c *Device) PressAppSwitch() error {
+	return wrapClientError(c.KeyEvent(KeyCodeAppSwitch), c, "PressAppSwitch")
+}
+
+/*
+Chord presses codes together, like a person pressing several buttons at once: each key is
+pressed in order, all of them are held for hold, then they're released. For example, power and
+volume down take a screenshot:
+
+	device.Chord(500*time.Millisecond, adb.KeyCodePower, adb.KeyCodeVolumeDown)
+
+If hold is zero, input's default is used. Requires a device running Android 13 or later;
+older versions can't hold keys down, and fail with RequirementNotMet.
+
+Corresponds to the command:
+
+	adb shell input [-d <display>] keycombination [-t hold(ms)] <code>...
+*/
+func (c *Device) Chord(hold time.Duration, codes ...KeyCode) error {
+	if len(codes) < 2 {
+		return wrapClientError(errors.AssertionErrorf("a chord needs at least 2 keys, got %d", len(codes)), c, "Chord")
+	}
+	level, err := c.getProp(PropAPILevel)
+	if err != nil {
+		return wrapClientError(err, c, "Chord")
+	}
+	if atoiOrZero(level) < keyCombinationAPILevel {
+		return wrapClientError(errors.Errorf(errors.RequirementNotMet,
+			"key chords require API level %d, device has %q", keyCombinationAPILevel, level), c, "Chord")
+	}
+	return wrapClientError(c.runInput(keyCombinationArgs(hold, codes)...), c, "Chord")
+}
+
+func keyCombinationArgs(hold time.Duration, codes []KeyCode) []string {
+	args := []string{"keycombination"}
+	if hold > 0 {
+		args = append(args, "-t", strconv.FormatInt(hold.Milliseconds(), 10))
+	}
+	for _, code := range codes {
+		args = append(args, strconv.Itoa(int(code)))
+	}
+	return args
+}
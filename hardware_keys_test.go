@@ -0,0 +1,47 @@
+package adb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mqhack/goadb/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPressKeys(t *testing.T) {
+	for expected, press := range map[string]func(*Device) error{
+		"shell:input keyevent 3":   (*Device).PressHome,
+		"shell:input keyevent 4":   (*Device).PressBack,
+		"shell:input keyevent 26":  (*Device).PressPower,
+		"shell:input keyevent 24":  (*Device).PressVolumeUp,
+		"shell:input keyevent 25":  (*Device).PressVolumeDown,
+		"shell:input keyevent 187": (*Device).PressAppSwitch,
+	} {
+		s := &MockServer{Status: wire.StatusSuccess}
+		require.NoError(t, press((&Adb{server: s}).Device(AnyDevice())), expected)
+		assert.Equal(t, expected, s.Requests[1])
+	}
+}
+
+func TestKeyCombinationArgs(t *testing.T) {
+	assert.Equal(t, []string{"keycombination", "-t", "500", "26", "25"},
+		keyCombinationArgs(500*time.Millisecond, []KeyCode{KeyCodePower, KeyCodeVolumeDown}))
+	assert.Equal(t, []string{"keycombination", "26", "25"},
+		keyCombinationArgs(0, []KeyCode{KeyCodePower, KeyCodeVolumeDown}))
+}
+
+func TestChordRequiresAndroid13(t *testing.T) {
+	s := &MockServer{
+		Status:   wire.StatusSuccess,
+		Messages: []string{"30\n"},
+	}
+	device := (&Adb{server: s}).Device(AnyDevice())
+
+	err := device.Chord(0, KeyCodePower, KeyCodeVolumeDown)
+	assert.True(t, HasErrCode(err, RequirementNotMet))
+	assert.Equal(t, []string{"host:transport-any", "shell:getprop ro.build.version.sdk"}, s.Requests)
+
+	err = device.Chord(0, KeyCodePower)
+	assert.True(t, HasErrCode(err, AssertionError))
+}
@@ -0,0 +1,199 @@
+package adb
+
+import (
+	"image"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mqhack/goadb/internal/errors"
+)
+
+// KeyCode is an Android key code, from android.view.KeyEvent.
+type KeyCode int
+
+const (
+	KeyCodeHome           KeyCode = 3
+	KeyCodeBack           KeyCode = 4
+	KeyCodeCall           KeyCode = 5
+	KeyCodeEndCall        KeyCode = 6
+	KeyCodeDpadUp         KeyCode = 19
+	KeyCodeDpadDown       KeyCode = 20
+	KeyCodeDpadLeft       KeyCode = 21
+	KeyCodeDpadRight      KeyCode = 22
+	KeyCodeDpadCenter     KeyCode = 23
+	KeyCodeVolumeUp       KeyCode = 24
+	KeyCodeVolumeDown     KeyCode = 25
+	KeyCodePower          KeyCode = 26
+	KeyCodeCamera         KeyCode = 27
+	KeyCodeTab            KeyCode = 61
+	KeyCodeSpace          KeyCode = 62
+	KeyCodeEnter          KeyCode = 66
+	KeyCodeDel            KeyCode = 67
+	KeyCodeMenu           KeyCode = 82
+	KeyCodeSearch         KeyCode = 84
+	KeyCodeMediaPlayPause KeyCode = 85
+	KeyCodeMediaNext      KeyCode = 87
+	KeyCodeMediaPrevious  KeyCode = 88
+	KeyCodePageUp         KeyCode = 92
+	KeyCodePageDown       KeyCode = 93
+	KeyCodeEscape         KeyCode = 111
+	KeyCodeForwardDel     KeyCode = 112
+	KeyCodeMoveHome       KeyCode = 122
+	KeyCodeMoveEnd        KeyCode = 123
+	KeyCodeVolumeMute     KeyCode = 164
+	KeyCodeAppSwitch      KeyCode = 187
+	KeyCodeSleep          KeyCode = 223
+	KeyCodeWakeUp         KeyCode = 224
+)
+
+/*
+Tap taps the screen at x, y, in pixels. Like the other input helpers, it taps the display set
+by SetInputDisplay, if there is one.
+
+Corresponds to the command:
+
+	adb shell input [-d <display>] tap <x> <y>
+*/
+func (c *Device) Tap(x, y int) error {
+	return wrapClientError(c.runInput("tap", strconv.Itoa(x), strconv.Itoa(y)), c, "Tap")
+}
+
+/*
+Swipe drags from x1, y1 to x2, y2, in pixels, over duration. If duration is zero, input's
+default is used, which is 300ms on most versions.
+
+Corresponds to the command:
+
+	adb shell input [-d <display>] swipe <x1> <y1> <x2> <y2> [duration(ms)]
+*/
+func (c *Device) Swipe(x1, y1, x2, y2 int, duration time.Duration) error {
+	args := []string{"swipe", strconv.Itoa(x1), strconv.Itoa(y1), strconv.Itoa(x2), strconv.Itoa(y2)}
+	if duration > 0 {
+		args = append(args, strconv.FormatInt(duration.Milliseconds(), 10))
+	}
+	return wrapClientError(c.runInput(args...), c, "Swipe")
+}
+
+// DefaultLongPressDuration is how long LongPress holds by default, comfortably longer than the
+// long press timeout of any Android version.
+const DefaultLongPressDuration = time.Second
+
+// The first API level whose input has the draganddrop command (Android O).
+const dragAndDropAPILevel = 26
+
+/*
+LongPress touches the screen at x, y, in pixels, and holds for duration before lifting. If
+duration is zero, DefaultLongPressDuration is used.
+
+Corresponds to the command:
+
+	adb shell input [-d <display>] swipe <x> <y> <x> <y> <duration(ms)>
+*/
+func (c *Device) LongPress(x, y int, duration time.Duration) error {
+	if duration <= 0 {
+		duration = DefaultLongPressDuration
+	}
+	return wrapClientError(c.Swipe(x, y, x, y, duration), c, "LongPress")
+}
+
+/*
+DragAndDrop long presses from, then moves to to over duration and lifts, which drags the item
+at from, e.g. a launcher icon or a list item that can be reordered. If duration is zero,
+input's default is used.
+
+On Android O and later, this uses input draganddrop, which holds for the long press timeout
+before moving. Older versions can only swipe, which picks up items that start dragging when
+they're touched, but not ones that need a long press first.
+
+Corresponds to the command:
+
+	adb shell input [-d <display>] draganddrop <x1> <y1> <x2> <y2> [duration(ms)]
+*/
+func (c *Device) DragAndDrop(from, to image.Point, duration time.Duration) error {
+	level, err := c.getProp(PropAPILevel)
+	if err != nil {
+		return wrapClientError(err, c, "DragAndDrop")
+	}
+	return wrapClientError(c.runInput(dragAndDropArgs(atoiOrZero(level), from, to, duration)...), c, "DragAndDrop")
+}
+
+// dragAndDropArgs returns the arguments of the input command that drags from from to to on a
+// device with API level apiLevel.
+func dragAndDropArgs(apiLevel int, from, to image.Point, duration time.Duration) []string {
+	command := "swipe"
+	if apiLevel >= dragAndDropAPILevel {
+		command = "draganddrop"
+	}
+	args := []string{command, strconv.Itoa(from.X), strconv.Itoa(from.Y), strconv.Itoa(to.X), strconv.Itoa(to.Y)}
+	if duration > 0 {
+		args = append(args, strconv.FormatInt(duration.Milliseconds(), 10))
+	}
+	return args
+}
+
+/*
+Text types s into the focused view, as if it was typed on a hardware keyboard. Only printable
+ASCII is supported, since input text can only type characters that have a key on the virtual
+keyboard.
+
+Corresponds to the command:
+
+	adb shell input [-d <display>] text <s>
+*/
+func (c *Device) Text(s string) error {
+	arg, err := inputTextArg(s)
+	if err != nil {
+		return wrapClientError(err, c, "Text")
+	}
+	if arg == "" {
+		return nil
+	}
+	return wrapClientError(c.runInput("text", arg), c, "Text")
+}
+
+/*
+KeyEvent presses and releases the key with code.
+
+Corresponds to the command:
+
+	adb shell input [-d <display>] keyevent <code>
+*/
+func (c *Device) KeyEvent(code KeyCode) error {
+	return wrapClientError(c.runInput("keyevent", strconv.Itoa(int(code))), c, "KeyEvent")
+}
+
+// runInput runs input with args, which must already be quoted for the shell, on the display set
+// by SetInputDisplay. input prints nothing when it succeeds, and exits with status 0 even if it
+// fails on most versions, so any output is an error.
+func (c *Device) runInput(args ...string) error {
+	cmd := "input "
+	if display := c.getInputDisplay(); display != 0 {
+		cmd += "-d " + strconv.Itoa(display) + " "
+	}
+	// The command line is passed as a single string, since RunCommand rejects arguments that
+	// contain double quotes, which text can.
+	output, err := c.RunCommand(cmd + strings.Join(args, " "))
+	if err != nil {
+		return err
+	}
+	if output = strings.TrimSpace(output); output != "" {
+		return errors.Errorf(errors.AdbError, "input %s failed: %s", args[0], output)
+	}
+	return nil
+}
+
+// inputTextArg encodes s as the argument of input text, which is run by the device's shell.
+// input text types "%s" as a space, since its argument can't contain spaces, and the rest is
+// single-quoted for the shell.
+func inputTextArg(s string) (string, error) {
+	for i, r := range s {
+		if r < ' ' || r > '~' {
+			return "", errors.AssertionErrorf("input text can't type character %q at index %d", r, i)
+		}
+	}
+	if s == "" {
+		return "", nil
+	}
+	return shellQuote(strings.Replace(s, " ", "%s", -1)), nil
+}
@@ -0,0 +1,141 @@
+package adb
+
+import (
+	"bufio"
+	"context"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/mqhack/goadb/internal/errors"
+)
+
+// InputEvent is a raw event read from an input device, like a key press or a touchscreen
+// axis moving.
+type InputEvent struct {
+	// Device is the input device node, e.g. "/dev/input/event2".
+	Device string
+	// Timestamp is the time since boot the event happened at.
+	Timestamp time.Duration
+	// Type and Code are the event's type and code as named by getevent, e.g. "EV_ABS" and
+	// "ABS_MT_POSITION_X". Types and codes getevent doesn't know are in hex, e.g. "0035".
+	Type string
+	Code string
+	// Value is 1 for key presses, 0 for releases and 2 for repeats.
+	Value int32
+}
+
+// Matches a line of getevent -lt output, e.g.
+// "[   12345.678901] /dev/input/event2: EV_ABS       ABS_MT_POSITION_X    000001f4".
+var geteventLinePattern = regexp.MustCompile(`^\[\s*(\d+)\.(\d+)\] (\S+): (\S+)\s+(\S+)\s+(\S+)\s*$`)
+
+// The values that getevent -l prints for EV_KEY events.
+var geteventKeyValues = map[string]int32{
+	"UP":     0,
+	"DOWN":   1,
+	"REPEAT": 2,
+}
+
+/*
+InputEventStream delivers the events of all input devices from a running getevent command.
+*/
+type InputEventStream struct {
+	events chan InputEvent
+
+	// If an error occurs, it is stored here and events is closed immediately after.
+	err atomic.Value
+}
+
+// C returns a channel that can be received on to get input events.
+// The channel is closed when the context passed to InputEvents is done, or an error occurs.
+func (s *InputEventStream) C() <-chan InputEvent {
+	return s.events
+}
+
+// Err returns the error that caused the channel returned by C to be closed, if C is closed.
+// It's nil if the context was done.
+// If C is not closed, its return value is undefined.
+func (s *InputEventStream) Err() error {
+	if err, ok := s.err.Load().(error); ok {
+		return err
+	}
+	return nil
+}
+
+/*
+InputEvents streams the events of all input devices until ctx is done, e.g. to record user
+interactions for replaying them later with sendevent.
+
+Corresponds to the command:
+
+	adb shell getevent -lt
+*/
+func (c *Device) InputEvents(ctx context.Context) (*InputEventStream, error) {
+	conn, err := c.openShell("getevent -lt")
+	if err != nil {
+		return nil, wrapClientError(err, c, "InputEvents")
+	}
+	stop := closeWhenDone(ctx, conn)
+
+	stream := &InputEventStream{events: make(chan InputEvent)}
+	go func() {
+		defer close(stream.events)
+		defer conn.Close()
+		defer stop()
+
+		stdout := newShellStdoutReader(conn)
+		scanner := bufio.NewScanner(stdout)
+		for scanner.Scan() {
+			event, ok := parseGeteventLine(scanner.Text())
+			if !ok {
+				// getevent lists the devices before the events.
+				continue
+			}
+			select {
+			case stream.events <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		err := scanner.Err()
+		if err != nil {
+			err = errors.WrapErrorf(err, errors.NetworkError, "error reading input events")
+		} else {
+			err = errors.Errorf(errors.AdbError, "getevent exited with status %d: %s",
+				stdout.exitCode, strings.TrimSpace(stdout.stderr.String()))
+		}
+		stream.err.Store(wrapClientError(err, c, "InputEvents"))
+	}()
+	return stream, nil
+}
+
+// parseGeteventLine parses an event printed by getevent -lt, or returns false if line isn't
+// an event.
+func parseGeteventLine(line string) (InputEvent, bool) {
+	match := geteventLinePattern.FindStringSubmatch(strings.TrimRight(line, "\r"))
+	if match == nil {
+		return InputEvent{}, false
+	}
+	event := InputEvent{
+		Device:    match[3],
+		Timestamp: parseKernelTimestamp(match[1], match[2]),
+		Type:      match[4],
+		Code:      match[5],
+	}
+	if value, ok := geteventKeyValues[match[6]]; ok {
+		event.Value = value
+		return event, true
+	}
+	value, err := strconv.ParseUint(match[6], 16, 32)
+	if err != nil {
+		return InputEvent{}, false
+	}
+	// Values are printed as unsigned, but are signed, e.g. ffffffff for a tracking ID of -1.
+	event.Value = int32(uint32(value))
+	return event, true
+}
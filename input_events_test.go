@@ -0,0 +1,81 @@
+package adb
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mqhack/goadb/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseGeteventLine(t *testing.T) {
+	event, ok := parseGeteventLine("[   12345.678901] /dev/input/event2: EV_ABS       ABS_MT_POSITION_X    000001f4\r")
+	require.True(t, ok)
+	assert.Equal(t, InputEvent{
+		Device:    "/dev/input/event2",
+		Timestamp: 12345*time.Second + 678901*time.Microsecond,
+		Type:      "EV_ABS",
+		Code:      "ABS_MT_POSITION_X",
+		Value:     500,
+	}, event)
+
+	event, ok = parseGeteventLine("[      12.000000] /dev/input/event2: EV_ABS       ABS_MT_TRACKING_ID   ffffffff")
+	require.True(t, ok)
+	assert.Equal(t, int32(-1), event.Value)
+
+	event, ok = parseGeteventLine("[      12.000000] /dev/input/event0: EV_KEY       KEY_POWER            DOWN")
+	require.True(t, ok)
+	assert.Equal(t, int32(1), event.Value)
+
+	_, ok = parseGeteventLine("add device 1: /dev/input/event0")
+	assert.False(t, ok)
+	_, ok = parseGeteventLine(`  name:     "gpio-keys"`)
+	assert.False(t, ok)
+}
+
+func TestInputEvents(t *testing.T) {
+	s := &MockServer{
+		Status: wire.StatusSuccess,
+		Messages: []string{
+			shellPacket(wire.ShellIDStdout, "add device 1: /dev/input/event0\n  name:     \"gpio-keys\"\n"),
+			shellPacket(wire.ShellIDStdout, "[      12.000000] /dev/input/event0: EV_KEY       KEY_POWER            DOWN\n"+
+				"[      12.000000] /dev/input/event0: EV_SYN       SYN_REPORT           00000000\n"),
+			shellPacket(wire.ShellIDStderr, "getevent: killed\n"),
+			shellPacket(wire.ShellIDExit, "\x01"),
+		},
+	}
+	device := (&Adb{server: s}).Device(AnyDevice())
+
+	stream, err := device.InputEvents(context.Background())
+	require.NoError(t, err)
+	var events []InputEvent
+	for event := range stream.C() {
+		events = append(events, event)
+	}
+	assert.Equal(t, []InputEvent{
+		{"/dev/input/event0", 12 * time.Second, "EV_KEY", "KEY_POWER", 1},
+		{"/dev/input/event0", 12 * time.Second, "EV_SYN", "SYN_REPORT", 0},
+	}, events)
+	assert.True(t, HasErrCode(stream.Err(), AdbError))
+	assert.Contains(t, ErrorWithCauseChain(stream.Err()), "getevent exited with status 1: getevent: killed")
+	assert.Equal(t, "shell,v2,raw:getevent -lt", s.Requests[1])
+}
+
+func TestInputEventsLineTooLong(t *testing.T) {
+	s := &MockServer{
+		Status: wire.StatusSuccess,
+		Messages: []string{
+			shellPacket(wire.ShellIDStdout, "add device 1: /dev/input/event2\n  name: \""+strings.Repeat("x", 70000)+"\"\n"),
+			shellPacket(wire.ShellIDExit, "\x00"),
+		},
+	}
+	stream, err := (&Adb{server: s}).Device(AnyDevice()).InputEvents(context.Background())
+	require.NoError(t, err)
+	for range stream.C() {
+	}
+	assert.True(t, HasErrCode(stream.Err(), NetworkError))
+	assert.Contains(t, ErrorWithCauseChain(stream.Err()), "token too long")
+}
@@ -0,0 +1,84 @@
+package adb
+
+import (
+	"image"
+	"testing"
+	"time"
+
+	"github.com/mqhack/goadb/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInputCommands(t *testing.T) {
+	for expected, run := range map[string]func(*Device) error{
+		"shell:input tap 100 200":              func(d *Device) error { return d.Tap(100, 200) },
+		"shell:input swipe 10 20 30 40 250":    func(d *Device) error { return d.Swipe(10, 20, 30, 40, 250*time.Millisecond) },
+		"shell:input swipe 10 20 30 40":        func(d *Device) error { return d.Swipe(10, 20, 30, 40, 0) },
+		"shell:input swipe 5 6 5 6 1000":       func(d *Device) error { return d.LongPress(5, 6, 0) },
+		"shell:input swipe 5 6 5 6 2000":       func(d *Device) error { return d.LongPress(5, 6, 2*time.Second) },
+		"shell:input keyevent 66":              func(d *Device) error { return d.KeyEvent(KeyCodeEnter) },
+		`shell:input text 'it'\''s%s"quoted"'`: func(d *Device) error { return d.Text(`it's "quoted"`) },
+	} {
+		s := &MockServer{Status: wire.StatusSuccess}
+		require.NoError(t, run((&Adb{server: s}).Device(AnyDevice())), expected)
+		assert.Equal(t, expected, s.Requests[1])
+	}
+}
+
+func TestInputCommandsOnDisplay(t *testing.T) {
+	for expected, run := range map[string]func(*Device) error{
+		"shell:input -d 1 tap 100 200":           func(d *Device) error { return d.Tap(100, 200) },
+		"shell:input -d 1 swipe 10 20 30 40 250": func(d *Device) error { return d.Swipe(10, 20, 30, 40, 250*time.Millisecond) },
+		"shell:input -d 1 keyevent 66":           func(d *Device) error { return d.KeyEvent(KeyCodeEnter) },
+		"shell:input -d 1 text 'hi'":             func(d *Device) error { return d.Text("hi") },
+	} {
+		s := &MockServer{Status: wire.StatusSuccess}
+		device := (&Adb{server: s}).Device(AnyDevice())
+		// Set the logical ID directly, since SetInputDisplay looks it up with dumpsys.
+		device.inputDisplay.Store(1)
+		require.NoError(t, run(device), expected)
+		assert.Equal(t, expected, s.Requests[1])
+	}
+}
+
+func TestInputFailed(t *testing.T) {
+	s := &MockServer{
+		Status:   wire.StatusSuccess,
+		Messages: []string{"Error: Invalid arguments for command: tap\n"},
+	}
+	device := (&Adb{server: s}).Device(AnyDevice())
+
+	err := device.Tap(1, 2)
+	assert.True(t, HasErrCode(err, AdbError))
+	assert.Contains(t, ErrorWithCauseChain(err), "input tap failed: Error: Invalid arguments for command: tap")
+}
+
+func TestInputTextArg(t *testing.T) {
+	arg, err := inputTextArg("hello world")
+	require.NoError(t, err)
+	assert.Equal(t, "'hello%sworld'", arg)
+
+	_, err = inputTextArg("line\nbreak")
+	assert.True(t, HasErrCode(err, AssertionError))
+	_, err = inputTextArg("héllo")
+	assert.True(t, HasErrCode(err, AssertionError))
+}
+
+func TestDragAndDropArgs(t *testing.T) {
+	from, to := image.Pt(100, 200), image.Pt(300, 400)
+	assert.Equal(t, []string{"draganddrop", "100", "200", "300", "400", "1500"}, dragAndDropArgs(33, from, to, 1500*time.Millisecond))
+	assert.Equal(t, []string{"draganddrop", "100", "200", "300", "400"}, dragAndDropArgs(26, from, to, 0))
+	assert.Equal(t, []string{"swipe", "100", "200", "300", "400", "1500"}, dragAndDropArgs(25, from, to, 1500*time.Millisecond))
+}
+
+func TestDragAndDrop(t *testing.T) {
+	s := &MockServer{Status: wire.StatusSuccess}
+	device := (&Adb{server: s}).Device(AnyDevice())
+
+	require.NoError(t, device.DragAndDrop(image.Pt(1, 2), image.Pt(3, 4), time.Second))
+	assert.Equal(t, []string{
+		"host:transport-any", "shell:getprop ro.build.version.sdk",
+		"host:transport-any", "shell:input swipe 1 2 3 4 1000",
+	}, s.Requests)
+}
@@ -0,0 +1,192 @@
+package adb
+
+import (
+	"bufio"
+	"encoding/base64"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/mqhack/goadb/internal/errors"
+	"github.com/mqhack/goadb/wire"
+)
+
+// HelperIME is the component of ADBKeyboard, the input method InputText uses to type text
+// that input text can't.
+const HelperIME = "com.android.adbkeyboard/.AdbIME"
+
+// Broadcast action ADBKeyboard types the base64-encoded "msg" extra of.
+const helperIMEInputAction = "ADB_INPUT_B64"
+
+// Where the helper IME's APK is pushed to be installed.
+const helperIMEInstallPath = "/data/local/tmp/goadb-adbkeyboard.apk"
+
+// TextInputOptions configures Device.InputText.
+type TextInputOptions struct {
+	// HelperAPK, if set, is the APK of ADBKeyboard, which is installed if the device doesn't
+	// have HelperIME.
+	HelperAPK io.Reader
+}
+
+/*
+InputText types s into the focused view. Unlike Text, s can contain any characters, including
+CJK, emoji and newlines.
+
+Text that input text can type is typed with it. Other text is sent to HelperIME, which is
+installed from opts.HelperAPK if it's missing, and made the current input method while
+typing. The previous input method is restored afterwards. If the helper isn't installed and
+there's no APK to install it from, text that's only ASCII, with newlines and tabs, is typed
+with input text and key events for Enter and Tab; any other text is an error with code
+RequirementNotMet.
+*/
+func (c *Device) InputText(s string, opts TextInputOptions) error {
+	if _, err := inputTextArg(s); err == nil {
+		return wrapClientError(c.Text(s), c, "InputText")
+	}
+	return wrapClientError(c.inputTextWithIME(s, opts), c, "InputText")
+}
+
+func (c *Device) inputTextWithIME(s string, opts TextInputOptions) error {
+	// -a lists every installed input method, not only the enabled ones, which are all -s lists
+	// by itself; setIME enables it if it isn't.
+	output, err := c.RunCommand("ime", "list", "-a", "-s")
+	if err != nil {
+		return err
+	}
+	if !listsIME(output, HelperIME) {
+		if opts.HelperAPK == nil {
+			if canTypeWithKeyEvents(s) {
+				return c.inputTextWithKeyEvents(s)
+			}
+			return errors.Errorf(errors.RequirementNotMet,
+				"can't type non-ASCII text without the %s input method installed", HelperIME)
+		}
+		if err := c.installHelperIME(opts.HelperAPK); err != nil {
+			return err
+		}
+	}
+
+	previous, err := c.RunCommand("settings", "get", "secure", "default_input_method")
+	if err != nil {
+		return err
+	}
+	previous = strings.TrimSpace(previous)
+	if previous != HelperIME {
+		if err := c.setIME(HelperIME); err != nil {
+			return err
+		}
+	}
+
+	output, err = c.RunCommand("am", "broadcast", "-a", helperIMEInputAction,
+		"--es", "msg", base64.StdEncoding.EncodeToString([]byte(s)))
+	if err == nil {
+		err = checkBroadcastOutput(output)
+	}
+
+	if previous != HelperIME && previous != "" && previous != "null" {
+		if restoreErr := c.setIME(previous); err == nil {
+			err = restoreErr
+		}
+	}
+	return err
+}
+
+// Key codes typed for the control characters inputTextWithKeyEvents supports.
+var textKeyCodes = map[rune]KeyCode{
+	'\n': KeyCodeEnter,
+	'\t': KeyCodeTab,
+}
+
+// canTypeWithKeyEvents returns true if s is only characters input text can type and ones in
+// textKeyCodes.
+func canTypeWithKeyEvents(s string) bool {
+	for _, r := range s {
+		if _, ok := textKeyCodes[r]; !ok && (r < ' ' || r > '~') {
+			return false
+		}
+	}
+	return true
+}
+
+// inputTextWithKeyEvents types s with input text, pressing keys for the characters in
+// textKeyCodes. s must satisfy canTypeWithKeyEvents.
+func (c *Device) inputTextWithKeyEvents(s string) error {
+	for s != "" {
+		text := s
+		i := strings.IndexAny(s, "\n\t")
+		if i >= 0 {
+			text = s[:i]
+		}
+		if text != "" {
+			arg, err := inputTextArg(text)
+			if err != nil {
+				return err
+			}
+			if err := c.runInput("text", arg); err != nil {
+				return err
+			}
+		}
+		if i < 0 {
+			return nil
+		}
+		if err := c.runInput("keyevent", strconv.Itoa(int(textKeyCodes[rune(s[i])]))); err != nil {
+			return err
+		}
+		s = s[i+1:]
+	}
+	return nil
+}
+
+// setIME enables and selects the input method with component.
+func (c *Device) setIME(component string) error {
+	if _, err := c.RunCommand("ime", "enable", component); err != nil {
+		return err
+	}
+	output, err := c.RunCommand("ime", "set", component)
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(output, "selected") {
+		return errors.Errorf(errors.AdbError, "error selecting input method %s: %s", component, strings.TrimSpace(output))
+	}
+	return nil
+}
+
+// installHelperIME pushes apk to the device and installs it.
+func (c *Device) installHelperIME(apk io.Reader) error {
+	w, err := c.OpenWrite(helperIMEInstallPath, wire.DefaultFilePerms, MtimeOfClose)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, apk); err != nil {
+		w.Close()
+		if _, ok := err.(*errors.Err); !ok {
+			err = errors.WrapErrorf(err, errors.NetworkError, "error pushing helper input method")
+		}
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	output, err := c.RunCommand("pm install -r " + shellQuote(helperIMEInstallPath) + "; rm -f " + shellQuote(helperIMEInstallPath))
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(output, "Success") {
+		return errors.Errorf(errors.AdbError, "error installing helper input method: %s", strings.TrimSpace(output))
+	}
+	return nil
+}
+
+// listsIME returns true if the output of ime list -a -s, which has a line per input method
+// component, includes component.
+func listsIME(output, component string) bool {
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		if strings.TrimSpace(scanner.Text()) == component {
+			return true
+		}
+	}
+	return false
+}
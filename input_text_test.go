@@ -0,0 +1,52 @@
+package adb
+
+import (
+	"testing"
+
+	"github.com/mqhack/goadb/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInputTextASCII(t *testing.T) {
+	s := &MockServer{Status: wire.StatusSuccess}
+	device := (&Adb{server: s}).Device(AnyDevice())
+
+	require.NoError(t, device.InputText("hello world", TextInputOptions{}))
+	assert.Equal(t, "shell:input text 'hello%sworld'", s.Requests[1])
+}
+
+func TestInputTextWithoutHelperIME(t *testing.T) {
+	s := &MockServer{
+		Status:   wire.StatusSuccess,
+		Messages: []string{"com.android.inputmethod.latin/.LatinIME\n"},
+	}
+	device := (&Adb{server: s}).Device(AnyDevice())
+
+	err := device.InputText("こんにちは 👋", TextInputOptions{})
+	assert.True(t, HasErrCode(err, RequirementNotMet))
+	assert.Equal(t, "shell:ime list -a -s", s.Requests[1])
+}
+
+func TestInputTextKeyEventsWithoutHelperIME(t *testing.T) {
+	s := &MockServer{
+		Status:   wire.StatusSuccess,
+		Messages: []string{"com.android.inputmethod.latin/.LatinIME\n"},
+	}
+	device := (&Adb{server: s}).Device(AnyDevice())
+
+	require.NoError(t, device.InputText("one\ntwo\t", TextInputOptions{}))
+	assert.Equal(t, []string{
+		"host:transport-any", "shell:ime list -a -s",
+		"host:transport-any", "shell:input text 'one'",
+		"host:transport-any", "shell:input keyevent 66",
+		"host:transport-any", "shell:input text 'two'",
+		"host:transport-any", "shell:input keyevent 61",
+	}, s.Requests)
+}
+
+func TestListsIME(t *testing.T) {
+	output := "com.android.inputmethod.latin/.LatinIME\r\ncom.android.adbkeyboard/.AdbIME\r\n"
+	assert.True(t, listsIME(output, HelperIME))
+	assert.False(t, listsIME("com.android.inputmethod.latin/.LatinIME\n", HelperIME))
+}
@@ -0,0 +1,159 @@
+package adb
+
+import (
+	"bufio"
+	"context"
+	"strings"
+	"time"
+
+	"github.com/mqhack/goadb/internal/errors"
+	"github.com/mqhack/goadb/wire"
+)
+
+// Printed by the replay shell after each input command, to detect when it's finished.
+const inputAckMarker = "goadb-input-done"
+
+// DefaultReplaySmoothing is the default ReplayOptions.Smoothing.
+const DefaultReplaySmoothing = 0.5
+
+// TimedInput is an input command to replay at Offset from the start of a replay.
+type TimedInput struct {
+	Offset time.Duration
+	// Command is run by the device's shell, e.g. "input motionevent MOVE 540 1200".
+	Command string
+}
+
+// InputDelivery reports when a replayed input was sent and delivered, relative to the start
+// of the replay.
+type InputDelivery struct {
+	// Offset is the TimedInput's offset, when it should have been delivered.
+	Offset    time.Duration
+	Sent      time.Duration
+	Delivered time.Duration
+}
+
+// Latency is how long the input took to be delivered after it was sent.
+func (d InputDelivery) Latency() time.Duration {
+	return d.Delivered - d.Sent
+}
+
+// Skew is how late the input was delivered, or negative if it was early.
+func (d InputDelivery) Skew() time.Duration {
+	return d.Delivered - d.Offset
+}
+
+// ReplayOptions configures Device.ReplayInput.
+type ReplayOptions struct {
+	// InitialLatency is the latency assumed for the first input. If zero, the first input is
+	// sent at its offset, and its measured latency is used for the next.
+	InitialLatency time.Duration
+	// Smoothing is the weight given to each new latency measurement in the estimate, between
+	// 0 and 1. Higher values adapt faster to changes, but are more affected by outliers.
+	// Defaults to DefaultReplaySmoothing.
+	Smoothing float64
+}
+
+/*
+ReplayInput runs each input's command at its offset, compensating for the time it takes to
+deliver, so the inputs happen on the device with the same timing they were recorded with.
+This keeps the velocity of replayed gestures the same, which matters for testing scrolling
+and fling physics.
+
+Each input is sent early by the current estimate of the delivery latency, which is updated
+after each input with the latency measured for it. The commands are run one at a time by a
+single shell, which saves starting a shell for each. An input counts as delivered when its
+command exits, which is a close approximation for input commands, since they inject the
+event just before exiting.
+
+Returns the delivery of each input that was run, even if an error stops the replay early.
+If ctx is done first, the error has code Timeout.
+*/
+func (c *Device) ReplayInput(ctx context.Context, inputs []TimedInput, opts ReplayOptions) ([]InputDelivery, error) {
+	conn, err := c.openShell("sh")
+	if err != nil {
+		return nil, wrapClientError(err, c, "ReplayInput")
+	}
+	defer conn.Close()
+	stop := closeWhenDone(ctx, conn)
+	defer stop()
+
+	run := shellInputRunner(conn)
+	deliveries, err := replayInputs(ctx, inputs, opts, run, time.Now, sleepContext)
+	if err != nil && ctx.Err() != nil {
+		err = errors.WrapErrorf(ctx.Err(), errors.Timeout, "input replay didn't complete")
+	}
+	return deliveries, wrapClientError(err, c, "ReplayInput")
+}
+
+// shellInputRunner returns a func that runs a command in the shell on conn, and returns once
+// it has exited.
+func shellInputRunner(conn *wire.ShellConn) func(cmd string) error {
+	stdout := newShellStdoutReader(conn)
+	lines := bufio.NewReader(stdout)
+	return func(cmd string) error {
+		if err := conn.SendPacket(wire.ShellIDStdin, []byte(cmd+"; echo "+inputAckMarker+"\n")); err != nil {
+			return err
+		}
+		for {
+			line, err := lines.ReadString('\n')
+			if strings.HasSuffix(strings.TrimRight(line, "\r\n"), inputAckMarker) {
+				return nil
+			}
+			if err != nil {
+				if stdout.exited {
+					return errors.Errorf(errors.AdbError, "replay shell exited with status %d: %s",
+						stdout.exitCode, strings.TrimSpace(stdout.stderr.String()))
+				}
+				return errors.WrapErrorf(err, errors.NetworkError, "error reading replay shell output")
+			}
+		}
+	}
+}
+
+// replayInputs runs each input with run at its offset from the time replayInputs is called,
+// minus the estimated latency.
+func replayInputs(ctx context.Context, inputs []TimedInput, opts ReplayOptions, run func(cmd string) error,
+	now func() time.Time, sleep func(context.Context, time.Duration) error) ([]InputDelivery, error) {
+	smoothing := opts.Smoothing
+	if smoothing <= 0 || smoothing > 1 {
+		smoothing = DefaultReplaySmoothing
+	}
+
+	start := now()
+	latency := opts.InitialLatency
+	estimated := opts.InitialLatency > 0
+	deliveries := make([]InputDelivery, 0, len(inputs))
+	for _, input := range inputs {
+		if wait := input.Offset - latency - now().Sub(start); wait > 0 {
+			if err := sleep(ctx, wait); err != nil {
+				return deliveries, err
+			}
+		}
+
+		delivery := InputDelivery{Offset: input.Offset, Sent: now().Sub(start)}
+		if err := run(input.Command); err != nil {
+			return deliveries, errors.WrapErrf(err, "error replaying input %q", input.Command)
+		}
+		delivery.Delivered = now().Sub(start)
+		deliveries = append(deliveries, delivery)
+
+		if measured := delivery.Latency(); estimated {
+			latency += time.Duration(smoothing * float64(measured-latency))
+		} else {
+			latency, estimated = measured, true
+		}
+	}
+	return deliveries, nil
+}
+
+// sleepContext sleeps for d, or until ctx is done, in which case it returns ctx's error.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return errors.WrapErrorf(ctx.Err(), errors.Timeout, "context done while waiting")
+	}
+}
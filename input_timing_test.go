@@ -0,0 +1,124 @@
+package adb
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mqhack/goadb/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeInputClock advances time when sleeping or running a command, which takes the next of
+// latencies.
+type fakeInputClock struct {
+	now       time.Time
+	latencies []time.Duration
+	commands  []string
+}
+
+func (c *fakeInputClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeInputClock) Sleep(ctx context.Context, d time.Duration) error {
+	c.now = c.now.Add(d)
+	return nil
+}
+
+func (c *fakeInputClock) Run(cmd string) error {
+	c.commands = append(c.commands, cmd)
+	c.now = c.now.Add(c.latencies[0])
+	c.latencies = c.latencies[1:]
+	return nil
+}
+
+func TestReplayInputsCompensatesLatency(t *testing.T) {
+	clock := &fakeInputClock{
+		now:       time.Unix(0, 0),
+		latencies: []time.Duration{100 * time.Millisecond, 100 * time.Millisecond, 60 * time.Millisecond},
+	}
+	inputs := []TimedInput{
+		{Offset: 0, Command: "input motionevent DOWN 100 100"},
+		{Offset: 500 * time.Millisecond, Command: "input motionevent MOVE 100 300"},
+		{Offset: 1000 * time.Millisecond, Command: "input motionevent UP 100 500"},
+	}
+
+	deliveries, err := replayInputs(context.Background(), inputs, ReplayOptions{}, clock.Run, clock.Now, clock.Sleep)
+	require.NoError(t, err)
+	assert.Equal(t, []string{inputs[0].Command, inputs[1].Command, inputs[2].Command}, clock.commands)
+	assert.Equal(t, []InputDelivery{
+		// Nothing to compensate for before the first measurement.
+		{Offset: 0, Sent: 0, Delivered: 100 * time.Millisecond},
+		{Offset: 500 * time.Millisecond, Sent: 400 * time.Millisecond, Delivered: 500 * time.Millisecond},
+		// Sent 100ms early, but delivered faster than estimated.
+		{Offset: 1000 * time.Millisecond, Sent: 900 * time.Millisecond, Delivered: 960 * time.Millisecond},
+	}, deliveries)
+	assert.Equal(t, -40*time.Millisecond, deliveries[2].Skew())
+	assert.Equal(t, 60*time.Millisecond, deliveries[2].Latency())
+}
+
+func TestReplayInputsSmoothing(t *testing.T) {
+	clock := &fakeInputClock{
+		now:       time.Unix(0, 0),
+		latencies: []time.Duration{200 * time.Millisecond, 0},
+	}
+	inputs := []TimedInput{{Offset: 0}, {Offset: time.Second}}
+	opts := ReplayOptions{InitialLatency: 100 * time.Millisecond, Smoothing: 0.25}
+
+	deliveries, err := replayInputs(context.Background(), inputs, opts, clock.Run, clock.Now, clock.Sleep)
+	require.NoError(t, err)
+	// The estimate moves a quarter of the way from 100ms to 200ms.
+	assert.Equal(t, 875*time.Millisecond, deliveries[1].Sent)
+}
+
+func TestReplayInputsLateInputsSentImmediately(t *testing.T) {
+	clock := &fakeInputClock{
+		now:       time.Unix(0, 0),
+		latencies: []time.Duration{300 * time.Millisecond, 300 * time.Millisecond},
+	}
+	inputs := []TimedInput{{Offset: 0}, {Offset: 100 * time.Millisecond}}
+
+	deliveries, err := replayInputs(context.Background(), inputs, ReplayOptions{}, clock.Run, clock.Now, clock.Sleep)
+	require.NoError(t, err)
+	assert.Equal(t, 300*time.Millisecond, deliveries[1].Sent)
+}
+
+func TestReplayInput(t *testing.T) {
+	s := &MockServer{
+		Status: wire.StatusSuccess,
+		Messages: []string{
+			shellPacket(wire.ShellIDStdout, "goadb-input-done\n"),
+			shellPacket(wire.ShellIDStdout, "some output\ngoadb-input-done\n"),
+		},
+	}
+	device := (&Adb{server: s}).Device(AnyDevice())
+
+	deliveries, err := device.ReplayInput(context.Background(), []TimedInput{
+		{Offset: 0, Command: "input tap 1 2"},
+		{Offset: 0, Command: "input tap 3 4"},
+	}, ReplayOptions{})
+	require.NoError(t, err)
+	assert.Len(t, deliveries, 2)
+	assert.Equal(t, "shell,v2,raw:sh", s.Requests[1])
+	assert.Equal(t, shellPacket(wire.ShellIDStdin, "input tap 1 2; echo goadb-input-done\n")+
+		shellPacket(wire.ShellIDStdin, "input tap 3 4; echo goadb-input-done\n"), string(s.Written))
+}
+
+func TestReplayInputShellExited(t *testing.T) {
+	s := &MockServer{
+		Status: wire.StatusSuccess,
+		Messages: []string{
+			shellPacket(wire.ShellIDStderr, "sh: input: not found\n"),
+			shellPacket(wire.ShellIDExit, "\x7f"),
+		},
+	}
+	device := (&Adb{server: s}).Device(AnyDevice())
+
+	deliveries, err := device.ReplayInput(context.Background(), []TimedInput{{Command: "input tap 1 2"}}, ReplayOptions{})
+	assert.Empty(t, deliveries)
+	assert.True(t, HasErrCode(err, AdbError))
+	assert.True(t, strings.Contains(ErrorWithCauseChain(err), "replay shell exited with status 127: sh: input: not found"))
+}
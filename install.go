@@ -0,0 +1,202 @@
+package adb
+
+import (
+	"context"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/mqhack/goadb/internal/errors"
+)
+
+// InstallOptions configures Device.Install.
+type InstallOptions struct {
+	// Replace reinstalls the app if it's already installed, keeping its data.
+	Replace bool
+	// AllowDowngrade allows installing an older version than the one installed.
+	AllowDowngrade bool
+	// GrantPermissions grants all the permissions in the app's manifest.
+	GrantPermissions bool
+	// AllowTest allows installing an APK with android:testOnly set in its manifest.
+	AllowTest bool
+	// Args are passed to install-create after the options above, e.g. "--user", "10".
+	Args []string
+
+	// Progress, if set, is called with the number of bytes of the APKs streamed so far, from
+	// the goroutine that called Install or InstallMultiple.
+	Progress func(written int64)
+}
+
+// APKSource is one of the APKs of an app for Device.InstallMultiple.
+type APKSource struct {
+	// Name is the APK's name in the install session, e.g. "split_config.arm64_v8a.apk". Each
+	// APK needs a different name; if it's empty, the first APK is named base.apk and the
+	// others split<index>.apk.
+	Name   string
+	Reader io.Reader
+	Size   int64
+}
+
+// args returns the arguments of install-create for the options.
+func (o InstallOptions) args() []string {
+	var args []string
+	for _, flag := range []struct {
+		set  bool
+		flag string
+	}{
+		{o.Replace, "-r"},
+		{o.AllowDowngrade, "-d"},
+		{o.GrantPermissions, "-g"},
+		{o.AllowTest, "-t"},
+	} {
+		if flag.set {
+			args = append(args, flag.flag)
+		}
+	}
+	return append(args, o.Args...)
+}
+
+/*
+Install installs the APK of size bytes read from apk. The APK is streamed into a package
+installer session over the exec: service, so it's never written to the device's temporary
+storage, which is much faster for big APKs than pushing it and running pm install.
+
+If the package manager rejects the APK, the error has code PackageManagerError, and
+PackageFailureReason returns the reason, e.g. InstallFailedVersionDowngrade. If ctx is done,
+the error has code Timeout.
+Either way, the session is abandoned unless it was committed. Requires a device running
+Android N or later.
+
+Corresponds to the command:
+
+	adb install <apk>
+*/
+func (c *Device) Install(ctx context.Context, apk io.Reader, size int64, opts InstallOptions) error {
+	err := c.install(ctx, []APKSource{{Name: "base.apk", Reader: apk, Size: size}}, opts)
+	return wrapClientError(err, c, "Install")
+}
+
+/*
+InstallMultiple installs an app that's made of several APKs, like the split APKs bundletool
+builds from an App Bundle: the base APK and its configuration splits, e.g. for the device's
+ABI and screen density. They're all streamed into one package installer session like
+Install, so they're installed together or not at all.
+
+Corresponds to the command:
+
+	adb install-multiple <apk>...
+*/
+func (c *Device) InstallMultiple(ctx context.Context, apks []APKSource, opts InstallOptions) error {
+	return wrapClientError(c.install(ctx, apks, opts), c, "InstallMultiple")
+}
+
+func (c *Device) install(ctx context.Context, apks []APKSource, opts InstallOptions) error {
+	if len(apks) == 0 {
+		return errors.Errorf(errors.AssertionError, "no APKs to install")
+	}
+	names := make([]string, len(apks))
+	seen := make(map[string]bool)
+	var total int64
+	for i, apk := range apks {
+		switch {
+		case apk.Name != "":
+			names[i] = apk.Name
+		case i == 0:
+			names[i] = "base.apk"
+		default:
+			names[i] = "split" + strconv.Itoa(i) + ".apk"
+		}
+		if seen[names[i]] {
+			return errors.Errorf(errors.AssertionError, "more than one APK is named %s", names[i])
+		}
+		seen[names[i]] = true
+		total += apk.Size
+	}
+
+	output, err := c.RunCommand("cmd", append([]string{"package", "install-create", "-S", strconv.FormatInt(total, 10)},
+		opts.args()...)...)
+	if err != nil {
+		return err
+	}
+	session, err := parseInstallSession(output)
+	if err != nil {
+		return err
+	}
+
+	var written int64
+	for i, apk := range apks {
+		err := c.installWrite(ctx, session, names[i], apk.Reader, apk.Size, func(n int64) {
+			if opts.Progress != nil {
+				opts.Progress(written + n)
+			}
+		})
+		if err != nil {
+			// The error that stopped the install is more useful than one about abandoning it.
+			c.RunCommand("cmd", "package", "install-abandon", session)
+			return err
+		}
+		written += apk.Size
+	}
+
+	output, err = c.RunCommand("cmd", "package", "install-commit", session)
+	if err != nil {
+		return err
+	}
+	return parsePackageManagerResult("install-commit", output)
+}
+
+// installWrite streams the APK into session as name, calling progress as it's sent.
+func (c *Device) installWrite(ctx context.Context, session, name string, apk io.Reader, size int64,
+	progress func(written int64)) error {
+	conn, err := c.openExec("cmd", "package", "install-write", "-S", strconv.FormatInt(size, 10), session, name, "-")
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	stop := closeWhenDone(ctx, conn)
+	defer stop()
+
+	var written int64
+	stdin := &progressReader{r: apk, progress: func(n int) {
+		written += int64(n)
+		if progress != nil {
+			progress(written)
+		}
+	}}
+	// install-write reads exactly size bytes, then prints its result and exits, so there's no
+	// need to send EOF.
+	_, err = io.CopyN(conn, stdin, size)
+	var output []byte
+	if err == nil {
+		output, err = io.ReadAll(conn)
+	}
+	if ctx.Err() != nil {
+		return errors.WrapErrorf(ctx.Err(), errors.Timeout, "install cancelled after %d of %d bytes of %s", written, size, name)
+	}
+	switch {
+	case err == io.EOF:
+		return errors.Errorf(errors.AssertionError, "%s ended after %d bytes, expected %d", name, written, size)
+	case err != nil:
+		if _, ok := err.(*errors.Err); !ok {
+			err = errors.WrapErrorf(err, errors.NetworkError, "error streaming %s", name)
+		}
+		return err
+	}
+	return parsePackageManagerResult("install-write", string(output))
+}
+
+// parseInstallSession returns the ID of the session install-create created, from output like
+//
+//	Success: created install session [1234]
+func parseInstallSession(output string) (string, error) {
+	output = strings.TrimSpace(output)
+	start, end := strings.LastIndex(output, "["), strings.LastIndex(output, "]")
+	if !strings.HasPrefix(output, "Success") || start < 0 || end < start {
+		return "", errors.Errorf(errors.AdbError, "error creating install session: %s", output)
+	}
+	session := output[start+1 : end]
+	if _, err := strconv.Atoi(session); err != nil {
+		return "", errors.Errorf(errors.ParseError, "invalid install session ID in %q", output)
+	}
+	return session, nil
+}
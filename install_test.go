@@ -0,0 +1,75 @@
+package adb
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/mqhack/goadb/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseInstallSession(t *testing.T) {
+	session, err := parseInstallSession("Success: created install session [1234]\r\n")
+	require.NoError(t, err)
+	assert.Equal(t, "1234", session)
+
+	_, err = parseInstallSession("Error: java.lang.SecurityException: Permission denied\n")
+	assert.True(t, HasErrCode(err, AdbError))
+	_, err = parseInstallSession("Success: created install session [abc]")
+	assert.True(t, HasErrCode(err, ParseError))
+}
+
+func TestInstallArgs(t *testing.T) {
+	assert.Empty(t, InstallOptions{}.args())
+	assert.Equal(t, []string{"-r", "-g", "--user", "10"},
+		InstallOptions{Replace: true, GrantPermissions: true, Args: []string{"--user", "10"}}.args())
+}
+
+func TestInstallWrite(t *testing.T) {
+	s := &MockServer{Status: wire.StatusSuccess, Messages: []string{"Success: streamed 10 bytes\n"}}
+	var progress []int64
+	err := (&Adb{server: s}).Device(AnyDevice()).installWrite(context.Background(), "1234", "base.apk",
+		strings.NewReader("0123456789"), 10, func(written int64) { progress = append(progress, written) })
+	require.NoError(t, err)
+	assert.Equal(t, "exec:cmd package install-write -S 10 1234 base.apk -", s.Requests[1])
+	assert.Contains(t, string(s.Written), "0123456789")
+	assert.Equal(t, int64(10), progress[len(progress)-1])
+}
+
+func TestInstallWriteShortAPK(t *testing.T) {
+	s := &MockServer{Status: wire.StatusSuccess, Messages: []string{""}}
+	err := (&Adb{server: s}).Device(AnyDevice()).installWrite(context.Background(), "1234", "base.apk",
+		strings.NewReader("0123"), 10, nil)
+	assert.True(t, HasErrCode(err, AssertionError))
+}
+
+func TestInstallCreateFails(t *testing.T) {
+	s := &MockServer{Status: wire.StatusSuccess, Messages: []string{"Error: java.lang.IllegalArgumentException\n"}}
+	err := (&Adb{server: s}).Device(AnyDevice()).Install(context.Background(), strings.NewReader("apk"), 3,
+		InstallOptions{Replace: true})
+	assert.True(t, HasErrCode(err, AdbError))
+	assert.Equal(t, "shell:cmd package install-create -S 3 -r", s.Requests[1])
+	assert.Len(t, s.Requests, 2)
+}
+
+func TestInstallMultipleNames(t *testing.T) {
+	s := &MockServer{Status: wire.StatusSuccess}
+	err := (&Adb{server: s}).Device(AnyDevice()).InstallMultiple(context.Background(), []APKSource{
+		{Reader: strings.NewReader("base"), Size: 4},
+		{Name: "base.apk", Reader: strings.NewReader("split"), Size: 5},
+	}, InstallOptions{})
+	assert.True(t, HasErrCode(err, AssertionError))
+	assert.Empty(t, s.Requests)
+}
+
+func TestInstallMultipleCreate(t *testing.T) {
+	s := &MockServer{Status: wire.StatusSuccess, Messages: []string{"Error: no space\n"}}
+	err := (&Adb{server: s}).Device(AnyDevice()).InstallMultiple(context.Background(), []APKSource{
+		{Name: "base.apk", Reader: strings.NewReader("base"), Size: 4},
+		{Name: "split_config.arm64_v8a.apk", Reader: strings.NewReader("split"), Size: 5},
+	}, InstallOptions{})
+	assert.True(t, HasErrCode(err, AdbError))
+	assert.Equal(t, "shell:cmd package install-create -S 9", s.Requests[1])
+}
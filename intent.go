@@ -0,0 +1,375 @@
+package adb
+
+import (
+	"context"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mqhack/goadb/internal/errors"
+)
+
+/*
+Intent describes an intent for StartActivity, StartService or SendBroadcast, which the device's
+am command builds from its fields. Extras are added with the Put methods, which return the
+intent so calls can be chained:
+
+	intent := adb.NewIntent("android.intent.action.VIEW").
+		PutString("title", "Hello, world").
+		PutInt("count", 3)
+	intent.Data = "https://example.com"
+
+Fields that are empty are left unset.
+*/
+type Intent struct {
+	// Action is e.g. "android.intent.action.VIEW".
+	Action string
+	// Data is the intent's data URI, e.g. "https://example.com".
+	Data string
+	// MIMEType is the type of the data, e.g. "image/png".
+	MIMEType string
+	// Component is the component to deliver the intent to, e.g. "com.example/.MainActivity".
+	Component string
+	// Package limits the components the intent resolves to to those of the package.
+	Package    string
+	Categories []string
+	// Flags are the intent's flags, e.g. FLAG_ACTIVITY_NEW_TASK, 0x10000000.
+	Flags int
+
+	extras []string
+}
+
+// NewIntent returns an intent with action.
+func NewIntent(action string) *Intent {
+	return &Intent{Action: action}
+}
+
+// AddCategory adds a category, e.g. "android.intent.category.LAUNCHER".
+func (i *Intent) AddCategory(category string) *Intent {
+	i.Categories = append(i.Categories, category)
+	return i
+}
+
+func (i *Intent) putExtra(flag, key, value string) *Intent {
+	i.extras = append(i.extras, flag, key, value)
+	return i
+}
+
+// PutString adds a String extra.
+func (i *Intent) PutString(key, value string) *Intent { return i.putExtra("--es", key, value) }
+
+// PutBool adds a boolean extra.
+func (i *Intent) PutBool(key string, value bool) *Intent {
+	return i.putExtra("--ez", key, strconv.FormatBool(value))
+}
+
+// PutInt adds an int extra.
+func (i *Intent) PutInt(key string, value int32) *Intent {
+	return i.putExtra("--ei", key, strconv.FormatInt(int64(value), 10))
+}
+
+// PutLong adds a long extra.
+func (i *Intent) PutLong(key string, value int64) *Intent {
+	return i.putExtra("--el", key, strconv.FormatInt(value, 10))
+}
+
+// PutFloat adds a float extra.
+func (i *Intent) PutFloat(key string, value float32) *Intent {
+	return i.putExtra("--ef", key, strconv.FormatFloat(float64(value), 'g', -1, 32))
+}
+
+// PutURI adds a Uri extra.
+func (i *Intent) PutURI(key, uri string) *Intent { return i.putExtra("--eu", key, uri) }
+
+// PutComponent adds a ComponentName extra, e.g. "com.example/.MyService".
+func (i *Intent) PutComponent(key, component string) *Intent {
+	return i.putExtra("--ecn", key, component)
+}
+
+// PutStringArray adds a String[] extra.
+func (i *Intent) PutStringArray(key string, values []string) *Intent {
+	escaped := make([]string, len(values))
+	for j, value := range values {
+		// am splits the array at commas that aren't escaped.
+		escaped[j] = strings.Replace(value, ",", `\,`, -1)
+	}
+	return i.putExtra("--esa", key, strings.Join(escaped, ","))
+}
+
+// PutIntArray adds an int[] extra.
+func (i *Intent) PutIntArray(key string, values []int32) *Intent {
+	strs := make([]string, len(values))
+	for j, value := range values {
+		strs[j] = strconv.FormatInt(int64(value), 10)
+	}
+	return i.putExtra("--eia", key, strings.Join(strs, ","))
+}
+
+// PutNull adds a null String extra.
+func (i *Intent) PutNull(key string) *Intent {
+	i.extras = append(i.extras, "--esn", key)
+	return i
+}
+
+// args returns the intent's arguments to am, quoted for the device's shell.
+func (i *Intent) args() string {
+	var args []string
+	add := func(flag, value string) {
+		if value != "" {
+			args = append(args, flag, shellQuote(value))
+		}
+	}
+	add("-a", i.Action)
+	add("-d", i.Data)
+	add("-t", i.MIMEType)
+	for _, category := range i.Categories {
+		add("-c", category)
+	}
+	add("-n", i.Component)
+	add("-p", i.Package)
+	if i.Flags != 0 {
+		args = append(args, "-f", strconv.Itoa(i.Flags))
+	}
+	for j := 0; j < len(i.extras); {
+		// Null extras have no value.
+		n := 3
+		if i.extras[j] == "--esn" {
+			n = 2
+		}
+		args = append(args, i.extras[j])
+		for _, arg := range i.extras[j+1 : j+n] {
+			args = append(args, shellQuote(arg))
+		}
+		j += n
+	}
+	return strings.Join(args, " ")
+}
+
+// IntentOptions configures StartActivity, StartService and SendBroadcast.
+type IntentOptions struct {
+	// Wait waits for the activity to finish launching, and reports how long it took. Only
+	// used by StartActivity.
+	Wait bool
+	// User, if positive, delivers the intent as the user with that ID, e.g. a work profile.
+	// By default, the current user's components receive it.
+	User int
+	// Debug waits for a debugger to attach to the activity's process before it runs. Only
+	// used by StartActivity, and only for debuggable apps.
+	Debug bool
+}
+
+// StartResult reports how StartActivity went.
+type StartResult struct {
+	// Warning is set if the activity wasn't started, but that's not an error, e.g. "Activity
+	// not started, its current task has been brought to the front".
+	Warning string
+
+	// The rest are only reported with IntentOptions.Wait. Status is e.g. "ok" or "timeout",
+	// LaunchState e.g. "COLD" or "WARM", and Activity the activity that was launched.
+	Status      string
+	LaunchState string
+	Activity    string
+	// TotalTime is how long the activity took to launch, and WaitTime how long am waited.
+	TotalTime, WaitTime time.Duration
+}
+
+// BroadcastResult reports the result SendBroadcast's receivers set.
+type BroadcastResult struct {
+	Code int
+	// Data is the result data, or "" if none was set.
+	Data string
+}
+
+/*
+StartActivity starts the activity intent resolves to. If am reports an error, the error has
+code FileNoExistError if no activity matches the intent, PermissionDenied if the activity
+isn't exported or the shell isn't allowed to start it, or AdbError otherwise. If ctx is done,
+the error has code Timeout, and the activity may still start.
+
+Requires a device running Android L or later (see OpenExec).
+
+Corresponds to the command:
+
+	adb shell am start [-W] [-D] [--user <user>] <intent>
+*/
+func (c *Device) StartActivity(ctx context.Context, intent *Intent, opts IntentOptions) (*StartResult, error) {
+	cmd := "am start"
+	if opts.Wait {
+		cmd += " -W"
+	}
+	if opts.Debug {
+		cmd += " -D"
+	}
+	output, err := c.runActivityManager(ctx, cmd, intent, opts)
+	if err != nil {
+		return nil, wrapClientError(err, c, "StartActivity")
+	}
+	result, err := parseStartResult(output)
+	return result, wrapClientError(err, c, "StartActivity")
+}
+
+/*
+StartService starts the service intent resolves to, like StartActivity. Since Android O, apps
+in the background can't start services, but foreground services can be started with
+StartForegroundService.
+
+Corresponds to the command:
+
+	adb shell am startservice [--user <user>] <intent>
+*/
+func (c *Device) StartService(ctx context.Context, intent *Intent, opts IntentOptions) error {
+	_, err := c.runActivityManager(ctx, "am startservice", intent, opts)
+	return wrapClientError(err, c, "StartService")
+}
+
+/*
+StartForegroundService starts the service intent resolves to as a foreground service, which
+must then call startForeground. Requires a device running Android O or later.
+
+Corresponds to the command:
+
+	adb shell am start-foreground-service [--user <user>] <intent>
+*/
+func (c *Device) StartForegroundService(ctx context.Context, intent *Intent, opts IntentOptions) error {
+	_, err := c.runActivityManager(ctx, "am start-foreground-service", intent, opts)
+	return wrapClientError(err, c, "StartForegroundService")
+}
+
+/*
+SendBroadcast broadcasts intent, waits for its receivers to handle it, and returns the result
+they set.
+
+Corresponds to the command:
+
+	adb shell am broadcast [--user <user>] <intent>
+*/
+func (c *Device) SendBroadcast(ctx context.Context, intent *Intent, opts IntentOptions) (*BroadcastResult, error) {
+	output, err := c.runActivityManager(ctx, "am broadcast", intent, opts)
+	if err != nil {
+		return nil, wrapClientError(err, c, "SendBroadcast")
+	}
+	result, err := parseBroadcastResult(output)
+	return result, wrapClientError(err, c, "SendBroadcast")
+}
+
+// runActivityManager runs the am command cmd with intent, over exec: so ctx can stop it and
+// its stderr is merged into its output, and returns the output, or the error it reports.
+func (c *Device) runActivityManager(ctx context.Context, cmd string, intent *Intent, opts IntentOptions) (string, error) {
+	if opts.User > 0 {
+		cmd += " --user " + strconv.Itoa(opts.User)
+	}
+	conn, err := c.openExec(cmd + " " + intent.args())
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	stop := closeWhenDone(ctx, conn)
+	defer stop()
+
+	output, err := io.ReadAll(conn)
+	if ctx.Err() != nil {
+		return "", errors.WrapErrorf(ctx.Err(), errors.Timeout, "%s cancelled", cmd)
+	}
+	if err != nil {
+		if _, ok := err.(*errors.Err); !ok {
+			err = errors.WrapErrorf(err, errors.NetworkError, "error reading output of %s", cmd)
+		}
+		return "", err
+	}
+
+	// am prints errors on lines starting with Error, sometimes after other output, e.g.
+	//
+	//	Starting: Intent { act=android.intent.action.MAIN cmp=com.example/.Missing }
+	//	Error type 3
+	//	Error: Activity class {com.example/com.example.Missing} does not exist.
+	//
+	// or as an exception, e.g. "java.lang.SecurityException: Permission Denial: ...". Other
+	// lines that only mention an exception, like extras echoed back, aren't failures.
+	var failure []string
+	for _, line := range strings.Split(string(output), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "Error") || amExceptionPattern.MatchString(line) || failure != nil && line != "" {
+			failure = append(failure, line)
+		}
+	}
+	if failure != nil {
+		message := strings.Join(failure, "\n")
+		return "", errors.Errorf(packageCommandErrorCode(message), "%s failed: %s", cmd, message)
+	}
+	return string(output), nil
+}
+
+// Matches the first line of an exception printed by am, e.g. "java.lang.SecurityException: ...".
+var amExceptionPattern = regexp.MustCompile(`^\S+Exception:`)
+
+// parseStartResult parses the output of am start, e.g. with -W:
+//
+//	Starting: Intent { act=android.intent.action.MAIN cmp=com.example/.MainActivity }
+//	Status: ok
+//	LaunchState: COLD
+//	Activity: com.example/.MainActivity
+//	TotalTime: 345
+//	WaitTime: 350
+//	Complete
+func parseStartResult(output string) (*StartResult, error) {
+	result := &StartResult{}
+	for _, line := range strings.Split(output, "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		var err error
+		switch key {
+		case "Warning":
+			result.Warning = value
+		case "Status":
+			result.Status = value
+		case "LaunchState":
+			result.LaunchState = value
+		case "Activity":
+			result.Activity = value
+		case "TotalTime":
+			result.TotalTime, err = parseMillis(value)
+		case "WaitTime":
+			result.WaitTime, err = parseMillis(value)
+		}
+		if err != nil {
+			return nil, errors.WrapErrorf(err, errors.ParseError, "invalid %s in am start output: %q", key, value)
+		}
+	}
+	return result, nil
+}
+
+func parseMillis(s string) (time.Duration, error) {
+	ms, err := strconv.ParseInt(s, 10, 64)
+	return time.Duration(ms) * time.Millisecond, err
+}
+
+// parseBroadcastResult parses the output of am broadcast, e.g.
+//
+//	Broadcasting: Intent { act=com.example.PING flg=0x400000 }
+//	Broadcast completed: result=-1, data="pong"
+func parseBroadcastResult(output string) (*BroadcastResult, error) {
+	for _, line := range strings.Split(output, "\n") {
+		rest := strings.TrimPrefix(strings.TrimSpace(line), "Broadcast completed: result=")
+		if rest == strings.TrimSpace(line) {
+			continue
+		}
+		code, data, _ := strings.Cut(rest, ", data=")
+		n, err := strconv.Atoi(strings.TrimSpace(code))
+		if err != nil {
+			return nil, errors.WrapErrorf(err, errors.ParseError, "invalid broadcast result: %q", line)
+		}
+		// Extras the receivers set follow the data.
+		data, _, _ = strings.Cut(data, ", extras:")
+		data = strings.TrimSpace(data)
+		if unquoted, err := strconv.Unquote(data); err == nil {
+			data = unquoted
+		}
+		return &BroadcastResult{Code: n, Data: data}, nil
+	}
+	return nil, errors.Errorf(errors.AdbError, "broadcast didn't complete: %s", strings.TrimSpace(output))
+}
@@ -0,0 +1,97 @@
+package adb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mqhack/goadb/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIntentArgs(t *testing.T) {
+	intent := NewIntent("android.intent.action.VIEW").
+		AddCategory("android.intent.category.BROWSABLE").
+		PutString("title", "it's a test").
+		PutBool("debug", true).
+		PutInt("count", 3).
+		PutLong("id", 1<<40).
+		PutFloat("ratio", 0.5).
+		PutStringArray("tags", []string{"a,b", "c"}).
+		PutIntArray("ids", []int32{1, 2}).
+		PutNull("empty")
+	intent.Data = "https://example.com/?q=1&r=2"
+	intent.Component = "com.example/.MainActivity"
+	intent.Flags = 0x10000000
+	assert.Equal(t, `-a 'android.intent.action.VIEW' -d 'https://example.com/?q=1&r=2' `+
+		`-c 'android.intent.category.BROWSABLE' -n 'com.example/.MainActivity' -f 268435456 `+
+		`--es 'title' 'it'\''s a test' --ez 'debug' 'true' --ei 'count' '3' --el 'id' '1099511627776' `+
+		`--ef 'ratio' '0.5' --esa 'tags' 'a\,b,c' --eia 'ids' '1,2' --esn 'empty'`, intent.args())
+}
+
+func TestStartActivity(t *testing.T) {
+	s := &MockServer{Status: wire.StatusSuccess, Messages: []string{
+		"Starting: Intent { act=android.intent.action.MAIN cmp=com.example/.MainActivity }\n" +
+			"Status: ok\nLaunchState: COLD\nActivity: com.example/.MainActivity\nTotalTime: 345\nWaitTime: 350\nComplete\n",
+	}}
+	intent := &Intent{Component: "com.example/.MainActivity"}
+	result, err := (&Adb{server: s}).Device(AnyDevice()).StartActivity(context.Background(), intent,
+		IntentOptions{Wait: true, User: 10})
+	require.NoError(t, err)
+	assert.Equal(t, &StartResult{Status: "ok", LaunchState: "COLD", Activity: "com.example/.MainActivity",
+		TotalTime: 345 * time.Millisecond, WaitTime: 350 * time.Millisecond}, result)
+	assert.Equal(t, "exec:am start -W --user 10 -n 'com.example/.MainActivity'", s.Requests[1])
+}
+
+func TestStartActivityErrors(t *testing.T) {
+	for output, code := range map[string]ErrCode{
+		"Starting: Intent { cmp=com.example/.Missing }\nError type 3\n" +
+			"Error: Activity class {com.example/com.example.Missing} does not exist.\n": FileNoExistError,
+		"Starting: Intent { act=com.example.NOPE }\n" +
+			"Error: Activity not started, unable to resolve Intent { act=com.example.NOPE flg=0x10000000 }\n": FileNoExistError,
+		"Starting: Intent { cmp=com.example/.Private }\n" +
+			"java.lang.SecurityException: Permission Denial: starting Intent { cmp=com.example/.Private } not exported\n": PermissionDenied,
+	} {
+		s := &MockServer{Status: wire.StatusSuccess, Messages: []string{output}}
+		_, err := (&Adb{server: s}).Device(AnyDevice()).StartActivity(context.Background(), NewIntent("x"), IntentOptions{})
+		assert.True(t, HasErrCode(err, code), "%q: %v", output, err)
+	}
+}
+
+func TestStartActivityWarning(t *testing.T) {
+	result, err := parseStartResult("Starting: Intent { cmp=com.example/.MainActivity }\n" +
+		"Warning: Activity not started, its current task has been brought to the front\n")
+	require.NoError(t, err)
+	assert.Equal(t, "Activity not started, its current task has been brought to the front", result.Warning)
+}
+
+func TestStartService(t *testing.T) {
+	s := &MockServer{Status: wire.StatusSuccess, Messages: []string{
+		"Starting service: Intent { cmp=com.example/.Sync }\nError: Not found; no service started.\n"}}
+	err := (&Adb{server: s}).Device(AnyDevice()).StartService(context.Background(),
+		&Intent{Component: "com.example/.Sync"}, IntentOptions{})
+	assert.True(t, HasErrCode(err, FileNoExistError))
+	assert.Equal(t, "exec:am startservice -n 'com.example/.Sync'", s.Requests[1])
+}
+
+func TestSendBroadcast(t *testing.T) {
+	s := &MockServer{Status: wire.StatusSuccess, Messages: []string{
+		"Broadcasting: Intent { act=com.example.PING flg=0x400000 }\nBroadcast completed: result=-1, data=\"pong, ok\"\n"}}
+	result, err := (&Adb{server: s}).Device(AnyDevice()).SendBroadcast(context.Background(),
+		NewIntent("com.example.PING"), IntentOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, &BroadcastResult{Code: -1, Data: "pong, ok"}, result)
+
+	// Data that mentions an exception isn't mistaken for am failing.
+	s = &MockServer{Status: wire.StatusSuccess, Messages: []string{
+		"Broadcasting: Intent { act=com.example.CHECK flg=0x400000 }\nBroadcast completed: result=1, data=\"no IOException: ok\"\n"}}
+	result, err = (&Adb{server: s}).Device(AnyDevice()).SendBroadcast(context.Background(),
+		NewIntent("com.example.CHECK"), IntentOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, &BroadcastResult{Code: 1, Data: "no IOException: ok"}, result)
+
+	result, err = parseBroadcastResult("Broadcast completed: result=0\n")
+	require.NoError(t, err)
+	assert.Equal(t, &BroadcastResult{}, result)
+}
@@ -4,9 +4,9 @@ package errors
 
 import "fmt"
 
-const _ErrCode_name = "AssertionErrorParseErrorServerNotAvailableNetworkErrorConnectionResetErrorAdbErrorDeviceNotFoundFileNoExistError"
+const _ErrCode_name = "AssertionErrorParseErrorServerNotAvailableNetworkErrorConnectionResetErrorAdbErrorDeviceNotFoundFileNoExistErrorTimeoutRequirementNotMetServerRestrictedUntrustedDeviceNodeNotFoundChecksumMismatchPermissionDeniedReadOnlyFileSystemFileExistErrorPackageManagerError"
 
-var _ErrCode_index = [...]uint8{0, 14, 24, 42, 54, 74, 82, 96, 112}
+var _ErrCode_index = [...]uint16{0, 14, 24, 42, 54, 74, 82, 96, 112, 119, 136, 152, 167, 179, 195, 211, 229, 243, 262}
 
 func (i ErrCode) String() string {
 	if i >= ErrCode(len(_ErrCode_index)-1) {
@@ -50,6 +50,31 @@ const (
 	DeviceNotFound
 	// Tried to perform an operation on a path that doesn't exist on the device.
 	FileNoExistError
+	// The operation didn't finish before its deadline, or its context was cancelled.
+	Timeout
+	// The device doesn't meet a requirement checked by the operation, e.g. it's running the
+	// wrong build.
+	RequirementNotMet
+	// The server doesn't allow access to the device, e.g. because it was started with
+	// --one-device for a different device.
+	ServerRestricted
+	// The device's certificate doesn't match the one it was first trusted with, or has been
+	// revoked.
+	UntrustedDevice
+	// No view on the screen matches a UI selector.
+	NodeNotFound
+	// A transferred file's checksum on the device doesn't match the checksum of the data
+	// sent or received.
+	ChecksumMismatch
+	// The device refused access to a file.
+	PermissionDenied
+	// Tried to modify a file on a file system the device has mounted read-only.
+	ReadOnlyFileSystem
+	// Tried to create a file at a path that already exists on the device.
+	FileExistError
+	// The package manager refused to install or uninstall a package. The error's Details is
+	// the reason it gave.
+	PackageManagerError
 )
 
 func Errorf(code ErrCode, format string, args ...interface{}) error {
@@ -136,6 +161,18 @@ func WrapErrorf(cause error, code ErrCode, format string, args ...interface{}) e
 	}
 }
 
+/*
+WrapAnyErrf wraps cause like WrapErrf if it's an *Err, keeping its ErrCode, and like
+WrapErrorf with code otherwise. Use it for errors returned through interfaces that may be
+implemented outside this module.
+*/
+func WrapAnyErrf(cause error, code ErrCode, format string, args ...interface{}) error {
+	if _, ok := cause.(*Err); ok {
+		return WrapErrf(cause, format, args...)
+	}
+	return WrapErrorf(cause, code, format, args...)
+}
+
 func AssertionErrorf(format string, args ...interface{}) error {
 	return &Err{
 		Code:    AssertionError,
@@ -42,3 +42,13 @@ func TestCombineErrors(t *testing.T) {
 	assert.Equal(t, `AdbError: hello
 caused by 2 errors: [lulz ∪ fail]`, ErrorWithCauseChain(err))
 }
+
+func TestWrapAnyErrf(t *testing.T) {
+	assert.NoError(t, WrapAnyErrf(nil, NetworkError, "hello"))
+
+	err := WrapAnyErrf(errors.New("lulz"), NetworkError, "hello")
+	assert.EqualError(t, err, "NetworkError: hello")
+
+	err = WrapAnyErrf(&Err{Code: FileNoExistError, Message: "lulz"}, NetworkError, "hello")
+	assert.EqualError(t, err, "FileNoExistError: hello")
+}
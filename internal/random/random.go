@@ -0,0 +1,26 @@
+// Package random generates the random names goadb gives to files, markers and sessions it
+// creates on devices.
+package random
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+// Uint64 returns a random number from crypto/rand, so that names made from it don't collide
+// with ones made by other Devices or processes.
+func Uint64() uint64 {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		// The clock is unique enough for names that are only used once.
+		return uint64(time.Now().UnixNano())
+	}
+	return binary.BigEndian.Uint64(b[:])
+}
+
+// ID returns 16 random hex digits.
+func ID() string {
+	return fmt.Sprintf("%016x", Uint64())
+}
@@ -0,0 +1,181 @@
+package adb
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mqhack/goadb/wire"
+)
+
+// Number of round trips LinkQuality measures.
+const linkQualitySamples = 5
+
+// tcpStateEstablished is the value of the st column in /proc/net/tcp for established sockets.
+const tcpStateEstablished = "01"
+
+// LinkQuality describes the health of the transport to a device.
+type LinkQuality struct {
+	// Endpoint is the host:port the adb server is connected to, for TCP devices.
+	// It's empty for USB devices.
+	Endpoint string
+
+	// Round-trip latency to adbd, over the samples that succeeded.
+	MinLatency  time.Duration
+	MeanLatency time.Duration
+	MaxLatency  time.Duration
+
+	// Samples is the number of round trips attempted, and Failures the number of those
+	// that failed, usually because the transport dropped and had to be reopened.
+	Samples  int
+	Failures int
+
+	// Retransmits is the number of retransmission timeouts on adbd's established TCP
+	// sockets for Endpoint, as reported by the device's kernel.
+	// It's -1 for USB devices, or if the device doesn't report it.
+	Retransmits int
+}
+
+// IsTCP returns true if the device is connected over TCP, e.g. Wi-Fi.
+func (q *LinkQuality) IsTCP() bool {
+	return q.Endpoint != ""
+}
+
+/*
+LinkQuality measures the round-trip latency to adbd and reports recent connection problems,
+so callers can prefer a stable transport (e.g. USB) when a device is reachable more than one
+way.
+
+Latency is measured with sync protocol STAT requests, which are handled by adbd itself
+without starting a process. Retransmits are read from /proc/net/tcp on the device, assuming
+adbd listens on the port the server is connected to.
+*/
+func (c *Device) LinkQuality() (*LinkQuality, error) {
+	serial, err := c.Serial()
+	if err != nil {
+		return nil, wrapClientError(err, c, "LinkQuality")
+	}
+
+	quality := &LinkQuality{
+		Endpoint:    tcpEndpoint(serial),
+		Retransmits: -1,
+	}
+
+	if err := c.measureLatency(quality, linkQualitySamples); err != nil {
+		return nil, wrapClientError(err, c, "LinkQuality")
+	}
+
+	if quality.IsTCP() {
+		_, port, _ := net.SplitHostPort(quality.Endpoint)
+		// Older devices don't have tcp6, so ignore errors from cat as long as the output
+		// has at least one table.
+		if output, err := c.RunCommand("cat", "/proc/net/tcp", "/proc/net/tcp6"); err == nil {
+			quality.Retransmits = parseTCPRetransmits(output, port)
+		}
+	}
+
+	return quality, nil
+}
+
+// measureLatency times samples round trips to adbd and records the results in quality.
+// Returns an error only if every sample failed.
+func (c *Device) measureLatency(quality *LinkQuality, samples int) error {
+	var conn *wire.SyncConn
+	defer func() {
+		if conn != nil {
+			conn.Close()
+		}
+	}()
+
+	var total time.Duration
+	var lastErr error
+	for i := 0; i < samples; i++ {
+		quality.Samples++
+
+		if conn == nil {
+			var err error
+			if conn, err = c.getSyncConn(); err != nil {
+				quality.Failures++
+				lastErr = err
+				continue
+			}
+		}
+
+		start := time.Now()
+		if _, err := stat(conn, "/"); err != nil {
+			// The connection is in an unknown state, so don't reuse it.
+			conn.Close()
+			conn = nil
+			quality.Failures++
+			lastErr = err
+			continue
+		}
+		latency := time.Since(start)
+
+		if quality.MinLatency == 0 || latency < quality.MinLatency {
+			quality.MinLatency = latency
+		}
+		if latency > quality.MaxLatency {
+			quality.MaxLatency = latency
+		}
+		total += latency
+	}
+
+	if succeeded := quality.Samples - quality.Failures; succeeded > 0 {
+		quality.MeanLatency = total / time.Duration(succeeded)
+		return nil
+	}
+	return lastErr
+}
+
+// tcpEndpoint returns serial if it's the host:port of a TCP device, else "".
+func tcpEndpoint(serial string) string {
+	host, port, err := net.SplitHostPort(serial)
+	if err != nil || host == "" {
+		return ""
+	}
+	if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+		return ""
+	}
+	return serial
+}
+
+// parseTCPRetransmits sums the retrnsmt column of the established sockets in the
+// /proc/net/tcp-format tables in output whose local port is port.
+// Returns -1 if no table could be found.
+func parseTCPRetransmits(output string, port string) int {
+	portNum, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return -1
+	}
+	// Addresses are formatted as hex IP:port.
+	portSuffix := fmt.Sprintf(":%04X", portNum)
+
+	retransmits := -1
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		// sl local_address rem_address st tx_queue:rx_queue tr:tm->when retrnsmt uid ...
+		fields := strings.Fields(scanner.Text())
+		if len(fields) > 0 && fields[0] == "sl" {
+			if retransmits < 0 {
+				retransmits = 0
+			}
+			continue
+		}
+		if retransmits < 0 || len(fields) < 7 {
+			continue
+		}
+		if fields[3] != tcpStateEstablished || !strings.HasSuffix(strings.ToUpper(fields[1]), portSuffix) {
+			continue
+		}
+		count, err := strconv.ParseUint(fields[6], 16, 32)
+		if err != nil {
+			continue
+		}
+		retransmits += int(count)
+	}
+	return retransmits
+}
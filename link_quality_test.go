@@ -0,0 +1,85 @@
+package adb
+
+import (
+	"testing"
+
+	"github.com/mqhack/goadb/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// statResponse is a sync STAT response for a directory.
+const statResponse = "STAT\xed\x41\x00\x00\x00\x10\x00\x00\x00\x00\x00\x00"
+
+const procNetTCP = `  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 00000000:15B3 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 1234 1
+   1: 0501A8C0:15B3 0201A8C0:D431 01 00000000:00000000 00:00000000 00000003     0        0 5678 1
+   2: 0501A8C0:15B3 0201A8C0:D432 06 00000000:00000000 00:00000000 00000009     0        0 0 1
+   3: 0501A8C0:1F90 0201A8C0:D433 01 00000000:00000000 00:00000000 00000007     0        0 9999 1
+`
+
+func TestLinkQualityTCP(t *testing.T) {
+	s := &MockServer{
+		Status: wire.StatusSuccess,
+		Messages: []string{
+			"192.168.1.5:5555",
+			statResponse, statResponse, statResponse, statResponse, statResponse,
+			procNetTCP,
+		},
+	}
+	device := (&Adb{server: s}).Device(AnyDevice())
+
+	quality, err := device.LinkQuality()
+	require.NoError(t, err)
+	assert.True(t, quality.IsTCP())
+	assert.Equal(t, "192.168.1.5:5555", quality.Endpoint)
+	assert.Equal(t, linkQualitySamples, quality.Samples)
+	assert.Equal(t, 0, quality.Failures)
+	assert.Equal(t, 3, quality.Retransmits)
+	assert.True(t, quality.MinLatency <= quality.MeanLatency)
+	assert.True(t, quality.MeanLatency <= quality.MaxLatency)
+	assert.Equal(t, "shell:cat /proc/net/tcp /proc/net/tcp6", s.Requests[len(s.Requests)-1])
+}
+
+func TestLinkQualityUSBWithFailures(t *testing.T) {
+	s := &MockServer{
+		Status: wire.StatusSuccess,
+		Messages: []string{
+			"0123456789ABCDEF",
+			statResponse, "FAIL\x04\x00\x00\x00oops", statResponse, statResponse, statResponse,
+		},
+	}
+	device := (&Adb{server: s}).Device(AnyDevice())
+
+	quality, err := device.LinkQuality()
+	require.NoError(t, err)
+	assert.False(t, quality.IsTCP())
+	assert.Equal(t, 1, quality.Failures)
+	assert.Equal(t, -1, quality.Retransmits)
+}
+
+func TestLinkQualityAllFailed(t *testing.T) {
+	s := &MockServer{
+		Status:   wire.StatusSuccess,
+		Messages: []string{"0123456789ABCDEF"},
+	}
+	device := (&Adb{server: s}).Device(AnyDevice())
+
+	_, err := device.LinkQuality()
+	assert.True(t, HasErrCode(err, NetworkError), "%v", err)
+}
+
+func TestTCPEndpoint(t *testing.T) {
+	assert.Equal(t, "192.168.1.5:5555", tcpEndpoint("192.168.1.5:5555"))
+	assert.Equal(t, "[fe80::1]:5555", tcpEndpoint("[fe80::1]:5555"))
+	assert.Equal(t, "", tcpEndpoint("0123456789ABCDEF"))
+	assert.Equal(t, "", tcpEndpoint("emulator-5554"))
+	assert.Equal(t, "", tcpEndpoint("adb-123._adb-tls-connect._tcp"))
+}
+
+func TestParseTCPRetransmits(t *testing.T) {
+	assert.Equal(t, 3, parseTCPRetransmits(procNetTCP, "5555"))
+	assert.Equal(t, 7, parseTCPRetransmits(procNetTCP, "8080"))
+	assert.Equal(t, 0, parseTCPRetransmits(procNetTCP, "1234"))
+	assert.Equal(t, -1, parseTCPRetransmits("cat: /proc/net/tcp: No such file", "5555"))
+}
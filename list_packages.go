@@ -0,0 +1,131 @@
+package adb
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/mqhack/goadb/internal/errors"
+)
+
+// ListPackagesOptions filters the packages Device.ListPackages returns. By default, the
+// packages installed for the system user, 0, are returned, like pm list packages does.
+type ListPackagesOptions struct {
+	// ThirdPartyOnly returns only the packages the user installed, and SystemOnly only the ones
+	// in the system image.
+	ThirdPartyOnly, SystemOnly bool
+	// Enabled returns only the enabled packages, and Disabled only the disabled ones.
+	Enabled, Disabled bool
+	// UID, if positive, returns only the packages with that UID, which is more than one if
+	// they share a user ID.
+	UID int
+	// User, if positive, returns the packages installed for the user with that ID, e.g. a work
+	// profile, instead of the system user's.
+	User int
+}
+
+// args returns the arguments of pm list packages for the options.
+func (o ListPackagesOptions) args() []string {
+	args := []string{"list", "packages", "-f", "-U", "-i", "--show-versioncode"}
+	for _, flag := range []struct {
+		set  bool
+		flag string
+	}{
+		{o.ThirdPartyOnly, "-3"},
+		{o.SystemOnly, "-s"},
+		{o.Enabled, "-e"},
+		{o.Disabled, "-d"},
+	} {
+		if flag.set {
+			args = append(args, flag.flag)
+		}
+	}
+	if o.UID > 0 {
+		args = append(args, "--uid", strconv.Itoa(o.UID))
+	}
+	if o.User > 0 {
+		args = append(args, "--user", strconv.Itoa(o.User))
+	}
+	return args
+}
+
+// PackageEntry is an installed package listed by Device.ListPackages.
+type PackageEntry struct {
+	Package string
+	// APKPath is the path of the package's base APK.
+	APKPath     string
+	VersionCode int64
+	UID         int
+	// Installer is the package that installed it, e.g. com.android.vending, or "" if it
+	// wasn't installed by a package, like the system image's packages and ones installed
+	// with adb.
+	Installer string
+}
+
+/*
+ListPackages returns the packages installed on the device, filtered by opts, in the order
+the package manager lists them.
+
+Corresponds to the command:
+
+	adb shell pm list packages -f -U -i --show-versioncode
+*/
+func (c *Device) ListPackages(opts ListPackagesOptions) ([]PackageEntry, error) {
+	output, err := c.RunCommand("pm", opts.args()...)
+	if err != nil {
+		return nil, wrapClientError(err, c, "ListPackages")
+	}
+	packages, err := parsePackageList(output)
+	return packages, wrapClientError(err, c, "ListPackages")
+}
+
+// parsePackageList parses the output of pm list packages -f -U -i --show-versioncode, e.g.
+//
+//	package:/data/app/~~k3Pa4w==/com.example-Xy9z==/base.apk=com.example versionCode:42  installer=com.android.vending uid:10123
+//
+// Versions that don't know an option leave its field out.
+func parsePackageList(output string) ([]PackageEntry, error) {
+	var packages []PackageEntry
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if !strings.HasPrefix(line, "package:") {
+			// pm prints errors, e.g. for an unknown user, instead of the list.
+			return nil, errors.Errorf(errors.AdbError, "error listing packages: %s", line)
+		}
+		fields := strings.Fields(strings.TrimPrefix(line, "package:"))
+		if len(fields) == 0 {
+			return nil, errors.Errorf(errors.ParseError, "invalid package line %q", line)
+		}
+
+		var entry PackageEntry
+		// The path contains = in the random parts of its directories, but the name doesn't.
+		if i := strings.LastIndex(fields[0], "="); i >= 0 {
+			entry.APKPath, entry.Package = fields[0][:i], fields[0][i+1:]
+		} else {
+			entry.Package = fields[0]
+		}
+		for _, field := range fields[1:] {
+			var err error
+			switch {
+			case strings.HasPrefix(field, "versionCode:"):
+				entry.VersionCode, err = strconv.ParseInt(strings.TrimPrefix(field, "versionCode:"), 10, 64)
+			case strings.HasPrefix(field, "uid:"):
+				// Packages installed for several users can list a UID for each, which only
+				// differ in the user.
+				uid, _, _ := strings.Cut(strings.TrimPrefix(field, "uid:"), ",")
+				entry.UID, err = strconv.Atoi(uid)
+			case strings.HasPrefix(field, "installer="):
+				if entry.Installer = strings.TrimPrefix(field, "installer="); entry.Installer == "null" {
+					entry.Installer = ""
+				}
+			}
+			if err != nil {
+				return nil, errors.WrapErrorf(err, errors.ParseError, "invalid package line %q", line)
+			}
+		}
+		packages = append(packages, entry)
+	}
+	return packages, nil
+}
@@ -0,0 +1,36 @@
+package adb
+
+import (
+	"testing"
+
+	"github.com/mqhack/goadb/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePackageList(t *testing.T) {
+	packages, err := parsePackageList(
+		"package:/data/app/~~k3Pa4w==/com.example-Xy9z==/base.apk=com.example versionCode:42  installer=com.android.vending uid:10123\r\n" +
+			"package:/system/priv-app/Settings/Settings.apk=com.android.settings versionCode:34  installer=null uid:1000,1010000\r\n" +
+			"package:com.old\r\n")
+	require.NoError(t, err)
+	assert.Equal(t, []PackageEntry{
+		{Package: "com.example", APKPath: "/data/app/~~k3Pa4w==/com.example-Xy9z==/base.apk", VersionCode: 42, UID: 10123,
+			Installer: "com.android.vending"},
+		{Package: "com.android.settings", APKPath: "/system/priv-app/Settings/Settings.apk", VersionCode: 34, UID: 1000},
+		{Package: "com.old"},
+	}, packages)
+
+	_, err = parsePackageList("Error: Unknown user 42\n")
+	assert.True(t, HasErrCode(err, AdbError))
+	_, err = parsePackageList("package:com.example versionCode:x\n")
+	assert.True(t, HasErrCode(err, ParseError))
+}
+
+func TestListPackagesArgs(t *testing.T) {
+	s := &MockServer{Status: wire.StatusSuccess, Messages: []string{""}}
+	packages, err := (&Adb{server: s}).Device(AnyDevice()).ListPackages(ListPackagesOptions{ThirdPartyOnly: true, User: 10})
+	require.NoError(t, err)
+	assert.Empty(t, packages)
+	assert.Equal(t, "shell:pm list packages -f -U -i --show-versioncode -3 --user 10", s.Requests[1])
+}
@@ -0,0 +1,371 @@
+package adb
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/mqhack/goadb/internal/errors"
+)
+
+// LogPriority is the priority (aka level) of a log entry.
+type LogPriority byte
+
+const (
+	PriorityVerbose LogPriority = 'V'
+	PriorityDebug   LogPriority = 'D'
+	PriorityInfo    LogPriority = 'I'
+	PriorityWarn    LogPriority = 'W'
+	PriorityError   LogPriority = 'E'
+	PriorityFatal   LogPriority = 'F'
+	PrioritySilent  LogPriority = 'S'
+)
+
+func (p LogPriority) String() string {
+	return string(rune(p))
+}
+
+// LogcatFormat is an output format understood by LogcatOptions.
+type LogcatFormat string
+
+const (
+	// LogcatThreadtime prints one line per entry, with the date, time, PID and TID.
+	LogcatThreadtime LogcatFormat = "threadtime"
+	// LogcatLong prints a header line per entry, followed by the message lines and a
+	// blank line. Multi-line messages are kept as a single entry, which is only complete once
+	// the next entry's header is read.
+	LogcatLong LogcatFormat = "long"
+)
+
+// LogBuffer is one of the ring buffers logcat can read from.
+type LogBuffer string
+
+const (
+	LogBufferMain     LogBuffer = "main"
+	LogBufferSystem   LogBuffer = "system"
+	LogBufferRadio    LogBuffer = "radio"
+	LogBufferEvents   LogBuffer = "events"
+	LogBufferCrash    LogBuffer = "crash"
+	LogBufferKernel   LogBuffer = "kernel"
+	LogBufferStats    LogBuffer = "stats"
+	LogBufferSecurity LogBuffer = "security"
+	LogBufferAll      LogBuffer = "all"
+)
+
+// LogFilter is a filter spec that sets the minimum priority of entries shown for a tag.
+// Tag may be "*" to match every tag, e.g. LogFilter{"*", PrioritySilent} hides everything
+// not matched by another filter.
+type LogFilter struct {
+	Tag      string
+	Priority LogPriority
+}
+
+func (f LogFilter) String() string {
+	return fmt.Sprintf("%s:%s", f.Tag, f.Priority)
+}
+
+// LogEntry is a single parsed log message.
+type LogEntry struct {
+	// Time is when the entry was logged. Logcat doesn't print the year or time zone, so
+	// the current year and the host's local time zone are assumed.
+	Time     time.Time
+	PID      int
+	TID      int
+	Priority LogPriority
+	Tag      string
+	Message  string
+}
+
+// LogcatOptions configures the logcat command run by Device.Logcat.
+type LogcatOptions struct {
+	// Format of the output requested from logcat. Defaults to LogcatThreadtime.
+	Format LogcatFormat
+
+	// Buffers to read. If empty, logcat's default buffers are read (usually main, system
+	// and crash).
+	Buffers []LogBuffer
+
+	// Filters restrict the entries shown by tag and priority.
+	Filters []LogFilter
+
+	// If non-zero, only entries logged at or after Since are shown. It's interpreted in
+	// the device's time zone, so should be in the same location as the device's clock.
+	Since time.Time
+
+	// If positive, only the last Tail entries (and any logged after them) are shown.
+	// Ignored if Since is set.
+	Tail int
+
+	// If true, logcat prints the selected entries and exits instead of waiting for more.
+	Dump bool
+}
+
+// logcatTimeFormat is the format accepted by logcat's -t and -T options.
+const logcatTimeFormat = "01-02 15:04:05.000"
+
+// args returns the arguments to pass to logcat.
+func (opts LogcatOptions) args() []string {
+	format := opts.Format
+	if format == "" {
+		format = LogcatThreadtime
+	}
+	return append([]string{"-v", string(format)}, opts.selectionArgs()...)
+}
+
+// selectionArgs returns the arguments that select which entries logcat prints.
+func (opts LogcatOptions) selectionArgs() []string {
+	var args []string
+	for _, buffer := range opts.Buffers {
+		args = append(args, "-b", string(buffer))
+	}
+
+	// -t implies -d, -T is the same but keeps following the log.
+	startFlag := "-T"
+	if opts.Dump {
+		startFlag = "-t"
+	}
+	switch {
+	case !opts.Since.IsZero():
+		args = append(args, startFlag, opts.Since.Format(logcatTimeFormat))
+	case opts.Tail > 0:
+		args = append(args, startFlag, strconv.Itoa(opts.Tail))
+	case opts.Dump:
+		args = append(args, "-d")
+	}
+
+	for _, filter := range opts.Filters {
+		args = append(args, filter.String())
+	}
+	return args
+}
+
+/*
+LogcatStream delivers parsed log entries from a running logcat command.
+*/
+type LogcatStream struct {
+	entries chan LogEntry
+
+	// If an error occurs, it is stored here and entries is closed immediately after.
+	err atomic.Value
+}
+
+// C returns a channel that can be received on to get log entries.
+// The channel is closed when logcat exits, the context passed to Logcat is done, or an
+// error occurs.
+func (s *LogcatStream) C() <-chan LogEntry {
+	return s.entries
+}
+
+// Err returns the error that caused the channel returned by C to be closed, if C is closed.
+// It's nil if logcat exited normally or the context was done.
+// If C is not closed, its return value is undefined.
+func (s *LogcatStream) Err() error {
+	if err, ok := s.err.Load().(error); ok {
+		return err
+	}
+	return nil
+}
+
+/*
+Logcat runs logcat on the device and streams the parsed entries until ctx is done.
+
+Corresponds to the command:
+
+	adb logcat -v <format>
+*/
+func (c *Device) Logcat(ctx context.Context, opts LogcatOptions) (*LogcatStream, error) {
+	parser, err := newLogParser(opts.Format, time.Now())
+	if err != nil {
+		return nil, wrapClientError(err, c, "Logcat")
+	}
+
+	conn, err := c.openExec("logcat", opts.args()...)
+	if err != nil {
+		return nil, wrapClientError(err, c, "Logcat")
+	}
+
+	stream := &LogcatStream{entries: make(chan LogEntry)}
+	go func() {
+		defer close(stream.entries)
+		defer conn.Close()
+		stop := closeWhenDone(ctx, conn)
+		defer stop()
+
+		err := parseLogcat(ctx, bufio.NewScanner(conn), parser, c.getOutputEncoding(), stream.entries)
+		if err != nil && ctx.Err() == nil {
+			stream.err.Store(wrapClientError(err, c, "Logcat"))
+		}
+	}()
+	return stream, nil
+}
+
+/*
+ClearLogcat deletes all entries from the given buffers, or the default buffers if none
+are given.
+
+Corresponds to the command:
+
+	adb logcat -c [-b <buffer>...]
+*/
+func (c *Device) ClearLogcat(buffers ...LogBuffer) error {
+	args := []string{"-c"}
+	for _, buffer := range buffers {
+		args = append(args, "-b", string(buffer))
+	}
+
+	// logcat -c prints nothing on success.
+	output, err := c.RunCommand("logcat", args...)
+	if err != nil {
+		return wrapClientError(err, c, "ClearLogcat")
+	}
+	if output = strings.TrimSpace(output); output != "" {
+		return wrapClientError(errors.Errorf(errors.AdbError, "error clearing logcat: %s", output), c, "ClearLogcat")
+	}
+	return nil
+}
+
+// parseLogcat parses lines from scanner, normalized according to enc, and sends them on
+// entries until scanner is exhausted or ctx is done.
+func parseLogcat(ctx context.Context, scanner *bufio.Scanner, parser logParser, enc *OutputEncoding, entries chan<- LogEntry) error {
+	// Log messages can be up to ~4k, but give binary junk some headroom.
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	send := func(entry *LogEntry) bool {
+		if entry == nil {
+			return true
+		}
+		select {
+		case entries <- *entry:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	for scanner.Scan() {
+		// Logcat output may have CRLF line endings on old devices.
+		line, err := enc.normalizeLine(scanner.Text())
+		if err != nil {
+			return err
+		}
+		if !send(parser.ParseLine(line)) {
+			return nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return errors.WrapErrorf(err, errors.NetworkError, "error reading logcat output")
+	}
+	send(parser.Flush())
+	return nil
+}
+
+// logParser parses the output of logcat one line at a time.
+type logParser interface {
+	// ParseLine returns the entry completed by line, or nil if line doesn't complete one.
+	ParseLine(line string) *LogEntry
+	// Flush returns any partially-parsed entry once there is no more input.
+	Flush() *LogEntry
+}
+
+func newLogParser(format LogcatFormat, now time.Time) (logParser, error) {
+	switch format {
+	case LogcatThreadtime, "":
+		return &threadtimeParser{year: now.Year()}, nil
+	case LogcatLong:
+		return &longParser{year: now.Year()}, nil
+	default:
+		return nil, errors.Errorf(errors.AssertionError, "unsupported logcat format: %s", format)
+	}
+}
+
+// Matches e.g. "01-02 03:04:05.678  1234  5678 I ActivityManager: Start proc".
+// The tag may contain spaces, and is padded with spaces before the colon.
+var threadtimePattern = regexp.MustCompile(
+	`^(\d\d-\d\d \d\d:\d\d:\d\d\.\d+)\s+(\d+)\s+(\d+)\s+([VDIWEFS])\s(.*?)\s*: (.*)$`)
+
+type threadtimeParser struct {
+	year int
+}
+
+func (p *threadtimeParser) ParseLine(line string) *LogEntry {
+	match := threadtimePattern.FindStringSubmatch(line)
+	if match == nil {
+		// Most likely a "--------- beginning of main" divider.
+		return nil
+	}
+	return &LogEntry{
+		Time:     parseLogTime(p.year, match[1]),
+		PID:      atoiOrZero(match[2]),
+		TID:      atoiOrZero(match[3]),
+		Priority: LogPriority(match[4][0]),
+		Tag:      match[5],
+		Message:  match[6],
+	}
+}
+
+func (p *threadtimeParser) Flush() *LogEntry {
+	return nil
+}
+
+// Matches e.g. "[ 01-02 03:04:05.678  1234: 5678 I/ActivityManager ]".
+var longHeaderPattern = regexp.MustCompile(
+	`^\[ (\d\d-\d\d \d\d:\d\d:\d\d\.\d+)\s+(\d+):\s*(\d+) ([VDIWEFS])/(.*?)\s*\]$`)
+
+type longParser struct {
+	year    int
+	current *LogEntry
+	lines   []string
+}
+
+func (p *longParser) ParseLine(line string) *LogEntry {
+	if match := longHeaderPattern.FindStringSubmatch(line); match != nil {
+		done := p.Flush()
+		p.current = &LogEntry{
+			Time:     parseLogTime(p.year, match[1]),
+			PID:      atoiOrZero(match[2]),
+			TID:      atoiOrZero(match[3]),
+			Priority: LogPriority(match[4][0]),
+			Tag:      match[5],
+		}
+		return done
+	}
+	// Messages can contain blank lines, so an entry only ends at the next header. Dividers
+	// like "--------- beginning of main" go between entries.
+	if p.current == nil || strings.HasPrefix(line, "--------- ") {
+		return nil
+	}
+	p.lines = append(p.lines, line)
+	return nil
+}
+
+func (p *longParser) Flush() *LogEntry {
+	entry := p.current
+	if entry != nil {
+		// Drop the blank line that separates the entry from the next one.
+		if n := len(p.lines); n > 0 && p.lines[n-1] == "" {
+			p.lines = p.lines[:n-1]
+		}
+		entry.Message = strings.Join(p.lines, "\n")
+	}
+	p.current = nil
+	p.lines = nil
+	return entry
+}
+
+func parseLogTime(year int, s string) time.Time {
+	t, err := time.ParseInLocation("2006-01-02 15:04:05.999999999", fmt.Sprintf("%d-%s", year, s), time.Local)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+func atoiOrZero(s string) int {
+	n, _ := strconv.Atoi(s)
+	return n
+}
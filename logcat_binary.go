@@ -0,0 +1,396 @@
+package adb
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/mqhack/goadb/internal/errors"
+)
+
+// EventLogTagsPath is where devices list the names of the tags used in the events buffer.
+const EventLogTagsPath = "/system/etc/event-log-tags"
+
+// Header sizes of the struct logger_entry versions written by logcat -B.
+// Version 1 entries have a zero hdr_size field.
+const (
+	loggerEntryV1HeaderSize = 20
+	loggerEntryV3HeaderSize = 24
+	loggerEntryV4HeaderSize = 28
+)
+
+// Log buffer IDs (log_id_t), in the order defined by liblog.
+var logBufferIDs = []LogBuffer{
+	LogBufferMain,
+	LogBufferRadio,
+	LogBufferEvents,
+	LogBufferSystem,
+	LogBufferCrash,
+	LogBufferStats,
+	LogBufferSecurity,
+	LogBufferKernel,
+}
+
+// Priorities (android_LogPriority) used in the payload of text entries,
+// starting at ANDROID_LOG_VERBOSE.
+var binaryLogPriorities = []LogPriority{
+	PriorityVerbose,
+	PriorityDebug,
+	PriorityInfo,
+	PriorityWarn,
+	PriorityError,
+	PriorityFatal,
+	PrioritySilent,
+}
+
+// Types of the values in event payloads.
+const (
+	eventTypeInt    byte = 0
+	eventTypeLong   byte = 1
+	eventTypeString byte = 2
+	eventTypeList   byte = 3
+	eventTypeFloat  byte = 4
+)
+
+// RawLogEntry is a log entry in the binary format written by logcat -B.
+// The payload is left undecoded; use DecodeText or DecodeEvent depending on the buffer the
+// entry came from.
+type RawLogEntry struct {
+	Time time.Time
+	PID  int
+	TID  int
+	// Buffer the entry was read from, or "" if the device's header format doesn't include it.
+	Buffer LogBuffer
+	// UID of the process that logged the entry, or -1 if the header doesn't include it.
+	UID     int
+	Payload []byte
+}
+
+// IsEvent returns true if the payload is in the binary event format rather than text.
+func (e *RawLogEntry) IsEvent() bool {
+	switch e.Buffer {
+	case LogBufferEvents, LogBufferStats, LogBufferSecurity:
+		return true
+	default:
+		return false
+	}
+}
+
+// DecodeText decodes the payload of an entry from a text buffer such as main or system.
+func (e *RawLogEntry) DecodeText() (*LogEntry, error) {
+	payload := e.Payload
+	if len(payload) < 1 {
+		return nil, errors.Errorf(errors.ParseError, "empty log entry payload")
+	}
+
+	priority := LogPriority('?')
+	if index := int(payload[0]) - 2; index >= 0 && index < len(binaryLogPriorities) {
+		priority = binaryLogPriorities[index]
+	}
+
+	tag, message, found := cutNul(payload[1:])
+	if !found {
+		return nil, errors.Errorf(errors.ParseError, "log entry tag is not terminated")
+	}
+	message, _, _ = cutNul(message)
+
+	return &LogEntry{
+		Time:     e.Time,
+		PID:      e.PID,
+		TID:      e.TID,
+		Priority: priority,
+		Tag:      string(tag),
+		Message:  string(message),
+	}, nil
+}
+
+// LogEvent is a decoded entry from the events buffer.
+type LogEvent struct {
+	Time      time.Time
+	PID       int
+	TID       int
+	TagNumber int32
+	// Tag is the name of the tag, or "" if it isn't in the EventTags used to decode the event.
+	Tag string
+	// Value is an int32, int64, float32, string, or []interface{} of those types.
+	Value interface{}
+}
+
+// DecodeEvent decodes the payload of an entry from the events buffer. Tag names are
+// looked up in tags, which may be nil.
+func (e *RawLogEntry) DecodeEvent(tags EventTags) (*LogEvent, error) {
+	if len(e.Payload) < 4 {
+		return nil, errors.Errorf(errors.ParseError, "event payload too short for tag: %d bytes", len(e.Payload))
+	}
+	tagNumber := int32(binary.LittleEndian.Uint32(e.Payload))
+
+	event := &LogEvent{
+		Time:      e.Time,
+		PID:       e.PID,
+		TID:       e.TID,
+		TagNumber: tagNumber,
+		Tag:       tags[tagNumber],
+	}
+	if len(e.Payload) == 4 {
+		// Events may have no value.
+		return event, nil
+	}
+
+	value, _, err := decodeEventValue(e.Payload[4:])
+	if err != nil {
+		return nil, errors.WrapErrf(err, "error decoding event %d", tagNumber)
+	}
+	event.Value = value
+	return event, nil
+}
+
+// decodeEventValue decodes one value from data and returns the bytes following it.
+func decodeEventValue(data []byte) (interface{}, []byte, error) {
+	if len(data) < 1 {
+		return nil, nil, errors.Errorf(errors.ParseError, "missing event value type")
+	}
+	valueType, data := data[0], data[1:]
+
+	need := func(n int) error {
+		if len(data) < n {
+			return errors.Errorf(errors.ParseError, "event value of type %d truncated: want %d bytes, have %d",
+				valueType, n, len(data))
+		}
+		return nil
+	}
+
+	switch valueType {
+	case eventTypeInt:
+		if err := need(4); err != nil {
+			return nil, nil, err
+		}
+		return int32(binary.LittleEndian.Uint32(data)), data[4:], nil
+	case eventTypeLong:
+		if err := need(8); err != nil {
+			return nil, nil, err
+		}
+		return int64(binary.LittleEndian.Uint64(data)), data[8:], nil
+	case eventTypeFloat:
+		if err := need(4); err != nil {
+			return nil, nil, err
+		}
+		return math.Float32frombits(binary.LittleEndian.Uint32(data)), data[4:], nil
+	case eventTypeString:
+		if err := need(4); err != nil {
+			return nil, nil, err
+		}
+		// The length is checked before converting it, since it could be negative as an int
+		// on 32-bit platforms.
+		length := binary.LittleEndian.Uint32(data)
+		data = data[4:]
+		if uint64(length) > uint64(len(data)) {
+			return nil, nil, errors.Errorf(errors.ParseError, "event value of type %d truncated: want %d bytes, have %d",
+				valueType, length, len(data))
+		}
+		return string(data[:length]), data[length:], nil
+	case eventTypeList:
+		if err := need(1); err != nil {
+			return nil, nil, err
+		}
+		count := int(data[0])
+		data = data[1:]
+		list := make([]interface{}, 0, count)
+		for i := 0; i < count; i++ {
+			var item interface{}
+			var err error
+			if item, data, err = decodeEventValue(data); err != nil {
+				return nil, nil, err
+			}
+			list = append(list, item)
+		}
+		return list, data, nil
+	default:
+		return nil, nil, errors.Errorf(errors.ParseError, "unknown event value type: %d", valueType)
+	}
+}
+
+// EventTags maps event tag numbers to their names.
+type EventTags map[int32]string
+
+/*
+EventLogTags reads the names of the event tags defined on the device, for decoding
+entries from the events buffer.
+
+Corresponds to the command:
+
+	adb shell cat /system/etc/event-log-tags
+*/
+func (c *Device) EventLogTags() (EventTags, error) {
+	reader, err := c.OpenRead(EventLogTagsPath)
+	if err != nil {
+		return nil, wrapClientError(err, c, "EventLogTags")
+	}
+	defer reader.Close()
+
+	tags, err := parseEventLogTags(reader)
+	return tags, wrapClientError(err, c, "EventLogTags")
+}
+
+// parseEventLogTags parses the event-log-tags file format, e.g.
+//
+//	# comment
+//	2718 e
+//	30001 am_finish_activity (User|1|5),(Token|1|5),(Task ID|1|5)
+func parseEventLogTags(r io.Reader) (EventTags, error) {
+	tags := make(EventTags)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		number, err := strconv.ParseInt(fields[0], 10, 32)
+		if err != nil {
+			continue
+		}
+		tags[int32(number)] = fields[1]
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.WrapErrorf(err, errors.NetworkError, "error reading event log tags")
+	}
+	return tags, nil
+}
+
+/*
+BinaryLogcatStream delivers raw log entries from a running logcat -B command.
+*/
+type BinaryLogcatStream struct {
+	entries chan RawLogEntry
+
+	// If an error occurs, it is stored here and entries is closed immediately after.
+	err atomic.Value
+}
+
+// C returns a channel that can be received on to get log entries.
+// The channel is closed when logcat exits, the context passed to LogcatBinary is done, or
+// an error occurs.
+func (s *BinaryLogcatStream) C() <-chan RawLogEntry {
+	return s.entries
+}
+
+// Err returns the error that caused the channel returned by C to be closed, if C is closed.
+// It's nil if logcat exited normally or the context was done.
+// If C is not closed, its return value is undefined.
+func (s *BinaryLogcatStream) Err() error {
+	if err, ok := s.err.Load().(error); ok {
+		return err
+	}
+	return nil
+}
+
+/*
+LogcatBinary runs logcat on the device in binary mode and streams the entries until ctx is
+done. Unlike Logcat, no information is lost in formatting, which matters most for the
+events buffer. opts.Format is ignored.
+
+Corresponds to the command:
+
+	adb logcat -B
+*/
+func (c *Device) LogcatBinary(ctx context.Context, opts LogcatOptions) (*BinaryLogcatStream, error) {
+	conn, err := c.openExec("logcat", append([]string{"-B"}, opts.selectionArgs()...)...)
+	if err != nil {
+		return nil, wrapClientError(err, c, "LogcatBinary")
+	}
+
+	stream := &BinaryLogcatStream{entries: make(chan RawLogEntry)}
+	go func() {
+		defer close(stream.entries)
+		defer conn.Close()
+		stop := closeWhenDone(ctx, conn)
+		defer stop()
+
+		err := parseBinaryLogcat(ctx, bufio.NewReader(conn), stream.entries)
+		if err != nil && ctx.Err() == nil {
+			stream.err.Store(wrapClientError(err, c, "LogcatBinary"))
+		}
+	}()
+	return stream, nil
+}
+
+// parseBinaryLogcat reads entries from r and sends them on entries until r is exhausted
+// or ctx is done.
+func parseBinaryLogcat(ctx context.Context, r io.Reader, entries chan<- RawLogEntry) error {
+	for {
+		entry, err := readRawLogEntry(r)
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		select {
+		case entries <- *entry:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// readRawLogEntry reads a single struct logger_entry and its payload.
+// Returns io.EOF if r is exhausted before the first byte of the entry.
+func readRawLogEntry(r io.Reader) (*RawLogEntry, error) {
+	var prefix [4]byte
+	if _, err := io.ReadFull(r, prefix[:]); err == io.EOF {
+		return nil, io.EOF
+	} else if err != nil {
+		return nil, errors.WrapErrorf(err, errors.NetworkError, "error reading log entry header")
+	}
+	payloadLen := int(binary.LittleEndian.Uint16(prefix[0:]))
+	headerSize := int(binary.LittleEndian.Uint16(prefix[2:]))
+	if headerSize == 0 {
+		headerSize = loggerEntryV1HeaderSize
+	}
+	if headerSize < loggerEntryV1HeaderSize {
+		return nil, errors.Errorf(errors.ParseError, "invalid log entry header size: %d", headerSize)
+	}
+
+	rest := make([]byte, headerSize-len(prefix)+payloadLen)
+	if _, err := io.ReadFull(r, rest); err != nil {
+		return nil, errors.WrapErrorf(err, errors.NetworkError, "error reading log entry")
+	}
+	header, payload := rest[:headerSize-len(prefix)], rest[headerSize-len(prefix):]
+
+	entry := &RawLogEntry{
+		PID:     int(int32(binary.LittleEndian.Uint32(header[0:]))),
+		TID:     int(binary.LittleEndian.Uint32(header[4:])),
+		Time:    time.Unix(int64(binary.LittleEndian.Uint32(header[8:])), int64(binary.LittleEndian.Uint32(header[12:]))),
+		UID:     -1,
+		Payload: payload,
+	}
+	// Version 2 headers have the euid where version 3 has the buffer ID, but version 2 was
+	// only written by the kernel logger, which predates the exec: service.
+	if headerSize >= loggerEntryV3HeaderSize {
+		if id := int(binary.LittleEndian.Uint32(header[16:])); id < len(logBufferIDs) {
+			entry.Buffer = logBufferIDs[id]
+		}
+	}
+	if headerSize >= loggerEntryV4HeaderSize {
+		entry.UID = int(binary.LittleEndian.Uint32(header[20:]))
+	}
+	return entry, nil
+}
+
+// cutNul splits data around the first NUL byte.
+func cutNul(data []byte) (before, after []byte, found bool) {
+	if i := bytes.IndexByte(data, 0); i >= 0 {
+		return data[:i], data[i+1:], true
+	}
+	return data, nil, false
+}
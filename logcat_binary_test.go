@@ -0,0 +1,169 @@
+package adb
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mqhack/goadb/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// loggerEntryV4 encodes a struct logger_entry with a version 4 header.
+func loggerEntryV4(pid, tid int32, sec, nsec, lid, uid uint32, payload []byte) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, uint16(len(payload)))
+	binary.Write(&buf, binary.LittleEndian, uint16(loggerEntryV4HeaderSize))
+	for _, field := range []interface{}{pid, tid, sec, nsec, lid, uid} {
+		binary.Write(&buf, binary.LittleEndian, field)
+	}
+	buf.Write(payload)
+	return buf.Bytes()
+}
+
+func TestReadRawLogEntryV4(t *testing.T) {
+	payload := []byte("\x04ActivityManager\x00Start proc\x00")
+	r := bytes.NewReader(loggerEntryV4(1234, 5678, 1451703845, 678000000, 0, 1000, payload))
+
+	entry, err := readRawLogEntry(r)
+	require.NoError(t, err)
+	assert.Equal(t, &RawLogEntry{
+		Time:    time.Unix(1451703845, 678000000),
+		PID:     1234,
+		TID:     5678,
+		Buffer:  LogBufferMain,
+		UID:     1000,
+		Payload: payload,
+	}, entry)
+	assert.False(t, entry.IsEvent())
+
+	text, err := entry.DecodeText()
+	require.NoError(t, err)
+	assert.Equal(t, &LogEntry{
+		Time:     time.Unix(1451703845, 678000000),
+		PID:      1234,
+		TID:      5678,
+		Priority: PriorityInfo,
+		Tag:      "ActivityManager",
+		Message:  "Start proc",
+	}, text)
+
+	_, err = readRawLogEntry(r)
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestReadRawLogEntryV1(t *testing.T) {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, uint16(3))
+	binary.Write(&buf, binary.LittleEndian, uint16(0))
+	binary.Write(&buf, binary.LittleEndian, []int32{1, 2, 3, 4})
+	buf.WriteString("abc")
+
+	entry, err := readRawLogEntry(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, 1, entry.PID)
+	assert.Equal(t, 2, entry.TID)
+	assert.Equal(t, time.Unix(3, 4), entry.Time)
+	assert.Equal(t, LogBuffer(""), entry.Buffer)
+	assert.Equal(t, -1, entry.UID)
+	assert.Equal(t, []byte("abc"), entry.Payload)
+}
+
+func TestReadRawLogEntryTruncated(t *testing.T) {
+	data := loggerEntryV4(1, 2, 3, 4, 0, 0, []byte("\x04tag\x00msg\x00"))
+	_, err := readRawLogEntry(bytes.NewReader(data[:len(data)-2]))
+	assert.True(t, HasErrCode(err, NetworkError))
+}
+
+func TestDecodeEvent(t *testing.T) {
+	var payload bytes.Buffer
+	binary.Write(&payload, binary.LittleEndian, int32(30001))
+	payload.WriteByte(eventTypeList)
+	payload.WriteByte(4)
+	payload.WriteByte(eventTypeInt)
+	binary.Write(&payload, binary.LittleEndian, int32(-5))
+	payload.WriteByte(eventTypeLong)
+	binary.Write(&payload, binary.LittleEndian, int64(1)<<40)
+	payload.WriteByte(eventTypeString)
+	binary.Write(&payload, binary.LittleEndian, int32(3))
+	payload.WriteString("foo")
+	payload.WriteByte(eventTypeFloat)
+	binary.Write(&payload, binary.LittleEndian, math.Float32bits(1.5))
+	// Trailing list terminator written by some devices.
+	payload.WriteByte('\n')
+
+	entry := &RawLogEntry{PID: 1, TID: 2, Buffer: LogBufferEvents, Payload: payload.Bytes()}
+	assert.True(t, entry.IsEvent())
+
+	event, err := entry.DecodeEvent(EventTags{30001: "am_finish_activity"})
+	require.NoError(t, err)
+	assert.Equal(t, &LogEvent{
+		PID:       1,
+		TID:       2,
+		TagNumber: 30001,
+		Tag:       "am_finish_activity",
+		Value:     []interface{}{int32(-5), int64(1) << 40, "foo", float32(1.5)},
+	}, event)
+
+	event, err = entry.DecodeEvent(nil)
+	require.NoError(t, err)
+	assert.Equal(t, "", event.Tag)
+}
+
+func TestDecodeEventErrors(t *testing.T) {
+	for _, payload := range []string{
+		"\x01\x00",
+		"\x01\x00\x00\x00\x09",
+		"\x01\x00\x00\x00\x00\x01\x00",
+		"\x01\x00\x00\x00\x02\x05\x00\x00\x00abc",
+		// A string length that's negative as an int32.
+		"\x01\x00\x00\x00\x02\xff\xff\xff\xffabc",
+		"\x01\x00\x00\x00\x03\x02\x00\x01\x00\x00\x00",
+	} {
+		entry := &RawLogEntry{Payload: []byte(payload)}
+		_, err := entry.DecodeEvent(nil)
+		assert.True(t, HasErrCode(err, ParseError), "payload %q: %v", payload, err)
+	}
+}
+
+func TestParseEventLogTags(t *testing.T) {
+	tags, err := parseEventLogTags(strings.NewReader(`# comment
+
+42 answer (to life the universe etc|3)
+2718 e
+bogus line
+30001 am_finish_activity (User|1|5),(Token|1|5)
+`))
+	require.NoError(t, err)
+	assert.Equal(t, EventTags{42: "answer", 2718: "e", 30001: "am_finish_activity"}, tags)
+}
+
+func TestLogcatBinary(t *testing.T) {
+	entry1 := loggerEntryV4(1, 2, 3, 4, 0, 0, []byte("\x04Foo\x00hello\x00"))
+	entry2 := loggerEntryV4(1, 2, 3, 5, 3, 0, []byte("\x03Bar\x00world\x00"))
+	s := &MockServer{
+		Status:   wire.StatusSuccess,
+		Messages: []string{string(entry1[:10]), string(entry1[10:]) + string(entry2)},
+	}
+	device := (&Adb{server: s}).Device(AnyDevice())
+
+	stream, err := device.LogcatBinary(context.Background(), LogcatOptions{
+		Format:  LogcatLong,
+		Buffers: []LogBuffer{LogBufferMain, LogBufferSystem},
+	})
+	require.NoError(t, err)
+
+	var buffers []LogBuffer
+	for entry := range stream.C() {
+		buffers = append(buffers, entry.Buffer)
+	}
+	assert.NoError(t, stream.Err())
+	assert.Equal(t, []LogBuffer{LogBufferMain, LogBufferSystem}, buffers)
+	assert.Equal(t, []string{"host:transport-any", "exec:logcat -B -b main -b system"}, s.Requests)
+}
@@ -0,0 +1,125 @@
+package adb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mqhack/goadb/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestThreadtimeParser(t *testing.T) {
+	p := &threadtimeParser{year: 2016}
+
+	assert.Nil(t, p.ParseLine("--------- beginning of main"))
+	assert.Equal(t, &LogEntry{
+		Time:     time.Date(2016, 1, 2, 3, 4, 5, 678000000, time.Local),
+		PID:      1234,
+		TID:      5678,
+		Priority: PriorityInfo,
+		Tag:      "ActivityManager",
+		Message:  "Start proc: com.example: a:b",
+	}, p.ParseLine("01-02 03:04:05.678  1234  5678 I ActivityManager: Start proc: com.example: a:b"))
+
+	entry := p.ParseLine("12-31 23:59:59.000   1   2 W Tag With Spaces  : msg")
+	require.NotNil(t, entry)
+	assert.Equal(t, "Tag With Spaces", entry.Tag)
+	assert.Equal(t, PriorityWarn, entry.Priority)
+	assert.Equal(t, "msg", entry.Message)
+}
+
+func TestLongParser(t *testing.T) {
+	p := &longParser{year: 2016}
+
+	assert.Nil(t, p.ParseLine("--------- beginning of main"))
+	assert.Nil(t, p.ParseLine("[ 01-02 03:04:05.678  1234: 5678 E/AndroidRuntime ]"))
+	assert.Nil(t, p.ParseLine("FATAL EXCEPTION: main"))
+	assert.Nil(t, p.ParseLine(""))
+	assert.Nil(t, p.ParseLine("Process: com.example, PID: 1234"))
+	assert.Nil(t, p.ParseLine(""))
+	assert.Nil(t, p.ParseLine("--------- beginning of crash"))
+	assert.Equal(t, &LogEntry{
+		Time:     time.Date(2016, 1, 2, 3, 4, 5, 678000000, time.Local),
+		PID:      1234,
+		TID:      5678,
+		Priority: PriorityError,
+		Tag:      "AndroidRuntime",
+		Message:  "FATAL EXCEPTION: main\n\nProcess: com.example, PID: 1234",
+	}, p.ParseLine("[ 01-02 03:04:05.679  1: 2 D/Foo ]"))
+
+	assert.Nil(t, p.ParseLine("unterminated"))
+	entry := p.Flush()
+	require.NotNil(t, entry)
+	assert.Equal(t, "unterminated", entry.Message)
+	assert.Nil(t, p.Flush())
+}
+
+func TestNewLogParserInvalidFormat(t *testing.T) {
+	_, err := newLogParser("brief", time.Now())
+	assert.EqualError(t, err, "AssertionError: unsupported logcat format: brief")
+}
+
+func TestLogcat(t *testing.T) {
+	s := &MockServer{
+		Status: wire.StatusSuccess,
+		Messages: []string{
+			"--------- beginning of main\n01-02 03:04:05.678  1  2 I Foo: hello\r\n01-02 03:04",
+			":05.679  1  2 D Bar: world\n",
+		},
+	}
+	device := (&Adb{server: s}).Device(AnyDevice())
+
+	stream, err := device.Logcat(context.Background(), LogcatOptions{})
+	require.NoError(t, err)
+
+	var messages []string
+	for entry := range stream.C() {
+		messages = append(messages, entry.Tag+": "+entry.Message)
+	}
+	assert.NoError(t, stream.Err())
+	assert.Equal(t, []string{"Foo: hello", "Bar: world"}, messages)
+	assert.Equal(t, []string{"host:transport-any", "exec:logcat -v threadtime"}, s.Requests)
+}
+
+func TestLogcatOptionsArgs(t *testing.T) {
+	since := time.Date(2016, 1, 2, 3, 4, 5, 600000000, time.UTC)
+
+	for _, test := range []struct {
+		Opts LogcatOptions
+		Want []string
+	}{
+		{LogcatOptions{}, []string{"-v", "threadtime"}},
+		{LogcatOptions{Format: LogcatLong, Dump: true}, []string{"-v", "long", "-d"}},
+		{LogcatOptions{Buffers: []LogBuffer{LogBufferMain, LogBufferCrash}},
+			[]string{"-v", "threadtime", "-b", "main", "-b", "crash"}},
+		{LogcatOptions{Since: since}, []string{"-v", "threadtime", "-T", "01-02 03:04:05.600"}},
+		{LogcatOptions{Since: since, Dump: true}, []string{"-v", "threadtime", "-t", "01-02 03:04:05.600"}},
+		{LogcatOptions{Tail: 10}, []string{"-v", "threadtime", "-T", "10"}},
+		{LogcatOptions{Tail: 10, Dump: true}, []string{"-v", "threadtime", "-t", "10"}},
+		{LogcatOptions{Filters: []LogFilter{{"ActivityManager", PriorityInfo}, {"*", PrioritySilent}}},
+			[]string{"-v", "threadtime", "ActivityManager:I", "*:S"}},
+	} {
+		assert.Equal(t, test.Want, test.Opts.args())
+	}
+}
+
+func TestClearLogcat(t *testing.T) {
+	s := &MockServer{Status: wire.StatusSuccess}
+	device := (&Adb{server: s}).Device(AnyDevice())
+
+	assert.NoError(t, device.ClearLogcat(LogBufferMain))
+	assert.Equal(t, "shell:logcat -c -b main", s.Requests[1])
+}
+
+func TestClearLogcatFailure(t *testing.T) {
+	s := &MockServer{
+		Status:   wire.StatusSuccess,
+		Messages: []string{"failed to clear the 'main' log\n"},
+	}
+	device := (&Adb{server: s}).Device(AnyDevice())
+
+	err := device.ClearLogcat()
+	assert.True(t, HasErrCode(err, AdbError))
+}
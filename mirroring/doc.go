@@ -0,0 +1,22 @@
+/*
+Package mirroring streams the screen of Android devices as encoded video with low latency,
+using the scrcpy server, without needing the scrcpy client installed.
+
+	server, _ := os.Open("scrcpy-server-v2.4")
+	stream, err := mirroring.Start(ctx, device, mirroring.Options{
+		Server:        server,
+		ServerVersion: "2.4",
+		MaxSize:       1024,
+	})
+	meta := stream.Metadata()
+	for packet := range stream.C() {
+		decoder.Decode(packet.Data)
+	}
+
+The server jar isn't bundled, since it must match ServerVersion exactly; it's published with
+each scrcpy release. It's pushed to the device for each session, and connected to over a
+localabstract socket through the device's transport, so no host ports are used. Mirroring
+continues until the context passed to Start is done. Requires scrcpy 2.0 or later, and a
+device running Android L or later.
+*/
+package mirroring
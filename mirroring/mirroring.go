@@ -0,0 +1,368 @@
+package mirroring
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mqhack/goadb/internal/errors"
+	"github.com/mqhack/goadb/internal/random"
+	"github.com/mqhack/goadb/wire"
+)
+
+// ServerPath is where the server jar is pushed to on the device.
+const ServerPath = "/data/local/tmp/goadb-mirroring-server.jar"
+
+// DefaultConnectTimeout is how long Start waits for the server to start listening by default.
+const DefaultConnectTimeout = 10 * time.Second
+
+// How often Start tries to connect to the server while it's starting.
+const connectRetryInterval = 100 * time.Millisecond
+
+// Sizes of the metadata sent by the server before the video.
+const (
+	deviceNameLength   = 64
+	codecMetaLength    = 12
+	packetHeaderLength = 12
+	// Far larger than any encoded frame, to catch a corrupted header.
+	maxPacketLength = 32 << 20
+)
+
+// Flags in the PTS field of packet headers.
+const (
+	ptsFlagConfig   = uint64(1) << 63
+	ptsFlagKeyFrame = uint64(1) << 62
+	ptsMask         = ptsFlagKeyFrame - 1
+)
+
+// Codec is a video codec supported by the server.
+type Codec string
+
+const (
+	CodecH264 Codec = "h264"
+	CodecH265 Codec = "h265"
+	CodecAV1  Codec = "av1"
+)
+
+// Codec IDs sent in the codec metadata, which are the codec names in ASCII.
+var codecIDs = map[uint32]Codec{
+	0x68323634: CodecH264,
+	0x68323635: CodecH265,
+	0x00617631: CodecAV1,
+}
+
+// Device is the part of *adb.Device that Start needs.
+type Device interface {
+	OpenWrite(path string, perms os.FileMode, mtime time.Time) (io.WriteCloser, error)
+	OpenExec(cmd string, args ...string) (io.ReadWriteCloser, error)
+	DialSocket(socket string) (io.ReadWriteCloser, error)
+}
+
+// Options configures a mirroring session.
+type Options struct {
+	// Server is the scrcpy server jar. Required.
+	Server io.Reader
+	// ServerVersion is the scrcpy version of Server, e.g. "2.4". The server refuses to start
+	// if it doesn't match. Required.
+	ServerVersion string
+
+	// Codec defaults to CodecH264. H.265 and AV1 require a device with a hardware encoder
+	// for them.
+	Codec Codec
+	// MaxSize limits the width and height of the video, preserving the aspect ratio. Zero
+	// means the display's resolution.
+	MaxSize int
+	// BitRate is the video bit rate, in bits per second. Zero means the server's default.
+	BitRate int
+	// MaxFPS limits the frame rate. Zero means no limit.
+	MaxFPS int
+
+	// ConnectTimeout defaults to DefaultConnectTimeout.
+	ConnectTimeout time.Duration
+}
+
+// Metadata describes the device and video, sent by the server before the video.
+type Metadata struct {
+	DeviceName string
+	Codec      Codec
+	// Width and Height are the initial size of the video. The size changes when the
+	// device is rotated, which is signalled by a new config packet.
+	Width  int
+	Height int
+}
+
+// Packet is one packet of the encoded video.
+type Packet struct {
+	// PTS is the presentation timestamp of the frame. Zero for config packets.
+	PTS time.Duration
+	// Config is true if the packet contains codec configuration (e.g. the H.264 SPS and
+	// PPS) rather than a frame. Decoders need it before the next frame.
+	Config   bool
+	KeyFrame bool
+	Data     []byte
+}
+
+// Stream is a mirroring session started by Start.
+type Stream struct {
+	metadata Metadata
+	packets  chan Packet
+
+	// If an error occurs, it is stored here and packets is closed immediately after.
+	err atomic.Value
+}
+
+// Metadata returns the metadata sent by the server when the session started.
+func (s *Stream) Metadata() Metadata {
+	return s.metadata
+}
+
+// C returns a channel that receives the video packets. It's closed when the context passed
+// to Start is done, or the server stops.
+func (s *Stream) C() <-chan Packet {
+	return s.packets
+}
+
+// Err returns the error that caused the channel returned by C to be closed, if C is closed.
+// It's nil if the stream ended because the context was done.
+func (s *Stream) Err() error {
+	if err, ok := s.err.Load().(error); ok {
+		return err
+	}
+	return nil
+}
+
+/*
+Start pushes the server to device, starts it, and returns once the video stream has started.
+It fails if the server doesn't start listening within opts.ConnectTimeout. The server is
+stopped when ctx is done.
+*/
+func Start(ctx context.Context, device Device, opts Options) (*Stream, error) {
+	if opts.Server == nil || opts.ServerVersion == "" {
+		return nil, errors.AssertionErrorf("mirroring requires a server jar and its version")
+	}
+	if opts.Codec == "" {
+		opts.Codec = CodecH264
+	}
+	if opts.ConnectTimeout <= 0 {
+		opts.ConnectTimeout = DefaultConnectTimeout
+	}
+
+	if err := pushServer(device, opts.Server); err != nil {
+		return nil, err
+	}
+
+	// scrcpy parses the scid as a positive 31-bit integer.
+	scid := fmt.Sprintf("%08x", random.Uint64()&0x7fffffff)
+	server, err := device.OpenExec(serverCommand(opts, scid))
+	if err != nil {
+		return nil, errors.WrapAnyErrf(err, errors.NetworkError, "error starting mirroring server")
+	}
+	log := newServerLog(server)
+
+	conn, err := connect(ctx, device, "localabstract:scrcpy_"+scid, opts.ConnectTimeout, log)
+	if err != nil {
+		server.Close()
+		return nil, err
+	}
+	metadata, err := readMetadata(conn)
+	if err != nil {
+		conn.Close()
+		server.Close()
+		return nil, err
+	}
+
+	stream := &Stream{
+		metadata: metadata,
+		packets:  make(chan Packet),
+	}
+	go stream.run(ctx, conn, server)
+	return stream, nil
+}
+
+func pushServer(device Device, server io.Reader) error {
+	w, err := device.OpenWrite(ServerPath, wire.DefaultFilePerms, time.Time{})
+	if err != nil {
+		return errors.WrapAnyErrf(err, errors.NetworkError, "error pushing mirroring server")
+	}
+	if _, err := io.Copy(w, server); err != nil {
+		w.Close()
+		if _, ok := err.(*errors.Err); !ok {
+			return errors.WrapErrorf(err, errors.AssertionError, "error reading mirroring server")
+		}
+		return errors.WrapErrf(err, "error pushing mirroring server")
+	}
+	return errors.WrapAnyErrf(w.Close(), errors.NetworkError, "error pushing mirroring server")
+}
+
+// serverCommand returns the command line that starts the server, streaming video only.
+func serverCommand(opts Options, scid string) string {
+	args := []string{
+		"CLASSPATH=" + ServerPath, "app_process", "/", "com.genymobile.scrcpy.Server", opts.ServerVersion,
+		"scid=" + scid,
+		"log_level=info",
+		"tunnel_forward=true",
+		"send_dummy_byte=true",
+		"audio=false",
+		"control=false",
+		"video_codec=" + string(opts.Codec),
+	}
+	if opts.MaxSize > 0 {
+		args = append(args, "max_size="+strconv.Itoa(opts.MaxSize))
+	}
+	if opts.BitRate > 0 {
+		args = append(args, "video_bit_rate="+strconv.Itoa(opts.BitRate))
+	}
+	if opts.MaxFPS > 0 {
+		args = append(args, "max_fps="+strconv.Itoa(opts.MaxFPS))
+	}
+	return strings.Join(args, " ")
+}
+
+// connect connects to the server's socket, retrying until the server is listening. The
+// server sends a byte as soon as it accepts the connection, so a connection that's closed
+// before then was made too early.
+func connect(ctx context.Context, device Device, socket string, timeout time.Duration, log *serverLog) (io.ReadWriteCloser, error) {
+	deadline := time.After(timeout)
+	for {
+		conn, err := device.DialSocket(socket)
+		if err == nil {
+			var dummy [1]byte
+			if _, err = io.ReadFull(conn, dummy[:]); err == nil {
+				return conn, nil
+			}
+			conn.Close()
+		}
+
+		select {
+		case <-time.After(connectRetryInterval):
+		case <-log.exited:
+			return nil, errors.Errorf(errors.AdbError, "mirroring server exited: %s", log.String())
+		case <-deadline:
+			return nil, errors.Errorf(errors.Timeout, "mirroring server didn't start listening within %s: %s", timeout, log.String())
+		case <-ctx.Done():
+			return nil, errors.WrapErrorf(ctx.Err(), errors.Timeout, "mirroring server didn't start listening")
+		}
+	}
+}
+
+func readMetadata(r io.Reader) (Metadata, error) {
+	var buf [deviceNameLength + codecMetaLength]byte
+	if _, err := io.ReadFull(r, buf[:]); err != nil {
+		return Metadata{}, errors.WrapErrorf(err, errors.NetworkError, "error reading mirroring metadata")
+	}
+
+	codecID := binary.BigEndian.Uint32(buf[deviceNameLength:])
+	codec, ok := codecIDs[codecID]
+	if !ok {
+		return Metadata{}, errors.Errorf(errors.ParseError, "unknown mirroring codec ID %#x", codecID)
+	}
+	return Metadata{
+		DeviceName: string(bytes.TrimRight(buf[:deviceNameLength], "\x00")),
+		Codec:      codec,
+		Width:      int(binary.BigEndian.Uint32(buf[deviceNameLength+4:])),
+		Height:     int(binary.BigEndian.Uint32(buf[deviceNameLength+8:])),
+	}, nil
+}
+
+// readPacket reads a packet header, which is the PTS and flags as a uint64, and the packet
+// size as a uint32, followed by the packet.
+func readPacket(r io.Reader) (Packet, error) {
+	var header [packetHeaderLength]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return Packet{}, errors.WrapErrorf(err, errors.NetworkError, "error reading mirroring packet header")
+	}
+	pts := binary.BigEndian.Uint64(header[:])
+	size := binary.BigEndian.Uint32(header[8:])
+	if size > maxPacketLength {
+		return Packet{}, errors.Errorf(errors.ParseError, "mirroring packet too large: %d bytes", size)
+	}
+
+	packet := Packet{
+		Config:   pts&ptsFlagConfig != 0,
+		KeyFrame: pts&ptsFlagKeyFrame != 0,
+		Data:     make([]byte, size),
+	}
+	if !packet.Config {
+		packet.PTS = time.Duration(pts&ptsMask) * time.Microsecond
+	}
+	if _, err := io.ReadFull(r, packet.Data); err != nil {
+		return Packet{}, errors.WrapErrorf(err, errors.NetworkError, "error reading mirroring packet")
+	}
+	return packet, nil
+}
+
+func (s *Stream) run(ctx context.Context, conn io.ReadCloser, server io.Closer) {
+	defer close(s.packets)
+	defer server.Close()
+	defer conn.Close()
+
+	stopped := make(chan struct{})
+	defer close(stopped)
+	go func() {
+		select {
+		case <-ctx.Done():
+			// Unblocks readPacket.
+			conn.Close()
+		case <-stopped:
+		}
+	}()
+
+	for {
+		packet, err := readPacket(conn)
+		if err != nil {
+			if ctx.Err() == nil {
+				s.err.Store(err)
+			}
+			return
+		}
+		select {
+		case s.packets <- packet:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// serverLog collects the server's output, to explain why it failed to start.
+type serverLog struct {
+	mu     sync.Mutex
+	buf    bytes.Buffer
+	exited chan struct{}
+}
+
+// The most output kept, so a chatty server doesn't use unbounded memory.
+const maxServerLogLength = 4096
+
+func newServerLog(server io.Reader) *serverLog {
+	log := &serverLog{exited: make(chan struct{})}
+	go func() {
+		defer close(log.exited)
+		buf := make([]byte, 1024)
+		for {
+			n, err := server.Read(buf)
+			log.mu.Lock()
+			if log.buf.Len() < maxServerLogLength {
+				log.buf.Write(buf[:n])
+			}
+			log.mu.Unlock()
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return log
+}
+
+func (l *serverLog) String() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return strings.TrimSpace(l.buf.String())
+}
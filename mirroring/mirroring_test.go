@@ -0,0 +1,179 @@
+package mirroring
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	adb "github.com/mqhack/goadb"
+	"github.com/mqhack/goadb/internal/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var _ Device = (*adb.Device)(nil)
+
+type MockDevice struct {
+	mu sync.Mutex
+
+	// Data sent on the socket, after a number of failed dials.
+	Socket      []byte
+	FailedDials int
+	// Output of the server, which exits when it's all read if ServerExits is set.
+	ServerOutput string
+	ServerExits  bool
+
+	Files      map[string][]byte
+	ExecCmd    string
+	Sockets    []string
+	ServerDone chan struct{}
+}
+
+type fileWriter struct {
+	bytes.Buffer
+	d    *MockDevice
+	path string
+}
+
+func (w *fileWriter) Close() error {
+	w.d.Files[w.path] = w.Bytes()
+	return nil
+}
+
+func (d *MockDevice) OpenWrite(path string, perms os.FileMode, mtime time.Time) (io.WriteCloser, error) {
+	if d.Files == nil {
+		d.Files = make(map[string][]byte)
+	}
+	return &fileWriter{d: d, path: path}, nil
+}
+
+// mockServer outputs ServerOutput, then blocks until closed unless it exits.
+type mockServer struct {
+	io.Reader
+	exits  bool
+	closed chan struct{}
+	once   sync.Once
+}
+
+func (s *mockServer) Read(p []byte) (int, error) {
+	n, err := s.Reader.Read(p)
+	if err == io.EOF && !s.exits {
+		<-s.closed
+	}
+	return n, err
+}
+
+func (s *mockServer) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+func (s *mockServer) Close() error {
+	s.once.Do(func() { close(s.closed) })
+	return nil
+}
+
+func (d *MockDevice) OpenExec(cmd string, args ...string) (io.ReadWriteCloser, error) {
+	d.ExecCmd = cmd
+	d.ServerDone = make(chan struct{})
+	return &mockServer{Reader: strings.NewReader(d.ServerOutput), exits: d.ServerExits, closed: d.ServerDone}, nil
+}
+
+type socketConn struct {
+	io.Reader
+}
+
+func (socketConn) Write(p []byte) (int, error) { return len(p), nil }
+func (socketConn) Close() error                { return nil }
+
+func (d *MockDevice) DialSocket(socket string) (io.ReadWriteCloser, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.Sockets = append(d.Sockets, socket)
+	if len(d.Sockets) <= d.FailedDials {
+		return nil, errors.Errorf(errors.AdbError, "connection refused")
+	}
+	return socketConn{bytes.NewReader(d.Socket)}, nil
+}
+
+func metadata(name string, codecID, width, height uint32) []byte {
+	buf := make([]byte, deviceNameLength+codecMetaLength)
+	copy(buf, name)
+	binary.BigEndian.PutUint32(buf[deviceNameLength:], codecID)
+	binary.BigEndian.PutUint32(buf[deviceNameLength+4:], width)
+	binary.BigEndian.PutUint32(buf[deviceNameLength+8:], height)
+	return buf
+}
+
+func packet(pts uint64, data string) []byte {
+	buf := make([]byte, packetHeaderLength)
+	binary.BigEndian.PutUint64(buf, pts)
+	binary.BigEndian.PutUint32(buf[8:], uint32(len(data)))
+	return append(buf, data...)
+}
+
+func TestStart(t *testing.T) {
+	var socket []byte
+	socket = append(socket, 0)
+	socket = append(socket, metadata("Pixel 7", 0x68323634, 1080, 2400)...)
+	socket = append(socket, packet(ptsFlagConfig, "sps")...)
+	socket = append(socket, packet(ptsFlagKeyFrame|16000, "idr")...)
+	socket = append(socket, packet(32000, "p")...)
+	device := &MockDevice{Socket: socket, FailedDials: 2}
+
+	stream, err := Start(context.Background(), device, Options{
+		Server:        strings.NewReader("jar"),
+		ServerVersion: "2.4",
+		MaxSize:       1024,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, Metadata{DeviceName: "Pixel 7", Codec: CodecH264, Width: 1080, Height: 2400}, stream.Metadata())
+	assert.Equal(t, []byte("jar"), device.Files[ServerPath])
+	assert.Len(t, device.Sockets, 3)
+	assert.True(t, strings.HasPrefix(device.Sockets[0], "localabstract:scrcpy_"))
+	assert.Contains(t, device.ExecCmd, "com.genymobile.scrcpy.Server 2.4 scid="+strings.TrimPrefix(device.Sockets[0], "localabstract:scrcpy_"))
+	assert.Contains(t, device.ExecCmd, " video_codec=h264 max_size=1024")
+
+	var packets []Packet
+	for p := range stream.C() {
+		packets = append(packets, p)
+	}
+	assert.Equal(t, []Packet{
+		{Config: true, Data: []byte("sps")},
+		{PTS: 16 * time.Millisecond, KeyFrame: true, Data: []byte("idr")},
+		{PTS: 32 * time.Millisecond, Data: []byte("p")},
+	}, packets)
+	assert.True(t, errors.HasErrCode(stream.Err(), errors.NetworkError))
+	<-device.ServerDone
+}
+
+func TestStartServerExits(t *testing.T) {
+	device := &MockDevice{
+		FailedDials:  1000,
+		ServerOutput: "[server] ERROR: The server version (2.3) does not match the client (2.4)\n",
+		ServerExits:  true,
+	}
+	_, err := Start(context.Background(), device, Options{Server: strings.NewReader("jar"), ServerVersion: "2.4"})
+	assert.EqualError(t, err, "AdbError: mirroring server exited: [server] ERROR: The server version (2.3) does not match the client (2.4)")
+}
+
+func TestStartConnectTimeout(t *testing.T) {
+	device := &MockDevice{FailedDials: 1000}
+	_, err := Start(context.Background(), device, Options{
+		Server:         strings.NewReader("jar"),
+		ServerVersion:  "2.4",
+		ConnectTimeout: 250 * time.Millisecond,
+	})
+	assert.True(t, errors.HasErrCode(err, errors.Timeout))
+	<-device.ServerDone
+}
+
+func TestReadMetadataUnknownCodec(t *testing.T) {
+	_, err := readMetadata(bytes.NewReader(metadata("x", 42, 1, 1)))
+	assert.EqualError(t, err, "ParseError: unknown mirroring codec ID 0x2a")
+}
@@ -0,0 +1,252 @@
+package adb
+
+import (
+	"bufio"
+	"context"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mqhack/goadb/internal/errors"
+)
+
+// MonkeyOptions configures Device.RunMonkey.
+type MonkeyOptions struct {
+	// Package is the app the monkey is confined to. Required.
+	Package string
+	// EventCount is the number of events to inject. Required.
+	EventCount int
+	// Seed seeds the monkey's random number generator, so a run can be repeated with the
+	// same events. Zero lets the monkey choose one, which is reported in the result.
+	Seed int64
+	// Throttle is the delay between events. Zero injects them as fast as possible.
+	Throttle time.Duration
+	// Categories restrict the activities the monkey starts to those in the intent
+	// categories, e.g. "android.intent.category.LAUNCHER". Defaults to the launcher and
+	// monkey categories.
+	Categories []string
+	// IgnoreErrors keeps the monkey going after crashes and ANRs, instead of stopping at
+	// the first one.
+	IgnoreErrors bool
+
+	// OnCrash, if set, is called with each crash or ANR as soon as the monkey reports it.
+	OnCrash func(CrashEvent)
+}
+
+// MonkeyResult is the outcome of Device.RunMonkey.
+type MonkeyResult struct {
+	// Seed is the seed the monkey used.
+	Seed int64
+	// EventsInjected is how many events were injected before the monkey finished or
+	// stopped.
+	EventsInjected int
+	// Crashes are the crashes and ANRs the monkey encountered, in order. Their StackTrace
+	// and Log are what the monkey printed, without its "// " prefixes.
+	Crashes []CrashEvent
+	// Completed is true if the monkey injected all the events. It's false if it stopped at
+	// a crash or ANR.
+	Completed bool
+}
+
+// Monkey prints crash reports with every line prefixed with "// ", and ANR reports with
+// only the first one prefixed.
+var (
+	monkeyHeaderPattern = regexp.MustCompile(`^:Monkey: seed=(-?\d+) count=\d+`)
+	monkeyCrashPattern  = regexp.MustCompile(`^// CRASH: (\S+) \(pid (\d+)\)`)
+	monkeyANRPattern    = regexp.MustCompile(`^// NOT RESPONDING: (\S+) \(pid (\d+)\)`)
+	monkeyEventsPattern = regexp.MustCompile(`^Events injected: (\d+)`)
+)
+
+// What the monkey prints when it has injected all the events.
+const monkeyFinished = "// Monkey finished"
+
+// The fields of a crash report before its stack trace, e.g. "// Short Msg: ...".
+var monkeyCrashFields = []string{"Short Msg:", "Long Msg:", "Build Label:", "Build Changelist:", "Build Time:"}
+
+/*
+RunMonkey runs the UI/Application Exerciser Monkey on opts.Package, injecting random events
+until opts.EventCount have been injected or the app crashes. Crashes and ANRs are passed to
+opts.OnCrash as they're encountered, and returned in the result.
+
+If ctx is done before the monkey exits, it's killed and an error with code Timeout is returned
+along with the result so far.
+
+Requires a device running Android N or later (see OpenShell).
+
+Corresponds to the command:
+
+	adb shell monkey -p <package> [-s seed] [--throttle ms] [-c category]... -v <count>
+*/
+func (c *Device) RunMonkey(ctx context.Context, opts MonkeyOptions) (*MonkeyResult, error) {
+	args, err := monkeyArgs(opts)
+	if err != nil {
+		return nil, wrapClientError(err, c, "RunMonkey")
+	}
+	conn, err := c.openShell("monkey", args...)
+	if err != nil {
+		return nil, wrapClientError(err, c, "RunMonkey")
+	}
+	defer conn.Close()
+	stop := closeWhenDone(ctx, conn)
+	defer stop()
+
+	parser := &monkeyParser{onCrash: opts.OnCrash, result: &MonkeyResult{Seed: opts.Seed}}
+	stdout := newShellStdoutReader(conn)
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		parser.line(strings.TrimRight(scanner.Text(), "\r"))
+	}
+	parser.flush()
+	result := parser.result
+
+	if ctx.Err() != nil {
+		return result, wrapClientError(errors.WrapErrorf(ctx.Err(), errors.Timeout, "monkey didn't complete"), c, "RunMonkey")
+	}
+	if err := scanner.Err(); err != nil {
+		return result, wrapClientError(errors.WrapErrorf(err, errors.NetworkError, "error reading monkey output"), c, "RunMonkey")
+	}
+	// The monkey exits with an error status when it stops at a crash, which is reported in
+	// the result. Other errors, like the package not having any activities, are only
+	// reported on stderr.
+	if !result.Completed && len(result.Crashes) == 0 {
+		return result, wrapClientError(errors.Errorf(errors.AdbError, "monkey exited with status %d: %s",
+			stdout.exitCode, strings.TrimSpace(stdout.stderr.String())), c, "RunMonkey")
+	}
+	return result, nil
+}
+
+func monkeyArgs(opts MonkeyOptions) ([]string, error) {
+	if opts.Package == "" {
+		return nil, errors.AssertionErrorf("monkey package must be set")
+	}
+	if opts.EventCount <= 0 {
+		return nil, errors.AssertionErrorf("monkey event count must be positive, got %d", opts.EventCount)
+	}
+	args := []string{"-p", opts.Package}
+	if opts.Seed != 0 {
+		args = append(args, "-s", strconv.FormatInt(opts.Seed, 10))
+	}
+	if opts.Throttle > 0 {
+		args = append(args, "--throttle", strconv.FormatInt(int64(opts.Throttle/time.Millisecond), 10))
+	}
+	for _, category := range opts.Categories {
+		args = append(args, "-c", category)
+	}
+	if opts.IgnoreErrors {
+		args = append(args, "--ignore-crashes", "--ignore-timeouts", "--ignore-security-exceptions")
+	}
+	return append(args, "-v", strconv.Itoa(opts.EventCount)), nil
+}
+
+// monkeyParser collects the result of a monkey run from its output, line by line.
+type monkeyParser struct {
+	onCrash func(CrashEvent)
+	result  *MonkeyResult
+
+	// The report being read, if any.
+	report *CrashEvent
+}
+
+func (p *monkeyParser) line(line string) {
+	if p.report != nil {
+		if p.continuesReport(line) {
+			p.report.Log = append(p.report.Log, strings.TrimPrefix(strings.TrimPrefix(line, "//"), " "))
+			return
+		}
+		p.flush()
+	}
+
+	if match := monkeyCrashPattern.FindStringSubmatch(line); match != nil {
+		p.report = &CrashEvent{Kind: CrashJava, Time: time.Now(), Package: match[1], PID: atoiOrZero(match[2])}
+		p.report.Log = []string{strings.TrimPrefix(line, "// ")}
+	} else if match := monkeyANRPattern.FindStringSubmatch(line); match != nil {
+		p.report = &CrashEvent{Kind: CrashANR, Time: time.Now(), Package: match[1], PID: atoiOrZero(match[2])}
+		p.report.Log = []string{strings.TrimPrefix(line, "// ")}
+	} else if match := monkeyHeaderPattern.FindStringSubmatch(line); match != nil {
+		p.result.Seed, _ = strconv.ParseInt(match[1], 10, 64)
+	} else if match := monkeyEventsPattern.FindStringSubmatch(line); match != nil {
+		p.result.EventsInjected = atoiOrZero(match[1])
+	} else if line == monkeyFinished {
+		p.result.Completed = true
+	}
+}
+
+// continuesReport returns true if line is part of the report being read. Crash reports end
+// at their last "// " line, or an empty "//" line; ANR reports end at the next line the
+// monkey prints itself, which starts with ":", "//" or "**".
+func (p *monkeyParser) continuesReport(line string) bool {
+	if p.report.Kind == CrashANR {
+		return !strings.HasPrefix(line, ":") && !strings.HasPrefix(line, "//") &&
+			!strings.HasPrefix(line, "**") && !monkeyEventsPattern.MatchString(line)
+	}
+	return strings.HasPrefix(line, "// ") && strings.TrimSpace(line) != "//"
+}
+
+// flush finishes the report being read, if any.
+func (p *monkeyParser) flush() {
+	if p.report == nil {
+		return
+	}
+	event := p.report
+	p.report = nil
+
+	if event.Kind == CrashANR {
+		for _, line := range event.Log {
+			if reason := strings.TrimPrefix(line, "Reason: "); reason != line && event.Reason == "" {
+				event.Reason = reason
+			}
+		}
+	} else {
+		parseMonkeyCrash(event)
+	}
+
+	p.result.Crashes = append(p.result.Crashes, *event)
+	if p.onCrash != nil {
+		p.onCrash(*event)
+	}
+}
+
+// parseMonkeyCrash sets the reason and stack trace of a crash report, e.g.
+//
+//	CRASH: com.example (pid 1234)
+//	Short Msg: java.lang.RuntimeException
+//	Long Msg: java.lang.RuntimeException: boom
+//	Build Time: 1600000000000
+//	java.lang.RuntimeException: boom
+//		at com.example.Foo.bar(Foo.java:10)
+func parseMonkeyCrash(event *CrashEvent) {
+	var shortMsg string
+	exceptionSeen := false
+lines:
+	for _, line := range event.Log[1:] {
+		for _, field := range monkeyCrashFields {
+			if value := strings.TrimPrefix(line, field); value != line {
+				switch field {
+				case "Short Msg:":
+					shortMsg = strings.TrimSpace(value)
+				case "Long Msg:":
+					event.Reason = strings.TrimSpace(value)
+				}
+				continue lines
+			}
+		}
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			continue
+		}
+		if !exceptionSeen {
+			// The first line of the trace repeats the long message.
+			exceptionSeen = true
+			if event.Reason == "" {
+				event.Reason = trimmed
+			}
+			continue
+		}
+		event.StackTrace = append(event.StackTrace, trimmed)
+	}
+	if event.Reason == "" {
+		event.Reason = shortMsg
+	}
+}
@@ -0,0 +1,136 @@
+package adb
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mqhack/goadb/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const monkeyCrashOutput = `:Monkey: seed=1234 count=500
+:AllowPackage: com.example
+:IncludeCategory: android.intent.category.LAUNCHER
+:Switch: #Intent;action=android.intent.action.MAIN;component=com.example/.Main;end
+    // Allowing start of Intent { cmp=com.example/.Main } in package com.example
+:Sending Touch (ACTION_DOWN): 0:(540.0,960.0)
+// CRASH: com.example (pid 4321)
+// Short Msg: java.lang.IllegalStateException
+// Long Msg: java.lang.IllegalStateException: boom
+// Build Label: google/sdk/generic:13/TE1A/1234:userdebug/test-keys
+// Build Changelist: 1234
+// Build Time: 1600000000000
+// java.lang.IllegalStateException: boom
+// 	at com.example.Main.onClick(Main.java:10)
+// 	at android.view.View.performClick(View.java:7448)
+// 
+** Monkey aborted due to error.
+Events injected: 42
+:Sending rotation degree=0, persist=false
+:Dropped: keys=0 pointers=0 trackballs=0 flips=0 rotations=0
+## Network stats: elapsed time=1234ms (0ms mobile, 0ms wifi, 1234ms not connected)
+** System appears to have crashed at event 42 of 500 using seed 1234
+`
+
+func TestRunMonkey(t *testing.T) {
+	s := &MockServer{
+		Status: wire.StatusSuccess,
+		Messages: []string{
+			shellPacket(wire.ShellIDStdout, monkeyCrashOutput),
+			shellPacket(wire.ShellIDExit, "\xff"),
+		},
+	}
+	device := (&Adb{server: s}).Device(AnyDevice())
+
+	var reported []CrashEvent
+	result, err := device.RunMonkey(context.Background(), MonkeyOptions{
+		Package:    "com.example",
+		EventCount: 500,
+		Throttle:   100 * time.Millisecond,
+		Categories: []string{"android.intent.category.LAUNCHER"},
+		OnCrash:    func(event CrashEvent) { reported = append(reported, event) },
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "shell,v2,raw:monkey -p com.example --throttle 100 -c android.intent.category.LAUNCHER -v 500", s.Requests[1])
+
+	assert.Equal(t, int64(1234), result.Seed)
+	assert.Equal(t, 42, result.EventsInjected)
+	assert.False(t, result.Completed)
+	require.Len(t, result.Crashes, 1)
+	crash := result.Crashes[0]
+	assert.Equal(t, CrashJava, crash.Kind)
+	assert.Equal(t, "com.example", crash.Package)
+	assert.Equal(t, 4321, crash.PID)
+	assert.Equal(t, "java.lang.IllegalStateException: boom", crash.Reason)
+	assert.Equal(t, []string{
+		"at com.example.Main.onClick(Main.java:10)",
+		"at android.view.View.performClick(View.java:7448)",
+	}, crash.StackTrace)
+	assert.Equal(t, "CRASH: com.example (pid 4321)", crash.Log[0])
+	assert.Equal(t, result.Crashes, reported)
+}
+
+func TestParseMonkeyANR(t *testing.T) {
+	parser := &monkeyParser{result: &MonkeyResult{}}
+	for _, line := range []string{
+		":Sending Touch (ACTION_UP): 0:(540.0,960.0)",
+		"// NOT RESPONDING: com.example (pid 4321)",
+		"ANR in com.example (com.example/.Main)",
+		"PID: 4321",
+		"Reason: Input dispatching timed out",
+		"Load: 1.0 / 1.0 / 1.0",
+		":Sending Touch (ACTION_DOWN): 0:(10.0,10.0)",
+		"Events injected: 500",
+		"// Monkey finished",
+	} {
+		parser.line(line)
+	}
+	parser.flush()
+
+	result := parser.result
+	assert.True(t, result.Completed)
+	assert.Equal(t, 500, result.EventsInjected)
+	require.Len(t, result.Crashes, 1)
+	assert.Equal(t, CrashANR, result.Crashes[0].Kind)
+	assert.Equal(t, "Input dispatching timed out", result.Crashes[0].Reason)
+	assert.Len(t, result.Crashes[0].Log, 5)
+}
+
+func TestRunMonkeyFailed(t *testing.T) {
+	s := &MockServer{
+		Status: wire.StatusSuccess,
+		Messages: []string{
+			shellPacket(wire.ShellIDStdout, ":Monkey: seed=1 count=10\n:AllowPackage: com.missing\n"),
+			shellPacket(wire.ShellIDStderr, "** No activities found to run, monkey aborted.\n"),
+			shellPacket(wire.ShellIDExit, "\xfc"),
+		},
+	}
+	device := (&Adb{server: s}).Device(AnyDevice())
+
+	_, err := device.RunMonkey(context.Background(), MonkeyOptions{Package: "com.missing", EventCount: 10, Seed: 1})
+	assert.True(t, HasErrCode(err, AdbError))
+	assert.Contains(t, ErrorWithCauseChain(err), "monkey exited with status 252: ** No activities found to run, monkey aborted.")
+	assert.Equal(t, "shell,v2,raw:monkey -p com.missing -s 1 -v 10", s.Requests[1])
+
+	_, err = device.RunMonkey(context.Background(), MonkeyOptions{Package: "com.example"})
+	assert.True(t, HasErrCode(err, AssertionError))
+}
+
+func TestRunMonkeyLineTooLong(t *testing.T) {
+	s := &MockServer{
+		Status: wire.StatusSuccess,
+		Messages: []string{
+			// The line spans two packets, since a packet can't be bigger than the scanner's buffer.
+			shellPacket(wire.ShellIDStdout, ":Monkey: seed=1 count=10\n// "+strings.Repeat("x", 768*1024)),
+			shellPacket(wire.ShellIDStdout, strings.Repeat("x", 768*1024)+"\n"),
+			shellPacket(wire.ShellIDExit, "\x00"),
+		},
+	}
+	_, err := (&Adb{server: s}).Device(AnyDevice()).RunMonkey(context.Background(),
+		MonkeyOptions{Package: "com.example", EventCount: 10, Seed: 1})
+	assert.True(t, HasErrCode(err, NetworkError))
+	assert.Contains(t, ErrorWithCauseChain(err), "token too long")
+}
@@ -0,0 +1,162 @@
+package adb
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/mqhack/goadb/internal/errors"
+)
+
+// Mount is a file system mounted on the device, as listed in /proc/mounts.
+type Mount struct {
+	// Device is the block device or other source of the file system, e.g. "/dev/block/dm-5"
+	// or "tmpfs".
+	Device     string
+	MountPoint string
+	// Type is the file system type, e.g. "ext4".
+	Type    string
+	Options []string
+}
+
+// ReadOnly returns true if the file system is mounted read-only.
+func (m Mount) ReadOnly() bool {
+	for _, option := range m.Options {
+		if option == "ro" {
+			return true
+		}
+	}
+	return false
+}
+
+// ListMounts returns the file systems mounted on the device, in the order they were mounted.
+func (c *Device) ListMounts() ([]Mount, error) {
+	output, err := c.RunCommand("cat /proc/mounts")
+	if err != nil {
+		return nil, wrapClientError(err, c, "ListMounts")
+	}
+	mounts, err := parseMounts(output)
+	return mounts, wrapClientError(err, c, "ListMounts")
+}
+
+// parseMounts parses the lines of /proc/mounts, e.g.
+//
+//	/dev/block/dm-5 /data ext4 rw,seclabel,nosuid,nodev,noatime 0 0
+func parseMounts(output string) ([]Mount, error) {
+	var mounts []Mount
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 4 {
+			return nil, errors.Errorf(errors.ParseError, "invalid mount %q", strings.TrimSpace(line))
+		}
+		mounts = append(mounts, Mount{
+			Device:     unescapeMountField(fields[0]),
+			MountPoint: unescapeMountField(fields[1]),
+			Type:       fields[2],
+			Options:    strings.Split(fields[3], ","),
+		})
+	}
+	return mounts, nil
+}
+
+// unescapeMountField replaces the octal escapes the kernel writes for whitespace and
+// backslashes in /proc/mounts, e.g. "\040" for a space.
+func unescapeMountField(field string) string {
+	if !strings.Contains(field, `\`) {
+		return field
+	}
+	var b strings.Builder
+	for i := 0; i < len(field); i++ {
+		if field[i] == '\\' && i+4 <= len(field) {
+			if n, err := strconv.ParseUint(field[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(n))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(field[i])
+	}
+	return b.String()
+}
+
+/*
+RemountPartition remounts the file system at mountPoint read-write if rw is true, or
+read-only if it's false. Unlike Remount, which asks adbd to remount every partition, this
+runs mount as root, using su if adbd isn't running as root, and the error has code
+RequirementNotMet if neither can.
+
+Corresponds to the command:
+
+	adb shell mount -o remount,rw <mount-point>
+*/
+func (c *Device) RemountPartition(mountPoint string, rw bool) error {
+	mode := "ro"
+	if rw {
+		mode = "rw"
+	}
+	err := c.runAsRoot("mount -o remount," + mode + " " + shellQuote(mountPoint))
+	return wrapClientError(err, c, "RemountPartition(%s)", mountPoint)
+}
+
+/*
+Mount mounts the file system on source, e.g. a block device, at mountPoint, as root like
+RemountPartition. fsType and options may be empty, to let mount detect the type and use the
+default options.
+
+Corresponds to the command:
+
+	adb shell mount -t <fs-type> -o <options> <source> <mount-point>
+*/
+func (c *Device) Mount(source, mountPoint, fsType string, options []string) error {
+	cmd := "mount"
+	if fsType != "" {
+		cmd += " -t " + shellQuote(fsType)
+	}
+	if len(options) > 0 {
+		cmd += " -o " + shellQuote(strings.Join(options, ","))
+	}
+	err := c.runAsRoot(cmd + " " + shellQuote(source) + " " + shellQuote(mountPoint))
+	return wrapClientError(err, c, "Mount(%s)", mountPoint)
+}
+
+// Unmount unmounts the file system at mountPoint, as root like RemountPartition.
+func (c *Device) Unmount(mountPoint string) error {
+	return wrapClientError(c.runAsRoot("umount "+shellQuote(mountPoint)), c, "Unmount(%s)", mountPoint)
+}
+
+// runAsRoot runs cmd, which prints nothing if it succeeds, as root like mutateFS.
+func (c *Device) runAsRoot(cmd string) error {
+	level, err := c.rootPrivilegeLevel()
+	if err != nil {
+		return err
+	}
+	return c.mutateFS(level.wrap(cmd))
+}
+
+// rootPrivilegeLevel returns the first of privilegeLevels that runs commands as root, which
+// is the shell itself if adbd is running as root.
+func (c *Device) rootPrivilegeLevel() (privilegeLevel, error) {
+	// All the levels are tried by one command, which prints the index of the first that works.
+	script := ""
+	for i, level := range privilegeLevels {
+		if i > 0 {
+			script += "el"
+		}
+		script += `if [ "$(` + level.wrap("id -u") + ` 2>/dev/null)" = 0 ]; then echo ` + strconv.Itoa(i) + "; "
+	}
+	output, err := c.RunCommand(script + "fi </dev/null")
+	if err != nil {
+		return privilegeLevel{}, err
+	}
+	i, err := strconv.Atoi(strings.TrimSpace(output))
+	if err != nil || i < 0 || i >= len(privilegeLevels) {
+		var tried []string
+		for _, level := range privilegeLevels {
+			tried = append(tried, level.name)
+		}
+		return privilegeLevel{}, errors.Errorf(errors.RequirementNotMet, "can't run commands as root (tried %s)", strings.Join(tried, ", "))
+	}
+	return privilegeLevels[i], nil
+}
@@ -0,0 +1,57 @@
+package adb
+
+import (
+	"testing"
+
+	"github.com/mqhack/goadb/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListMounts(t *testing.T) {
+	s := &MockServer{Status: wire.StatusSuccess, Messages: []string{
+		"/dev/block/dm-0 / ext4 ro,seclabel,relatime 0 0\r\n" +
+			"tmpfs /dev tmpfs rw,seclabel,nosuid,relatime,mode=755 0 0\r\n" +
+			"/dev/fuse /mnt/user/0/My\\040Drive fuse rw,lazytime 0 0\r\n",
+	}}
+	mounts, err := (&Adb{server: s}).Device(AnyDevice()).ListMounts()
+	require.NoError(t, err)
+	require.Len(t, mounts, 3)
+	assert.Equal(t, Mount{Device: "/dev/block/dm-0", MountPoint: "/", Type: "ext4",
+		Options: []string{"ro", "seclabel", "relatime"}}, mounts[0])
+	assert.True(t, mounts[0].ReadOnly())
+	assert.False(t, mounts[1].ReadOnly())
+	assert.Equal(t, "/mnt/user/0/My Drive", mounts[2].MountPoint)
+}
+
+func TestParseMountsInvalid(t *testing.T) {
+	_, err := parseMounts("/dev/block/dm-0 /\n")
+	assert.True(t, HasErrCode(err, ParseError))
+}
+
+func TestUnescapeMountField(t *testing.T) {
+	assert.Equal(t, "a b\\c", unescapeMountField(`a\040b\134c`))
+	assert.Equal(t, `a\04`, unescapeMountField(`a\04`))
+}
+
+func TestRemountPartition(t *testing.T) {
+	// The probe reports that su 0 runs commands as root, then mount prints nothing.
+	s := &MockServer{Status: wire.StatusSuccess, Messages: []string{"1\r\n"}}
+	err := (&Adb{server: s}).Device(AnyDevice()).RemountPartition("/system", true)
+	require.NoError(t, err)
+	assert.Contains(t, s.Requests[1], `if [ "$(id -u 2>/dev/null)" = 0 ]; then echo 0; elif [ "$(su 0 sh -c 'id -u' 2>/dev/null)" = 0 ]`)
+	assert.Equal(t, `shell:su 0 sh -c 'mount -o remount,rw '\''/system'\''' </dev/null 2>&1`, s.Requests[3])
+}
+
+func TestRemountPartitionNoRoot(t *testing.T) {
+	s := &MockServer{Status: wire.StatusSuccess, Messages: []string{""}}
+	err := (&Adb{server: s}).Device(AnyDevice()).RemountPartition("/system", false)
+	assert.True(t, HasErrCode(err, RequirementNotMet))
+}
+
+func TestMount(t *testing.T) {
+	s := &MockServer{Status: wire.StatusSuccess, Messages: []string{"0\r\n"}}
+	device := (&Adb{server: s}).Device(AnyDevice())
+	require.NoError(t, device.Mount("/dev/block/sda1", "/mnt/usb", "vfat", []string{"rw", "noatime"}))
+	assert.Equal(t, "shell:mount -t 'vfat' -o 'rw,noatime' '/dev/block/sda1' '/mnt/usb' </dev/null 2>&1", s.Requests[3])
+}
@@ -0,0 +1,190 @@
+package adb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/mqhack/goadb/internal/errors"
+)
+
+// OperationState is how far an operation recorded in an OperationLog got.
+type OperationState string
+
+const (
+	// The operation was started, but hasn't finished. If the process that started it has
+	// exited, it may or may not have been done.
+	OperationStarted   OperationState = "started"
+	OperationSucceeded OperationState = "succeeded"
+	OperationFailed    OperationState = "failed"
+)
+
+// Operation identifies a mutating operation, like an install or a reboot, so an orchestrator
+// that retries it doesn't do it twice.
+type Operation struct {
+	// Key is unique to the operation, and the same every time it's retried, e.g. derived from
+	// the job that requested it.
+	Key string `json:"key"`
+	// Name describes the operation, e.g. "install com.example.app".
+	Name string `json:"name,omitempty"`
+	// Metadata is recorded with the operation, e.g. the ID of the job that requested it.
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// OperationRecord is an operation recorded in an OperationLog.
+type OperationRecord struct {
+	Operation
+	// Device is the device the operation was run on, as given by Device.String.
+	Device     string         `json:"device"`
+	State      OperationState `json:"state"`
+	StartedAt  time.Time      `json:"started_at"`
+	FinishedAt time.Time      `json:"finished_at"`
+	// Error is the message of the error the operation failed with.
+	Error string `json:"error,omitempty"`
+}
+
+/*
+OperationLog records the operations run with it in a file, so an operation is run at most once
+per key, even if the process running it is restarted. It's for device farm orchestrators that
+retry jobs, so a retried job doesn't install an app or reboot a device again.
+
+Every change is appended to the file as a line of JSON before Run returns, and the last line
+for a key is its current record. An operation that failed can be retried with the same key;
+one that succeeded, or that was started by a process that exited before it finished, can't.
+*/
+type OperationLog struct {
+	path string
+	now  func() time.Time
+
+	mu      sync.Mutex
+	records map[string]OperationRecord
+}
+
+// OpenOperationLog loads the operation log saved at path. If the file doesn't exist, the log
+// is empty, and the file is created when the first operation is run.
+func OpenOperationLog(path string) (*OperationLog, error) {
+	l := &OperationLog{
+		path:    path,
+		now:     time.Now,
+		records: make(map[string]OperationRecord),
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return l, nil
+	} else if err != nil {
+		return nil, wrapLocalFileError(err, path)
+	}
+	if err := l.parse(data); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Lookup returns the record of the operation with key, if it has been run.
+func (l *OperationLog) Lookup(key string) (OperationRecord, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	record, ok := l.records[key]
+	return record, ok
+}
+
+/*
+Run runs fn, which performs op on device, and records it. If an operation with op.Key has
+already succeeded, or was started and never finished, fn isn't run: the earlier record is
+returned, and duplicate is true.
+
+If fn fails, its error is returned, and the operation can be run again with the same key.
+*/
+func (l *OperationLog) Run(device *Device, op Operation, fn func() error) (record OperationRecord, duplicate bool, err error) {
+	if op.Key == "" {
+		return OperationRecord{}, false, errors.AssertionErrorf("operation has no key")
+	}
+
+	l.mu.Lock()
+	if previous, ok := l.records[op.Key]; ok && previous.State != OperationFailed {
+		l.mu.Unlock()
+		return previous, true, nil
+	}
+	record = OperationRecord{
+		Operation: op,
+		Device:    device.String(),
+		State:     OperationStarted,
+		StartedAt: l.now().UTC(),
+	}
+	err = l.appendLocked(record)
+	l.mu.Unlock()
+	if err != nil {
+		return OperationRecord{}, false, err
+	}
+
+	fnErr := fn()
+	record.FinishedAt = l.now().UTC()
+	record.State = OperationSucceeded
+	if fnErr != nil {
+		record.State = OperationFailed
+		record.Error = fnErr.Error()
+	}
+
+	l.mu.Lock()
+	err = l.appendLocked(record)
+	l.mu.Unlock()
+	if fnErr != nil {
+		return record, false, fnErr
+	}
+	return record, false, err
+}
+
+func (l *OperationLog) parse(data []byte) error {
+	// A line that's missing its newline was being written when the process that wrote it
+	// exited, so it's ignored.
+	if i := bytes.LastIndexByte(data, '\n'); i < len(data)-1 {
+		data = data[:i+1]
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, 1024*1024)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var record OperationRecord
+		if err := json.Unmarshal(line, &record); err != nil || record.Key == "" {
+			return errors.Errorf(errors.ParseError, "malformed operation log line %d in %s: %s", lineNum, l.path, line)
+		}
+		l.records[record.Key] = record
+	}
+	if err := scanner.Err(); err != nil {
+		return errors.WrapErrorf(err, errors.ParseError, "error reading operation log %s", l.path)
+	}
+	return nil
+}
+
+// appendLocked appends record to the log's file, and syncs it, so the record survives the
+// process being killed.
+func (l *OperationLog) appendLocked(record OperationRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return errors.WrapErrorf(err, errors.AssertionError, "error encoding operation %s", record.Key)
+	}
+	f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return wrapLocalFileError(err, l.path)
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return wrapLocalFileError(err, l.path)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return wrapLocalFileError(err, l.path)
+	}
+	if err := f.Close(); err != nil {
+		return wrapLocalFileError(err, l.path)
+	}
+	l.records[record.Key] = record
+	return nil
+}
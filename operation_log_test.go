@@ -0,0 +1,93 @@
+package adb
+
+import (
+	stderrors "errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOperationLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "operations")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "operations.jsonl")
+
+	log, err := OpenOperationLog(path)
+	require.NoError(t, err)
+	log.now = func() time.Time { return time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC) }
+	device := (&Adb{server: &MockServer{}}).Device(DeviceWithSerial("abc"))
+	op := Operation{Key: "job-1/install", Name: "install com.example.app", Metadata: map[string]string{"job": "job-1"}}
+
+	runs := 0
+	_, duplicate, err := log.Run(device, op, func() error {
+		runs++
+		return stderrors.New("device offline")
+	})
+	assert.EqualError(t, err, "device offline")
+	assert.False(t, duplicate)
+
+	// A failed operation can be retried.
+	record, duplicate, err := log.Run(device, op, func() error {
+		runs++
+		return nil
+	})
+	require.NoError(t, err)
+	assert.False(t, duplicate)
+	assert.Equal(t, 2, runs)
+	assert.Equal(t, OperationRecord{
+		Operation:  op,
+		Device:     "DeviceSerial[abc]",
+		State:      OperationSucceeded,
+		StartedAt:  time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC),
+		FinishedAt: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC),
+	}, record)
+
+	// The log is reloaded from its file, and the operation isn't run again.
+	log, err = OpenOperationLog(path)
+	require.NoError(t, err)
+	reloaded, duplicate, err := log.Run(device, op, func() error {
+		runs++
+		return nil
+	})
+	require.NoError(t, err)
+	assert.True(t, duplicate)
+	assert.Equal(t, 2, runs)
+	assert.Equal(t, record, reloaded)
+
+	_, _, err = log.Run(device, Operation{}, func() error { return nil })
+	assert.True(t, HasErrCode(err, AssertionError))
+}
+
+func TestOperationLogInterrupted(t *testing.T) {
+	dir, err := ioutil.TempDir("", "operations")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "operations.jsonl")
+
+	// The process exited while rebooting, and while writing the next line.
+	require.NoError(t, ioutil.WriteFile(path, []byte(
+		`{"key":"job-2/reboot","device":"DeviceSerial[abc]","state":"started","started_at":"2024-03-01T12:00:00Z"}`+"\n"+
+			`{"key":"job-2/reb`), 0600))
+	log, err := OpenOperationLog(path)
+	require.NoError(t, err)
+	record, ok := log.Lookup("job-2/reboot")
+	require.True(t, ok)
+	assert.Equal(t, OperationStarted, record.State)
+
+	_, duplicate, err := log.Run((&Adb{server: &MockServer{}}).Device(DeviceWithSerial("abc")), Operation{Key: "job-2/reboot"}, func() error {
+		t.Fatal("interrupted operation was run again")
+		return nil
+	})
+	require.NoError(t, err)
+	assert.True(t, duplicate)
+
+	require.NoError(t, ioutil.WriteFile(path, []byte("not json\n"), 0600))
+	_, err = OpenOperationLog(path)
+	assert.True(t, HasErrCode(err, ParseError))
+}
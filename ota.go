@@ -0,0 +1,262 @@
+package adb
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/mqhack/goadb/internal/errors"
+	"github.com/mqhack/goadb/wire"
+)
+
+// OTAStage is a step of applying an OTA package with ApplyOTA.
+//
+//go:generate stringer -type=OTAStage
+type OTAStage int8
+
+const (
+	// OTARebootingToSideload means the device is rebooting into recovery's sideload mode.
+	OTARebootingToSideload OTAStage = iota
+	// OTASideloading means recovery is reading the package from the host.
+	OTASideloading
+	// OTAWaitingForBoot means the package has been installed, and the device is rebooting
+	// back into Android.
+	OTAWaitingForBoot
+	// OTAComplete means the device has finished booting.
+	OTAComplete
+)
+
+// Size of the blocks recovery requests the package in.
+const sideloadBlockSize = 65536
+
+// Sent by recovery instead of a block number once it's finished reading the package.
+const (
+	sideloadDone = "DONEDONE"
+	sideloadFail = "FAILFAIL"
+)
+
+// How often sys.boot_completed is polled while waiting for the device to boot.
+const bootCompletedPollInterval = time.Second
+
+// OTAProgress is reported by ApplyOTA when the stage changes, and as the package is sideloaded.
+type OTAProgress struct {
+	Stage OTAStage
+	// Percent is an estimate of how much of the sideload is complete, from 0 to 100.
+	// Recovery reads the package about twice (once to verify it, once to install it), so
+	// this is based on the amount transferred rather than the package size, and stays
+	// below 100 until the sideload is done.
+	Percent float64
+}
+
+/*
+OTAUpdate delivers the progress of an OTA package being applied by ApplyOTA.
+*/
+type OTAUpdate struct {
+	progress chan OTAProgress
+
+	// If an error occurs, it is stored here and progress is closed immediately after.
+	err atomic.Value
+}
+
+// C returns a channel that can be received on to get progress events. It's closed once
+// the device has booted after the update, or an error occurs.
+// Events are dropped if the receiver isn't keeping up, except for stage changes.
+func (u *OTAUpdate) C() <-chan OTAProgress {
+	return u.progress
+}
+
+// Err returns the error that caused the channel returned by C to be closed, if C is closed.
+// It's nil if the update was applied and the device booted.
+// If C is not closed, its return value is undefined.
+func (u *OTAUpdate) Err() error {
+	if err, ok := u.err.Load().(error); ok {
+		return err
+	}
+	return nil
+}
+
+/*
+ApplyOTA installs an OTA package of size bytes, read from pkg, and waits for the device
+to boot again.
+
+The device is rebooted into recovery's sideload mode (unless it's already in it), the
+package is served to recovery as it requests it, and once it's installed the device
+reboots automatically. If ctx is done before the device has booted, the update reports an
+error with code Timeout; the device is left in whatever state it had reached.
+
+Corresponds to the commands:
+
+	adb reboot sideload-auto-reboot
+	adb wait-for-sideload
+	adb sideload <package>
+	adb wait-for-device
+*/
+func (c *Device) ApplyOTA(ctx context.Context, pkg io.ReaderAt, size int64) (*OTAUpdate, error) {
+	if size <= 0 {
+		return nil, errors.AssertionErrorf("OTA package size must be positive, got %d", size)
+	}
+
+	update := &OTAUpdate{progress: make(chan OTAProgress, 16)}
+	// Stage changes are always delivered, unless ctx is done.
+	report := func(p OTAProgress, stageChange bool) {
+		if stageChange {
+			select {
+			case update.progress <- p:
+			case <-ctx.Done():
+			}
+			return
+		}
+		select {
+		case update.progress <- p:
+		default:
+		}
+	}
+
+	go func() {
+		defer close(update.progress)
+		if err := c.applyOTA(ctx, pkg, size, report); err != nil {
+			if ctx.Err() != nil {
+				err = errors.WrapErrorf(ctx.Err(), errors.Timeout, "OTA update didn't complete")
+			}
+			update.err.Store(wrapClientError(err, c, "ApplyOTA"))
+		}
+	}()
+	return update, nil
+}
+
+func (c *Device) applyOTA(ctx context.Context, pkg io.ReaderAt, size int64, report func(OTAProgress, bool)) error {
+	state, err := c.State()
+	if err != nil {
+		return err
+	}
+	if state != StateSideload {
+		report(OTAProgress{Stage: OTARebootingToSideload}, true)
+		if err := c.reboot("sideload-auto-reboot"); err != nil {
+			return err
+		}
+		if err := c.waitForState(ctx, "sideload"); err != nil {
+			return err
+		}
+	}
+
+	report(OTAProgress{Stage: OTASideloading}, true)
+	conn, err := c.dialDevice()
+	if err != nil {
+		return err
+	}
+	stop := closeWhenDone(ctx, conn)
+	err = sideload(conn, pkg, size, func(pct float64) {
+		report(OTAProgress{Stage: OTASideloading, Percent: pct}, false)
+	})
+	stop()
+	conn.Close()
+	if err != nil {
+		return err
+	}
+	report(OTAProgress{Stage: OTASideloading, Percent: 100}, true)
+
+	report(OTAProgress{Stage: OTAWaitingForBoot}, true)
+	if err := c.waitForState(ctx, "device"); err != nil {
+		return err
+	}
+	if err := c.waitForBootCompleted(ctx); err != nil {
+		return err
+	}
+	report(OTAProgress{Stage: OTAComplete, Percent: 100}, true)
+	return nil
+}
+
+// reboot asks adbd to reboot the device into target, e.g. "recovery". An empty target
+// reboots normally.
+func (c *Device) reboot(target string) error {
+	conn, err := c.dialDevice()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	req := "reboot:" + target
+	if err = wire.SendMessageString(conn, req); err != nil {
+		return err
+	}
+	_, err = conn.ReadStatus(req)
+	return err
+}
+
+// sideload serves pkg to recovery over conn, which must already be connected to the device,
+// until recovery reports it's done.
+func sideload(conn *wire.Conn, pkg io.ReaderAt, size int64, progress func(pct float64)) error {
+	req := fmt.Sprintf("sideload-host:%d:%d", size, sideloadBlockSize)
+	if err := wire.SendMessageString(conn, req); err != nil {
+		return err
+	}
+	if _, err := conn.ReadStatus(req); err != nil {
+		return err
+	}
+
+	var transferred int64
+	block := make([]byte, sideloadBlockSize)
+	request := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(conn, request); err != nil {
+			return errors.WrapErrorf(err, errors.NetworkError, "error reading sideload block request")
+		}
+		switch string(request) {
+		case sideloadDone:
+			return nil
+		case sideloadFail:
+			return errors.Errorf(errors.AdbError, "recovery failed to install the package")
+		}
+
+		n, err := strconv.ParseInt(string(request), 10, 64)
+		if err != nil {
+			return errors.WrapErrorf(err, errors.ParseError, "invalid sideload block request: %q", request)
+		}
+		offset := n * sideloadBlockSize
+		if n < 0 || offset >= size {
+			return errors.Errorf(errors.ParseError, "sideload block %d out of range for package of %d bytes", n, size)
+		}
+		length := int64(sideloadBlockSize)
+		if offset+length > size {
+			length = size - offset
+		}
+
+		if read, err := pkg.ReadAt(block[:length], offset); int64(read) < length {
+			return errors.WrapErrorf(err, errors.AssertionError, "error reading OTA package at offset %d", offset)
+		}
+		if _, err := conn.Write(block[:length]); err != nil {
+			return errors.WrapErrorf(err, errors.NetworkError, "error sending sideload block %d", n)
+		}
+
+		transferred += length
+		if progress != nil {
+			// The package is read about 2.13 times in total, which this scales to 100%.
+			pct := float64(transferred) * 47 / float64(size)
+			if pct > 99 {
+				pct = 99
+			}
+			progress(pct)
+		}
+	}
+}
+
+// waitForBootCompleted polls sys.boot_completed until the device has finished booting.
+func (c *Device) waitForBootCompleted(ctx context.Context) error {
+	ticker := time.NewTicker(bootCompletedPollInterval)
+	defer ticker.Stop()
+	for {
+		// adbd may not be ready for shell commands for a moment after the device comes
+		// online, so errors are retried.
+		if value, err := c.getProp("sys.boot_completed"); err == nil && value == "1" {
+			return nil
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return errors.WrapErrorf(ctx.Err(), errors.Timeout, "device didn't finish booting")
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package adb
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/mqhack/goadb/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSideload(t *testing.T) {
+	pkg := []byte(strings.Repeat("a", sideloadBlockSize) + "tail")
+	s := &MockServer{
+		Status:   wire.StatusSuccess,
+		Messages: []string{"00000001", "00000000", "00000001", sideloadDone},
+	}
+	conn, err := s.Dial()
+	require.NoError(t, err)
+
+	var progress []float64
+	err = sideload(conn, bytes.NewReader(pkg), int64(len(pkg)), func(pct float64) {
+		progress = append(progress, pct)
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"sideload-host:65540:65536"}, s.Requests)
+	assert.True(t, bytes.Equal(append([]byte("tail"), pkg...), s.Written), "wrote %d bytes", len(s.Written))
+	require.Len(t, progress, 3)
+	assert.InDelta(t, float64(4)*47/65540, progress[0], 0.001)
+	assert.InDelta(t, 47, progress[2], 0.01)
+}
+
+func TestSideloadFailure(t *testing.T) {
+	s := &MockServer{
+		Status:   wire.StatusSuccess,
+		Messages: []string{"00000000", sideloadFail},
+	}
+	conn, err := s.Dial()
+	require.NoError(t, err)
+
+	err = sideload(conn, strings.NewReader("pkg"), 3, nil)
+	assert.EqualError(t, err, "AdbError: recovery failed to install the package")
+}
+
+func TestSideloadBlockOutOfRange(t *testing.T) {
+	s := &MockServer{
+		Status:   wire.StatusSuccess,
+		Messages: []string{"00000002"},
+	}
+	conn, err := s.Dial()
+	require.NoError(t, err)
+
+	err = sideload(conn, strings.NewReader("pkg"), 3, nil)
+	assert.EqualError(t, err, "ParseError: sideload block 2 out of range for package of 3 bytes")
+}
+
+func TestApplyOTAAlreadyInSideload(t *testing.T) {
+	s := &MockServer{
+		Status:   wire.StatusSuccess,
+		Messages: []string{"sideload", sideloadDone, "1\n"},
+	}
+	device := (&Adb{server: s}).Device(DeviceWithSerial("abc"))
+
+	update, err := device.ApplyOTA(context.Background(), strings.NewReader("pkg"), 3)
+	require.NoError(t, err)
+	var stages []OTAStage
+	for p := range update.C() {
+		stages = append(stages, p.Stage)
+	}
+	require.NoError(t, update.Err())
+	assert.Equal(t, []OTAStage{OTASideloading, OTASideloading, OTAWaitingForBoot, OTAComplete}, stages)
+	assert.Equal(t, []string{
+		"host-serial:abc:get-state",
+		"host:transport:abc",
+		"sideload-host:3:65536",
+		"host-serial:abc:wait-for-any-device",
+		"host:transport:abc",
+		"shell:getprop sys.boot_completed",
+	}, s.Requests)
+}
@@ -0,0 +1,130 @@
+package adb
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mqhack/goadb/internal/errors"
+)
+
+// InvalidUTF8Policy is how OutputEncoding handles output that isn't valid UTF-8.
+type InvalidUTF8Policy int
+
+const (
+	// InvalidUTF8Keep leaves invalid bytes in the output.
+	InvalidUTF8Keep InvalidUTF8Policy = iota
+	// InvalidUTF8Replace replaces each run of invalid bytes with U+FFFD.
+	InvalidUTF8Replace
+	// InvalidUTF8Error fails with an error with code ParseError.
+	InvalidUTF8Error
+)
+
+/*
+OutputEncoding is how the text printed by commands is normalized by RunCommand, Lines and
+Logcat, set with Device.SetOutputEncoding.
+
+Until it's set, RunCommand returns output exactly as the device printed it, Lines and Logcat
+remove the CR of CRLF line endings, and nothing else is changed.
+*/
+type OutputEncoding struct {
+	// KeepCRLF leaves CRLF line endings alone. By default they're converted to LF: the shell
+	// on releases before Android N translates LF to CRLF, so output differs between releases
+	// without it.
+	KeepCRLF bool
+	// StripANSI removes ANSI escape sequences, like the colors of ls --color and logcat
+	// -v color, and terminal title changes.
+	StripANSI bool
+	// InvalidUTF8 is how byte sequences that aren't valid UTF-8 are handled. Defaults to
+	// InvalidUTF8Keep.
+	InvalidUTF8 InvalidUTF8Policy
+}
+
+// Matches ANSI escape sequences: control sequences, like "\x1b[1;31m", operating system
+// commands, like "\x1b]0;title\x07", and two-character escapes, like "\x1b=".
+var ansiEscapePattern = regexp.MustCompile(`\x1b(\[[0-?]*[ -/]*[@-~]|\][^\x07\x1b]*(\x07|\x1b\\)|[@-Z\\-_])`)
+
+/*
+SetOutputEncoding makes RunCommand, Lines and Logcat normalize output according to enc, so
+parsers see the same text whichever release the device runs. Commands run by other Device
+values for the same device are unaffected.
+
+Passing nil restores the default behavior, described on OutputEncoding.
+*/
+func (c *Device) SetOutputEncoding(enc *OutputEncoding) {
+	c.outputEncoding.Store(enc)
+}
+
+// getOutputEncoding returns the encoding set by SetOutputEncoding, or nil if there isn't one.
+func (c *Device) getOutputEncoding() *OutputEncoding {
+	enc, _ := c.outputEncoding.Load().(*OutputEncoding)
+	return enc
+}
+
+/*
+Lines runs cmd like RunCommand, and returns its output split into lines, without line endings.
+A final empty line, after the output's last newline, isn't included.
+*/
+func (c *Device) Lines(cmd string, args ...string) ([]string, error) {
+	output, err := c.RunCommand(cmd, args...)
+	if err != nil {
+		return nil, wrapClientError(err, c, "Lines")
+	}
+	output = strings.TrimSuffix(output, "\n")
+	if output == "" {
+		return nil, nil
+	}
+	lines := strings.Split(output, "\n")
+	if c.getOutputEncoding() == nil {
+		for i, line := range lines {
+			lines[i] = strings.TrimRight(line, "\r")
+		}
+	}
+	return lines, nil
+}
+
+// normalize returns output normalized according to enc. A nil enc leaves output unchanged.
+func (enc *OutputEncoding) normalize(output string) (string, error) {
+	if enc == nil {
+		return output, nil
+	}
+	if !enc.KeepCRLF {
+		output = strings.Replace(output, "\r\n", "\n", -1)
+	}
+	if enc.StripANSI && strings.IndexByte(output, '\x1b') >= 0 {
+		output = ansiEscapePattern.ReplaceAllString(output, "")
+	}
+	switch enc.InvalidUTF8 {
+	case InvalidUTF8Replace:
+		output = strings.ToValidUTF8(output, string(utf8.RuneError))
+	case InvalidUTF8Error:
+		if !utf8.ValidString(output) {
+			return "", errors.Errorf(errors.ParseError, "output isn't valid UTF-8 at byte %d", invalidUTF8Offset(output))
+		}
+	}
+	return output, nil
+}
+
+// normalizeLine normalizes a line of output, without its LF, according to enc. With a nil enc,
+// only the CR of a CRLF line ending is removed.
+func (enc *OutputEncoding) normalizeLine(line string) (string, error) {
+	if enc == nil || !enc.KeepCRLF {
+		line = strings.TrimRight(line, "\r")
+	}
+	if enc == nil {
+		return line, nil
+	}
+	return enc.normalize(line)
+}
+
+// invalidUTF8Offset returns the offset of the first byte of s that isn't valid UTF-8.
+func invalidUTF8Offset(s string) int {
+	for i, r := range s {
+		if r == utf8.RuneError {
+			if _, size := utf8.DecodeRuneInString(s[i:]); size == 1 {
+				return i
+			}
+		}
+	}
+	return len(s)
+}
@@ -0,0 +1,73 @@
+package adb
+
+import (
+	"testing"
+
+	"github.com/mqhack/goadb/internal/errors"
+	"github.com/mqhack/goadb/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOutputEncodingNormalize(t *testing.T) {
+	output := "\x1b]0;shell\x07\x1b[1;31mred\x1b[0m\r\nplain \xff\xfe\r\n"
+
+	normalized, err := (*OutputEncoding)(nil).normalize(output)
+	require.NoError(t, err)
+	assert.Equal(t, output, normalized)
+
+	normalized, err = (&OutputEncoding{}).normalize(output)
+	require.NoError(t, err)
+	assert.Equal(t, "\x1b]0;shell\x07\x1b[1;31mred\x1b[0m\nplain \xff\xfe\n", normalized)
+
+	normalized, err = (&OutputEncoding{KeepCRLF: true, StripANSI: true, InvalidUTF8: InvalidUTF8Replace}).normalize(output)
+	require.NoError(t, err)
+	assert.Equal(t, "red\r\nplain �\r\n", normalized)
+
+	_, err = (&OutputEncoding{InvalidUTF8: InvalidUTF8Error}).normalize(output)
+	assert.Equal(t, errors.ParseError, code(err))
+	assert.Contains(t, err.Error(), "at byte 31")
+}
+
+func TestOutputEncodingNormalizeLine(t *testing.T) {
+	line, err := (*OutputEncoding)(nil).normalizeLine("\x1b[32mline\x1b[0m\r")
+	require.NoError(t, err)
+	assert.Equal(t, "\x1b[32mline\x1b[0m", line)
+
+	line, err = (&OutputEncoding{KeepCRLF: true, StripANSI: true}).normalizeLine("\x1b[32mline\x1b[0m\r")
+	require.NoError(t, err)
+	assert.Equal(t, "line\r", line)
+}
+
+func TestRunCommandOutputEncoding(t *testing.T) {
+	s := &MockServer{
+		Status:   wire.StatusSuccess,
+		Messages: []string{"\x1b[1mone\x1b[0m\r\ntwo\r\n"},
+	}
+	device := (&Adb{server: s}).Device(AnyDevice())
+	device.SetOutputEncoding(&OutputEncoding{StripANSI: true})
+
+	output, err := device.RunCommand("ls", "--color")
+	require.NoError(t, err)
+	assert.Equal(t, "one\ntwo\n", output)
+}
+
+func TestLines(t *testing.T) {
+	s := &MockServer{
+		Status:   wire.StatusSuccess,
+		Messages: []string{"one\r\n\r\ntwo\r\n"},
+	}
+	lines, err := (&Adb{server: s}).Device(AnyDevice()).Lines("ls")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"one", "", "two"}, lines)
+
+	s = &MockServer{
+		Status:   wire.StatusSuccess,
+		Messages: []string{"one\r\ntwo"},
+	}
+	device := (&Adb{server: s}).Device(AnyDevice())
+	device.SetOutputEncoding(&OutputEncoding{KeepCRLF: true})
+	lines, err = device.Lines("ls")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"one\r", "two"}, lines)
+}
@@ -0,0 +1,108 @@
+package adb
+
+import (
+	"strings"
+
+	"github.com/mqhack/goadb/internal/errors"
+)
+
+// PackageFailure is the reason the package manager gave for refusing to install or uninstall
+// a package, e.g. INSTALL_FAILED_VERSION_DOWNGRADE. The constants are the common ones, but any
+// reason the device gives is reported.
+type PackageFailure string
+
+const (
+	// The package is already installed, and InstallOptions.Replace isn't set.
+	InstallFailedAlreadyExists PackageFailure = "INSTALL_FAILED_ALREADY_EXISTS"
+	// The device doesn't have enough storage for the package.
+	InstallFailedInsufficientStorage PackageFailure = "INSTALL_FAILED_INSUFFICIENT_STORAGE"
+	// The package is older than the installed one, and InstallOptions.AllowDowngrade isn't
+	// set.
+	InstallFailedVersionDowngrade PackageFailure = "INSTALL_FAILED_VERSION_DOWNGRADE"
+	// The package is signed with a different certificate than the installed one.
+	InstallFailedUpdateIncompatible PackageFailure = "INSTALL_FAILED_UPDATE_INCOMPATIBLE"
+	// The package has no native code for any of the device's ABIs.
+	InstallFailedNoMatchingABIs PackageFailure = "INSTALL_FAILED_NO_MATCHING_ABIS"
+	// The package is marked testOnly, and InstallOptions.AllowTest isn't set.
+	InstallFailedTestOnly PackageFailure = "INSTALL_FAILED_TEST_ONLY"
+	// The APK couldn't be parsed, e.g. because it's corrupt or isn't an APK.
+	InstallParseFailedNotAPK PackageFailure = "INSTALL_PARSE_FAILED_NOT_APK"
+	// The APK isn't signed, or its signature is invalid.
+	InstallParseFailedNoCertificates PackageFailure = "INSTALL_PARSE_FAILED_NO_CERTIFICATES"
+
+	// The package manager failed for an unspecified reason, which includes the package not
+	// being installed on older devices.
+	DeleteFailedInternalError PackageFailure = "DELETE_FAILED_INTERNAL_ERROR"
+	// The package is an active device administrator, e.g. an MDM agent.
+	DeleteFailedDevicePolicyManager PackageFailure = "DELETE_FAILED_DEVICE_POLICY_MANAGER"
+	// A user restriction set by the device's owner forbids uninstalling apps.
+	DeleteFailedUserRestricted PackageFailure = "DELETE_FAILED_USER_RESTRICTED"
+	// The device's owner has blocked uninstalling the package.
+	DeleteFailedOwnerBlocked PackageFailure = "DELETE_FAILED_OWNER_BLOCKED"
+	// The package is a shared library that installed packages use.
+	DeleteFailedUsedSharedLibrary PackageFailure = "DELETE_FAILED_USED_SHARED_LIBRARY"
+	// The installed package's version code isn't UninstallOptions.VersionCode.
+	DeleteFailedAborted PackageFailure = "DELETE_FAILED_ABORTED"
+)
+
+/*
+PackageFailureReason returns the reason the package manager gave for err, or "" if err
+doesn't have code PackageManagerError.
+*/
+func PackageFailureReason(err error) PackageFailure {
+	for {
+		e, ok := err.(*errors.Err)
+		if !ok {
+			return ""
+		}
+		if reason, ok := e.Details.(PackageFailure); ok && e.Code == errors.PackageManagerError {
+			return reason
+		}
+		err = e.Cause
+	}
+}
+
+// parsePackageManagerResult returns the error reported in the output of the pm command cmd,
+// which starts with Success if it succeeded, e.g.
+//
+//	Failure [INSTALL_FAILED_VERSION_DOWNGRADE: Downgrade detected: ...]
+//
+// The error has code PackageManagerError if the output gives a reason, and AdbError otherwise.
+func parsePackageManagerResult(cmd, output string) error {
+	output = strings.TrimSpace(output)
+	if strings.HasPrefix(output, "Success") {
+		return nil
+	}
+	start, end := strings.Index(output, "["), strings.LastIndex(output, "]")
+	if start >= 0 && end > start {
+		reason, message, _ := strings.Cut(output[start+1:end], ":")
+		if isPackageFailure(reason) {
+			if message = strings.TrimSpace(message); message == "" {
+				message = "failed"
+			}
+			return &errors.Err{
+				Code:    errors.PackageManagerError,
+				Message: cmd + ": " + message,
+				Details: PackageFailure(reason),
+			}
+		}
+	}
+	if output == "" {
+		output = "no output"
+	}
+	return errors.Errorf(errors.AdbError, "%s failed: %s", cmd, output)
+}
+
+// isPackageFailure returns whether s looks like a failure reason: upper case words separated
+// by underscores.
+func isPackageFailure(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if (r < 'A' || r > 'Z') && (r < '0' || r > '9') && r != '_' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,25 @@
+package adb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePackageManagerResult(t *testing.T) {
+	assert.NoError(t, parsePackageManagerResult("install-commit", "Success\r\n"))
+
+	err := parsePackageManagerResult("install-commit",
+		"Failure [INSTALL_FAILED_VERSION_DOWNGRADE: Downgrade detected: Update version code 1 is older than current 2]\n")
+	assert.True(t, HasErrCode(err, PackageManagerError))
+	assert.Equal(t, InstallFailedVersionDowngrade, PackageFailureReason(err))
+	assert.EqualError(t, err, "PackageManagerError: install-commit: Downgrade detected: "+
+		"Update version code 1 is older than current 2 (INSTALL_FAILED_VERSION_DOWNGRADE)")
+
+	err = parsePackageManagerResult("uninstall com.example", "Failure [DELETE_FAILED_DEVICE_POLICY_MANAGER]")
+	assert.Equal(t, DeleteFailedDevicePolicyManager, PackageFailureReason(wrapClientError(err, &Device{}, "Uninstall")))
+
+	err = parsePackageManagerResult("install-write", "Error: java.lang.IllegalStateException")
+	assert.True(t, HasErrCode(err, AdbError))
+	assert.Equal(t, PackageFailure(""), PackageFailureReason(err))
+}
@@ -0,0 +1,281 @@
+package adb
+
+import (
+	"bufio"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mqhack/goadb/internal/errors"
+)
+
+// PackageInfo describes an installed package, as reported by dumpsys package. Fields the
+// device's version doesn't report are left zero.
+type PackageInfo struct {
+	Package     string
+	UID         int
+	VersionCode int64
+	VersionName string
+	MinSDK      int
+	TargetSDK   int
+	// CodePath is the directory the package's APKs are in.
+	CodePath string
+	// Installer is the package that installed it, e.g. com.android.vending, or "" if it
+	// wasn't installed by a package.
+	Installer string
+
+	// Flags are the package's ApplicationInfo flags, e.g. "SYSTEM", "DEBUGGABLE", and
+	// PrivateFlags its private flags, e.g. "PRIVILEGED".
+	Flags, PrivateFlags []string
+	// RequestedPermissions are the permissions in the manifest, in its order.
+	RequestedPermissions []string
+	// GrantedPermissions are the install-time permissions, and runtime permissions granted
+	// for any user, sorted.
+	GrantedPermissions []string
+	// Signatures are the hashes dumpsys reports for the package's signing certificates, which
+	// identify them on the device but aren't digests of them.
+	Signatures []string
+
+	// FirstInstallTime and LastUpdateTime are in the device's time zone, from
+	// persist.sys.timezone, since dumpsys prints them without one. They're in UTC if the
+	// device doesn't set the property, or the host doesn't know its zone.
+	FirstInstallTime, LastUpdateTime time.Time
+}
+
+// HasFlag returns whether the package has the ApplicationInfo flag, e.g. "DEBUGGABLE".
+func (p *PackageInfo) HasFlag(flag string) bool {
+	for _, f := range p.Flags {
+		if f == flag {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+PackageInfo returns what the package manager knows about the installed package pkg. The error
+has code FileNoExistError if it isn't installed.
+
+Corresponds to the command:
+
+	adb shell dumpsys package <pkg>
+*/
+func (c *Device) PackageInfo(pkg string) (*PackageInfo, error) {
+	output, err := c.RunCommand("dumpsys", "package", pkg)
+	if err != nil {
+		return nil, wrapClientError(err, c, "PackageInfo(%s)", pkg)
+	}
+	loc, err := c.deviceLocation()
+	if err != nil {
+		return nil, wrapClientError(err, c, "PackageInfo(%s)", pkg)
+	}
+	info, err := parsePackageInfo(pkg, output, loc)
+	return info, wrapClientError(err, c, "PackageInfo(%s)", pkg)
+}
+
+// deviceLocation returns the device's time zone, or UTC if it's not set or the host's time
+// zone database doesn't have it.
+func (c *Device) deviceLocation() (*time.Location, error) {
+	zone, err := c.getProp("persist.sys.timezone")
+	if err != nil {
+		return nil, err
+	}
+	if zone == "" {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(zone)
+	if err != nil {
+		return time.UTC, nil
+	}
+	return loc, nil
+}
+
+// Headers of the permission lists in a package's dump.
+const (
+	requestedPermissionsHeader = "requested permissions:"
+	installPermissionsHeader   = "install permissions:"
+	runtimePermissionsHeader   = "runtime permissions:"
+)
+
+// parsePackageInfo parses the section for pkg in the output of dumpsys package, e.g.
+//
+//	Packages:
+//	  Package [com.example] (c0ffee):
+//	    userId=10123
+//	    versionCode=42 minSdk=24 targetSdk=33
+//	    versionName=1.2.3
+//	    flags=[ HAS_CODE ALLOW_CLEAR_USER_DATA ALLOW_BACKUP ]
+//	    firstInstallTime=2023-01-02 03:04:06
+//	    signatures=PackageSignatures{fa11 version:2, signatures:[a1b2c3d4], past signatures:[]}
+//	    requested permissions:
+//	      android.permission.CAMERA
+//	    User 0: ceDataInode=4242 installed=true hidden=false
+//	      runtime permissions:
+//	        android.permission.CAMERA: granted=true, flags=[ USER_SET ]
+//
+// Only the first section is parsed, since an updated system package also has one under
+// Hidden system packages for the version in the system image. Times are parsed in loc.
+func parsePackageInfo(pkg, output string, loc *time.Location) (*PackageInfo, error) {
+	info := &PackageInfo{Package: pkg}
+	granted := make(map[string]bool)
+	var pkgFlags []string
+	found := false
+	// The indent of the Package line, and of the header of the permission list being read, or
+	// -1 if none is.
+	sectionIndent, listIndent := -1, -1
+	var list string
+
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		raw := strings.TrimRight(scanner.Text(), "\r")
+		line := strings.TrimSpace(raw)
+		indent := len(raw) - len(strings.TrimLeft(raw, " "))
+		if line == "" {
+			continue
+		}
+		if sectionIndent < 0 {
+			if strings.HasPrefix(line, "Package ["+pkg+"]") {
+				sectionIndent, found = indent, true
+			}
+			continue
+		}
+		if indent <= sectionIndent {
+			break
+		}
+
+		if listIndent >= 0 && indent > listIndent {
+			name, rest, _ := strings.Cut(line, ":")
+			name, _, _ = strings.Cut(name, ",")
+			switch {
+			case list == requestedPermissionsHeader:
+				info.RequestedPermissions = append(info.RequestedPermissions, name)
+			case strings.Contains(rest, "granted=true"):
+				granted[name] = true
+			}
+			continue
+		}
+		listIndent = -1
+		switch line {
+		case requestedPermissionsHeader, installPermissionsHeader, runtimePermissionsHeader:
+			list, listIndent = line, indent
+			continue
+		}
+
+		if err := parsePackageInfoLine(info, &pkgFlags, line, loc); err != nil {
+			return nil, err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.WrapErrorf(err, errors.ParseError, "error reading package dump")
+	}
+	if !found {
+		return nil, errors.Errorf(errors.FileNoExistError, "package %s isn't installed", pkg)
+	}
+
+	if info.Flags == nil {
+		info.Flags = pkgFlags
+	}
+	for name := range granted {
+		info.GrantedPermissions = append(info.GrantedPermissions, name)
+	}
+	sort.Strings(info.GrantedPermissions)
+	return info, nil
+}
+
+// parsePackageInfoLine sets the fields of info on line, which isn't in a permission list.
+func parsePackageInfoLine(info *PackageInfo, pkgFlags *[]string, line string, loc *time.Location) error {
+	key, value, ok := strings.Cut(line, "=")
+	if !ok {
+		return nil
+	}
+	// Values that contain spaces take up the rest of the line.
+	switch key {
+	case "flags":
+		info.Flags = parseFlagList(value)
+		return nil
+	case "privateFlags":
+		info.PrivateFlags = parseFlagList(value)
+		return nil
+	case "pkgFlags":
+		*pkgFlags = parseFlagList(value)
+		return nil
+	case "firstInstallTime":
+		info.FirstInstallTime = parsePackageTime(value, loc)
+		return nil
+	case "lastUpdateTime":
+		info.LastUpdateTime = parsePackageTime(value, loc)
+		return nil
+	case "signatures":
+		info.Signatures = parseSignatures(value)
+		return nil
+	case "versionName":
+		info.VersionName = value
+		return nil
+	}
+
+	// The rest have no spaces, and some lines have several, e.g. versionCode=42 targetSdk=33.
+	for _, field := range strings.Fields(line) {
+		key, value, _ := strings.Cut(field, "=")
+		var err error
+		switch key {
+		case "userId":
+			info.UID, err = strconv.Atoi(value)
+		case "versionCode":
+			info.VersionCode, err = strconv.ParseInt(value, 10, 64)
+		case "minSdk":
+			info.MinSDK, err = strconv.Atoi(value)
+		case "targetSdk":
+			info.TargetSDK, err = strconv.Atoi(value)
+		case "codePath":
+			info.CodePath = value
+		case "installerPackageName":
+			info.Installer = value
+		}
+		if err != nil {
+			return errors.WrapErrorf(err, errors.ParseError, "invalid %s in package dump: %q", key, value)
+		}
+	}
+	return nil
+}
+
+// parseFlagList parses a list of flags like "[ HAS_CODE ALLOW_BACKUP ]".
+func parseFlagList(value string) []string {
+	return strings.Fields(strings.Trim(value, "[] "))
+}
+
+// parsePackageTime parses a time like "2023-01-02 03:04:06" in loc, or returns the zero time.
+func parsePackageTime(value string, loc *time.Location) time.Time {
+	t, err := time.ParseInLocation("2006-01-02 15:04:05", strings.TrimSpace(value), loc)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// parseSignatures returns the hashes in a PackageSignatures, e.g.
+// "PackageSignatures{fa11 version:2, signatures:[a1b2c3d4], past signatures:[]}", or
+// "PackageSignatures{419a4b2 [53c7caf1]}" before Android P.
+func parseSignatures(value string) []string {
+	start := strings.Index(value, "signatures:[")
+	if start >= 0 {
+		start += len("signatures:")
+	} else {
+		start = strings.Index(value, "[")
+	}
+	if start < 0 {
+		return nil
+	}
+	end := strings.Index(value[start:], "]")
+	if end < 0 {
+		return nil
+	}
+	var sigs []string
+	for _, sig := range strings.Split(value[start+1:start+end], ",") {
+		if sig = strings.TrimSpace(sig); sig != "" {
+			sigs = append(sigs, sig)
+		}
+	}
+	return sigs
+}
@@ -0,0 +1,136 @@
+package adb
+
+import (
+	"strings"
+	"testing"
+	"time"
+	_ "time/tzdata"
+
+	"github.com/mqhack/goadb/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var tokyo = time.FixedZone("JST", 9*60*60)
+
+const packageDump = `Activity Resolver Table:
+  Non-Data Actions:
+      android.intent.action.MAIN:
+        c0ffee com.example/.MainActivity filter 1f2e3d
+
+Packages:
+  Package [com.example] (c0ffee):
+    userId=10123
+    pkg=Package{5ca1ab1 com.example}
+    codePath=/data/app/~~k3Pa4w==/com.example-Xy9z==
+    versionCode=42 minSdk=24 targetSdk=33
+    versionName=1.2.3
+    splits=[base]
+    flags=[ HAS_CODE ALLOW_CLEAR_USER_DATA DEBUGGABLE ]
+    privateFlags=[ PRIVATE_FLAG_ACTIVITIES_RESIZE_MODE_RESIZEABLE ]
+    timeStamp=2023-01-02 03:04:05
+    firstInstallTime=2023-01-02 03:04:06
+    lastUpdateTime=2023-02-03 04:05:06
+    installerPackageName=com.android.vending
+    signatures=PackageSignatures{fa11 version:2, signatures:[a1b2c3d4], past signatures:[]}
+    pkgFlags=[ HAS_CODE ALLOW_CLEAR_USER_DATA DEBUGGABLE ]
+    requested permissions:
+      android.permission.INTERNET
+      android.permission.CAMERA
+      android.permission.READ_CONTACTS: restricted=true
+    install permissions:
+      android.permission.INTERNET: granted=true
+    User 0: ceDataInode=4242 installed=true hidden=false suspended=false stopped=false
+      gids=[3003]
+      runtime permissions:
+        android.permission.CAMERA: granted=true, flags=[ USER_SET ]
+        android.permission.READ_CONTACTS: granted=false, flags=[ USER_SET ]
+    User 10: ceDataInode=0 installed=false hidden=false suspended=false stopped=true
+
+Hidden system packages:
+  Package [com.example] (deadbe):
+    userId=10123
+    versionCode=1 minSdk=24 targetSdk=30
+`
+
+func TestParsePackageInfo(t *testing.T) {
+	info, err := parsePackageInfo("com.example", packageDump, tokyo)
+	require.NoError(t, err)
+	assert.Equal(t, &PackageInfo{
+		Package:              "com.example",
+		UID:                  10123,
+		VersionCode:          42,
+		VersionName:          "1.2.3",
+		MinSDK:               24,
+		TargetSDK:            33,
+		CodePath:             "/data/app/~~k3Pa4w==/com.example-Xy9z==",
+		Installer:            "com.android.vending",
+		Flags:                []string{"HAS_CODE", "ALLOW_CLEAR_USER_DATA", "DEBUGGABLE"},
+		PrivateFlags:         []string{"PRIVATE_FLAG_ACTIVITIES_RESIZE_MODE_RESIZEABLE"},
+		RequestedPermissions: []string{"android.permission.INTERNET", "android.permission.CAMERA", "android.permission.READ_CONTACTS"},
+		GrantedPermissions:   []string{"android.permission.CAMERA", "android.permission.INTERNET"},
+		Signatures:           []string{"a1b2c3d4"},
+		FirstInstallTime:     time.Date(2023, 1, 2, 3, 4, 6, 0, tokyo),
+		LastUpdateTime:       time.Date(2023, 2, 3, 4, 5, 6, 0, tokyo),
+	}, info)
+	assert.True(t, info.HasFlag("DEBUGGABLE"))
+	assert.False(t, info.HasFlag("SYSTEM"))
+}
+
+func TestPackageInfoDeviceTimeZone(t *testing.T) {
+	s := &MockServer{
+		Status:          wire.StatusSuccess,
+		SeparateOutputs: true,
+		Messages:        []string{packageDump, "Asia/Tokyo\n"},
+	}
+	info, err := (&Adb{server: s}).Device(AnyDevice()).PackageInfo("com.example")
+	require.NoError(t, err)
+	assert.Equal(t, "shell:getprop persist.sys.timezone", s.Requests[3])
+	assert.Equal(t, "Asia/Tokyo", info.FirstInstallTime.Location().String())
+	assert.True(t, time.Date(2023, 1, 2, 3, 4, 6, 0, tokyo).Equal(info.FirstInstallTime))
+
+	// Zones the host doesn't know fall back to UTC.
+	s = &MockServer{
+		Status:          wire.StatusSuccess,
+		SeparateOutputs: true,
+		Messages:        []string{packageDump, "Nowhere/Special\n"},
+	}
+	info, err = (&Adb{server: s}).Device(AnyDevice()).PackageInfo("com.example")
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2023, 1, 2, 3, 4, 6, 0, time.UTC), info.FirstInstallTime)
+}
+
+func TestParsePackageInfoOld(t *testing.T) {
+	info, err := parsePackageInfo("com.example", "Packages:\n"+
+		"  Package [com.example] (419a4b2):\n"+
+		"    userId=10052 gids=[3003]\n"+
+		"    versionCode=7 targetSdk=19\n"+
+		"    signatures=PackageSignatures{419a4b2 [53c7caf1]}\n"+
+		"    pkgFlags=[ HAS_CODE ALLOW_BACKUP ]\n", time.UTC)
+	require.NoError(t, err)
+	assert.Equal(t, 10052, info.UID)
+	assert.Equal(t, int64(7), info.VersionCode)
+	assert.Equal(t, 19, info.TargetSDK)
+	assert.Equal(t, []string{"53c7caf1"}, info.Signatures)
+	assert.Equal(t, []string{"HAS_CODE", "ALLOW_BACKUP"}, info.Flags)
+}
+
+func TestParsePackageInfoNotInstalled(t *testing.T) {
+	_, err := parsePackageInfo("com.missing", "Unable to find package: com.missing\n", time.UTC)
+	assert.True(t, HasErrCode(err, FileNoExistError))
+}
+
+func TestParsePackageInfoVersionNameWithSpaces(t *testing.T) {
+	info, err := parsePackageInfo("com.example", "Packages:\n"+
+		"  Package [com.example] (c0ffee):\n"+
+		"    versionName=2.0 beta (build 7)\n", time.UTC)
+	require.NoError(t, err)
+	assert.Equal(t, "2.0 beta (build 7)", info.VersionName)
+}
+
+func TestParsePackageInfoLineTooLong(t *testing.T) {
+	_, err := parsePackageInfo("com.example", "Packages:\n"+
+		"  Package [com.example] (c0ffee):\n"+
+		"    signatures="+strings.Repeat("x", 2<<20)+"\n", time.UTC)
+	assert.True(t, HasErrCode(err, ParseError))
+}
@@ -0,0 +1,109 @@
+package adb
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/mqhack/goadb/internal/errors"
+)
+
+// PackageEnabledState is whether a package is enabled, as pm reports it after enabling or
+// disabling it.
+type PackageEnabledState string
+
+const (
+	// PackageDefault is the state the package's manifest declares.
+	PackageDefault PackageEnabledState = "default"
+	PackageEnabled PackageEnabledState = "enabled"
+	// PackageDisabled means the package was disabled by the system or its own code.
+	PackageDisabled PackageEnabledState = "disabled"
+	// PackageDisabledUser means the package was disabled by the user, as DisablePackage does.
+	PackageDisabledUser PackageEnabledState = "disabled-user"
+	// PackageDisabledUntilUsed means the package is enabled once another app uses it.
+	PackageDisabledUntilUsed PackageEnabledState = "disabled-until-used"
+)
+
+/*
+ClearAppData deletes all the data of the package pkg, including its files, databases, shared
+preferences, cache and granted runtime permissions, and stops it, like Settings' clear storage
+button. The error has code FileNoExistError if pkg isn't installed.
+
+Corresponds to the command:
+
+	adb shell pm clear <pkg>
+*/
+func (c *Device) ClearAppData(pkg string) error {
+	output, err := c.runPackageCommand("pm clear " + shellQuote(pkg))
+	if err == nil && strings.TrimSpace(output) != "Success" {
+		// pm prints Failed, without a reason, e.g. if pkg isn't installed on older devices.
+		err = errors.Errorf(errors.AdbError, "pm clear failed: %s", strings.TrimSpace(output))
+	}
+	return wrapClientError(err, c, "ClearAppData(%s)", pkg)
+}
+
+/*
+ForceStop stops everything associated with the package pkg: its processes, services and
+alarms, like Settings' force stop button. It's not an error if pkg isn't running.
+
+Corresponds to the command:
+
+	adb shell am force-stop <pkg>
+*/
+func (c *Device) ForceStop(pkg string) error {
+	_, err := c.runPackageCommand("am force-stop " + shellQuote(pkg))
+	return wrapClientError(err, c, "ForceStop(%s)", pkg)
+}
+
+/*
+DisablePackage disables the package pkg for the user with ID user, or the system user if user
+isn't positive, so none of its components can run and it's hidden from the launcher, and
+returns its new state, PackageDisabledUser. The error has code FileNoExistError if pkg isn't
+installed, or PermissionDenied if the device doesn't allow disabling it, e.g. because it's
+required by the system.
+
+Corresponds to the command:
+
+	adb shell pm disable-user [--user <user>] <pkg>
+*/
+func (c *Device) DisablePackage(pkg string, user int) (PackageEnabledState, error) {
+	state, err := c.setPackageEnabled("disable-user", pkg, user)
+	return state, wrapClientError(err, c, "DisablePackage(%s)", pkg)
+}
+
+/*
+EnablePackage enables the package pkg for the user with ID user, or the system user if user
+isn't positive, and returns its new state, PackageEnabled.
+
+Corresponds to the command:
+
+	adb shell pm enable [--user <user>] <pkg>
+*/
+func (c *Device) EnablePackage(pkg string, user int) (PackageEnabledState, error) {
+	state, err := c.setPackageEnabled("enable", pkg, user)
+	return state, wrapClientError(err, c, "EnablePackage(%s)", pkg)
+}
+
+// setPackageEnabled runs pm verb for pkg and user, and returns the new state it reports.
+func (c *Device) setPackageEnabled(verb, pkg string, user int) (PackageEnabledState, error) {
+	cmd := "pm " + verb
+	if user > 0 {
+		cmd += " --user " + strconv.Itoa(user)
+	}
+	output, err := c.runPackageCommand(cmd + " " + shellQuote(pkg))
+	if err != nil {
+		return "", err
+	}
+	return parsePackageEnabledState(output)
+}
+
+// parsePackageEnabledState parses the output of pm enable or disable, e.g.
+//
+//	Package com.example new state: disabled-user
+func parsePackageEnabledState(output string) (PackageEnabledState, error) {
+	output = strings.TrimSpace(output)
+	i := strings.LastIndex(output, "new state:")
+	if i < 0 {
+		return "", errors.Errorf(errors.AdbError, "pm didn't report the package's new state: %s", output)
+	}
+	return PackageEnabledState(strings.TrimSpace(output[i+len("new state:"):])), nil
+}
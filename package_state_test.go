@@ -0,0 +1,50 @@
+package adb
+
+import (
+	"testing"
+
+	"github.com/mqhack/goadb/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClearAppData(t *testing.T) {
+	s := &MockServer{Status: wire.StatusSuccess, Messages: []string{"Success\r\n"}}
+	require.NoError(t, (&Adb{server: s}).Device(AnyDevice()).ClearAppData("com.example"))
+	assert.Equal(t, "shell:pm clear 'com.example' 2>&1", s.Requests[1])
+
+	s = &MockServer{Status: wire.StatusSuccess, Messages: []string{"Failed\n"}}
+	assert.True(t, HasErrCode((&Adb{server: s}).Device(AnyDevice()).ClearAppData("com.example"), AdbError))
+}
+
+func TestForceStop(t *testing.T) {
+	s := &MockServer{Status: wire.StatusSuccess, Messages: []string{""}}
+	require.NoError(t, (&Adb{server: s}).Device(AnyDevice()).ForceStop("com.example"))
+	assert.Equal(t, "shell:am force-stop 'com.example' 2>&1", s.Requests[1])
+}
+
+func TestDisablePackage(t *testing.T) {
+	s := &MockServer{Status: wire.StatusSuccess, Messages: []string{"Package com.example new state: disabled-user\n"}}
+	state, err := (&Adb{server: s}).Device(AnyDevice()).DisablePackage("com.example", 10)
+	require.NoError(t, err)
+	assert.Equal(t, PackageDisabledUser, state)
+	assert.Equal(t, "shell:pm disable-user --user 10 'com.example' 2>&1", s.Requests[1])
+
+	s = &MockServer{Status: wire.StatusSuccess, Messages: []string{
+		"Exception occurred while executing 'disable-user':\njava.lang.IllegalArgumentException: " +
+			"Cannot disable a protected package: com.android.settings\n"}}
+	_, err = (&Adb{server: s}).Device(AnyDevice()).DisablePackage("com.android.settings", 0)
+	assert.True(t, HasErrCode(err, PermissionDenied))
+}
+
+func TestEnablePackage(t *testing.T) {
+	s := &MockServer{Status: wire.StatusSuccess, Messages: []string{"Package com.example new state: enabled\n"}}
+	state, err := (&Adb{server: s}).Device(AnyDevice()).EnablePackage("com.example", 0)
+	require.NoError(t, err)
+	assert.Equal(t, PackageEnabled, state)
+	assert.Equal(t, "shell:pm enable 'com.example' 2>&1", s.Requests[1])
+
+	s = &MockServer{Status: wire.StatusSuccess, Messages: []string{"Error: java.lang.IllegalArgumentException: Unknown package: com.missing\n"}}
+	_, err = (&Adb{server: s}).Device(AnyDevice()).EnablePackage("com.missing", 0)
+	assert.True(t, HasErrCode(err, FileNoExistError))
+}
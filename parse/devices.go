@@ -0,0 +1,133 @@
+package parse
+
+import (
+	"bufio"
+	"regexp"
+	"strings"
+
+	"github.com/mqhack/goadb/internal/errors"
+)
+
+// DeviceLine is a device listed by adb devices.
+type DeviceLine struct {
+	Serial string
+	// State is the state column, e.g. "device" or "no permissions (...)".
+	State string
+	// Attributes are the key:value attributes of the long format, e.g. "model" and "usb".
+	// Nil in the short format.
+	Attributes map[string]string
+}
+
+// deviceAttributePattern matches a key:value attribute in the long device list format.
+// Keys are always lowercase identifiers, which distinguishes them from words in
+// free-form states like "no permissions (...); see [http://...]".
+var deviceAttributePattern = regexp.MustCompile(`^([a-z_]+):(.*)$`)
+
+/*
+DeviceList parses the output of adb devices, which is the short format, or adb devices -l if
+long is true. Blank lines are skipped.
+
+If strict is true, a list that doesn't end with a newline, which means it was truncated, and
+malformed or duplicate attributes are errors. Otherwise malformed attributes are skipped.
+Attributes aren't checked against the ones the server is known to report, which is up to
+the caller.
+*/
+func DeviceList(list string, long, strict bool) ([]*DeviceLine, error) {
+	if strict && list != "" && !strings.HasSuffix(list, "\n") {
+		return nil, errors.Errorf(errors.ParseError, "device list truncated, last line: %s", lastLine(list))
+	}
+
+	parseLine := ShortDeviceLine
+	if long {
+		parseLine = LongDeviceLine
+	}
+	devices := []*DeviceLine{}
+	scanner := bufio.NewScanner(strings.NewReader(list))
+	for scanner.Scan() {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		device, err := parseLine(scanner.Text(), strict)
+		if err != nil {
+			return nil, err
+		}
+		devices = append(devices, device)
+	}
+	return devices, nil
+}
+
+// ShortDeviceLine parses a line of adb devices output, e.g. "SERIAL\tdevice". strict has no
+// effect, and is there for symmetry with LongDeviceLine.
+func ShortDeviceLine(line string, strict bool) (*DeviceLine, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		return nil, errors.Errorf(errors.ParseError,
+			"malformed device line, expected at least 2 fields but found %d", len(fields))
+	}
+
+	// The state may be more than one word, e.g. "no permissions".
+	return &DeviceLine{Serial: fields[0], State: strings.Join(fields[1:], " ")}, nil
+}
+
+// LongDeviceLine parses a line of adb devices -l output, e.g.
+// "SERIAL device usb:1-1 product:sdk model:Pixel device:generic transport_id:1".
+func LongDeviceLine(line string, strict bool) (*DeviceLine, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		return nil, errors.Errorf(errors.ParseError,
+			"malformed device line, expected at least 2 fields but found %d", len(fields))
+	}
+
+	// The state runs from the second field up to the first attribute.
+	attrsStart := 2
+	for attrsStart < len(fields) && !deviceAttributePattern.MatchString(fields[attrsStart]) {
+		attrsStart++
+	}
+
+	attrs, err := parseDeviceAttributes(fields[attrsStart:], strict)
+	if err != nil {
+		return nil, err
+	}
+	return &DeviceLine{
+		Serial:     fields[0],
+		State:      strings.Join(fields[1:attrsStart], " "),
+		Attributes: attrs,
+	}, nil
+}
+
+func parseDeviceAttributes(fields []string, strict bool) (map[string]string, error) {
+	attrs := map[string]string{}
+	for _, field := range fields {
+		key, val, ok := parseKeyVal(field)
+		if !ok {
+			if strict {
+				return nil, errors.Errorf(errors.ParseError, "malformed device attribute: %s", field)
+			}
+			continue
+		}
+		if _, dup := attrs[key]; dup && strict {
+			return nil, errors.Errorf(errors.ParseError, "duplicate device attribute: %s", key)
+		}
+		attrs[key] = val
+	}
+	return attrs, nil
+}
+
+// Parses a key:val pair and returns key, val. Only the first colon is treated as the
+// separator, so values may contain colons. Returns false if pair isn't an attribute.
+func parseKeyVal(pair string) (string, string, bool) {
+	match := deviceAttributePattern.FindStringSubmatch(pair)
+	if match == nil {
+		return "", "", false
+	}
+	return match[1], match[2], true
+}
+
+// lastLine returns the last non-empty line of s.
+func lastLine(s string) string {
+	s = strings.TrimRight(s, "\n")
+	if i := strings.LastIndex(s, "\n"); i >= 0 {
+		return s[i+1:]
+	}
+	return s
+}
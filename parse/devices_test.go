@@ -0,0 +1,70 @@
+package parse
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mqhack/goadb/internal/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeviceList(t *testing.T) {
+	devices, err := DeviceList("SERIAL1\tdevice\n\nSERIAL2\tno permissions (user in plugdev group)\n", false, false)
+	require.NoError(t, err)
+	assert.Equal(t, []*DeviceLine{
+		{Serial: "SERIAL1", State: "device"},
+		{Serial: "SERIAL2", State: "no permissions (user in plugdev group)"},
+	}, devices)
+
+	devices, err = DeviceList("SERIAL    device usb:1-1 product:sdk model:Pixel_5 device:redfin transport_id:3\n", true, true)
+	require.NoError(t, err)
+	assert.Equal(t, []*DeviceLine{{
+		Serial: "SERIAL",
+		State:  "device",
+		Attributes: map[string]string{
+			"usb":          "1-1",
+			"product":      "sdk",
+			"model":        "Pixel_5",
+			"device":       "redfin",
+			"transport_id": "3",
+		},
+	}}, devices)
+}
+
+func TestDeviceListStrict(t *testing.T) {
+	_, err := DeviceList("SERIAL\tdevice", false, true)
+	assert.True(t, errors.HasErrCode(err, errors.ParseError))
+
+	_, err = DeviceList("SERIAL device usb:1-1 usb:1-2\n", true, true)
+	assert.True(t, errors.HasErrCode(err, errors.ParseError))
+
+	devices, err := DeviceList("SERIAL device usb:1-1 connection_speed:5000\n", true, true)
+	require.NoError(t, err)
+	assert.Equal(t, "5000", devices[0].Attributes["connection_speed"])
+}
+
+func FuzzDeviceList(f *testing.F) {
+	f.Add("SERIAL1\tdevice\n\nSERIAL2\tunauthorized\n", false)
+	f.Add("SERIAL    device usb:1-1 product:sdk model:Pixel_5 device:redfin transport_id:3\n", true)
+	f.Add("SERIAL    no permissions (missing udev rules?); see [http://developer.android.com/tools/device.html] usb:1-1\n", true)
+	f.Fuzz(func(t *testing.T, list string, long bool) {
+		lenient, err := DeviceList(list, long, false)
+		if err != nil {
+			assert.True(t, errors.HasErrCode(err, errors.ParseError))
+			return
+		}
+		for _, device := range lenient {
+			assert.NotEmpty(t, device.Serial)
+			assert.False(t, strings.ContainsAny(device.Serial, " \t\n"), "serial %q contains whitespace", device.Serial)
+			assert.NotEmpty(t, device.State)
+		}
+
+		// Strict parsing only rejects lists that lenient parsing accepts, it never parses them
+		// differently.
+		strict, err := DeviceList(list, long, true)
+		if err == nil {
+			assert.Equal(t, lenient, strict)
+		}
+	})
+}
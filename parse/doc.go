@@ -0,0 +1,13 @@
+/*
+Package parse parses the text formats printed by adb and the commands it runs on devices, for
+tools that capture adb output some other way, e.g. from logs or a CI artifact, and want to
+interpret it the same way the goadb package does.
+
+	devices, err := parse.DeviceList(output, true, false)
+	props := parse.Getprop(getpropOutput)
+
+The goadb package uses these parsers itself, so they handle the variations between adb
+server and Android versions it does. Parsers that take a strict flag are lenient when it's
+false, skipping or tolerating anything they don't recognize, like goadb does by default.
+*/
+package parse
@@ -0,0 +1,35 @@
+package parse
+
+import (
+	"bufio"
+	"strings"
+
+	"github.com/mqhack/goadb/internal/errors"
+)
+
+// Forward is a port forward listed by adb forward --list.
+type Forward struct {
+	Serial string
+	// Local is the socket on the host, e.g. "tcp:8080".
+	Local string
+	// Remote is the socket on the device, e.g. "localabstract:chrome_devtools_remote".
+	Remote string
+}
+
+// ForwardList parses the output of adb forward --list, which has a line per forward, e.g.
+// "SERIAL tcp:8080 tcp:8080". Blank lines are skipped.
+func ForwardList(list string) ([]Forward, error) {
+	var forwards []Forward
+	scanner := bufio.NewScanner(strings.NewReader(list))
+	for scanner.Scan() {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 {
+			return nil, errors.Errorf(errors.ParseError, "malformed forward line: %s", scanner.Text())
+		}
+		forwards = append(forwards, Forward{Serial: fields[0], Local: fields[1], Remote: fields[2]})
+	}
+	return forwards, nil
+}
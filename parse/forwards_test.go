@@ -0,0 +1,41 @@
+package parse
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mqhack/goadb/internal/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestForwardList(t *testing.T) {
+	forwards, err := ForwardList("SERIAL1 tcp:8080 tcp:80\nSERIAL2 tcp:9222 localabstract:chrome_devtools_remote\n")
+	require.NoError(t, err)
+	assert.Equal(t, []Forward{
+		{"SERIAL1", "tcp:8080", "tcp:80"},
+		{"SERIAL2", "tcp:9222", "localabstract:chrome_devtools_remote"},
+	}, forwards)
+
+	_, err = ForwardList("SERIAL1 tcp:8080\n")
+	assert.True(t, errors.HasErrCode(err, errors.ParseError))
+}
+
+func FuzzForwardList(f *testing.F) {
+	f.Add("SERIAL1 tcp:8080 tcp:80\n")
+	f.Add("\n\nSERIAL tcp:9222 localabstract:chrome_devtools_remote")
+	f.Add("SERIAL1 tcp:8080\n")
+	f.Fuzz(func(t *testing.T, list string) {
+		forwards, err := ForwardList(list)
+		if err != nil {
+			assert.True(t, errors.HasErrCode(err, errors.ParseError))
+			return
+		}
+		for _, forward := range forwards {
+			for _, field := range []string{forward.Serial, forward.Local, forward.Remote} {
+				assert.NotEmpty(t, field)
+				assert.False(t, strings.ContainsAny(field, " \t\n"), "field %q contains whitespace", field)
+			}
+		}
+	})
+}
@@ -0,0 +1,25 @@
+package parse
+
+import (
+	"bufio"
+	"regexp"
+	"strings"
+)
+
+// Matches a line of getprop output, e.g. "[ro.build.version.sdk]: [30]".
+var getpropLinePattern = regexp.MustCompile(`^\[([^\]]+)\]: \[(.*)\]$`)
+
+// Getprop parses the output of getprop with no arguments into a map of property names to
+// values. Lines that aren't in the expected format, such as continuations of multi-line values,
+// are ignored.
+func Getprop(output string) map[string]string {
+	props := make(map[string]string)
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if match := getpropLinePattern.FindStringSubmatch(line); match != nil {
+			props[match[1]] = match[2]
+		}
+	}
+	return props
+}
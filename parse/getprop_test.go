@@ -0,0 +1,31 @@
+package parse
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetprop(t *testing.T) {
+	assert.Equal(t, map[string]string{
+		"ro.build.version.sdk": "30",
+		"empty":                "",
+		"with.brackets":        "[a] [b]",
+	}, Getprop("[ro.build.version.sdk]: [30]\r\n[empty]: []\n[with.brackets]: [[a] [b]]\n[multi]: [line1\nline2]\ngarbage\n"))
+}
+
+func FuzzGetprop(f *testing.F) {
+	f.Add("ro.build.version.sdk", "30")
+	f.Add("with.brackets", "[a] [b]")
+	f.Add("empty", "")
+	f.Fuzz(func(t *testing.T, key, value string) {
+		if key == "" || strings.ContainsAny(key, "]\r\n") || strings.ContainsAny(value, "\r\n") {
+			t.Skip()
+		}
+		// Any single-line property printed by getprop is parsed back.
+		props := Getprop(fmt.Sprintf("[%s]: [%s]\n", key, value))
+		assert.Equal(t, map[string]string{key: value}, props)
+	})
+}
@@ -0,0 +1,182 @@
+package parse
+
+import (
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LsEntry is a file listed by ls -l.
+type LsEntry struct {
+	Name string
+	Mode os.FileMode
+	// Size is zero for directories and devices.
+	Size       int64
+	ModifiedAt time.Time
+}
+
+// Matches ls -l lines with ISO dates, printed by toolbox (Android 5 and earlier):
+//
+//	-rw-r--r-- root     root         1234 2015-01-01 12:00 name
+//
+// and toybox (Android 6 and later), which adds a link count:
+//
+//	-rw-r--r-- 1 root root 1234 2015-01-01 12:00 name
+var lsISOLinePattern = regexp.MustCompile(`^([-dlcbps][-rwxsStT]{9})[.+@]?\s+(.*?)\s+(\d{4}-\d{2}-\d{2} \d{2}:\d{2})\s(.*)$`)
+
+// Matches ls -l lines printed by busybox, which has a link count and abbreviated dates:
+//
+//	-rw-r--r--    1 root     root          1234 Jan  1 12:00 name
+//	-rw-r--r--    1 root     root          1234 Jan  1  2015 name
+var lsBusyboxLinePattern = regexp.MustCompile(`^([-dlcbps][-rwxsStT]{9})[.+@]?\s+(.*?)\s+([A-Z][a-z]{2}\s+\d{1,2}\s+(?:\d{2}:\d{2}|\d{4}))\s(.*)$`)
+
+// lsFormats are the ls -l formats LsLine tries, in order, with the function that parses the
+// date matched by each.
+var lsFormats = []struct {
+	pattern   *regexp.Regexp
+	parseTime func(s string, now time.Time) (time.Time, error)
+}{
+	{lsISOLinePattern, parseISOLsTime},
+	{lsBusyboxLinePattern, parseBusyboxLsTime},
+}
+
+// LsLine parses a line of ls -l output, as printed by toolbox, toybox or busybox. Returns false
+// if it's not in a known format, e.g. the "total" line.
+//
+// ls prints times in the device's time zone, which isn't known, so they're interpreted as
+// UTC. Times are only accurate to the minute, or to the day for old files listed by busybox.
+// Busybox leaves out the year for recent files, so it's taken to be the most recent year that
+// doesn't put the time in the future.
+func LsLine(line string) (*LsEntry, bool) {
+	return lsLine(line, time.Now())
+}
+
+func lsLine(line string, now time.Time) (*LsEntry, bool) {
+	line = strings.TrimRight(line, "\r")
+
+	// A line whose date doesn't parse in one format, e.g. because the name contains
+	// something that looks like a date, is tried with the rest.
+	var match []string
+	var mtime time.Time
+	for _, format := range lsFormats {
+		m := format.pattern.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		t, err := format.parseTime(m[3], now)
+		if err != nil {
+			continue
+		}
+		match, mtime = m, t
+		break
+	}
+	if match == nil {
+		return nil, false
+	}
+
+	mode := parseLsMode(match[1])
+	name := match[4]
+	if mode&os.ModeSymlink != 0 {
+		if i := strings.Index(name, " -> "); i >= 0 {
+			name = name[:i]
+		}
+	}
+
+	entry := &LsEntry{
+		Name:       name,
+		Mode:       mode,
+		ModifiedAt: mtime,
+	}
+	// The size is the last field before the date, except for devices, which have
+	// "<major>, <minor>" instead.
+	if mode&os.ModeDevice == 0 {
+		owner := strings.Fields(match[2])
+		if len(owner) > 0 {
+			if size, err := strconv.ParseInt(owner[len(owner)-1], 10, 64); err == nil {
+				entry.Size = size
+			}
+		}
+	}
+	return entry, true
+}
+
+func parseISOLsTime(s string, now time.Time) (time.Time, error) {
+	return time.Parse("2006-01-02 15:04", s)
+}
+
+// How far in the future a busybox time without a year can be and still be in the current
+// year. Times are in the device's time zone but compared with now in UTC, so this is more
+// than the largest time zone offset.
+const busyboxLsFutureSlack = 24 * time.Hour
+
+func parseBusyboxLsTime(s string, now time.Time) (time.Time, error) {
+	fields := strings.Fields(s)
+	s = strings.Join(fields, " ")
+	if strings.Contains(fields[2], ":") {
+		// Files modified in the last six months are shown with the time instead of the
+		// year, so a time later than now must be from last year.
+		t, err := time.Parse("Jan 2 15:04", s)
+		if err != nil {
+			return time.Time{}, err
+		}
+		year := now.UTC().Year()
+		if t.AddDate(year, 0, 0).After(now.Add(busyboxLsFutureSlack)) {
+			year--
+		}
+		return t.AddDate(year, 0, 0), nil
+	}
+	return time.Parse("Jan 2 2006", s)
+}
+
+// parseLsMode parses a mode string like "drwxr-x--x".
+func parseLsMode(s string) os.FileMode {
+	var mode os.FileMode
+	switch s[0] {
+	case 'd':
+		mode |= os.ModeDir
+	case 'l':
+		mode |= os.ModeSymlink
+	case 'c':
+		mode |= os.ModeDevice | os.ModeCharDevice
+	case 'b':
+		mode |= os.ModeDevice
+	case 'p':
+		mode |= os.ModeNamedPipe
+	case 's':
+		mode |= os.ModeSocket
+	}
+
+	perms := s[1:]
+	for i, c := range perms {
+		// Each position is one of rwx, from the user's read permission down to other's
+		// execute permission.
+		bit := os.FileMode(1) << uint(8-i)
+		switch c {
+		case 'r', 'w', 'x':
+			mode |= bit
+		case 's', 't':
+			mode |= bit
+			fallthrough
+		case 'S', 'T':
+			mode |= lsSpecialBit(i)
+		}
+	}
+	return mode
+}
+
+// lsSpecialBit returns the setuid, setgid or sticky bit shown in the execute position i of
+// the permissions.
+func lsSpecialBit(i int) os.FileMode {
+	switch i {
+	case 2:
+		return os.ModeSetuid
+	case 5:
+		return os.ModeSetgid
+	case 8:
+		return os.ModeSticky
+	default:
+		return 0
+	}
+}
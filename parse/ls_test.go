@@ -0,0 +1,112 @@
+package parse
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLsLineToolbox(t *testing.T) {
+	entry, ok := LsLine("-rw-r--r-- root     root         1234 2015-01-02 03:04 name with spaces\r")
+	assert.True(t, ok)
+	assert.Equal(t, &LsEntry{
+		Name:       "name with spaces",
+		Mode:       0644,
+		Size:       1234,
+		ModifiedAt: time.Date(2015, 1, 2, 3, 4, 0, 0, time.UTC),
+	}, entry)
+
+	entry, ok = LsLine("drwxrwx--x system   system            2015-01-02 03:04 data")
+	assert.True(t, ok)
+	assert.Equal(t, os.ModeDir|0771, entry.Mode)
+	assert.Equal(t, "data", entry.Name)
+	assert.Equal(t, int64(0), entry.Size)
+}
+
+func TestLsLineToybox(t *testing.T) {
+	entry, ok := LsLine("lrwxrwxrwx 1 root root 11 2021-06-07 08:09 sdcard -> /storage/self/primary")
+	assert.True(t, ok)
+	assert.Equal(t, &LsEntry{
+		Name:       "sdcard",
+		Mode:       os.ModeSymlink | 0777,
+		Size:       11,
+		ModifiedAt: time.Date(2021, 6, 7, 8, 9, 0, 0, time.UTC),
+	}, entry)
+
+	entry, ok = LsLine("crw-rw-rw- 1 root root 1,   3 2021-06-07 08:09 null")
+	assert.True(t, ok)
+	assert.Equal(t, os.ModeDevice|os.ModeCharDevice|0666, entry.Mode)
+	assert.Equal(t, int64(0), entry.Size)
+
+	entry, ok = LsLine("-rwsr-x--T 1 root shell 42 2021-06-07 08:09 su")
+	assert.True(t, ok)
+	assert.Equal(t, os.ModeSetuid|os.ModeSticky|0750, entry.Mode)
+}
+
+func TestLsLineBusybox(t *testing.T) {
+	entry, ok := LsLine("-rw-r--r--    1 root     root          1234 Jan  2  2015 old")
+	assert.True(t, ok)
+	assert.Equal(t, &LsEntry{
+		Name:       "old",
+		Mode:       0644,
+		Size:       1234,
+		ModifiedAt: time.Date(2015, 1, 2, 0, 0, 0, 0, time.UTC),
+	}, entry)
+
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	entry, ok = lsLine("-rw-r--r--    1 root     root          1234 Mar 14 15:09 recent", now)
+	assert.True(t, ok)
+	assert.Equal(t, time.Date(2024, 3, 14, 15, 9, 0, 0, time.UTC), entry.ModifiedAt)
+
+	// Times without a year that would be in the future are from last year.
+	now = time.Date(2024, 1, 1, 0, 30, 0, 0, time.UTC)
+	entry, ok = lsLine("-rw-r--r--    1 root     root          1234 Dec 31 23:59 new-year", now)
+	assert.True(t, ok)
+	assert.Equal(t, time.Date(2023, 12, 31, 23, 59, 0, 0, time.UTC), entry.ModifiedAt)
+	entry, ok = lsLine("-rw-r--r--    1 root     root          1234 Jan  1 09:00 ahead", now)
+	assert.True(t, ok)
+	assert.Equal(t, time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC), entry.ModifiedAt)
+}
+
+func TestLsLineFallsBackToBusybox(t *testing.T) {
+	// The name looks like an ISO date, but isn't a valid one, so the busybox format is used.
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	entry, ok := lsLine("-rw-r--r--    1 root     root             5 Mar 14 15:09 2015-99-99 12:00 x", now)
+	assert.True(t, ok)
+	assert.Equal(t, "2015-99-99 12:00 x", entry.Name)
+	assert.Equal(t, int64(5), entry.Size)
+	assert.Equal(t, time.Date(2024, 3, 14, 15, 9, 0, 0, time.UTC), entry.ModifiedAt)
+}
+
+func TestLsLineInvalid(t *testing.T) {
+	_, ok := LsLine("total 24")
+	assert.False(t, ok)
+	_, ok = LsLine("ls: /data/anr: Permission denied")
+	assert.False(t, ok)
+}
+
+func FuzzLsLine(f *testing.F) {
+	f.Add("-rw-r--r-- root     root         1234 2015-01-02 03:04 name with spaces\r")
+	f.Add("lrwxrwxrwx 1 root root 11 2021-06-07 08:09 sdcard -> /storage/self/primary")
+	f.Add("crw-rw-rw- 1 root root 1,   3 2021-06-07 08:09 null")
+	f.Add("-rw-r--r--    1 root     root          1234 Mar 14 15:09 recent")
+	f.Add("total 24")
+	f.Fuzz(func(t *testing.T, line string) {
+		entry, ok := LsLine(line)
+		if !ok {
+			return
+		}
+		// The type is given by the first character of the mode.
+		switch line[0] {
+		case 'd':
+			assert.True(t, entry.Mode.IsDir())
+		case '-':
+			assert.True(t, entry.Mode.IsRegular())
+		case 'l':
+			assert.Equal(t, os.ModeSymlink, entry.Mode.Type())
+		}
+		assert.Equal(t, os.FileMode(0), entry.Mode.Perm()&^0777)
+	})
+}
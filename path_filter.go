@@ -0,0 +1,132 @@
+package adb
+
+import (
+	"path"
+	"strings"
+
+	"github.com/mqhack/goadb/internal/errors"
+)
+
+// pathPattern is one of DirTransferOptions.Patterns, split into its segments.
+type pathPattern struct {
+	segments []string
+	exclude  bool
+}
+
+// pathFilter decides which paths in a directory tree are transferred, by
+// DirTransferOptions.Patterns. The zero pathFilter includes everything.
+type pathFilter struct {
+	patterns []pathPattern
+	// Whether any pattern includes paths, so paths that match no pattern are excluded.
+	restricts bool
+}
+
+func newPathFilter(patterns []string) (pathFilter, error) {
+	var filter pathFilter
+	for _, pattern := range patterns {
+		p := pathPattern{}
+		if strings.HasPrefix(pattern, "!") {
+			pattern, p.exclude = pattern[1:], true
+		}
+		pattern = strings.Trim(pattern, "/")
+		if pattern == "" {
+			return pathFilter{}, errors.Errorf(errors.AssertionError, "empty pattern in %q", patterns)
+		}
+		p.segments = strings.Split(pattern, "/")
+		for _, segment := range p.segments {
+			if _, err := path.Match(segment, ""); err != nil {
+				return pathFilter{}, errors.WrapErrorf(err, errors.AssertionError, "invalid pattern %q", pattern)
+			}
+		}
+		filter.patterns = append(filter.patterns, p)
+		filter.restricts = filter.restricts || !p.exclude
+	}
+	return filter, nil
+}
+
+// includes returns whether the file or symlink at rel, relative to the directory with
+// slashes, is transferred.
+func (f pathFilter) includes(rel string) bool {
+	included := !f.restricts
+	segments := strings.Split(rel, "/")
+	for _, p := range f.patterns {
+		if matchSegments(p.segments, segments) {
+			included = !p.exclude
+		}
+	}
+	return included
+}
+
+// excludesDir returns whether the directory at rel is left out entirely, because the last
+// pattern that matches it, or everything under it, excludes it.
+func (f pathFilter) excludesDir(rel string) bool {
+	excluded := false
+	segments := strings.Split(rel, "/")
+	for _, p := range f.patterns {
+		n := len(p.segments)
+		if matchSegments(p.segments, segments) || n > 1 && p.segments[n-1] == "**" && matchSegments(p.segments[:n-1], segments) {
+			excluded = p.exclude
+		}
+	}
+	return excluded
+}
+
+// matchSegments returns whether the path segments match the pattern segments, where "**"
+// matches any number of segments, and any other pattern segment matches one segment like
+// path.Match.
+func matchSegments(pattern, segments []string) bool {
+	if len(pattern) == 0 {
+		return len(segments) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(segments); i++ {
+			if matchSegments(pattern[1:], segments[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(segments) == 0 {
+		return false
+	}
+	if ok, _ := path.Match(pattern[0], segments[0]); !ok {
+		return false
+	}
+	return matchSegments(pattern[1:], segments[1:])
+}
+
+// parentDirs returns the ancestors of the paths, relative to the directory with slashes,
+// without "." and in no particular order.
+func parentDirs(paths []string) map[string]bool {
+	dirs := make(map[string]bool)
+	for _, p := range paths {
+		for dir := path.Dir(p); dir != "." && !dirs[dir]; dir = path.Dir(dir) {
+			dirs[dir] = true
+		}
+	}
+	return dirs
+}
+
+// dirsToCreate returns the walked directories that are created at the destination: all of
+// them, or if the filter restricts what's transferred, those that hold transferred files or
+// symlinks.
+func (f pathFilter) dirsToCreate(dirs []string, files []dirTransferFile, links []dirTransferLink) []string {
+	if !f.restricts {
+		return dirs
+	}
+	paths := make([]string, 0, len(files)+len(links))
+	for _, file := range files {
+		paths = append(paths, file.path)
+	}
+	for _, link := range links {
+		paths = append(paths, link.path)
+	}
+	needed := parentDirs(paths)
+	var kept []string
+	for _, dir := range dirs {
+		if needed[dir] {
+			kept = append(kept, dir)
+		}
+	}
+	return kept
+}
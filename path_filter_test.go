@@ -0,0 +1,82 @@
+package adb
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mqhack/goadb/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPathFilterIncludes(t *testing.T) {
+	filter, err := newPathFilter([]string{"**/*.so", "!**/obj/**", "logs/*.txt"})
+	require.NoError(t, err)
+	assert.True(t, filter.includes("libfoo.so"))
+	assert.True(t, filter.includes("lib/arm64/libfoo.so"))
+	assert.False(t, filter.includes("obj/libfoo.so"))
+	assert.False(t, filter.includes("build/obj/x/libfoo.so"))
+	assert.True(t, filter.includes("logs/a.txt"))
+	assert.False(t, filter.includes("logs/old/a.txt"))
+	assert.False(t, filter.includes("README"))
+
+	assert.True(t, filter.excludesDir("obj"))
+	assert.True(t, filter.excludesDir("build/obj"))
+	assert.False(t, filter.excludesDir("build"))
+	assert.False(t, filter.excludesDir("logs"))
+}
+
+func TestPathFilterOnlyExcludes(t *testing.T) {
+	filter, err := newPathFilter([]string{"!*.tmp", "!cache"})
+	require.NoError(t, err)
+	assert.False(t, filter.restricts)
+	assert.True(t, filter.includes("a.txt"))
+	assert.True(t, filter.includes("sub/b.tmp"))
+	assert.False(t, filter.includes("b.tmp"))
+	assert.True(t, filter.excludesDir("cache"))
+	assert.False(t, filter.excludesDir("sub/cache"))
+}
+
+func TestPathFilterEmpty(t *testing.T) {
+	filter, err := newPathFilter(nil)
+	require.NoError(t, err)
+	assert.True(t, filter.includes("a/b/c"))
+	assert.False(t, filter.excludesDir("a"))
+	assert.Equal(t, []string{"a", "a/b"}, filter.dirsToCreate([]string{"a", "a/b"}, nil, nil))
+}
+
+func TestPathFilterInvalid(t *testing.T) {
+	_, err := newPathFilter([]string{"logs/[a"})
+	assert.True(t, HasErrCode(err, AssertionError))
+	_, err = newPathFilter([]string{"!"})
+	assert.True(t, HasErrCode(err, AssertionError))
+}
+
+func TestPathFilterDirsToCreate(t *testing.T) {
+	filter, err := newPathFilter([]string{"**/*.log"})
+	require.NoError(t, err)
+	dirs := filter.dirsToCreate([]string{"a", "a/b", "a/b/c", "d"},
+		[]dirTransferFile{{path: "a/b/x.log"}}, []dirTransferLink{{path: "d/y.log"}})
+	assert.Equal(t, []string{"a", "a/b", "d"}, dirs)
+}
+
+func TestPushDirPatterns(t *testing.T) {
+	localDir := t.TempDir()
+	for _, name := range []string{"lib/libfoo.so", "lib/notes.txt", "obj/libfoo.so", "docs/README"} {
+		localPath := filepath.Join(localDir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(localPath), 0755))
+		require.NoError(t, ioutil.WriteFile(localPath, []byte("data"), 0644))
+	}
+	s := &MockServer{Status: wire.StatusSuccess, Messages: []string{""}}
+
+	result, err := v1SyncDevice(s).PushDir(context.Background(), localDir, "/sdcard/x",
+		DirTransferOptions{Patterns: []string{"**/*.so", "!obj/**"}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"lib/libfoo.so"}, result.Succeeded)
+	assert.Equal(t, "shell:mkdir -p '/sdcard/x' '/sdcard/x/lib'", s.Requests[1])
+	assert.False(t, strings.Contains(string(s.Written), "obj"))
+}
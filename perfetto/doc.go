@@ -0,0 +1,14 @@
+/*
+Package perfetto records system traces on Android devices with perfetto.
+
+	var trace bytes.Buffer
+	err := perfetto.CaptureTrace(ctx, device, config, &trace)
+
+*adb.Device has the same as a method, device.CapturePerfettoTrace(ctx, config, &trace).
+
+The config is a binary-encoded perfetto.protos.TraceConfig. Tracing stops when the duration
+set in the config elapses, or when ctx is done, whichever comes first; either way the trace
+recorded so far is written out. Requires a device running Android P or later, with the
+traced service enabled (it's enabled by default from Android Q).
+*/
+package perfetto
@@ -0,0 +1,146 @@
+package perfetto
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mqhack/goadb/internal/errors"
+	"github.com/mqhack/goadb/internal/random"
+	"github.com/mqhack/goadb/wire"
+)
+
+// Directories the config and trace are staged in on the device. perfetto can only write
+// traces to TraceDir on user builds.
+const (
+	ConfigDir = "/data/local/tmp"
+	TraceDir  = "/data/misc/perfetto-traces"
+)
+
+// Device is the part of *adb.Device that CaptureTrace needs.
+type Device interface {
+	OpenShell(cmd string, args ...string) (*wire.ShellConn, error)
+	OpenRead(path string) (io.ReadCloser, error)
+	OpenWrite(path string, perms os.FileMode, mtime time.Time) (io.WriteCloser, error)
+	RunCommand(cmd string, args ...string) (string, error)
+}
+
+/*
+CaptureTrace records a trace on device using config, a binary-encoded TraceConfig, and
+writes it to out. The config and trace files are deleted from the device afterwards.
+
+If ctx is done before the trace duration in the config elapses, perfetto is asked to stop
+tracing early, and the shorter trace is written to out without an error. This makes it
+possible to trace for an open-ended duration.
+*/
+func CaptureTrace(ctx context.Context, device Device, config []byte, out io.Writer) error {
+	id := random.ID()
+	configPath := ConfigDir + "/goadb-perfetto-" + id + ".pb"
+	tracePath := TraceDir + "/goadb-" + id + ".pftrace"
+	defer device.RunCommand("rm", "-f", configPath, tracePath)
+
+	if err := pushConfig(device, configPath, config); err != nil {
+		return err
+	}
+	if err := record(ctx, device, configPath, tracePath); err != nil {
+		return err
+	}
+	return pullTrace(device, tracePath, out)
+}
+
+func pushConfig(device Device, path string, config []byte) error {
+	w, err := device.OpenWrite(path, wire.DefaultFilePerms, time.Time{})
+	if err != nil {
+		return errors.WrapAnyErrf(err, errors.NetworkError, "error pushing perfetto config")
+	}
+	if _, err := w.Write(config); err != nil {
+		w.Close()
+		return errors.WrapAnyErrf(err, errors.NetworkError, "error pushing perfetto config")
+	}
+	return errors.WrapAnyErrf(w.Close(), errors.NetworkError, "error pushing perfetto config")
+}
+
+// record runs perfetto until it exits. If ctx is done first, perfetto is sent SIGTERM,
+// which makes it stop tracing and write the trace.
+func record(ctx context.Context, device Device, configPath, tracePath string) error {
+	// The config is redirected by the shell, because perfetto isn't allowed to open files in
+	// ConfigDir itself. exec keeps the shell's PID, so it can be signalled.
+	conn, err := device.OpenShell("echo $$; exec perfetto -c - -o " + tracePath + " < " + configPath)
+	if err != nil {
+		return errors.WrapAnyErrf(err, errors.NetworkError, "error starting perfetto")
+	}
+	defer conn.Close()
+
+	exited := make(chan struct{})
+	defer close(exited)
+
+	var stdout, stderr bytes.Buffer
+	watching := false
+	for {
+		id, data, err := conn.ReadPacket()
+		if err != nil {
+			return errors.WrapAnyErrf(err, errors.NetworkError, "error reading perfetto output")
+		}
+
+		switch id {
+		case wire.ShellIDStdout:
+			stdout.Write(data)
+			if line, ok := firstLine(stdout.String()); ok && !watching {
+				watching = true
+				go stopOnDone(ctx, device, line, exited)
+			}
+		case wire.ShellIDStderr:
+			stderr.Write(data)
+		case wire.ShellIDExit:
+			if len(data) != 1 {
+				return errors.Errorf(errors.ParseError, "expected 1 byte exit code, got %d bytes", len(data))
+			}
+			if code := int(data[0]); code != 0 {
+				return errors.Errorf(errors.AdbError, "perfetto exited with status %d: %s", code, lastLine(stderr.String()))
+			}
+			return nil
+		}
+	}
+}
+
+// stopOnDone sends SIGTERM to pid if ctx is done before exited is closed.
+func stopOnDone(ctx context.Context, device Device, pid string, exited <-chan struct{}) {
+	select {
+	case <-ctx.Done():
+		device.RunCommand("kill", "-TERM", pid)
+	case <-exited:
+	}
+}
+
+func pullTrace(device Device, path string, out io.Writer) error {
+	r, err := device.OpenRead(path)
+	if err != nil {
+		return errors.WrapAnyErrf(err, errors.NetworkError, "error pulling trace %s", path)
+	}
+	defer r.Close()
+
+	if _, err := io.Copy(out, r); err != nil {
+		if _, ok := err.(*errors.Err); !ok {
+			return errors.WrapErrorf(err, errors.AssertionError, "error writing trace %s", path)
+		}
+		return errors.WrapErrf(err, "error pulling trace %s", path)
+	}
+	return nil
+}
+
+func firstLine(s string) (string, bool) {
+	i := strings.IndexByte(s, '\n')
+	if i < 0 {
+		return "", false
+	}
+	return strings.TrimSpace(s[:i]), true
+}
+
+// lastLine returns the last non-empty line of perfetto's log, which explains why it failed.
+func lastLine(s string) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
@@ -0,0 +1,162 @@
+package perfetto
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mqhack/goadb/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type MockDevice struct {
+	mu sync.Mutex
+
+	// Shell output, as shell protocol packets.
+	Output io.Reader
+	Trace  string
+
+	Files    map[string][]byte
+	WriteErr error
+	ShellCmd string
+	Commands []string
+	ReadPath string
+}
+
+type fileWriter struct {
+	bytes.Buffer
+	d    *MockDevice
+	path string
+}
+
+func (w *fileWriter) Close() error {
+	w.d.Files[w.path] = w.Bytes()
+	return nil
+}
+
+func (d *MockDevice) OpenShell(cmd string, args ...string) (*wire.ShellConn, error) {
+	d.ShellCmd = cmd
+	return &wire.ShellConn{
+		ShellScanner: wire.NewShellScanner(d.Output),
+		ShellSender:  wire.NewShellSender(ioutil.Discard),
+	}, nil
+}
+
+func (d *MockDevice) OpenRead(path string) (io.ReadCloser, error) {
+	d.ReadPath = path
+	return ioutil.NopCloser(strings.NewReader(d.Trace)), nil
+}
+
+func (d *MockDevice) OpenWrite(path string, perms os.FileMode, mtime time.Time) (io.WriteCloser, error) {
+	if d.WriteErr != nil {
+		return nil, d.WriteErr
+	}
+	return &fileWriter{d: d, path: path}, nil
+}
+
+func (d *MockDevice) RunCommand(cmd string, args ...string) (string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.Commands = append(d.Commands, strings.Join(append([]string{cmd}, args...), " "))
+	return "", nil
+}
+
+func (d *MockDevice) commands() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]string(nil), d.Commands...)
+}
+
+func packet(id byte, data string) string {
+	header := make([]byte, 5)
+	header[0] = id
+	binary.LittleEndian.PutUint32(header[1:], uint32(len(data)))
+	return string(header) + data
+}
+
+func TestCaptureTrace(t *testing.T) {
+	dev := &MockDevice{
+		Output: strings.NewReader(packet(wire.ShellIDStdout, "4321\n") +
+			packet(wire.ShellIDStderr, "Connected to the Perfetto traced service\n") +
+			packet(wire.ShellIDExit, "\x00")),
+		Trace: "trace data",
+		Files: make(map[string][]byte),
+	}
+
+	var out bytes.Buffer
+	require.NoError(t, CaptureTrace(context.Background(), dev, []byte("config"), &out))
+	assert.Equal(t, "trace data", out.String())
+
+	require.Len(t, dev.Files, 1)
+	var configPath string
+	for path, data := range dev.Files {
+		configPath = path
+		assert.Equal(t, "config", string(data))
+	}
+	assert.True(t, strings.HasPrefix(configPath, ConfigDir+"/"), configPath)
+	assert.True(t, strings.HasPrefix(dev.ReadPath, TraceDir+"/"), dev.ReadPath)
+	assert.Equal(t, "echo $$; exec perfetto -c - -o "+dev.ReadPath+" < "+configPath, dev.ShellCmd)
+	assert.Equal(t, []string{"rm -f " + configPath + " " + dev.ReadPath}, dev.commands())
+}
+
+func TestCaptureTraceFailure(t *testing.T) {
+	dev := &MockDevice{
+		Output: strings.NewReader(packet(wire.ShellIDStdout, "4321\n") +
+			packet(wire.ShellIDStderr, "perfetto_cmd.cc:123 Could not connect to the traced socket\n") +
+			packet(wire.ShellIDExit, "\x01")),
+		Files: make(map[string][]byte),
+	}
+
+	err := CaptureTrace(context.Background(), dev, []byte("config"), ioutil.Discard)
+	assert.EqualError(t, err, "AdbError: perfetto exited with status 1: perfetto_cmd.cc:123 Could not connect to the traced socket")
+	assert.Empty(t, dev.ReadPath)
+	assert.Len(t, dev.commands(), 1)
+}
+
+func TestCaptureTraceDeviceError(t *testing.T) {
+	// Device errors that aren't *errors.Err are wrapped rather than making CaptureTrace panic.
+	dev := &MockDevice{WriteErr: io.ErrClosedPipe}
+	err := CaptureTrace(context.Background(), dev, []byte("config"), ioutil.Discard)
+	assert.EqualError(t, err, "NetworkError: error pushing perfetto config")
+}
+
+func TestCaptureTraceStopsOnDone(t *testing.T) {
+	output, outputWriter := io.Pipe()
+	dev := &MockDevice{
+		Output: output,
+		Trace:  "short trace",
+		Files:  make(map[string][]byte),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+
+	go func() {
+		io.WriteString(outputWriter, packet(wire.ShellIDStdout, "4321\n"))
+		cancel()
+		// perfetto exits cleanly once it's signalled.
+		for !containsCommand(dev.commands(), "kill -TERM 4321") {
+			time.Sleep(time.Millisecond)
+		}
+		io.WriteString(outputWriter, packet(wire.ShellIDExit, "\x00"))
+	}()
+
+	var out bytes.Buffer
+	require.NoError(t, CaptureTrace(ctx, dev, []byte("config"), &out))
+	assert.Equal(t, "short trace", out.String())
+}
+
+func containsCommand(commands []string, cmd string) bool {
+	for _, c := range commands {
+		if c == cmd {
+			return true
+		}
+	}
+	return false
+}
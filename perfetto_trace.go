@@ -0,0 +1,20 @@
+package adb
+
+import (
+	"context"
+	"io"
+
+	"github.com/mqhack/goadb/perfetto"
+)
+
+/*
+CapturePerfettoTrace records a trace using config, a binary-encoded perfetto TraceConfig,
+and writes it to out. See perfetto.CaptureTrace for how ctx stops tracing early.
+
+Corresponds to the command:
+
+	adb shell perfetto -c - -o <trace> < <config>
+*/
+func (c *Device) CapturePerfettoTrace(ctx context.Context, config []byte, out io.Writer) error {
+	return wrapClientError(perfetto.CaptureTrace(ctx, c, config, out), c, "CapturePerfettoTrace")
+}
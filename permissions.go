@@ -0,0 +1,183 @@
+package adb
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mqhack/goadb/internal/errors"
+)
+
+// The app ops that control special permissions, which pm grant can't grant because they're
+// granted by the user in Settings instead of by a dialog.
+var specialPermissionOps = map[string]string{
+	"android.permission.MANAGE_EXTERNAL_STORAGE":  "MANAGE_EXTERNAL_STORAGE",
+	"android.permission.SYSTEM_ALERT_WINDOW":      "SYSTEM_ALERT_WINDOW",
+	"android.permission.WRITE_SETTINGS":           "WRITE_SETTINGS",
+	"android.permission.PACKAGE_USAGE_STATS":      "GET_USAGE_STATS",
+	"android.permission.REQUEST_INSTALL_PACKAGES": "REQUEST_INSTALL_PACKAGES",
+	"android.permission.SCHEDULE_EXACT_ALARM":     "SCHEDULE_EXACT_ALARM",
+	"android.permission.MANAGE_MEDIA":             "MANAGE_MEDIA",
+	"android.permission.ACCESS_NOTIFICATIONS":     "ACCESS_NOTIFICATIONS",
+}
+
+/*
+GrantPermission grants the permission perm, e.g. "android.permission.CAMERA", to the package
+pkg. Special permissions the user grants in Settings, like
+android.permission.MANAGE_EXTERNAL_STORAGE, are granted by allowing their app op instead.
+The error has code FileNoExistError if pkg isn't installed.
+
+Corresponds to the commands:
+
+	adb shell pm grant <pkg> <perm>
+	adb shell appops set <pkg> <op> allow
+*/
+func (c *Device) GrantPermission(pkg, perm string) error {
+	return wrapClientError(c.setPermission(pkg, perm, true), c, "GrantPermission(%s, %s)", pkg, perm)
+}
+
+/*
+RevokePermission revokes the permission perm from the package pkg, like GrantPermission
+grants it. Special permissions are revoked by denying their app op.
+
+Corresponds to the commands:
+
+	adb shell pm revoke <pkg> <perm>
+	adb shell appops set <pkg> <op> deny
+*/
+func (c *Device) RevokePermission(pkg, perm string) error {
+	return wrapClientError(c.setPermission(pkg, perm, false), c, "RevokePermission(%s, %s)", pkg, perm)
+}
+
+func (c *Device) setPermission(pkg, perm string, grant bool) error {
+	if op, ok := specialPermissionOps[perm]; ok {
+		mode := "deny"
+		if grant {
+			mode = "allow"
+		}
+		_, err := c.runPackageCommand("appops set " + shellQuote(pkg) + " " + op + " " + mode)
+		return err
+	}
+	verb := "revoke"
+	if grant {
+		verb = "grant"
+	}
+	_, err := c.runPackageCommand("pm " + verb + " " + shellQuote(pkg) + " " + shellQuote(perm))
+	return err
+}
+
+/*
+GetGrantedPermissions returns the permissions the package pkg has been granted, sorted: its
+install-time permissions, runtime permissions granted for any user, and special permissions
+whose app op is allowed. The error has code FileNoExistError if pkg isn't installed.
+*/
+func (c *Device) GetGrantedPermissions(pkg string) ([]string, error) {
+	perms, err := c.getGrantedPermissions(pkg)
+	return perms, wrapClientError(err, c, "GetGrantedPermissions(%s)", pkg)
+}
+
+func (c *Device) getGrantedPermissions(pkg string) ([]string, error) {
+	output, err := c.RunCommand("dumpsys", "package", pkg)
+	if err != nil {
+		return nil, err
+	}
+	// Only the permissions are used, so the time zone doesn't matter.
+	info, err := parsePackageInfo(pkg, output, time.UTC)
+	if err != nil {
+		return nil, err
+	}
+	var special []string
+	for _, perm := range info.RequestedPermissions {
+		if _, ok := specialPermissionOps[perm]; ok {
+			special = append(special, perm)
+		}
+	}
+	if len(special) == 0 {
+		return info.GrantedPermissions, nil
+	}
+
+	output, err = c.runPackageCommand("appops get " + shellQuote(pkg))
+	if err != nil {
+		return nil, err
+	}
+	modes := parseAppOps(output)
+	granted := info.GrantedPermissions
+	for _, perm := range special {
+		if modes[specialPermissionOps[perm]] == "allow" {
+			granted = append(granted, perm)
+		}
+	}
+	return sortedUnique(granted), nil
+}
+
+// parseAppOps returns the mode of each app op listed by appops get, e.g.
+//
+//	MANAGE_EXTERNAL_STORAGE: allow; time=+2d3h ago
+//	SYSTEM_ALERT_WINDOW: deny
+//	Uid mode: WRITE_SETTINGS: allow
+func parseAppOps(output string) map[string]string {
+	modes := make(map[string]string)
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		uidMode := strings.HasPrefix(line, "Uid mode: ")
+		op, rest, ok := strings.Cut(strings.TrimPrefix(line, "Uid mode: "), ":")
+		if !ok {
+			continue
+		}
+		mode, _, _ := strings.Cut(strings.TrimSpace(rest), ";")
+		// The package's own mode overrides its UID's.
+		if _, ok := modes[op]; !ok || !uidMode {
+			modes[op] = strings.TrimSpace(mode)
+		}
+	}
+	return modes
+}
+
+/*
+runPackageCommand runs cmd, a pm, am or appops command line, with its stderr merged into its
+output, and returns the output. The error has code FileNoExistError if the package or
+component it names doesn't exist, PermissionDenied if the shell isn't allowed to run it, and
+AdbError for other failures it prints.
+*/
+func (c *Device) runPackageCommand(cmd string) (string, error) {
+	output, err := c.RunCommand(cmd + " 2>&1")
+	if err != nil {
+		return "", err
+	}
+	trimmed := strings.TrimSpace(output)
+	for _, failure := range []string{"Exception", "Error:", "Failure", "Unknown package"} {
+		if strings.Contains(trimmed, failure) {
+			return "", errors.Errorf(packageCommandErrorCode(trimmed), "%s", trimmed)
+		}
+	}
+	return output, nil
+}
+
+// packageCommandErrorCode returns the code of the failure printed by a pm, am or appops
+// command.
+func packageCommandErrorCode(output string) errors.ErrCode {
+	lower := strings.ToLower(output)
+	switch {
+	case strings.Contains(lower, "unknown package"), strings.Contains(lower, "package not found"),
+		strings.Contains(lower, "namenotfoundexception"), strings.Contains(lower, "does not exist"),
+		strings.Contains(lower, "unable to resolve"), strings.Contains(lower, "no service started"):
+		return errors.FileNoExistError
+	case strings.Contains(lower, "securityexception"), strings.Contains(lower, "permission denial"),
+		strings.Contains(lower, "cannot disable"):
+		return errors.PermissionDenied
+	default:
+		return errors.AdbError
+	}
+}
+
+// sortedUnique sorts strs and removes duplicates.
+func sortedUnique(strs []string) []string {
+	sort.Strings(strs)
+	unique := strs[:0]
+	for _, s := range strs {
+		if len(unique) == 0 || s != unique[len(unique)-1] {
+			unique = append(unique, s)
+		}
+	}
+	return unique
+}
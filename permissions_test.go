@@ -0,0 +1,58 @@
+package adb
+
+import (
+	"testing"
+
+	"github.com/mqhack/goadb/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGrantPermission(t *testing.T) {
+	s := &MockServer{Status: wire.StatusSuccess, Messages: []string{""}}
+	require.NoError(t, (&Adb{server: s}).Device(AnyDevice()).GrantPermission("com.example", "android.permission.CAMERA"))
+	assert.Equal(t, "shell:pm grant 'com.example' 'android.permission.CAMERA' 2>&1", s.Requests[1])
+
+	s = &MockServer{Status: wire.StatusSuccess, Messages: []string{""}}
+	require.NoError(t, (&Adb{server: s}).Device(AnyDevice()).RevokePermission("com.example",
+		"android.permission.MANAGE_EXTERNAL_STORAGE"))
+	assert.Equal(t, "shell:appops set 'com.example' MANAGE_EXTERNAL_STORAGE deny 2>&1", s.Requests[1])
+}
+
+func TestGrantPermissionErrors(t *testing.T) {
+	for output, code := range map[string]ErrCode{
+		"Exception occurred while executing 'grant':\njava.lang.IllegalArgumentException: Unknown package: com.example\n": FileNoExistError,
+		"Exception occurred while executing 'grant':\njava.lang.SecurityException: Permission android.permission.BLUETOOTH " +
+			"requested by com.example is not a changeable permission type\n": PermissionDenied,
+		"Exception occurred while executing 'grant':\njava.lang.IllegalArgumentException: Unknown permission: x\n": AdbError,
+	} {
+		s := &MockServer{Status: wire.StatusSuccess, Messages: []string{output}}
+		err := (&Adb{server: s}).Device(AnyDevice()).GrantPermission("com.example", "x")
+		assert.True(t, HasErrCode(err, code), "%q: %v", output, err)
+	}
+}
+
+func TestParseAppOps(t *testing.T) {
+	assert.Equal(t, map[string]string{
+		"MANAGE_EXTERNAL_STORAGE": "allow",
+		"SYSTEM_ALERT_WINDOW":     "deny",
+		"WRITE_SETTINGS":          "ignore",
+	}, parseAppOps("Uid mode: WRITE_SETTINGS: allow\n"+
+		"Uid mode: SYSTEM_ALERT_WINDOW: deny\n"+
+		"MANAGE_EXTERNAL_STORAGE: allow; time=+2d3h ago\r\n"+
+		"WRITE_SETTINGS: ignore\n"))
+}
+
+func TestGetGrantedPermissions(t *testing.T) {
+	s := &MockServer{Status: wire.StatusSuccess, Messages: []string{"Packages:\n" +
+		"  Package [com.example] (c0ffee):\n" +
+		"    requested permissions:\n" +
+		"      android.permission.INTERNET\n" +
+		"      android.permission.CAMERA\n" +
+		"    install permissions:\n" +
+		"      android.permission.INTERNET: granted=true\n"}}
+	perms, err := (&Adb{server: s}).Device(AnyDevice()).GetGrantedPermissions("com.example")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"android.permission.INTERNET"}, perms)
+	assert.Equal(t, "shell:dumpsys package com.example", s.Requests[1])
+}
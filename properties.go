@@ -0,0 +1,245 @@
+package adb
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/mqhack/goadb/internal/errors"
+	"github.com/mqhack/goadb/parse"
+	"github.com/mqhack/goadb/wire"
+)
+
+// getProps returns all the system properties on the device.
+func (c *Device) getProps() (map[string]string, error) {
+	output, err := c.RunCommand("getprop")
+	if err != nil {
+		return nil, err
+	}
+	return parse.Getprop(output), nil
+}
+
+// How often properties are polled on devices that don't have watchprops.
+const propertyPollInterval = time.Second
+
+// Matches a line of watchprops output, e.g. "1451703845 sys.boot_completed = '1'".
+var watchpropsLinePattern = regexp.MustCompile(`^\s*\d+ (\S+) = '(.*)'$`)
+
+// PropertyChange is a new value of a system property.
+type PropertyChange struct {
+	Key   string
+	Value string
+}
+
+/*
+PropertyWatcher delivers changes to system properties on a device.
+*/
+type PropertyWatcher struct {
+	changes chan PropertyChange
+
+	// If an error occurs, it is stored here and changes is closed immediately after.
+	err atomic.Value
+}
+
+// C returns a channel that can be received on to get property changes.
+// The channel is closed when the context passed to WatchProperties is done, or an error
+// occurs.
+func (w *PropertyWatcher) C() <-chan PropertyChange {
+	return w.changes
+}
+
+// Err returns the error that caused the channel returned by C to be closed, if C is closed.
+// It's nil if the context was done.
+// If C is not closed, its return value is undefined.
+func (w *PropertyWatcher) Err() error {
+	if err, ok := w.err.Load().(error); ok {
+		return err
+	}
+	return nil
+}
+
+/*
+WatchProperties reports each system property that's set or changed, until ctx is done.
+The values properties have when watching starts aren't reported.
+
+Devices that have watchprops (Android N and earlier) report changes as they happen. On
+other devices, all the properties are polled every second and compared with the previous
+values, so changes that are reverted between polls are missed.
+*/
+func (c *Device) WatchProperties(ctx context.Context) (*PropertyWatcher, error) {
+	conn, err := c.openShell("watchprops")
+	if err != nil {
+		return nil, wrapClientError(err, c, "WatchProperties")
+	}
+
+	watcher := &PropertyWatcher{changes: make(chan PropertyChange)}
+	go func() {
+		defer close(watcher.changes)
+		if err := c.watchProperties(ctx, conn, watcher.changes); err != nil && ctx.Err() == nil {
+			watcher.err.Store(wrapClientError(err, c, "WatchProperties"))
+		}
+	}()
+	return watcher, nil
+}
+
+// watchProperties sends the changes reported by watchprops, running on conn, to changes.
+// If watchprops isn't available, it polls instead.
+func (c *Device) watchProperties(ctx context.Context, conn *wire.ShellConn, changes chan<- PropertyChange) error {
+	stop := closeWhenDone(ctx, conn)
+	defer stop()
+	defer conn.Close()
+
+	// watchprops doesn't print anything until a property changes, so if it exits before
+	// printing anything, it isn't available.
+	stdout := newShellStdoutReader(conn)
+	if err := stdout.fill(); err != nil {
+		return err
+	}
+	if stdout.exited {
+		props, err := c.getProps()
+		if err != nil {
+			return err
+		}
+		return c.pollProperties(ctx, props, changes)
+	}
+
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		match := watchpropsLinePattern.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		select {
+		case changes <- PropertyChange{Key: match[1], Value: match[2]}:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return errors.WrapErrorf(err, errors.NetworkError, "error reading property changes")
+	}
+	return errors.Errorf(errors.AdbError, "watchprops exited with status %d: %s", stdout.exitCode, strings.TrimSpace(stdout.stderr.String()))
+}
+
+// Matches a valid system property name.
+var propertyNamePattern = regexp.MustCompile(`^[A-Za-z0-9_.\-:@]+$`)
+
+/*
+WatchProp reports the value of the system property key when watching starts, and then each
+time it changes, until ctx is done. It's useful for waiting for properties like
+sys.boot_completed without checking them in a loop.
+
+The property is watched by a single shell on the device, which uses watchprops if it's
+available (Android N and earlier), and otherwise checks the property every second. Unlike
+WatchProperties, this doesn't fetch all the properties on each check.
+*/
+func (c *Device) WatchProp(ctx context.Context, key string) (*PropertyWatcher, error) {
+	if !propertyNamePattern.MatchString(key) {
+		return nil, wrapClientError(errors.AssertionErrorf("invalid property name: %q", key), c, "WatchProp")
+	}
+	conn, err := c.openShell(watchPropScript(key))
+	if err != nil {
+		return nil, wrapClientError(err, c, "WatchProp")
+	}
+
+	watcher := &PropertyWatcher{changes: make(chan PropertyChange)}
+	go func() {
+		defer close(watcher.changes)
+		if err := watchProp(ctx, conn, key, watcher.changes); err != nil && ctx.Err() == nil {
+			watcher.err.Store(wrapClientError(err, c, "WatchProp"))
+		}
+	}()
+	return watcher, nil
+}
+
+// watchPropScript returns a shell script that prints key's current value, then runs
+// watchprops, or if it's not available, prints key's value each time it changes. Values are
+// printed in the same format as watchprops, so the output can be parsed the same way.
+func watchPropScript(key string) string {
+	return fmt.Sprintf(`echo "0 %[1]s = '$(getprop %[1]s)'"; watchprops 2>/dev/null || { `+
+		`p=$(getprop %[1]s); while sleep %[2]d; do v=$(getprop %[1]s); `+
+		`if [ "$v" != "$p" ]; then echo "0 %[1]s = '$v'"; p=$v; fi; done; }`,
+		key, int(propertyPollInterval/time.Second))
+}
+
+// watchProp sends the values of key printed by watchPropScript, running on conn, to
+// changes. watchprops reports every property that's set, so other properties, and values
+// that are the same as the previous one, are skipped.
+func watchProp(ctx context.Context, conn *wire.ShellConn, key string, changes chan<- PropertyChange) error {
+	stop := closeWhenDone(ctx, conn)
+	defer stop()
+	defer conn.Close()
+
+	stdout := newShellStdoutReader(conn)
+	scanner := bufio.NewScanner(stdout)
+	var last *string
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		match := watchpropsLinePattern.FindStringSubmatch(line)
+		if match == nil || match[1] != key || (last != nil && *last == match[2]) {
+			continue
+		}
+		value := match[2]
+		last = &value
+		select {
+		case changes <- PropertyChange{Key: key, Value: value}:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return errors.WrapErrorf(err, errors.NetworkError, "error reading %s", key)
+	}
+	return errors.Errorf(errors.AdbError, "property watch exited with status %d: %s", stdout.exitCode, strings.TrimSpace(stdout.stderr.String()))
+}
+
+// pollProperties sends the properties that differ from the previous poll to changes,
+// starting from props, until ctx is done.
+func (c *Device) pollProperties(ctx context.Context, props map[string]string, changes chan<- PropertyChange) error {
+	ticker := time.NewTicker(propertyPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return nil
+		}
+
+		current, err := c.getProps()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		for _, change := range diffProperties(props, current) {
+			select {
+			case changes <- change:
+			case <-ctx.Done():
+				return nil
+			}
+		}
+		props = current
+	}
+}
+
+// diffProperties returns the properties in current that are new or different to previous,
+// sorted by key.
+func diffProperties(previous, current map[string]string) []PropertyChange {
+	var changes []PropertyChange
+	for key, value := range current {
+		if old, ok := previous[key]; !ok || old != value {
+			changes = append(changes, PropertyChange{Key: key, Value: value})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Key < changes[j].Key
+	})
+	return changes
+}
@@ -0,0 +1,118 @@
+package adb
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/mqhack/goadb/wire"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffProperties(t *testing.T) {
+	previous := map[string]string{
+		"sys.boot_completed": "",
+		"ro.build.type":      "user",
+	}
+	current := map[string]string{
+		"sys.boot_completed": "1",
+		"ro.build.type":      "user",
+		"dev.bootcomplete":   "1",
+	}
+	assert.Equal(t, []PropertyChange{
+		{"dev.bootcomplete", "1"},
+		{"sys.boot_completed", "1"},
+	}, diffProperties(previous, current))
+	assert.Empty(t, diffProperties(current, current))
+}
+
+func TestWatchPropertiesWatchprops(t *testing.T) {
+	s := &MockServer{
+		Status: wire.StatusSuccess,
+		Messages: []string{
+			shellPacket(wire.ShellIDStdout, "1451703845 sys.boot_completed = '1'\n1451703846 init.svc.bootanim = 'stopped'\n"),
+			shellPacket(wire.ShellIDExit, "\x00"),
+		},
+	}
+	device := (&Adb{server: s}).Device(AnyDevice())
+
+	watcher, err := device.WatchProperties(context.Background())
+	assert.NoError(t, err)
+	var changes []PropertyChange
+	for change := range watcher.C() {
+		changes = append(changes, change)
+	}
+	assert.Equal(t, []PropertyChange{
+		{"sys.boot_completed", "1"},
+		{"init.svc.bootanim", "stopped"},
+	}, changes)
+	assert.True(t, HasErrCode(watcher.Err(), AdbError))
+	assert.Contains(t, ErrorWithCauseChain(watcher.Err()), "watchprops exited with status 0")
+	assert.Equal(t, "shell,v2,raw:watchprops", s.Requests[1])
+}
+
+func TestWatchPropertiesLineTooLong(t *testing.T) {
+	s := &MockServer{
+		Status: wire.StatusSuccess,
+		Messages: []string{
+			shellPacket(wire.ShellIDStdout, "1451703845 sys.boot_completed = '1'\n"),
+			shellPacket(wire.ShellIDStdout, "1451703846 debug.big = '"+strings.Repeat("x", 70000)+"'\n"),
+			shellPacket(wire.ShellIDExit, "\x00"),
+		},
+	}
+	watcher, err := (&Adb{server: s}).Device(AnyDevice()).WatchProperties(context.Background())
+	assert.NoError(t, err)
+	for range watcher.C() {
+	}
+	assert.True(t, HasErrCode(watcher.Err(), NetworkError))
+	assert.Contains(t, ErrorWithCauseChain(watcher.Err()), "token too long")
+}
+
+func TestWatchProp(t *testing.T) {
+	s := &MockServer{
+		Status: wire.StatusSuccess,
+		Messages: []string{
+			shellPacket(wire.ShellIDStdout, "0 sys.boot_completed = ''\n"),
+			shellPacket(wire.ShellIDStdout, "1451703845 init.svc.bootanim = 'stopped'\n1451703846 sys.boot_completed = '1'\n"),
+			shellPacket(wire.ShellIDStdout, "1451703847 sys.boot_completed = '1'\n"),
+			shellPacket(wire.ShellIDExit, "\x00"),
+		},
+	}
+	device := (&Adb{server: s}).Device(AnyDevice())
+
+	watcher, err := device.WatchProp(context.Background(), "sys.boot_completed")
+	assert.NoError(t, err)
+	var changes []PropertyChange
+	for change := range watcher.C() {
+		changes = append(changes, change)
+	}
+	assert.Equal(t, []PropertyChange{
+		{"sys.boot_completed", ""},
+		{"sys.boot_completed", "1"},
+	}, changes)
+	assert.True(t, HasErrCode(watcher.Err(), AdbError))
+	assert.Equal(t, "shell,v2,raw:"+watchPropScript("sys.boot_completed"), s.Requests[1])
+}
+
+func TestWatchPropLineTooLong(t *testing.T) {
+	s := &MockServer{
+		Status: wire.StatusSuccess,
+		Messages: []string{
+			shellPacket(wire.ShellIDStdout, "0 debug.big = '"+strings.Repeat("x", 70000)+"'\n"),
+			shellPacket(wire.ShellIDExit, "\x00"),
+		},
+	}
+	watcher, err := (&Adb{server: s}).Device(AnyDevice()).WatchProp(context.Background(), "debug.big")
+	assert.NoError(t, err)
+	for range watcher.C() {
+	}
+	assert.True(t, HasErrCode(watcher.Err(), NetworkError))
+	assert.Contains(t, ErrorWithCauseChain(watcher.Err()), "token too long")
+}
+
+func TestWatchPropInvalidKey(t *testing.T) {
+	device := (&Adb{server: &MockServer{}}).Device(AnyDevice())
+
+	_, err := device.WatchProp(context.Background(), "sys.boot_completed; reboot")
+	assert.True(t, HasErrCode(err, AssertionError))
+}
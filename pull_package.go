@@ -0,0 +1,71 @@
+package adb
+
+import (
+	"context"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/mqhack/goadb/internal/errors"
+)
+
+/*
+PullPackage pulls the APKs of the installed package pkg into dstDir, creating it if needed,
+and returns their local paths: the base APK, and any split APKs, e.g.
+split_config.arm64_v8a.apk. The files keep their names on the device. The error has code
+FileNoExistError if pkg isn't installed.
+
+Corresponds to the commands:
+
+	adb shell pm path <pkg>
+	adb pull <apk> <dst-dir>
+*/
+func (c *Device) PullPackage(ctx context.Context, pkg, dstDir string) ([]string, error) {
+	paths, err := c.pullPackage(ctx, pkg, dstDir)
+	return paths, wrapClientError(err, c, "PullPackage(%s)", pkg)
+}
+
+func (c *Device) pullPackage(ctx context.Context, pkg, dstDir string) ([]string, error) {
+	output, err := c.RunCommand("pm", "path", pkg)
+	if err != nil {
+		return nil, err
+	}
+	apks, err := parsePackagePaths(pkg, output)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dstDir, 0755); err != nil {
+		return nil, wrapLocalFileError(err, dstDir)
+	}
+
+	localPaths := make([]string, len(apks))
+	for i, apk := range apks {
+		localPaths[i] = filepath.Join(dstDir, path.Base(apk))
+		if err := c.pullFile(ctx, apk, localPaths[i], TransferOptions{}, nil, nil); err != nil {
+			return nil, err
+		}
+	}
+	return localPaths, nil
+}
+
+// parsePackagePaths returns the APK paths listed by pm path, e.g.
+//
+//	package:/data/app/~~k3Pa4w==/com.example-Xy9z==/base.apk
+//	package:/data/app/~~k3Pa4w==/com.example-Xy9z==/split_config.arm64_v8a.apk
+func parsePackagePaths(pkg, output string) ([]string, error) {
+	var apks []string
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "package:") && len(line) > len("package:") {
+			apks = append(apks, strings.TrimPrefix(line, "package:"))
+		}
+	}
+	if len(apks) == 0 {
+		if output = strings.TrimSpace(output); output != "" {
+			return nil, errors.Errorf(errors.FileNoExistError, "package %s isn't installed: %s", pkg, output)
+		}
+		return nil, errors.Errorf(errors.FileNoExistError, "package %s isn't installed", pkg)
+	}
+	return apks, nil
+}
@@ -0,0 +1,33 @@
+package adb
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/mqhack/goadb/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePackagePaths(t *testing.T) {
+	apks, err := parsePackagePaths("com.example", "package:/data/app/~~k3Pa4w==/com.example-Xy9z==/base.apk\r\n"+
+		"package:/data/app/~~k3Pa4w==/com.example-Xy9z==/split_config.arm64_v8a.apk\r\n")
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"/data/app/~~k3Pa4w==/com.example-Xy9z==/base.apk",
+		"/data/app/~~k3Pa4w==/com.example-Xy9z==/split_config.arm64_v8a.apk",
+	}, apks)
+
+	_, err = parsePackagePaths("com.missing", "")
+	assert.True(t, HasErrCode(err, FileNoExistError))
+}
+
+func TestPullPackageNotInstalled(t *testing.T) {
+	s := &MockServer{Status: wire.StatusSuccess, Messages: []string{""}}
+	dstDir := filepath.Join(t.TempDir(), "apks")
+	_, err := (&Adb{server: s}).Device(AnyDevice()).PullPackage(context.Background(), "com.missing", dstDir)
+	assert.True(t, HasErrCode(err, FileNoExistError))
+	assert.Equal(t, "shell:pm path com.missing", s.Requests[1])
+	assert.NoDirExists(t, dstDir)
+}
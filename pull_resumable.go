@@ -0,0 +1,134 @@
+package adb
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/mqhack/goadb/internal/errors"
+)
+
+/*
+PullFileResumable pulls the file at remotePath to localPath, continuing a previous
+interrupted pull if possible, and returns the offset it resumed from.
+
+If localPath already exists and is no larger than the remote file, the MD5 of its contents
+is compared to the MD5 of the same number of bytes at the start of the remote file. If they
+match, only the rest of the file is read, with tail on the device, and appended to the local
+file. Otherwise, or if there is no partial file, the whole file is pulled.
+
+Unlike PullFile, the partial local file is kept if the pull fails, so the next call can resume
+it. Resuming requires md5sum, head and tail on the device (toybox provides them on Android M
+and later), and a device that supports the shell protocol.
+*/
+func (c *Device) PullFileResumable(ctx context.Context, remotePath, localPath string) (int64, error) {
+	offset, err := c.pullFileResumable(ctx, remotePath, localPath)
+	return offset, wrapClientError(err, c, "PullFileResumable(%s)", remotePath)
+}
+
+func (c *Device) pullFileResumable(ctx context.Context, remotePath, localPath string) (int64, error) {
+	entry, err := c.Stat(remotePath)
+	if err != nil {
+		return 0, err
+	}
+	if entry.Mode.IsDir() {
+		return 0, errors.Errorf(errors.AssertionError, "remote path %s is a directory", remotePath)
+	}
+
+	offset, err := c.pullResumeOffset(ctx, localPath, remotePath, entry.Size)
+	if err != nil {
+		return 0, err
+	}
+	if offset > 0 && offset == entry.Size {
+		// Already fully transferred.
+		return offset, nil
+	}
+
+	var remote io.ReadCloser
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if offset == 0 {
+		remote, err = c.openRead(remotePath, "")
+	} else {
+		flags = os.O_WRONLY | os.O_APPEND
+		remote, err = c.openTail(remotePath, offset)
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer remote.Close()
+	stop := closeWhenDone(ctx, remote)
+	defer stop()
+
+	local, err := os.OpenFile(localPath, flags, 0666)
+	if err != nil {
+		return 0, wrapLocalFileError(err, localPath)
+	}
+	_, err = io.Copy(&pullDestination{w: local}, remote)
+	if closeErr := local.Close(); err == nil && closeErr != nil {
+		err = errors.WrapErrorf(closeErr, errors.AssertionError, "error writing local file %s", localPath)
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return offset, errors.WrapErrorf(ctx.Err(), errors.Timeout, "pull of %s cancelled", remotePath)
+		}
+		if _, ok := err.(*errors.Err); !ok {
+			err = errors.WrapErrorf(err, errors.NetworkError, "error pulling %s", remotePath)
+		}
+		return offset, err
+	}
+	return offset, nil
+}
+
+// pullResumeOffset returns how many bytes at the start of the remote file are already present
+// in the local file, or 0 if the local file doesn't exist or doesn't match.
+func (c *Device) pullResumeOffset(ctx context.Context, localPath, remotePath string, remoteSize int64) (int64, error) {
+	local, err := os.Open(localPath)
+	if os.IsNotExist(err) {
+		return 0, nil
+	} else if err != nil {
+		return 0, wrapLocalFileError(err, localPath)
+	}
+	defer local.Close()
+	info, err := local.Stat()
+	if err != nil {
+		return 0, wrapLocalFileError(err, localPath)
+	}
+
+	localSize := info.Size()
+	if !info.Mode().IsRegular() || localSize == 0 || localSize > remoteSize {
+		return 0, nil
+	}
+
+	localSum := md5.New()
+	if _, err := io.CopyN(localSum, local, localSize); err != nil {
+		return 0, errors.WrapErrorf(err, errors.AssertionError, "error reading local file %s", localPath)
+	}
+
+	result, err := c.RunCommandResult(ctx,
+		fmt.Sprintf("head -c %d %s | md5sum", localSize, shellQuote(remotePath)), CommandOptions{})
+	if err != nil {
+		return 0, err
+	}
+	remoteSum, err := parseChecksumOutput(result.Stdout)
+	if err != nil {
+		return 0, err
+	}
+
+	if remoteSum != hex.EncodeToString(localSum.Sum(nil)) {
+		return 0, nil
+	}
+	return localSize, nil
+}
+
+// openTail opens the file at remotePath for reading from offset, with tail.
+func (c *Device) openTail(remotePath string, offset int64) (io.ReadCloser, error) {
+	// tail counts bytes from 1.
+	conn, err := c.openShell(fmt.Sprintf("tail -c +%d %s", offset+1, shellQuote(remotePath)))
+	if err != nil {
+		return nil, err
+	}
+	return &shellFileReader{shellStdoutReader: newShellStdoutReader(conn), conn: conn, command: "tail"}, nil
+}
@@ -0,0 +1,80 @@
+package adb
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mqhack/goadb/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPullFileResumable(t *testing.T) {
+	localPath := filepath.Join(t.TempDir(), "a.txt")
+	require.NoError(t, ioutil.WriteFile(localPath, []byte("hel"), 0644))
+	s := &MockServer{
+		Status: wire.StatusSuccess,
+		Messages: []string{
+			syncStat(0100644, 5, 0),
+			shellPacket(wire.ShellIDStdout, "46356afe55fa3cea9cbe73ad442cad47  -\n") + shellPacket(wire.ShellIDExit, "\x00"),
+			shellPacket(wire.ShellIDStdout, "lo") + shellPacket(wire.ShellIDExit, "\x00"),
+		},
+	}
+	device := v1SyncDevice(s)
+
+	offset, err := device.PullFileResumable(context.Background(), "/sdcard/a.txt", localPath)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), offset)
+	data, err := ioutil.ReadFile(localPath)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(data))
+	assert.Equal(t, "shell,v2,raw:head -c 3 '/sdcard/a.txt' | md5sum", s.Requests[3])
+	assert.Equal(t, "shell,v2,raw:tail -c +4 '/sdcard/a.txt'", s.Requests[5])
+}
+
+func TestPullFileResumableMismatch(t *testing.T) {
+	localPath := filepath.Join(t.TempDir(), "a.txt")
+	require.NoError(t, ioutil.WriteFile(localPath, []byte("abc"), 0644))
+	s := &MockServer{
+		Status: wire.StatusSuccess,
+		Messages: []string{
+			syncStat(0100644, 5, 0),
+			shellPacket(wire.ShellIDStdout, "46356afe55fa3cea9cbe73ad442cad47  -\n") + shellPacket(wire.ShellIDExit, "\x00"),
+			"DATA\x05\x00\x00\x00hello",
+			"DONE\x00\x00\x00\x00",
+		},
+	}
+	device := v1SyncDevice(s)
+
+	offset, err := device.PullFileResumable(context.Background(), "/sdcard/a.txt", localPath)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), offset)
+	data, err := ioutil.ReadFile(localPath)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(data))
+}
+
+func TestPullFileResumableTailFails(t *testing.T) {
+	localPath := filepath.Join(t.TempDir(), "a.txt")
+	require.NoError(t, ioutil.WriteFile(localPath, []byte("hel"), 0644))
+	s := &MockServer{
+		Status: wire.StatusSuccess,
+		Messages: []string{
+			syncStat(0100644, 5, 0),
+			shellPacket(wire.ShellIDStdout, "46356afe55fa3cea9cbe73ad442cad47  -\n") + shellPacket(wire.ShellIDExit, "\x00"),
+			shellPacket(wire.ShellIDStderr, "tail: /sdcard/a.txt: Permission denied\n") + shellPacket(wire.ShellIDExit, "\x01"),
+		},
+	}
+	device := v1SyncDevice(s)
+
+	offset, err := device.PullFileResumable(context.Background(), "/sdcard/a.txt", localPath)
+	assert.Equal(t, int64(3), offset)
+	assert.True(t, HasErrCode(err, AdbError))
+	// The partial file is kept for the next attempt.
+	info, err := os.Stat(localPath)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), info.Size())
+}
@@ -0,0 +1,81 @@
+package adb
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/mqhack/goadb/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPullTar(t *testing.T) {
+	s := &MockServer{
+		Status:   wire.StatusSuccess,
+		Messages: []string{pullTarToolMarker + "\r\n"},
+	}
+	require.NoError(t, v1SyncDevice(s).PullTar(context.Background(), "/sdcard/DCIM", &bytes.Buffer{}))
+	assert.Equal(t, []string{
+		"host:transport-any",
+		"shell:if [ ! -d '/sdcard/DCIM' ]; then echo goadb:no-dir; elif command -v tar >/dev/null 2>&1; then echo goadb:tar; fi",
+		"host:transport-any",
+		"exec:tar -cf - -C '/sdcard/DCIM' . 2>/dev/null",
+	}, s.Requests)
+}
+
+func TestPullTarNoDir(t *testing.T) {
+	s := &MockServer{Status: wire.StatusSuccess, Messages: []string{pullTarNoDirMarker + "\r\n"}}
+	err := v1SyncDevice(s).PullTar(context.Background(), "/sdcard/missing", &bytes.Buffer{})
+	assert.True(t, HasErrCode(err, FileNoExistError))
+}
+
+func TestSyncTar(t *testing.T) {
+	s := &MockServer{
+		Status: wire.StatusSuccess,
+		Messages: []string{
+			syncDirEntry(040750, 0, 1451703845, "."),
+			syncDirEntry(040755, 0, 1451703845, ".."),
+			syncDirEntry(0100644, 5, 1451703845, "a.txt"),
+			syncDirEntry(0120777, 5, 1451703845, "link"),
+			syncDirEntry(040755, 0, 1451703845, "sub"),
+			"DONE",
+			"DATA\x05\x00\x00\x00hello", "DONE",
+			syncDirEntry(040700, 0, 1451703845, "."),
+			"DONE",
+			// readlink's output, once the subdirectory has been archived.
+			"a.txt\n",
+		},
+	}
+	var buf bytes.Buffer
+	require.NoError(t, v1SyncDevice(s).syncTar(context.Background(), "/sdcard/DCIM", &buf))
+
+	tr := tar.NewReader(&buf)
+	var names []string
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		names = append(names, header.Name)
+		switch header.Name {
+		case "./":
+			assert.Equal(t, int64(0750), header.Mode)
+		case "./a.txt":
+			content, err := ioutil.ReadAll(tr)
+			require.NoError(t, err)
+			assert.Equal(t, "hello", string(content))
+			assert.Equal(t, int64(1451703845), header.ModTime.Unix())
+		case "./link":
+			assert.Equal(t, byte(tar.TypeSymlink), header.Typeflag)
+			assert.Equal(t, "a.txt", header.Linkname)
+		case "./sub/":
+			assert.Equal(t, int64(0700), header.Mode)
+		}
+	}
+	assert.Equal(t, []string{"./", "./a.txt", "./sub/", "./link"}, names)
+}
@@ -0,0 +1,142 @@
+package adb
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/mqhack/goadb/internal/errors"
+)
+
+/*
+PushFileResumable pushes the file at localPath to remotePath, continuing a previous
+interrupted push if possible, and returns the offset it resumed from.
+
+If remotePath already exists and is no larger than the local file, the MD5 of its contents
+is compared to the MD5 of the same number of bytes at the start of the local file. If they
+match, only the rest of the file is sent, and appended using dd on the device. Otherwise,
+or if there is no partial file, the whole file is pushed with the local file's permissions
+and modification time.
+
+When a push is resumed, the modification time of the remote file is not updated.
+Resuming requires md5sum, head and dd on the device (toybox provides them on Android M
+and later), and a device that supports the shell protocol.
+*/
+func (c *Device) PushFileResumable(ctx context.Context, localPath, remotePath string) (int64, error) {
+	offset, err := c.pushFileResumable(ctx, localPath, remotePath)
+	return offset, wrapClientError(err, c, "PushFileResumable(%s)", remotePath)
+}
+
+func (c *Device) pushFileResumable(ctx context.Context, localPath, remotePath string) (int64, error) {
+	local, err := os.Open(localPath)
+	if err != nil {
+		return 0, wrapLocalFileError(err, localPath)
+	}
+	defer local.Close()
+
+	info, err := local.Stat()
+	if err != nil {
+		return 0, errors.WrapErrorf(err, errors.AssertionError, "error reading local file %s", localPath)
+	}
+
+	offset, err := c.resumeOffset(ctx, local, info.Size(), remotePath)
+	if err != nil {
+		return 0, err
+	}
+
+	if offset == 0 {
+		return 0, c.pushFromStart(local, remotePath, info)
+	}
+	if offset == info.Size() {
+		// Already fully transferred.
+		return offset, nil
+	}
+
+	if _, err := local.Seek(offset, io.SeekStart); err != nil {
+		return 0, errors.WrapErrorf(err, errors.AssertionError, "error seeking local file %s", localPath)
+	}
+	result, err := c.RunCommandResult(ctx,
+		fmt.Sprintf("dd of=%s bs=65536 seek=%d oflag=seek_bytes conv=notrunc 2>&1", shellQuote(remotePath), offset),
+		CommandOptions{Stdin: local})
+	if err != nil {
+		return offset, err
+	}
+	if result.ExitCode != 0 {
+		return offset, errors.Errorf(errors.AdbError, "dd failed with exit code %d: %s",
+			result.ExitCode, strings.TrimSpace(result.Stdout))
+	}
+	return offset, nil
+}
+
+// resumeOffset returns how many bytes at the start of the local file are already present
+// in the remote file, or 0 if the remote file doesn't exist or doesn't match.
+func (c *Device) resumeOffset(ctx context.Context, local io.ReadSeeker, localSize int64, remotePath string) (int64, error) {
+	entry, err := c.Stat(remotePath)
+	if HasErrCode(err, FileNoExistError) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	if entry.Mode.IsDir() {
+		return 0, errors.Errorf(errors.AssertionError, "remote path %s is a directory", remotePath)
+	}
+
+	remoteSize := entry.Size
+	if remoteSize == 0 || remoteSize > localSize {
+		return 0, nil
+	}
+
+	localSum := md5.New()
+	if _, err := io.CopyN(localSum, local, remoteSize); err != nil {
+		return 0, errors.WrapErrorf(err, errors.AssertionError, "error reading local file")
+	}
+	if _, err := local.Seek(0, io.SeekStart); err != nil {
+		return 0, errors.WrapErrorf(err, errors.AssertionError, "error seeking local file")
+	}
+
+	result, err := c.RunCommandResult(ctx,
+		fmt.Sprintf("head -c %d %s | md5sum", remoteSize, shellQuote(remotePath)), CommandOptions{})
+	if err != nil {
+		return 0, err
+	}
+	remoteSum, err := parseChecksumOutput(result.Stdout)
+	if err != nil {
+		return 0, err
+	}
+
+	if remoteSum != hex.EncodeToString(localSum.Sum(nil)) {
+		return 0, nil
+	}
+	return remoteSize, nil
+}
+
+func (c *Device) pushFromStart(local io.Reader, remotePath string, info os.FileInfo) error {
+	writer, err := c.OpenWrite(remotePath, info.Mode().Perm(), info.ModTime())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(writer, local); err != nil {
+		writer.Close()
+		return errors.WrapErrorf(err, errors.NetworkError, "error pushing file")
+	}
+	return writer.Close()
+}
+
+// parseChecksumOutput returns the hash from the output of md5sum or sha*sum, which print
+// lines of the form "<hash>  <path>".
+func parseChecksumOutput(output string) (string, error) {
+	fields := strings.Fields(output)
+	if len(fields) == 0 || !isHex(fields[0]) {
+		return "", errors.Errorf(errors.ParseError, "invalid checksum output: %s", output)
+	}
+	return strings.ToLower(fields[0]), nil
+}
+
+func isHex(s string) bool {
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
@@ -0,0 +1,19 @@
+package adb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseChecksumOutput(t *testing.T) {
+	sum, err := parseChecksumOutput("D41D8CD98F00B204E9800998ECF8427E  -\n")
+	assert.NoError(t, err)
+	assert.Equal(t, "d41d8cd98f00b204e9800998ecf8427e", sum)
+
+	_, err = parseChecksumOutput("md5sum: /foo: No such file or directory\n")
+	assert.Error(t, err)
+
+	_, err = parseChecksumOutput("")
+	assert.Error(t, err)
+}
@@ -0,0 +1,111 @@
+package adb
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/mqhack/goadb/internal/errors"
+	"github.com/mqhack/goadb/wire"
+)
+
+// The most bytes a rateLimiter lets through at once after being idle: one sync data chunk.
+const rateLimitBurst = wire.SyncMaxChunkSize
+
+/*
+rateLimiter is a token bucket that limits how many bytes per second are transferred. It's safe
+for concurrent use, so transfers sharing one share its rate.
+
+Bytes are reserved before they're waited for, so the bucket can go into debt: a transfer that
+reserves more than is available waits until it's paid off, and later reservations wait behind
+it.
+*/
+type rateLimiter struct {
+	rate float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(bytesPerSecond int64) *rateLimiter {
+	return &rateLimiter{rate: float64(bytesPerSecond), tokens: rateLimitBurst}
+}
+
+// reserve takes n bytes from the bucket at now, and returns how long to wait before
+// transferring them.
+func (l *rateLimiter) reserve(now time.Time, n int) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.last.IsZero() {
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		if l.tokens > rateLimitBurst {
+			l.tokens = rateLimitBurst
+		}
+	}
+	l.last = now
+	l.tokens -= float64(n)
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
+
+// wait blocks until n bytes may be transferred, or ctx is done.
+func (l *rateLimiter) wait(ctx context.Context, n int) error {
+	delay := l.reserve(time.Now(), n)
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return errors.WrapErrorf(ctx.Err(), errors.Timeout, "cancelled while rate limited")
+	}
+}
+
+// rateLimitedReader limits how fast r is read by waiting for each read's bytes after
+// they've been read.
+type rateLimitedReader struct {
+	ctx     context.Context
+	r       io.Reader
+	limiter *rateLimiter
+}
+
+func (r *rateLimitedReader) Read(p []byte) (int, error) {
+	if len(p) > rateLimitBurst {
+		p = p[:rateLimitBurst]
+	}
+	n, err := r.r.Read(p)
+	if n > 0 {
+		if waitErr := r.limiter.wait(r.ctx, n); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
+
+// rateLimited returns r limited to opts' rate, or r if opts has no rate limit.
+func (o TransferOptions) rateLimited(ctx context.Context, r io.Reader) io.Reader {
+	limiter := o.limiter
+	if limiter == nil && o.RateLimit > 0 {
+		limiter = newRateLimiter(o.RateLimit)
+	}
+	if limiter == nil {
+		return r
+	}
+	return &rateLimitedReader{ctx: ctx, r: r, limiter: limiter}
+}
+
+// withSharedRateLimit returns o with a limiter that's shared by all the transfers made with
+// it, so transferring many files at once doesn't multiply the rate.
+func (o TransferOptions) withSharedRateLimit() TransferOptions {
+	if o.limiter == nil && o.RateLimit > 0 {
+		o.limiter = newRateLimiter(o.RateLimit)
+	}
+	return o
+}
@@ -0,0 +1,50 @@
+package adb
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimiterReserve(t *testing.T) {
+	l := newRateLimiter(1024 * 1024)
+	start := time.Unix(1000, 0)
+
+	// The first burst is free.
+	assert.Equal(t, time.Duration(0), l.reserve(start, rateLimitBurst))
+	// The next has to wait for the bucket to refill.
+	assert.Equal(t, time.Second/16, l.reserve(start, rateLimitBurst))
+	// Later reservations wait behind the debt.
+	assert.Equal(t, time.Second/8, l.reserve(start, rateLimitBurst))
+	// Once it's paid off, idle time refills the bucket, but only up to a burst.
+	assert.Equal(t, time.Duration(0), l.reserve(start.Add(time.Hour), rateLimitBurst))
+	assert.Equal(t, time.Second/16, l.reserve(start.Add(time.Hour), rateLimitBurst))
+}
+
+func TestRateLimitedReader(t *testing.T) {
+	opts := TransferOptions{RateLimit: 1024 * 1024}
+	data := bytes.Repeat([]byte("a"), 3*rateLimitBurst)
+
+	start := time.Now()
+	read, err := ioutil.ReadAll(opts.rateLimited(context.Background(), bytes.NewReader(data)))
+	require.NoError(t, err)
+	assert.Equal(t, data, read)
+	// The first chunk is free, and the other two take 1/16 of a second each.
+	assert.True(t, time.Since(start) >= time.Second/8, "took %s", time.Since(start))
+
+	assert.IsType(t, &bytes.Reader{}, TransferOptions{}.rateLimited(context.Background(), bytes.NewReader(nil)))
+}
+
+func TestRateLimitedReaderCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r := TransferOptions{RateLimit: 1}.rateLimited(ctx, bytes.NewReader(make([]byte, 2*rateLimitBurst)))
+
+	_, err := ioutil.ReadAll(r)
+	assert.True(t, HasErrCode(err, Timeout))
+}
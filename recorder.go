@@ -0,0 +1,198 @@
+package adb
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/mqhack/goadb/internal/errors"
+)
+
+// RecorderOptions configures a Recorder.
+type RecorderOptions struct {
+	// Options for each segment. TimeLimit is the length of each segment, and defaults to
+	// MaxScreenrecordTimeLimit.
+	ScreenrecordOptions
+
+	// Output receives the segments concatenated into one H.264 stream. Each segment starts
+	// with its own stream headers, so the result plays as a single video.
+	Output io.Writer
+	// NewSegment, if set, is called to open a separate writer for each segment, instead of
+	// writing them to Output. The writer is closed when the segment ends.
+	NewSegment func(index int) (io.WriteCloser, error)
+}
+
+// RecordingSegment describes one screenrecord run in a recording.
+type RecordingSegment struct {
+	Index     int
+	StartedAt time.Time
+	Duration  time.Duration
+	// Offset is where the segment starts in RecorderOptions.Output. Zero if segments are
+	// written with NewSegment.
+	Offset int64
+	Size   int64
+}
+
+/*
+Recorder records the screen for arbitrarily long, by chaining screenrecord runs, which are
+each limited to MaxScreenrecordTimeLimit. A new segment is started as soon as the previous
+one ends, so only a few frames are lost at each boundary.
+
+Start begins recording, and Stop ends it and returns the segments recorded.
+*/
+type Recorder struct {
+	opts   RecorderOptions
+	record func(ctx context.Context, w io.Writer, opts ScreenrecordOptions) error
+	now    func() time.Time
+
+	mu       sync.Mutex
+	started  bool
+	segments []RecordingSegment
+	err      error
+
+	stop context.CancelFunc
+	done chan struct{}
+}
+
+// NewRecorder returns a Recorder for the device. Call Start to begin recording.
+func (c *Device) NewRecorder(opts RecorderOptions) *Recorder {
+	return newRecorder(opts, c.Screenrecord)
+}
+
+func newRecorder(opts RecorderOptions, record func(context.Context, io.Writer, ScreenrecordOptions) error) *Recorder {
+	if opts.TimeLimit <= 0 {
+		opts.TimeLimit = MaxScreenrecordTimeLimit
+	}
+	return &Recorder{
+		opts:   opts,
+		record: record,
+		now:    time.Now,
+		done:   make(chan struct{}),
+	}
+}
+
+// Start begins recording in the background. Recording continues until Stop is called, ctx
+// is done, or a segment fails.
+func (r *Recorder) Start(ctx context.Context) error {
+	if r.opts.Output == nil && r.opts.NewSegment == nil {
+		return errors.AssertionErrorf("recorder needs an Output or NewSegment")
+	}
+	if err := validateScreenrecordOptions(r.opts.ScreenrecordOptions); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.started {
+		return errors.AssertionErrorf("recorder already started")
+	}
+	r.started = true
+
+	ctx, r.stop = context.WithCancel(ctx)
+	go r.run(ctx)
+	return nil
+}
+
+// Stop ends the recording, waits for the current segment to be written, and returns all the
+// segments recorded. The error is the one that ended the recording early, if any.
+func (r *Recorder) Stop() ([]RecordingSegment, error) {
+	r.mu.Lock()
+	started := r.started
+	r.mu.Unlock()
+	if !started {
+		return nil, errors.AssertionErrorf("recorder not started")
+	}
+
+	r.stop()
+	<-r.done
+	return r.Segments(), r.err
+}
+
+// Segments returns the segments that have been completely recorded so far.
+func (r *Recorder) Segments() []RecordingSegment {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]RecordingSegment(nil), r.segments...)
+}
+
+func (r *Recorder) run(ctx context.Context) {
+	defer close(r.done)
+	var offset int64
+	for index := 0; ctx.Err() == nil; index++ {
+		w, err := r.segmentWriter(index)
+		if err != nil {
+			r.fail(err)
+			return
+		}
+
+		out := &countingWriter{w: w}
+		startedAt := r.now()
+		err = r.record(ctx, out, r.opts.ScreenrecordOptions)
+		if closeErr := w.Close(); err == nil && closeErr != nil {
+			err = errors.WrapErrorf(closeErr, errors.AssertionError, "error closing segment %d", index)
+		}
+		if out.n > 0 {
+			segment := RecordingSegment{
+				Index:     index,
+				StartedAt: startedAt,
+				Duration:  r.now().Sub(startedAt),
+				Size:      out.n,
+			}
+			if r.opts.NewSegment == nil {
+				segment.Offset = offset
+				offset += out.n
+			}
+			r.mu.Lock()
+			r.segments = append(r.segments, segment)
+			r.mu.Unlock()
+		}
+
+		if err != nil {
+			r.fail(err)
+			return
+		}
+		if out.n == 0 && ctx.Err() == nil {
+			// Don't keep restarting screenrecord if it can't record anything.
+			r.fail(errors.Errorf(errors.AdbError, "screenrecord ended without recording segment %d", index))
+			return
+		}
+	}
+}
+
+func (r *Recorder) segmentWriter(index int) (io.WriteCloser, error) {
+	if r.opts.NewSegment == nil {
+		return nopWriteCloser{r.opts.Output}, nil
+	}
+	w, err := r.opts.NewSegment(index)
+	if err != nil {
+		return nil, errors.WrapErrorf(err, errors.AssertionError, "error opening segment %d", index)
+	}
+	return w, nil
+}
+
+func (r *Recorder) fail(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.err = err
+}
+
+// countingWriter counts the bytes written to w.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
@@ -0,0 +1,101 @@
+package adb
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeScreenrecord returns a record func that writes each segment's name, and returns
+// immediately for the first segments, as if they hit the time limit, then waits for ctx.
+func fakeScreenrecord(limitedSegments int, limits *[]time.Duration) func(context.Context, io.Writer, ScreenrecordOptions) error {
+	index := 0
+	return func(ctx context.Context, w io.Writer, opts ScreenrecordOptions) error {
+		*limits = append(*limits, opts.TimeLimit)
+		fmt.Fprintf(w, "segment%d;", index)
+		index++
+		if index > limitedSegments {
+			<-ctx.Done()
+		}
+		return nil
+	}
+}
+
+func TestRecorderConcatenatesSegments(t *testing.T) {
+	var limits []time.Duration
+	var out bytes.Buffer
+	r := newRecorder(RecorderOptions{Output: &out}, fakeScreenrecord(2, &limits))
+
+	require.NoError(t, r.Start(context.Background()))
+	assert.Eventually(t, func() bool { return len(r.Segments()) == 2 }, time.Second, time.Millisecond)
+	segments, err := r.Stop()
+	require.NoError(t, err)
+
+	assert.Equal(t, "segment0;segment1;segment2;", out.String())
+	require.Len(t, segments, 3)
+	for i, segment := range segments {
+		assert.Equal(t, i, segment.Index)
+		assert.Equal(t, int64(9*i), segment.Offset)
+		assert.Equal(t, int64(9), segment.Size)
+	}
+	assert.Equal(t, []time.Duration{MaxScreenrecordTimeLimit, MaxScreenrecordTimeLimit, MaxScreenrecordTimeLimit}, limits)
+}
+
+type segmentBuffer struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (b *segmentBuffer) Close() error {
+	b.closed = true
+	return nil
+}
+
+func TestRecorderSeparateSegments(t *testing.T) {
+	var limits []time.Duration
+	var files []*segmentBuffer
+	r := newRecorder(RecorderOptions{
+		ScreenrecordOptions: ScreenrecordOptions{TimeLimit: time.Minute},
+		NewSegment: func(index int) (io.WriteCloser, error) {
+			files = append(files, &segmentBuffer{})
+			return files[index], nil
+		},
+	}, fakeScreenrecord(1, &limits))
+
+	require.NoError(t, r.Start(context.Background()))
+	assert.Eventually(t, func() bool { return len(r.Segments()) == 1 }, time.Second, time.Millisecond)
+	segments, err := r.Stop()
+	require.NoError(t, err)
+
+	require.Len(t, files, 2)
+	assert.Equal(t, "segment0;", files[0].String())
+	assert.Equal(t, "segment1;", files[1].String())
+	assert.True(t, files[0].closed && files[1].closed)
+	require.Len(t, segments, 2)
+	assert.Equal(t, int64(0), segments[1].Offset)
+	assert.Equal(t, []time.Duration{time.Minute, time.Minute}, limits)
+}
+
+func TestRecorderStopsOnEmptySegment(t *testing.T) {
+	r := newRecorder(RecorderOptions{Output: &bytes.Buffer{}}, func(context.Context, io.Writer, ScreenrecordOptions) error {
+		return nil
+	})
+	require.NoError(t, r.Start(context.Background()))
+	<-r.done
+	segments, err := r.Stop()
+	assert.Empty(t, segments)
+	assert.EqualError(t, err, "AdbError: screenrecord ended without recording segment 0")
+}
+
+func TestRecorderErrors(t *testing.T) {
+	r := newRecorder(RecorderOptions{}, nil)
+	assert.EqualError(t, r.Start(context.Background()), "AssertionError: recorder needs an Output or NewSegment")
+	_, err := r.Stop()
+	assert.EqualError(t, err, "AssertionError: recorder not started")
+}
@@ -0,0 +1,126 @@
+package adb
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mqhack/goadb/internal/errors"
+)
+
+// Rotation is the rotation of the display from its natural orientation, in quarter turns
+// counterclockwise.
+type Rotation int
+
+const (
+	Rotation0 Rotation = iota
+	Rotation90
+	Rotation180
+	Rotation270
+)
+
+func (r Rotation) String() string {
+	if r < Rotation0 || r > Rotation270 {
+		return fmt.Sprintf("Rotation(%d)", int(r))
+	}
+	return fmt.Sprintf("Rotation%d", int(r)*90)
+}
+
+// How long SetRotation waits for the display to rotate, and how often it checks.
+const (
+	rotationTimeout      = 5 * time.Second
+	rotationPollInterval = 100 * time.Millisecond
+)
+
+// Matches the rotation of the default display's current DisplayInfo in dumpsys display output,
+// e.g. "mOverrideDisplayInfo=DisplayInfo{"Built-in Screen", displayId 0, ..., rotation 1, ...".
+var overrideDisplayInfoRotationPattern = regexp.MustCompile(`mOverrideDisplayInfo=DisplayInfo\{.*?\brotation (\d)\b`)
+
+// Matches the display's base DisplayInfo, which older releases report the rotation in.
+var baseDisplayInfoRotationPattern = regexp.MustCompile(`mBaseDisplayInfo=DisplayInfo\{.*?\brotation (\d)\b`)
+
+/*
+GetRotation returns the current rotation of the default display.
+
+Corresponds to the command:
+
+	adb shell dumpsys display
+*/
+func (c *Device) GetRotation() (Rotation, error) {
+	rotation, err := c.getRotation()
+	return rotation, wrapClientError(err, c, "GetRotation")
+}
+
+func (c *Device) getRotation() (Rotation, error) {
+	output, err := c.RunCommand("dumpsys", "display")
+	if err != nil {
+		return 0, err
+	}
+	return parseDisplayRotation(output)
+}
+
+/*
+SetRotation turns off auto-rotate and rotates the default display to r, so the orientation
+doesn't depend on how the device is held. It returns once dumpsys display reports the new
+rotation. Apps locked to an orientation can keep the display from rotating, in which case the
+error has code AdbError.
+
+Auto-rotate stays off until it's turned back on in Settings, or with:
+
+	adb shell settings put system accelerometer_rotation 1
+
+Corresponds to the commands:
+
+	adb shell settings put system accelerometer_rotation 0
+	adb shell settings put system user_rotation <r>
+*/
+func (c *Device) SetRotation(r Rotation) error {
+	return wrapClientError(c.setRotation(r), c, "SetRotation")
+}
+
+func (c *Device) setRotation(r Rotation) error {
+	if r < Rotation0 || r > Rotation270 {
+		return errors.AssertionErrorf("invalid rotation %d", int(r))
+	}
+	if _, err := c.RunCommand("settings", "put", "system", "accelerometer_rotation", "0"); err != nil {
+		return err
+	}
+	if _, err := c.RunCommand("settings", "put", "system", "user_rotation", strconv.Itoa(int(r))); err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(rotationTimeout)
+	for {
+		current, err := c.getRotation()
+		if err != nil {
+			return err
+		}
+		if current == r {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return errors.Errorf(errors.AdbError, "display didn't rotate to %s after %s: still at %s", r, rotationTimeout, current)
+		}
+		time.Sleep(rotationPollInterval)
+	}
+}
+
+// parseDisplayRotation returns the rotation of the first display in dumpsys display output,
+// which is the default display.
+func parseDisplayRotation(output string) (Rotation, error) {
+	match := overrideDisplayInfoRotationPattern.FindStringSubmatch(output)
+	if match == nil {
+		match = baseDisplayInfoRotationPattern.FindStringSubmatch(output)
+	}
+	if match == nil {
+		return 0, errors.Errorf(errors.ParseError, "no display rotation in dumpsys display output: %.100s",
+			strings.TrimSpace(output))
+	}
+	rotation, _ := strconv.Atoi(match[1])
+	if rotation > int(Rotation270) {
+		return 0, errors.Errorf(errors.ParseError, "invalid display rotation %d", rotation)
+	}
+	return Rotation(rotation), nil
+}
@@ -0,0 +1,51 @@
+package adb
+
+import (
+	"testing"
+
+	"github.com/mqhack/goadb/internal/errors"
+	"github.com/mqhack/goadb/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const dumpsysDisplayOutput = `DISPLAY MANAGER (dumpsys display)
+  mOnlyCode=false
+Logical Displays: size=1
+  Display 0:
+    mDisplayId=0
+    mBaseDisplayInfo=DisplayInfo{"Built-in Screen", displayId 0, FLAG_SECURE, real 1080 x 2400, largest app 1080 x 2400, rotation 0, density 420}
+    mOverrideDisplayInfo=DisplayInfo{"Built-in Screen", displayId 0, FLAG_SECURE, real 2400 x 1080, largest app 2400 x 2400, rotation 1, density 420}
+`
+
+func TestParseDisplayRotation(t *testing.T) {
+	rotation, err := parseDisplayRotation(dumpsysDisplayOutput)
+	require.NoError(t, err)
+	assert.Equal(t, Rotation90, rotation)
+
+	rotation, err = parseDisplayRotation(`mBaseDisplayInfo=DisplayInfo{"Built-in Screen", displayId 0, rotation 2, density 420}`)
+	require.NoError(t, err)
+	assert.Equal(t, Rotation180, rotation)
+
+	_, err = parseDisplayRotation("Can't find service: display\n")
+	assert.Equal(t, errors.ParseError, code(err))
+}
+
+func TestGetRotation(t *testing.T) {
+	s := &MockServer{
+		Status:   wire.StatusSuccess,
+		Messages: []string{dumpsysDisplayOutput},
+	}
+	rotation, err := (&Adb{server: s}).Device(AnyDevice()).GetRotation()
+	require.NoError(t, err)
+	assert.Equal(t, Rotation90, rotation)
+	assert.Equal(t, "Rotation90", rotation.String())
+	assert.Equal(t, "shell:dumpsys display", s.Requests[1])
+}
+
+func TestSetRotationInvalid(t *testing.T) {
+	s := &MockServer{Status: wire.StatusSuccess}
+	err := (&Adb{server: s}).Device(AnyDevice()).SetRotation(Rotation(4))
+	assert.Equal(t, errors.AssertionError, code(err))
+	assert.Empty(t, s.Requests)
+}
@@ -0,0 +1,104 @@
+package adb
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/mqhack/goadb/internal/errors"
+	"github.com/mqhack/goadb/internal/random"
+)
+
+/*
+RunCommands runs cmds one after another in a single shell session, and returns the result of
+each, so a script of many small commands takes one round trip instead of one per command.
+
+Each command is a shell command line, e.g. "cd /sdcard && ls", which is run with eval, so a
+syntax error in one only fails that command. The commands share the session, so working
+directory changes and variables set by one are seen by the ones after it. Their stdin is
+/dev/null. A command that fails doesn't stop the rest; a command that exits the shell does,
+and an error is returned along with the results of the commands that ran. The Duration of
+the results isn't set, since the commands aren't timed separately.
+
+Requires a device running Android N or later (see OpenShell).
+*/
+func (c *Device) RunCommands(cmds []string) ([]*CommandResult, error) {
+	if len(cmds) == 0 {
+		return nil, nil
+	}
+	sentinel := "goadb-end-" + random.ID()
+
+	conn, err := c.openShell("sh")
+	if err != nil {
+		return nil, wrapClientError(err, c, "RunCommands")
+	}
+	defer conn.Close()
+
+	stdinErr := make(chan error, 1)
+	go func() {
+		stdinErr <- sendShellStdin(conn, strings.NewReader(batchScript(cmds, sentinel)))
+	}()
+	output, err := readCommandResult(conn, 0)
+	if err != nil {
+		return nil, wrapClientError(err, c, "RunCommands")
+	}
+	if err := <-stdinErr; err != nil {
+		return nil, wrapClientError(err, c, "RunCommands")
+	}
+
+	results, err := splitBatchOutput(output, sentinel, len(cmds))
+	return results, wrapClientError(err, c, "RunCommands")
+}
+
+// batchScript returns a shell script that runs each of cmds, followed by sentinel and its exit
+// code on stdout, and sentinel on stderr.
+func batchScript(cmds []string, sentinel string) string {
+	var script strings.Builder
+	for _, cmd := range cmds {
+		fmt.Fprintf(&script, "eval %s </dev/null\n", shellQuote(cmd))
+		fmt.Fprintf(&script, "printf '%%s %%d\\n' %s $?\n", sentinel)
+		fmt.Fprintf(&script, "printf '%%s\\n' %s >&2\n", sentinel)
+	}
+	return script.String()
+}
+
+// splitBatchOutput splits the output of a batchScript of n commands into a result per command.
+// If the shell exited early, the last result is that of the command that exited it, with the
+// shell's exit code, and an error is returned with the results.
+func splitBatchOutput(output *CommandResult, sentinel string, n int) ([]*CommandResult, error) {
+	stdout, stderr := output.Stdout, output.Stderr
+	var results []*CommandResult
+	for len(results) < n {
+		i := strings.Index(stdout, sentinel+" ")
+		if i < 0 {
+			break
+		}
+		result := &CommandResult{Stdout: stdout[:i]}
+		line := stdout[i+len(sentinel)+1:]
+		end := strings.IndexByte(line, '\n')
+		if end < 0 {
+			return results, errors.Errorf(errors.ParseError, "truncated exit code of command %d: %q", len(results)+1, line)
+		}
+		exitCode, err := strconv.Atoi(line[:end])
+		if err != nil {
+			return results, errors.WrapErrorf(err, errors.ParseError, "malformed exit code of command %d: %q", len(results)+1, line[:end])
+		}
+		result.ExitCode = exitCode
+		stdout = line[end+1:]
+
+		if j := strings.Index(stderr, sentinel+"\n"); j >= 0 {
+			result.Stderr = stderr[:j]
+			stderr = stderr[j+len(sentinel)+1:]
+		} else {
+			result.Stderr, stderr = stderr, ""
+		}
+		results = append(results, result)
+	}
+	if len(results) == n {
+		return results, nil
+	}
+
+	results = append(results, &CommandResult{Stdout: stdout, Stderr: stderr, ExitCode: output.ExitCode})
+	return results, errors.Errorf(errors.AdbError, "shell exited with status %d during command %d of %d",
+		output.ExitCode, len(results), n)
+}
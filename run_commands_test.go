@@ -0,0 +1,58 @@
+package adb
+
+import (
+	"testing"
+
+	"github.com/mqhack/goadb/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBatchScript(t *testing.T) {
+	assert.Equal(t, "eval 'cd /sdcard' </dev/null\n"+
+		"printf '%s %d\\n' END $?\n"+
+		"printf '%s\\n' END >&2\n"+
+		"eval 'echo '\\''hi'\\''' </dev/null\n"+
+		"printf '%s %d\\n' END $?\n"+
+		"printf '%s\\n' END >&2\n",
+		batchScript([]string{"cd /sdcard", "echo 'hi'"}, "END"))
+}
+
+func TestSplitBatchOutput(t *testing.T) {
+	results, err := splitBatchOutput(&CommandResult{
+		Stdout: "one\nEND 0\nEND 1\npartialEND 2\n",
+		Stderr: "END\nnot found\nEND\nEND\n",
+	}, "END", 3)
+	require.NoError(t, err)
+	assert.Equal(t, []*CommandResult{
+		{Stdout: "one\n", ExitCode: 0},
+		{Stdout: "", Stderr: "not found\n", ExitCode: 1},
+		{Stdout: "partial", ExitCode: 2},
+	}, results)
+}
+
+func TestSplitBatchOutputShellExited(t *testing.T) {
+	results, err := splitBatchOutput(&CommandResult{
+		Stdout:   "one\nEND 0\nbye\n",
+		Stderr:   "END\n",
+		ExitCode: 3,
+	}, "END", 3)
+	assert.True(t, HasErrCode(err, AdbError))
+	assert.EqualError(t, err, "AdbError: shell exited with status 3 during command 2 of 3")
+	assert.Equal(t, []*CommandResult{
+		{Stdout: "one\n", ExitCode: 0},
+		{Stdout: "bye\n", ExitCode: 3},
+	}, results)
+}
+
+func TestRunCommandsOpensOneShell(t *testing.T) {
+	s := &MockServer{
+		Status:   wire.StatusSuccess,
+		Messages: []string{shellPacket(wire.ShellIDExit, "\000")},
+	}
+	device := (&Adb{server: s}).Device(AnyDevice())
+
+	_, err := device.RunCommands([]string{"true", "false"})
+	assert.True(t, HasErrCode(err, AdbError))
+	assert.Equal(t, []string{"host:transport-any", "shell,v2,raw:sh"}, s.Requests)
+}
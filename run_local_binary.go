@@ -0,0 +1,139 @@
+package adb
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mqhack/goadb/internal/errors"
+	"github.com/mqhack/goadb/internal/random"
+	"github.com/mqhack/goadb/wire"
+)
+
+// RunBinaryOptions configures Device.RunLocalBinary.
+type RunBinaryOptions struct {
+	// Stdin is sent to the binary as its standard input, followed by EOF. If nil, the
+	// binary gets an empty input.
+	Stdin io.Reader
+
+	// Stdout and Stderr are written the binary's output as it runs, from the goroutine that
+	// called RunLocalBinary. If nil, the output is discarded.
+	Stdout, Stderr io.Writer
+}
+
+/*
+RunLocalBinary pushes the executable at localPath to a new file in /data/local/tmp, makes it
+executable, and runs it with args, streaming its output to opts.Stdout and opts.Stderr.
+It returns the binary's exit code once it exits, and removes the file afterwards, even if it
+failed or ctx is done. The args are quoted, so they reach the binary unchanged.
+
+If ctx is done, the binary is killed and the error has code Timeout. Requires a device
+running Android N or later, for the shell protocol.
+*/
+func (c *Device) RunLocalBinary(ctx context.Context, localPath string, args []string, opts RunBinaryOptions) (int, error) {
+	exitCode, err := c.runLocalBinary(ctx, localPath, args, opts)
+	return exitCode, wrapClientError(err, c, "RunLocalBinary(%s)", localPath)
+}
+
+func (c *Device) runLocalBinary(ctx context.Context, localPath string, args []string, opts RunBinaryOptions) (int, error) {
+	local, err := os.Open(localPath)
+	if err != nil {
+		return -1, wrapLocalFileError(err, localPath)
+	}
+	defer local.Close()
+	info, err := local.Stat()
+	if err != nil {
+		return -1, wrapLocalFileError(err, localPath)
+	}
+
+	remotePath := fmt.Sprintf("%s/goadb-%s-%s", deviceTempDirParent, random.ID(), filepath.Base(localPath))
+	quoted := shellQuote(remotePath)
+	exitCode, err := func() (int, error) {
+		if err := c.pushStream(ctx, local, info.Size(), remotePath, 0755, MtimeOfClose, ""); err != nil {
+			return -1, err
+		}
+		cmd := "chmod 755 " + quoted + " && " + quoted
+		for _, arg := range args {
+			cmd += " " + shellQuote(arg)
+		}
+		return c.streamCommand(ctx, cmd, opts)
+	}()
+
+	// The file is removed even if the push failed part way, since it may have been created.
+	output, rmErr := c.RunCommand("rm -f " + quoted)
+	if rmErr == nil && strings.TrimSpace(output) != "" {
+		rmErr = errors.Errorf(errors.AdbError, "error removing %s: %s", remotePath, strings.TrimSpace(output))
+	}
+	if err == nil {
+		err = rmErr
+	}
+	return exitCode, err
+}
+
+// streamCommand runs cmd with the shell protocol, sending opts.Stdin and writing its output to
+// opts.Stdout and opts.Stderr as it arrives, and returns its exit code.
+func (c *Device) streamCommand(ctx context.Context, cmd string, opts RunBinaryOptions) (int, error) {
+	conn, err := c.openShell(cmd)
+	if err != nil {
+		return -1, err
+	}
+	defer conn.Close()
+	stop := closeWhenDone(ctx, conn)
+	defer stop()
+
+	stdinErr := make(chan error, 1)
+	stdinDone := make(chan struct{})
+	go func() {
+		defer close(stdinDone)
+		if err := sendShellStdin(conn, opts.Stdin); err != nil {
+			// Without the rest of its input the command may never exit, so abort it.
+			stdinErr <- err
+			conn.Close()
+		}
+	}()
+	// The command may exit without reading all its input, so closing the connection is what
+	// stops the sender.
+	defer func() {
+		conn.Close()
+		<-stdinDone
+	}()
+
+	stdout, stderr := opts.Stdout, opts.Stderr
+	if stdout == nil {
+		stdout = ioutil.Discard
+	}
+	if stderr == nil {
+		stderr = ioutil.Discard
+	}
+	for {
+		id, data, err := conn.ReadPacket()
+		if err != nil {
+			if ctx.Err() != nil {
+				return -1, errors.WrapErrorf(ctx.Err(), errors.Timeout, "command '%s' cancelled", cmd)
+			}
+			select {
+			case err = <-stdinErr:
+			default:
+			}
+			return -1, err
+		}
+		switch id {
+		case wire.ShellIDStdout:
+			_, err = stdout.Write(data)
+		case wire.ShellIDStderr:
+			_, err = stderr.Write(data)
+		case wire.ShellIDExit:
+			if len(data) != 1 {
+				return -1, errors.Errorf(errors.ParseError, "expected 1 byte exit code, got %d bytes", len(data))
+			}
+			return int(data[0]), nil
+		}
+		if err != nil {
+			return -1, errors.WrapErrorf(err, errors.AssertionError, "error writing output of '%s'", cmd)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package adb
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/mqhack/goadb/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunLocalBinary(t *testing.T) {
+	localPath := filepath.Join(t.TempDir(), "runner")
+	require.NoError(t, ioutil.WriteFile(localPath, []byte("\x7fELF"), 0644))
+	s := &MockServer{Status: wire.StatusSuccess, Messages: []string{
+		shellPacket(wire.ShellIDStdout, "running\n") + shellPacket(wire.ShellIDStderr, "1 failure\n") +
+			shellPacket(wire.ShellIDStdout, "done\n") + shellPacket(wire.ShellIDExit, "\x02"),
+		"",
+	}}
+	var stdout, stderr bytes.Buffer
+
+	exitCode, err := v1SyncDevice(s).RunLocalBinary(context.Background(), localPath, []string{"--filter", "a b"},
+		RunBinaryOptions{Stdin: strings.NewReader("in"), Stdout: &stdout, Stderr: &stderr})
+	require.NoError(t, err)
+	assert.Equal(t, 2, exitCode)
+	assert.Equal(t, "running\ndone\n", stdout.String())
+	assert.Equal(t, "1 failure\n", stderr.String())
+
+	remotePath := regexp.MustCompile(`/data/local/tmp/goadb-[0-9a-f]{16}-runner`).FindString(string(s.Written))
+	require.NotEmpty(t, remotePath)
+	assert.True(t, strings.Contains(string(s.Written), remotePath+",493DATA\x04\x00\x00\x00\x7fELFDONE"), "%q", s.Written)
+	assert.Equal(t, "shell,v2,raw:chmod 755 '"+remotePath+"' && '"+remotePath+"' '--filter' 'a b'", s.Requests[3])
+	assert.Equal(t, "shell:rm -f '"+remotePath+"'", s.Requests[5])
+}
+
+func TestRunLocalBinaryMissing(t *testing.T) {
+	s := &MockServer{Status: wire.StatusSuccess}
+	_, err := v1SyncDevice(s).RunLocalBinary(context.Background(), filepath.Join(t.TempDir(), "missing"), nil, RunBinaryOptions{})
+	assert.True(t, HasErrCode(err, FileNoExistError))
+	assert.Empty(t, s.Requests)
+}
+
+func TestRunLocalBinaryCancelled(t *testing.T) {
+	localPath := filepath.Join(t.TempDir(), "runner")
+	require.NoError(t, ioutil.WriteFile(localPath, []byte("\x7fELF"), 0644))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	s := &MockServer{Status: wire.StatusSuccess, Messages: []string{""}}
+
+	_, err := v1SyncDevice(s).RunLocalBinary(ctx, localPath, nil, RunBinaryOptions{})
+	assert.True(t, HasErrCode(err, Timeout), "%v", err)
+	// The file is removed even though it was never run.
+	assert.True(t, strings.HasPrefix(s.Requests[len(s.Requests)-1], "shell:rm -f '/data/local/tmp/goadb-"), "%q", s.Requests)
+}
@@ -0,0 +1,132 @@
+package adb
+
+import (
+	"bufio"
+	"strings"
+	"time"
+
+	"github.com/mqhack/goadb/internal/errors"
+)
+
+// How long WakeUp and Sleep wait for the screen to change state before pressing the power key,
+// and how often they check.
+const (
+	screenStateTimeout      = time.Second
+	screenStatePollInterval = 100 * time.Millisecond
+)
+
+/*
+IsScreenOn returns true if the device is awake, i.e. the screen is on, as reported by
+dumpsys power.
+
+Corresponds to the command:
+
+	adb shell dumpsys power
+*/
+func (c *Device) IsScreenOn() (bool, error) {
+	output, err := c.RunCommand("dumpsys", "power")
+	if err != nil {
+		return false, wrapClientError(err, c, "IsScreenOn")
+	}
+	on, err := parseScreenOn(output)
+	return on, wrapClientError(err, c, "IsScreenOn")
+}
+
+/*
+WakeUp turns the screen on if it's off. It does nothing if the screen is already on.
+
+KEYCODE_WAKEUP is used, since unlike the power key it doesn't toggle the screen. Devices
+older than Android 4.4W ignore it, so the power key is pressed if the screen is still off.
+*/
+func (c *Device) WakeUp() error {
+	return wrapClientError(c.setScreenOn(true), c, "WakeUp")
+}
+
+/*
+Sleep turns the screen off if it's on. It does nothing if the screen is already off.
+
+KEYCODE_SLEEP is used, since unlike the power key it doesn't toggle the screen. Devices older
+than Android 4.4W ignore it, so the power key is pressed if the screen is still on.
+*/
+func (c *Device) Sleep() error {
+	return wrapClientError(c.setScreenOn(false), c, "Sleep")
+}
+
+func (c *Device) setScreenOn(on bool) error {
+	keycode := "KEYCODE_SLEEP"
+	if on {
+		keycode = "KEYCODE_WAKEUP"
+	}
+	if _, err := c.RunCommand("input", "keyevent", keycode); err != nil {
+		return err
+	}
+
+	// The power manager takes a moment to change state, and pressing the power key before it
+	// has would toggle the screen back.
+	deadline := time.Now().Add(screenStateTimeout)
+	for {
+		output, err := c.RunCommand("dumpsys", "power")
+		if err != nil {
+			return err
+		}
+		current, err := parseScreenOn(output)
+		if err != nil || current == on {
+			return err
+		}
+		if time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(screenStatePollInterval)
+	}
+	_, err := c.RunCommand("input", "keyevent", "KEYCODE_POWER")
+	return err
+}
+
+/*
+DismissKeyguard dismisses the lock screen, if it isn't secured with a PIN, pattern or
+password. It should be called after WakeUp, since the keyguard can't be dismissed while the
+screen is off.
+
+Devices older than Android O don't have wm dismiss-keyguard, so the menu key, which dismisses
+the keyguard on those versions, is pressed instead.
+
+Corresponds to the command:
+
+	adb shell wm dismiss-keyguard
+*/
+func (c *Device) DismissKeyguard() error {
+	output, err := c.RunCommand("wm", "dismiss-keyguard")
+	if err != nil {
+		return wrapClientError(err, c, "DismissKeyguard")
+	}
+	if output = strings.TrimSpace(output); output != "" {
+		// wm prints its usage for unknown commands.
+		if !strings.Contains(output, "usage:") && !strings.Contains(output, "Unknown command") {
+			err := errors.Errorf(errors.AdbError, "wm dismiss-keyguard failed: %s", output)
+			return wrapClientError(err, c, "DismissKeyguard")
+		}
+		if _, err := c.RunCommand("input", "keyevent", "KEYCODE_MENU"); err != nil {
+			return wrapClientError(err, c, "DismissKeyguard")
+		}
+	}
+	return nil
+}
+
+// parseScreenOn returns whether the screen is on from the output of dumpsys power. Android L
+// and later report the wakefulness, e.g. "mWakefulness=Awake", and older versions report
+// "mScreenOn=true".
+func parseScreenOn(output string) (bool, error) {
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if value := strings.TrimPrefix(line, "mWakefulness="); value != line {
+			// Dreaming (showing a screensaver) and Dozing (showing an ambient display) both
+			// count as off, since the device isn't interactive.
+			return value == "Awake", nil
+		}
+		if value := strings.TrimPrefix(line, "mScreenOn="); value != line {
+			return value == "true", nil
+		}
+	}
+	return false, errors.Errorf(errors.ParseError, "no screen state in dumpsys power output")
+}
@@ -0,0 +1,59 @@
+package adb
+
+import (
+	"testing"
+
+	"github.com/mqhack/goadb/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseScreenOn(t *testing.T) {
+	for output, expected := range map[string]bool{
+		"POWER MANAGER (dumpsys power)\r\n\r\n  mWakefulness=Awake\r\n": true,
+		"  mWakefulness=Asleep\n": false,
+		"  mWakefulness=Dozing\n": false,
+		"  mScreenOn=true\n":      true,
+		"  mScreenOn=false\n":     false,
+	} {
+		on, err := parseScreenOn(output)
+		require.NoError(t, err, output)
+		assert.Equal(t, expected, on, output)
+	}
+
+	_, err := parseScreenOn("Can't find service: power\n")
+	assert.EqualError(t, err, "ParseError: no screen state in dumpsys power output")
+}
+
+func TestIsScreenOn(t *testing.T) {
+	s := &MockServer{
+		Status:   wire.StatusSuccess,
+		Messages: []string{"  mWakefulness=Awake\n"},
+	}
+	device := (&Adb{server: s}).Device(AnyDevice())
+
+	on, err := device.IsScreenOn()
+	require.NoError(t, err)
+	assert.True(t, on)
+	assert.Equal(t, "shell:dumpsys power", s.Requests[1])
+}
+
+func TestDismissKeyguard(t *testing.T) {
+	s := &MockServer{Status: wire.StatusSuccess}
+	device := (&Adb{server: s}).Device(AnyDevice())
+
+	require.NoError(t, device.DismissKeyguard())
+	assert.Equal(t, []string{"host:transport-any", "shell:wm dismiss-keyguard"}, s.Requests)
+}
+
+func TestDismissKeyguardFailed(t *testing.T) {
+	s := &MockServer{
+		Status:   wire.StatusSuccess,
+		Messages: []string{"Error: SecurityException\n"},
+	}
+	device := (&Adb{server: s}).Device(AnyDevice())
+
+	err := device.DismissKeyguard()
+	assert.True(t, HasErrCode(err, AdbError))
+	assert.Contains(t, ErrorWithCauseChain(err), "wm dismiss-keyguard failed: Error: SecurityException")
+}
@@ -0,0 +1,165 @@
+package adb
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mqhack/goadb/internal/errors"
+)
+
+// MaxScreenrecordTimeLimit is the longest screenrecord will record for.
+const MaxScreenrecordTimeLimit = 3 * time.Minute
+
+// How long screenrecord is given to finish writing the video after being interrupted.
+const screenrecordStopTimeout = 5 * time.Second
+
+// H.264 Annex B streams start with a start code, which begins with two zero bytes.
+var h264StartCodePrefix = []byte{0, 0}
+
+// ScreenrecordOptions configures Device.Screenrecord. The zero value uses screenrecord's
+// defaults.
+type ScreenrecordOptions struct {
+	// BitRate is the video bit rate, in bits per second. Defaults to 20Mbps.
+	BitRate int
+	// Size is the video size, e.g. "1280x720". Defaults to the display's resolution.
+	Size string
+	// TimeLimit is the longest the recording may last, up to MaxScreenrecordTimeLimit,
+	// which is the default. It's rounded down to whole seconds.
+	TimeLimit time.Duration
+	// BugReport adds the timestamp and frame number to each frame, and a summary of the
+	// device at the start.
+	BugReport bool
+	// DisplayID selects the display to record, from ListDisplays. Defaults to the default
+	// display.
+	DisplayID DisplayID
+}
+
+func (opts ScreenrecordOptions) args() []string {
+	args := []string{"--output-format=h264"}
+	if opts.BitRate > 0 {
+		args = append(args, "--bit-rate", strconv.Itoa(opts.BitRate))
+	}
+	if opts.Size != "" {
+		args = append(args, "--size", opts.Size)
+	}
+	if seconds := int(opts.TimeLimit / time.Second); seconds > 0 {
+		args = append(args, "--time-limit", strconv.Itoa(seconds))
+	}
+	if opts.BugReport {
+		args = append(args, "--bugreport")
+	}
+	if opts.DisplayID != 0 {
+		args = append(args, "--display-id", strconv.FormatUint(uint64(opts.DisplayID), 10))
+	}
+	return args
+}
+
+/*
+Screenrecord records the screen and streams the video to w, as a raw H.264 stream, until
+opts.TimeLimit elapses or ctx is done.
+
+When ctx is done, screenrecord is interrupted rather than killed, so it finishes encoding the
+last frames, and Screenrecord returns nil once the stream ends. Requires Android O or later,
+for the h264 output format.
+
+Corresponds to the command:
+
+	adb exec-out screenrecord --output-format=h264 [options] -
+*/
+func (c *Device) Screenrecord(ctx context.Context, w io.Writer, opts ScreenrecordOptions) error {
+	if err := validateScreenrecordOptions(opts); err != nil {
+		return wrapClientError(err, c, "Screenrecord")
+	}
+
+	// exec keeps the PID printed by the shell, so screenrecord can be interrupted.
+	conn, err := c.openExec("echo $$; exec screenrecord " + strings.Join(opts.args(), " ") + " -")
+	if err != nil {
+		return wrapClientError(err, c, "Screenrecord")
+	}
+	defer conn.Close()
+	stopped := make(chan struct{})
+	defer close(stopped)
+
+	output := bufio.NewReader(conn)
+	pid, err := readScreenrecordPID(output)
+	if err != nil {
+		return wrapClientError(err, c, "Screenrecord")
+	}
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.RunCommand("kill", "-INT", pid)
+			select {
+			case <-time.After(screenrecordStopTimeout):
+				conn.Close()
+			case <-stopped:
+			}
+		case <-stopped:
+		}
+	}()
+
+	if err := checkScreenrecordOutput(output); err != nil {
+		return wrapClientError(err, c, "Screenrecord")
+	}
+	if _, err := io.Copy(w, output); err != nil {
+		if _, ok := err.(*errors.Err); !ok {
+			err = errors.WrapErrorf(err, errors.NetworkError, "error streaming screenrecord output")
+		}
+		return wrapClientError(err, c, "Screenrecord")
+	}
+	return nil
+}
+
+func validateScreenrecordOptions(opts ScreenrecordOptions) error {
+	if opts.TimeLimit > MaxScreenrecordTimeLimit {
+		return errors.AssertionErrorf("screenrecord time limit must be at most %s, got %s", MaxScreenrecordTimeLimit, opts.TimeLimit)
+	}
+	if opts.Size != "" && !containsOnly(opts.Size, "0123456789x") {
+		return errors.AssertionErrorf("invalid screenrecord size %q, expected e.g. 1280x720", opts.Size)
+	}
+	return nil
+}
+
+// readScreenrecordPID reads the PID echoed by the shell before screenrecord starts.
+func readScreenrecordPID(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", errors.WrapErrorf(err, errors.NetworkError, "error reading screenrecord PID")
+	}
+	pid := strings.TrimSpace(line)
+	if _, err := strconv.Atoi(pid); err != nil {
+		return "", errors.Errorf(errors.ParseError, "expected screenrecord PID, got %q", pid)
+	}
+	return pid, nil
+}
+
+// checkScreenrecordOutput returns an error containing screenrecord's output if it doesn't
+// start with an H.264 stream, e.g. because screenrecord failed to start.
+func checkScreenrecordOutput(r *bufio.Reader) error {
+	start, err := r.Peek(len(h264StartCodePrefix))
+	if bytes.Equal(start, h264StartCodePrefix) {
+		return nil
+	}
+	if err == io.EOF && len(start) == 0 {
+		// Stopped before any frames were recorded.
+		return nil
+	}
+
+	message, _ := ioutil.ReadAll(io.LimitReader(r, 4096))
+	return errors.Errorf(errors.AdbError, "screenrecord failed: %s", bytes.TrimSpace(message))
+}
+
+func containsOnly(s, chars string) bool {
+	for _, r := range s {
+		if !strings.ContainsRune(chars, r) {
+			return false
+		}
+	}
+	return true
+}
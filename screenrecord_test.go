@@ -0,0 +1,65 @@
+package adb
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mqhack/goadb/internal/errors"
+	"github.com/mqhack/goadb/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScreenrecordOptionsArgs(t *testing.T) {
+	assert.Equal(t, []string{"--output-format=h264"}, ScreenrecordOptions{}.args())
+	assert.Equal(t, []string{
+		"--output-format=h264", "--bit-rate", "4000000", "--size", "1280x720", "--time-limit", "30", "--bugreport",
+		"--display-id", "4619827259835644672",
+	}, ScreenrecordOptions{
+		BitRate:   4000000,
+		Size:      "1280x720",
+		TimeLimit: 30500 * time.Millisecond,
+		BugReport: true,
+		DisplayID: 4619827259835644672,
+	}.args())
+}
+
+func TestScreenrecord(t *testing.T) {
+	video := "\x00\x00\x00\x01\x67video"
+	s := &MockServer{
+		Status:   wire.StatusSuccess,
+		Messages: []string{"1234\n", video},
+	}
+	device := (&Adb{server: s}).Device(AnyDevice())
+
+	var out bytes.Buffer
+	err := device.Screenrecord(context.Background(), &out, ScreenrecordOptions{TimeLimit: 10 * time.Second})
+	require.NoError(t, err)
+	assert.Equal(t, video, out.String())
+	assert.Equal(t, "exec:echo $$; exec screenrecord --output-format=h264 --time-limit 10 -", s.Requests[1])
+}
+
+func TestScreenrecordFailed(t *testing.T) {
+	s := &MockServer{
+		Status:   wire.StatusSuccess,
+		Messages: []string{"1234\n", "ERROR: unable to create video/avc codec\n"},
+	}
+	device := (&Adb{server: s}).Device(AnyDevice())
+
+	var out bytes.Buffer
+	err := device.Screenrecord(context.Background(), &out, ScreenrecordOptions{})
+	assert.True(t, HasErrCode(err, AdbError))
+	assert.Contains(t, errors.ErrorWithCauseChain(err), "screenrecord failed: ERROR: unable to create video/avc codec")
+	assert.Empty(t, out.Bytes())
+}
+
+func TestScreenrecordInvalidOptions(t *testing.T) {
+	device := (&Adb{server: &MockServer{}}).Device(AnyDevice())
+	err := device.Screenrecord(context.Background(), &bytes.Buffer{}, ScreenrecordOptions{TimeLimit: time.Hour})
+	assert.True(t, HasErrCode(err, AssertionError))
+
+	err = device.Screenrecord(context.Background(), &bytes.Buffer{}, ScreenrecordOptions{Size: "720p; rm -rf /"})
+	assert.True(t, HasErrCode(err, AssertionError))
+}
@@ -0,0 +1,164 @@
+package adb
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"strconv"
+
+	"github.com/mqhack/goadb/internal/errors"
+)
+
+// Pixel formats reported in the header of raw screencap output, from
+// android.graphics.PixelFormat.
+const (
+	pixelFormatRGBA8888 = 1
+	pixelFormatRGBX8888 = 2
+	pixelFormatRGB888   = 3
+	pixelFormatRGB565   = 4
+	pixelFormatBGRA8888 = 5
+)
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// ScreenshotOptions configures Device.Screenshot.
+type ScreenshotOptions struct {
+	// DisplayID selects the display to capture, from ListDisplays. Defaults to the default
+	// display.
+	DisplayID DisplayID
+}
+
+/*
+Screenshot captures the screen and returns it decoded, along with the raw data output by
+screencap.
+
+screencap is run with the exec: service, so the data isn't corrupted by LF to CRLF
+translation. It's run without -p, because encoding a PNG on the device is slow; the raw
+data starts with a header giving the width, height and pixel format, followed by the pixels.
+If the device outputs a PNG anyway, it's decoded instead.
+
+Corresponds to the command:
+
+	adb exec-out screencap [-d display-id]
+*/
+func (c *Device) Screenshot(ctx context.Context, opts ScreenshotOptions) (image.Image, []byte, error) {
+	var args []string
+	if opts.DisplayID != 0 {
+		args = append(args, "-d", strconv.FormatUint(uint64(opts.DisplayID), 10))
+	}
+	conn, err := c.openExec("screencap", args...)
+	if err != nil {
+		return nil, nil, wrapClientError(err, c, "Screenshot")
+	}
+	defer conn.Close()
+	stop := closeWhenDone(ctx, conn)
+	defer stop()
+
+	data, err := ioutil.ReadAll(conn)
+	if ctx.Err() != nil {
+		return nil, nil, wrapClientError(errors.WrapErrorf(ctx.Err(), errors.Timeout, "screencap didn't complete"), c, "Screenshot")
+	}
+	if err != nil {
+		return nil, nil, wrapClientError(errors.WrapErrorf(err, errors.NetworkError, "error reading screencap output"), c, "Screenshot")
+	}
+
+	img, err := decodeScreencap(data)
+	return img, data, wrapClientError(err, c, "Screenshot")
+}
+
+// The largest width or height decodeScreencap accepts, so a corrupt header can't overflow
+// the image size.
+const maxScreencapDimension = 16384
+
+// decodeScreencap decodes the output of screencap, with or without -p.
+func decodeScreencap(data []byte) (image.Image, error) {
+	if bytes.HasPrefix(data, pngSignature) {
+		img, err := png.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, errors.WrapErrorf(err, errors.ParseError, "error decoding screencap PNG")
+		}
+		return img, nil
+	}
+
+	// The header is the width, height and format, followed by the dataspace on Android O
+	// and later, each a little-endian uint32. Sizes never use all four bytes, so a header
+	// without any zero bytes is an error message.
+	if len(data) < 12 || bytes.IndexByte(data[:12], 0) < 0 {
+		return nil, errors.Errorf(errors.AdbError, "screencap failed: %s", bytes.TrimSpace(data))
+	}
+	rawWidth := binary.LittleEndian.Uint32(data[0:])
+	rawHeight := binary.LittleEndian.Uint32(data[4:])
+	format := int(binary.LittleEndian.Uint32(data[8:]))
+	bpp, ok := pixelFormatBytes(format)
+	if !ok {
+		return nil, errors.Errorf(errors.ParseError, "unsupported screencap pixel format %d", format)
+	}
+
+	// Checking the dimensions before converting them keeps width*height*bpp from
+	// overflowing, even with 32-bit ints.
+	if rawWidth > maxScreencapDimension || rawHeight > maxScreencapDimension {
+		return nil, errors.Errorf(errors.ParseError, "screencap image %dx%d is larger than the maximum of %dx%d",
+			rawWidth, rawHeight, maxScreencapDimension, maxScreencapDimension)
+	}
+	width, height := int(rawWidth), int(rawHeight)
+	size := width * height * bpp
+	if size > maxFramebufferSize {
+		return nil, errors.Errorf(errors.ParseError, "screencap image size %d is larger than the maximum of %d",
+			size, maxFramebufferSize)
+	}
+	switch len(data) - size {
+	case 12, 16:
+		return decodePixels(data[len(data)-size:], width, height, width*bpp, format), nil
+	default:
+		return nil, errors.Errorf(errors.ParseError, "screencap output is %d bytes, expected a %dx%d image in format %d",
+			len(data), width, height, format)
+	}
+}
+
+// pixelFormatBytes returns the bytes per pixel of format, and false if it's not supported.
+func pixelFormatBytes(format int) (int, bool) {
+	switch format {
+	case pixelFormatRGBA8888, pixelFormatRGBX8888, pixelFormatBGRA8888:
+		return 4, true
+	case pixelFormatRGB888:
+		return 3, true
+	case pixelFormatRGB565:
+		return 2, true
+	default:
+		return 0, false
+	}
+}
+
+// decodePixels converts the pixels of an image in format, with rows stride bytes apart, to
+// an image.Image. The format must be supported by pixelFormatBytes.
+func decodePixels(pixels []byte, width, height, stride, format int) image.Image {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	bpp, _ := pixelFormatBytes(format)
+	for y := 0; y < height; y++ {
+		row := pixels[y*stride:]
+		for x := 0; x < width; x++ {
+			p := row[x*bpp:]
+			var c color.NRGBA
+			switch format {
+			case pixelFormatRGBA8888:
+				c = color.NRGBA{p[0], p[1], p[2], p[3]}
+			case pixelFormatRGBX8888:
+				c = color.NRGBA{p[0], p[1], p[2], 0xff}
+			case pixelFormatBGRA8888:
+				c = color.NRGBA{p[2], p[1], p[0], p[3]}
+			case pixelFormatRGB888:
+				c = color.NRGBA{p[0], p[1], p[2], 0xff}
+			case pixelFormatRGB565:
+				v := binary.LittleEndian.Uint16(p)
+				r, g, b := byte(v>>11), byte(v>>5&0x3f), byte(v&0x1f)
+				c = color.NRGBA{r<<3 | r>>2, g<<2 | g>>4, b<<3 | b>>2, 0xff}
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	return img
+}
@@ -0,0 +1,99 @@
+package adb
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+
+	"github.com/mqhack/goadb/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func screencapHeader(width, height, format uint32, dataspace bool) []byte {
+	fields := []uint32{width, height, format}
+	if dataspace {
+		fields = append(fields, 0)
+	}
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, fields)
+	return buf.Bytes()
+}
+
+func TestDecodeScreencapRGBA(t *testing.T) {
+	data := append(screencapHeader(2, 1, pixelFormatRGBA8888, true), 1, 2, 3, 4, 5, 6, 7, 8)
+	img, err := decodeScreencap(data)
+	require.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 2, 1), img.Bounds())
+	assert.Equal(t, color.NRGBA{1, 2, 3, 4}, img.At(0, 0))
+	assert.Equal(t, color.NRGBA{5, 6, 7, 8}, img.At(1, 0))
+}
+
+func TestDecodeScreencapRGB565(t *testing.T) {
+	// Pure red, then pure blue, with no dataspace in the header.
+	data := append(screencapHeader(1, 2, pixelFormatRGB565, false), 0x00, 0xf8, 0x1f, 0x00)
+	img, err := decodeScreencap(data)
+	require.NoError(t, err)
+	assert.Equal(t, color.NRGBA{0xff, 0, 0, 0xff}, img.At(0, 0))
+	assert.Equal(t, color.NRGBA{0, 0, 0xff, 0xff}, img.At(0, 1))
+}
+
+func TestDecodeScreencapPNG(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 1, 1))
+	src.SetNRGBA(0, 0, color.NRGBA{10, 20, 30, 255})
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, src))
+
+	img, err := decodeScreencap(buf.Bytes())
+	require.NoError(t, err)
+	r, g, b, _ := img.At(0, 0).RGBA()
+	assert.Equal(t, []uint32{10, 20, 30}, []uint32{r >> 8, g >> 8, b >> 8})
+}
+
+func TestDecodeScreencapErrors(t *testing.T) {
+	_, err := decodeScreencap([]byte("screencap: not found\r\n"))
+	assert.EqualError(t, err, "AdbError: screencap failed: screencap: not found")
+
+	_, err = decodeScreencap(screencapHeader(1, 1, 42, true))
+	assert.EqualError(t, err, "ParseError: unsupported screencap pixel format 42")
+
+	_, err = decodeScreencap(append(screencapHeader(2, 2, pixelFormatRGBA8888, true), 1, 2, 3, 4))
+	assert.EqualError(t, err, "ParseError: screencap output is 20 bytes, expected a 2x2 image in format 1")
+
+	_, err = decodeScreencap(screencapHeader(0x80000000, 0x80000000, pixelFormatRGBA8888, false))
+	assert.EqualError(t, err, "ParseError: screencap image 2147483648x2147483648 is larger than the maximum of 16384x16384")
+
+	_, err = decodeScreencap(append(screencapHeader(16384, 16384, pixelFormatRGBA8888, true), 1, 2, 3, 4))
+	assert.EqualError(t, err, "ParseError: screencap image size 1073741824 is larger than the maximum of 132710400")
+}
+
+func TestScreenshot(t *testing.T) {
+	data := append(screencapHeader(1, 1, pixelFormatBGRA8888, true), 1, 2, 3, 4)
+	s := &MockServer{
+		Status:   wire.StatusSuccess,
+		Messages: []string{string(data)},
+	}
+	device := (&Adb{server: s}).Device(AnyDevice())
+
+	img, raw, err := device.Screenshot(context.Background(), ScreenshotOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, data, raw)
+	assert.Equal(t, color.NRGBA{3, 2, 1, 4}, img.At(0, 0))
+	assert.Equal(t, "exec:screencap", s.Requests[1])
+}
+
+func TestScreenshotDisplay(t *testing.T) {
+	s := &MockServer{
+		Status:   wire.StatusSuccess,
+		Messages: []string{string(append(screencapHeader(1, 1, pixelFormatRGBA8888, true), 1, 2, 3, 4))},
+	}
+	device := (&Adb{server: s}).Device(AnyDevice())
+
+	_, _, err := device.Screenshot(context.Background(), ScreenshotOptions{DisplayID: 4619827259835644672})
+	require.NoError(t, err)
+	assert.Equal(t, "exec:screencap -d 4619827259835644672", s.Requests[1])
+}
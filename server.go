@@ -7,6 +7,7 @@ import (
 	"os/exec"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/mqhack/goadb/internal/errors"
 	"github.com/mqhack/goadb/wire"
@@ -31,6 +32,33 @@ type ServerConfig struct {
 	// Dialer used to connect to the adb server.
 	Dialer
 
+	// DeviceListCacheTTL is how long Adb.ListDevices and Adb.ListDeviceSerials reuse the
+	// server's response for. Zero disables the cache.
+	DeviceListCacheTTL time.Duration
+
+	// CompressionPreference lists the names of the compression codecs to use for sync
+	// transfers, most preferred first. Defaults to DefaultCompressionPreference.
+	CompressionPreference []string
+
+	// StrictParsing makes responses from the server that aren't fully understood errors,
+	// instead of being ignored: unknown device states, unexpected device attributes, and
+	// truncated device lists. It's meant for testing against new releases of platform-tools,
+	// to catch changes in the protocol early. Only device lists, from ListDevices,
+	// ListDeviceSerials and DeviceWatcher, are affected: other responses, like forward lists,
+	// connect results and the server version, are errors if they're not understood either way.
+	StrictParsing bool
+
+	// OneDevice restricts the server started by the client to a single device, given by serial
+	// or USB address, with adb --one-device. It has no effect if the server is already
+	// running. Requests for other devices fail with ServerRestricted.
+	OneDevice string
+
+	// Resolver, if set, resolves host names passed to Adb.Connect on the client, and connects
+	// to the address it returns. By default, host names are resolved by the server, which
+	// can't see names that only the client's DNS knows, e.g. when the server runs on another
+	// machine. *net.Resolver implements it.
+	Resolver Resolver
+
 	fs *filesystem
 }
 
@@ -110,7 +138,11 @@ func (s *realServer) Dial() (*wire.Conn, error) {
 
 // StartServer ensures there is a server running.
 func (s *realServer) Start() error {
-	output, err := s.config.fs.CmdCombinedOutput(s.config.PathToAdb, "-L", fmt.Sprintf("tcp:%s", s.address), "start-server")
+	args := []string{"-L", fmt.Sprintf("tcp:%s", s.address)}
+	if s.config.OneDevice != "" {
+		args = append(args, "--one-device", s.config.OneDevice)
+	}
+	output, err := s.config.fs.CmdCombinedOutput(s.config.PathToAdb, append(args, "start-server")...)
 	outputStr := strings.TrimSpace(string(output))
 	return errors.WrapErrorf(err, errors.ServerNotAvailable, "error starting server: %s\noutput:\n%s", err, outputStr)
 }
@@ -3,13 +3,19 @@ package adb
 import (
 	"io"
 	"strings"
+	"sync"
 
 	"github.com/mqhack/goadb/internal/errors"
 	"github.com/mqhack/goadb/wire"
 )
 
 // MockServer implements Server, Scanner, and Sender.
+// Sync and shell protocol scanners and senders read and write the raw stream (see Read and
+// Write), so Messages can contain encoded sync responses or shell packets.
 type MockServer struct {
+	// Guards everything below, so that raw reads and writes may be done concurrently.
+	mu sync.Mutex
+
 	// Each time an operation is performed, if this slice is non-empty, the head element
 	// of this slice is returned and removed from the slice. If the head is nil, it is removed
 	// but not returned.
@@ -20,10 +26,18 @@ type MockServer struct {
 	// Messages are returned from read calls in order, each preceded by a length header.
 	Messages     []string
 	nextMsgIndex int
+	// If true, each ReadUntilEof call returns only the next message, so consecutive commands
+	// can be given different output.
+	SeparateOutputs bool
+	// Remainder of the message currently being consumed by raw Read calls.
+	pendingRead []byte
 
 	// Each message passed to a send call is appended to this slice.
 	Requests []string
 
+	// All data passed to raw Write calls.
+	Written []byte
+
 	// Each time an operation is performed, its name is appended to this slice.
 	Trace []string
 }
@@ -31,6 +45,8 @@ type MockServer struct {
 var _ server = &MockServer{}
 
 func (s *MockServer) Dial() (*wire.Conn, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	s.logMethod("Dial")
 	if err := s.getNextErrToReturn(); err != nil {
 		return nil, err
@@ -39,11 +55,15 @@ func (s *MockServer) Dial() (*wire.Conn, error) {
 }
 
 func (s *MockServer) Start() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	s.logMethod("Start")
 	return nil
 }
 
 func (s *MockServer) ReadStatus(req string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	s.logMethod("ReadStatus")
 	if err := s.getNextErrToReturn(); err != nil {
 		return "", err
@@ -52,6 +72,8 @@ func (s *MockServer) ReadStatus(req string) (string, error) {
 }
 
 func (s *MockServer) ReadMessage() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	s.logMethod("ReadMessage")
 	if err := s.getNextErrToReturn(); err != nil {
 		return nil, err
@@ -65,11 +87,18 @@ func (s *MockServer) ReadMessage() ([]byte, error) {
 }
 
 func (s *MockServer) ReadUntilEof() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	s.logMethod("ReadUntilEof")
 	if err := s.getNextErrToReturn(); err != nil {
 		return nil, err
 	}
 
+	if s.SeparateOutputs && s.nextMsgIndex < len(s.Messages) {
+		s.nextMsgIndex++
+		return []byte(s.Messages[s.nextMsgIndex-1]), nil
+	}
+
 	var data []string
 	for ; s.nextMsgIndex < len(s.Messages); s.nextMsgIndex++ {
 		data = append(data, s.Messages[s.nextMsgIndex])
@@ -77,7 +106,40 @@ func (s *MockServer) ReadUntilEof() ([]byte, error) {
 	return []byte(strings.Join(data, "")), nil
 }
 
+// Read returns the remaining messages as a raw stream, without length headers.
+func (s *MockServer) Read(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.logMethod("Read")
+	if err := s.getNextErrToReturn(); err != nil {
+		return 0, err
+	}
+	for len(s.pendingRead) == 0 {
+		if s.nextMsgIndex >= len(s.Messages) {
+			return 0, io.EOF
+		}
+		s.pendingRead = []byte(s.Messages[s.nextMsgIndex])
+		s.nextMsgIndex++
+	}
+	n := copy(p, s.pendingRead)
+	s.pendingRead = s.pendingRead[n:]
+	return n, nil
+}
+
+func (s *MockServer) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.logMethod("Write")
+	if err := s.getNextErrToReturn(); err != nil {
+		return 0, err
+	}
+	s.Written = append(s.Written, p...)
+	return len(p), nil
+}
+
 func (s *MockServer) SendMessage(msg []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	s.logMethod("SendMessage")
 	if err := s.getNextErrToReturn(); err != nil {
 		return err
@@ -87,16 +149,46 @@ func (s *MockServer) SendMessage(msg []byte) error {
 }
 
 func (s *MockServer) NewSyncScanner() wire.SyncScanner {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	s.logMethod("NewSyncScanner")
-	return nil
+	return wire.NewSyncScanner(rawReader{s})
 }
 
 func (s *MockServer) NewSyncSender() wire.SyncSender {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	s.logMethod("NewSyncSender")
-	return nil
+	return wire.NewSyncSender(rawWriter{s})
 }
 
+func (s *MockServer) NewShellScanner() wire.ShellScanner {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.logMethod("NewShellScanner")
+	return wire.NewShellScanner(rawReader{s})
+}
+
+func (s *MockServer) NewShellSender() wire.ShellSender {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.logMethod("NewShellSender")
+	return wire.NewShellSender(rawWriter{s})
+}
+
+// rawReader and rawWriter hide MockServer's Close method from the sync and shell protocol
+// types, so closing a SyncConn or ShellConn doesn't log an extra Close.
+type rawReader struct{ s *MockServer }
+
+func (r rawReader) Read(p []byte) (int, error) { return r.s.Read(p) }
+
+type rawWriter struct{ s *MockServer }
+
+func (w rawWriter) Write(p []byte) (int, error) { return w.s.Write(p) }
+
 func (s *MockServer) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	s.logMethod("Close")
 	if err := s.getNextErrToReturn(); err != nil {
 		return err
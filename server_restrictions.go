@@ -0,0 +1,183 @@
+package adb
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/mqhack/goadb/internal/errors"
+)
+
+// ServerRestrictions are limits the adb server was started with, that affect which devices
+// clients can use.
+type ServerRestrictions struct {
+	// OneDevice is the device the server was restricted to with adb --one-device, either a
+	// serial or a USB address like "usb:1-1". Empty if the server isn't restricted.
+	OneDevice string
+}
+
+// Restricted returns true if the server only allows access to some devices.
+func (r *ServerRestrictions) Restricted() bool {
+	return r.OneDevice != ""
+}
+
+// Allows returns true if the server allows access to the device with serial. Devices
+// restricted by USB address can only be checked by the server, so they're always allowed.
+func (r *ServerRestrictions) Allows(serial string) bool {
+	return r.OneDevice == "" || r.OneDevice == serial || strings.HasPrefix(r.OneDevice, "usb:")
+}
+
+// serverRestrictions holds the restrictions of an Adb's server, which its devices check
+// before making requests.
+type serverRestrictions struct {
+	// From ServerConfig.OneDevice.
+	configured string
+
+	// The *ServerRestrictions last detected by Adb.ServerRestrictions.
+	detected atomic.Value
+}
+
+func newServerRestrictions(oneDevice string) *serverRestrictions {
+	return &serverRestrictions{configured: oneDevice}
+}
+
+func (r *serverRestrictions) current() *ServerRestrictions {
+	if r == nil {
+		return &ServerRestrictions{}
+	}
+	if r.configured != "" {
+		return &ServerRestrictions{OneDevice: r.configured}
+	}
+	if detected, ok := r.detected.Load().(*ServerRestrictions); ok {
+		return detected
+	}
+	return &ServerRestrictions{}
+}
+
+/*
+ServerRestrictions returns the limits the server was started with.
+
+If ServerConfig.OneDevice is set, the server is assumed to have been started with it.
+Otherwise, the restrictions are read from the command line of the server process, which is
+only supported for servers running on this host on Linux. Elsewhere the server is reported as
+unrestricted, and requests for other devices fail with DeviceNotFound.
+
+Once detected, devices of this client fail requests for devices the server doesn't allow with
+ServerRestricted, without contacting the server.
+*/
+func (c *Adb) ServerRestrictions() (*ServerRestrictions, error) {
+	restrictions := c.serverRestrictions()
+	if restrictions.configured != "" || !isLocalServer(c.server) || runtime.GOOS != "linux" {
+		return restrictions.current(), nil
+	}
+
+	detected, err := detectServerRestrictions(serverPort(c.server))
+	if err != nil {
+		return nil, wrapClientError(err, c, "ServerRestrictions")
+	}
+	restrictions.detected.Store(detected)
+	return detected, nil
+}
+
+// serverRestrictions returns the restrictions shared with the client's devices, creating them
+// if the client wasn't created by NewWithConfig.
+func (c *Adb) serverRestrictions() *serverRestrictions {
+	if c.restrictions == nil {
+		c.restrictions = newServerRestrictions("")
+	}
+	return c.restrictions
+}
+
+// checkServerRestrictions returns a ServerRestricted error if the server doesn't allow access
+// to the device.
+func (c *Device) checkServerRestrictions() error {
+	if c.descriptor.descriptorType != DeviceSerial {
+		return nil
+	}
+	if restrictions := c.restrictions.current(); !restrictions.Allows(c.descriptor.serial) {
+		return errors.Errorf(errors.ServerRestricted,
+			"server only allows access to device %s", restrictions.OneDevice)
+	}
+	return nil
+}
+
+// serverPort returns the port of the local server s.
+func serverPort(s server) int {
+	if ts, ok := s.(*transcribingServer); ok {
+		s = ts.server
+	}
+	if rs, ok := s.(*realServer); ok {
+		return rs.config.Port
+	}
+	return AdbPort
+}
+
+// detectServerRestrictions finds the adb server listening on port in /proc, and returns the
+// restrictions on its command line.
+func detectServerRestrictions(port int) (*ServerRestrictions, error) {
+	cmdlines, err := filepath.Glob("/proc/[0-9]*/cmdline")
+	if err != nil {
+		return nil, errors.WrapErrorf(err, errors.AssertionError, "error listing processes")
+	}
+	for _, path := range cmdlines {
+		// Processes may exit, or belong to other users, while they're being listed.
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		args := strings.Split(string(bytes.TrimRight(data, "\x00")), "\x00")
+		if restrictions, ok := parseServerCommandLine(args, port); ok {
+			return restrictions, nil
+		}
+	}
+	return nil, errors.Errorf(errors.ServerNotAvailable, "no adb server process for port %d", port)
+}
+
+// parseServerCommandLine returns the restrictions of the adb server with the command line
+// args, or false if args isn't the command line of a server listening on port. The client
+// starts the server with a command line like
+//
+//	adb -L tcp:5037 --one-device 2B121FDH2004M1 fork-server server --reply-fd 4
+func parseServerCommandLine(args []string, port int) (*ServerRestrictions, bool) {
+	if len(args) == 0 || filepath.Base(args[0]) != AdbExecutableName {
+		return nil, false
+	}
+
+	isServer := false
+	serverPort := AdbPort
+	restrictions := &ServerRestrictions{}
+	for i := 1; i < len(args); i++ {
+		var value string
+		if i+1 < len(args) {
+			value = args[i+1]
+		}
+		switch args[i] {
+		case "server", "fork-server":
+			isServer = true
+		case "-L":
+			// The socket spec is tcp:<port> or tcp:<host>:<port>.
+			if j := strings.LastIndex(value, ":"); strings.HasPrefix(value, "tcp:") && j >= 0 {
+				if n, err := strconv.Atoi(value[j+1:]); err == nil {
+					serverPort = n
+				}
+			}
+			i++
+		case "-P":
+			if n, err := strconv.Atoi(value); err == nil {
+				serverPort = n
+			}
+			i++
+		case "--one-device":
+			restrictions.OneDevice = value
+			i++
+		}
+	}
+	if !isServer || serverPort != port {
+		return nil, false
+	}
+	return restrictions, true
+}
@@ -0,0 +1,76 @@
+package adb
+
+import (
+	"testing"
+
+	"github.com/mqhack/goadb/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseServerCommandLine(t *testing.T) {
+	restrictions, ok := parseServerCommandLine([]string{
+		"/opt/platform-tools/adb", "-L", "tcp:5037", "--one-device", "SERIAL", "fork-server", "server", "--reply-fd", "4",
+	}, AdbPort)
+	require.True(t, ok)
+	assert.Equal(t, &ServerRestrictions{OneDevice: "SERIAL"}, restrictions)
+	assert.True(t, restrictions.Restricted())
+
+	restrictions, ok = parseServerCommandLine([]string{"adb", "-L", "tcp:localhost:5038", "fork-server", "server"}, 5038)
+	require.True(t, ok)
+	assert.False(t, restrictions.Restricted())
+
+	_, ok = parseServerCommandLine([]string{"adb", "-L", "tcp:5038", "fork-server", "server"}, AdbPort)
+	assert.False(t, ok)
+	_, ok = parseServerCommandLine([]string{"adb", "--one-device", "SERIAL", "start-server"}, AdbPort)
+	assert.False(t, ok)
+	_, ok = parseServerCommandLine([]string{"bash"}, AdbPort)
+	assert.False(t, ok)
+}
+
+func TestServerRestrictionsAllows(t *testing.T) {
+	assert.True(t, (&ServerRestrictions{}).Allows("SERIAL"))
+	assert.True(t, (&ServerRestrictions{OneDevice: "SERIAL"}).Allows("SERIAL"))
+	assert.False(t, (&ServerRestrictions{OneDevice: "SERIAL"}).Allows("OTHER"))
+	assert.True(t, (&ServerRestrictions{OneDevice: "usb:1-1"}).Allows("OTHER"))
+}
+
+func TestDeviceServerRestricted(t *testing.T) {
+	s := &MockServer{Status: wire.StatusSuccess, Messages: []string{"output"}}
+	client := &Adb{server: s, restrictions: newServerRestrictions("SERIAL")}
+
+	_, err := client.Device(DeviceWithSerial("OTHER")).RunCommand("ls")
+	assert.True(t, HasErrCode(err, ServerRestricted))
+	assert.Contains(t, ErrorWithCauseChain(err), "server only allows access to device SERIAL")
+	_, err = client.Device(DeviceWithSerial("OTHER")).DevicePath()
+	assert.True(t, HasErrCode(err, ServerRestricted))
+	assert.Empty(t, s.Requests)
+
+	output, err := client.Device(DeviceWithSerial("SERIAL")).RunCommand("ls")
+	require.NoError(t, err)
+	assert.Equal(t, "output", output)
+
+	restrictions, err := client.ServerRestrictions()
+	require.NoError(t, err)
+	assert.Equal(t, "SERIAL", restrictions.OneDevice)
+}
+
+func TestServerStartOneDevice(t *testing.T) {
+	var startArgs []string
+	server := &realServer{
+		config: ServerConfig{
+			PathToAdb: "/bin/adb",
+			OneDevice: "SERIAL",
+			fs: &filesystem{
+				CmdCombinedOutput: func(name string, arg ...string) ([]byte, error) {
+					startArgs = arg
+					return nil, nil
+				},
+			},
+		},
+		address: "localhost:5037",
+	}
+
+	require.NoError(t, server.Start())
+	assert.Equal(t, []string{"-L", "tcp:localhost:5037", "--one-device", "SERIAL", "start-server"}, startArgs)
+}
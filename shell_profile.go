@@ -0,0 +1,151 @@
+package adb
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/mqhack/goadb/internal/errors"
+	"github.com/mqhack/goadb/internal/random"
+	"github.com/mqhack/goadb/wire"
+)
+
+/*
+ShellProfile is a script that's sourced before every command a Device runs, so commands
+can rely on tools that some vendor builds are missing, by pushing toybox or busybox to the
+device and putting it on the PATH.
+*/
+type ShellProfile struct {
+	// Path is a list of directories prepended to PATH, in order.
+	Path []string
+
+	// Aliases maps command names to the shell code that runs them, e.g. "md5sum" to
+	// "busybox md5sum". They're defined as functions, which are passed on any arguments,
+	// since aliases aren't expanded in commands on the same line as the profile.
+	Aliases map[string]string
+
+	// Script is arbitrary shell code run after the PATH and aliases are set up.
+	Script string
+}
+
+// render returns the profile as a shell script.
+func (p *ShellProfile) render() string {
+	var script strings.Builder
+	if len(p.Path) > 0 {
+		quoted := make([]string, len(p.Path))
+		for i, dir := range p.Path {
+			quoted[i] = shellQuote(dir)
+		}
+		fmt.Fprintf(&script, "export PATH=%s:\"$PATH\"\n", strings.Join(quoted, ":"))
+	}
+
+	names := make([]string, 0, len(p.Aliases))
+	for name := range p.Aliases {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(&script, "%s() { %s \"$@\"; }\n", name, p.Aliases[name])
+	}
+
+	if p.Script != "" {
+		script.WriteString(p.Script)
+		if !strings.HasSuffix(p.Script, "\n") {
+			script.WriteString("\n")
+		}
+	}
+	return script.String()
+}
+
+/*
+SetShellProfile pushes profile to a file in /data/local/tmp on the device, and makes every
+command run by this Device (by RunCommand, OpenShell, OpenExec, and the helpers built on
+them) source it first. Commands run by other Device values for the same device are
+unaffected. Each Device stages its profile at its own path, which is deleted when the Device
+is closed.
+
+Passing nil stops sourcing the profile, but doesn't delete it from the device.
+*/
+func (c *Device) SetShellProfile(profile *ShellProfile) error {
+	if profile == nil {
+		c.shellProfile.Store((*stagedShellProfile)(nil))
+		return nil
+	}
+
+	path := c.shellProfilePath()
+	w, err := c.OpenWrite(path, wire.DefaultFilePerms, MtimeOfClose)
+	if err != nil {
+		return wrapClientError(err, c, "SetShellProfile")
+	}
+	if _, err := w.Write([]byte(profile.render())); err != nil {
+		w.Close()
+		return wrapClientError(err, c, "SetShellProfile")
+	}
+	if err := w.Close(); err != nil {
+		return wrapClientError(err, c, "SetShellProfile")
+	}
+
+	c.shellProfile.Store(&stagedShellProfile{profile: profile, path: path})
+	return nil
+}
+
+// stagedShellProfile is a profile set by SetShellProfile and where it was pushed.
+type stagedShellProfile struct {
+	profile *ShellProfile
+	path    string
+}
+
+// shellProfilePath returns the path this Device stages its profile at, choosing it the first
+// time it's called. Closing the Device stops sourcing the profile and deletes it.
+func (c *Device) shellProfilePath() string {
+	c.resources.mu.Lock()
+	defer c.resources.mu.Unlock()
+	if c.resources.profilePath != "" {
+		return c.resources.profilePath
+	}
+
+	path := fmt.Sprintf("%s/goadb_profile_%s.sh", deviceTempDirParent, random.ID())
+	c.resources.profilePath = path
+	c.resources.cleanups = append(c.resources.cleanups, func() error {
+		c.shellProfile.Store((*stagedShellProfile)(nil))
+		output, err := c.RunCommand("rm -f " + shellQuote(path))
+		if err != nil {
+			return err
+		}
+		if output = strings.TrimSpace(output); output != "" {
+			return errors.Errorf(errors.AdbError, "error removing %s: %s", path, output)
+		}
+		return nil
+	})
+	return path
+}
+
+// getStagedShellProfile returns the profile set by SetShellProfile, or nil if there isn't one.
+func (c *Device) getStagedShellProfile() *stagedShellProfile {
+	staged, _ := c.shellProfile.Load().(*stagedShellProfile)
+	return staged
+}
+
+// getShellProfile returns the profile set by SetShellProfile, or nil if there isn't one.
+func (c *Device) getShellProfile() *ShellProfile {
+	if staged := c.getStagedShellProfile(); staged != nil {
+		return staged.profile
+	}
+	return nil
+}
+
+// commandLine prepares the command line for cmd and args like prepareCommandLine, and
+// prefixes it with the command priority and shell profile, if they've been set.
+func (c *Device) commandLine(cmd string, args ...string) (string, error) {
+	cmd, err := prepareCommandLine(cmd, args...)
+	if err != nil {
+		return "", err
+	}
+	if staged := c.getStagedShellProfile(); staged != nil {
+		cmd = ". " + shellQuote(staged.path) + "; " + cmd
+	}
+	if priority := c.getCommandPriority(); priority != nil {
+		cmd = priority.render() + cmd
+	}
+	return cmd, nil
+}
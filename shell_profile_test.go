@@ -0,0 +1,63 @@
+package adb
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mqhack/goadb/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderShellProfile(t *testing.T) {
+	profile := &ShellProfile{
+		Path: []string{"/data/local/tmp/bin", "/data/local/tmp/my tools"},
+		Aliases: map[string]string{
+			"tar":    "busybox tar",
+			"md5sum": "busybox md5sum",
+		},
+		Script: "umask 022",
+	}
+	assert.Equal(t, "export PATH='/data/local/tmp/bin':'/data/local/tmp/my tools':\"$PATH\"\n"+
+		"md5sum() { busybox md5sum \"$@\"; }\n"+
+		"tar() { busybox tar \"$@\"; }\n"+
+		"umask 022\n", profile.render())
+
+	assert.Equal(t, "", (&ShellProfile{}).render())
+}
+
+func TestSetShellProfile(t *testing.T) {
+	s := &MockServer{
+		Status:   wire.StatusSuccess,
+		Messages: []string{"OKAY\x00\x00\x00\x00", "output"},
+	}
+	device := (&Adb{server: s}).Device(AnyDevice())
+
+	require.NoError(t, device.SetShellProfile(&ShellProfile{Path: []string{"/data/local/tmp/bin"}}))
+	path := device.getStagedShellProfile().path
+	assert.Regexp(t, `^/data/local/tmp/goadb_profile_[0-9a-f]{16}\.sh$`, path)
+	assert.True(t, strings.Contains(string(s.Written), path), string(s.Written))
+	assert.True(t, strings.Contains(string(s.Written), "export PATH='/data/local/tmp/bin':\"$PATH\"\n"), string(s.Written))
+	other := (&Adb{server: s}).Device(AnyDevice())
+	assert.NotEqual(t, path, other.shellProfilePath())
+
+	_, err := device.RunCommand("ls", "/sdcard")
+	require.NoError(t, err)
+	assert.Equal(t, "shell:. '"+path+"'; ls /sdcard", s.Requests[len(s.Requests)-1])
+
+	require.NoError(t, device.SetShellProfile(nil))
+	_, err = device.RunCommand("ls")
+	require.NoError(t, err)
+	assert.Equal(t, "shell:ls", s.Requests[len(s.Requests)-1])
+}
+
+func TestShellProfileRemovedOnClose(t *testing.T) {
+	s := &MockServer{Status: wire.StatusSuccess}
+	device := (&Adb{server: s}).Device(AnyDevice())
+
+	require.NoError(t, device.SetShellProfile(&ShellProfile{Path: []string{"/data/local/tmp/bin"}}))
+	path := device.getStagedShellProfile().path
+	require.NoError(t, device.Close())
+	assert.Equal(t, "shell:rm -f '"+path+"'", s.Requests[len(s.Requests)-1])
+	assert.Nil(t, device.getShellProfile())
+}
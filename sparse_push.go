@@ -0,0 +1,108 @@
+package adb
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/mqhack/goadb/internal/errors"
+)
+
+const (
+	// The block size PushSparse writes regions with. Regions start on a multiple of it, which
+	// holes found by seeking already do on file systems with blocks of this size or bigger.
+	sparseBlockSize = 4096
+	// Holes smaller than this are pushed as zeros, since each region costs a command.
+	sparseMinHole = 1 << 20
+)
+
+// fileRegion is the bytes [start, end) of a file.
+type fileRegion struct {
+	start, end int64
+}
+
+/*
+PushSparse pushes the file at localPath to remotePath like Push, but only sends the regions
+of the file that hold data, leaving its holes as holes in the remote file. Pushing a mostly
+empty file system image, e.g. an ext4 or f2fs image made by make_ext4fs or mkfs, this sends a
+fraction of its size. It returns the number of bytes sent.
+
+The holes are found with SEEK_DATA and SEEK_HOLE, so on platforms or file systems that don't
+report them, the whole file is sent. The remote file is created at the full size with
+truncate, and each region is written into it with dd over the shell protocol, which requires
+Android N or later. The remote file gets the local file's permissions, and the current time as
+its modification time. If ctx is done, the error has code Timeout and the remote file is left
+partly written.
+*/
+func (c *Device) PushSparse(ctx context.Context, localPath, remotePath string) (int64, error) {
+	sent, err := c.pushSparse(ctx, localPath, remotePath)
+	return sent, wrapClientError(err, c, "PushSparse(%s)", remotePath)
+}
+
+func (c *Device) pushSparse(ctx context.Context, localPath, remotePath string) (int64, error) {
+	local, err := os.Open(localPath)
+	if err != nil {
+		return 0, wrapLocalFileError(err, localPath)
+	}
+	defer local.Close()
+	info, err := local.Stat()
+	if err != nil {
+		return 0, wrapLocalFileError(err, localPath)
+	}
+	regions, err := sparseRegions(local, info.Size())
+	if err != nil {
+		return 0, wrapLocalFileError(err, localPath)
+	}
+
+	quoted := shellQuote(remotePath)
+	if err := c.runSparseStep(ctx, fmt.Sprintf("rm -f %s && truncate -s %d %s && chmod %04o %s",
+		quoted, info.Size(), quoted, info.Mode().Perm(), quoted), nil); err != nil {
+		return 0, err
+	}
+
+	var sent int64
+	for _, region := range regions {
+		cmd := "dd of=" + quoted + " bs=" + strconv.Itoa(sparseBlockSize) +
+			" seek=" + strconv.FormatInt(region.start/sparseBlockSize, 10) + " conv=notrunc"
+		if err := c.runSparseStep(ctx, cmd, io.NewSectionReader(local, region.start, region.end-region.start)); err != nil {
+			return sent, err
+		}
+		sent += region.end - region.start
+	}
+	return sent, nil
+}
+
+// runSparseStep runs cmd with stdin, and returns the error it printed if it fails.
+func (c *Device) runSparseStep(ctx context.Context, cmd string, stdin io.Reader) error {
+	result, err := c.RunCommandResult(ctx, cmd, CommandOptions{Stdin: stdin})
+	if err != nil {
+		return err
+	}
+	if result.ExitCode != 0 {
+		output := strings.TrimSpace(result.Stderr + result.Stdout)
+		return errors.Errorf(fsErrorCode(output), "'%s' exited with code %d: %s", cmd, result.ExitCode, output)
+	}
+	return nil
+}
+
+// sparseRegions returns the regions of the file of the given size that hold data, starting on
+// multiples of sparseBlockSize, with holes smaller than sparseMinHole filled in.
+func sparseRegions(f *os.File, size int64) ([]fileRegion, error) {
+	found, err := dataRegions(f, size)
+	if err != nil {
+		return nil, err
+	}
+	var regions []fileRegion
+	for _, region := range found {
+		region.start -= region.start % sparseBlockSize
+		if n := len(regions); n > 0 && region.start-regions[n-1].end < sparseMinHole {
+			regions[n-1].end = region.end
+		} else {
+			regions = append(regions, region)
+		}
+	}
+	return regions, nil
+}
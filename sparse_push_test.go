@@ -0,0 +1,81 @@
+package adb
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mqhack/goadb/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeSparseFile writes a 16MiB file with 4KiB of data at the start and 10 bytes at 8MiB+100,
+// and skips the test if the file system doesn't report its holes.
+func writeSparseFile(t *testing.T) string {
+	localPath := filepath.Join(t.TempDir(), "system.img")
+	f, err := os.Create(localPath)
+	require.NoError(t, err)
+	defer f.Close()
+	_, err = f.Write([]byte(strings.Repeat("a", 4096)))
+	require.NoError(t, err)
+	_, err = f.WriteAt([]byte(strings.Repeat("b", 10)), 8<<20+100)
+	require.NoError(t, err)
+	require.NoError(t, f.Truncate(16<<20))
+
+	regions, err := dataRegions(f, 16<<20)
+	require.NoError(t, err)
+	if len(regions) == 1 && regions[0] == (fileRegion{0, 16 << 20}) {
+		t.Skip("file system doesn't report holes")
+	}
+	return localPath
+}
+
+func TestSparseRegions(t *testing.T) {
+	f, err := os.Open(writeSparseFile(t))
+	require.NoError(t, err)
+	defer f.Close()
+
+	regions, err := sparseRegions(f, 16<<20)
+	require.NoError(t, err)
+	require.Len(t, regions, 2)
+	assert.Equal(t, int64(0), regions[0].start)
+	assert.True(t, regions[0].end >= 4096 && regions[0].end < 8<<20, "%v", regions)
+	assert.Equal(t, int64(0), regions[1].start%sparseBlockSize)
+	assert.True(t, regions[1].start <= 8<<20+100 && regions[1].end >= 8<<20+110 && regions[1].end <= 16<<20, "%v", regions)
+}
+
+func TestSparseRegionsEmptyFile(t *testing.T) {
+	dir := t.TempDir()
+	f, err := os.Create(filepath.Join(dir, "empty"))
+	require.NoError(t, err)
+	defer f.Close()
+	regions, err := sparseRegions(f, 0)
+	require.NoError(t, err)
+	assert.Empty(t, regions)
+}
+
+func TestPushSparse(t *testing.T) {
+	localPath := writeSparseFile(t)
+	exited := shellPacket(wire.ShellIDExit, "\x00")
+	s := &MockServer{Status: wire.StatusSuccess, Messages: []string{exited, exited, exited}}
+
+	sent, err := (&Adb{server: s}).Device(AnyDevice()).PushSparse(context.Background(), localPath, "/data/local/tmp/system.img")
+	require.NoError(t, err)
+	assert.True(t, sent < 8<<20, "sent %d bytes", sent)
+	assert.Equal(t, "shell,v2,raw:rm -f '/data/local/tmp/system.img' && truncate -s 16777216 '/data/local/tmp/system.img' && "+
+		"chmod 0644 '/data/local/tmp/system.img'", s.Requests[1])
+	assert.Equal(t, "shell,v2,raw:dd of='/data/local/tmp/system.img' bs=4096 seek=0 conv=notrunc", s.Requests[3])
+	assert.Equal(t, "shell,v2,raw:dd of='/data/local/tmp/system.img' bs=4096 seek=2048 conv=notrunc", s.Requests[5])
+}
+
+func TestPushSparseFails(t *testing.T) {
+	localPath := writeSparseFile(t)
+	s := &MockServer{Status: wire.StatusSuccess, Messages: []string{
+		shellPacket(wire.ShellIDStderr, "truncate: /system/x.img: Read-only file system\n") + shellPacket(wire.ShellIDExit, "\x01"),
+	}}
+	_, err := (&Adb{server: s}).Device(AnyDevice()).PushSparse(context.Background(), localPath, "/system/x.img")
+	assert.True(t, HasErrCode(err, ReadOnlyFileSystem), "%v", err)
+}
@@ -0,0 +1,41 @@
+//go:build darwin || freebsd || linux
+// +build darwin freebsd linux
+
+package adb
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// dataRegions returns the regions of the file of the given size that hold data, by seeking
+// over its holes.
+func dataRegions(f *os.File, size int64) ([]fileRegion, error) {
+	fd := int(f.Fd())
+	var regions []fileRegion
+	for offset := int64(0); offset < size; {
+		start, err := unix.Seek(fd, offset, unix.SEEK_DATA)
+		if err == unix.ENXIO {
+			// There's no more data, only a hole to the end of the file.
+			break
+		}
+		if err == unix.EINVAL && offset == 0 {
+			// The file system doesn't report holes.
+			return []fileRegion{{0, size}}, nil
+		}
+		if err != nil {
+			return nil, &os.PathError{Op: "seek", Path: f.Name(), Err: err}
+		}
+		end, err := unix.Seek(fd, start, unix.SEEK_HOLE)
+		if err != nil {
+			return nil, &os.PathError{Op: "seek", Path: f.Name(), Err: err}
+		}
+		if end > size {
+			end = size
+		}
+		regions = append(regions, fileRegion{start, end})
+		offset = end
+	}
+	return regions, nil
+}
@@ -1,17 +1,19 @@
 package adb
 
 import (
-	"github.com/mqhack/goadb/internal/errors"
-	"github.com/mqhack/goadb/wire"
+	"fmt"
 	"io"
 	"os"
 	"time"
+
+	"github.com/mqhack/goadb/internal/errors"
+	"github.com/mqhack/goadb/wire"
 )
 
 var zeroTime = time.Unix(0, 0).UTC()
 
 func stat(conn *wire.SyncConn, path string) (*DirEntry, error) {
-	if err := conn.SendOctetString("STAT"); err != nil {
+	if err := conn.SendOctetString(wire.SyncIDStat); err != nil {
 		return nil, err
 	}
 	if err := conn.SendBytes([]byte(path)); err != nil {
@@ -22,15 +24,42 @@ func stat(conn *wire.SyncConn, path string) (*DirEntry, error) {
 	if err != nil {
 		return nil, err
 	}
-	if id != "STAT" {
+	if id != wire.SyncIDStat {
 		return nil, errors.Errorf(errors.AssertionError, "expected stat ID 'STAT', but got '%s'", id)
 	}
 
 	return readStat(conn)
 }
 
+// lstatV2 is stat using the v2 request, which reports 64-bit sizes and the file's owner.
+func lstatV2(conn *wire.SyncConn, path string) (*DirEntry, error) {
+	if err := conn.SendOctetString(wire.SyncIDLstatV2); err != nil {
+		return nil, err
+	}
+	if err := conn.SendBytes([]byte(path)); err != nil {
+		return nil, err
+	}
+
+	id, err := conn.ReadStatus("stat")
+	if err != nil {
+		return nil, err
+	}
+	if id != wire.SyncIDLstatV2 {
+		return nil, errors.Errorf(errors.AssertionError, "expected stat ID 'LST2', but got '%s'", id)
+	}
+
+	entry, errno, err := readStatV2(conn)
+	if err != nil {
+		return nil, err
+	}
+	if errno != 0 {
+		return nil, syncErrnoError(errno, path)
+	}
+	return entry, nil
+}
+
 func listDirEntries(conn *wire.SyncConn, path string) (entries *DirEntries, err error) {
-	if err = conn.SendOctetString("LIST"); err != nil {
+	if err = conn.SendOctetString(wire.SyncIDList); err != nil {
 		return
 	}
 	if err = conn.SendBytes([]byte(path)); err != nil {
@@ -40,8 +69,20 @@ func listDirEntries(conn *wire.SyncConn, path string) (entries *DirEntries, err
 	return &DirEntries{scanner: conn}, nil
 }
 
+// listDirEntriesV2 is listDirEntries using the v2 request, which reports 64-bit sizes and the
+// owner of each file.
+func listDirEntriesV2(conn *wire.SyncConn, path string) (*DirEntries, error) {
+	if err := conn.SendOctetString(wire.SyncIDListV2); err != nil {
+		return nil, err
+	}
+	if err := conn.SendBytes([]byte(path)); err != nil {
+		return nil, err
+	}
+	return &DirEntries{scanner: conn, v2: true}, nil
+}
+
 func receiveFile(conn *wire.SyncConn, path string) (io.ReadCloser, error) {
-	if err := conn.SendOctetString("RECV"); err != nil {
+	if err := conn.SendOctetString(wire.SyncIDReceive); err != nil {
 		return nil, err
 	}
 	if err := conn.SendBytes([]byte(path)); err != nil {
@@ -55,7 +96,7 @@ func receiveFile(conn *wire.SyncConn, path string) (io.ReadCloser, error) {
 // The file's modified time will be set to mtime, unless mtime is 0, in which case the time the writer is
 // closed will be used.
 func sendFile(conn *wire.SyncConn, path string, mode os.FileMode, mtime time.Time) (io.WriteCloser, error) {
-	if err := conn.SendOctetString("SEND"); err != nil {
+	if err := conn.SendOctetString(wire.SyncIDSend); err != nil {
 		return nil, err
 	}
 
@@ -91,9 +132,94 @@ func readStat(s wire.SyncScanner) (entry *DirEntry, err error) {
 	}
 
 	entry = &DirEntry{
-		Mode:       mode,
-		Size:       size,
+		Mode: mode,
+		// Sizes are unsigned in v1.
+		Size:       int64(uint32(size)),
 		ModifiedAt: mtime,
+		UID:        -1,
+		GID:        -1,
 	}
 	return
 }
+
+// readStatV2 reads the fields of a SyncIDStatV2, SyncIDLstatV2 or SyncIDDirEntryV2 packet after
+// its ID, up to the name of a SyncIDDirEntryV2. errno is non-zero if the stat failed.
+func readStatV2(s wire.SyncScanner) (entry *DirEntry, errno uint32, err error) {
+	// Reads the fields in order, stopping at the first error.
+	readUint32 := func(field string) uint32 {
+		if err != nil {
+			return 0
+		}
+		var v uint32
+		if v, err = s.ReadUint32(); err != nil {
+			err = errors.WrapErrf(err, "error reading %s: %v", field, err)
+		}
+		return v
+	}
+	readInt64 := func(field string) int64 {
+		if err != nil {
+			return 0
+		}
+		var v int64
+		if v, err = s.ReadInt64(); err != nil {
+			err = errors.WrapErrf(err, "error reading %s: %v", field, err)
+		}
+		return v
+	}
+
+	errno = readUint32("error")
+	readInt64("device")
+	readInt64("inode")
+	var mode os.FileMode
+	if err == nil {
+		if mode, err = s.ReadFileMode(); err != nil {
+			err = errors.WrapErrf(err, "error reading file mode: %v", err)
+		}
+	}
+	links := readUint32("link count")
+	uid := readUint32("uid")
+	gid := readUint32("gid")
+	size := readInt64("file size")
+	atime := readInt64("access time")
+	mtime := readInt64("file time")
+	ctime := readInt64("change time")
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return &DirEntry{
+		Mode:       mode,
+		Size:       size,
+		ModifiedAt: time.Unix(mtime, 0).UTC(),
+		UID:        int(uid),
+		GID:        int(gid),
+		Links:      int(links),
+		AccessedAt: time.Unix(atime, 0).UTC(),
+		ChangedAt:  time.Unix(ctime, 0).UTC(),
+	}, errno, nil
+}
+
+// Messages of the errnos v2 stats commonly fail with on Linux, which has different numbers to
+// some hosts, so syscall.Errno can't describe them.
+var syncErrnoMessages = map[uint32]string{
+	1:  "operation not permitted",
+	13: "permission denied",
+	20: "not a directory",
+	36: "file name too long",
+	40: "too many levels of symbolic links",
+}
+
+// Linux's ENOENT.
+const syncErrnoNoEntry = 2
+
+// syncErrnoError returns the error for a v2 stat of path that failed with errno.
+func syncErrnoError(errno uint32, path string) error {
+	if errno == syncErrnoNoEntry {
+		return errors.Errorf(errors.FileNoExistError, "file doesn't exist")
+	}
+	message, ok := syncErrnoMessages[errno]
+	if !ok {
+		message = fmt.Sprintf("errno %d", errno)
+	}
+	return errors.Errorf(errors.AdbError, "error statting %s: %s", path, message)
+}
@@ -3,6 +3,7 @@ package adb
 
 import (
 	"bytes"
+	"encoding/binary"
 	"os"
 	"testing"
 	"time"
@@ -30,7 +31,8 @@ func TestStatValid(t *testing.T) {
 	assert.NoError(t, err)
 	require.NotNil(t, entry)
 	assert.Equal(t, mode, entry.Mode, "expected os.FileMode %s, got %s", mode, entry.Mode)
-	assert.Equal(t, int32(4), entry.Size)
+	assert.Equal(t, int64(4), entry.Size)
+	assert.Equal(t, -1, entry.UID)
 	assert.Equal(t, someTime, entry.ModifiedAt)
 	assert.Equal(t, "", entry.Name)
 }
@@ -59,3 +61,95 @@ func TestStatNoExist(t *testing.T) {
 	assert.Nil(t, entry)
 	assert.Equal(t, errors.FileNoExistError, err.(*errors.Err).Code)
 }
+
+// v1SyncDevice returns a device that stats and lists files with the v1 sync requests, without
+// reading its features first.
+func v1SyncDevice(s *MockServer) *Device {
+	device := (&Adb{server: s}).Device(AnyDevice())
+	device.syncFeatures.Store(syncFeatures{})
+	return device
+}
+
+// encodeStatV2 encodes the fields of a v2 stat response after its ID.
+func encodeStatV2(buf *bytes.Buffer, errno, mode, uid, gid uint32, size, mtime int64) {
+	binary.Write(buf, binary.LittleEndian, errno)
+	binary.Write(buf, binary.LittleEndian, uint64(1))  // dev
+	binary.Write(buf, binary.LittleEndian, uint64(42)) // ino
+	binary.Write(buf, binary.LittleEndian, mode)
+	binary.Write(buf, binary.LittleEndian, uint32(1)) // nlink
+	binary.Write(buf, binary.LittleEndian, uid)
+	binary.Write(buf, binary.LittleEndian, gid)
+	binary.Write(buf, binary.LittleEndian, size)
+	binary.Write(buf, binary.LittleEndian, mtime+60) // atime
+	binary.Write(buf, binary.LittleEndian, mtime)
+	binary.Write(buf, binary.LittleEndian, mtime+120) // ctime
+}
+
+func TestLstatV2(t *testing.T) {
+	var buf bytes.Buffer
+	conn := &wire.SyncConn{wire.NewSyncScanner(&buf), wire.NewSyncSender(&buf)}
+
+	buf.WriteString("LST2")
+	encodeStatV2(&buf, 0, 0104755, 2000, 1015, 5<<30, someTime.Unix())
+	entry, err := lstatV2(conn, "/sdcard/big.img")
+	require.NoError(t, err)
+	assert.Equal(t, &DirEntry{
+		Mode:       os.ModeSetuid | 0755,
+		Size:       5 << 30,
+		ModifiedAt: someTime,
+		UID:        2000,
+		GID:        1015,
+		Links:      1,
+		AccessedAt: someTime.Add(time.Minute),
+		ChangedAt:  someTime.Add(2 * time.Minute),
+	}, entry)
+
+	buf.Reset()
+	buf.WriteString("LST2")
+	encodeStatV2(&buf, 2, 0, 0, 0, 0, 0)
+	_, err = lstatV2(conn, "/missing")
+	assert.Equal(t, errors.FileNoExistError, err.(*errors.Err).Code)
+
+	buf.Reset()
+	buf.WriteString("LST2")
+	encodeStatV2(&buf, 13, 0, 0, 0, 0, 0)
+	_, err = lstatV2(conn, "/data/data")
+	assert.EqualError(t, err, "AdbError: error statting /data/data: permission denied")
+
+	buf.Reset()
+	buf.WriteString("LST2")
+	buf.WriteString("\x00\x00")
+	_, err = lstatV2(conn, "/truncated")
+	assert.Equal(t, errors.NetworkError, err.(*errors.Err).Code)
+}
+
+func TestListDirEntriesV2(t *testing.T) {
+	var buf bytes.Buffer
+	conn := &wire.SyncConn{wire.NewSyncScanner(&buf), wire.NewSyncSender(&buf)}
+	entries, err := listDirEntriesV2(conn, "/sdcard")
+	require.NoError(t, err)
+	buf.Reset()
+
+	buf.WriteString("DNT2")
+	encodeStatV2(&buf, 0, 040771, 0, 9997, 4096, someTime.Unix())
+	conn.SendBytes([]byte("Download"))
+	buf.WriteString("DNT2")
+	encodeStatV2(&buf, 0, 0100660, 10123, 9997, 5<<30, someTime.Unix())
+	conn.SendBytes([]byte("big.img"))
+	buf.WriteString("DONE")
+	buf.Write(make([]byte, 68))
+
+	all, err := entries.ReadAll()
+	require.NoError(t, err)
+	require.Len(t, all, 2)
+	assert.Equal(t, "Download", all[0].Name)
+	assert.True(t, all[0].Mode.IsDir())
+	assert.Equal(t, &DirEntry{Name: "big.img", Mode: 0660, Size: 5 << 30, ModifiedAt: someTime, UID: 10123, GID: 9997,
+		Links: 1, AccessedAt: someTime.Add(time.Minute), ChangedAt: someTime.Add(2 * time.Minute)}, all[1])
+}
+
+func TestParseSyncFeatures(t *testing.T) {
+	features := []string{"shell_v2", "stat_v2", "ls_v2"}
+	assert.Equal(t, syncFeatures{statV2: true, listV2: true, all: features}, parseSyncFeatures(features))
+	assert.Equal(t, syncFeatures{all: []string{"shell_v2", "cmd"}}, parseSyncFeatures([]string{"shell_v2", "cmd"}))
+}
@@ -0,0 +1,263 @@
+package adb
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/mqhack/goadb/internal/errors"
+	"github.com/mqhack/goadb/wire"
+)
+
+// Files smaller than this aren't compressed, since compressing them saves less than it costs.
+const minCompressedFileSize = 4 * 1024
+
+// A pushed file is only compressed if its first chunk compresses to less than this fraction
+// of its size.
+const maxCompressionRatio = 0.9
+
+// Extensions of files that are already compressed, so compressing them again when they're
+// pulled only wastes time. Pushed files are checked by compressing their first chunk instead.
+var incompressibleExtensions = map[string]bool{
+	".7z": true, ".br": true, ".bz2": true, ".gz": true, ".lz4": true, ".tgz": true, ".xz": true,
+	".zip": true, ".zst": true,
+	".gif": true, ".heic": true, ".jpeg": true, ".jpg": true, ".png": true, ".webp": true,
+	".aac": true, ".m4a": true, ".mkv": true, ".mp3": true, ".mp4": true, ".ogg": true,
+	".opus": true, ".webm": true,
+}
+
+// transferCodec returns the codec to compress a transfer with: the codec named compression,
+// or if it's empty, the first codec in the client's preference that the device supports.
+// Returns nil if the transfer shouldn't be compressed.
+//
+// The device's features are only read if a codec that could be used is registered, so
+// transfers with no codecs registered need no extra round trip.
+func (c *Device) transferCodec(compression string) (CompressionCodec, error) {
+	if compression == CompressionNone {
+		return nil, nil
+	}
+	preference := c.compressionPreference
+	if compression != "" {
+		preference = []string{compression}
+	} else if preference == nil {
+		preference = DefaultCompressionPreference
+	}
+
+	registered := false
+	for _, name := range preference {
+		if name == CompressionNone {
+			break
+		}
+		if _, ok := LookupCompressionCodec(name); ok {
+			registered = true
+			break
+		}
+	}
+	if !registered {
+		if compression != "" {
+			return nil, errors.Errorf(errors.RequirementNotMet, "no %s compression codec registered", compression)
+		}
+		return nil, nil
+	}
+
+	codec := selectCompressionCodec(preference, c.getSyncFeatures().all)
+	if codec == nil && compression != "" {
+		return nil, errors.Errorf(errors.RequirementNotMet, "device doesn't support %s compression", compression)
+	}
+	return codec, nil
+}
+
+// isCompressible returns false if the file at path is probably already compressed, going by
+// its extension.
+func isCompressible(remotePath string) bool {
+	return !incompressibleExtensions[strings.ToLower(path.Ext(remotePath))]
+}
+
+// receiveFileV2 requests the file at path with the v2 receive request, which the device
+// compresses with codec.
+func receiveFileV2(conn *wire.SyncConn, path string, codec CompressionCodec) (io.ReadCloser, error) {
+	if err := conn.SendOctetString(wire.SyncIDReceiveV2); err != nil {
+		return nil, err
+	}
+	if err := conn.SendBytes([]byte(path)); err != nil {
+		return nil, err
+	}
+	if err := conn.SendOctetString(wire.SyncIDReceiveV2); err != nil {
+		return nil, err
+	}
+	if err := conn.SendInt32(int32(codec.SyncFlag())); err != nil {
+		return nil, err
+	}
+
+	compressed, err := newSyncFileReader(conn)
+	if err != nil {
+		return nil, err
+	}
+	r, err := codec.NewReader(compressed)
+	if err != nil {
+		compressed.Close()
+		return nil, errors.WrapErrorf(err, errors.AssertionError, "error starting %s decompression", codec.Name())
+	}
+	return &decompressingReader{r, compressed, codec}, nil
+}
+
+// decompressingReader reads a file received with receiveFileV2.
+type decompressingReader struct {
+	io.ReadCloser
+	compressed io.Closer
+	codec      CompressionCodec
+}
+
+func (r *decompressingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if err != nil && err != io.EOF {
+		if _, ok := err.(*errors.Err); !ok {
+			err = errors.WrapErrorf(err, errors.NetworkError, "error decompressing %s data", r.codec.Name())
+		}
+	}
+	return n, err
+}
+
+func (r *decompressingReader) Close() error {
+	r.ReadCloser.Close()
+	return r.compressed.Close()
+}
+
+/*
+syncFileWriterV2 sends a file with the v2 send request, compressing it with codec if force is
+set or it compresses well.
+
+The request carries the compression flags, so it isn't sent until the first chunk of the file
+has been written, or the writer is closed, and the first chunk has been compressed to see
+whether compressing the rest is worthwhile.
+*/
+type syncFileWriterV2 struct {
+	sender wire.SyncSender
+	path   string
+	mode   os.FileMode
+	mtime  time.Time
+	codec  CompressionCodec
+	force  bool
+
+	// Data written before the request was sent.
+	sample []byte
+	// The writer data is written to once the request has been sent, which compresses it if
+	// it's compressible.
+	w io.Writer
+	// Sends the data packets.
+	file *syncFileWriter
+	// Closes the compressor, or nil if the file isn't compressed.
+	compressor io.Closer
+}
+
+func newSyncFileWriterV2(s wire.SyncSender, path string, mode os.FileMode, mtime time.Time, codec CompressionCodec, force bool) io.WriteCloser {
+	return &syncFileWriterV2{sender: s, path: path, mode: mode, mtime: mtime, codec: codec, force: force}
+}
+
+func (w *syncFileWriterV2) Write(p []byte) (int, error) {
+	if w.w != nil {
+		return w.w.Write(p)
+	}
+
+	n := wire.SyncMaxChunkSize - len(w.sample)
+	if n > len(p) {
+		n = len(p)
+	}
+	w.sample = append(w.sample, p[:n]...)
+	if len(w.sample) < wire.SyncMaxChunkSize {
+		return len(p), nil
+	}
+	if err := w.start(); err != nil {
+		return 0, err
+	}
+	written, err := w.w.Write(p[n:])
+	return n + written, err
+}
+
+func (w *syncFileWriterV2) Close() error {
+	if w.w == nil {
+		if err := w.start(); err != nil {
+			w.sender.Close()
+			return err
+		}
+	}
+	if w.compressor != nil {
+		if err := w.compressor.Close(); err != nil {
+			w.sender.Close()
+			return wrapCompressionError(err, w.codec, "error flushing %s compression")
+		}
+	}
+	return w.file.Close()
+}
+
+// start sends the request, and the data written so far.
+func (w *syncFileWriterV2) start() error {
+	compress := w.force || w.shouldCompress()
+	flags := wire.SyncFlagNone
+	if compress {
+		flags = w.codec.SyncFlag()
+	}
+
+	if err := w.sender.SendOctetString(wire.SyncIDSendV2); err != nil {
+		return err
+	}
+	if err := w.sender.SendBytes([]byte(w.path)); err != nil {
+		return err
+	}
+	if err := w.sender.SendOctetString(wire.SyncIDSendV2); err != nil {
+		return err
+	}
+	if err := w.sender.SendFileMode(w.mode.Perm()); err != nil {
+		return err
+	}
+	if err := w.sender.SendInt32(int32(flags)); err != nil {
+		return err
+	}
+
+	w.file = &syncFileWriter{sender: w.sender, mtime: w.mtime}
+	w.w = w.file
+	if compress {
+		compressor, err := w.codec.NewWriter(w.file)
+		if err != nil {
+			return wrapCompressionError(err, w.codec, "error starting %s compression")
+		}
+		w.w, w.compressor = compressor, compressor
+	}
+
+	sample := w.sample
+	w.sample = nil
+	if len(sample) == 0 {
+		return nil
+	}
+	_, err := w.w.Write(sample)
+	return err
+}
+
+// shouldCompress returns true if the sample compresses well enough for compressing the file to
+// be worthwhile.
+func (w *syncFileWriterV2) shouldCompress() bool {
+	if len(w.sample) < minCompressedFileSize {
+		return false
+	}
+	var buf bytes.Buffer
+	compressor, err := w.codec.NewWriter(&buf)
+	if err != nil {
+		// The error is reported when the file is compressed.
+		return true
+	}
+	_, err = compressor.Write(w.sample)
+	if closeErr := compressor.Close(); err == nil {
+		err = closeErr
+	}
+	return err != nil || float64(buf.Len()) < maxCompressionRatio*float64(len(w.sample))
+}
+
+func wrapCompressionError(err error, codec CompressionCodec, format string) error {
+	if _, ok := err.(*errors.Err); ok {
+		return err
+	}
+	return errors.WrapErrorf(err, errors.AssertionError, format, codec.Name())
+}
@@ -0,0 +1,184 @@
+package adb
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mqhack/goadb/internal/errors"
+	"github.com/mqhack/goadb/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// flateCodec is a codec that really compresses, for testing when compression is used.
+type flateCodec struct{}
+
+func (flateCodec) Name() string     { return "test-flate" }
+func (flateCodec) SyncFlag() uint32 { return 0x200 }
+
+func (flateCodec) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return flate.NewWriter(w, flate.BestSpeed)
+}
+
+func (flateCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return flate.NewReader(r), nil
+}
+
+// readSendV2 parses a file sent with syncFileWriterV2, returning its path, flags and data.
+func readSendV2(t *testing.T, sent []byte) (string, uint32, []byte) {
+	s := wire.NewSyncScanner(bytes.NewReader(sent))
+	id, err := s.ReadStatus("")
+	require.NoError(t, err)
+	require.Equal(t, wire.SyncIDSendV2, id)
+	path, err := s.ReadString()
+	require.NoError(t, err)
+	id, err = s.ReadStatus("")
+	require.NoError(t, err)
+	require.Equal(t, wire.SyncIDSendV2, id)
+	mode, err := s.ReadFileMode()
+	require.NoError(t, err)
+	assert.Equal(t, "-rw-r--r--", mode.String())
+	flags, err := s.ReadUint32()
+	require.NoError(t, err)
+
+	var data bytes.Buffer
+	r, err := newSyncFileReader(s)
+	require.NoError(t, err)
+	_, err = io.Copy(&data, r)
+	require.NoError(t, err)
+	return path, flags, data.Bytes()
+}
+
+func TestSyncFileWriterV2Compresses(t *testing.T) {
+	var buf bytes.Buffer
+	w := newSyncFileWriterV2(wire.NewSyncSender(&buf), "/data/local/tmp/trace.txt", 0644, time.Unix(1, 0), flateCodec{}, false)
+	content := []byte(strings.Repeat("sched_switch: prev_comm=swapper next_comm=surfaceflinger\n", 3000))
+	for i := 0; i < len(content); i += 1000 {
+		end := i + 1000
+		if end > len(content) {
+			end = len(content)
+		}
+		n, err := w.Write(content[i:end])
+		require.NoError(t, err)
+		assert.Equal(t, end-i, n)
+	}
+	require.NoError(t, w.Close())
+	assert.True(t, buf.Len() < len(content)/5)
+
+	path, flags, data := readSendV2(t, buf.Bytes())
+	assert.Equal(t, "/data/local/tmp/trace.txt", path)
+	assert.Equal(t, uint32(0x200), flags)
+	decompressed, err := ioutil.ReadAll(flate.NewReader(bytes.NewReader(data)))
+	require.NoError(t, err)
+	assert.Equal(t, content, decompressed)
+}
+
+func TestSyncFileWriterV2SkipsIncompressible(t *testing.T) {
+	content := make([]byte, 100*1024)
+	rand.New(rand.NewSource(1)).Read(content)
+
+	var buf bytes.Buffer
+	w := newSyncFileWriterV2(wire.NewSyncSender(&buf), "/sdcard/photo.bin", 0644, time.Unix(1, 0), flateCodec{}, false)
+	n, err := w.Write(content)
+	require.NoError(t, err)
+	assert.Equal(t, len(content), n)
+	require.NoError(t, w.Close())
+
+	_, flags, data := readSendV2(t, buf.Bytes())
+	assert.Equal(t, wire.SyncFlagNone, flags)
+	assert.Equal(t, content, data)
+}
+
+func TestSyncFileWriterV2SmallFile(t *testing.T) {
+	var buf bytes.Buffer
+	w := newSyncFileWriterV2(wire.NewSyncSender(&buf), "/sdcard/a.txt", 0644, time.Unix(1, 0), flateCodec{}, false)
+	_, err := w.Write([]byte("aaaaaaaaaaaaaaaa"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	_, flags, data := readSendV2(t, buf.Bytes())
+	assert.Equal(t, wire.SyncFlagNone, flags)
+	assert.Equal(t, "aaaaaaaaaaaaaaaa", string(data))
+
+	// Small files are compressed if the codec is forced.
+	buf.Reset()
+	w = newSyncFileWriterV2(wire.NewSyncSender(&buf), "/sdcard/a.txt", 0644, time.Unix(1, 0), flateCodec{}, true)
+	require.NoError(t, w.Close())
+	_, flags, _ = readSendV2(t, buf.Bytes())
+	assert.Equal(t, uint32(0x200), flags)
+}
+
+func TestReceiveFileV2(t *testing.T) {
+	var compressed bytes.Buffer
+	fw, _ := flateCodec{}.NewWriter(&compressed)
+	fw.Write([]byte("hello world"))
+	fw.Close()
+	var response bytes.Buffer
+	response.WriteString("DATA")
+	binary.Write(&response, binary.LittleEndian, uint32(compressed.Len()))
+	response.Write(compressed.Bytes())
+	response.WriteString("DONE\x00\x00\x00\x00")
+
+	var sent bytes.Buffer
+	conn := &wire.SyncConn{
+		SyncScanner: wire.NewSyncScanner(&response),
+		SyncSender:  wire.NewSyncSender(&sent),
+	}
+	r, err := receiveFileV2(conn, "/sdcard/a.txt", flateCodec{})
+	require.NoError(t, err)
+	data, err := ioutil.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, "hello world", string(data))
+	assert.NoError(t, r.Close())
+
+	assert.Equal(t, "RCV2\x0d\x00\x00\x00/sdcard/a.txtRCV2\x00\x02\x00\x00", sent.String())
+}
+
+func TestTransferCodec(t *testing.T) {
+	RegisterCompressionCodec(flateCodec{})
+	s := &MockServer{
+		Status:   wire.StatusSuccess,
+		Messages: []string{"shell_v2,sendrecv_v2,sendrecv_v2_test-flate\n"},
+	}
+	device := (&Adb{server: s}).Device(DeviceWithSerial("abc"))
+
+	// The default preference doesn't name any registered codecs, so the features aren't read.
+	codec, err := device.transferCodec("")
+	require.NoError(t, err)
+	assert.Nil(t, codec)
+	assert.Empty(t, s.Requests)
+
+	codec, err = device.transferCodec(CompressionNone)
+	require.NoError(t, err)
+	assert.Nil(t, codec)
+
+	_, err = device.transferCodec("test-unregistered")
+	assert.Equal(t, errors.RequirementNotMet, code(err))
+
+	codec, err = device.transferCodec("test-flate")
+	require.NoError(t, err)
+	assert.Equal(t, flateCodec{}, codec)
+	assert.Equal(t, []string{"host-serial:abc:features"}, s.Requests)
+
+	device = (&Adb{server: s, compressionPreference: []string{"test-flate"}}).Device(DeviceWithSerial("abc"))
+	device.syncFeatures.Store(syncFeatures{all: []string{"sendrecv_v2"}})
+	codec, err = device.transferCodec("")
+	require.NoError(t, err)
+	assert.Nil(t, codec)
+	_, err = device.transferCodec("test-flate")
+	assert.Equal(t, errors.RequirementNotMet, code(err))
+}
+
+func TestIsCompressible(t *testing.T) {
+	assert.True(t, isCompressible("/data/app/base.apk"))
+	assert.True(t, isCompressible("/data/misc/perfetto-traces/trace"))
+	assert.False(t, isCompressible("/sdcard/DCIM/IMG_0001.JPG"))
+	assert.False(t, isCompressible("/sdcard/bugreport.zip"))
+}
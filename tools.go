@@ -0,0 +1,193 @@
+package adb
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/mqhack/goadb/internal/errors"
+	"github.com/mqhack/goadb/wire"
+)
+
+// The directory in the Device's TempDir where EnsureTools pushes busybox and links its
+// applets.
+const toolsDirName = "tools"
+
+// BusyboxBinary is a static busybox build on the host, for EnsureTools to push.
+type BusyboxBinary struct {
+	// Path is the local path of the binary.
+	Path string
+	// SHA256 is the hex-encoded SHA-256 digest the binary must have, to make sure devices
+	// only get the pinned build. If empty, the binary isn't checked.
+	SHA256 string
+}
+
+var busyboxBinaries = struct {
+	sync.RWMutex
+	byABI map[string]BusyboxBinary
+}{byABI: make(map[string]BusyboxBinary)}
+
+// RegisterBusyboxBinary makes EnsureTools use binary for devices with abi, as reported by
+// ro.product.cpu.abi (e.g. "arm64-v8a"). It replaces any binary registered for the same ABI.
+// No binaries are registered by default.
+func RegisterBusyboxBinary(abi string, binary BusyboxBinary) {
+	busyboxBinaries.Lock()
+	defer busyboxBinaries.Unlock()
+	busyboxBinaries.byABI[abi] = binary
+}
+
+func lookupBusyboxBinary(abi string) (BusyboxBinary, bool) {
+	busyboxBinaries.RLock()
+	defer busyboxBinaries.RUnlock()
+	binary, ok := busyboxBinaries.byABI[abi]
+	return binary, ok
+}
+
+/*
+EnsureTools makes sure the device has every command in tools, so helpers that need them can
+work on old or stripped-down builds.
+
+If any are missing, the busybox binary registered for the device's ABI (see
+RegisterBusyboxBinary) is pushed to a directory in the Device's TempDir, unless an earlier
+call already pushed it, and the missing commands are linked to it. That directory is added
+to the PATH of this Device's shell profile (see SetShellProfile), keeping any profile
+already set, and is deleted when the Device is closed. If there's no binary registered, or busybox doesn't provide all the missing
+commands, an error with code RequirementNotMet is returned.
+*/
+func (c *Device) EnsureTools(tools ...string) error {
+	missing, err := c.missingTools(tools)
+	if err != nil || len(missing) == 0 {
+		return wrapClientError(err, c, "EnsureTools")
+	}
+
+	abi, err := c.getProp("ro.product.cpu.abi")
+	if err != nil {
+		return wrapClientError(err, c, "EnsureTools")
+	}
+	binary, ok := lookupBusyboxBinary(abi)
+	if !ok {
+		err := errors.Errorf(errors.RequirementNotMet, "device is missing %s, and no busybox binary is configured for ABI %q",
+			strings.Join(missing, ", "), abi)
+		return wrapClientError(err, c, "EnsureTools")
+	}
+
+	tempDir, err := c.TempDir()
+	if err != nil {
+		return err
+	}
+	toolsDir := path.Join(tempDir, toolsDirName)
+	if err := c.installBusybox(binary, toolsDir, missing); err != nil {
+		return wrapClientError(err, c, "EnsureTools")
+	}
+	if err := c.addToolsDirToProfile(toolsDir); err != nil {
+		return wrapClientError(err, c, "EnsureTools")
+	}
+
+	missing, err = c.missingTools(missing)
+	if err == nil && len(missing) > 0 {
+		err = errors.Errorf(errors.RequirementNotMet, "busybox doesn't provide %s", strings.Join(missing, ", "))
+	}
+	return wrapClientError(err, c, "EnsureTools")
+}
+
+// missingTools returns the tools the device's shell can't find.
+func (c *Device) missingTools(tools []string) ([]string, error) {
+	quoted := make([]string, len(tools))
+	for i, tool := range tools {
+		quoted[i] = shellQuote(tool)
+	}
+	output, err := c.RunCommand("for t in " + strings.Join(quoted, " ") + `; do command -v "$t" >/dev/null || echo "$t"; done`)
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(output), nil
+}
+
+// installBusybox pushes binary to toolsDir if it's not already there, and links the applets
+// in tools to it.
+func (c *Device) installBusybox(binary BusyboxBinary, toolsDir string, tools []string) error {
+	local, err := os.Open(binary.Path)
+	if err != nil {
+		return wrapLocalFileError(err, binary.Path)
+	}
+	defer local.Close()
+	info, err := local.Stat()
+	if err != nil {
+		return wrapLocalFileError(err, binary.Path)
+	}
+	if err := checkBusyboxDigest(local, binary); err != nil {
+		return err
+	}
+
+	remotePath := path.Join(toolsDir, "busybox")
+	if remote, err := c.Stat(remotePath); err != nil || remote.Size != info.Size() {
+		if _, err := c.RunCommand("mkdir -p " + shellQuote(toolsDir)); err != nil {
+			return err
+		}
+		if _, err := local.Seek(0, io.SeekStart); err != nil {
+			return wrapLocalFileError(err, binary.Path)
+		}
+		if err := c.pushBusybox(local, remotePath); err != nil {
+			return err
+		}
+	}
+
+	script := "cd " + shellQuote(toolsDir)
+	for _, tool := range tools {
+		script += " && ln -sf busybox " + shellQuote(tool)
+	}
+	output, err := c.RunCommand(script)
+	if err == nil && strings.TrimSpace(output) != "" {
+		err = errors.Errorf(errors.AdbError, "error linking busybox applets: %s", strings.TrimSpace(output))
+	}
+	return err
+}
+
+func (c *Device) pushBusybox(local io.Reader, remotePath string) error {
+	w, err := c.OpenWrite(remotePath, wire.DefaultExecutablePerms, MtimeOfClose)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, local); err != nil {
+		w.Close()
+		if _, ok := err.(*errors.Err); !ok {
+			err = errors.WrapErrorf(err, errors.NetworkError, "error pushing busybox")
+		}
+		return err
+	}
+	return w.Close()
+}
+
+func checkBusyboxDigest(r io.Reader, binary BusyboxBinary) error {
+	if binary.SHA256 == "" {
+		return nil
+	}
+	hash := sha256.New()
+	if _, err := io.Copy(hash, r); err != nil {
+		return wrapLocalFileError(err, binary.Path)
+	}
+	if digest := hex.EncodeToString(hash.Sum(nil)); !strings.EqualFold(digest, binary.SHA256) {
+		return errors.Errorf(errors.AssertionError, "busybox binary %s has SHA-256 %s, expected %s", binary.Path, digest, binary.SHA256)
+	}
+	return nil
+}
+
+// addToolsDirToProfile sets a shell profile that puts toolsDir first on the PATH, based on
+// the current profile.
+func (c *Device) addToolsDirToProfile(toolsDir string) error {
+	var profile ShellProfile
+	if current := c.getShellProfile(); current != nil {
+		profile = *current
+	}
+	for _, dir := range profile.Path {
+		if dir == toolsDir {
+			return nil
+		}
+	}
+	profile.Path = append([]string{toolsDir}, profile.Path...)
+	return c.SetShellProfile(&profile)
+}
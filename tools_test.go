@@ -0,0 +1,58 @@
+package adb
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mqhack/goadb/wire"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnsureToolsPresent(t *testing.T) {
+	s := &MockServer{Status: wire.StatusSuccess}
+	device := (&Adb{server: s}).Device(AnyDevice())
+
+	assert.NoError(t, device.EnsureTools("tar", "md5sum"))
+	assert.Equal(t, `shell:for t in 'tar' 'md5sum'; do command -v "$t" >/dev/null || echo "$t"; done`, s.Requests[1])
+	assert.Len(t, s.Requests, 2)
+}
+
+func TestEnsureToolsNoBinary(t *testing.T) {
+	s := &MockServer{
+		Status:   wire.StatusSuccess,
+		Messages: []string{"md5sum\n"},
+	}
+	device := (&Adb{server: s}).Device(AnyDevice())
+
+	err := device.EnsureTools("tar", "md5sum")
+	assert.True(t, HasErrCode(err, RequirementNotMet))
+	assert.Contains(t, ErrorWithCauseChain(err), `device is missing md5sum, and no busybox binary is configured for ABI ""`)
+	assert.Equal(t, "shell:getprop ro.product.cpu.abi", s.Requests[3])
+}
+
+func TestCheckBusyboxDigest(t *testing.T) {
+	binary := BusyboxBinary{
+		Path:   "busybox",
+		SHA256: "2CF24DBA5FB0A30E26E83B2AC5B9E29E1B161E5C1FA7425E73043362938B9824",
+	}
+	assert.NoError(t, checkBusyboxDigest(strings.NewReader("hello"), binary))
+	assert.EqualError(t, checkBusyboxDigest(strings.NewReader("goodbye"), binary),
+		"AssertionError: busybox binary busybox has SHA-256 82e35a63ceba37e9646434c5dd412ea577147f1e4a41ccde1614253187e3dbf9, expected 2CF24DBA5FB0A30E26E83B2AC5B9E29E1B161E5C1FA7425E73043362938B9824")
+	assert.NoError(t, checkBusyboxDigest(strings.NewReader("anything"), BusyboxBinary{Path: "busybox"}))
+}
+
+func TestRegisterBusyboxBinary(t *testing.T) {
+	binary := BusyboxBinary{Path: "busybox-armv7l"}
+	RegisterBusyboxBinary("test-abi", binary)
+	defer func() {
+		busyboxBinaries.Lock()
+		delete(busyboxBinaries.byABI, "test-abi")
+		busyboxBinaries.Unlock()
+	}()
+
+	found, ok := lookupBusyboxBinary("test-abi")
+	assert.True(t, ok)
+	assert.Equal(t, binary, found)
+	_, ok = lookupBusyboxBinary("other-abi")
+	assert.False(t, ok)
+}
@@ -0,0 +1,287 @@
+package adb
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mqhack/goadb/internal/errors"
+	"github.com/mqhack/goadb/wire"
+)
+
+// Services whose request is a shell command line, which may contain secrets.
+var commandServices = []string{"shell:", "shell,v2,raw:", "exec:"}
+
+/*
+Transcript records a line for every connection made to the adb server while it's active: the
+services requested, how long the connection was open, and whether it succeeded. It's meant
+to be attached to bug reports, so it's redacted: serials are replaced with aliases like
+<device-1>, addresses are removed, only the program name of shell commands is kept, and
+errors are reported by code without their messages. File contents and command output are
+never recorded.
+
+A transcript is started with Adb.BeginTranscript, and stopped with End.
+*/
+type Transcript struct {
+	recorder *transcriptRecorder
+	start    time.Time
+	now      func() time.Time
+
+	mu         sync.Mutex
+	w          io.Writer
+	err        error
+	operations int
+	failures   int
+	aliases    map[string]string
+}
+
+// transcriptRecorder holds the active transcript of an Adb, if any.
+type transcriptRecorder struct {
+	active atomic.Value // *Transcript
+}
+
+func (r *transcriptRecorder) transcript() *Transcript {
+	t, _ := r.active.Load().(*Transcript)
+	return t
+}
+
+// transcribingServer records the connections made through server in the active transcript.
+type transcribingServer struct {
+	server
+	recorder *transcriptRecorder
+}
+
+// BeginTranscript starts recording operations performed with the client and its devices to
+// w, replacing any active transcript.
+func (c *Adb) BeginTranscript(w io.Writer) *Transcript {
+	if c.transcripts == nil {
+		c.transcripts = &transcriptRecorder{}
+		c.server = &transcribingServer{server: c.server, recorder: c.transcripts}
+	}
+
+	t := &Transcript{
+		recorder: c.transcripts,
+		start:    time.Now(),
+		now:      time.Now,
+		w:        w,
+		aliases:  make(map[string]string),
+	}
+	if previous := c.transcripts.transcript(); previous != nil {
+		previous.End()
+	}
+	t.writef("goadb transcript started at %s", t.start.UTC().Format(time.RFC3339))
+	c.transcripts.active.Store(t)
+	return t
+}
+
+// End stops recording, and writes a summary. Returns the first error writing the transcript,
+// if any.
+func (t *Transcript) End() error {
+	if t.recorder.transcript() == t {
+		t.recorder.active.Store((*Transcript)(nil))
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.w != nil {
+		t.writefLocked("goadb transcript ended after %s: %d operations, %d failed",
+			t.now().Sub(t.start).Round(time.Millisecond), t.operations, t.failures)
+		t.w = nil
+	}
+	return t.err
+}
+
+func (s *transcribingServer) Dial() (*wire.Conn, error) {
+	t := s.recorder.transcript()
+	if t == nil {
+		return s.server.Dial()
+	}
+
+	op := &transcriptOperation{transcript: t, started: t.now()}
+	conn, err := s.server.Dial()
+	if err != nil {
+		op.fail(err)
+		op.finish()
+		return nil, err
+	}
+	return wire.NewConn(&transcribingScanner{conn.Scanner, op}, &transcribingSender{conn.Sender, op}), nil
+}
+
+// transcriptOperation is a connection being recorded.
+type transcriptOperation struct {
+	transcript *Transcript
+	started    time.Time
+
+	mu       sync.Mutex
+	requests []string
+	err      error
+	finished bool
+}
+
+func (op *transcriptOperation) request(req []byte) {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+	op.requests = append(op.requests, op.transcript.redact(string(req)))
+}
+
+func (op *transcriptOperation) fail(err error) {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+	if op.err == nil && err != nil && !errors.HasErrCode(err, errors.ConnectionResetError) {
+		op.err = err
+	}
+}
+
+func (op *transcriptOperation) finish() {
+	op.mu.Lock()
+	if op.finished {
+		op.mu.Unlock()
+		return
+	}
+	op.finished = true
+	requests, err := op.requests, op.err
+	op.mu.Unlock()
+
+	outcome := "ok"
+	if err != nil {
+		outcome = "failed"
+		if e, ok := err.(*errors.Err); ok {
+			outcome += ": " + e.Code.String()
+		}
+	}
+	if len(requests) == 0 {
+		requests = []string{"(no request)"}
+	}
+	op.transcript.record(op.started, strings.Join(requests, " "), err != nil, outcome)
+}
+
+func (t *Transcript) record(started time.Time, requests string, failed bool, outcome string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.w == nil {
+		return
+	}
+	t.operations++
+	if failed {
+		t.failures++
+	}
+	t.writefLocked("+%.3fs %s %s -> %s", started.Sub(t.start).Seconds(),
+		t.now().Sub(started).Round(time.Millisecond), requests, outcome)
+}
+
+func (t *Transcript) writef(format string, args ...interface{}) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.writefLocked(format, args...)
+}
+
+func (t *Transcript) writefLocked(format string, args ...interface{}) {
+	if t.err != nil {
+		return
+	}
+	if _, err := fmt.Fprintf(t.w, format+"\n", args...); err != nil {
+		t.err = errors.WrapErrorf(err, errors.AssertionError, "error writing transcript")
+	}
+}
+
+// redact removes serials, addresses and command arguments from a service request.
+func (t *Transcript) redact(req string) string {
+	for _, service := range commandServices {
+		if strings.HasPrefix(req, service) {
+			return service + redactCommandLine(strings.TrimPrefix(req, service))
+		}
+	}
+
+	switch {
+	case strings.HasPrefix(req, "host:transport:"):
+		return "host:transport:" + t.alias(strings.TrimPrefix(req, "host:transport:"))
+	case strings.HasPrefix(req, "host:tport:serial:"):
+		return "host:tport:serial:" + t.alias(strings.TrimPrefix(req, "host:tport:serial:"))
+	case strings.HasPrefix(req, "host-serial:"):
+		// The serial may contain colons, e.g. for TCP devices, so the service is after the
+		// last one.
+		rest := strings.TrimPrefix(req, "host-serial:")
+		if i := strings.LastIndex(rest, ":"); i >= 0 {
+			return "host-serial:" + t.alias(rest[:i]) + rest[i:]
+		}
+		return "host-serial:" + t.alias(rest)
+	case strings.HasPrefix(req, "host:connect:"), strings.HasPrefix(req, "host:disconnect:"):
+		parts := strings.SplitN(req, ":", 3)
+		return parts[0] + ":" + parts[1] + ":<address>"
+	}
+	return req
+}
+
+// alias returns a placeholder for serial, which is the same for every use of serial in the
+// transcript.
+func (t *Transcript) alias(serial string) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	alias, ok := t.aliases[serial]
+	if !ok {
+		alias = fmt.Sprintf("<device-%d>", len(t.aliases)+1)
+		t.aliases[serial] = alias
+	}
+	return alias
+}
+
+// redactCommandLine keeps only the program name of a shell command line, after the shell
+// profile prefix if there is one.
+func redactCommandLine(cmd string) string {
+	if i := strings.Index(cmd, "; "); i >= 0 && strings.HasPrefix(cmd, ". ") {
+		cmd = cmd[i+2:]
+	}
+	fields := strings.Fields(cmd)
+	switch len(fields) {
+	case 0:
+		return ""
+	case 1:
+		return fields[0]
+	default:
+		return fields[0] + " <redacted>"
+	}
+}
+
+type transcribingSender struct {
+	wire.Sender
+	op *transcriptOperation
+}
+
+func (s *transcribingSender) SendMessage(msg []byte) error {
+	s.op.request(msg)
+	err := s.Sender.SendMessage(msg)
+	s.op.fail(err)
+	return err
+}
+
+func (s *transcribingSender) Close() error {
+	err := s.Sender.Close()
+	s.op.finish()
+	return err
+}
+
+type transcribingScanner struct {
+	wire.Scanner
+	op *transcriptOperation
+}
+
+func (s *transcribingScanner) ReadStatus(req string) (string, error) {
+	status, err := s.Scanner.ReadStatus(req)
+	s.op.fail(err)
+	return status, err
+}
+
+func (s *transcribingScanner) ReadMessage() ([]byte, error) {
+	msg, err := s.Scanner.ReadMessage()
+	s.op.fail(err)
+	return msg, err
+}
+
+func (s *transcribingScanner) ReadUntilEof() ([]byte, error) {
+	data, err := s.Scanner.ReadUntilEof()
+	s.op.fail(err)
+	return data, err
+}
@@ -0,0 +1,63 @@
+package adb
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/mqhack/goadb/internal/errors"
+	"github.com/mqhack/goadb/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Replaces the timings in a transcript, which vary.
+var transcriptTimingPattern = regexp.MustCompile(`\+\d+\.\d{3}s \S+ |after \S+:|at \S+$`)
+
+func TestTranscript(t *testing.T) {
+	s := &MockServer{
+		Status:   wire.StatusSuccess,
+		Messages: []string{"192.168.1.5:5555\tdevice\n", "output"},
+	}
+	client := &Adb{server: s}
+	var out bytes.Buffer
+	transcript := client.BeginTranscript(&out)
+
+	_, err := client.ListDeviceSerials()
+	require.NoError(t, err)
+	device := client.Device(DeviceWithSerial("192.168.1.5:5555"))
+	_, err = device.RunCommand("cat", "/sdcard/secret.txt")
+	require.NoError(t, err)
+	s.Errs = []error{nil, errors.Errorf(errors.DeviceNotFound, "device '192.168.1.5:5555' not found")}
+	_, err = device.product()
+	assert.Error(t, err)
+	require.NoError(t, transcript.End())
+
+	// Not recorded after End.
+	client.ListDeviceSerials()
+
+	var lines []string
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		lines = append(lines, transcriptTimingPattern.ReplaceAllString(line, ""))
+	}
+	assert.Equal(t, []string{
+		"goadb transcript started ",
+		"host:devices -> ok",
+		"host:transport:<device-1> shell:cat <redacted> -> ok",
+		"host-serial:<device-1>:get-product -> failed: DeviceNotFound",
+		"goadb transcript ended  3 operations, 1 failed",
+	}, lines)
+}
+
+func TestTranscriptRedact(t *testing.T) {
+	transcript := (&Adb{server: &MockServer{}}).BeginTranscript(&bytes.Buffer{})
+	assert.Equal(t, "host:connect:<address>", transcript.redact("host:connect:10.0.0.2:5555"))
+	assert.Equal(t, "host:tport:serial:<device-1>", transcript.redact("host:tport:serial:emulator-5554"))
+	assert.Equal(t, "host-serial:<device-2>:features", transcript.redact("host-serial:R58M123:features"))
+	assert.Equal(t, "host-serial:<device-1>:features", transcript.redact("host-serial:emulator-5554:features"))
+	assert.Equal(t, "exec:screencap", transcript.redact("exec:screencap"))
+	assert.Equal(t, "shell,v2,raw:getprop <redacted>", transcript.redact(
+		"shell,v2,raw:. '/data/local/tmp/goadb_profile_0123456789abcdef.sh'; getprop ro.serialno"))
+	assert.Equal(t, "sync:", transcript.redact("sync:"))
+}
@@ -0,0 +1,449 @@
+package adb
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/mqhack/goadb/internal/errors"
+)
+
+// NewlinePolicy is how PushFile and PullFile convert line endings.
+type NewlinePolicy int
+
+const (
+	// NewlinesUnchanged copies files byte for byte, which binary files need.
+	NewlinesUnchanged NewlinePolicy = iota
+	// NewlinesNative converts text files to the host's line endings when they're pulled,
+	// which are CRLF on Windows and LF elsewhere, and to LF when they're pushed.
+	NewlinesNative
+	// NewlinesCRLF converts text files to CRLF line endings when they're pulled, and to LF
+	// when they're pushed, on any host.
+	NewlinesCRLF
+)
+
+// Paths this long or longer must have the \\?\ prefix on Windows, unless long paths are
+// enabled system-wide. It's MAX_PATH (260) less the 12 characters left for a file name when
+// creating a directory.
+const windowsMaxPath = 248
+
+// TransferOptions configures how PushFile and PullFile translate paths and file contents
+// between the host and the device.
+type TransferOptions struct {
+	// TranslateBackslashes replaces backslashes in remote paths with slashes, so paths built
+	// with filepath.Join on Windows can be used on the device. It's off by default, since
+	// backslashes are valid, if unusual, in Android file names.
+	TranslateBackslashes bool
+
+	// Newlines is how line endings are converted. Defaults to NewlinesUnchanged.
+	Newlines NewlinePolicy
+
+	// PreserveMetadata makes PullFile give the local file the remote file's permissions and
+	// modification time, like adb pull -a. PushFile always gives the remote file the local
+	// file's, like adb push.
+	PreserveMetadata bool
+
+	// Compression is the name of the codec the file is compressed with while it's
+	// transferred, e.g. CompressionZstd, which must be registered and supported by the
+	// device. CompressionNone disables compression. If it's empty, the first codec in the
+	// client's preference the device supports is used, unless the file looks incompressible:
+	// pulls skip files with extensions like .zip and .jpg, and pushes skip files whose first
+	// chunk doesn't compress well.
+	Compression string
+
+	// VerifyChecksum makes PushFile and PullFile compute the checksum of the file on the
+	// device once it's been transferred, and compare it to the checksum of the data that was
+	// sent or received. If they differ, the transfer fails with ChecksumMismatch, and a
+	// pulled file is removed. Defaults to ChecksumNone.
+	VerifyChecksum ChecksumAlgorithm
+
+	// RateLimit is the most bytes per second PushFile and PullFile transfer, so background
+	// transfers don't starve others sharing the USB bus. PushDir, PullDir and
+	// TransferManager share the limit between all their files. 0 means no limit.
+	RateLimit int64
+	// Shared by the transfers of PushDir, PullDir and TransferManager when RateLimit is set.
+	limiter *rateLimiter
+}
+
+// RemotePath returns path as it should be passed to the device.
+func (o TransferOptions) RemotePath(path string) string {
+	if o.TranslateBackslashes {
+		return strings.Replace(path, `\`, "/", -1)
+	}
+	return path
+}
+
+// LocalPath returns path as it should be passed to the host's file system. On Windows, long
+// paths are made absolute and given the \\?\ prefix, which lifts the 260 character limit.
+func (o TransferOptions) LocalPath(path string) string {
+	return localPathForOS(path, runtime.GOOS)
+}
+
+// PullWriter returns a writer that converts data pulled from the device to w according to
+// o.Newlines. It must be closed once all the data has been written, but doesn't close w.
+func (o TransferOptions) PullWriter(w io.Writer) io.WriteCloser {
+	switch {
+	case o.Newlines == NewlinesCRLF, o.Newlines == NewlinesNative && runtime.GOOS == "windows":
+		return &crlfWriter{w: w}
+	default:
+		return nopWriteCloser{w}
+	}
+}
+
+// PushReader returns a reader that converts data read from r to push to the device according
+// to o.Newlines.
+func (o TransferOptions) PushReader(r io.Reader) io.Reader {
+	if o.Newlines == NewlinesUnchanged {
+		return r
+	}
+	return &lfReader{r: r}
+}
+
+/*
+PushFile pushes the file at localPath to remotePath, with the local file's permissions and
+modification time, translating paths and contents according to opts.
+
+Corresponds to the command:
+
+	adb push <local> <remote>
+*/
+func (c *Device) PushFile(localPath, remotePath string, opts TransferOptions) error {
+	return wrapClientError(c.pushFile(context.Background(), localPath, remotePath, opts, nil), c, "PushFile")
+}
+
+// pushFile pushes localPath to remotePath, calling progress, if it's not nil, with the number
+// of bytes read from the local file as they're pushed.
+func (c *Device) pushFile(ctx context.Context, localPath, remotePath string, opts TransferOptions, progress func(n int)) error {
+	localPath = opts.LocalPath(localPath)
+	local, err := os.Open(localPath)
+	if err != nil {
+		return wrapLocalFileError(err, localPath)
+	}
+	defer local.Close()
+	info, err := local.Stat()
+	if err != nil {
+		return wrapLocalFileError(err, localPath)
+	}
+
+	sum, err := opts.VerifyChecksum.newHash()
+	if err != nil {
+		return err
+	}
+	r := opts.rateLimited(ctx, local)
+	if progress != nil {
+		r = &progressReader{r: r, progress: progress}
+	}
+	r = opts.PushReader(r)
+	if sum != nil {
+		r = io.TeeReader(r, sum)
+	}
+	remotePath = opts.RemotePath(remotePath)
+	if err := c.pushStream(ctx, r, -1, remotePath, info.Mode().Perm(), info.ModTime(), opts.Compression); err != nil {
+		return err
+	}
+	if sum != nil {
+		return c.verifyRemoteChecksum(opts.VerifyChecksum, remotePath, sum.Sum(nil))
+	}
+	return nil
+}
+
+/*
+PushReader pushes the data read from r until EOF to remotePath, creating it with the
+permissions in mode and the current time as its modification time, so data can be streamed to
+the device without a local file.
+
+If size isn't negative, r must provide exactly size bytes. If it provides fewer or more, reading
+it fails, or ctx is done, the push is aborted and the device removes the partial file.
+*/
+func (c *Device) PushReader(ctx context.Context, r io.Reader, size int64, remotePath string, mode os.FileMode) error {
+	err := c.pushStream(ctx, r, size, remotePath, mode.Perm(), MtimeOfClose, "")
+	return wrapClientError(err, c, "PushReader(%s)", remotePath)
+}
+
+// pushStream pushes the data read from r to remotePath, checking that r provides size bytes if
+// size isn't negative. If the push fails, it's aborted, so the device removes the partial file.
+func (c *Device) pushStream(ctx context.Context, r io.Reader, size int64, remotePath string, perms os.FileMode, mtime time.Time, compression string) error {
+	writer, conn, err := c.openWrite(remotePath, perms, mtime, compression)
+	if err != nil {
+		return err
+	}
+	stop := closeWhenDone(ctx, conn)
+	defer stop()
+	if size >= 0 {
+		// One byte more than expected is enough to tell that r is too long.
+		r = io.LimitReader(r, size+1)
+	}
+	n, err := io.Copy(writer, r)
+	switch {
+	case err != nil:
+	case size >= 0 && n < size:
+		err = errors.Errorf(errors.AssertionError, "only %d of the %d bytes to push to %s were provided", n, size, remotePath)
+	case size >= 0 && n > size:
+		err = errors.Errorf(errors.AssertionError, "more than the %d bytes to push to %s were provided", size, remotePath)
+	default:
+		return writer.Close()
+	}
+
+	conn.Close()
+	if ctx.Err() != nil {
+		return errors.WrapErrorf(ctx.Err(), errors.Timeout, "push to %s cancelled", remotePath)
+	}
+	if _, ok := err.(*errors.Err); !ok {
+		err = errors.WrapErrorf(err, errors.NetworkError, "error pushing to %s", remotePath)
+	}
+	return err
+}
+
+/*
+PullFile pulls the file at remotePath to localPath, translating paths and contents according
+to opts. If the pull fails, the partial local file is removed. If opts.PreserveMetadata is set,
+the remote file is stat'd first, and its permissions and modification time are applied to the
+local file once it's been written.
+
+Corresponds to the command:
+
+	adb pull [-a] <remote> <local>
+*/
+func (c *Device) PullFile(remotePath, localPath string, opts TransferOptions) error {
+	return wrapClientError(c.pullFile(context.Background(), remotePath, localPath, opts, nil, nil), c, "PullFile")
+}
+
+// pullFile pulls remotePath to localPath, calling progress, if it's not nil, with the number
+// of bytes read from the device as they're pulled. If opts.PreserveMetadata is set, the
+// metadata is taken from entry, or if it's nil, by stat'ing remotePath.
+func (c *Device) pullFile(ctx context.Context, remotePath, localPath string, opts TransferOptions, entry *DirEntry, progress func(n int)) error {
+	sum, err := opts.VerifyChecksum.newHash()
+	if err != nil {
+		return err
+	}
+	if opts.PreserveMetadata && entry == nil {
+		if entry, err = c.Stat(opts.RemotePath(remotePath)); err != nil {
+			return err
+		}
+	}
+	remote, err := c.openRead(opts.RemotePath(remotePath), opts.Compression)
+	if err != nil {
+		return err
+	}
+	defer remote.Close()
+	stop := closeWhenDone(ctx, remote)
+	defer stop()
+
+	localPath = opts.LocalPath(localPath)
+	local, err := os.Create(localPath)
+	if err != nil {
+		return wrapLocalFileError(err, localPath)
+	}
+	r := opts.rateLimited(ctx, remote)
+	if progress != nil {
+		r = &progressReader{r: r, progress: progress}
+	}
+	if sum != nil {
+		r = io.TeeReader(r, sum)
+	}
+	w := opts.PullWriter(local)
+	_, err = io.Copy(w, r)
+	if err == nil {
+		err = w.Close()
+	}
+	if closeErr := local.Close(); err == nil && closeErr != nil {
+		err = errors.WrapErrorf(closeErr, errors.AssertionError, "error writing local file %s", localPath)
+	}
+	if err == nil && sum != nil {
+		err = c.verifyRemoteChecksum(opts.VerifyChecksum, opts.RemotePath(remotePath), sum.Sum(nil))
+	}
+	if err != nil {
+		os.Remove(localPath)
+		if ctx.Err() != nil {
+			return errors.WrapErrorf(ctx.Err(), errors.Timeout, "pull of %s cancelled", remotePath)
+		}
+		if _, ok := err.(*errors.Err); !ok {
+			err = errors.WrapErrorf(err, errors.NetworkError, "error pulling %s", remotePath)
+		}
+		return err
+	}
+	if opts.PreserveMetadata {
+		return restoreMetadata(localPath, entry)
+	}
+	return nil
+}
+
+/*
+PullTo pulls the file at remotePath, writing its contents to w, so they can be streamed
+elsewhere without a local file, and returns the number of bytes written. The pull stops if
+writing to w fails, or ctx is done.
+*/
+func (c *Device) PullTo(ctx context.Context, remotePath string, w io.Writer) (int64, error) {
+	n, err := c.pullTo(ctx, remotePath, w)
+	return n, wrapClientError(err, c, "PullTo(%s)", remotePath)
+}
+
+func (c *Device) pullTo(ctx context.Context, remotePath string, w io.Writer) (int64, error) {
+	remote, err := c.openRead(remotePath, "")
+	if err != nil {
+		return 0, err
+	}
+	defer remote.Close()
+	stop := closeWhenDone(ctx, remote)
+	defer stop()
+
+	n, err := io.Copy(&pullDestination{w: w}, remote)
+	if err != nil {
+		if ctx.Err() != nil {
+			return n, errors.WrapErrorf(ctx.Err(), errors.Timeout, "pull of %s cancelled", remotePath)
+		}
+		if _, ok := err.(*errors.Err); !ok {
+			err = errors.WrapErrorf(err, errors.NetworkError, "error pulling %s", remotePath)
+		}
+	}
+	return n, err
+}
+
+// pullDestination reports errors writing to w as assertion errors, so they aren't taken for
+// errors reading from the device.
+type pullDestination struct {
+	w io.Writer
+}
+
+func (d *pullDestination) Write(p []byte) (int, error) {
+	n, err := d.w.Write(p)
+	if err != nil {
+		if _, ok := err.(*errors.Err); !ok {
+			err = errors.WrapErrorf(err, errors.AssertionError, "error writing pulled data")
+		}
+	}
+	return n, err
+}
+
+// restoreMetadata gives the file at localPath the permissions and modification time of entry.
+// Only regular files are restored: the metadata of a symlink is the link's, not its target's.
+func restoreMetadata(localPath string, entry *DirEntry) error {
+	if !entry.Mode.IsRegular() {
+		return nil
+	}
+	if err := os.Chmod(localPath, entry.Mode.Perm()); err != nil {
+		return wrapLocalFileError(err, localPath)
+	}
+	if err := os.Chtimes(localPath, entry.ModifiedAt, entry.ModifiedAt); err != nil {
+		return wrapLocalFileError(err, localPath)
+	}
+	return nil
+}
+
+// progressReader calls progress with the number of bytes of each read from r.
+type progressReader struct {
+	r        io.Reader
+	progress func(n int)
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if n > 0 {
+		r.progress(n)
+	}
+	return n, err
+}
+
+// localPathForOS returns path as it should be passed to the file system of goos.
+func localPathForOS(path, goos string) string {
+	if goos != "windows" || len(path) < windowsMaxPath || strings.HasPrefix(path, `\\?\`) {
+		return path
+	}
+	// The prefix turns off path normalization, so the path must be absolute and only use
+	// backslashes.
+	path = strings.Replace(path, "/", `\`, -1)
+	if !isWindowsAbs(path) {
+		if abs, err := filepath.Abs(path); err == nil {
+			path = abs
+		}
+	}
+	if strings.HasPrefix(path, `\\`) {
+		return `\\?\UNC\` + path[2:]
+	}
+	return `\\?\` + path
+}
+
+// isWindowsAbs returns true if path, which only uses backslashes, is a Windows path starting
+// with a drive letter, like C:\dir, or a UNC path, like \\server\share.
+func isWindowsAbs(path string) bool {
+	if strings.HasPrefix(path, `\\`) {
+		return true
+	}
+	return len(path) >= 3 && path[1] == ':' && path[2] == '\\' &&
+		('a' <= path[0] && path[0] <= 'z' || 'A' <= path[0] && path[0] <= 'Z')
+}
+
+// crlfWriter converts LF line endings to CRLF, leaving existing CRLFs alone.
+type crlfWriter struct {
+	w io.Writer
+	// Whether the last byte written was a CR.
+	afterCR bool
+	buf     bytes.Buffer
+}
+
+func (w *crlfWriter) Write(p []byte) (int, error) {
+	w.buf.Reset()
+	for _, b := range p {
+		if b == '\n' && !w.afterCR {
+			w.buf.WriteByte('\r')
+		}
+		w.buf.WriteByte(b)
+		w.afterCR = b == '\r'
+	}
+	if _, err := w.w.Write(w.buf.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (w *crlfWriter) Close() error {
+	return nil
+}
+
+// lfReader converts CRLF line endings to LF. Lone CRs are left alone.
+type lfReader struct {
+	r   io.Reader
+	buf [32 * 1024]byte
+	// Converted data that hasn't been read yet, in converted.
+	out       []byte
+	converted [32*1024 + 1]byte
+	// Whether the last byte read from r was a CR, which is held back until the next byte
+	// shows whether it ends a line.
+	pendingCR bool
+	err       error
+}
+
+func (r *lfReader) Read(p []byte) (int, error) {
+	for len(r.out) == 0 {
+		if r.err != nil {
+			if r.pendingCR {
+				r.pendingCR = false
+				r.out = []byte{'\r'}
+				break
+			}
+			return 0, r.err
+		}
+
+		var n int
+		n, r.err = r.r.Read(r.buf[:])
+		out := r.converted[:0]
+		for _, b := range r.buf[:n] {
+			if r.pendingCR && b != '\n' {
+				out = append(out, '\r')
+			}
+			r.pendingCR = b == '\r'
+			if !r.pendingCR {
+				out = append(out, b)
+			}
+		}
+		r.out = out
+	}
+	n := copy(p, r.out)
+	r.out = r.out[n:]
+	return n, nil
+}
@@ -0,0 +1,141 @@
+package adb
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"strings"
+
+	"github.com/mqhack/goadb/internal/errors"
+)
+
+// Printed by the checksum script if the device has no tool for the algorithm.
+const noChecksumToolMarker = "goadb:no-checksum-tool"
+
+// ChecksumAlgorithm is a hash function transfers can be verified with.
+type ChecksumAlgorithm int
+
+const (
+	// ChecksumNone doesn't verify transfers.
+	ChecksumNone ChecksumAlgorithm = iota
+	// ChecksumMD5 verifies transfers with md5sum on the device, which is fast and available
+	// on more devices, but only detects accidental corruption.
+	ChecksumMD5
+	// ChecksumSHA256 verifies transfers with sha256sum on the device.
+	ChecksumSHA256
+)
+
+func (a ChecksumAlgorithm) String() string {
+	switch a {
+	case ChecksumNone:
+		return "none"
+	case ChecksumMD5:
+		return "MD5"
+	case ChecksumSHA256:
+		return "SHA-256"
+	default:
+		return fmt.Sprintf("ChecksumAlgorithm(%d)", int(a))
+	}
+}
+
+// newHash returns a hash for the algorithm, or nil for ChecksumNone.
+func (a ChecksumAlgorithm) newHash() (hash.Hash, error) {
+	switch a {
+	case ChecksumNone:
+		return nil, nil
+	case ChecksumMD5:
+		return md5.New(), nil
+	case ChecksumSHA256:
+		return sha256.New(), nil
+	default:
+		return nil, errors.Errorf(errors.AssertionError, "invalid checksum algorithm %d", int(a))
+	}
+}
+
+// tool returns the name of the command that computes the algorithm's checksums on the
+// device.
+func (a ChecksumAlgorithm) tool() string {
+	if a == ChecksumSHA256 {
+		return "sha256sum"
+	}
+	return "md5sum"
+}
+
+// verifyRemoteChecksum checks that the checksum of the file at remotePath on the device is
+// sum, the checksum of the data that was transferred.
+func (c *Device) verifyRemoteChecksum(algorithm ChecksumAlgorithm, remotePath string, sum []byte) error {
+	remote, err := c.remoteChecksum(algorithm, remotePath)
+	if err != nil {
+		return err
+	}
+	if expected := hex.EncodeToString(sum); remote != expected {
+		return errors.Errorf(errors.ChecksumMismatch, "%s of %s on the device is %s, but %s was transferred",
+			algorithm, remotePath, remote, expected)
+	}
+	return nil
+}
+
+// remoteChecksum returns the checksum of the file at remotePath on the device.
+func (c *Device) remoteChecksum(algorithm ChecksumAlgorithm, remotePath string) (string, error) {
+	output, err := c.runChecksumTool(algorithm, " "+shellQuote(remotePath))
+	if err != nil {
+		return "", err
+	}
+	return parseChecksumOutput(output)
+}
+
+// remoteChecksums returns the checksums of the files at remotePaths on the device, by path,
+// with as few commands as possible. Files that couldn't be read are left out.
+func (c *Device) remoteChecksums(algorithm ChecksumAlgorithm, remotePaths []string) (map[string]string, error) {
+	args := make([]string, len(remotePaths))
+	for i, p := range remotePaths {
+		args[i] = " " + shellQuote(p)
+	}
+	sums := make(map[string]string)
+	for _, batch := range shellBatches("", args, "") {
+		output, err := c.runChecksumTool(algorithm, batch.cmd)
+		if err != nil {
+			return nil, err
+		}
+		// Each line is the checksum, then the path. Errors are printed for files that
+		// couldn't be read instead.
+		for _, line := range strings.Split(output, "\n") {
+			sum, p, ok := strings.Cut(strings.TrimRight(line, "\r"), " ")
+			if ok && isHex(sum) {
+				sums[strings.TrimLeft(p, " *")] = strings.ToLower(sum)
+			}
+		}
+	}
+	return sums, nil
+}
+
+// runChecksumTool runs the algorithm's tool on the PATH, or toybox's or busybox's if it isn't,
+// with args, the quoted paths each preceded by a space, and returns its output.
+func (c *Device) runChecksumTool(algorithm ChecksumAlgorithm, args string) (string, error) {
+	return c.runChecksumScript(algorithm, checksumScript(algorithm, args))
+}
+
+// checksumScript returns a script that runs the algorithm's tool like runChecksumTool, or prints
+// noChecksumToolMarker if the device has none. With no args, the tool reads stdin.
+func checksumScript(algorithm ChecksumAlgorithm, args string) string {
+	tool := algorithm.tool()
+	script := "set --" + args + "; if command -v " + tool + " >/dev/null 2>&1; then " + tool + ` "$@"`
+	for _, multicall := range []string{"toybox", "busybox"} {
+		script += "; elif " + multicall + " " + tool + " </dev/null >/dev/null 2>&1; then " + multicall + " " + tool + ` "$@"`
+	}
+	return script + "; else echo " + noChecksumToolMarker + "; fi"
+}
+
+// runChecksumScript runs cmd, which contains a checksumScript, and returns its output.
+func (c *Device) runChecksumScript(algorithm ChecksumAlgorithm, cmd string) (string, error) {
+	output, err := c.RunCommand(cmd)
+	if err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(output) == noChecksumToolMarker {
+		return "", errors.Errorf(errors.RequirementNotMet, "device has no %s, toybox or busybox to compute checksums with", algorithm.tool())
+	}
+	return output, nil
+}
@@ -0,0 +1,76 @@
+package adb
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mqhack/goadb/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const helloMD5 = "5d41402abc4b2a76b9719d911017c592"
+
+func TestRemoteChecksum(t *testing.T) {
+	s := &MockServer{
+		Status:   wire.StatusSuccess,
+		Messages: []string{"2CF24DBA5FB0A30E26E83B2AC5B9E29E1B161E5C1FA7425E73043362938B9824  /sdcard/a.txt\r\n"},
+	}
+	device := (&Adb{server: s}).Device(AnyDevice())
+
+	sum, err := device.remoteChecksum(ChecksumSHA256, "/sdcard/a.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824", sum)
+	assert.Equal(t, `shell:set -- '/sdcard/a.txt'; if command -v sha256sum >/dev/null 2>&1; then sha256sum "$@"`+
+		`; elif toybox sha256sum </dev/null >/dev/null 2>&1; then toybox sha256sum "$@"`+
+		`; elif busybox sha256sum </dev/null >/dev/null 2>&1; then busybox sha256sum "$@"`+
+		"; else echo goadb:no-checksum-tool; fi", s.Requests[1])
+
+	s = &MockServer{Status: wire.StatusSuccess, Messages: []string{noChecksumToolMarker + "\r\n"}}
+	device = (&Adb{server: s}).Device(AnyDevice())
+	_, err = device.remoteChecksum(ChecksumMD5, "/sdcard/a.txt")
+	assert.True(t, HasErrCode(err, RequirementNotMet))
+}
+
+func TestPushFileVerifyChecksum(t *testing.T) {
+	localPath := filepath.Join(t.TempDir(), "a.txt")
+	require.NoError(t, ioutil.WriteFile(localPath, []byte("hello"), 0644))
+	opts := TransferOptions{VerifyChecksum: ChecksumMD5}
+
+	s := &MockServer{Status: wire.StatusSuccess, Messages: []string{helloMD5 + "  /sdcard/a.txt\n"}}
+	device := v1SyncDevice(s)
+	require.NoError(t, device.PushFile(localPath, "/sdcard/a.txt", opts))
+	assert.True(t, strings.Contains(s.Requests[3], "if command -v md5sum"), s.Requests[3])
+
+	s = &MockServer{Status: wire.StatusSuccess, Messages: []string{"d41d8cd98f00b204e9800998ecf8427e  /sdcard/a.txt\n"}}
+	device = v1SyncDevice(s)
+	err := device.PushFile(localPath, "/sdcard/a.txt", opts)
+	assert.True(t, HasErrCode(err, ChecksumMismatch))
+}
+
+func TestPullFileVerifyChecksum(t *testing.T) {
+	localPath := filepath.Join(t.TempDir(), "a.txt")
+	opts := TransferOptions{VerifyChecksum: ChecksumMD5}
+
+	s := &MockServer{
+		Status:   wire.StatusSuccess,
+		Messages: []string{"DATA\x05\x00\x00\x00hello", "DONE\x00\x00\x00\x00", helloMD5 + "  /sdcard/a.txt\n"},
+	}
+	require.NoError(t, v1SyncDevice(s).PullFile("/sdcard/a.txt", localPath, opts))
+	data, err := ioutil.ReadFile(localPath)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(data))
+
+	// A file that doesn't match is removed.
+	s = &MockServer{
+		Status:   wire.StatusSuccess,
+		Messages: []string{"DATA\x05\x00\x00\x00hellp", "DONE\x00\x00\x00\x00", helloMD5 + "  /sdcard/a.txt\n"},
+	}
+	err = v1SyncDevice(s).PullFile("/sdcard/a.txt", localPath, opts)
+	assert.True(t, HasErrCode(err, ChecksumMismatch))
+	_, err = os.Stat(localPath)
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,203 @@
+package adb
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/mqhack/goadb/internal/errors"
+)
+
+// DefaultTransferWorkers is how many files a TransferManager transfers at once if
+// TransferManagerOptions.Workers isn't set.
+const DefaultTransferWorkers = 4
+
+// TransferDirection is whether a TransferJob pushes or pulls.
+type TransferDirection int
+
+const (
+	// TransferPush pushes the local file to the device.
+	TransferPush TransferDirection = iota
+	// TransferPull pulls the remote file from the device.
+	TransferPull
+)
+
+// TransferJob is a file for a TransferManager to push or pull.
+type TransferJob struct {
+	Direction             TransferDirection
+	LocalPath, RemotePath string
+	// Size is the size of the file being pulled, if it's known, for the progress totals.
+	// Pushed files' sizes are read from the local file system.
+	Size int64
+}
+
+// TransferManagerOptions configures a TransferManager.
+type TransferManagerOptions struct {
+	// TransferOptions is how each file's path and contents are translated.
+	TransferOptions
+	// BulkOptions controls whether the transfer stops at the first file that fails. Files
+	// that are already being transferred when one fails are finished.
+	BulkOptions
+
+	// Workers is how many files are transferred at once, each over its own sync connection.
+	// Defaults to DefaultTransferWorkers.
+	Workers int
+
+	// Progress, if set, is called as the files are transferred, from the goroutine that
+	// called Run, so calls are never concurrent and the totals only increase. Path is the
+	// RemotePath of the job the call reports on.
+	Progress func(DirTransferProgress)
+}
+
+/*
+TransferManager pushes and pulls many files concurrently, which is much faster than
+transferring them one after another when there are many small files, since each file's
+round trips overlap with the others'.
+*/
+type TransferManager struct {
+	device *Device
+	opts   TransferManagerOptions
+}
+
+// NewTransferManager returns a TransferManager that transfers files to and from the device.
+func (c *Device) NewTransferManager(opts TransferManagerOptions) *TransferManager {
+	return &TransferManager{device: c, opts: opts}
+}
+
+// transferEvent is sent by a worker when a job has transferred n more bytes, or finished.
+type transferEvent struct {
+	job  int
+	n    int
+	done bool
+	err  error
+}
+
+/*
+Run transfers jobs, and reports the result for each by its RemotePath, in the order of jobs
+regardless of the order they finished in. Pulled files' local directories are created as
+needed, like the device creates pushed files' remote directories.
+
+The returned error is only non-nil if ctx is done, in which case the error has code Timeout,
+the jobs being transferred fail, and jobs that weren't started are in PartialResult.Skipped.
+*/
+func (m *TransferManager) Run(ctx context.Context, jobs []TransferJob) (*PartialResult, error) {
+	workers := m.opts.Workers
+	if workers <= 0 {
+		workers = DefaultTransferWorkers
+	}
+	if workers > len(jobs) {
+		workers = len(jobs)
+	}
+
+	opts := m.opts.TransferOptions.withSharedRateLimit()
+	sizes := make([]int64, len(jobs))
+	total := DirTransferProgress{TotalFiles: len(jobs)}
+	for i, job := range jobs {
+		sizes[i] = job.Size
+		if job.Direction == TransferPush {
+			// A file that can't be stat'd fails when it's pushed.
+			if info, err := os.Stat(m.opts.LocalPath(job.LocalPath)); err == nil {
+				sizes[i] = info.Size()
+			}
+		}
+		total.TotalBytes += sizes[i]
+	}
+
+	next := make(chan int)
+	events := make(chan transferEvent)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				err := m.transfer(ctx, jobs[i], opts, func(n int) {
+					events <- transferEvent{job: i, n: n}
+				})
+				events <- transferEvent{job: i, done: true, err: err}
+			}
+		}()
+	}
+
+	report := func(i int, fileBytes int64) {
+		if m.opts.Progress != nil {
+			current := total
+			current.Path, current.FileBytes, current.FileSize = jobs[i].RemotePath, fileBytes, sizes[i]
+			m.opts.Progress(current)
+		}
+	}
+
+	// Jobs [0, started) have been handed to workers, and finished of them are done.
+	errs := make([]error, len(jobs))
+	fileBytes := make([]int64, len(jobs))
+	started, finished := 0, 0
+	failed := false
+	for {
+		stopping := ctx.Err() != nil || m.opts.FailFast && failed
+		if finished == started && (started == len(jobs) || stopping) {
+			break
+		}
+		var send chan<- int
+		var done <-chan struct{}
+		if started < len(jobs) && !stopping {
+			send, done = next, ctx.Done()
+		}
+
+		select {
+		case send <- started:
+			report(started, 0)
+			started++
+		case event := <-events:
+			if !event.done {
+				fileBytes[event.job] += int64(event.n)
+				total.Bytes += int64(event.n)
+				report(event.job, fileBytes[event.job])
+				continue
+			}
+			errs[event.job] = event.err
+			failed = failed || event.err != nil
+			finished++
+			total.Files = finished
+		case <-done:
+		}
+	}
+	close(next)
+	wg.Wait()
+	if m.opts.Progress != nil {
+		m.opts.Progress(total)
+	}
+
+	runner := newBulkRunner(m.opts.BulkOptions)
+	for i, job := range jobs {
+		switch {
+		case i >= started:
+			runner.result.Skipped = append(runner.result.Skipped, job.RemotePath)
+		case errs[i] != nil:
+			runner.fail(job.RemotePath, errs[i])
+		default:
+			runner.result.Succeeded = append(runner.result.Succeeded, job.RemotePath)
+		}
+	}
+	if ctx.Err() != nil {
+		return runner.result, wrapClientError(errors.WrapErrorf(ctx.Err(), errors.Timeout,
+			"transfer cancelled after %d of %d files", finished, len(jobs)), m.device, "TransferManager.Run")
+	}
+	return runner.result, nil
+}
+
+// transfer pushes or pulls job, calling progress with the number of bytes transferred as it
+// goes.
+func (m *TransferManager) transfer(ctx context.Context, job TransferJob, opts TransferOptions, progress func(n int)) error {
+	if ctx.Err() != nil {
+		return errors.WrapErrorf(ctx.Err(), errors.Timeout, "transfer of %s cancelled", job.RemotePath)
+	}
+	if job.Direction == TransferPush {
+		return m.device.pushFile(ctx, job.LocalPath, job.RemotePath, opts, progress)
+	}
+	dir := opts.LocalPath(filepath.Dir(job.LocalPath))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return wrapLocalFileError(err, dir)
+	}
+	return m.device.pullFile(ctx, job.RemotePath, job.LocalPath, opts, nil, progress)
+}
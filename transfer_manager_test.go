@@ -0,0 +1,82 @@
+package adb
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/mqhack/goadb/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// pushJobs writes n local files, and returns jobs pushing them to /sdcard.
+func pushJobs(t *testing.T, n int) []TransferJob {
+	dir := t.TempDir()
+	var jobs []TransferJob
+	for i := 0; i < n; i++ {
+		localPath := filepath.Join(dir, fmt.Sprintf("%d.txt", i))
+		require.NoError(t, ioutil.WriteFile(localPath, []byte("hello"), 0644))
+		jobs = append(jobs, TransferJob{Direction: TransferPush, LocalPath: localPath, RemotePath: fmt.Sprintf("/sdcard/%d.txt", i)})
+	}
+	return jobs
+}
+
+func TestTransferManagerPush(t *testing.T) {
+	s := &MockServer{Status: wire.StatusSuccess}
+	jobs := pushJobs(t, 10)
+	var progress []DirTransferProgress
+	manager := v1SyncDevice(s).NewTransferManager(TransferManagerOptions{
+		Workers:  3,
+		Progress: func(p DirTransferProgress) { progress = append(progress, p) },
+	})
+
+	result, err := manager.Run(context.Background(), jobs)
+	require.NoError(t, err)
+	assert.True(t, result.OK())
+	var expected []string
+	for _, job := range jobs {
+		expected = append(expected, job.RemotePath)
+	}
+	assert.Equal(t, expected, result.Succeeded)
+
+	assert.Equal(t, DirTransferProgress{Files: 10, TotalFiles: 10, Bytes: 50, TotalBytes: 50}, progress[len(progress)-1])
+	for i := 1; i < len(progress); i++ {
+		assert.True(t, progress[i].Bytes >= progress[i-1].Bytes && progress[i].Files >= progress[i-1].Files)
+	}
+	assert.Len(t, s.Requests, 20)
+}
+
+func TestTransferManagerFailFast(t *testing.T) {
+	s := &MockServer{Status: wire.StatusSuccess}
+	jobs := pushJobs(t, 4)
+	jobs[1].LocalPath += ".missing"
+	manager := v1SyncDevice(s).NewTransferManager(TransferManagerOptions{Workers: 1, BulkOptions: BulkOptions{FailFast: true}})
+
+	result, err := manager.Run(context.Background(), jobs)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/sdcard/0.txt"}, result.Succeeded)
+	require.Len(t, result.Failed, 1)
+	assert.Equal(t, "/sdcard/1.txt", result.Failed[0].Item)
+	assert.Equal(t, []string{"/sdcard/2.txt", "/sdcard/3.txt"}, result.Skipped)
+
+	// Without FailFast, the others are still pushed.
+	manager = v1SyncDevice(s).NewTransferManager(TransferManagerOptions{Workers: 2})
+	result, err = manager.Run(context.Background(), jobs)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/sdcard/0.txt", "/sdcard/2.txt", "/sdcard/3.txt"}, result.Succeeded)
+	assert.Len(t, result.Failed, 1)
+}
+
+func TestTransferManagerCancelled(t *testing.T) {
+	s := &MockServer{Status: wire.StatusSuccess}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	result, err := v1SyncDevice(s).NewTransferManager(TransferManagerOptions{}).Run(ctx, pushJobs(t, 3))
+	assert.True(t, HasErrCode(err, Timeout))
+	assert.Equal(t, []string{"/sdcard/0.txt", "/sdcard/1.txt", "/sdcard/2.txt"}, result.Skipped)
+	assert.Empty(t, s.Requests)
+}
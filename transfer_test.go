@@ -0,0 +1,164 @@
+package adb
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/mqhack/goadb/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalPathForOS(t *testing.T) {
+	long := `C:\Users\me\` + strings.Repeat("a", windowsMaxPath)
+	assert.Equal(t, `C:\short\file.txt`, localPathForOS(`C:\short\file.txt`, "windows"))
+	assert.Equal(t, long, localPathForOS(long, "linux"))
+	assert.Equal(t, `\\?\UNC\server\share`+strings.Repeat(`\a`, windowsMaxPath),
+		localPathForOS(`\\server\share`+strings.Repeat(`/a`, windowsMaxPath), "windows"))
+	assert.Equal(t, `\\?\`+long, localPathForOS(`\\?\`+long, "windows"))
+	assert.Equal(t, `\\?\`+long, localPathForOS(strings.Replace(long, `\`, "/", -1), "windows"))
+}
+
+func TestTransferOptionsRemotePath(t *testing.T) {
+	assert.Equal(t, `sdcard\foo.txt`, TransferOptions{}.RemotePath(`sdcard\foo.txt`))
+	assert.Equal(t, "/sdcard/dir/foo.txt", TransferOptions{TranslateBackslashes: true}.RemotePath(`/sdcard\dir\foo.txt`))
+}
+
+func TestCRLFWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := TransferOptions{Newlines: NewlinesCRLF}.PullWriter(&buf)
+	for _, s := range []string{"one\ntwo\r", "\nthree\n", "\n"} {
+		n, err := w.Write([]byte(s))
+		assert.NoError(t, err)
+		assert.Equal(t, len(s), n)
+	}
+	assert.NoError(t, w.Close())
+	assert.Equal(t, "one\r\ntwo\r\nthree\r\n\r\n", buf.String())
+}
+
+func TestPullWriterUnchanged(t *testing.T) {
+	var buf bytes.Buffer
+	w := TransferOptions{}.PullWriter(&buf)
+	w.Write([]byte("one\ntwo\r\n"))
+	assert.NoError(t, w.Close())
+	assert.Equal(t, "one\ntwo\r\n", buf.String())
+}
+
+func TestLFReader(t *testing.T) {
+	r := TransferOptions{Newlines: NewlinesNative}.PushReader(strings.NewReader("one\r\ntwo\rthree\r\n\r"))
+	data, err := ioutil.ReadAll(r)
+	assert.NoError(t, err)
+	assert.Equal(t, "one\ntwo\rthree\n\r", string(data))
+
+	r = TransferOptions{Newlines: NewlinesCRLF}.PushReader(iotest.OneByteReader(strings.NewReader("a\r\nb\r\r\n")))
+	data, err = ioutil.ReadAll(iotest.OneByteReader(r))
+	assert.NoError(t, err)
+	assert.Equal(t, "a\nb\r\n", string(data))
+}
+
+func TestPushReaderUnchanged(t *testing.T) {
+	r := strings.NewReader("one\r\n")
+	assert.Equal(t, r, TransferOptions{}.PushReader(r))
+}
+
+func TestRestoreMetadata(t *testing.T) {
+	localPath := filepath.Join(t.TempDir(), "file")
+	require.NoError(t, ioutil.WriteFile(localPath, []byte("data"), 0600))
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	require.NoError(t, restoreMetadata(localPath, &DirEntry{Mode: 0755, ModifiedAt: mtime}))
+	info, err := os.Stat(localPath)
+	require.NoError(t, err)
+	if runtime.GOOS != "windows" {
+		assert.Equal(t, os.FileMode(0755), info.Mode().Perm())
+	}
+	assert.True(t, mtime.Equal(info.ModTime()))
+
+	// Symlinks' metadata isn't applied to the pulled target.
+	require.NoError(t, restoreMetadata(localPath, &DirEntry{Mode: os.ModeSymlink | 0777, ModifiedAt: time.Unix(0, 0)}))
+	info, err = os.Stat(localPath)
+	require.NoError(t, err)
+	assert.True(t, mtime.Equal(info.ModTime()))
+}
+
+func TestDevicePushReader(t *testing.T) {
+	s := &MockServer{Status: wire.StatusSuccess}
+	device := v1SyncDevice(s)
+
+	err := device.PushReader(context.Background(), strings.NewReader("hello"), 5, "/sdcard/a.txt", 0640)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"host:transport-any", "sync:"}, s.Requests)
+	assert.True(t, strings.HasPrefix(string(s.Written), "SEND\x11\x00\x00\x00/sdcard/a.txt,416DATA\x05\x00\x00\x00helloDONE"),
+		"%q", s.Written)
+}
+
+func TestDevicePushReaderUnknownSize(t *testing.T) {
+	s := &MockServer{Status: wire.StatusSuccess}
+	device := v1SyncDevice(s)
+
+	require.NoError(t, device.PushReader(context.Background(), strings.NewReader("hello"), -1, "/sdcard/a.txt", 0644))
+	assert.True(t, strings.Contains(string(s.Written), "DATA\x05\x00\x00\x00helloDONE"), "%q", s.Written)
+}
+
+func TestDevicePushReaderWrongSize(t *testing.T) {
+	for _, size := range []int64{4, 6} {
+		s := &MockServer{Status: wire.StatusSuccess}
+		device := v1SyncDevice(s)
+
+		err := device.PushReader(context.Background(), strings.NewReader("hello"), size, "/sdcard/a.txt", 0644)
+		assert.True(t, HasErrCode(err, AssertionError), "size %d", size)
+		// The file isn't finished, so the device discards it.
+		assert.False(t, strings.Contains(string(s.Written), "DONE"), "size %d: %q", size, s.Written)
+	}
+}
+
+func TestDevicePushReaderReadError(t *testing.T) {
+	s := &MockServer{Status: wire.StatusSuccess}
+	device := v1SyncDevice(s)
+
+	r := io.MultiReader(strings.NewReader("hel"), iotest.ErrReader(errors.New("connection reset")))
+	err := device.PushReader(context.Background(), r, -1, "/sdcard/a.txt", 0644)
+	assert.True(t, HasErrCode(err, NetworkError))
+	assert.False(t, strings.Contains(string(s.Written), "DONE"), "%q", s.Written)
+}
+
+func TestDevicePullTo(t *testing.T) {
+	s := &MockServer{
+		Status:   wire.StatusSuccess,
+		Messages: []string{"DATA\x05\x00\x00\x00hello", "DONE\x00\x00\x00\x00"},
+	}
+	device := v1SyncDevice(s)
+
+	var buf bytes.Buffer
+	n, err := device.PullTo(context.Background(), "/sdcard/a.txt", &buf)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), n)
+	assert.Equal(t, "hello", buf.String())
+	assert.Equal(t, []string{"host:transport-any", "sync:"}, s.Requests)
+	assert.Equal(t, "RECV\x0d\x00\x00\x00/sdcard/a.txt", string(s.Written))
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) { return 0, errors.New("disk full") }
+
+func TestDevicePullToWriteError(t *testing.T) {
+	s := &MockServer{
+		Status:   wire.StatusSuccess,
+		Messages: []string{"DATA\x05\x00\x00\x00hello", "DONE\x00\x00\x00\x00"},
+	}
+	device := v1SyncDevice(s)
+
+	_, err := device.PullTo(context.Background(), "/sdcard/a.txt", failingWriter{})
+	assert.True(t, HasErrCode(err, AssertionError))
+}
@@ -0,0 +1,252 @@
+package adb
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mqhack/goadb/internal/errors"
+)
+
+// Prefix of the certificate fingerprints in a trust store.
+const fingerprintPrefix = "sha256:"
+
+// Marks a line of a trust store file listing a revoked fingerprint.
+const revokedMarker = "@revoked"
+
+/*
+TrustStore records the certificate each device presented the first time it was connected to
+over TLS, like SSH's known_hosts, so a device whose identity changes is detected. It's for
+clients of adbd's TLS transport (wireless debugging), which authenticate devices by their
+self-signed certificates.
+
+A device that isn't in the store is trusted on first use. After that, only the same
+certificate is accepted for its serial; a different one fails with UntrustedDevice until the
+device is forgotten. Revoked certificates are never accepted, for any serial.
+
+The store is saved to its file after every change. Lines of the file look like
+
+	192.168.1.23:5555 sha256:4f1c... 2024-03-01T12:00:00Z
+	@revoked sha256:9ab2...
+*/
+type TrustStore struct {
+	path string
+	now  func() time.Time
+
+	mu      sync.Mutex
+	devices map[string]TrustedDevice
+	revoked map[string]bool
+}
+
+// TrustedDevice is a device recorded in a TrustStore.
+type TrustedDevice struct {
+	Serial string
+	// Fingerprint is the SHA-256 of the device's certificate, e.g. "sha256:4f1c...".
+	Fingerprint string
+	// TrustedAt is when the device was first connected to.
+	TrustedAt time.Time
+}
+
+// OpenTrustStore loads the trust store saved at path. If the file doesn't exist, the store is
+// empty, and the file is created when the first device is trusted.
+func OpenTrustStore(path string) (*TrustStore, error) {
+	store := &TrustStore{
+		path:    path,
+		now:     time.Now,
+		devices: make(map[string]TrustedDevice),
+		revoked: make(map[string]bool),
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return store, nil
+	} else if err != nil {
+		return nil, wrapLocalFileError(err, path)
+	}
+	if err := store.parse(data); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// CertificateFingerprint returns the fingerprint a TrustStore records for cert.
+func CertificateFingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return fingerprintPrefix + hex.EncodeToString(sum[:])
+}
+
+/*
+Verify checks that cert is the certificate the device with serial is trusted with. If the
+device isn't in the store, it's added with cert, and firstUse is true.
+
+Returns an error with code UntrustedDevice if serial is trusted with a different certificate,
+or cert has been revoked.
+*/
+func (s *TrustStore) Verify(serial string, cert *x509.Certificate) (firstUse bool, err error) {
+	fingerprint := CertificateFingerprint(cert)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.revoked[fingerprint] {
+		return false, errors.Errorf(errors.UntrustedDevice, "certificate %s of device %s has been revoked", fingerprint, serial)
+	}
+	if device, ok := s.devices[serial]; ok {
+		if device.Fingerprint != fingerprint {
+			return false, errors.Errorf(errors.UntrustedDevice,
+				"certificate of device %s changed: trusted %s since %s, got %s",
+				serial, device.Fingerprint, device.TrustedAt.UTC().Format(time.RFC3339), fingerprint)
+		}
+		return false, nil
+	}
+
+	s.devices[serial] = TrustedDevice{Serial: serial, Fingerprint: fingerprint, TrustedAt: s.now().UTC().Truncate(time.Second)}
+	if err := s.saveLocked(); err != nil {
+		delete(s.devices, serial)
+		return false, err
+	}
+	return true, nil
+}
+
+/*
+VerifyPeerCertificate returns a function for tls.Config.VerifyPeerCertificate that verifies the
+certificate presented by the device with serial. tls.Config.InsecureSkipVerify must be set,
+since devices' certificates are self-signed.
+*/
+func (s *TrustStore) VerifyPeerCertificate(serial string) func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return errors.Errorf(errors.UntrustedDevice, "device %s didn't present a certificate", serial)
+		}
+		cert, err := x509.ParseCertificate(rawCerts[0])
+		if err != nil {
+			return errors.WrapErrorf(err, errors.ParseError, "error parsing certificate of device %s", serial)
+		}
+		_, err = s.Verify(serial, cert)
+		return err
+	}
+}
+
+// Devices returns the trusted devices, sorted by serial.
+func (s *TrustStore) Devices() []TrustedDevice {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sortedDevicesLocked()
+}
+
+// Forget removes the device with serial from the store, so whatever certificate it presents
+// next is trusted. It's for devices whose identity changed legitimately, e.g. after a factory
+// reset.
+func (s *TrustStore) Forget(serial string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	device, ok := s.devices[serial]
+	if !ok {
+		return nil
+	}
+	delete(s.devices, serial)
+	if err := s.saveLocked(); err != nil {
+		s.devices[serial] = device
+		return err
+	}
+	return nil
+}
+
+// Revoke forgets the device with serial, and rejects the certificate it was trusted with from
+// then on, for any serial. It's for devices that have been compromised or decommissioned.
+// Does nothing if serial isn't trusted.
+func (s *TrustStore) Revoke(serial string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	device, ok := s.devices[serial]
+	if !ok {
+		return nil
+	}
+	delete(s.devices, serial)
+	s.revoked[device.Fingerprint] = true
+	if err := s.saveLocked(); err != nil {
+		s.devices[serial] = device
+		delete(s.revoked, device.Fingerprint)
+		return err
+	}
+	return nil
+}
+
+func (s *TrustStore) parse(data []byte) error {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[0] == revokedMarker && strings.HasPrefix(fields[1], fingerprintPrefix) {
+			s.revoked[fields[1]] = true
+			continue
+		}
+		if len(fields) != 3 || !strings.HasPrefix(fields[1], fingerprintPrefix) {
+			return errors.Errorf(errors.ParseError, "malformed trust store line %d in %s: %s", lineNum, s.path, line)
+		}
+		trustedAt, err := time.Parse(time.RFC3339, fields[2])
+		if err != nil {
+			return errors.WrapErrorf(err, errors.ParseError, "malformed trust store line %d in %s: %s", lineNum, s.path, line)
+		}
+		s.devices[fields[0]] = TrustedDevice{Serial: fields[0], Fingerprint: fields[1], TrustedAt: trustedAt}
+	}
+	return nil
+}
+
+// saveLocked writes the store to a temporary file, and renames it over the store's file, so
+// the file is never partially written.
+func (s *TrustStore) saveLocked() error {
+	var buf bytes.Buffer
+	for _, device := range s.sortedDevicesLocked() {
+		fmt.Fprintf(&buf, "%s %s %s\n", device.Serial, device.Fingerprint, device.TrustedAt.UTC().Format(time.RFC3339))
+	}
+	revoked := make([]string, 0, len(s.revoked))
+	for fingerprint := range s.revoked {
+		revoked = append(revoked, fingerprint)
+	}
+	sort.Strings(revoked)
+	for _, fingerprint := range revoked {
+		fmt.Fprintf(&buf, "%s %s\n", revokedMarker, fingerprint)
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".tmp")
+	if err != nil {
+		return wrapLocalFileError(err, s.path)
+	}
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return wrapLocalFileError(err, tmp.Name())
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return wrapLocalFileError(err, tmp.Name())
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		os.Remove(tmp.Name())
+		return wrapLocalFileError(err, s.path)
+	}
+	return nil
+}
+
+func (s *TrustStore) sortedDevicesLocked() []TrustedDevice {
+	devices := make([]TrustedDevice, 0, len(s.devices))
+	for _, device := range s.devices {
+		devices = append(devices, device)
+	}
+	sort.Slice(devices, func(i, j int) bool {
+		return devices[i].Serial < devices[j].Serial
+	})
+	return devices
+}
@@ -0,0 +1,84 @@
+package adb
+
+import (
+	"crypto/x509"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrustStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "trust")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "known_devices")
+
+	store, err := OpenTrustStore(path)
+	require.NoError(t, err)
+	store.now = func() time.Time { return time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC) }
+	cert := &x509.Certificate{Raw: []byte("device certificate")}
+	other := &x509.Certificate{Raw: []byte("other certificate")}
+
+	firstUse, err := store.Verify("192.168.1.23:5555", cert)
+	require.NoError(t, err)
+	assert.True(t, firstUse)
+	firstUse, err = store.Verify("192.168.1.23:5555", cert)
+	require.NoError(t, err)
+	assert.False(t, firstUse)
+
+	_, err = store.Verify("192.168.1.23:5555", other)
+	assert.True(t, HasErrCode(err, UntrustedDevice))
+	assert.Contains(t, err.Error(), "certificate of device 192.168.1.23:5555 changed: trusted "+CertificateFingerprint(cert)+" since 2024-03-01T12:00:00Z")
+
+	// The store is reloaded from its file.
+	store, err = OpenTrustStore(path)
+	require.NoError(t, err)
+	assert.Equal(t, []TrustedDevice{{
+		Serial:      "192.168.1.23:5555",
+		Fingerprint: CertificateFingerprint(cert),
+		TrustedAt:   time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC),
+	}}, store.Devices())
+
+	require.NoError(t, store.Revoke("192.168.1.23:5555"))
+	assert.Empty(t, store.Devices())
+	_, err = store.Verify("192.168.1.24:5555", cert)
+	assert.True(t, HasErrCode(err, UntrustedDevice))
+	firstUse, err = store.Verify("192.168.1.23:5555", other)
+	require.NoError(t, err)
+	assert.True(t, firstUse)
+
+	require.NoError(t, store.Forget("192.168.1.23:5555"))
+	store, err = OpenTrustStore(path)
+	require.NoError(t, err)
+	assert.Empty(t, store.Devices())
+	_, err = store.Verify("192.168.1.23:5555", cert)
+	assert.True(t, HasErrCode(err, UntrustedDevice), "revocation should be saved")
+}
+
+func TestTrustStoreMalformed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "trust")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "known_devices")
+	require.NoError(t, ioutil.WriteFile(path, []byte("# comment\nSERIAL md5:abc 2024-03-01T12:00:00Z\n"), 0600))
+
+	_, err = OpenTrustStore(path)
+	assert.True(t, HasErrCode(err, ParseError))
+}
+
+func TestTrustStoreVerifyPeerCertificate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "trust")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	store, err := OpenTrustStore(filepath.Join(dir, "known_devices"))
+	require.NoError(t, err)
+
+	verify := store.VerifyPeerCertificate("SERIAL")
+	assert.True(t, HasErrCode(verify(nil, nil), UntrustedDevice))
+	assert.True(t, HasErrCode(verify([][]byte{[]byte("not a certificate")}, nil), ParseError))
+}
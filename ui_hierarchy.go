@@ -0,0 +1,221 @@
+package adb
+
+import (
+	"context"
+	"encoding/xml"
+	"image"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/mqhack/goadb/internal/errors"
+)
+
+// Where uiautomator dumps the UI hierarchy to, before it's pulled.
+const uiHierarchyDumpPath = "/data/local/tmp/goadb-ui.xml"
+
+// UIHierarchy is the tree of views on the screen, as dumped by uiautomator.
+type UIHierarchy struct {
+	// Rotation is the display's rotation, from 0 to 3 in quarter turns.
+	Rotation int
+	// Nodes are the root views of the windows on the screen.
+	Nodes []*UINode
+}
+
+// UINode is a view in a UIHierarchy.
+type UINode struct {
+	// Class is the view's class, e.g. "android.widget.Button".
+	Class string
+	// ResourceID is the view's ID, e.g. "com.android.settings:id/title", or "" if it has none.
+	ResourceID string
+	Text       string
+	// ContentDesc is the view's content description, which accessibility services read out.
+	ContentDesc string
+	Package     string
+	// Bounds is where the view is on the screen, in pixels.
+	Bounds image.Rectangle
+
+	Checkable     bool
+	Checked       bool
+	Clickable     bool
+	Enabled       bool
+	Focusable     bool
+	Focused       bool
+	LongClickable bool
+	Password      bool
+	Scrollable    bool
+	Selected      bool
+
+	Children []*UINode
+}
+
+// Walk calls fn for each node of the hierarchy, parents before their children. If fn returns
+// false, the node's children are skipped.
+func (h *UIHierarchy) Walk(fn func(node *UINode) bool) {
+	for _, node := range h.Nodes {
+		node.Walk(fn)
+	}
+}
+
+// Walk calls fn for n and its descendants, parents before their children. If fn returns false,
+// the node's children are skipped.
+func (n *UINode) Walk(fn func(node *UINode) bool) {
+	if !fn(n) {
+		return
+	}
+	for _, child := range n.Children {
+		child.Walk(fn)
+	}
+}
+
+/*
+DumpUIHierarchy returns the views on the screen. The screen must be idle for uiautomator to
+dump it, so it fails while an animation is running.
+
+Corresponds to the commands:
+
+	adb shell uiautomator dump /data/local/tmp/goadb-ui.xml
+	adb pull /data/local/tmp/goadb-ui.xml
+*/
+func (c *Device) DumpUIHierarchy(ctx context.Context) (*UIHierarchy, error) {
+	if err := c.dumpUIHierarchy(ctx); err != nil {
+		return nil, wrapClientError(err, c, "DumpUIHierarchy")
+	}
+	defer c.RunCommand("rm", "-f", uiHierarchyDumpPath)
+
+	reader, err := c.OpenRead(uiHierarchyDumpPath)
+	if err != nil {
+		return nil, wrapClientError(err, c, "DumpUIHierarchy")
+	}
+	defer reader.Close()
+	stop := closeWhenDone(ctx, reader)
+	defer stop()
+
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		if ctx.Err() != nil {
+			err = errors.WrapErrorf(ctx.Err(), errors.Timeout, "pull of %s cancelled", uiHierarchyDumpPath)
+		} else if _, ok := err.(*errors.Err); !ok {
+			err = errors.WrapErrorf(err, errors.NetworkError, "error pulling %s", uiHierarchyDumpPath)
+		}
+		return nil, wrapClientError(err, c, "DumpUIHierarchy")
+	}
+
+	hierarchy, err := parseUIHierarchy(data)
+	return hierarchy, wrapClientError(err, c, "DumpUIHierarchy")
+}
+
+func (c *Device) dumpUIHierarchy(ctx context.Context) error {
+	conn, err := c.openExec("uiautomator", "dump", uiHierarchyDumpPath)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	stop := closeWhenDone(ctx, conn)
+	defer stop()
+
+	output, err := ioutil.ReadAll(conn)
+	if ctx.Err() != nil {
+		return errors.WrapErrorf(ctx.Err(), errors.Timeout, "uiautomator dump didn't complete")
+	}
+	if err != nil {
+		return errors.WrapErrorf(err, errors.NetworkError, "error reading uiautomator output")
+	}
+	// uiautomator prints "UI hierchary dumped to: <path>" on success, and an error message
+	// otherwise, e.g. "ERROR: could not get idle state.", always exiting with status 0.
+	if !strings.Contains(string(output), "dumped to:") {
+		return errors.Errorf(errors.AdbError, "uiautomator dump failed: %s", strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// Matches the bounds attribute of a node, e.g. "[0,63][1080,210]".
+var uiBoundsPattern = regexp.MustCompile(`^\[(-?\d+),(-?\d+)\]\[(-?\d+),(-?\d+)\]$`)
+
+// The XML written by uiautomator dump.
+type xmlUIHierarchy struct {
+	Rotation int         `xml:"rotation,attr"`
+	Nodes    []xmlUINode `xml:"node"`
+}
+
+type xmlUINode struct {
+	Class         string      `xml:"class,attr"`
+	ResourceID    string      `xml:"resource-id,attr"`
+	Text          string      `xml:"text,attr"`
+	ContentDesc   string      `xml:"content-desc,attr"`
+	Package       string      `xml:"package,attr"`
+	Bounds        string      `xml:"bounds,attr"`
+	Checkable     bool        `xml:"checkable,attr"`
+	Checked       bool        `xml:"checked,attr"`
+	Clickable     bool        `xml:"clickable,attr"`
+	Enabled       bool        `xml:"enabled,attr"`
+	Focusable     bool        `xml:"focusable,attr"`
+	Focused       bool        `xml:"focused,attr"`
+	LongClickable bool        `xml:"long-clickable,attr"`
+	Password      bool        `xml:"password,attr"`
+	Scrollable    bool        `xml:"scrollable,attr"`
+	Selected      bool        `xml:"selected,attr"`
+	Children      []xmlUINode `xml:"node"`
+}
+
+func parseUIHierarchy(data []byte) (*UIHierarchy, error) {
+	var doc xmlUIHierarchy
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil, errors.WrapErrorf(err, errors.ParseError, "error parsing UI hierarchy")
+	}
+	hierarchy := &UIHierarchy{Rotation: doc.Rotation}
+	for _, node := range doc.Nodes {
+		n, err := node.toUINode()
+		if err != nil {
+			return nil, err
+		}
+		hierarchy.Nodes = append(hierarchy.Nodes, n)
+	}
+	return hierarchy, nil
+}
+
+func (x xmlUINode) toUINode() (*UINode, error) {
+	bounds, err := parseUIBounds(x.Bounds)
+	if err != nil {
+		return nil, err
+	}
+	node := &UINode{
+		Class:         x.Class,
+		ResourceID:    x.ResourceID,
+		Text:          x.Text,
+		ContentDesc:   x.ContentDesc,
+		Package:       x.Package,
+		Bounds:        bounds,
+		Checkable:     x.Checkable,
+		Checked:       x.Checked,
+		Clickable:     x.Clickable,
+		Enabled:       x.Enabled,
+		Focusable:     x.Focusable,
+		Focused:       x.Focused,
+		LongClickable: x.LongClickable,
+		Password:      x.Password,
+		Scrollable:    x.Scrollable,
+		Selected:      x.Selected,
+	}
+	for _, child := range x.Children {
+		c, err := child.toUINode()
+		if err != nil {
+			return nil, err
+		}
+		node.Children = append(node.Children, c)
+	}
+	return node, nil
+}
+
+func parseUIBounds(s string) (image.Rectangle, error) {
+	match := uiBoundsPattern.FindStringSubmatch(s)
+	if match == nil {
+		return image.Rectangle{}, errors.Errorf(errors.ParseError, "malformed node bounds: %q", s)
+	}
+	var coords [4]int
+	for i := range coords {
+		coords[i], _ = strconv.Atoi(match[i+1])
+	}
+	return image.Rect(coords[0], coords[1], coords[2], coords[3]), nil
+}
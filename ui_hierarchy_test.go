@@ -0,0 +1,67 @@
+package adb
+
+import (
+	"context"
+	"image"
+	"testing"
+
+	"github.com/mqhack/goadb/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const uiHierarchyXML = `<?xml version='1.0' encoding='UTF-8' standalone='yes' ?>` +
+	`<hierarchy rotation="1">` +
+	`<node index="0" text="" resource-id="" class="android.widget.FrameLayout" package="com.android.settings" content-desc="" checkable="false" checked="false" clickable="false" enabled="true" focusable="false" focused="false" scrollable="false" long-clickable="false" password="false" selected="false" bounds="[0,0][1080,1920]">` +
+	`<node index="0" text="Wi‑Fi &amp; network" resource-id="android:id/title" class="android.widget.TextView" package="com.android.settings" content-desc="" checkable="false" checked="false" clickable="true" enabled="true" focusable="true" focused="false" scrollable="false" long-clickable="false" password="false" selected="false" bounds="[42,63][1038,210]" />` +
+	`</node>` +
+	`</hierarchy>`
+
+func TestParseUIHierarchy(t *testing.T) {
+	hierarchy, err := parseUIHierarchy([]byte(uiHierarchyXML))
+	require.NoError(t, err)
+	assert.Equal(t, &UIHierarchy{
+		Rotation: 1,
+		Nodes: []*UINode{{
+			Class:   "android.widget.FrameLayout",
+			Package: "com.android.settings",
+			Bounds:  image.Rect(0, 0, 1080, 1920),
+			Enabled: true,
+			Children: []*UINode{{
+				Class:      "android.widget.TextView",
+				ResourceID: "android:id/title",
+				Text:       "Wi‑Fi & network",
+				Package:    "com.android.settings",
+				Bounds:     image.Rect(42, 63, 1038, 210),
+				Clickable:  true,
+				Enabled:    true,
+				Focusable:  true,
+			}},
+		}},
+	}, hierarchy)
+
+	var classes []string
+	hierarchy.Walk(func(node *UINode) bool {
+		classes = append(classes, node.Class)
+		return true
+	})
+	assert.Equal(t, []string{"android.widget.FrameLayout", "android.widget.TextView"}, classes)
+}
+
+func TestParseUIHierarchyMalformedBounds(t *testing.T) {
+	_, err := parseUIHierarchy([]byte(`<hierarchy rotation="0"><node bounds="[0,0]" /></hierarchy>`))
+	assert.True(t, HasErrCode(err, ParseError))
+}
+
+func TestDumpUIHierarchyFailed(t *testing.T) {
+	s := &MockServer{
+		Status:   wire.StatusSuccess,
+		Messages: []string{"ERROR: could not get idle state.\n"},
+	}
+	device := (&Adb{server: s}).Device(AnyDevice())
+
+	_, err := device.DumpUIHierarchy(context.Background())
+	assert.True(t, HasErrCode(err, AdbError))
+	assert.Contains(t, ErrorWithCauseChain(err), "uiautomator dump failed: ERROR: could not get idle state.")
+	assert.Equal(t, "exec:uiautomator dump /data/local/tmp/goadb-ui.xml", s.Requests[1])
+}
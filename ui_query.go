@@ -0,0 +1,99 @@
+package adb
+
+import (
+	"context"
+	"image"
+
+	"github.com/mqhack/goadb/internal/errors"
+)
+
+// UISelector matches nodes of a UIHierarchy.
+type UISelector struct {
+	description string
+	match       func(node *UINode) bool
+}
+
+func (s UISelector) String() string {
+	return s.description
+}
+
+// ByText matches nodes whose text is text.
+func ByText(text string) UISelector {
+	return UISelector{"text=" + text, func(node *UINode) bool { return node.Text == text }}
+}
+
+// ByResourceID matches nodes with the resource ID id, e.g. "com.android.settings:id/title".
+func ByResourceID(id string) UISelector {
+	return UISelector{"resource-id=" + id, func(node *UINode) bool { return node.ResourceID == id }}
+}
+
+// ByDesc matches nodes whose content description is desc.
+func ByDesc(desc string) UISelector {
+	return UISelector{"content-desc=" + desc, func(node *UINode) bool { return node.ContentDesc == desc }}
+}
+
+// ByClass matches nodes of class, e.g. "android.widget.Button".
+func ByClass(class string) UISelector {
+	return UISelector{"class=" + class, func(node *UINode) bool { return node.Class == class }}
+}
+
+// Find returns the nodes that match selector, parents before their children.
+func (h *UIHierarchy) Find(selector UISelector) []*UINode {
+	var nodes []*UINode
+	h.Walk(func(node *UINode) bool {
+		if selector.match(node) {
+			nodes = append(nodes, node)
+		}
+		return true
+	})
+	return nodes
+}
+
+// First returns the first node that matches selector, or nil if none does.
+func (h *UIHierarchy) First(selector UISelector) *UINode {
+	var found *UINode
+	h.Walk(func(node *UINode) bool {
+		if found == nil && selector.match(node) {
+			found = node
+		}
+		return found == nil
+	})
+	return found
+}
+
+// Center returns the point in the middle of the node's bounds.
+func (n *UINode) Center() image.Point {
+	return image.Pt((n.Bounds.Min.X+n.Bounds.Max.X)/2, (n.Bounds.Min.Y+n.Bounds.Max.Y)/2)
+}
+
+/*
+FindNode dumps the UI hierarchy and returns the first node that matches selector. If none
+does, the error has code NodeNotFound.
+*/
+func (c *Device) FindNode(ctx context.Context, selector UISelector) (*UINode, error) {
+	hierarchy, err := c.DumpUIHierarchy(ctx)
+	if err != nil {
+		return nil, wrapClientError(err, c, "FindNode")
+	}
+	node := hierarchy.First(selector)
+	if node == nil {
+		return nil, wrapClientError(errors.Errorf(errors.NodeNotFound, "no node matches %s", selector), c, "FindNode")
+	}
+	return node, nil
+}
+
+/*
+TapNode taps the center of the first node that matches selector, and returns the node.
+If none does, the error has code NodeNotFound.
+*/
+func (c *Device) TapNode(ctx context.Context, selector UISelector) (*UINode, error) {
+	node, err := c.FindNode(ctx, selector)
+	if err != nil {
+		return nil, wrapClientError(err, c, "TapNode")
+	}
+	center := node.Center()
+	if err := c.Tap(center.X, center.Y); err != nil {
+		return node, wrapClientError(err, c, "TapNode")
+	}
+	return node, nil
+}
@@ -0,0 +1,25 @@
+package adb
+
+import (
+	"image"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUIHierarchyFind(t *testing.T) {
+	hierarchy, err := parseUIHierarchy([]byte(uiHierarchyXML))
+	require.NoError(t, err)
+
+	nodes := hierarchy.Find(ByResourceID("android:id/title"))
+	require.Len(t, nodes, 1)
+	assert.Equal(t, image.Rect(42, 63, 1038, 210), nodes[0].Bounds)
+	assert.Equal(t, image.Pt(540, 136), nodes[0].Center())
+
+	assert.Equal(t, nodes[0], hierarchy.First(ByText("Wi‑Fi & network")))
+	assert.Equal(t, hierarchy.Nodes[0], hierarchy.First(ByClass("android.widget.FrameLayout")))
+	assert.Nil(t, hierarchy.First(ByDesc("Navigate up")))
+	assert.Empty(t, hierarchy.Find(ByClass("android.widget.Button")))
+	assert.Equal(t, "content-desc=Navigate up", ByDesc("Navigate up").String())
+}
@@ -0,0 +1,147 @@
+package adb
+
+import (
+	"sort"
+
+	"github.com/mqhack/goadb/internal/errors"
+)
+
+// TransportPreference selects which transport UnifiedDevice uses first.
+type TransportPreference int8
+
+const (
+	// PreferUSB uses USB if it's available, since it's usually faster and more reliable.
+	PreferUSB TransportPreference = iota
+	// PreferTCP uses TCP if it's available, e.g. to keep the USB link free for other traffic.
+	PreferTCP
+)
+
+// UnifiedDevice is a physical device that may be reachable over more than one transport,
+// e.g. both USB and Wi-Fi, each of which the adb server lists with its own serial.
+type UnifiedDevice struct {
+	// HardwareSerial is the device's ro.serialno property, which unlike the adb serial is
+	// the same for every transport. Empty if the device doesn't report one.
+	HardwareSerial string
+	// Fingerprint is the device's ro.build.fingerprint property.
+	Fingerprint string
+
+	// Transports lists each online transport to the device, USB first.
+	Transports []*DeviceInfo
+
+	adb *Adb
+}
+
+// transportsFor returns the transports of d in the order they should be tried for pref.
+func (d *UnifiedDevice) transportsFor(pref TransportPreference) []*DeviceInfo {
+	transports := make([]*DeviceInfo, len(d.Transports))
+	copy(transports, d.Transports)
+	sort.SliceStable(transports, func(i, j int) bool {
+		return transportRank(transports[i], pref) < transportRank(transports[j], pref)
+	})
+	return transports
+}
+
+func transportRank(info *DeviceInfo, pref TransportPreference) int {
+	switch {
+	case pref == PreferUSB && info.IsUsb(), pref == PreferTCP && info.IsTCP():
+		return 0
+	case info.IsUsb() || info.IsTCP():
+		return 1
+	default:
+		// E.g. emulators, which are neither.
+		return 2
+	}
+}
+
+// Device returns a Device that communicates over the most preferred transport.
+func (d *UnifiedDevice) Device(pref TransportPreference) *Device {
+	return d.adb.Device(DeviceWithSerial(d.transportsFor(pref)[0].Serial))
+}
+
+/*
+Do calls fn with a Device for the most preferred transport. If fn fails because the
+transport is unreachable, it's called again with the next transport, until one succeeds or
+every transport has been tried.
+
+Errors other than NetworkError, ConnectionResetError, and DeviceNotFound are returned
+immediately, since they would most likely happen on any transport.
+*/
+func (d *UnifiedDevice) Do(pref TransportPreference, fn func(device *Device) error) error {
+	var errs []error
+	for _, info := range d.transportsFor(pref) {
+		err := fn(d.adb.Device(DeviceWithSerial(info.Serial)))
+		if err == nil {
+			return nil
+		}
+		if !isTransportError(err) {
+			return err
+		}
+		errs = append(errs, err)
+	}
+	return errors.CombineErrs("operation failed on every transport", errors.DeviceNotFound, errs...)
+}
+
+// isTransportError returns true if err means the device couldn't be reached, as opposed to
+// the operation itself failing.
+func isTransportError(err error) bool {
+	return HasErrCode(err, NetworkError) ||
+		HasErrCode(err, ConnectionResetError) ||
+		HasErrCode(err, DeviceNotFound)
+}
+
+/*
+UnifyTransports lists the online devices, and groups together the transports that lead to
+the same physical device.
+
+Transports are matched by the device's ro.serialno and ro.build.fingerprint properties.
+Devices that don't report a serial number are never merged, since devices of the same model
+share a fingerprint. Devices whose properties can't be read are returned on their own.
+*/
+func (c *Adb) UnifyTransports() ([]*UnifiedDevice, error) {
+	infos, err := c.ListDevices()
+	if err != nil {
+		return nil, wrapClientError(err, c, "UnifyTransports")
+	}
+
+	return groupTransports(c, infos, func(serial string) (string, string) {
+		device := c.Device(DeviceWithSerial(serial))
+		hardwareSerial, _ := device.getProp("ro.serialno")
+		fingerprint, _ := device.getProp("ro.build.fingerprint")
+		return hardwareSerial, fingerprint
+	}), nil
+}
+
+// groupTransports groups the online devices in infos by the hardware serial and fingerprint
+// returned by identify.
+func groupTransports(c *Adb, infos []*DeviceInfo, identify func(serial string) (hardwareSerial, fingerprint string)) []*UnifiedDevice {
+	var devices []*UnifiedDevice
+	byKey := make(map[string]*UnifiedDevice)
+	for _, info := range infos {
+		if info.State != StateOnline {
+			continue
+		}
+
+		hardwareSerial, fingerprint := identify(info.Serial)
+		key := hardwareSerial + "\x00" + fingerprint
+		if unified, ok := byKey[key]; ok && hardwareSerial != "" {
+			unified.Transports = append(unified.Transports, info)
+			continue
+		}
+
+		unified := &UnifiedDevice{
+			HardwareSerial: hardwareSerial,
+			Fingerprint:    fingerprint,
+			Transports:     []*DeviceInfo{info},
+			adb:            c,
+		}
+		if hardwareSerial != "" {
+			byKey[key] = unified
+		}
+		devices = append(devices, unified)
+	}
+
+	for _, device := range devices {
+		device.Transports = device.transportsFor(PreferUSB)
+	}
+	return devices
+}
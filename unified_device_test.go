@@ -0,0 +1,92 @@
+package adb
+
+import (
+	"testing"
+
+	"github.com/mqhack/goadb/internal/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGroupTransports(t *testing.T) {
+	infos := []*DeviceInfo{
+		{Serial: "192.168.1.5:5555", State: StateOnline},
+		{Serial: "ABC123", State: StateOnline, Usb: "1-1"},
+		{Serial: "DEF456", State: StateOnline, Usb: "1-2"},
+		{Serial: "emulator-5554", State: StateOnline},
+		{Serial: "emulator-5556", State: StateOnline},
+		{Serial: "GHI789", State: StateOffline, Usb: "1-3"},
+	}
+	props := map[string][2]string{
+		"192.168.1.5:5555": {"ABC123", "google/walleye"},
+		"ABC123":           {"ABC123", "google/walleye"},
+		"DEF456":           {"DEF456", "google/walleye"},
+		// Devices without serial numbers are never merged.
+		"emulator-5554": {"", "generic/sdk"},
+		"emulator-5556": {"", "generic/sdk"},
+	}
+
+	devices := groupTransports(&Adb{}, infos, func(serial string) (string, string) {
+		return props[serial][0], props[serial][1]
+	})
+	require.Len(t, devices, 4)
+
+	assert.Equal(t, "ABC123", devices[0].HardwareSerial)
+	assert.Equal(t, "google/walleye", devices[0].Fingerprint)
+	require.Len(t, devices[0].Transports, 2)
+	assert.Equal(t, "ABC123", devices[0].Transports[0].Serial)
+	assert.Equal(t, "192.168.1.5:5555", devices[0].Transports[1].Serial)
+
+	assert.Equal(t, "DEF456", devices[1].HardwareSerial)
+	assert.Equal(t, "emulator-5554", devices[2].Transports[0].Serial)
+	assert.Equal(t, "emulator-5556", devices[3].Transports[0].Serial)
+}
+
+func TestUnifiedDeviceFailover(t *testing.T) {
+	device := &UnifiedDevice{
+		Transports: []*DeviceInfo{
+			{Serial: "ABC123", Usb: "1-1"},
+			{Serial: "192.168.1.5:5555"},
+		},
+		adb: &Adb{},
+	}
+	assert.Equal(t, "DeviceSerial[192.168.1.5:5555]", device.Device(PreferTCP).String())
+
+	var tried []string
+	err := device.Do(PreferUSB, func(d *Device) error {
+		tried = append(tried, d.String())
+		if len(tried) == 1 {
+			return errors.Errorf(errors.DeviceNotFound, "gone")
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"DeviceSerial[ABC123]", "DeviceSerial[192.168.1.5:5555]"}, tried)
+}
+
+func TestUnifiedDeviceNoFailoverForOtherErrors(t *testing.T) {
+	device := &UnifiedDevice{
+		Transports: []*DeviceInfo{{Serial: "ABC123", Usb: "1-1"}, {Serial: "192.168.1.5:5555"}},
+		adb:        &Adb{},
+	}
+
+	calls := 0
+	err := device.Do(PreferUSB, func(d *Device) error {
+		calls++
+		return errors.Errorf(errors.FileNoExistError, "no such file")
+	})
+	assert.True(t, HasErrCode(err, FileNoExistError))
+	assert.Equal(t, 1, calls)
+}
+
+func TestUnifiedDeviceAllTransportsFailed(t *testing.T) {
+	device := &UnifiedDevice{
+		Transports: []*DeviceInfo{{Serial: "ABC123", Usb: "1-1"}, {Serial: "192.168.1.5:5555"}},
+		adb:        &Adb{},
+	}
+
+	err := device.Do(PreferTCP, func(d *Device) error {
+		return errors.Errorf(errors.NetworkError, "unreachable")
+	})
+	assert.True(t, HasErrCode(err, DeviceNotFound))
+}
@@ -0,0 +1,83 @@
+package adb
+
+import (
+	"context"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/mqhack/goadb/internal/errors"
+)
+
+// UninstallOptions configures Device.Uninstall.
+type UninstallOptions struct {
+	// KeepData keeps the package's data and cache directories, so they're used again if it's
+	// reinstalled.
+	KeepData bool
+	// User, if set, uninstalls the package only for the user with that ID, e.g. 0 for the
+	// device's owner or 10 for a work profile. By default it's uninstalled for all users.
+	User *int
+	// VersionCode, if set, only uninstalls the package if it's the installed version, so a
+	// package that was updated in the meantime is left alone. The error's reason is
+	// DeleteFailedAborted if it isn't.
+	VersionCode int64
+}
+
+// args returns the arguments of pm uninstall for the options.
+func (o UninstallOptions) args() []string {
+	var args []string
+	if o.KeepData {
+		args = append(args, "-k")
+	}
+	if o.User != nil {
+		args = append(args, "--user", strconv.Itoa(*o.User))
+	}
+	if o.VersionCode != 0 {
+		args = append(args, "--versionCode", strconv.FormatInt(o.VersionCode, 10))
+	}
+	return args
+}
+
+/*
+Uninstall uninstalls the package pkg. If pkg isn't installed, the error has code
+FileNoExistError on devices that report it, and PackageManagerError with the reason
+DeleteFailedInternalError on older ones. If the package manager refuses to uninstall it, the
+error has code PackageManagerError, and PackageFailureReason returns the reason, e.g.
+DeleteFailedDevicePolicyManager.
+
+Requires a device running Android L or later (see OpenExec).
+
+Corresponds to the command:
+
+	adb uninstall [-k] <pkg>
+*/
+func (c *Device) Uninstall(ctx context.Context, pkg string, opts UninstallOptions) error {
+	return wrapClientError(c.uninstall(ctx, pkg, opts), c, "Uninstall(%s)", pkg)
+}
+
+func (c *Device) uninstall(ctx context.Context, pkg string, opts UninstallOptions) error {
+	// exec: merges pm's stderr, where some versions print "Unknown package", into its output.
+	conn, err := c.openExec("pm", append(append([]string{"uninstall"}, opts.args()...), pkg)...)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	stop := closeWhenDone(ctx, conn)
+	defer stop()
+
+	output, err := io.ReadAll(conn)
+	if ctx.Err() != nil {
+		return errors.WrapErrorf(ctx.Err(), errors.Timeout, "uninstalling %s cancelled", pkg)
+	}
+	if err != nil {
+		if _, ok := err.(*errors.Err); !ok {
+			err = errors.WrapErrorf(err, errors.NetworkError, "error reading output of pm uninstall")
+		}
+		return err
+	}
+	if result := strings.TrimSpace(string(output)); strings.Contains(result, "not installed for") ||
+		strings.Contains(result, "Unknown package") {
+		return errors.Errorf(errors.FileNoExistError, "package %s isn't installed: %s", pkg, result)
+	}
+	return parsePackageManagerResult("uninstall "+pkg, string(output))
+}
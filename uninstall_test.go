@@ -0,0 +1,37 @@
+package adb
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mqhack/goadb/wire"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUninstallArgs(t *testing.T) {
+	assert.Empty(t, UninstallOptions{}.args())
+	work, owner := 10, 0
+	assert.Equal(t, []string{"-k", "--user", "10", "--versionCode", "42"},
+		UninstallOptions{KeepData: true, User: &work, VersionCode: 42}.args())
+	assert.Equal(t, []string{"--user", "0"}, UninstallOptions{User: &owner}.args())
+}
+
+func TestUninstall(t *testing.T) {
+	s := &MockServer{Status: wire.StatusSuccess, Messages: []string{"Success\n"}}
+	err := (&Adb{server: s}).Device(AnyDevice()).Uninstall(context.Background(), "com.example", UninstallOptions{KeepData: true})
+	assert.NoError(t, err)
+	assert.Equal(t, "exec:pm uninstall -k com.example", s.Requests[1])
+}
+
+func TestUninstallErrors(t *testing.T) {
+	for output, code := range map[string]ErrCode{
+		"Failure [not installed for 0]\n":                   FileNoExistError,
+		"Unknown package: com.example\n":                    FileNoExistError,
+		"Failure [DELETE_FAILED_DEVICE_POLICY_MANAGER]\n":   PackageManagerError,
+		"Error: java.lang.SecurityException: not allowed\n": AdbError,
+	} {
+		s := &MockServer{Status: wire.StatusSuccess, Messages: []string{output}}
+		err := (&Adb{server: s}).Device(AnyDevice()).Uninstall(context.Background(), "com.example", UninstallOptions{})
+		assert.True(t, HasErrCode(err, code), "%q: %v", output, err)
+	}
+}
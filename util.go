@@ -1,7 +1,10 @@
 package adb
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"os"
 	"reflect"
 	"regexp"
 	"strings"
@@ -38,3 +41,51 @@ func wrapClientError(err error, client interface{}, operation string, args ...in
 		Details: client,
 	}
 }
+
+// closeWhenDone closes c as soon as ctx is done, which unblocks any reads or writes
+// in progress on it. The returned function must be called once the operation has
+// finished to release the watcher goroutine.
+func closeWhenDone(ctx context.Context, c io.Closer) (stop func()) {
+	stopped := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.Close()
+		case <-stopped:
+		}
+	}()
+	return func() { close(stopped) }
+}
+
+// shellQuote quotes s so the device's shell treats it as a single word, even if it
+// contains whitespace, quotes, or other special characters. Unlike the quoting done by
+// RunCommand, this can be used to build command lines that use pipes and redirection.
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// privilegeLevel is a way of running commands on the device.
+type privilegeLevel struct {
+	name string
+	// wrap returns a command line that runs script at this level.
+	wrap func(script string) string
+}
+
+// privilegeLevels are tried in order by operations that need more access than the shell
+// user has on production builds.
+var privilegeLevels = []privilegeLevel{
+	{"shell", func(script string) string { return script }},
+	// su from AOSP userdebug and eng builds.
+	{"su 0", func(script string) string { return "su 0 sh -c " + shellQuote(script) }},
+	// su from most rooting tools.
+	{"su -c", func(script string) string { return "su -c " + shellQuote(script) }},
+}
+
+// wrapLocalFileError wraps an error from opening a file on the host.
+func wrapLocalFileError(err error, path string) error {
+	code := errors.AssertionError
+	if os.IsNotExist(err) {
+		code = errors.FileNoExistError
+	}
+	return errors.WrapErrorf(err, code, "error opening local file %s", path)
+}
@@ -25,3 +25,9 @@ func TestIsBlankWhenJustWhitespace(t *testing.T) {
 func TestIsBlankNo(t *testing.T) {
 	assert.False(t, isBlank("     h   "))
 }
+
+func TestShellQuote(t *testing.T) {
+	assert.Equal(t, `'/sdcard/a b'`, shellQuote("/sdcard/a b"))
+	assert.Equal(t, `'it'\''s'`, shellQuote("it's"))
+	assert.Equal(t, `''`, shellQuote(""))
+}
@@ -0,0 +1,190 @@
+/*
+Package webhook posts device lab events, such as devices being attached or going offline,
+as JSON to an HTTP endpoint.
+
+	emitter := webhook.NewEmitter(webhook.Config{
+		URL:    "https://example.com/hooks/adb",
+		Secret: []byte("shared secret"),
+	})
+	go emitter.ForwardDeviceEvents(ctx, client.NewDeviceWatcher(), nil)
+
+If a Secret is configured, every request carries a SignatureHeader containing the
+hex-encoded HMAC-SHA256 of the body, prefixed with "sha256=", so receivers can verify that
+the event came from this emitter.
+*/
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	adb "github.com/mqhack/goadb"
+	"github.com/mqhack/goadb/internal/errors"
+)
+
+// SignatureHeader is the HTTP header that carries the HMAC signature of the request body.
+const SignatureHeader = "X-Goadb-Signature"
+
+// EventType identifies the kind of event in the Type field of the JSON payload.
+type EventType string
+
+const (
+	DeviceAdded        EventType = "device.added"
+	DeviceRemoved      EventType = "device.removed"
+	DeviceStateChanged EventType = "device.state_changed"
+	InstallCompleted   EventType = "install.completed"
+	CrashDetected      EventType = "crash.detected"
+)
+
+// Event is the JSON payload posted for each event.
+type Event struct {
+	Type     EventType `json:"type"`
+	Serial   string    `json:"serial"`
+	Time     time.Time `json:"time"`
+	OldState string    `json:"old_state,omitempty"`
+	NewState string    `json:"new_state,omitempty"`
+
+	// Details holds event-specific data, e.g. the package name for InstallCompleted.
+	Details map[string]string `json:"details,omitempty"`
+}
+
+type Config struct {
+	// URL that events are POSTed to.
+	URL string
+
+	// Secret used to sign requests. If empty, requests are not signed.
+	Secret []byte
+
+	// MaxRetries is how many times delivery of an event is retried after the first attempt
+	// fails with a network error or a 5xx response. Defaults to 3. Set to a negative value
+	// to disable retries.
+	MaxRetries int
+
+	// RetryDelay is the delay before the first retry. It doubles after each attempt.
+	// Defaults to 1 second.
+	RetryDelay time.Duration
+
+	// Client used to send requests. Defaults to http.DefaultClient.
+	Client *http.Client
+}
+
+// Emitter delivers events to a webhook endpoint.
+type Emitter struct {
+	config Config
+}
+
+func NewEmitter(config Config) *Emitter {
+	if config.MaxRetries == 0 {
+		config.MaxRetries = 3
+	} else if config.MaxRetries < 0 {
+		config.MaxRetries = 0
+	}
+	if config.RetryDelay == 0 {
+		config.RetryDelay = time.Second
+	}
+	if config.Client == nil {
+		config.Client = http.DefaultClient
+	}
+	return &Emitter{config: config}
+}
+
+// Emit posts event to the webhook, retrying transient failures. If event.Time is zero,
+// it's set to the current time.
+func (e *Emitter) Emit(ctx context.Context, event Event) error {
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		return errors.WrapErrorf(err, errors.AssertionError, "error encoding webhook event")
+	}
+
+	delay := e.config.RetryDelay
+	for attempt := 0; ; attempt++ {
+		retry, err := e.post(ctx, body)
+		if err == nil || !retry || attempt >= e.config.MaxRetries {
+			return err
+		}
+
+		select {
+		case <-time.After(delay):
+			delay *= 2
+		case <-ctx.Done():
+			return errors.WrapErrorf(ctx.Err(), errors.Timeout, "webhook delivery cancelled")
+		}
+	}
+}
+
+// post sends a single request, and returns whether a failure is worth retrying.
+func (e *Emitter) post(ctx context.Context, body []byte) (retry bool, err error) {
+	req, err := http.NewRequest(http.MethodPost, e.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, errors.WrapErrorf(err, errors.AssertionError, "invalid webhook URL: %s", e.config.URL)
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	if len(e.config.Secret) > 0 {
+		req.Header.Set(SignatureHeader, Sign(e.config.Secret, body))
+	}
+
+	resp, err := e.config.Client.Do(req)
+	if err != nil {
+		return ctx.Err() == nil, errors.WrapErrorf(err, errors.NetworkError, "error posting webhook to %s", e.config.URL)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	return resp.StatusCode >= 500, errors.Errorf(errors.NetworkError,
+		"webhook %s responded with %s", e.config.URL, resp.Status)
+}
+
+// Sign returns the value of SignatureHeader for body.
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// ForwardDeviceEvents emits an event for every device state change reported by watcher,
+// until ctx is done or the watcher's channel is closed. Delivery failures don't stop
+// forwarding, they are passed to onError if it's non-nil.
+func (e *Emitter) ForwardDeviceEvents(ctx context.Context, watcher *adb.DeviceWatcher, onError func(error)) error {
+	for {
+		select {
+		case change, ok := <-watcher.C():
+			if !ok {
+				return watcher.Err()
+			}
+			if err := e.Emit(ctx, eventFromStateChange(change)); err != nil && onError != nil {
+				onError(err)
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+func eventFromStateChange(change adb.DeviceStateChangedEvent) Event {
+	event := Event{
+		Type:     DeviceStateChanged,
+		Serial:   change.Serial,
+		OldState: fmt.Sprint(change.OldState),
+		NewState: fmt.Sprint(change.NewState),
+	}
+	switch {
+	case change.OldState == adb.StateDisconnected:
+		event.Type = DeviceAdded
+	case change.NewState == adb.StateDisconnected:
+		event.Type = DeviceRemoved
+	}
+	return event
+}
@@ -0,0 +1,78 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	adb "github.com/mqhack/goadb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEmitSignsBody(t *testing.T) {
+	var gotBody []byte
+	var gotSignature string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotBody, _ = ioutil.ReadAll(r.Body)
+		gotSignature = r.Header.Get(SignatureHeader)
+	}))
+	defer server.Close()
+
+	emitter := NewEmitter(Config{URL: server.URL, Secret: []byte("secret")})
+	someTime := time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC)
+	err := emitter.Emit(context.Background(), Event{Type: DeviceAdded, Serial: "abc", Time: someTime})
+	require.NoError(t, err)
+
+	var event Event
+	require.NoError(t, json.Unmarshal(gotBody, &event))
+	assert.Equal(t, Event{Type: DeviceAdded, Serial: "abc", Time: someTime}, event)
+	assert.Equal(t, Sign([]byte("secret"), gotBody), gotSignature)
+}
+
+func TestEmitRetriesServerErrors(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer server.Close()
+
+	emitter := NewEmitter(Config{URL: server.URL, RetryDelay: time.Millisecond})
+	assert.NoError(t, emitter.Emit(context.Background(), Event{Type: DeviceRemoved}))
+	assert.Equal(t, 3, attempts)
+}
+
+func TestEmitDoesntRetryClientErrors(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	emitter := NewEmitter(Config{URL: server.URL, RetryDelay: time.Millisecond})
+	err := emitter.Emit(context.Background(), Event{Type: DeviceRemoved})
+	assert.True(t, adb.HasErrCode(err, adb.NetworkError))
+	assert.Equal(t, 1, attempts)
+}
+
+func TestEventFromStateChange(t *testing.T) {
+	assert.Equal(t, Event{
+		Type:     DeviceAdded,
+		Serial:   "abc",
+		OldState: "StateDisconnected",
+		NewState: "StateOnline",
+	}, eventFromStateChange(adb.DeviceStateChangedEvent{Serial: "abc", OldState: adb.StateDisconnected, NewState: adb.StateOnline}))
+
+	assert.Equal(t, DeviceRemoved, eventFromStateChange(adb.DeviceStateChangedEvent{
+		OldState: adb.StateOnline, NewState: adb.StateDisconnected}).Type)
+	assert.Equal(t, DeviceStateChanged, eventFromStateChange(adb.DeviceStateChangedEvent{
+		OldState: adb.StateOffline, NewState: adb.StateOnline}).Type)
+}
@@ -0,0 +1,235 @@
+package adb
+
+import (
+	"bufio"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/mqhack/goadb/internal/errors"
+)
+
+// DisplaySize is a display resolution in pixels.
+type DisplaySize struct {
+	Width  int
+	Height int
+}
+
+// String returns the size in the format wm accepts, e.g. "1080x2400".
+func (s DisplaySize) String() string {
+	return fmt.Sprintf("%dx%d", s.Width, s.Height)
+}
+
+// DisplaySizeInfo is the display size reported by wm size.
+type DisplaySizeInfo struct {
+	Physical DisplaySize
+	// Override is the size set by SetDisplaySize, or zero if there isn't one.
+	Override DisplaySize
+}
+
+// Effective returns the size apps see: the override if there is one, and otherwise the
+// physical size.
+func (i *DisplaySizeInfo) Effective() DisplaySize {
+	if i.Override != (DisplaySize{}) {
+		return i.Override
+	}
+	return i.Physical
+}
+
+// DisplayDensityInfo is the display density, in dpi, reported by wm density.
+type DisplayDensityInfo struct {
+	Physical int
+	// Override is the density set by SetDisplayDensity, or zero if there isn't one.
+	Override int
+}
+
+// Effective returns the density apps see: the override if there is one, and otherwise the
+// physical density.
+func (i *DisplayDensityInfo) Effective() int {
+	if i.Override != 0 {
+		return i.Override
+	}
+	return i.Physical
+}
+
+/*
+GetDisplaySize returns the physical size of the default display, and the override set by
+SetDisplaySize, if any.
+
+Corresponds to the command:
+
+	adb shell wm size
+*/
+func (c *Device) GetDisplaySize() (*DisplaySizeInfo, error) {
+	output, err := c.RunCommand("wm", "size")
+	if err != nil {
+		return nil, wrapClientError(err, c, "GetDisplaySize")
+	}
+	info, err := parseWmSize(output)
+	return info, wrapClientError(err, c, "GetDisplaySize")
+}
+
+/*
+SetDisplaySize makes apps render the default display at size, e.g. so screenshots from
+different devices can be compared. The override persists across reboots until
+ResetDisplaySize is called.
+
+Corresponds to the command:
+
+	adb shell wm size WxH
+*/
+func (c *Device) SetDisplaySize(size DisplaySize) error {
+	if size.Width <= 0 || size.Height <= 0 {
+		return wrapClientError(errors.AssertionErrorf("invalid display size %s", size), c, "SetDisplaySize")
+	}
+	return wrapClientError(c.runWmSetting("size", size.String()), c, "SetDisplaySize")
+}
+
+/*
+ResetDisplaySize removes the override set by SetDisplaySize.
+
+Corresponds to the command:
+
+	adb shell wm size reset
+*/
+func (c *Device) ResetDisplaySize() error {
+	return wrapClientError(c.runWmSetting("size", "reset"), c, "ResetDisplaySize")
+}
+
+/*
+GetDisplayDensity returns the physical density of the default display, and the override set
+by SetDisplayDensity, if any.
+
+Corresponds to the command:
+
+	adb shell wm density
+*/
+func (c *Device) GetDisplayDensity() (*DisplayDensityInfo, error) {
+	output, err := c.RunCommand("wm", "density")
+	if err != nil {
+		return nil, wrapClientError(err, c, "GetDisplayDensity")
+	}
+	info, err := parseWmDensity(output)
+	return info, wrapClientError(err, c, "GetDisplayDensity")
+}
+
+/*
+SetDisplayDensity makes apps render the default display at dpi. The override persists across
+reboots until ResetDisplayDensity is called.
+
+Corresponds to the command:
+
+	adb shell wm density DPI
+*/
+func (c *Device) SetDisplayDensity(dpi int) error {
+	if dpi <= 0 {
+		return wrapClientError(errors.AssertionErrorf("invalid display density %d", dpi), c, "SetDisplayDensity")
+	}
+	return wrapClientError(c.runWmSetting("density", strconv.Itoa(dpi)), c, "SetDisplayDensity")
+}
+
+/*
+ResetDisplayDensity removes the override set by SetDisplayDensity.
+
+Corresponds to the command:
+
+	adb shell wm density reset
+*/
+func (c *Device) ResetDisplayDensity() error {
+	return wrapClientError(c.runWmSetting("density", "reset"), c, "ResetDisplayDensity")
+}
+
+// runWmSetting runs wm to change a setting. wm prints nothing when it succeeds, and always
+// exits with status 0, so any output is an error.
+func (c *Device) runWmSetting(setting, value string) error {
+	output, err := c.RunCommand("wm", setting, value)
+	if err != nil {
+		return err
+	}
+	if output = strings.TrimSpace(output); output != "" {
+		return errors.Errorf(errors.AdbError, "wm %s %s failed: %s", setting, value, output)
+	}
+	return nil
+}
+
+// parseWmSize parses the output of wm size, e.g.
+//
+//	Physical size: 1080x2400
+//	Override size: 720x1600
+func parseWmSize(output string) (*DisplaySizeInfo, error) {
+	info := &DisplaySizeInfo{}
+	var found bool
+	err := parseWmOutput(output, "size", func(kind, value string) error {
+		width, height, ok := strings.Cut(value, "x")
+		w, werr := strconv.Atoi(width)
+		h, herr := strconv.Atoi(height)
+		if !ok || werr != nil || herr != nil {
+			return errors.Errorf(errors.ParseError, "invalid display size %q", value)
+		}
+		size := DisplaySize{w, h}
+		switch kind {
+		case "Physical":
+			info.Physical, found = size, true
+		case "Override":
+			info.Override = size
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, errors.Errorf(errors.ParseError, "no physical size in wm size output: %s", strings.TrimSpace(output))
+	}
+	return info, nil
+}
+
+// parseWmDensity parses the output of wm density, e.g.
+//
+//	Physical density: 420
+//	Override density: 320
+func parseWmDensity(output string) (*DisplayDensityInfo, error) {
+	info := &DisplayDensityInfo{}
+	var found bool
+	err := parseWmOutput(output, "density", func(kind, value string) error {
+		dpi, err := strconv.Atoi(value)
+		if err != nil {
+			return errors.Errorf(errors.ParseError, "invalid display density %q", value)
+		}
+		switch kind {
+		case "Physical":
+			info.Physical, found = dpi, true
+		case "Override":
+			info.Override = dpi
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, errors.Errorf(errors.ParseError, "no physical density in wm density output: %s", strings.TrimSpace(output))
+	}
+	return info, nil
+}
+
+// parseWmOutput calls fn with the kind (e.g. "Physical") and value of each line of the form
+// "<kind> <setting>: <value>".
+func parseWmOutput(output, setting string, fn func(kind, value string) error) error {
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		label, value, ok := strings.Cut(line, ": ")
+		if !ok {
+			continue
+		}
+		kind, name, ok := strings.Cut(label, " ")
+		if !ok || name != setting {
+			continue
+		}
+		if err := fn(kind, strings.TrimSpace(value)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
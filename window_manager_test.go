@@ -0,0 +1,61 @@
+package adb
+
+import (
+	"testing"
+
+	"github.com/mqhack/goadb/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseWmSize(t *testing.T) {
+	info, err := parseWmSize("Physical size: 1080x2400\r\nOverride size: 720x1600\r\n")
+	require.NoError(t, err)
+	assert.Equal(t, DisplaySize{1080, 2400}, info.Physical)
+	assert.Equal(t, DisplaySize{720, 1600}, info.Override)
+	assert.Equal(t, DisplaySize{720, 1600}, info.Effective())
+
+	info, err = parseWmSize("Physical size: 1080x2400\n")
+	require.NoError(t, err)
+	assert.Equal(t, DisplaySize{}, info.Override)
+	assert.Equal(t, DisplaySize{1080, 2400}, info.Effective())
+
+	_, err = parseWmSize("Physical size: 1080by2400\n")
+	assert.EqualError(t, err, `ParseError: invalid display size "1080by2400"`)
+	_, err = parseWmSize("/system/bin/sh: wm: not found\n")
+	assert.EqualError(t, err, "ParseError: no physical size in wm size output: /system/bin/sh: wm: not found")
+}
+
+func TestParseWmDensity(t *testing.T) {
+	info, err := parseWmDensity("Physical density: 420\nOverride density: 320\n")
+	require.NoError(t, err)
+	assert.Equal(t, DisplayDensityInfo{Physical: 420, Override: 320}, *info)
+	assert.Equal(t, 320, info.Effective())
+
+	info, err = parseWmDensity("Physical density: 420\n")
+	require.NoError(t, err)
+	assert.Equal(t, 420, info.Effective())
+}
+
+func TestSetDisplaySize(t *testing.T) {
+	s := &MockServer{Status: wire.StatusSuccess}
+	device := (&Adb{server: s}).Device(AnyDevice())
+
+	require.NoError(t, device.SetDisplaySize(DisplaySize{720, 1280}))
+	assert.Equal(t, "shell:wm size 720x1280", s.Requests[1])
+
+	assert.True(t, HasErrCode(device.SetDisplaySize(DisplaySize{0, 1280}), AssertionError))
+}
+
+func TestSetDisplayDensityFailed(t *testing.T) {
+	s := &MockServer{
+		Status:   wire.StatusSuccess,
+		Messages: []string{"Error: SecurityException: Must hold permission android.permission.WRITE_SECURE_SETTINGS\n"},
+	}
+	device := (&Adb{server: s}).Device(AnyDevice())
+
+	err := device.SetDisplayDensity(320)
+	assert.True(t, HasErrCode(err, AdbError))
+	assert.Contains(t, ErrorWithCauseChain(err), "wm density 320 failed: Error: SecurityException")
+	assert.Equal(t, "shell:wm density 320", s.Requests[1])
+}
@@ -3,8 +3,9 @@ package wire
 import "github.com/mqhack/goadb/internal/errors"
 
 const (
-	// The official implementation of adb imposes an undocumented 255-byte limit
-	// on messages.
+	// MaxMessageLength is the longest message that can be sent to or read from the
+	// server. Messages are prefixed with their length as 4 hex digits, so they can't be
+	// any longer.
 	MaxMessageLength = 65536
 )
 
@@ -49,6 +50,16 @@ func (c *Conn) NewSyncConn() *SyncConn {
 	}
 }
 
+// NewShellConn returns a connection that can speak the shell protocol.
+// The connection must already have been switched (by requesting a "shell,v2:" service
+// from a specific device), or the returned connection will return an error.
+func (c *Conn) NewShellConn() *ShellConn {
+	return &ShellConn{
+		ShellScanner: c.Scanner.NewShellScanner(),
+		ShellSender:  c.Sender.NewShellSender(),
+	}
+}
+
 // RoundTripSingleResponse sends a message to the server, and reads a single
 // message response. If the reponse has a failure status code, returns it as an error.
 func (conn *Conn) RoundTripSingleResponse(req []byte) (resp []byte, err error) {
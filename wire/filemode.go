@@ -5,29 +5,98 @@ import "os"
 // ADB file modes seem to only be 16 bits.
 // Values are taken from http://linux.die.net/include/bits/stat.h.
 const (
-	ModeDir        uint32 = 0040000
-	ModeSymlink           = 0120000
-	ModeSocket            = 0140000
-	ModeFifo              = 0010000
-	ModeCharDevice        = 0020000
+	// ModeTypeMask selects the file type bits of a mode, which are exactly one of the
+	// Mode* values below.
+	ModeTypeMask uint32 = 0170000
+
+	ModeDir         uint32 = 0040000
+	ModeSymlink            = 0120000
+	ModeSocket             = 0140000
+	ModeFifo               = 0010000
+	ModeCharDevice         = 0020000
+	ModeBlockDevice        = 0060000
+	ModeRegular            = 0100000
+)
+
+// The bits of a mode that aren't its type or permissions.
+const (
+	ModeSetuid uint32 = 04000
+	ModeSetgid uint32 = 02000
+	ModeSticky uint32 = 01000
+)
+
+// Permissions files are usually given when they're pushed, like the official client's
+// defaults for files it doesn't have a local mode for.
+const (
+	// DefaultFilePerms is for regular files.
+	DefaultFilePerms os.FileMode = 0644
+	// DefaultExecutablePerms is for executables, and directories.
+	DefaultExecutablePerms os.FileMode = 0755
 )
 
+// ParseFileModeFromAdb converts a mode sent by the sync protocol, which is a POSIX st_mode,
+// to a Go os.FileMode.
 func ParseFileModeFromAdb(modeFromSync uint32) (filemode os.FileMode) {
 	// The ADB filemode uses the permission bits defined in Go's os package, but
 	// we need to parse the other bits manually.
-	switch {
-	case modeFromSync&ModeSymlink == ModeSymlink:
+	switch modeFromSync & ModeTypeMask {
+	case ModeSymlink:
 		filemode = os.ModeSymlink
-	case modeFromSync&ModeDir == ModeDir:
+	case ModeDir:
 		filemode = os.ModeDir
-	case modeFromSync&ModeSocket == ModeSocket:
+	case ModeSocket:
 		filemode = os.ModeSocket
-	case modeFromSync&ModeFifo == ModeFifo:
+	case ModeFifo:
 		filemode = os.ModeNamedPipe
-	case modeFromSync&ModeCharDevice == ModeCharDevice:
-		filemode = os.ModeCharDevice
+	case ModeCharDevice:
+		// Like the os package, character devices are also devices.
+		filemode = os.ModeDevice | os.ModeCharDevice
+	case ModeBlockDevice:
+		filemode = os.ModeDevice
 	}
 
+	if modeFromSync&ModeSetuid != 0 {
+		filemode |= os.ModeSetuid
+	}
+	if modeFromSync&ModeSetgid != 0 {
+		filemode |= os.ModeSetgid
+	}
+	if modeFromSync&ModeSticky != 0 {
+		filemode |= os.ModeSticky
+	}
 	filemode |= os.FileMode(modeFromSync).Perm()
 	return
 }
+
+// FileModeToAdb converts a Go os.FileMode to a POSIX st_mode, the inverse of
+// ParseFileModeFromAdb. Modes with no type bits are regular files.
+func FileModeToAdb(filemode os.FileMode) (mode uint32) {
+	switch {
+	case filemode&os.ModeSymlink != 0:
+		mode = ModeSymlink
+	case filemode&os.ModeDir != 0:
+		mode = ModeDir
+	case filemode&os.ModeSocket != 0:
+		mode = ModeSocket
+	case filemode&os.ModeNamedPipe != 0:
+		mode = ModeFifo
+	case filemode&os.ModeCharDevice != 0:
+		mode = ModeCharDevice
+	case filemode&os.ModeDevice != 0:
+		mode = ModeBlockDevice
+	default:
+		mode = ModeRegular
+	}
+
+	if filemode&os.ModeSetuid != 0 {
+		mode |= ModeSetuid
+	}
+	if filemode&os.ModeSetgid != 0 {
+		mode |= ModeSetgid
+	}
+	if filemode&os.ModeSticky != 0 {
+		mode |= ModeSticky
+	}
+	mode |= uint32(filemode.Perm())
+	return
+}
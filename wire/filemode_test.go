@@ -0,0 +1,38 @@
+package wire
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseFileModeFromAdb(t *testing.T) {
+	assert.Equal(t, os.FileMode(0644), ParseFileModeFromAdb(ModeRegular|0644))
+	assert.Equal(t, os.ModeDir|0755, ParseFileModeFromAdb(ModeDir|0755))
+	assert.Equal(t, os.ModeSymlink|0777, ParseFileModeFromAdb(ModeSymlink|0777))
+	assert.Equal(t, os.ModeSocket|0660, ParseFileModeFromAdb(ModeSocket|0660))
+	assert.Equal(t, os.ModeNamedPipe|0600, ParseFileModeFromAdb(ModeFifo|0600))
+	assert.Equal(t, os.ModeDevice|os.ModeCharDevice|0666, ParseFileModeFromAdb(ModeCharDevice|0666))
+	assert.Equal(t, os.ModeDevice|0600, ParseFileModeFromAdb(ModeBlockDevice|0600))
+	assert.Equal(t, os.ModeSetuid|0755, ParseFileModeFromAdb(ModeRegular|ModeSetuid|0755))
+	assert.Equal(t, os.ModeSetgid|0755, ParseFileModeFromAdb(ModeRegular|ModeSetgid|0755))
+	assert.Equal(t, os.ModeDir|os.ModeSticky|0777, ParseFileModeFromAdb(ModeDir|ModeSticky|0777))
+}
+
+func TestFileModeToAdb(t *testing.T) {
+	for _, mode := range []uint32{
+		ModeRegular | 0644,
+		ModeDir | 0755,
+		ModeSymlink | 0777,
+		ModeSocket | 0660,
+		ModeFifo | 0600,
+		ModeCharDevice | 0666,
+		ModeBlockDevice | 0600,
+		ModeRegular | ModeSetuid | ModeSetgid | 0755,
+		ModeDir | ModeSticky | 0777,
+	} {
+		assert.Equal(t, mode, FileModeToAdb(ParseFileModeFromAdb(mode)), "%o", mode)
+	}
+	assert.Equal(t, uint32(ModeRegular|0644), FileModeToAdb(0644))
+}
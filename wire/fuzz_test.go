@@ -0,0 +1,91 @@
+package wire
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+// The fuzz targets check that malformed data from the server is reported as an error, without
+// panicking or reading more than the limits allow. go test runs them on the seed inputs; run
+// them with e.g. go test -fuzz=FuzzReadMessage to fuzz for longer.
+
+func FuzzReadMessage(f *testing.F) {
+	for _, seed := range []string{"OKAY0005hello", "FAIL0004fail", "FAIL-fff", "0000", "ffff", "00"} {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		s := NewScanner(ioutil.NopCloser(bytes.NewReader(data)))
+		if _, err := s.ReadStatus("fuzz"); err != nil {
+			return
+		}
+		for {
+			msg, err := s.ReadMessage()
+			if err != nil {
+				return
+			}
+			if len(msg) > MaxMessageLength {
+				t.Fatalf("read %d byte message", len(msg))
+			}
+		}
+	})
+}
+
+func FuzzSyncScanner(f *testing.F) {
+	for _, seed := range []string{
+		"DENT\xa4\x81\x00\x00\x05\x00\x00\x00\x97\xd0\x2a\x55\x05\x00\x00\x00helloDONE",
+		"DATA\x05\x00\x00\x00helloDONE\x00\x00\x00\x00",
+		"FAIL\x04\x00\x00\x00fail",
+		"FAIL\xff\xff\xff\xff",
+		"DENT\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\xff\xff\xff\x7f",
+	} {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		s := NewSyncScanner(bytes.NewReader(data))
+		for {
+			if _, err := s.ReadStatus("fuzz"); err != nil {
+				return
+			}
+			if _, err := s.ReadFileMode(); err != nil {
+				return
+			}
+			if _, err := s.ReadTime(); err != nil {
+				return
+			}
+			str, err := s.ReadString()
+			if err != nil {
+				return
+			}
+			if len(str) > SyncMaxChunkSize {
+				t.Fatalf("read %d byte string", len(str))
+			}
+			r, err := s.ReadBytes()
+			if err != nil {
+				return
+			}
+			if n, _ := io.Copy(ioutil.Discard, r); n > SyncMaxChunkSize {
+				t.Fatalf("read %d bytes", n)
+			}
+		}
+	})
+}
+
+func FuzzShellScanner(f *testing.F) {
+	for _, seed := range []string{"\x01\x05\x00\x00\x00hello\x03\x01\x00\x00\x00\x00", "\x01\xff\xff\xff\xff", "\x01\x05"} {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		s := NewShellScanner(bytes.NewReader(data))
+		for {
+			_, packet, err := s.ReadPacket()
+			if err != nil {
+				return
+			}
+			if len(packet) > ShellMaxPacketSize {
+				t.Fatalf("read %d byte packet", len(packet))
+			}
+		}
+	})
+}
@@ -2,7 +2,6 @@ package wire
 
 import (
 	"encoding/binary"
-	"fmt"
 	"io"
 	"strconv"
 
@@ -39,10 +38,14 @@ See Conn for more details.
 type Scanner interface {
 	io.Closer
 	StatusReader
+	// Read reads raw bytes from the connection. It's used for services that stream
+	// unframed data after the status, such as shell: and exec:.
+	io.Reader
 	ReadMessage() ([]byte, error)
 	ReadUntilEof() ([]byte, error)
 
 	NewSyncScanner() SyncScanner
+	NewShellScanner() ShellScanner
 }
 
 type realScanner struct {
@@ -77,10 +80,18 @@ func (s *realScanner) ReadUntilEof() ([]byte, error) {
 	return data, nil
 }
 
+func (s *realScanner) Read(buf []byte) (int, error) {
+	return s.reader.Read(buf)
+}
+
 func (s *realScanner) NewSyncScanner() SyncScanner {
 	return NewSyncScanner(s.reader)
 }
 
+func (s *realScanner) NewShellScanner() ShellScanner {
+	return NewShellScanner(s.reader)
+}
+
 func (s *realScanner) Close() error {
 	return errors.WrapErrorf(s.reader.Close(), errors.NetworkError, "error closing scanner")
 }
@@ -131,6 +142,9 @@ func readOctetString(description string, r io.Reader) (string, error) {
 // lengthReader is the function used to read the length. Most operations encode
 // length as a hex string (readHexLength), but sync operations use little-endian
 // binary encoding (readInt32).
+//
+// Lengths that are negative or longer than MaxMessageLength are rejected before anything is
+// allocated, so a misbehaving server can't make the client allocate arbitrary amounts of memory.
 func readMessage(r io.Reader, lengthReader lengthReader) ([]byte, error) {
 	var err error
 
@@ -138,6 +152,9 @@ func readMessage(r io.Reader, lengthReader lengthReader) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
+	if err := checkLength("message", length, MaxMessageLength); err != nil {
+		return nil, err
+	}
 
 	data := make([]byte, length)
 	n, err := io.ReadFull(r, data)
@@ -158,17 +175,11 @@ func readHexLength(r io.Reader) (int, error) {
 		return 0, errIncompleteMessage("length", n, 4)
 	}
 
-	fmt.Printf("hex length: %s\n", string(lengthHex))
-	length, err := strconv.ParseInt(string(lengthHex), 16, 64)
+	// ParseUint, unlike ParseInt, rejects signs, so the length can't be negative.
+	length, err := strconv.ParseUint(string(lengthHex), 16, 16)
 	if err != nil {
-		return 0, errors.WrapErrorf(err, errors.NetworkError, "could not parse hex length %v", lengthHex)
-	}
-
-	// Clip the length to 255, as per the Google implementation.
-	if length > MaxMessageLength {
-		length = MaxMessageLength
+		return 0, errors.WrapErrorf(err, errors.NetworkError, "could not parse hex length %q", lengthHex)
 	}
-
 	return int(length), nil
 }
 
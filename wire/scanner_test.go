@@ -110,6 +110,24 @@ func TestReadLengthIncompleteLength(t *testing.T) {
 	assertEof(t, s)
 }
 
+func TestReadLengthInvalid(t *testing.T) {
+	for _, length := range []string{"-fff", "+fff", "0x1f", "zzzz", "ff f"} {
+		_, err := readHexLength(newEofReader(length))
+		assert.True(t, errors.HasErrCode(err, errors.NetworkError), length)
+	}
+}
+
+func TestReadMessageInvalidLength(t *testing.T) {
+	s := newEofReader("\377\377\377\377FAIL")
+	msg, err := readMessage(s, readInt32)
+	assert.Equal(t, checkLength("message", -1, MaxMessageLength), err)
+	assert.Nil(t, msg)
+
+	s = newEofReader("\001\000\001\000FAIL")
+	_, err = readMessage(s, readInt32)
+	assert.Equal(t, checkLength("message", MaxMessageLength+1, MaxMessageLength), err)
+}
+
 func assertEof(t *testing.T, r io.Reader) {
 	msg, err := readMessage(r, readHexLength)
 	assert.True(t, errors.HasErrCode(err, errors.ConnectionResetError))
@@ -9,8 +9,12 @@ import (
 // Sender sends messages to the server.
 type Sender interface {
 	SendMessage(msg []byte) error
+	// Write writes raw bytes to the connection. It's used for services that accept
+	// unframed data after the status, such as exec:.
+	io.Writer
 
 	NewSyncSender() SyncSender
+	NewShellSender() ShellSender
 
 	Close() error
 }
@@ -36,10 +40,18 @@ func (s *realSender) SendMessage(msg []byte) error {
 	return writeFully(s.writer, []byte(lengthAndMsg))
 }
 
+func (s *realSender) Write(data []byte) (int, error) {
+	return s.writer.Write(data)
+}
+
 func (s *realSender) NewSyncSender() SyncSender {
 	return NewSyncSender(s.writer)
 }
 
+func (s *realSender) NewShellSender() ShellSender {
+	return NewShellSender(s.writer)
+}
+
 func (s *realSender) Close() error {
 	return errors.WrapErrorf(s.writer.Close(), errors.NetworkError, "error closing sender")
 }
@@ -0,0 +1,40 @@
+package wire
+
+import "github.com/mqhack/goadb/internal/errors"
+
+// Packet IDs used by the shell protocol.
+const (
+	ShellIDStdin            byte = 0
+	ShellIDStdout           byte = 1
+	ShellIDStderr           byte = 2
+	ShellIDExit             byte = 3
+	ShellIDCloseStdin       byte = 4
+	ShellIDWindowSizeChange byte = 5
+)
+
+/*
+ShellConn is a connection to a device service that speaks the shell protocol (aka shell v2).
+Assumes the connection has already been switched by requesting a "shell,v2:" service.
+
+Unlike the legacy shell service, which returns the command's output as a raw stream with
+stdout and stderr interleaved, the shell protocol wraps every piece of data in a packet:
+
+	<id: 1 byte><length: 4 bytes, little-endian><data: length bytes>
+
+This allows stdin, stdout and stderr to be multiplexed over the same connection, and lets
+the device report the exit code of the command in a final exit packet, whose data is a
+single byte.
+
+The protocol is defined at
+https://android.googlesource.com/platform/packages/modules/adb/+/master/shell_protocol.h.
+*/
+type ShellConn struct {
+	ShellScanner
+	ShellSender
+}
+
+// Close closes both the sender and the scanner, and returns any errors.
+func (c ShellConn) Close() error {
+	return errors.CombineErrs("error closing ShellConn", errors.NetworkError,
+		c.ShellScanner.Close(), c.ShellSender.Close())
+}
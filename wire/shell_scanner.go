@@ -0,0 +1,61 @@
+package wire
+
+import (
+	"encoding/binary"
+	"io"
+
+	"github.com/mqhack/goadb/internal/errors"
+)
+
+// ShellMaxPacketSize is the largest amount of data in a single shell protocol packet. adbd
+// never sends larger packets, so ShellScanner rejects them rather than allocating for them.
+const ShellMaxPacketSize = 1024 * 1024
+
+type ShellScanner interface {
+	io.Closer
+	// ReadPacket reads the next shell protocol packet and returns its ID and data.
+	// Packets with more than ShellMaxPacketSize bytes of data are rejected.
+	ReadPacket() (id byte, data []byte, err error)
+}
+
+type realShellScanner struct {
+	io.Reader
+}
+
+func NewShellScanner(r io.Reader) ShellScanner {
+	return &realShellScanner{r}
+}
+
+func (s *realShellScanner) ReadPacket() (byte, []byte, error) {
+	header := make([]byte, 5)
+	n, err := io.ReadFull(s.Reader, header)
+	if err == io.EOF {
+		return 0, nil, errors.WrapErrorf(err, errors.ConnectionResetError, "shell stream closed")
+	} else if err == io.ErrUnexpectedEOF {
+		return 0, nil, errIncompleteMessage("shell packet header", n, len(header))
+	} else if err != nil {
+		return 0, nil, errors.WrapErrorf(err, errors.NetworkError, "error reading shell packet header")
+	}
+
+	id := header[0]
+	length := binary.LittleEndian.Uint32(header[1:])
+	if err := checkLength("shell packet", int(length), ShellMaxPacketSize); err != nil {
+		return id, nil, err
+	}
+
+	data := make([]byte, length)
+	n, err = io.ReadFull(s.Reader, data)
+	if err == io.ErrUnexpectedEOF || err == io.EOF {
+		return id, data, errIncompleteMessage("shell packet data", n, int(length))
+	} else if err != nil {
+		return id, data, errors.WrapErrorf(err, errors.NetworkError, "error reading shell packet data")
+	}
+	return id, data, nil
+}
+
+func (s *realShellScanner) Close() error {
+	if closer, ok := s.Reader.(io.Closer); ok {
+		return errors.WrapErrorf(closer.Close(), errors.NetworkError, "error closing shell scanner")
+	}
+	return nil
+}
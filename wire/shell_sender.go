@@ -0,0 +1,43 @@
+package wire
+
+import (
+	"encoding/binary"
+	"io"
+
+	"github.com/mqhack/goadb/internal/errors"
+)
+
+type ShellSender interface {
+	io.Closer
+	// SendPacket sends data in a single shell protocol packet with the given ID.
+	// If data is bigger than ShellMaxPacketSize, it returns an assertion error.
+	SendPacket(id byte, data []byte) error
+}
+
+type realShellSender struct {
+	io.Writer
+}
+
+func NewShellSender(w io.Writer) ShellSender {
+	return &realShellSender{w}
+}
+
+func (s *realShellSender) SendPacket(id byte, data []byte) error {
+	if len(data) > ShellMaxPacketSize {
+		return errors.AssertionErrorf("shell packet data must be <= %d in length", ShellMaxPacketSize)
+	}
+	// Send the header and data in a single write so packets from concurrent
+	// writers can't be interleaved on the wire.
+	packet := make([]byte, 5+len(data))
+	packet[0] = id
+	binary.LittleEndian.PutUint32(packet[1:], uint32(len(data)))
+	copy(packet[5:], data)
+	return writeFully(s.Writer, packet)
+}
+
+func (s *realShellSender) Close() error {
+	if closer, ok := s.Writer.(io.Closer); ok {
+		return errors.WrapErrorf(closer.Close(), errors.NetworkError, "error closing shell sender")
+	}
+	return nil
+}
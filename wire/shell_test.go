@@ -0,0 +1,69 @@
+package wire
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/mqhack/goadb/internal/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShellSendPacket(t *testing.T) {
+	var buf bytes.Buffer
+	s := NewShellSender(&buf)
+	err := s.SendPacket(ShellIDStdin, []byte("hello"))
+	assert.NoError(t, err)
+	assert.Equal(t, "\000\005\000\000\000hello", buf.String())
+}
+
+func TestShellSendEmptyPacket(t *testing.T) {
+	var buf bytes.Buffer
+	s := NewShellSender(&buf)
+	err := s.SendPacket(ShellIDCloseStdin, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "\004\000\000\000\000", buf.String())
+}
+
+func TestShellReadPacket(t *testing.T) {
+	s := NewShellScanner(strings.NewReader("\001\005\000\000\000hello\003\001\000\000\000\002"))
+
+	id, data, err := s.ReadPacket()
+	assert.NoError(t, err)
+	assert.Equal(t, ShellIDStdout, id)
+	assert.Equal(t, "hello", string(data))
+
+	id, data, err = s.ReadPacket()
+	assert.NoError(t, err)
+	assert.Equal(t, ShellIDExit, id)
+	assert.Equal(t, []byte{2}, data)
+
+	_, _, err = s.ReadPacket()
+	assert.True(t, errors.HasErrCode(err, errors.ConnectionResetError))
+}
+
+func TestShellReadPacketIncompleteHeader(t *testing.T) {
+	s := NewShellScanner(strings.NewReader("\001\005"))
+	_, _, err := s.ReadPacket()
+	assert.Equal(t, errIncompleteMessage("shell packet header", 2, 5), err)
+}
+
+func TestShellReadPacketIncompleteData(t *testing.T) {
+	s := NewShellScanner(strings.NewReader("\001\005\000\000\000he"))
+	_, _, err := s.ReadPacket()
+	assert.Equal(t, errIncompleteMessage("shell packet data", 2, 5), err)
+}
+
+func TestShellReadPacketTooLong(t *testing.T) {
+	s := NewShellScanner(strings.NewReader("\001\377\377\377\377"))
+	_, data, err := s.ReadPacket()
+	assert.Equal(t, checkLength("shell packet", 0xffffffff, ShellMaxPacketSize), err)
+	assert.Nil(t, data)
+}
+
+func TestShellSendPacketTooLong(t *testing.T) {
+	var buf bytes.Buffer
+	err := NewShellSender(&buf).SendPacket(ShellIDStdin, make([]byte, ShellMaxPacketSize+1))
+	assert.True(t, errors.HasErrCode(err, errors.AssertionError))
+	assert.Zero(t, buf.Len())
+}
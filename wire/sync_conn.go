@@ -3,8 +3,70 @@ package wire
 import "github.com/mqhack/goadb/internal/errors"
 
 const (
-	// Chunks cannot be longer than 64k.
+	// SyncMaxChunkSize is the largest amount of file data that can be sent in a single DATA
+	// packet. adbd rejects larger packets.
 	SyncMaxChunkSize = 64 * 1024
+
+	// SyncMaxPathLength is the longest path adbd accepts in a sync request.
+	SyncMaxPathLength = 1024
+)
+
+// Sync protocol request and response IDs. Each packet starts with one of these 4-byte
+// IDs, followed by a little-endian 32-bit length or value.
+const (
+	// Requests for the mode, size and mtime of a path. Responded to with SyncIDStat.
+	SyncIDStat = "STAT"
+	// Requests a directory listing. Responded to with a SyncIDDirEntry for each entry,
+	// then SyncIDDone.
+	SyncIDList = "LIST"
+	// Starts sending a file to the device. The path is followed by a comma and the
+	// decimal file mode, then the file is sent in SyncIDData packets, and finished with
+	// SyncIDDone carrying the mtime. The device responds with SyncIDOkay or SyncIDFail.
+	SyncIDSend = "SEND"
+	// Requests a file from the device, which is sent in SyncIDData packets, followed by
+	// SyncIDDone.
+	SyncIDReceive = "RECV"
+	// Ends the sync session.
+	SyncIDQuit = "QUIT"
+
+	// Requests for the stat of a path, following symlinks, on devices with the stat_v2
+	// feature. Unlike SyncIDStat, the response has 64-bit sizes and times, the file's owner,
+	// and an errno if the stat failed. Responded to with SyncIDStatV2.
+	SyncIDStatV2 = "STA2"
+	// Like SyncIDStatV2, but doesn't follow symlinks, like SyncIDStat. Responded to with
+	// SyncIDLstatV2.
+	SyncIDLstatV2 = "LST2"
+	// Requests a directory listing on devices with the ls_v2 feature. Responded to with a
+	// SyncIDDirEntryV2 for each entry, which has the same fields as a SyncIDStatV2, then
+	// SyncIDDone.
+	SyncIDListV2 = "LIS2"
+	// Starts sending a file on devices with the sendrecv_v2 feature. The path is followed by
+	// a second SyncIDSendV2 packet carrying the file mode, then a 32-bit SyncFlag selecting
+	// the compression of the data. The file is sent like SyncIDSend.
+	SyncIDSendV2 = "SND2"
+	// Requests a file on devices with the sendrecv_v2 feature. The path is followed by a
+	// second SyncIDReceiveV2 packet carrying a 32-bit SyncFlag selecting the compression of
+	// the data, which is sent like SyncIDReceive.
+	SyncIDReceiveV2 = "RCV2"
+
+	SyncIDDirEntry   = "DENT"
+	SyncIDDirEntryV2 = "DNT2"
+	SyncIDData       = StatusSyncData
+	SyncIDDone       = StatusSyncDone
+	SyncIDOkay       = StatusSuccess
+	// Reports an error, followed by the length of the error message and the message.
+	SyncIDFail = StatusFailure
+)
+
+// Flags of the v2 send and receive requests, which select the compression algorithm used for
+// the file data.
+const (
+	SyncFlagNone   uint32 = 0
+	SyncFlagBrotli uint32 = 1
+	SyncFlagLZ4    uint32 = 2
+	SyncFlagZstd   uint32 = 4
+	// Makes the device discard the file, for measuring throughput.
+	SyncFlagDryRun uint32 = 0x80000000
 )
 
 /*
@@ -13,15 +13,19 @@ type SyncScanner interface {
 	io.Closer
 	StatusReader
 	ReadInt32() (int32, error)
+	ReadUint32() (uint32, error)
+	ReadInt64() (int64, error)
 	ReadFileMode() (os.FileMode, error)
 	ReadTime() (time.Time, error)
 
 	// Reads an octet length, followed by length bytes.
+	// Lengths greater than SyncMaxChunkSize are rejected.
 	ReadString() (string, error)
 
 	// Reads an octet length, and returns a reader that will read length
 	// bytes (see io.LimitReader). The returned reader should be fully
 	// read before reading anything off the Scanner again.
+	// Lengths greater than SyncMaxChunkSize are rejected.
 	ReadBytes() (io.Reader, error)
 }
 
@@ -41,6 +45,18 @@ func (s *realSyncScanner) ReadInt32() (int32, error) {
 	value, err := readInt32(s.Reader)
 	return int32(value), errors.WrapErrorf(err, errors.NetworkError, "error reading int from sync scanner")
 }
+func (s *realSyncScanner) ReadUint32() (uint32, error) {
+	var value uint32
+	err := binary.Read(s.Reader, binary.LittleEndian, &value)
+	return value, errors.WrapErrorf(err, errors.NetworkError, "error reading int from sync scanner")
+}
+
+func (s *realSyncScanner) ReadInt64() (int64, error) {
+	var value int64
+	err := binary.Read(s.Reader, binary.LittleEndian, &value)
+	return value, errors.WrapErrorf(err, errors.NetworkError, "error reading int64 from sync scanner")
+}
+
 func (s *realSyncScanner) ReadFileMode() (os.FileMode, error) {
 	var value uint32
 	err := binary.Read(s.Reader, binary.LittleEndian, &value)
@@ -64,6 +80,9 @@ func (s *realSyncScanner) ReadString() (string, error) {
 	if err != nil {
 		return "", errors.WrapErrorf(err, errors.NetworkError, "error reading length from sync scanner")
 	}
+	if err := checkLength("string", int(length), SyncMaxChunkSize); err != nil {
+		return "", err
+	}
 
 	bytes := make([]byte, length)
 	n, rawErr := io.ReadFull(s.Reader, bytes)
@@ -80,6 +99,9 @@ func (s *realSyncScanner) ReadBytes() (io.Reader, error) {
 	if err != nil {
 		return nil, errors.WrapErrorf(err, errors.NetworkError, "error reading bytes from sync scanner")
 	}
+	if err := checkLength("bytes", int(length), SyncMaxChunkSize); err != nil {
+		return nil, err
+	}
 
 	return io.LimitReader(s.Reader, int64(length)), nil
 }
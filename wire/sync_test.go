@@ -60,6 +60,22 @@ func TestSyncReadStringTooShort(t *testing.T) {
 	assert.Equal(t, errIncompleteMessage("bytes", 1, 5), err)
 }
 
+func TestSyncReadStringInvalidLength(t *testing.T) {
+	s := NewSyncScanner(strings.NewReader("\377\377\377\377hello"))
+	_, err := s.ReadString()
+	assert.Equal(t, checkLength("string", -1, SyncMaxChunkSize), err)
+
+	s = NewSyncScanner(strings.NewReader("\001\000\001\000hello"))
+	_, err = s.ReadString()
+	assert.Equal(t, checkLength("string", SyncMaxChunkSize+1, SyncMaxChunkSize), err)
+}
+
+func TestSyncReadBytesInvalidLength(t *testing.T) {
+	s := NewSyncScanner(strings.NewReader("\000\000\000\200hello"))
+	_, err := s.ReadBytes()
+	assert.True(t, errors.HasErrCode(err, errors.NetworkError))
+}
+
 func TestSyncSendBytes(t *testing.T) {
 	var buf bytes.Buffer
 	s := NewSyncSender(&buf)
@@ -79,3 +95,16 @@ func TestSyncReadBytes(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, "hello", string(str))
 }
+
+func TestSyncReadUint32AndInt64(t *testing.T) {
+	s := NewSyncScanner(bytes.NewReader([]byte{0xff, 0xff, 0xff, 0xff, 0x00, 0x00, 0x00, 0x40, 0x01, 0x00, 0x00, 0x00}))
+	u, err := s.ReadUint32()
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(0xffffffff), u)
+	i, err := s.ReadInt64()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0x140000000), i)
+
+	_, err = s.ReadInt64()
+	assert.Equal(t, errors.NetworkError, err.(*errors.Err).Code)
+}
@@ -68,6 +68,25 @@ func errIncompleteMessage(description string, actual int, expected int) error {
 	}
 }
 
+// checkLength returns an error if length, read from the server, is negative or greater than
+// max. Lengths are checked before buffers are allocated for the data they prefix.
+func checkLength(description string, length int, max int) error {
+	if length < 0 || length > max {
+		return &errors.Err{
+			Code:    errors.NetworkError,
+			Message: fmt.Sprintf("invalid %s length %d: must be between 0 and %d", description, length, max),
+			Details: struct {
+				Length    int
+				MaxLength int
+			}{
+				Length:    length,
+				MaxLength: max,
+			},
+		}
+	}
+	return nil
+}
+
 // writeFully writes all of data to w.
 // Inverse of io.ReadFully().
 func writeFully(w io.Writer, data []byte) error {